@@ -22,6 +22,9 @@ import (
 	"github.com/brokercap/Bifrost/config"
 	"github.com/brokercap/Bifrost/plugin"
 	"github.com/brokercap/Bifrost/server"
+	"github.com/brokercap/Bifrost/server/cluster"
+	"github.com/brokercap/Bifrost/server/history"
+	"github.com/brokercap/Bifrost/server/user"
 	"io"
 	"io/ioutil"
 	"log"
@@ -161,11 +164,30 @@ func main() {
 	WritePid()
 
 	plugin.DoDynamicPlugin()
+	// 初始化用户的时候需要用配置的方式 hash 密码
+	user.InitAuth()
 	server.InitStorage()
+	cluster.Init()
+	cluster.InitShard()
 
 	log.Println("Server started, Bifrost version", config.VERSION)
 
-	doRecovery()
+	// 没有开启 ha 的时候直接启动, 开启之后只有 leader 才启动数据源和同步
+	cluster.Start(cluster.Handler{
+		OnElected: func() {
+			doRecovery()
+			server.StartWarningRuleCheck()
+		},
+		OnRevoked: doRevoked,
+		OnStandby: server.LoadStandbySnapshotData,
+	})
+	// 开启 shard 之后, 数据源分配到当前节点的时候才加载
+	cluster.StartShard(cluster.ShardHandler{
+		GetDbList:  server.GetShardDbNameList,
+		OnAssigned: doShardAssigned,
+		OnRevoked:  doShardRevoked,
+		OnFollower: server.LoadStandbySnapshotData,
+	})
 
 	go manager.Start()
 	ListenSignal()
@@ -233,11 +255,44 @@ func doSaveDbInfo() {
 	if os.Getppid() != 1 && BifrostDaemon {
 		return
 	}
+	// standby 没有加载数据源, 不能覆盖 leader 保存的配置
+	if !cluster.IsLeader() {
+		return
+	}
 	server.DoSaveSnapshotData()
 }
 
 func doRecovery() {
 	server.DoRecoverySnapshotData()
+	// shard 模式下任务跟着数据源一起加载
+	if cluster.ShardEnable() {
+		return
+	}
+	history.RecoveryHistory()
+	history.RecoveryIncrementalSnapshot()
+	history.RecoveryVerifyTask()
+}
+
+func doShardAssigned(dbName string) error {
+	if err := server.LoadShardDB(dbName); err != nil {
+		return err
+	}
+	history.RecoveryDb(dbName)
+	return nil
+}
+
+func doShardRevoked(dbName string) {
+	history.UnloadDb(dbName)
+	server.UnloadShardDB(dbName)
+}
+
+// 失去 leader 之后, 别的节点可能已经接管, 马上停止所有数据源和任务, 回到 standby
+// 元数据的写入已经被 fencing token 拦住, 这里不保存配置
+func doRevoked() {
+	for dbName := range server.GetListDb() {
+		history.UnloadDb(dbName)
+	}
+	server.UnloadAllDB()
 }
 
 func doSeverDbInfoFun() {
@@ -255,6 +310,8 @@ func doSeverDbInfoFun() {
 	}
 	server.StopAllChannel()
 	doSaveDbInfo()
+	cluster.Release()
+	cluster.ReleaseShard()
 	saveDbInfoStatus = true
 	server.Close()
 	log.Println("save db server info data success! ")
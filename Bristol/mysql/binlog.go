@@ -114,6 +114,7 @@ func (This *BinlogDump) StartDumpBinlog0() {
 	log.Println(This.DataSource+" start DumpBinlog... gtid:", This.parser.getGtid(), " binlogFileName:", This.parser.binlogFileName, " binlogPosition:", This.parser.binlogPosition)
 	defer func() {
 		This.parser.ParserConnClose(true)
+		This.parser.closePayloadDecoder()
 	}()
 
 	var first = true
@@ -171,6 +172,42 @@ func (This *BinlogDump) checksumEnabled() {
 	return
 }
 
+// binlog_row_value_options=PARTIAL_JSON 的时候，json diff 需要基于 before image 还原
+// binlog_row_image 不是 FULL 的时候，before image 中可能没有 json 字段，无法还原出完整的数据，所以拒绝同步
+func (This *BinlogDump) checkRowValueOptions() error {
+	sql := "SHOW GLOBAL VARIABLES WHERE Variable_name IN ('binlog_row_image','binlog_row_value_options')"
+	stmt, err := This.mysqlConn.Prepare(sql)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	p := make([]driver.Value, 0)
+	rows, err := stmt.Query(p)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	variables := make(map[string]string, 2)
+	for {
+		dest := make([]driver.Value, 2, 2)
+		if err = rows.Next(dest); err != nil {
+			break
+		}
+		variables[strings.ToLower(fmt.Sprint(dest[0]))] = fmt.Sprint(dest[1])
+	}
+	return checkPartialJsonRowImage(variables)
+}
+
+func checkPartialJsonRowImage(variables map[string]string) error {
+	if !strings.Contains(strings.ToUpper(variables["binlog_row_value_options"]), "PARTIAL_JSON") {
+		return nil
+	}
+	if rowImage := strings.ToUpper(variables["binlog_row_image"]); rowImage != "FULL" {
+		return fmt.Errorf("binlog_row_value_options=PARTIAL_JSON need binlog_row_image=FULL, but binlog_row_image=%s", rowImage)
+	}
+	return nil
+}
+
 func (This *BinlogDump) BinlogConnCLose(lock bool) {
 	if lock == true {
 		This.Lock()
@@ -251,6 +288,12 @@ func (This *BinlogDump) startConnAndDumpBinlog() {
 	if connectionId == "" {
 		return
 	}
+	if err = This.checkRowValueOptions(); err != nil {
+		log.Println("binlog checkRowValueOptions err:", err)
+		This.BinlogConnCLose(true)
+		This.parser.callbackErrChan <- err
+		return
+	}
 	This.parser.callbackErrChan <- fmt.Errorf(StatusFlagName(STATUS_RUNNING))
 	This.parser.connectionId = connectionId
 	ctx, cancelFun := context.WithCancel(This.context.ctx)
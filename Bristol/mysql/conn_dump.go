@@ -97,6 +97,7 @@ func (mc *mysqlConn) DumpBinlogMariaDBGtid(parser *eventParser, callbackFun call
 func (mc *mysqlConn) DumpBinlog0(parser *eventParser, callbackFun callback) (driver.Rows, error) {
 	var isDDL bool
 	var commitEventOk bool
+dumpLoop:
 	for {
 		parser.binlogDump.RLock()
 		if parser.dumpBinLogStatus != STATUS_RUNNING {
@@ -123,167 +124,186 @@ func (mc *mysqlConn) DumpBinlog0(parser *eventParser, callbackFun callback) (dri
 			//continue
 		}
 		if pkt[0] == 0 {
-			isDDL = false
-			var event *EventReslut
+			var eventDataList [][]byte
 			func() {
 				defer func() {
 					if err := recover(); err != nil {
-						e = fmt.Errorf("parseEvent err recover err:%s ;lastMapEvent:%T ;binlogFileName:%s ;binlogPosition:%d", fmt.Sprint(err), parser.lastMapEvent, parser.binlogFileName, parser.binlogPosition)
+						e = fmt.Errorf("splitEventPacket err recover err:%s ;binlogFileName:%s ;binlogPosition:%d", fmt.Sprint(err), parser.binlogFileName, parser.binlogPosition)
 						log.Println(string(debug.Stack()))
 					}
 				}()
-				event, _, e = parser.parseEvent(pkt[1:])
+				eventDataList, e = parser.splitEventPacket(pkt[1:])
 			}()
 			if e != nil {
-				//假如解析异常 ,就直接close掉
-				e = fmt.Errorf("parseEvent err:" + e.Error())
+				e = fmt.Errorf("splitEventPacket err:" + e.Error())
 				fmt.Println(e)
 				parser.callbackErrChan <- e
 				return nil, e
 			}
-			if event == nil {
-				continue
-			}
-			if parser.maxBinlogFileName != "" {
-				if event.BinlogFileName == parser.maxBinlogFileName && event.Header.LogPos >= parser.maxBinlogPosition {
-					parser.binlogDump.Lock()
-					parser.dumpBinLogStatus = STATUS_CLOSED
-					parser.binlogDump.Unlock()
-					break
+			for _, eventData := range eventDataList {
+				isDDL = false
+				var event *EventReslut
+				func() {
+					defer func() {
+						if err := recover(); err != nil {
+							e = fmt.Errorf("parseEvent err recover err:%s ;lastMapEvent:%T ;binlogFileName:%s ;binlogPosition:%d", fmt.Sprint(err), parser.lastMapEvent, parser.binlogFileName, parser.binlogPosition)
+							log.Println(string(debug.Stack()))
+						}
+					}()
+					event, _, e = parser.parseEvent(eventData)
+				}()
+				if e != nil {
+					//假如解析异常 ,就直接close掉
+					e = fmt.Errorf("parseEvent err:" + e.Error())
+					fmt.Println(e)
+					parser.callbackErrChan <- e
+					return nil, e
 				}
-			}
-			//log.Println("event.Header.EventType：", event.Header.EventType, event.Header.EventName(), event.Query)
-			event.EventID = parser.getNextEventID()
-			switch event.Header.EventType {
-			//这里要判断一下如果是row事件
-			//在map event的时候已经判断过了是否要过滤，所以判断一下 parser.filterNextRowEvent 是否为true
-			case WRITE_ROWS_EVENTv0, WRITE_ROWS_EVENTv1, WRITE_ROWS_EVENTv2, UPDATE_ROWS_EVENTv0, UPDATE_ROWS_EVENTv1, UPDATE_ROWS_EVENTv2, DELETE_ROWS_EVENTv0, DELETE_ROWS_EVENTv1, DELETE_ROWS_EVENTv2:
-				if parser.filterNextRowEvent == true {
+				if event == nil {
 					continue
 				}
-				break
-			case QUERY_EVENT:
-				parser.saveBinlog(event)
-				if event.Query == "COMMIT" {
-					if !commitEventOk {
+				if parser.maxBinlogFileName != "" {
+					if event.BinlogFileName == parser.maxBinlogFileName && event.Header.LogPos >= parser.maxBinlogPosition {
+						parser.binlogDump.Lock()
+						parser.dumpBinLogStatus = STATUS_CLOSED
+						parser.binlogDump.Unlock()
+						break dumpLoop
+					}
+				}
+				//log.Println("event.Header.EventType：", event.Header.EventType, event.Header.EventName(), event.Query)
+				event.EventID = parser.getNextEventID()
+				switch event.Header.EventType {
+				//这里要判断一下如果是row事件
+				//在map event的时候已经判断过了是否要过滤，所以判断一下 parser.filterNextRowEvent 是否为true
+				case WRITE_ROWS_EVENTv0, WRITE_ROWS_EVENTv1, WRITE_ROWS_EVENTv2, UPDATE_ROWS_EVENTv0, UPDATE_ROWS_EVENTv1, UPDATE_ROWS_EVENTv2, DELETE_ROWS_EVENTv0, DELETE_ROWS_EVENTv1, DELETE_ROWS_EVENTv2:
+					if parser.filterNextRowEvent == true {
 						continue
 					}
 					break
-				}
-				// # Dumm
-				// # Dummy e
-				// # Dum
-				// # Dummy event replacing event type 16
-				// mariadb Dumm 内容事件,这种内容的事件，直接过滤掉，不展示给上层
-				if event.Query[0:1] == "#" {
-					continue
-				}
-
-				//only return replicateDoDb, any sql may be use db.table query
-				var SchemaName, tableName string
-				var noReloadTableInfo bool
-				if SchemaName, tableName, noReloadTableInfo, isDDL = parser.GetQueryTableName(event.Query); tableName != "" {
-					if SchemaName != "" {
-						event.SchemaName = SchemaName
+				case QUERY_EVENT:
+					parser.saveBinlog(event)
+					if event.Query == "COMMIT" {
+						if !commitEventOk {
+							continue
+						}
+						break
 					}
-					event.TableName = tableName
-				}
-				if event.TableName != "" {
-					if parser.binlogDump.CheckReplicateDb(event.SchemaName, event.TableName) == false {
-						//parser.saveBinlog(event)
+					// # Dumm
+					// # Dummy e
+					// # Dum
+					// # Dummy event replacing event type 16
+					// mariadb Dumm 内容事件,这种内容的事件，直接过滤掉，不展示给上层
+					if event.Query[0:1] == "#" {
 						continue
 					}
-					if noReloadTableInfo {
-						// 假如 是rename,drop table 等操作 操作的 ddl,需要将 SchemaName,TableName 对应的缓存数据删除，因为表名变了，TableId 也变了
-						parser.delTableId(event.SchemaName, event.TableName)
-					} else {
-						if tableId, err := parser.GetTableId(event.SchemaName, event.TableName); err == nil {
-							parser.GetTableSchema(tableId, event.SchemaName, event.TableName)
+
+					//only return replicateDoDb, any sql may be use db.table query
+					var SchemaName, tableName string
+					var noReloadTableInfo bool
+					if SchemaName, tableName, noReloadTableInfo, isDDL = parser.GetQueryTableName(event.Query); tableName != "" {
+						if SchemaName != "" {
+							event.SchemaName = SchemaName
+						}
+						event.TableName = tableName
+					}
+					if event.TableName != "" {
+						if parser.binlogDump.CheckReplicateDb(event.SchemaName, event.TableName) == false {
+							//parser.saveBinlog(event)
+							continue
+						}
+						if noReloadTableInfo {
+							// 假如 是rename,drop table 等操作 操作的 ddl,需要将 SchemaName,TableName 对应的缓存数据删除，因为表名变了，TableId 也变了
+							parser.delTableId(event.SchemaName, event.TableName)
+						} else {
+							// 表结构是从 binlog optional metadata 中解析出来的，下一个 table map event 会带上新的表结构，不需要再去查询
+							if tableId, err := parser.GetTableId(event.SchemaName, event.TableName); err == nil && !parser.isTableSchemaFromMetadata(tableId) {
+								parser.GetTableSchema(tableId, event.SchemaName, event.TableName)
+							}
 						}
+						break
 					}
+					// 假如 drop database schemaName 这样的语句，只有 SchemaName，而没有 TableName的，则匹配是否要过滤整个库
+					if event.SchemaName != "" {
+						if parser.binlogDump.CheckReplicateDb(event.SchemaName, "*") == false {
+							//parser.saveBinlog(event)
+							continue
+						}
+					}
+					commitEventOk = true
 					break
-				}
-				// 假如 drop database schemaName 这样的语句，只有 SchemaName，而没有 TableName的，则匹配是否要过滤整个库
-				if event.SchemaName != "" {
-					if parser.binlogDump.CheckReplicateDb(event.SchemaName, "*") == false {
-						//parser.saveBinlog(event)
+				case XID_EVENT:
+					parser.saveBinlog(event)
+					// 假如整个事务期间，所有表都被过滤了，没有任何一个表的数据需要被同步，则表示可以直接跳过这个事务，当前这个 XID 事件也不需要返回给上一层
+					if !commitEventOk {
+						continue
+					}
+					break
+				case TABLE_MAP_EVENT:
+					break
+				default:
+					if event.TableName != "" && parser.binlogDump.CheckReplicateDb(event.SchemaName, event.TableName) == false {
+						parser.saveBinlog(event)
+						continue
+					}
+					if parser.eventDo[int(event.Header.EventType)] {
+						commitEventOk = true
+					} else {
 						continue
 					}
 				}
-				commitEventOk = true
-				break
-			case XID_EVENT:
-				parser.saveBinlog(event)
-				// 假如整个事务期间，所有表都被过滤了，没有任何一个表的数据需要被同步，则表示可以直接跳过这个事务，当前这个 XID 事件也不需要返回给上一层
-				if !commitEventOk {
-					continue
-				}
-				break
-			case TABLE_MAP_EVENT:
-				break
-			default:
-				if event.TableName != "" && parser.binlogDump.CheckReplicateDb(event.SchemaName, event.TableName) == false {
+
+				//only return EventType by set
+				if parser.eventDo[int(event.Header.EventType)] == false {
 					parser.saveBinlog(event)
 					continue
 				}
-				if parser.eventDo[int(event.Header.EventType)] {
-					commitEventOk = true
-				} else {
-					continue
-				}
-			}
-
-			//only return EventType by set
-			if parser.eventDo[int(event.Header.EventType)] == false {
-				parser.saveBinlog(event)
-				continue
-			}
-			//log.Println(event.BinlogFileName,event.BinlogPosition,event.Gtid,event.EventID,event.Header.EventName())
-			// no commit event after ddl
-			// so we need need callback a begin event and a commit event
-			if isDDL {
-				beginEvent := &EventReslut{
-					Header:         event.Header,
-					TableName:      event.TableName,
-					SchemaName:     event.SchemaName,
-					Query:          "BEGIN",
-					EventID:        event.EventID,
-					Rows:           nil,
-					BinlogFileName: event.BinlogFileName,
-					BinlogPosition: event.BinlogPosition,
-					Gtid:           "",
-					Pri:            nil,
-					ColumnMapping:  nil,
-				}
-				beginEvent.Header.EventType = QUERY_EVENT
-				commitEvent := &EventReslut{
-					Header:         event.Header,
-					TableName:      event.TableName,
-					SchemaName:     event.SchemaName,
-					Query:          "COMMIT",
-					EventID:        event.EventID,
-					Rows:           nil,
-					BinlogFileName: event.BinlogFileName,
-					BinlogPosition: event.BinlogPosition,
-					Gtid:           parser.getGtid(),
-					Pri:            nil,
-					ColumnMapping:  nil,
-				}
-				commitEvent.Header.EventType = XID_EVENT
-				callbackFun(beginEvent)
-				callbackFun(event)
-				callbackFun(commitEvent)
-				parser.saveBinlog(commitEvent)
-				commitEventOk = false
-			} else {
-				callbackFun(event)
-				parser.saveBinlog(event)
-				switch event.Header.EventType {
-				case WRITE_ROWS_EVENTv0, WRITE_ROWS_EVENTv1, WRITE_ROWS_EVENTv2, UPDATE_ROWS_EVENTv0, UPDATE_ROWS_EVENTv1, UPDATE_ROWS_EVENTv2, DELETE_ROWS_EVENTv0, DELETE_ROWS_EVENTv1, DELETE_ROWS_EVENTv2:
-					commitEventOk = true
-					break
-				default:
+				//log.Println(event.BinlogFileName,event.BinlogPosition,event.Gtid,event.EventID,event.Header.EventName())
+				// no commit event after ddl
+				// so we need need callback a begin event and a commit event
+				if isDDL {
+					beginEvent := &EventReslut{
+						Header:         event.Header,
+						TableName:      event.TableName,
+						SchemaName:     event.SchemaName,
+						Query:          "BEGIN",
+						EventID:        event.EventID,
+						Rows:           nil,
+						BinlogFileName: event.BinlogFileName,
+						BinlogPosition: event.BinlogPosition,
+						Gtid:           "",
+						Pri:            nil,
+						ColumnMapping:  nil,
+					}
+					beginEvent.Header.EventType = QUERY_EVENT
+					commitEvent := &EventReslut{
+						Header:         event.Header,
+						TableName:      event.TableName,
+						SchemaName:     event.SchemaName,
+						Query:          "COMMIT",
+						EventID:        event.EventID,
+						Rows:           nil,
+						BinlogFileName: event.BinlogFileName,
+						BinlogPosition: event.BinlogPosition,
+						Gtid:           parser.getGtid(),
+						Pri:            nil,
+						ColumnMapping:  nil,
+					}
+					commitEvent.Header.EventType = XID_EVENT
+					callbackFun(beginEvent)
+					callbackFun(event)
+					callbackFun(commitEvent)
+					parser.saveBinlog(commitEvent)
 					commitEventOk = false
+				} else {
+					callbackFun(event)
+					parser.saveBinlog(event)
+					switch event.Header.EventType {
+					case WRITE_ROWS_EVENTv0, WRITE_ROWS_EVENTv1, WRITE_ROWS_EVENTv2, UPDATE_ROWS_EVENTv0, UPDATE_ROWS_EVENTv1, UPDATE_ROWS_EVENTv2, DELETE_ROWS_EVENTv0, DELETE_ROWS_EVENTv1, DELETE_ROWS_EVENTv2:
+						commitEventOk = true
+						break
+					default:
+						commitEventOk = false
+					}
 				}
 			}
 		} else {
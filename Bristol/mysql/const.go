@@ -177,6 +177,8 @@ const (
 	TRANSACTION_CONTEXT_EVENT                  // 36
 	VIEW_CHANGE_EVENT                          // 37
 	XA_PREPARE_LOG_EVENT                       // 38
+	PARTIAL_UPDATE_ROWS_EVENT                  // 39
+	TRANSACTION_PAYLOAD_EVENT                  // 40
 )
 
 const (
@@ -211,6 +213,20 @@ const (
 	LOG_EVENT_MTS_ISOLATE_F
 )
 
+// TRANSACTION_PAYLOAD_EVENT 头部字段类型
+// https://dev.mysql.com/doc/dev/mysql-server/latest/classmysql_1_1binlog_1_1event_1_1Transaction__payload__event.html
+const (
+	PAYLOAD_HEADER_END_MARK         = 0
+	PAYLOAD_SIZE_FIELD              = 1
+	PAYLOAD_COMPRESSION_TYPE_FIELD  = 2
+	PAYLOAD_UNCOMPRESSED_SIZE_FIELD = 3
+	PAYLOAD_COMPRESSION_TYPE_ZSTD   = 0
+	PAYLOAD_COMPRESSION_TYPE_NONE   = 255
+)
+
+// binlog_row_value_options
+const BINLOG_ROW_VALUE_OPTIONS_PARTIAL_JSON_UPDATES = 1
+
 type StatusFlag int8
 
 const (
@@ -21,6 +21,7 @@ type RowsEvent struct {
 	columnsPresentBitmap1 Bitfield
 	columnsPresentBitmap2 Bitfield
 	rows                  []map[string]interface{}
+	presentColumns        [][]string // binlog_row_image 不是 FULL 的时候，每一行实际存在的字段,全部字段都存在的时候为 nil
 }
 
 func (parser *eventParser) parseRowsEvent(buf *bytes.Buffer) (event *RowsEvent, err error) {
@@ -39,7 +40,7 @@ func (parser *eventParser) parseRowsEvent(buf *bytes.Buffer) (event *RowsEvent,
 	event.tableId, err = readFixedLengthInteger(buf, tableIdSize)
 	err = binary.Read(buf, binary.LittleEndian, &event.flags)
 	switch event.header.EventType {
-	case UPDATE_ROWS_EVENTv2, WRITE_ROWS_EVENTv2, DELETE_ROWS_EVENTv2:
+	case UPDATE_ROWS_EVENTv2, WRITE_ROWS_EVENTv2, DELETE_ROWS_EVENTv2, PARTIAL_UPDATE_ROWS_EVENT:
 		//err = binary.Read(buf, binary.LittleEndian, &event.flags)
 		extraDataLength, _ := readFixedLengthInteger(buf, 2)
 		buf.Next(int(extraDataLength) - 2)
@@ -50,38 +51,129 @@ func (parser *eventParser) parseRowsEvent(buf *bytes.Buffer) (event *RowsEvent,
 
 	event.columnsPresentBitmap1 = Bitfield(buf.Next(int((columnCount + 7) / 8)))
 	switch event.header.EventType {
-	case UPDATE_ROWS_EVENTv1, UPDATE_ROWS_EVENTv2:
+	case UPDATE_ROWS_EVENTv1, UPDATE_ROWS_EVENTv2, PARTIAL_UPDATE_ROWS_EVENT:
 		event.columnsPresentBitmap2 = Bitfield(buf.Next(int((columnCount + 7) / 8)))
 	}
 	//假如 map event 已经过滤了当前库，则直接不再解析
 	if parser.filterNextRowEvent == true {
 		return
 	}
+	tableMap := parser.tableMap[event.tableId]
+	tableSchemaMap := parser.tableSchemaMap[event.tableId].ColumnSchemaTypeList
+	// binlog_row_image=MINIMAL,NOBLOB 的时候，没有在 present bitmap 中的字段是不会记录在 binlog 里的
+	presentColumns1 := getPresentColumns(event.columnsPresentBitmap1, tableSchemaMap, int(columnCount))
+	presentColumns2 := presentColumns1
+	if event.columnsPresentBitmap2 != nil {
+		presentColumns2 = getPresentColumns(event.columnsPresentBitmap2, tableSchemaMap, int(columnCount))
+	}
+	isFullRowImage := presentColumns1 == nil && presentColumns2 == nil
 	for buf.Len() > 0 {
 		var row map[string]interface{}
-		row, err = parser.parseEventRow(buf, parser.tableMap[event.tableId], parser.tableSchemaMap[event.tableId].ColumnSchemaTypeList)
+		// update 事件 before image 和 after image 交替出现
+		isAfterImage := event.columnsPresentBitmap2 != nil && len(event.rows)%2 == 1
+		presentBitmap, presentColumns := event.columnsPresentBitmap1, presentColumns1
+		if isAfterImage {
+			presentBitmap, presentColumns = event.columnsPresentBitmap2, presentColumns2
+		}
+		// PARTIAL_UPDATE_ROWS_EVENT 的 after image 中 json 字段可能只记录了修改的部分，需要基于 before image 还原出完整的 json
+		if event.header.EventType == PARTIAL_UPDATE_ROWS_EVENT && isAfterImage {
+			row, err = parser.parsePartialUpdateEventRow(buf, tableMap, tableSchemaMap, presentBitmap, event.rows[len(event.rows)-1])
+		} else {
+			row, err = parser.parseEventRowImage(buf, tableMap, tableSchemaMap, presentBitmap, nil, nil)
+		}
 		if err != nil {
 			log.Println("event row parser err:", err)
 			return
 		}
 		event.rows = append(event.rows, row)
+		if !isFullRowImage {
+			event.presentColumns = append(event.presentColumns, presentColumns)
+		}
 	}
 
 	return
 }
 
+// 将 present bitmap 转成字段名列表，所有字段都存在的情况下返回 nil
+func getPresentColumns(presentBitmap Bitfield, tableSchemaMap []*ColumnInfo, columnCount int) (presentColumns []string) {
+	if columnCount > len(tableSchemaMap) {
+		columnCount = len(tableSchemaMap)
+	}
+	var isFull = true
+	for i := 0; i < columnCount; i++ {
+		if presentBitmap.isSet(uint(i)) {
+			presentColumns = append(presentColumns, tableSchemaMap[i].COLUMN_NAME)
+		} else {
+			isFull = false
+		}
+	}
+	if isFull {
+		return nil
+	}
+	if presentColumns == nil {
+		presentColumns = make([]string, 0)
+	}
+	return
+}
+
 func (parser *eventParser) parseEventRow(buf *bytes.Buffer, tableMap *TableMapEvent, tableSchemaMap []*ColumnInfo) (row map[string]interface{}, e error) {
+	return parser.parseEventRowImage(buf, tableMap, tableSchemaMap, nil, nil, nil)
+}
+
+// binlog_row_value_options=PARTIAL_JSON 的时候，after image 在 null bitmap 之前 多了 value_options 和 partial bitmap
+// partial bitmap 中每一个 json 字段(不管有没有在 present bitmap 中)对应一个 bit,为 1 的字段记录的是 json diff
+func (parser *eventParser) parsePartialUpdateEventRow(buf *bytes.Buffer, tableMap *TableMapEvent, tableSchemaMap []*ColumnInfo, presentBitmap Bitfield, beforeRow map[string]interface{}) (row map[string]interface{}, e error) {
+	var valueOptions uint64
+	valueOptions, _, e = readLengthEncodedInt(buf)
+	if e != nil {
+		return nil, e
+	}
+	var partialBitmap Bitfield
+	if valueOptions&BINLOG_ROW_VALUE_OPTIONS_PARTIAL_JSON_UPDATES != 0 {
+		var jsonColumnCount int
+		for _, t := range tableMap.columnTypes {
+			if t == FIELD_TYPE_JSON {
+				jsonColumnCount++
+			}
+		}
+		partialBitmap = Bitfield(buf.Next((jsonColumnCount + 7) / 8))
+	}
+	return parser.parseEventRowImage(buf, tableMap, tableSchemaMap, presentBitmap, partialBitmap, beforeRow)
+}
+
+// presentBitmap 为 nil 的时候，代表所有字段都存在
+// null bitmap 只包含 present bitmap 中存在的字段
+func (parser *eventParser) parseEventRowImage(buf *bytes.Buffer, tableMap *TableMapEvent, tableSchemaMap []*ColumnInfo, presentBitmap Bitfield, partialBitmap Bitfield, beforeRow map[string]interface{}) (row map[string]interface{}, e error) {
 	columnsCount := len(tableMap.columnTypes)
 	row = make(map[string]interface{})
-	bitfieldSize := (columnsCount + 7) / 8
+	var jsonColumnIndex uint
+	var presentCount int
+	for i := 0; i < columnsCount; i++ {
+		if presentBitmap == nil || presentBitmap.isSet(uint(i)) {
+			presentCount++
+		}
+	}
+	bitfieldSize := (presentCount + 7) / 8
 	nullBitMap := Bitfield(buf.Next(bitfieldSize))
+	var nullIndex uint
 	if columnsCount > len(tableSchemaMap) {
 		log.Println("parseEventRow len(tableSchemaMap)=", len(tableSchemaMap), " < ", "columnsCount:", columnsCount, " tableMap:", *tableMap)
 	}
 	for i := 0; i < columnsCount; i++ {
 		column_name := tableSchemaMap[i].COLUMN_NAME
+		var isPartialJson bool
+		if tableMap.columnTypes[i] == FIELD_TYPE_JSON {
+			isPartialJson = partialBitmap != nil && partialBitmap.isSet(jsonColumnIndex)
+			jsonColumnIndex++
+		}
+		// 不在 present bitmap 中的字段，不放到 row 里，和 null 值区分开
+		if presentBitmap != nil && !presentBitmap.isSet(uint(i)) {
+			continue
+		}
 		//log.Println("column_name:",column_name,tableSchemaMap[i].DATA_TYPE)
-		if nullBitMap.isSet(uint(i)) {
+		isNull := nullBitMap.isSet(nullIndex)
+		nullIndex++
+		if isNull {
 			row[column_name] = nil
 			continue
 		}
@@ -585,6 +677,15 @@ func (parser *eventParser) parseEventRow(buf *bytes.Buffer, tableMap *TableMapEv
 			var length uint64
 			length, e = readFixedLengthInteger(buf, int(tableMap.columnMetaData[i].length_size))
 			data := buf.Next(int(length))
+			if isPartialJson {
+				before, ok := beforeRow[column_name]
+				if !ok {
+					e = fmt.Errorf("column %s json diff without before image", column_name)
+					break
+				}
+				row[column_name], e = apply_json_diff(before, data)
+				break
+			}
 			row[column_name], e = get_field_json_data(data, int64(length))
 			break
 		default:
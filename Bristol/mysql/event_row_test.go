@@ -0,0 +1,282 @@
+package mysql
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+const partialJsonTestTableId uint64 = 110
+const rowImageTestTableId uint64 = 111
+
+func rowTestEventData(eventType EventType, body []byte) []byte {
+	header := EventHeader{
+		Timestamp: 1700000000,
+		EventType: eventType,
+		ServerId:  1,
+		EventSize: uint32(19 + len(body)),
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, header)
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+func newRowTestParser() *eventParser {
+	binlogDump := NewBinlogDump("", nil, nil, nil, nil)
+	parser := binlogDump.parser
+	dataSource := ""
+	parser.dataSource = &dataSource
+	parser.currentBinlogFileName = "mysql-bin.000001"
+	parser.gtidSetInfo = NewMySQLGtidSet("")
+	headerLengths := make([]uint8, 40)
+	headerLengths[TABLE_MAP_EVENT-1] = 8
+	headerLengths[WRITE_ROWS_EVENTv2-1] = 10
+	headerLengths[UPDATE_ROWS_EVENTv2-1] = 10
+	headerLengths[PARTIAL_UPDATE_ROWS_EVENT-1] = 10
+	parser.format = &FormatDescriptionEvent{eventTypeHeaderLengths: headerLengths}
+	parser.tableSchemaMap[partialJsonTestTableId] = &tableStruct{
+		SchemaName: "bifrost_test",
+		TableName:  "partial_json_test",
+		Pri:        []string{"id"},
+		ColumnSchemaTypeList: []*ColumnInfo{
+			{COLUMN_NAME: "id", COLUMN_KEY: "PRI", COLUMN_TYPE: "int(11)", DATA_TYPE: "int", IsPrimary: true},
+			{COLUMN_NAME: "doc", COLUMN_TYPE: "json", DATA_TYPE: "json"},
+		},
+	}
+	parser.tableSchemaMap[rowImageTestTableId] = &tableStruct{
+		SchemaName: "bifrost_test",
+		TableName:  "row_image_test",
+		Pri:        []string{"id"},
+		ColumnSchemaTypeList: []*ColumnInfo{
+			{COLUMN_NAME: "id", COLUMN_KEY: "PRI", COLUMN_TYPE: "int(11)", DATA_TYPE: "int", IsPrimary: true},
+			{COLUMN_NAME: "name", COLUMN_TYPE: "varchar(20)", DATA_TYPE: "varchar", CHARACTER_OCTET_LENGTH: 80},
+		},
+		ColumnMapping: map[string]string{"id": "int32", "name": "Nullable(varchar(20))"},
+	}
+	return parser
+}
+
+// bifrost_test.partial_json_test (id int, doc json)
+func partialJsonTestTableMapEventData() []byte {
+	var body bytes.Buffer
+	body.Write(uint64ToBytes(partialJsonTestTableId)[0:6])
+	body.Write([]byte{1, 0})
+	body.WriteByte(byte(len("bifrost_test")))
+	body.WriteString("bifrost_test")
+	body.WriteByte(0)
+	body.WriteByte(byte(len("partial_json_test")))
+	body.WriteString("partial_json_test")
+	body.WriteByte(0)
+	body.WriteByte(2)
+	body.Write([]byte{byte(FIELD_TYPE_LONG), byte(FIELD_TYPE_JSON)})
+	body.WriteByte(1)
+	body.WriteByte(4)
+	body.WriteByte(0x02)
+	return rowTestEventData(TABLE_MAP_EVENT, body.Bytes())
+}
+
+func partialJsonTestRowData(id int32, jsonData []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(0x00)
+	binary.Write(&buf, binary.LittleEndian, id)
+	binary.Write(&buf, binary.LittleEndian, uint32(len(jsonData)))
+	buf.Write(jsonData)
+	return buf.Bytes()
+}
+
+func partialJsonTestUpdateRowsEventData() []byte {
+	var body bytes.Buffer
+	body.Write(uint64ToBytes(partialJsonTestTableId)[0:6])
+	body.Write([]byte{1, 0})
+	body.Write([]byte{2, 0})
+	body.WriteByte(2)
+	body.WriteByte(0x03)
+	body.WriteByte(0x03)
+	// before image: {"a":"x"}
+	beforeJson := []byte{JSONB_TYPE_SMALL_OBJECT, 1, 0, 14, 0, 11, 0, 1, 0, JSONB_TYPE_STRING, 12, 0, 'a', 1, 'x'}
+	body.Write(partialJsonTestRowData(1, beforeJson))
+	// after image: value_options + partial bitmap + json diff
+	body.Write(lengthCodedBinaryToBytes(BINLOG_ROW_VALUE_OPTIONS_PARTIAL_JSON_UPDATES))
+	body.WriteByte(0x01)
+	var diff []byte
+	diff = append(diff, jsonDiffTestData(JSON_DIFF_OPERATION_REPLACE, "$.a", jsonDiffTestString("y"))...)
+	diff = append(diff, jsonDiffTestData(JSON_DIFF_OPERATION_INSERT, "$.b", jsonDiffTestInt16(5))...)
+	body.Write(partialJsonTestRowData(1, diff))
+	return rowTestEventData(PARTIAL_UPDATE_ROWS_EVENT, body.Bytes())
+}
+
+func TestEventParser_parseEvent_PartialUpdateRowsEvent(t *testing.T) {
+	parser := newRowTestParser()
+	if _, _, err := parser.parseEvent(partialJsonTestTableMapEventData()); err != nil {
+		t.Fatal(err)
+	}
+	event, _, err := parser.parseEvent(partialJsonTestUpdateRowsEventData())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Header.EventType != UPDATE_ROWS_EVENTv2 {
+		t.Fatalf("EventType:%s != UPDATE_ROWS_EVENTv2", event.Header.EventName())
+	}
+	if len(event.Rows) != 2 {
+		t.Fatalf("rows len:%d != 2", len(event.Rows))
+	}
+	before := event.Rows[0]["doc"].(map[string]interface{})
+	after := event.Rows[1]["doc"].(map[string]interface{})
+	if len(before) != 1 || before["a"] != "x" {
+		t.Fatalf("before:%+v", before)
+	}
+	if len(after) != 2 || after["a"] != "y" || after["b"] != int16(5) {
+		t.Fatalf("after:%+v", after)
+	}
+	if event.Rows[1]["id"] != int32(1) {
+		t.Fatalf("after id:%v", event.Rows[1]["id"])
+	}
+}
+
+// binlog_row_image=MINIMAL 的时候 before image 中没有 json 字段，json diff 无法还原
+func partialJsonTestMinimalUpdateRowsEventData() []byte {
+	var body bytes.Buffer
+	body.Write(uint64ToBytes(partialJsonTestTableId)[0:6])
+	body.Write([]byte{1, 0})
+	body.Write([]byte{2, 0})
+	body.WriteByte(2)
+	body.WriteByte(0x01)
+	body.WriteByte(0x03)
+	// before image: id
+	body.WriteByte(0x00)
+	binary.Write(&body, binary.LittleEndian, int32(1))
+	body.Write(lengthCodedBinaryToBytes(BINLOG_ROW_VALUE_OPTIONS_PARTIAL_JSON_UPDATES))
+	body.WriteByte(0x01)
+	body.Write(partialJsonTestRowData(1, jsonDiffTestData(JSON_DIFF_OPERATION_REPLACE, "$.a", jsonDiffTestString("y"))))
+	return rowTestEventData(PARTIAL_UPDATE_ROWS_EVENT, body.Bytes())
+}
+
+func TestEventParser_parseEvent_PartialUpdateRowsEventWithoutBeforeImage(t *testing.T) {
+	parser := newRowTestParser()
+	if _, _, err := parser.parseEvent(partialJsonTestTableMapEventData()); err != nil {
+		t.Fatal(err)
+	}
+	event, _, err := parser.parseEvent(partialJsonTestMinimalUpdateRowsEventData())
+	if err == nil {
+		t.Fatal("json diff without before image need return err")
+	}
+	// 不能丢掉这个事件，需要停止解析并给出明确的错误
+	if !strings.Contains(err.Error(), "binlog dump stopped at mysql-bin.000001") {
+		t.Fatalf("err:%s", err)
+	}
+	if event != nil {
+		t.Fatalf("event need be nil:%+v", event)
+	}
+}
+
+func TestCheckPartialJsonRowImage(t *testing.T) {
+	for _, c := range []struct {
+		variables map[string]string
+		isErr     bool
+	}{
+		{map[string]string{}, false},
+		{map[string]string{"binlog_row_image": "MINIMAL", "binlog_row_value_options": ""}, false},
+		{map[string]string{"binlog_row_image": "FULL", "binlog_row_value_options": "PARTIAL_JSON"}, false},
+		{map[string]string{"binlog_row_image": "MINIMAL", "binlog_row_value_options": "PARTIAL_JSON"}, true},
+		{map[string]string{"binlog_row_image": "noblob", "binlog_row_value_options": "partial_json"}, true},
+	} {
+		if err := checkPartialJsonRowImage(c.variables); (err != nil) != c.isErr {
+			t.Fatalf("variables:%+v err:%v", c.variables, err)
+		}
+	}
+}
+
+// bifrost_test.row_image_test (id int, name varchar(20))
+func rowImageTestTableMapEventData() []byte {
+	var body bytes.Buffer
+	body.Write(uint64ToBytes(rowImageTestTableId)[0:6])
+	body.Write([]byte{1, 0})
+	body.WriteByte(byte(len("bifrost_test")))
+	body.WriteString("bifrost_test")
+	body.WriteByte(0)
+	body.WriteByte(byte(len("row_image_test")))
+	body.WriteString("row_image_test")
+	body.WriteByte(0)
+	body.WriteByte(2)
+	body.Write([]byte{byte(FIELD_TYPE_LONG), byte(FIELD_TYPE_VARCHAR)})
+	body.WriteByte(2)
+	body.Write([]byte{80, 0})
+	body.WriteByte(0x02)
+	return rowTestEventData(TABLE_MAP_EVENT, body.Bytes())
+}
+
+// binlog_row_image=FULL: insert into row_image_test values (id, name)
+func rowImageTestWriteRowsEventData(id int32, name string) []byte {
+	var body bytes.Buffer
+	body.Write(uint64ToBytes(rowImageTestTableId)[0:6])
+	body.Write([]byte{1, 0})
+	body.Write([]byte{2, 0})
+	body.WriteByte(2)
+	body.WriteByte(0x03)
+	body.WriteByte(0x00)
+	binary.Write(&body, binary.LittleEndian, id)
+	body.WriteByte(byte(len(name)))
+	body.WriteString(name)
+	return rowTestEventData(WRITE_ROWS_EVENTv2, body.Bytes())
+}
+
+// binlog_row_image=MINIMAL: update row_image_test set name = 'bristol' where id = 1
+func minimalTestUpdateRowsEventData() []byte {
+	var body bytes.Buffer
+	body.Write(uint64ToBytes(rowImageTestTableId)[0:6])
+	body.Write([]byte{1, 0})
+	body.Write([]byte{2, 0})
+	body.WriteByte(2)
+	body.WriteByte(0x01)
+	body.WriteByte(0x02)
+	// before image: id
+	body.WriteByte(0x00)
+	binary.Write(&body, binary.LittleEndian, int32(1))
+	// after image: name
+	body.WriteByte(0x00)
+	body.WriteByte(byte(len("bristol")))
+	body.WriteString("bristol")
+	return rowTestEventData(UPDATE_ROWS_EVENTv2, body.Bytes())
+}
+
+func TestEventParser_parseEvent_MinimalRowImage(t *testing.T) {
+	parser := newRowTestParser()
+	if _, _, err := parser.parseEvent(rowImageTestTableMapEventData()); err != nil {
+		t.Fatal(err)
+	}
+	event, _, err := parser.parseEvent(minimalTestUpdateRowsEventData())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(event.Rows) != 2 || len(event.PresentColumns) != 2 {
+		t.Fatalf("rows:%+v PresentColumns:%+v", event.Rows, event.PresentColumns)
+	}
+	if len(event.Rows[0]) != 1 || event.Rows[0]["id"] != int32(1) {
+		t.Fatalf("before:%+v", event.Rows[0])
+	}
+	if _, ok := event.Rows[1]["id"]; ok || event.Rows[1]["name"] != "bristol" {
+		t.Fatalf("after:%+v", event.Rows[1])
+	}
+	if len(event.PresentColumns[0]) != 1 || event.PresentColumns[0][0] != "id" {
+		t.Fatalf("PresentColumns[0]:%+v", event.PresentColumns[0])
+	}
+	if len(event.PresentColumns[1]) != 1 || event.PresentColumns[1][0] != "name" {
+		t.Fatalf("PresentColumns[1]:%+v", event.PresentColumns[1])
+	}
+}
+
+func TestEventParser_parseEvent_FullRowImage(t *testing.T) {
+	parser := newRowTestParser()
+	if _, _, err := parser.parseEvent(rowImageTestTableMapEventData()); err != nil {
+		t.Fatal(err)
+	}
+	event, _, err := parser.parseEvent(rowImageTestWriteRowsEventData(1, "bifrost"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.PresentColumns != nil {
+		t.Fatalf("PresentColumns:%+v", event.PresentColumns)
+	}
+}
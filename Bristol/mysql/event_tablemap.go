@@ -39,6 +39,10 @@ type TableMapEvent struct {
 	columnMeta     []uint16
 	columnMetaData []*ColumnType
 	nullBitmap     Bitfield
+	// binlog_row_metadata 配置的 optional metadata,没有的时候为 nil
+	optionalMetadata *TableMapOptionalMetadata
+	// event header 之后的全部内容,用于判断表结构是否有变化
+	metadataSign string
 }
 
 func (event *TableMapEvent) columnTypeNames() (names []string) {
@@ -60,12 +64,12 @@ func (event *TableMapEvent) parseColumnMetadata(data []byte) error {
 			pos += 1
 			c = uint8(data[pos])
 			pos += 1
-			metadata := (b << 8) + c
+			metadata := (uint16(b) << 8) + uint16(c)
 			if FieldType(b) == FIELD_TYPE_ENUM || FieldType(b) == FIELD_TYPE_SET {
 				event.columnMetaData[i].column_type = FieldType(b)
-				event.columnMetaData[i].size = uint16(metadata) & 0x00ff
+				event.columnMetaData[i].size = metadata & 0x00ff
 			} else {
-				event.columnMetaData[i].max_length = (((uint16(metadata) >> 4) & 0x300) ^ 0x300) + (uint16(metadata) & 0x00ff)
+				event.columnMetaData[i].max_length = ((metadata>>4)&0x300 ^ 0x300) + (metadata & 0x00ff)
 			}
 		case FIELD_TYPE_VARCHAR,
 			FIELD_TYPE_VAR_STRING,
@@ -130,6 +134,7 @@ func (parser *eventParser) parseTableMapEvent(buf *bytes.Buffer) (event *TableMa
 
 	event = new(TableMapEvent)
 	err = binary.Read(buf, binary.LittleEndian, &event.header)
+	event.metadataSign = string(buf.Bytes())
 	headerSize := parser.format.eventTypeHeaderLengths[event.header.EventType-1]
 	var tableIdSize int
 	if headerSize == 6 {
@@ -165,5 +170,9 @@ func (parser *eventParser) parseTableMapEvent(buf *bytes.Buffer) (event *TableMa
 		err = io.EOF
 	}
 	event.nullBitmap = Bitfield(buf.Next(int((columnCount + 7) / 8)))
+	if err != nil || buf.Len() == 0 {
+		return
+	}
+	err = parser.parseTableMapOptionalMetadata(event, buf.Bytes())
 	return
 }
@@ -0,0 +1,409 @@
+// documentation:
+// https://dev.mysql.com/doc/dev/mysql-server/latest/classmysql_1_1binlog_1_1event_1_1Table__map__event.html
+// binlog_row_metadata=FULL (MySQL 8.0.1+) 的时候，table map event 在 null bitmap 之后会带上 optional metadata
+package mysql
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// optional metadata 字段类型
+const (
+	TABLE_MAP_OPT_META_SIGNEDNESS                   = 1
+	TABLE_MAP_OPT_META_DEFAULT_CHARSET              = 2
+	TABLE_MAP_OPT_META_COLUMN_CHARSET               = 3
+	TABLE_MAP_OPT_META_COLUMN_NAME                  = 4
+	TABLE_MAP_OPT_META_SET_STR_VALUE                = 5
+	TABLE_MAP_OPT_META_ENUM_STR_VALUE               = 6
+	TABLE_MAP_OPT_META_GEOMETRY_TYPE                = 7
+	TABLE_MAP_OPT_META_SIMPLE_PRIMARY_KEY           = 8
+	TABLE_MAP_OPT_META_PRIMARY_KEY_WITH_PREFIX      = 9
+	TABLE_MAP_OPT_META_ENUM_AND_SET_DEFAULT_CHARSET = 10
+	TABLE_MAP_OPT_META_ENUM_AND_SET_COLUMN_CHARSET  = 11
+	TABLE_MAP_OPT_META_COLUMN_VISIBILITY            = 12
+)
+
+// binary 字符集
+const CHARSET_BINARY_COLLATION_ID = 63
+
+type TableMapOptionalMetadata struct {
+	// 数字类型字段是否为 unsigned,按数字类型字段的顺序
+	signedness []bool
+	// 字符类型字段的字符集 collation id,按字符类型字段的顺序
+	columnCharset []uint64
+	columnNames   []string
+	// set,enum 字段的可选值,按 set,enum 字段的顺序
+	setStrValues  [][]string
+	enumStrValues [][]string
+	primaryKey    []uint64
+}
+
+func (parser *eventParser) parseTableMapOptionalMetadata(event *TableMapEvent, data []byte) (err error) {
+	meta := &TableMapOptionalMetadata{}
+	buf := bytes.NewBuffer(data)
+	for buf.Len() > 0 {
+		var fieldType byte
+		var fieldLength uint64
+		fieldType, err = buf.ReadByte()
+		if err != nil {
+			return
+		}
+		fieldLength, _, err = readLengthEncodedInt(buf)
+		if err != nil {
+			return
+		}
+		if buf.Len() < int(fieldLength) {
+			return fmt.Errorf("table map optional metadata type:%d length:%d > buf len:%d", fieldType, fieldLength, buf.Len())
+		}
+		value := buf.Next(int(fieldLength))
+		switch fieldType {
+		case TABLE_MAP_OPT_META_SIGNEDNESS:
+			meta.signedness = event.decodeSignedness(value)
+		case TABLE_MAP_OPT_META_DEFAULT_CHARSET:
+			meta.columnCharset, err = event.decodeDefaultCharset(value)
+		case TABLE_MAP_OPT_META_COLUMN_CHARSET:
+			meta.columnCharset, err = decodeLengthEncodedIntList(value)
+		case TABLE_MAP_OPT_META_COLUMN_NAME:
+			meta.columnNames, err = decodeLengthEncodedStringList(value)
+		case TABLE_MAP_OPT_META_SET_STR_VALUE:
+			meta.setStrValues, err = decodeTypeStrValues(value)
+		case TABLE_MAP_OPT_META_ENUM_STR_VALUE:
+			meta.enumStrValues, err = decodeTypeStrValues(value)
+		case TABLE_MAP_OPT_META_SIMPLE_PRIMARY_KEY:
+			meta.primaryKey, err = decodeLengthEncodedIntList(value)
+		case TABLE_MAP_OPT_META_PRIMARY_KEY_WITH_PREFIX:
+			var list []uint64
+			list, err = decodeLengthEncodedIntList(value)
+			// column index 和 prefix length 成对出现
+			for i := 0; i+1 < len(list); i += 2 {
+				meta.primaryKey = append(meta.primaryKey, list[i])
+			}
+		default:
+			// GEOMETRY_TYPE,ENUM_AND_SET 字符集,COLUMN_VISIBILITY 等当前用不上，直接跳过
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("table map optional metadata type:%d err:%s", fieldType, err.Error())
+		}
+	}
+	event.optionalMetadata = meta
+	return
+}
+
+func (event *TableMapEvent) isNumericColumn(i int) bool {
+	switch event.columnMetaData[i].column_type {
+	case FIELD_TYPE_TINY, FIELD_TYPE_SHORT, FIELD_TYPE_INT24, FIELD_TYPE_LONG, FIELD_TYPE_LONGLONG,
+		FIELD_TYPE_NEWDECIMAL, FIELD_TYPE_FLOAT, FIELD_TYPE_DOUBLE:
+		return true
+	}
+	return false
+}
+
+// enum,set 字段在 parseColumnMetadata 的时候已经被替换成了真实类型，所以这里不会包括 enum,set
+func (event *TableMapEvent) isCharacterColumn(i int) bool {
+	switch event.columnMetaData[i].column_type {
+	case FIELD_TYPE_STRING, FIELD_TYPE_VAR_STRING, FIELD_TYPE_VARCHAR, FIELD_TYPE_BLOB:
+		return true
+	}
+	return false
+}
+
+// signedness 是按字节从高位到低位的 bitmap, 1 为 unsigned
+func (event *TableMapEvent) decodeSignedness(value []byte) (signedness []bool) {
+	var n int
+	for i := range event.columnMetaData {
+		if !event.isNumericColumn(i) {
+			continue
+		}
+		if n/8 >= len(value) {
+			break
+		}
+		signedness = append(signedness, value[n/8]&(1<<(7-uint(n%8))) != 0)
+		n++
+	}
+	return
+}
+
+// default charset 格式为: 默认 collation, 然后是 (字符类型字段序号,collation) 的列表，只列出和默认值不一样的字段
+func (event *TableMapEvent) decodeDefaultCharset(value []byte) (charsetList []uint64, err error) {
+	var list []uint64
+	list, err = decodeLengthEncodedIntList(value)
+	if err != nil || len(list) == 0 {
+		return
+	}
+	for i := range event.columnMetaData {
+		if event.isCharacterColumn(i) {
+			charsetList = append(charsetList, list[0])
+		}
+	}
+	for i := 1; i+1 < len(list); i += 2 {
+		if int(list[i]) < len(charsetList) {
+			charsetList[list[i]] = list[i+1]
+		}
+	}
+	return
+}
+
+func decodeLengthEncodedIntList(value []byte) (list []uint64, err error) {
+	buf := bytes.NewBuffer(value)
+	for buf.Len() > 0 {
+		var n uint64
+		n, _, err = readLengthEncodedInt(buf)
+		if err != nil {
+			return
+		}
+		list = append(list, n)
+	}
+	return
+}
+
+func decodeLengthEncodedString(buf *bytes.Buffer) (s string, err error) {
+	var length uint64
+	length, _, err = readLengthEncodedInt(buf)
+	if err != nil {
+		return
+	}
+	if buf.Len() < int(length) {
+		return "", fmt.Errorf("string length:%d > buf len:%d", length, buf.Len())
+	}
+	return string(buf.Next(int(length))), nil
+}
+
+func decodeLengthEncodedStringList(value []byte) (list []string, err error) {
+	buf := bytes.NewBuffer(value)
+	for buf.Len() > 0 {
+		var s string
+		s, err = decodeLengthEncodedString(buf)
+		if err != nil {
+			return
+		}
+		list = append(list, s)
+	}
+	return
+}
+
+// set,enum 可选值 格式为: 每个字段 可选值个数, 然后是每一个可选值
+func decodeTypeStrValues(value []byte) (list [][]string, err error) {
+	buf := bytes.NewBuffer(value)
+	for buf.Len() > 0 {
+		var count uint64
+		count, _, err = readLengthEncodedInt(buf)
+		if err != nil {
+			return
+		}
+		values := make([]string, 0, count)
+		for i := uint64(0); i < count; i++ {
+			var s string
+			s, err = decodeLengthEncodedString(buf)
+			if err != nil {
+				return
+			}
+			values = append(values, s)
+		}
+		list = append(list, values)
+	}
+	return
+}
+
+// 字符集 collation id 对应的一个字符最多占用的字节数，用于将字节长度转换成 char(N),varchar(N) 中的 N
+// 只列出常用的字符集，未知的字符集按 1 个字节处理
+func collationMaxLen(collationId uint64) uint64 {
+	switch {
+	case collationId == 33 || collationId == 83 || collationId == 76 || (collationId >= 192 && collationId <= 215) || collationId == 223:
+		// utf8mb3
+		return 3
+	case collationId == 45 || collationId == 46 || (collationId >= 224 && collationId <= 247) || collationId >= 255:
+		// utf8mb4
+		return 4
+	case collationId == 28 || collationId == 87 || collationId == 1 || collationId == 84 || collationId == 24 || collationId == 86 || collationId == 35 || collationId == 90 || (collationId >= 128 && collationId <= 151):
+		// gbk,big5,gb2312,ucs2
+		return 2
+	case collationId == 248 || collationId == 249 || collationId == 250 || collationId == 54 || collationId == 55 || (collationId >= 101 && collationId <= 124) || collationId == 60 || collationId == 61 || (collationId >= 160 && collationId <= 183):
+		// gb18030,utf16,utf32
+		return 4
+	default:
+		return 1
+	}
+}
+
+// 是否有字段名(binlog_row_metadata=FULL)
+func (event *TableMapEvent) hasFullMetadata() bool {
+	meta := event.optionalMetadata
+	return meta != nil && len(meta.columnNames) == len(event.columnMetaData)
+}
+
+func (event *TableMapEvent) hasTinyColumn() bool {
+	for _, column := range event.columnMetaData {
+		if column.column_type == FIELD_TYPE_TINY {
+			return true
+		}
+	}
+	return false
+}
+
+// 根据 optional metadata 生成表结构，假如没有字段名(binlog_row_metadata!=FULL)，则返回 nil ,由上一层再去 information_schema 查询
+// binlog 中不会记录 int 类型的显示宽度，字段默认值，auto_increment 属性
+// boolColumns 为 information_schema 中 tinyint(1) 的字段，这些字段同样当作 bool 处理
+func (event *TableMapEvent) tableStructByOptionalMetadata(boolColumns map[string]bool) *tableStruct {
+	if !event.hasFullMetadata() {
+		return nil
+	}
+	meta := event.optionalMetadata
+	tableInfo := &tableStruct{
+		SchemaName:           event.schemaName,
+		TableName:            event.tableName,
+		Pri:                  make([]string, 0),
+		ColumnSchemaTypeList: make([]*ColumnInfo, 0, len(event.columnMetaData)),
+		ColumnMapping:        make(map[string]string, len(event.columnMetaData)),
+		fromMetadata:         true,
+		metadataSign:         event.metadataSign,
+	}
+	isPrimary := make(map[int]bool, len(meta.primaryKey))
+	for _, index := range meta.primaryKey {
+		isPrimary[int(index)] = true
+	}
+	var numericIndex, characterIndex, enumIndex, setIndex int
+	for i, column := range event.columnMetaData {
+		columnInfo := &ColumnInfo{
+			COLUMN_NAME: meta.columnNames[i],
+			EnumValues:  make([]string, 0),
+			SetValues:   make([]string, 0),
+			IsPrimary:   isPrimary[i],
+		}
+		if columnInfo.IsPrimary {
+			columnInfo.COLUMN_KEY = "PRI"
+		}
+		var collationId uint64
+		if event.isNumericColumn(i) {
+			if numericIndex < len(meta.signedness) {
+				columnInfo.Unsigned = meta.signedness[numericIndex]
+			}
+			numericIndex++
+		}
+		if event.isCharacterColumn(i) {
+			if characterIndex < len(meta.columnCharset) {
+				collationId = meta.columnCharset[characterIndex]
+			}
+			characterIndex++
+		}
+		switch column.column_type {
+		case FIELD_TYPE_TINY:
+			columnInfo.DATA_TYPE, columnInfo.COLUMN_TYPE = "tinyint", "tinyint(4)"
+			if boolColumns[columnInfo.COLUMN_NAME] && !columnInfo.Unsigned {
+				columnInfo.COLUMN_TYPE, columnInfo.IsBool = "tinyint(1)", true
+			}
+		case FIELD_TYPE_SHORT:
+			columnInfo.DATA_TYPE, columnInfo.COLUMN_TYPE = "smallint", "smallint(6)"
+		case FIELD_TYPE_INT24:
+			columnInfo.DATA_TYPE, columnInfo.COLUMN_TYPE = "mediumint", "mediumint(9)"
+		case FIELD_TYPE_LONG:
+			columnInfo.DATA_TYPE, columnInfo.COLUMN_TYPE = "int", "int(11)"
+		case FIELD_TYPE_LONGLONG:
+			columnInfo.DATA_TYPE, columnInfo.COLUMN_TYPE = "bigint", "bigint(20)"
+		case FIELD_TYPE_FLOAT:
+			columnInfo.DATA_TYPE, columnInfo.COLUMN_TYPE = "float", "float"
+		case FIELD_TYPE_DOUBLE:
+			columnInfo.DATA_TYPE, columnInfo.COLUMN_TYPE = "double", "double"
+		case FIELD_TYPE_NEWDECIMAL:
+			columnInfo.DATA_TYPE = "decimal"
+			columnInfo.COLUMN_TYPE = fmt.Sprintf("decimal(%d,%d)", column.precision, column.decimals)
+			columnInfo.NUMERIC_SCALE = fmt.Sprint(column.decimals)
+		case FIELD_TYPE_YEAR:
+			columnInfo.DATA_TYPE, columnInfo.COLUMN_TYPE = "year", "year(4)"
+		case FIELD_TYPE_DATE, FIELD_TYPE_NEWDATE:
+			columnInfo.DATA_TYPE, columnInfo.COLUMN_TYPE = "date", "date"
+		case FIELD_TYPE_TIME, FIELD_TYPE_TIME2:
+			columnInfo.DATA_TYPE, columnInfo.COLUMN_TYPE = "time", columnTypeWithFsp("time", column.fsp)
+		case FIELD_TYPE_DATETIME, FIELD_TYPE_DATETIME2:
+			columnInfo.DATA_TYPE, columnInfo.COLUMN_TYPE = "datetime", columnTypeWithFsp("datetime", column.fsp)
+		case FIELD_TYPE_TIMESTAMP, FIELD_TYPE_TIMESTAMP2:
+			columnInfo.DATA_TYPE, columnInfo.COLUMN_TYPE = "timestamp", columnTypeWithFsp("timestamp", column.fsp)
+		case FIELD_TYPE_BIT:
+			columnInfo.DATA_TYPE = "bit"
+			columnInfo.COLUMN_TYPE = fmt.Sprintf("bit(%d)", column.bits)
+		case FIELD_TYPE_JSON:
+			columnInfo.DATA_TYPE, columnInfo.COLUMN_TYPE = "json", "json"
+		case FIELD_TYPE_GEOMETRY:
+			columnInfo.DATA_TYPE, columnInfo.COLUMN_TYPE = "geometry", "geometry"
+		case FIELD_TYPE_ENUM:
+			if enumIndex < len(meta.enumStrValues) {
+				columnInfo.EnumValues = meta.enumStrValues[enumIndex]
+			}
+			enumIndex++
+			columnInfo.DATA_TYPE = "enum"
+			columnInfo.COLUMN_TYPE = "enum(" + quoteStrValues(columnInfo.EnumValues) + ")"
+		case FIELD_TYPE_SET:
+			if setIndex < len(meta.setStrValues) {
+				columnInfo.SetValues = meta.setStrValues[setIndex]
+			}
+			setIndex++
+			columnInfo.DATA_TYPE = "set"
+			columnInfo.COLUMN_TYPE = "set(" + quoteStrValues(columnInfo.SetValues) + ")"
+		case FIELD_TYPE_STRING:
+			columnInfo.CHARACTER_OCTET_LENGTH = uint64(column.max_length)
+			if collationId == CHARSET_BINARY_COLLATION_ID {
+				columnInfo.DATA_TYPE = "binary"
+			} else {
+				columnInfo.DATA_TYPE = "char"
+			}
+			columnInfo.COLUMN_TYPE = fmt.Sprintf("%s(%d)", columnInfo.DATA_TYPE, uint64(column.max_length)/collationMaxLen(collationId))
+		case FIELD_TYPE_VARCHAR, FIELD_TYPE_VAR_STRING:
+			columnInfo.CHARACTER_OCTET_LENGTH = uint64(column.max_length)
+			if collationId == CHARSET_BINARY_COLLATION_ID {
+				columnInfo.DATA_TYPE = "varbinary"
+			} else {
+				columnInfo.DATA_TYPE = "varchar"
+			}
+			columnInfo.COLUMN_TYPE = fmt.Sprintf("%s(%d)", columnInfo.DATA_TYPE, uint64(column.max_length)/collationMaxLen(collationId))
+		case FIELD_TYPE_BLOB, FIELD_TYPE_TINY_BLOB, FIELD_TYPE_MEDIUM_BLOB, FIELD_TYPE_LONG_BLOB:
+			var prefix string
+			switch column.length_size {
+			case 1:
+				prefix = "tiny"
+			case 3:
+				prefix = "medium"
+			case 4:
+				prefix = "long"
+			}
+			if collationId == CHARSET_BINARY_COLLATION_ID {
+				columnInfo.DATA_TYPE = prefix + "blob"
+			} else {
+				columnInfo.DATA_TYPE = prefix + "text"
+			}
+			columnInfo.COLUMN_TYPE = columnInfo.DATA_TYPE
+		default:
+			columnInfo.DATA_TYPE = strings.ToLower(strings.Replace(fieldTypeName(column.column_type), "FIELD_TYPE_", "", 1))
+			columnInfo.COLUMN_TYPE = columnInfo.DATA_TYPE
+		}
+		if columnInfo.Unsigned {
+			columnInfo.COLUMN_TYPE += " unsigned"
+		}
+		tableInfo.ColumnSchemaTypeList = append(tableInfo.ColumnSchemaTypeList, columnInfo)
+		nullable := len(event.nullBitmap) > i/8 && event.nullBitmap.isSet(uint(i))
+		tableInfo.ColumnMapping[columnInfo.COLUMN_NAME] = getColumnMappingType(columnInfo.DATA_TYPE, columnInfo.COLUMN_TYPE, columnInfo.Unsigned, nullable)
+	}
+	// 主键按 key 中的字段顺序
+	for _, index := range meta.primaryKey {
+		if int(index) < len(tableInfo.ColumnSchemaTypeList) {
+			tableInfo.Pri = append(tableInfo.Pri, tableInfo.ColumnSchemaTypeList[index].COLUMN_NAME)
+		}
+	}
+	return tableInfo
+}
+
+func columnTypeWithFsp(dataType string, fsp uint8) string {
+	if fsp == 0 {
+		return dataType
+	}
+	return fmt.Sprintf("%s(%d)", dataType, fsp)
+}
+
+func quoteStrValues(values []string) string {
+	list := make([]string, len(values))
+	for i, v := range values {
+		list[i] = "'" + strings.Replace(v, "'", "''", -1) + "'"
+	}
+	return strings.Join(list, ",")
+}
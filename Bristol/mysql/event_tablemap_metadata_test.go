@@ -0,0 +1,292 @@
+package mysql
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+const metadataTestTableId uint64 = 109
+
+func metadataTestOptionalField(buf *bytes.Buffer, fieldType byte, value []byte) {
+	buf.WriteByte(fieldType)
+	buf.Write(lengthCodedBinaryToBytes(uint64(len(value))))
+	buf.Write(value)
+}
+
+func metadataTestLengthEncodedStrings(values ...string) []byte {
+	var buf bytes.Buffer
+	for _, v := range values {
+		buf.Write(lengthCodedBinaryToBytes(uint64(len(v))))
+		buf.WriteString(v)
+	}
+	return buf.Bytes()
+}
+
+// bifrost_test.metadata_test (
+//
+//	id int unsigned not null primary key,
+//	name varchar(20) null,
+//	status enum('a','b') not null,
+//	tags set('x','y') not null,
+//	price decimal(10,2) null,
+//	code char(10) not null
+//
+// ) charset=utf8mb4
+func metadataTestTableMapEventData(withOptionalMetadata bool) []byte {
+	var body bytes.Buffer
+	body.Write(uint64ToBytes(metadataTestTableId)[0:6])
+	body.Write([]byte{1, 0})
+	body.WriteByte(byte(len("bifrost_test")))
+	body.WriteString("bifrost_test")
+	body.WriteByte(0)
+	body.WriteByte(byte(len("metadata_test")))
+	body.WriteString("metadata_test")
+	body.WriteByte(0)
+	body.WriteByte(6)
+	body.Write([]byte{byte(FIELD_TYPE_LONG), byte(FIELD_TYPE_VARCHAR), byte(FIELD_TYPE_STRING), byte(FIELD_TYPE_STRING), byte(FIELD_TYPE_NEWDECIMAL), byte(FIELD_TYPE_STRING)})
+	columnMeta := []byte{80, 0, byte(FIELD_TYPE_ENUM), 1, byte(FIELD_TYPE_SET), 1, 10, 2, byte(FIELD_TYPE_STRING), 40}
+	body.WriteByte(byte(len(columnMeta)))
+	body.Write(columnMeta)
+	body.WriteByte(0x12)
+	if withOptionalMetadata {
+		metadataTestOptionalField(&body, TABLE_MAP_OPT_META_SIGNEDNESS, []byte{0x80})
+		metadataTestOptionalField(&body, TABLE_MAP_OPT_META_DEFAULT_CHARSET, lengthCodedBinaryToBytes(255))
+		metadataTestOptionalField(&body, TABLE_MAP_OPT_META_COLUMN_NAME, metadataTestLengthEncodedStrings("id", "name", "status", "tags", "price", "code"))
+		metadataTestOptionalField(&body, TABLE_MAP_OPT_META_SET_STR_VALUE, append([]byte{2}, metadataTestLengthEncodedStrings("x", "y")...))
+		metadataTestOptionalField(&body, TABLE_MAP_OPT_META_ENUM_STR_VALUE, append([]byte{2}, metadataTestLengthEncodedStrings("a", "b")...))
+		metadataTestOptionalField(&body, TABLE_MAP_OPT_META_SIMPLE_PRIMARY_KEY, []byte{0})
+	}
+	return payloadTestEventData(TABLE_MAP_EVENT, 0, body.Bytes())
+}
+
+func metadataTestWriteRowsEventData() []byte {
+	var body bytes.Buffer
+	body.Write(uint64ToBytes(metadataTestTableId)[0:6])
+	body.Write([]byte{1, 0})
+	body.Write([]byte{2, 0})
+	body.WriteByte(6)
+	body.WriteByte(0x3f)
+	// price is null
+	body.WriteByte(0x10)
+	binary.Write(&body, binary.LittleEndian, uint32(4294967295))
+	body.WriteByte(byte(len("bifrost")))
+	body.WriteString("bifrost")
+	body.WriteByte(2)
+	body.WriteByte(3)
+	body.WriteByte(byte(len("c01")))
+	body.WriteString("c01")
+	return payloadTestEventData(WRITE_ROWS_EVENTv2, 0, body.Bytes())
+}
+
+func TestEventParser_parseTableMapEvent_OptionalMetadata(t *testing.T) {
+	parser := newPayloadTestParser()
+	data := metadataTestTableMapEventData(true)
+	event, err := parser.parseTableMapEvent(bytes.NewBuffer(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.optionalMetadata == nil {
+		t.Fatal("optionalMetadata is nil")
+	}
+	tableInfo := event.tableStructByOptionalMetadata(nil)
+	if tableInfo == nil {
+		t.Fatal("tableStructByOptionalMetadata is nil")
+	}
+	if len(tableInfo.Pri) != 1 || tableInfo.Pri[0] != "id" {
+		t.Fatalf("Pri:%+v", tableInfo.Pri)
+	}
+	expectColumnTypes := []string{"int(11) unsigned", "varchar(20)", "enum('a','b')", "set('x','y')", "decimal(10,2)", "char(10)"}
+	for i, columnType := range expectColumnTypes {
+		if tableInfo.ColumnSchemaTypeList[i].COLUMN_TYPE != columnType {
+			t.Fatalf("column %s COLUMN_TYPE:%s != %s", tableInfo.ColumnSchemaTypeList[i].COLUMN_NAME, tableInfo.ColumnSchemaTypeList[i].COLUMN_TYPE, columnType)
+		}
+	}
+	if !tableInfo.ColumnSchemaTypeList[0].Unsigned || tableInfo.ColumnSchemaTypeList[4].Unsigned {
+		t.Fatal("signedness err")
+	}
+	if tableInfo.ColumnSchemaTypeList[5].CHARACTER_OCTET_LENGTH != 40 {
+		t.Fatalf("code CHARACTER_OCTET_LENGTH:%d != 40", tableInfo.ColumnSchemaTypeList[5].CHARACTER_OCTET_LENGTH)
+	}
+	expectColumnMapping := map[string]string{
+		"id":     "uint32",
+		"name":   "Nullable(varchar(20))",
+		"status": "enum('a','b')",
+		"tags":   "set('x','y')",
+		"price":  "Nullable(decimal(10,2))",
+		"code":   "char(10)",
+	}
+	for name, mappingType := range expectColumnMapping {
+		if tableInfo.ColumnMapping[name] != mappingType {
+			t.Fatalf("ColumnMapping[%s]:%s != %s", name, tableInfo.ColumnMapping[name], mappingType)
+		}
+	}
+}
+
+func TestEventParser_parseTableMapEvent_WithoutOptionalMetadata(t *testing.T) {
+	parser := newPayloadTestParser()
+	event, err := parser.parseTableMapEvent(bytes.NewBuffer(metadataTestTableMapEventData(false)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.tableStructByOptionalMetadata(nil) != nil {
+		t.Fatal("tableStructByOptionalMetadata need be nil")
+	}
+}
+
+// 表结构直接从 table map event 中获取，不会去连接 MySQL 查询 information_schema
+func TestEventParser_parseEvent_RowsByOptionalMetadata(t *testing.T) {
+	parser := newPayloadTestParser()
+	// 模拟 information_schema 查询到的是 ALTER TABLE 之后的表结构
+	parser.tableSchemaMap[metadataTestTableId] = &tableStruct{
+		SchemaName: "bifrost_test",
+		TableName:  "metadata_test",
+		ColumnSchemaTypeList: []*ColumnInfo{
+			{COLUMN_NAME: "new_column"},
+		},
+	}
+	if _, _, err := parser.parseEvent(metadataTestTableMapEventData(true)); err != nil {
+		t.Fatal(err)
+	}
+	if !parser.isTableSchemaFromMetadata(metadataTestTableId) {
+		t.Fatal("table schema need be from metadata")
+	}
+	if tableId, err := parser.GetTableId("bifrost_test", "metadata_test"); err != nil || tableId != metadataTestTableId {
+		t.Fatalf("GetTableId:%d err:%v", tableId, err)
+	}
+	event, _, err := parser.parseEvent(metadataTestWriteRowsEventData())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(event.Rows) != 1 {
+		t.Fatalf("rows len:%d != 1", len(event.Rows))
+	}
+	row := event.Rows[0]
+	if row["id"] != uint32(4294967295) {
+		t.Fatalf("id:%v (%T)", row["id"], row["id"])
+	}
+	if row["name"] != "bifrost" || row["status"] != "b" || row["code"] != "c01" || row["price"] != nil {
+		t.Fatalf("row:%+v", row)
+	}
+	tags, ok := row["tags"].([]string)
+	if !ok || len(tags) != 2 || tags[0] != "x" || tags[1] != "y" {
+		t.Fatalf("tags:%+v", row["tags"])
+	}
+	if len(event.Pri) != 1 || event.Pri[0] != "id" {
+		t.Fatalf("Pri:%+v", event.Pri)
+	}
+}
+
+// bifrost_test.metadata_tiny_test (
+//
+//	id int not null primary key,
+//	is_deleted tinyint(1) not null,
+//	level tinyint(4) not null
+//
+// )
+func metadataTestTinyTableMapEventData() []byte {
+	var body bytes.Buffer
+	body.Write(uint64ToBytes(metadataTestTableId)[0:6])
+	body.Write([]byte{1, 0})
+	body.WriteByte(byte(len("bifrost_test")))
+	body.WriteString("bifrost_test")
+	body.WriteByte(0)
+	body.WriteByte(byte(len("metadata_tiny_test")))
+	body.WriteString("metadata_tiny_test")
+	body.WriteByte(0)
+	body.WriteByte(3)
+	body.Write([]byte{byte(FIELD_TYPE_LONG), byte(FIELD_TYPE_TINY), byte(FIELD_TYPE_TINY)})
+	body.WriteByte(0)
+	body.WriteByte(0)
+	metadataTestOptionalField(&body, TABLE_MAP_OPT_META_SIGNEDNESS, []byte{0x00})
+	metadataTestOptionalField(&body, TABLE_MAP_OPT_META_COLUMN_NAME, metadataTestLengthEncodedStrings("id", "is_deleted", "level"))
+	metadataTestOptionalField(&body, TABLE_MAP_OPT_META_SIMPLE_PRIMARY_KEY, []byte{0})
+	return payloadTestEventData(TABLE_MAP_EVENT, 0, body.Bytes())
+}
+
+// tinyint(1) 的显示宽度从 information_schema 中获取，依然当作 bool 处理
+func TestEventParser_tableStructByOptionalMetadata_Bool(t *testing.T) {
+	parser := newPayloadTestParser()
+	event, err := parser.parseTableMapEvent(bytes.NewBuffer(metadataTestTinyTableMapEventData()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !event.hasTinyColumn() {
+		t.Fatal("hasTinyColumn need be true")
+	}
+	tableInfo := event.tableStructByOptionalMetadata(map[string]bool{"is_deleted": true, "not_exist": true})
+	if tableInfo == nil {
+		t.Fatal("tableStructByOptionalMetadata is nil")
+	}
+	isDeleted, level := tableInfo.ColumnSchemaTypeList[1], tableInfo.ColumnSchemaTypeList[2]
+	if !isDeleted.IsBool || isDeleted.COLUMN_TYPE != "tinyint(1)" || tableInfo.ColumnMapping["is_deleted"] != "bool" {
+		t.Fatalf("is_deleted:%+v mapping:%s", *isDeleted, tableInfo.ColumnMapping["is_deleted"])
+	}
+	if level.IsBool || level.COLUMN_TYPE != "tinyint(4)" || tableInfo.ColumnMapping["level"] != "int8" {
+		t.Fatalf("level:%+v mapping:%s", *level, tableInfo.ColumnMapping["level"])
+	}
+
+	tableInfo = event.tableStructByOptionalMetadata(nil)
+	if tableInfo.ColumnSchemaTypeList[1].IsBool || tableInfo.ColumnMapping["is_deleted"] != "int8" {
+		t.Fatal("is_deleted need be int8 without information_schema")
+	}
+}
+
+// table map event 没有变化的时候，不重新生成表结构
+func TestEventParser_parseEvent_TableMapCache(t *testing.T) {
+	parser := newPayloadTestParser()
+	data := metadataTestTableMapEventData(true)
+	if _, _, err := parser.parseEvent(data); err != nil {
+		t.Fatal(err)
+	}
+	tableInfo := parser.tableSchemaMap[metadataTestTableId]
+	if _, _, err := parser.parseEvent(data); err != nil {
+		t.Fatal(err)
+	}
+	if parser.tableSchemaMap[metadataTestTableId] != tableInfo {
+		t.Fatal("table struct need be cached")
+	}
+
+	// ROTATE 之后需要重新生成
+	tableInfo.needReload = true
+	if _, _, err := parser.parseEvent(data); err != nil {
+		t.Fatal(err)
+	}
+	if parser.tableSchemaMap[metadataTestTableId] == tableInfo || parser.tableSchemaMap[metadataTestTableId].needReload {
+		t.Fatal("table struct need be rebuild after needReload")
+	}
+
+	// 同一个 tableId 表结构变化
+	tableInfo = parser.tableSchemaMap[metadataTestTableId]
+	data = metadataTestTableMapEventData(true)
+	data[len(data)-1] = 1
+	if _, _, err := parser.parseEvent(data); err != nil {
+		t.Fatal(err)
+	}
+	if parser.tableSchemaMap[metadataTestTableId] == tableInfo {
+		t.Fatal("table struct need be rebuild after metadata changed")
+	}
+}
+
+// 查询 information_schema 一直失败, 重试次数用完之后只使用 binlog 里的 metadata, 不能一直卡住
+func TestEventParser_parseEvent_GetBoolColumnsErr(t *testing.T) {
+	oldRetryCount, oldRetryWait := getBoolColumnsRetryCount, getBoolColumnsRetryWait
+	getBoolColumnsRetryCount, getBoolColumnsRetryWait = 2, 10*time.Millisecond
+	defer func() {
+		getBoolColumnsRetryCount, getBoolColumnsRetryWait = oldRetryCount, oldRetryWait
+	}()
+	parser := newPayloadTestParser()
+	dataSource := "root:root@tcp(127.0.0.1:1)/bifrost_test"
+	parser.dataSource = &dataSource
+	if _, _, err := parser.parseEvent(metadataTestTinyTableMapEventData()); err != nil {
+		t.Fatal(err)
+	}
+	tableInfo := parser.tableSchemaMap[metadataTestTableId]
+	if tableInfo == nil || !tableInfo.fromMetadata {
+		t.Fatal("table schema need be from metadata")
+	}
+	if tableInfo.ColumnSchemaTypeList[1].IsBool || tableInfo.ColumnMapping["is_deleted"] != "int8" {
+		t.Fatal("is_deleted need be int8 without information_schema")
+	}
+}
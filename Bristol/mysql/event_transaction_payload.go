@@ -0,0 +1,124 @@
+// documentation:
+// https://dev.mysql.com/doc/dev/mysql-server/latest/classmysql_1_1binlog_1_1event_1_1Transaction__payload__event.html
+package mysql
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+)
+
+// MySQL 8.0.20+ 开启 binlog_transaction_compression=ON 后，整个事务内的 TABLE_MAP,ROWS,XID 等事件
+// 会被压缩后放在一个 TRANSACTION_PAYLOAD_EVENT 事件里下发
+type TransactionPayloadEvent struct {
+	header           EventHeader
+	payloadSize      uint64
+	compressionType  uint64
+	uncompressedSize uint64
+	payload          []byte
+}
+
+func (parser *eventParser) parseTransactionPayloadEvent(buf *bytes.Buffer) (event *TransactionPayloadEvent, err error) {
+	event = new(TransactionPayloadEvent)
+	err = binary.Read(buf, binary.LittleEndian, &event.header)
+	if err != nil {
+		return
+	}
+	for buf.Len() > 0 {
+		var fieldType, fieldLength, value uint64
+		fieldType, _, err = readLengthEncodedInt(buf)
+		if err != nil {
+			return
+		}
+		if fieldType == PAYLOAD_HEADER_END_MARK {
+			break
+		}
+		fieldLength, _, err = readLengthEncodedInt(buf)
+		if err != nil {
+			return
+		}
+		if buf.Len() < int(fieldLength) {
+			err = fmt.Errorf("transaction payload event field:%d length:%d > buf len:%d", fieldType, fieldLength, buf.Len())
+			return
+		}
+		switch fieldType {
+		case PAYLOAD_SIZE_FIELD, PAYLOAD_COMPRESSION_TYPE_FIELD, PAYLOAD_UNCOMPRESSED_SIZE_FIELD:
+			value, _, err = readLengthEncodedInt(bytes.NewBuffer(buf.Next(int(fieldLength))))
+			if err != nil {
+				return
+			}
+		default:
+			// 未知的字段，直接跳过，兼容以后的版本
+			buf.Next(int(fieldLength))
+			continue
+		}
+		switch fieldType {
+		case PAYLOAD_SIZE_FIELD:
+			event.payloadSize = value
+		case PAYLOAD_COMPRESSION_TYPE_FIELD:
+			event.compressionType = value
+		case PAYLOAD_UNCOMPRESSED_SIZE_FIELD:
+			event.uncompressedSize = value
+		}
+	}
+	event.payload = buf.Bytes()
+	if event.payloadSize > 0 && uint64(len(event.payload)) > event.payloadSize {
+		event.payload = event.payload[:event.payloadSize]
+	}
+	return
+}
+
+// zstd 解码器创建的时候会启动 goroutine 及分配缓存，每个解析器只创建一个，解析结束的时候关闭
+func (parser *eventParser) getPayloadDecoder() (*zstd.Decoder, error) {
+	if parser.payloadDecoder == nil {
+		decoder, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		parser.payloadDecoder = decoder
+	}
+	return parser.payloadDecoder, nil
+}
+
+func (parser *eventParser) closePayloadDecoder() {
+	if parser.payloadDecoder != nil {
+		parser.payloadDecoder.Close()
+		parser.payloadDecoder = nil
+	}
+}
+
+// 解压 payload ,并按事件头里的 EventSize 拆分成一个个完整的 binlog 事件
+// payload 里的事件是不带 checksum 的
+// 解压出来的数据不能复用，TableMapEvent 等会一直引用里面的数据，和 readPacket 一样每次都是新的
+func (parser *eventParser) decodePayload(event *TransactionPayloadEvent) (eventDataList [][]byte, err error) {
+	var data []byte
+	switch event.compressionType {
+	case PAYLOAD_COMPRESSION_TYPE_ZSTD:
+		var decoder *zstd.Decoder
+		decoder, err = parser.getPayloadDecoder()
+		if err != nil {
+			return
+		}
+		data, err = decoder.DecodeAll(event.payload, make([]byte, 0, event.uncompressedSize))
+		if err != nil {
+			return nil, fmt.Errorf("transaction payload event zstd decode err:%s", err.Error())
+		}
+	case PAYLOAD_COMPRESSION_TYPE_NONE:
+		data = event.payload
+	default:
+		return nil, fmt.Errorf("transaction payload event unknow compression type:%d", event.compressionType)
+	}
+	for len(data) > 0 {
+		if len(data) < 19 {
+			return nil, fmt.Errorf("transaction payload event data len:%d < event header size", len(data))
+		}
+		eventSize := int(bytesToUint32(data[9:13]))
+		if eventSize < 19 || eventSize > len(data) {
+			return nil, fmt.Errorf("transaction payload event inner event size:%d err, data len:%d", eventSize, len(data))
+		}
+		eventDataList = append(eventDataList, data[0:eventSize])
+		data = data[eventSize:]
+	}
+	return
+}
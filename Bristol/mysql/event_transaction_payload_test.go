@@ -0,0 +1,336 @@
+package mysql
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/klauspost/compress/zstd"
+	"testing"
+)
+
+const payloadTestTableId uint64 = 108
+
+func payloadTestEventData(eventType EventType, logPos uint32, body []byte) []byte {
+	header := EventHeader{
+		Timestamp: 1700000000,
+		EventType: eventType,
+		ServerId:  1,
+		EventSize: uint32(19 + len(body)),
+		LogPos:    logPos,
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, header)
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+// bifrost_test.payload_test (id int, name varchar(20))
+func payloadTestTableMapEventData() []byte {
+	var body bytes.Buffer
+	body.Write(uint64ToBytes(payloadTestTableId)[0:6])
+	body.Write([]byte{1, 0})
+	body.WriteByte(byte(len("bifrost_test")))
+	body.WriteString("bifrost_test")
+	body.WriteByte(0)
+	body.WriteByte(byte(len("payload_test")))
+	body.WriteString("payload_test")
+	body.WriteByte(0)
+	body.WriteByte(2)
+	body.Write([]byte{byte(FIELD_TYPE_LONG), byte(FIELD_TYPE_VARCHAR)})
+	body.WriteByte(2)
+	body.Write([]byte{80, 0})
+	body.WriteByte(0x02)
+	return payloadTestEventData(TABLE_MAP_EVENT, 0, body.Bytes())
+}
+
+func payloadTestWriteRowsEventData(id int32, name string) []byte {
+	var body bytes.Buffer
+	body.Write(uint64ToBytes(payloadTestTableId)[0:6])
+	body.Write([]byte{1, 0})
+	body.Write([]byte{2, 0})
+	body.WriteByte(2)
+	body.WriteByte(0x03)
+	body.WriteByte(0x00)
+	binary.Write(&body, binary.LittleEndian, id)
+	body.WriteByte(byte(len(name)))
+	body.WriteString(name)
+	return payloadTestEventData(WRITE_ROWS_EVENTv2, 0, body.Bytes())
+}
+
+func payloadTestXidEventData(xid int64) []byte {
+	var body bytes.Buffer
+	binary.Write(&body, binary.LittleEndian, xid)
+	return payloadTestEventData(XID_EVENT, 0, body.Bytes())
+}
+
+func payloadTestPayloadEventData(t *testing.T, compressionType uint64, logPos uint32, innerEvents ...[]byte) []byte {
+	uncompressed := bytes.Join(innerEvents, nil)
+	payload := uncompressed
+	if compressionType == PAYLOAD_COMPRESSION_TYPE_ZSTD {
+		encoder, err := zstd.NewWriter(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		payload = encoder.EncodeAll(uncompressed, nil)
+		encoder.Close()
+	}
+	var body bytes.Buffer
+	writeField := func(fieldType uint64, value uint64) {
+		v := lengthCodedBinaryToBytes(value)
+		body.Write(lengthCodedBinaryToBytes(fieldType))
+		body.Write(lengthCodedBinaryToBytes(uint64(len(v))))
+		body.Write(v)
+	}
+	writeField(PAYLOAD_COMPRESSION_TYPE_FIELD, compressionType)
+	writeField(PAYLOAD_UNCOMPRESSED_SIZE_FIELD, uint64(len(uncompressed)))
+	writeField(PAYLOAD_SIZE_FIELD, uint64(len(payload)))
+	body.WriteByte(PAYLOAD_HEADER_END_MARK)
+	body.Write(payload)
+	return payloadTestEventData(TRANSACTION_PAYLOAD_EVENT, logPos, body.Bytes())
+}
+
+func newPayloadTestParser() *eventParser {
+	binlogDump := NewBinlogDump("", nil, nil, nil, nil)
+	parser := binlogDump.parser
+	dataSource := ""
+	parser.dataSource = &dataSource
+	parser.currentBinlogFileName = "mysql-bin.000001"
+	parser.gtidSetInfo = NewMySQLGtidSet("")
+	headerLengths := make([]uint8, 40)
+	headerLengths[TABLE_MAP_EVENT-1] = 8
+	headerLengths[WRITE_ROWS_EVENTv2-1] = 10
+	parser.format = &FormatDescriptionEvent{eventTypeHeaderLengths: headerLengths}
+	parser.tableSchemaMap[payloadTestTableId] = &tableStruct{
+		SchemaName: "bifrost_test",
+		TableName:  "payload_test",
+		Pri:        []string{"id"},
+		ColumnSchemaTypeList: []*ColumnInfo{
+			{COLUMN_NAME: "id", COLUMN_KEY: "PRI", COLUMN_TYPE: "int(11)", DATA_TYPE: "int", IsPrimary: true},
+			{COLUMN_NAME: "name", COLUMN_TYPE: "varchar(20)", DATA_TYPE: "varchar", CHARACTER_OCTET_LENGTH: 80},
+		},
+		ColumnMapping: map[string]string{"id": "int32", "name": "Nullable(varchar(20))"},
+	}
+	return parser
+}
+
+func TestEventParser_TransactionPayloadEvent(t *testing.T) {
+	for _, compressionType := range []uint64{PAYLOAD_COMPRESSION_TYPE_ZSTD, PAYLOAD_COMPRESSION_TYPE_NONE} {
+		parser := newPayloadTestParser()
+		parser.binlog_checksum = true
+		data := payloadTestPayloadEventData(t, compressionType, 1024,
+			payloadTestTableMapEventData(),
+			payloadTestWriteRowsEventData(1, "bifrost"),
+			payloadTestWriteRowsEventData(2, "bristol"),
+			payloadTestXidEventData(99),
+		)
+		startPos := 1024 - binary.LittleEndian.Uint32(data[9:13])
+		// checksum
+		data = append(data, 0, 0, 0, 0)
+
+		eventDataList, err := parser.splitEventPacket(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(eventDataList) != 4 {
+			t.Fatalf("compressionType:%d eventDataList len:%d != 4", compressionType, len(eventDataList))
+		}
+		eventTypes := []EventType{TABLE_MAP_EVENT, WRITE_ROWS_EVENTv2, WRITE_ROWS_EVENTv2, XID_EVENT}
+		var rows []map[string]interface{}
+		for i, eventData := range eventDataList {
+			event, _, err := parser.parseEvent(eventData)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if event.Header.EventType != eventTypes[i] {
+				t.Fatalf("event %d type:%s != %d", i, event.Header.EventName(), eventTypes[i])
+			}
+			// 最后一个事件是 payload 结束位点, 前面的事件是 payload 起始位点 + PayloadIndex
+			var wantPos, wantIndex uint32 = startPos, uint32(i + 1)
+			if i == len(eventDataList)-1 {
+				wantPos, wantIndex = 1024, 0
+			}
+			if event.Header.LogPos != wantPos || event.BinlogPosition != wantPos || event.PayloadIndex != wantIndex {
+				t.Fatalf("event %d LogPos:%d BinlogPosition:%d PayloadIndex:%d != %d %d", i, event.Header.LogPos, event.BinlogPosition, event.PayloadIndex, wantPos, wantIndex)
+			}
+			if event.BinlogFileName != "mysql-bin.000001" {
+				t.Fatalf("event %d BinlogFileName:%s", i, event.BinlogFileName)
+			}
+			if event.Header.EventType == WRITE_ROWS_EVENTv2 {
+				if event.SchemaName != "bifrost_test" || event.TableName != "payload_test" {
+					t.Fatalf("event %d SchemaName:%s TableName:%s", i, event.SchemaName, event.TableName)
+				}
+				rows = append(rows, event.Rows...)
+			}
+		}
+		if len(rows) != 2 {
+			t.Fatalf("rows len:%d != 2", len(rows))
+		}
+		if rows[0]["id"] != int32(1) || rows[0]["name"] != "bifrost" {
+			t.Fatalf("rows[0]:%+v", rows[0])
+		}
+		if rows[1]["id"] != int32(2) || rows[1]["name"] != "bristol" {
+			t.Fatalf("rows[1]:%+v", rows[1])
+		}
+	}
+}
+
+func TestEventParser_TransactionPayloadEvent_Gtid(t *testing.T) {
+	parser := newPayloadTestParser()
+	// GTID_EVENT 是在 payload 事件之外下发的
+	parser.gtidSetInfo.Update("04038bcc-fd0c-11e7-9cc5-000c29db6599:1-18")
+	data := payloadTestPayloadEventData(t, PAYLOAD_COMPRESSION_TYPE_ZSTD, 2048,
+		payloadTestTableMapEventData(),
+		payloadTestWriteRowsEventData(1, "bifrost"),
+		payloadTestXidEventData(100),
+	)
+	eventDataList, err := parser.splitEventPacket(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var event *EventReslut
+	for _, eventData := range eventDataList {
+		event, _, err = parser.parseEvent(eventData)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if event.Header.EventType != XID_EVENT {
+		t.Fatalf("last event type:%s", event.Header.EventName())
+	}
+	if event.Gtid != parser.getGtid() || event.Gtid == "" {
+		t.Fatalf("xid gtid:%s != %s", event.Gtid, parser.getGtid())
+	}
+	parser.saveBinlog(event)
+	if parser.binlogPosition != 2048 {
+		t.Fatalf("saved binlogPosition:%d != 2048", parser.binlogPosition)
+	}
+}
+
+// 在 payload 中间重启, 保存的是 payload 起始位点, 重新 dump 的时候整个 payload 会重新解析, 后面的事件不会丢
+func TestEventParser_TransactionPayloadEvent_RestartInPayload(t *testing.T) {
+	newPayload := func() []byte {
+		return payloadTestPayloadEventData(t, PAYLOAD_COMPRESSION_TYPE_ZSTD, 4096,
+			payloadTestTableMapEventData(),
+			payloadTestWriteRowsEventData(1, "bifrost"),
+			payloadTestWriteRowsEventData(2, "bristol"),
+			payloadTestXidEventData(101),
+		)
+	}
+	data := newPayload()
+	startPos := 4096 - binary.LittleEndian.Uint32(data[9:13])
+
+	parser := newPayloadTestParser()
+	eventDataList, err := parser.splitEventPacket(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 处理完第一行数据之后就停止了, 保存的位点是 payload 起始位点
+	var lastEvent *EventReslut
+	for _, eventData := range eventDataList[0:2] {
+		lastEvent, _, err = parser.parseEvent(eventData)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if lastEvent.BinlogPosition != startPos || lastEvent.PayloadIndex != 2 {
+		t.Fatalf("BinlogPosition:%d PayloadIndex:%d != %d 2", lastEvent.BinlogPosition, lastEvent.PayloadIndex, startPos)
+	}
+	lastPos, lastIndex := lastEvent.BinlogPosition, lastEvent.PayloadIndex
+
+	// 从保存的位点重新 dump, 同一个 payload 会重新下发
+	parser = newPayloadTestParser()
+	eventDataList, err = parser.splitEventPacket(newPayload())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []map[string]interface{}
+	for _, eventData := range eventDataList {
+		event, _, err := parser.parseEvent(eventData)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 和 server 端一样, 已经处理过的位点跳过
+		if event.BinlogPosition < lastPos || (event.BinlogPosition == lastPos && event.PayloadIndex <= lastIndex) {
+			continue
+		}
+		if event.Header.EventType == WRITE_ROWS_EVENTv2 {
+			rows = append(rows, event.Rows...)
+		}
+	}
+	if len(rows) != 1 || rows[0]["id"] != int32(2) {
+		t.Fatalf("rows:%+v", rows)
+	}
+}
+
+// 同一个解析器复用一个 zstd 解码器，之前解压出来的数据不能被后面的覆盖
+func TestEventParser_TransactionPayloadEvent_ReuseDecoder(t *testing.T) {
+	parser := newPayloadTestParser()
+	defer parser.closePayloadDecoder()
+	first, err := parser.splitEventPacket(payloadTestPayloadEventData(t, PAYLOAD_COMPRESSION_TYPE_ZSTD, 1024,
+		payloadTestTableMapEventData(),
+		payloadTestWriteRowsEventData(1, "bifrost"),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoder := parser.payloadDecoder
+	if decoder == nil {
+		t.Fatal("payloadDecoder is nil")
+	}
+	firstCopy := append([]byte{}, first[1]...)
+	second, err := parser.splitEventPacket(payloadTestPayloadEventData(t, PAYLOAD_COMPRESSION_TYPE_ZSTD, 2048,
+		payloadTestTableMapEventData(),
+		payloadTestWriteRowsEventData(2, "bristol"),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parser.payloadDecoder != decoder {
+		t.Fatal("payloadDecoder not reused")
+	}
+	if len(second) != 2 || !bytes.Equal(first[1], firstCopy) {
+		t.Fatal("first payload event data be overwritten")
+	}
+	parser.closePayloadDecoder()
+	if parser.payloadDecoder != nil {
+		t.Fatal("payloadDecoder not closed")
+	}
+}
+
+func TestEventParser_splitEventPacket_NotPayload(t *testing.T) {
+	parser := newPayloadTestParser()
+	data := payloadTestXidEventData(1)
+	eventDataList, err := parser.splitEventPacket(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(eventDataList) != 1 || !bytes.Equal(eventDataList[0], data) {
+		t.Fatalf("eventDataList:%+v", eventDataList)
+	}
+	event, _, err := parser.parseEvent(eventDataList[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Header.LogPos != 0 {
+		t.Fatalf("LogPos:%d != 0", event.Header.LogPos)
+	}
+}
+
+func TestEventParser_TransactionPayloadEvent_UnknowCompressionType(t *testing.T) {
+	parser := newPayloadTestParser()
+	data := payloadTestPayloadEventData(t, 1, 1024, payloadTestXidEventData(1))
+	_, err := parser.splitEventPacket(data)
+	if err == nil {
+		t.Fatal("need err")
+	}
+	t.Log(err)
+}
+
+func TestEventHeader_EventName_TransactionPayload(t *testing.T) {
+	header := EventHeader{EventType: TRANSACTION_PAYLOAD_EVENT}
+	if header.EventName() != "TRANSACTION_PAYLOAD_EVENT" {
+		t.Fatalf("EventName:%s", header.EventName())
+	}
+	if TRANSACTION_PAYLOAD_EVENT != 40 || PARTIAL_UPDATE_ROWS_EVENT != 39 {
+		t.Fatalf("TRANSACTION_PAYLOAD_EVENT:%d PARTIAL_UPDATE_ROWS_EVENT:%d", TRANSACTION_PAYLOAD_EVENT, PARTIAL_UPDATE_ROWS_EVENT)
+	}
+}
@@ -330,3 +330,217 @@ func read_binary_json_type_inlined(buf *bytes.Buffer, z uint8, large bool) (data
 
 	panic("Json type " + fmt.Sprint(z) + " is not handled")
 }
+
+// binlog_row_value_options=PARTIAL_JSON 时，json 字段的 diff 操作类型
+// https://dev.mysql.com/doc/dev/mysql-server/latest/json__diff_8h.html
+const (
+	JSON_DIFF_OPERATION_REPLACE = 0x0
+	JSON_DIFF_OPERATION_INSERT  = 0x1
+	JSON_DIFF_OPERATION_REMOVE  = 0x2
+)
+
+type json_path_leg struct {
+	key     string
+	index   int
+	isArray bool
+}
+
+/*
+json diff 格式,可能有多个 diff 连续存放:
+
+	1 byte operation
+	length encoded path length
+	path
+	length encoded value length (REMOVE 没有)
+	value ,json binary 格式 (REMOVE 没有)
+*/
+func apply_json_diff(before interface{}, data []byte) (interface{}, error) {
+	doc := copy_json_value(before)
+	buf := bytes.NewBuffer(data)
+	for buf.Len() > 0 {
+		operation, err := buf.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		pathLength, _, err := readLengthEncodedInt(buf)
+		if err != nil {
+			return nil, err
+		}
+		if buf.Len() < int(pathLength) {
+			return nil, fmt.Errorf("json diff path length:%d > buf len:%d", pathLength, buf.Len())
+		}
+		path := string(buf.Next(int(pathLength)))
+		legs, err := parse_json_path(path)
+		if err != nil {
+			return nil, err
+		}
+		var value interface{}
+		if operation != JSON_DIFF_OPERATION_REMOVE {
+			valueLength, _, err := readLengthEncodedInt(buf)
+			if err != nil {
+				return nil, err
+			}
+			if buf.Len() < int(valueLength) || valueLength == 0 {
+				return nil, fmt.Errorf("json diff path:%s value length:%d err, buf len:%d", path, valueLength, buf.Len())
+			}
+			value, err = get_field_json_data(buf.Next(int(valueLength)), int64(valueLength))
+			if err != nil {
+				return nil, err
+			}
+		}
+		doc, err = apply_json_diff_operation(doc, operation, legs, value)
+		if err != nil {
+			return nil, fmt.Errorf("json diff path:%s err:%s", path, err.Error())
+		}
+	}
+	return doc, nil
+}
+
+func apply_json_diff_operation(doc interface{}, operation byte, legs []json_path_leg, value interface{}) (interface{}, error) {
+	if len(legs) == 0 {
+		if operation == JSON_DIFF_OPERATION_REPLACE {
+			return value, nil
+		}
+		return nil, fmt.Errorf("operation %d can't apply to the root", operation)
+	}
+	leg := legs[0]
+	if leg.isArray {
+		array, ok := doc.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%v is not array", doc)
+		}
+		if len(legs) > 1 {
+			if leg.index < 0 || leg.index >= len(array) {
+				return nil, fmt.Errorf("array index %d out of range", leg.index)
+			}
+			v, err := apply_json_diff_operation(array[leg.index], operation, legs[1:], value)
+			if err != nil {
+				return nil, err
+			}
+			array[leg.index] = v
+			return array, nil
+		}
+		switch operation {
+		case JSON_DIFF_OPERATION_REPLACE:
+			if leg.index < 0 || leg.index >= len(array) {
+				return nil, fmt.Errorf("array index %d out of range", leg.index)
+			}
+			array[leg.index] = value
+		case JSON_DIFF_OPERATION_INSERT:
+			index := leg.index
+			if index > len(array) {
+				index = len(array)
+			}
+			array = append(array, nil)
+			copy(array[index+1:], array[index:])
+			array[index] = value
+		case JSON_DIFF_OPERATION_REMOVE:
+			if leg.index < 0 || leg.index >= len(array) {
+				return nil, fmt.Errorf("array index %d out of range", leg.index)
+			}
+			array = append(array[:leg.index], array[leg.index+1:]...)
+		default:
+			return nil, fmt.Errorf("unknow json diff operation %d", operation)
+		}
+		return array, nil
+	}
+	object, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%v is not object", doc)
+	}
+	if len(legs) > 1 {
+		child, ok := object[leg.key]
+		if !ok {
+			return nil, fmt.Errorf("key %s not exist", leg.key)
+		}
+		v, err := apply_json_diff_operation(child, operation, legs[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		object[leg.key] = v
+		return object, nil
+	}
+	switch operation {
+	case JSON_DIFF_OPERATION_REPLACE, JSON_DIFF_OPERATION_INSERT:
+		object[leg.key] = value
+	case JSON_DIFF_OPERATION_REMOVE:
+		delete(object, leg.key)
+	default:
+		return nil, fmt.Errorf("unknow json diff operation %d", operation)
+	}
+	return object, nil
+}
+
+// 解析 json diff 中的 path ,例如: $.a."b c"[1]
+// json diff 中的 path 不会有通配符
+func parse_json_path(path string) (legs []json_path_leg, err error) {
+	if len(path) == 0 || path[0] != '$' {
+		return nil, fmt.Errorf("json path %s not start with $", path)
+	}
+	i := 1
+	for i < len(path) {
+		switch path[i] {
+		case ' ':
+			i++
+		case '.':
+			i++
+			if i < len(path) && path[i] == '"' {
+				var key []byte
+				i++
+				for ; i < len(path) && path[i] != '"'; i++ {
+					if path[i] == '\\' && i+1 < len(path) {
+						i++
+					}
+					key = append(key, path[i])
+				}
+				if i >= len(path) {
+					return nil, fmt.Errorf("json path %s quoted key not closed", path)
+				}
+				i++
+				legs = append(legs, json_path_leg{key: string(key)})
+				continue
+			}
+			start := i
+			for i < len(path) && path[i] != '.' && path[i] != '[' && path[i] != ' ' {
+				i++
+			}
+			if start == i {
+				return nil, fmt.Errorf("json path %s empty key", path)
+			}
+			legs = append(legs, json_path_leg{key: path[start:i]})
+		case '[':
+			end := bytes.IndexByte([]byte(path[i:]), ']')
+			if end < 0 {
+				return nil, fmt.Errorf("json path %s array index not closed", path)
+			}
+			var index int
+			if _, err = fmt.Sscanf(path[i+1:i+end], "%d", &index); err != nil {
+				return nil, fmt.Errorf("json path %s array index err:%s", path, err.Error())
+			}
+			legs = append(legs, json_path_leg{index: index, isArray: true})
+			i += end + 1
+		default:
+			return nil, fmt.Errorf("json path %s unexpected char %c", path, path[i])
+		}
+	}
+	return
+}
+
+func copy_json_value(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(value))
+		for k, val := range value {
+			m[k] = copy_json_value(val)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(value))
+		for i, val := range value {
+			a[i] = copy_json_value(val)
+		}
+		return a
+	default:
+		return v
+	}
+}
@@ -0,0 +1,79 @@
+package mysql
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func jsonDiffTestString(s string) []byte {
+	return append([]byte{JSONB_TYPE_STRING, byte(len(s))}, s...)
+}
+
+func jsonDiffTestInt16(n int16) []byte {
+	return []byte{JSONB_TYPE_INT16, byte(n), byte(n >> 8)}
+}
+
+func jsonDiffTestData(operation byte, path string, value []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(operation)
+	buf.Write(lengthCodedBinaryToBytes(uint64(len(path))))
+	buf.WriteString(path)
+	if operation != JSON_DIFF_OPERATION_REMOVE {
+		buf.Write(lengthCodedBinaryToBytes(uint64(len(value))))
+		buf.Write(value)
+	}
+	return buf.Bytes()
+}
+
+func TestParseJsonPath(t *testing.T) {
+	legs, err := parse_json_path(`$.a."b c"[2].d`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []json_path_leg{{key: "a"}, {key: "b c"}, {index: 2, isArray: true}, {key: "d"}}
+	if !reflect.DeepEqual(legs, expect) {
+		t.Fatalf("legs:%+v", legs)
+	}
+	if _, err = parse_json_path(`a.b`); err == nil {
+		t.Fatal("need err")
+	}
+}
+
+func TestApplyJsonDiff(t *testing.T) {
+	before := map[string]interface{}{
+		"a":    "x",
+		"list": []interface{}{int16(1), int16(2), int16(3)},
+		"del":  true,
+	}
+	var data []byte
+	data = append(data, jsonDiffTestData(JSON_DIFF_OPERATION_REPLACE, "$.a", jsonDiffTestString("y"))...)
+	data = append(data, jsonDiffTestData(JSON_DIFF_OPERATION_INSERT, "$.b", jsonDiffTestInt16(5))...)
+	data = append(data, jsonDiffTestData(JSON_DIFF_OPERATION_INSERT, "$.list[1]", jsonDiffTestInt16(9))...)
+	data = append(data, jsonDiffTestData(JSON_DIFF_OPERATION_REMOVE, "$.list[3]", nil)...)
+	data = append(data, jsonDiffTestData(JSON_DIFF_OPERATION_REMOVE, "$.del", nil)...)
+	after, err := apply_json_diff(before, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]interface{}{
+		"a":    "y",
+		"b":    int16(5),
+		"list": []interface{}{int16(1), int16(9), int16(2)},
+	}
+	if !reflect.DeepEqual(after, expect) {
+		t.Fatalf("after:%+v", after)
+	}
+	// before image 不能被修改
+	if before["a"] != "x" || len(before["list"].([]interface{})) != 3 || before["del"] != true {
+		t.Fatalf("before changed:%+v", before)
+	}
+}
+
+func TestApplyJsonDiff_Err(t *testing.T) {
+	before := map[string]interface{}{"a": "x"}
+	data := jsonDiffTestData(JSON_DIFF_OPERATION_REPLACE, "$.a.b", jsonDiffTestString("y"))
+	if _, err := apply_json_diff(before, data); err == nil {
+		t.Fatal("need err")
+	}
+}
@@ -12,6 +12,8 @@ type tableStruct struct {
 	ColumnSchemaTypeList []*ColumnInfo
 	needReload           bool
 	ColumnMapping        map[string]string
+	fromMetadata         bool   // 表结构是否是从 table map event 的 optional metadata 中解析出来的
+	metadataSign         string // fromMetadata 的时候, 生成表结构的 table map event 内容
 }
 
 type ColumnInfo struct {
@@ -55,6 +57,12 @@ type EventReslut struct {
 	Pri            []string
 	ColumnMapping  map[string]string
 	EventID        uint64 // 事件ID
+	// TRANSACTION_PAYLOAD_EVENT 里除最后一个以外的事件, 位点都是 payload 的起始位点, 用这个序号(从 1 开始)区分先后
+	// 其他事件都是 0
+	PayloadIndex uint32
+	// binlog_row_image 为 MINIMAL,NOBLOB 的时候，和 Rows 一一对应，记录每一行实际存在的字段
+	// nil 代表所有行都是完整的
+	PresentColumns [][]string
 }
 
 type callback func(data *EventReslut)
@@ -7,6 +7,9 @@ import (
 	"log"
 	"runtime/debug"
 	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
 )
 
 type eventParser struct {
@@ -38,6 +41,11 @@ type eventParser struct {
 	lastPrevtiousGTIDSMap map[string]Intervals // 当前解析的 binlog 文件的 PrevtiousGTIDS 对应关系
 	gtidSetInfo           GTIDSet
 	dbType                DBType
+	payloadLogPos         uint32 // 当前正在解析的 TRANSACTION_PAYLOAD_EVENT 的位点，非 payload 事件时为 0
+	payloadStartPos       uint32 // 当前 TRANSACTION_PAYLOAD_EVENT 的起始位点
+	payloadEventCount     int    // payload 里的事件数
+	payloadEventIndex     int    // 已经解析到 payload 里的第几个事件
+	payloadDecoder        *zstd.Decoder
 }
 
 func newEventParser(binlogDump *BinlogDump) (parser *eventParser) {
@@ -104,13 +112,58 @@ func (parser *eventParser) getGtid() string {
 	return parser.gtidSetInfo.String()
 }
 
-func (parser *eventParser) parseEvent(data []byte) (event *EventReslut, filename string, err error) {
-	var buf *bytes.Buffer
+// 将 dump 连接上读到的一个事件包拆分成一个或多个待解析的事件，返回的事件数据都已经去掉了 checksum
+// TRANSACTION_PAYLOAD_EVENT 会被解压，里面的每一个事件再按正常的事件解析流程解析
+func (parser *eventParser) splitEventPacket(data []byte) (eventDataList [][]byte, err error) {
 	if parser.binlog_checksum {
-		buf = bytes.NewBuffer(data[0 : len(data)-4])
+		data = data[0 : len(data)-4]
+	}
+	parser.payloadLogPos = 0
+	if EventType(data[4]) != TRANSACTION_PAYLOAD_EVENT {
+		return [][]byte{data}, nil
+	}
+	var payloadEvent *TransactionPayloadEvent
+	payloadEvent, err = parser.parseTransactionPayloadEvent(bytes.NewBuffer(data))
+	if err != nil {
+		return
+	}
+	eventDataList, err = parser.decodePayload(payloadEvent)
+	if err != nil {
+		return
+	}
+	parser.payloadLogPos = payloadEvent.header.LogPos
+	parser.payloadStartPos = payloadEvent.header.LogPos - payloadEvent.header.EventSize
+	parser.payloadEventCount = len(eventDataList)
+	parser.payloadEventIndex = 0
+	return
+}
+
+// data 为已经去掉了 checksum 的完整事件数据
+func (parser *eventParser) parseEvent(data []byte) (event *EventReslut, filename string, err error) {
+	event, filename, err = parser.parseEvent0(data)
+	if parser.payloadLogPos == 0 {
+		return
+	}
+	// payload 里的事件位点并不是 binlog 文件中的真实位点，只有 payload 的起始和结束位点可以用来重新 dump
+	// 最后一个事件用 payload 结束的位点, 前面的事件用 payload 起始的位点, 并用 PayloadIndex 区分先后
+	// 这样在 payload 中间重启的时候，会从 payload 起始位点重新 dump, 不会丢掉后面还没有处理的事件
+	parser.payloadEventIndex++
+	if event == nil {
+		return
+	}
+	if parser.payloadEventIndex >= parser.payloadEventCount {
+		event.Header.LogPos = parser.payloadLogPos
+		event.PayloadIndex = 0
 	} else {
-		buf = bytes.NewBuffer(data)
+		event.Header.LogPos = parser.payloadStartPos
+		event.PayloadIndex = uint32(parser.payloadEventIndex)
 	}
+	event.BinlogPosition = event.Header.LogPos
+	return
+}
+
+func (parser *eventParser) parseEvent0(data []byte) (event *EventReslut, filename string, err error) {
+	buf := bytes.NewBuffer(data)
 	//log.Println("data[4]:",data[4])
 	switch EventType(data[4]) {
 	case HEARTBEAT_EVENT, IGNORABLE_EVENT:
@@ -237,9 +290,26 @@ func (parser *eventParser) parseEvent(data []byte) (event *EventReslut, filename
 			parser.filterNextRowEvent = true
 		} else {
 			parser.filterNextRowEvent = false
-			_, ok := parser.tableSchemaMap[table_map_event.tableId]
-			if !ok || (parser.tableSchemaMap[table_map_event.tableId].needReload == true) {
-				parser.GetTableSchema(table_map_event.tableId, table_map_event.schemaName, table_map_event.tableName)
+			// binlog_row_metadata=FULL 的时候，优先使用 binlog 里记录的表结构，这样回放历史 binlog 的时候，不会因为表结构已经被修改而解析出错
+			if table_map_event.hasFullMetadata() {
+				// 同一个 tableId 的 table map event 没有变化的时候，不重新生成表结构
+				oldTableInfo, ok := parser.tableSchemaMap[table_map_event.tableId]
+				if !ok || !oldTableInfo.fromMetadata || oldTableInfo.needReload || oldTableInfo.metadataSign != table_map_event.metadataSign {
+					var boolColumns map[string]bool
+					if table_map_event.hasTinyColumn() {
+						boolColumns = parser.getBoolColumns(table_map_event.schemaName, table_map_event.tableName)
+					}
+					tableInfo := table_map_event.tableStructByOptionalMetadata(boolColumns)
+					parser.binlogDump.Lock()
+					parser.tableNameMap[table_map_event.schemaName+"."+table_map_event.tableName] = table_map_event.tableId
+					parser.tableSchemaMap[table_map_event.tableId] = tableInfo
+					parser.binlogDump.Unlock()
+				}
+			} else {
+				_, ok := parser.tableSchemaMap[table_map_event.tableId]
+				if !ok || (parser.tableSchemaMap[table_map_event.tableId].needReload == true) {
+					parser.GetTableSchema(table_map_event.tableId, table_map_event.schemaName, table_map_event.tableName)
+				}
 			}
 		}
 		event = &EventReslut{
@@ -251,11 +321,20 @@ func (parser *eventParser) parseEvent(data []byte) (event *EventReslut, filename
 		}
 
 		break
-	case WRITE_ROWS_EVENTv0, WRITE_ROWS_EVENTv1, WRITE_ROWS_EVENTv2, UPDATE_ROWS_EVENTv0, UPDATE_ROWS_EVENTv1, UPDATE_ROWS_EVENTv2, DELETE_ROWS_EVENTv0, DELETE_ROWS_EVENTv1, DELETE_ROWS_EVENTv2:
+	case WRITE_ROWS_EVENTv0, WRITE_ROWS_EVENTv1, WRITE_ROWS_EVENTv2, UPDATE_ROWS_EVENTv0, UPDATE_ROWS_EVENTv1, UPDATE_ROWS_EVENTv2, DELETE_ROWS_EVENTv0, DELETE_ROWS_EVENTv1, DELETE_ROWS_EVENTv2, PARTIAL_UPDATE_ROWS_EVENT:
 		var rowsEvent *RowsEvent
 		rowsEvent, err = parser.parseRowsEvent(buf)
 		if err != nil {
 			log.Println("row event err:", err)
+			// json diff 没有还原成完整的数据，不能把缺少字段的事件传给上一层，也不能直接丢掉
+			// 返回错误停止解析，重连后会从上一个事务结束的位点重新解析，一直失败的话状态会一直是这个错误，需要人工处理
+			if rowsEvent.header.EventType == PARTIAL_UPDATE_ROWS_EVENT {
+				return nil, "", fmt.Errorf("PARTIAL_UPDATE_ROWS_EVENT json diff can't be applied, binlog dump stopped at %s %d, please check binlog_row_image=FULL or set binlog_row_value_options='' ; err:%s", parser.currentBinlogFileName, rowsEvent.header.LogPos, err.Error())
+			}
+		}
+		// json diff 已经基于 before image 还原成了完整的 after image,对上一层来说就是一个普通的 update 事件
+		if rowsEvent.header.EventType == PARTIAL_UPDATE_ROWS_EVENT {
+			rowsEvent.header.EventType = UPDATE_ROWS_EVENTv2
 		}
 		if tableInfo, ok := parser.tableSchemaMap[rowsEvent.tableId]; ok {
 			event = &EventReslut{
@@ -265,6 +344,7 @@ func (parser *eventParser) parseEvent(data []byte) (event *EventReslut, filename
 				SchemaName:     tableInfo.SchemaName,
 				TableName:      tableInfo.TableName,
 				Rows:           rowsEvent.rows,
+				PresentColumns: rowsEvent.presentColumns,
 				Pri:            tableInfo.Pri,
 				ColumnMapping:  tableInfo.ColumnMapping,
 			}
@@ -355,9 +435,57 @@ func (parser *eventParser) GetTableSchema(tableId uint64, database string, table
 	}
 }
 
+// binlog 里没有 int 的显示宽度，tinyint(1) 的字段从 information_schema 中查询
+// 表已经被删除的时候，查不到字段，就全部当作 tinyint(4) 处理
+// 查询 bool 字段失败时的重试次数及第一次重试的等待时间, 每次重试等待时间翻倍
+var getBoolColumnsRetryCount = 3
+var getBoolColumnsRetryWait = 1 * time.Second
+
+// 查询失败超过重试次数, 返回 nil, 只使用 binlog 里的 FULL metadata, tinyint(1) 当作普通的 tinyint 处理
+func (parser *eventParser) getBoolColumns(database string, tablename string) map[string]bool {
+	wait := getBoolColumnsRetryWait
+	for i := 0; ; i++ {
+		parser.binlogDump.Lock()
+		tableInfo, err := parser.queryTableSchema(database, tablename)
+		parser.binlogDump.Unlock()
+		if err != nil {
+			if i >= getBoolColumnsRetryCount {
+				log.Println(*parser.dataSource, "binlog getBoolColumns err:", err, " database:", database, " tablename:", tablename, " retry:", i, " use binlog metadata only, tinyint(1) will not be converted to bool")
+				return nil
+			}
+			log.Println(*parser.dataSource, "binlog getBoolColumns err:", err, " database:", database, " tablename:", tablename, " retry after:", wait)
+			time.Sleep(wait)
+			wait *= 2
+			continue
+		}
+		boolColumns := make(map[string]bool)
+		for _, columnInfo := range tableInfo.ColumnSchemaTypeList {
+			if columnInfo.DATA_TYPE == "tinyint" && columnInfo.IsBool {
+				boolColumns[columnInfo.COLUMN_NAME] = true
+			}
+		}
+		return boolColumns
+	}
+}
+
 func (parser *eventParser) GetTableSchemaByName(tableId uint64, database string, tablename string) (errs error) {
 	parser.binlogDump.Lock()
 	defer parser.binlogDump.Unlock()
+	//set dbAndTable Name tableId
+	parser.tableNameMap[database+"."+tablename] = tableId
+	tableInfo, errs := parser.queryTableSchema(database, tablename)
+	if errs != nil {
+		return
+	}
+	if len(tableInfo.ColumnSchemaTypeList) == 0 {
+		return fmt.Errorf("column len is 0 " + "db:" + database + " table:" + tablename + " tableId:" + fmt.Sprint(tableId) + " may be no privilege")
+	}
+	parser.tableSchemaMap[tableId] = tableInfo
+	return nil
+}
+
+// 从 information_schema 查询表结构，调用方需要加锁
+func (parser *eventParser) queryTableSchema(database string, tablename string) (tableInfo *tableStruct, errs error) {
 	errs = fmt.Errorf("unknow error")
 	defer func() {
 		if err := recover(); err != nil {
@@ -368,8 +496,6 @@ func (parser *eventParser) GetTableSchemaByName(tableId uint64, database string,
 	if parser.connStatus == STATUS_CLOSED {
 		parser.initConn()
 	}
-	//set dbAndTable Name tableId
-	parser.tableNameMap[database+"."+tablename] = tableId
 	sql := "SELECT COLUMN_NAME,COLUMN_KEY,COLUMN_TYPE,CHARACTER_SET_NAME,COLLATION_NAME,NUMERIC_SCALE,EXTRA,COLUMN_DEFAULT,DATA_TYPE,CHARACTER_OCTET_LENGTH,IS_NULLABLE FROM information_schema.columns WHERE table_schema='" + database + "' AND table_name='" + tablename + "' ORDER BY `ORDINAL_POSITION` ASC"
 	stmt, err := parser.conn.Prepare(sql)
 	if err != nil {
@@ -387,7 +513,7 @@ func (parser *eventParser) GetTableSchemaByName(tableId uint64, database string,
 	}
 	defer rows.Close()
 	//columeArr := make([]*tableStruct column_schema_type,0)
-	tableInfo := &tableStruct{
+	tableInfo = &tableStruct{
 		SchemaName:           database,
 		TableName:            tablename,
 		Pri:                  make([]string, 0),
@@ -522,63 +648,64 @@ func (parser *eventParser) GetTableSchemaByName(tableId uint64, database string,
 			tableInfo.Pri = append(tableInfo.Pri, COLUMN_NAME)
 		}
 
-		var columnMappingType string
-		switch DATA_TYPE {
-		case "tinyint":
-			if unsigned {
-				columnMappingType = "uint8"
-			} else {
-				if COLUMN_TYPE == "tinyint(1)" {
-					columnMappingType = "bool"
-				} else {
-					columnMappingType = "int8"
-				}
-			}
-		case "smallint":
-			if unsigned {
-				columnMappingType = "uint16"
-			} else {
-				columnMappingType = "int16"
-			}
-		case "mediumint":
-			if unsigned {
-				columnMappingType = "uint24"
-			} else {
-				columnMappingType = "int24"
-			}
-		case "int":
-			if unsigned {
-				columnMappingType = "uint32"
-			} else {
-				columnMappingType = "int32"
-			}
-		case "bigint":
-			if unsigned {
-				columnMappingType = "uint64"
+		ColumnMapping[COLUMN_NAME] = getColumnMappingType(DATA_TYPE, COLUMN_TYPE, unsigned, IS_NULLABLE == "YES")
+	}
+	tableInfo.needReload = false
+	tableInfo.ColumnMapping = ColumnMapping
+	errs = nil
+	return
+}
+
+// 字段类型转换成 ColumnMapping 中的类型
+func getColumnMappingType(DATA_TYPE, COLUMN_TYPE string, unsigned bool, nullable bool) string {
+	var columnMappingType string
+	switch DATA_TYPE {
+	case "tinyint":
+		if unsigned {
+			columnMappingType = "uint8"
+		} else {
+			if COLUMN_TYPE == "tinyint(1)" {
+				columnMappingType = "bool"
 			} else {
-				columnMappingType = "int64"
+				columnMappingType = "int8"
 			}
-		case "numeric":
-			columnMappingType = strings.Replace(COLUMN_TYPE, "numeric", "decimal", 1)
-		case "real":
-			columnMappingType = strings.Replace(COLUMN_TYPE, "real", "double", 1)
-		default:
-			columnMappingType = COLUMN_TYPE
-			break
 		}
-		if IS_NULLABLE == "YES" {
-			columnMappingType = "Nullable(" + columnMappingType + ")"
+	case "smallint":
+		if unsigned {
+			columnMappingType = "uint16"
+		} else {
+			columnMappingType = "int16"
+		}
+	case "mediumint":
+		if unsigned {
+			columnMappingType = "uint24"
+		} else {
+			columnMappingType = "int24"
 		}
-		ColumnMapping[COLUMN_NAME] = columnMappingType
+	case "int":
+		if unsigned {
+			columnMappingType = "uint32"
+		} else {
+			columnMappingType = "int32"
+		}
+	case "bigint":
+		if unsigned {
+			columnMappingType = "uint64"
+		} else {
+			columnMappingType = "int64"
+		}
+	case "numeric":
+		columnMappingType = strings.Replace(COLUMN_TYPE, "numeric", "decimal", 1)
+	case "real":
+		columnMappingType = strings.Replace(COLUMN_TYPE, "real", "double", 1)
+	default:
+		columnMappingType = COLUMN_TYPE
+		break
 	}
-	if len(tableInfo.ColumnSchemaTypeList) == 0 {
-		return fmt.Errorf("column len is 0 " + "db:" + database + " table:" + tablename + " tableId:" + fmt.Sprint(tableId) + " may be no privilege")
+	if nullable {
+		columnMappingType = "Nullable(" + columnMappingType + ")"
 	}
-	tableInfo.needReload = false
-	tableInfo.ColumnMapping = ColumnMapping
-	parser.tableSchemaMap[tableId] = tableInfo
-	errs = nil
-	return
+	return columnMappingType
 }
 
 func (parser *eventParser) GetConnectionInfo(connectionId string) (m map[string]string, e error) {
@@ -655,6 +782,13 @@ func (parser *eventParser) GetTableId(database string, tablename string) (uint64
 	return parser.tableNameMap[key], nil
 }
 
+func (parser *eventParser) isTableSchemaFromMetadata(tableId uint64) bool {
+	if tableInfo, ok := parser.tableSchemaMap[tableId]; ok {
+		return tableInfo.fromMetadata
+	}
+	return false
+}
+
 func (parser *eventParser) delTableId(database string, tablename string) {
 	key := database + "." + tablename
 	if tableId, ok := parser.tableNameMap[key]; ok {
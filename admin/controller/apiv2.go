@@ -0,0 +1,255 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/brokercap/Bifrost/admin/xgo"
+	"github.com/brokercap/Bifrost/server/cluster"
+	"github.com/brokercap/Bifrost/server/user"
+)
+
+// /api/v2 接口
+// 按资源划分的 REST 风格的路由, 用 http 状态码表示结果, 出错的时候返回 APIV2Error
+// 支持 API token ( Authorization: Bearer xxx ), Basic 认证, 以及管理后台登录之后的 session
+
+type APIV2Controller struct {
+	CommonController
+	route    *apiV2Route
+	apiToken *user.APIToken // token 认证的时候不为空
+	group    string
+}
+
+type APIV2Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// token 不能用来管理 token, 只能用 session 或者 Basic 认证
+const apiV2ScopeTokens = "tokens"
+
+type apiV2Route struct {
+	Method   string
+	Path     string
+	Action   string
+	Scope    string // 需要的资源权限, 为空的不需要认证
+	Summary  string
+	Query    []string    // url 参数
+	Status   int         // 成功的时候返回的状态码
+	Request  interface{} // 请求 body 的类型, 生成 openapi 文档使用
+	Response interface{} // 返回的数据类型
+}
+
+var apiV2RouteMap = make(map[string]*apiV2Route, 0)
+
+func init() {
+	for _, route := range apiV2RouteList {
+		if route.Status == 0 {
+			route.Status = http.StatusOK
+		}
+		apiV2RouteMap[route.Action] = route
+	}
+}
+
+// 注册路由使用
+func GetAPIV2RouteList() []*apiV2Route {
+	return apiV2RouteList
+}
+
+// body 只支持 json, curl -d 之类默认是表单格式的, 不能被 ParseForm 读掉
+func (c *APIV2Controller) Init(ctx *xgo.Context, controllerName, actionName string) {
+	if strings.Contains(ctx.Request.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		ctx.Request.Header.Set("Content-Type", "application/json")
+	}
+	c.CommonController.Init(ctx, controllerName, actionName)
+}
+
+func (c *APIV2Controller) isWriteRequest() bool {
+	return c.Ctx.Request.Method != http.MethodGet && c.Ctx.Request.Method != http.MethodHead
+}
+
+func (c *APIV2Controller) Prepare() {
+	c.route = apiV2RouteMap[c.ActionName]
+	if c.route == nil {
+		c.writeError(http.StatusNotFound, "not found")
+		return
+	}
+	if c.route.Scope == "" {
+		return
+	}
+	if code, err := c.author(); err != nil {
+		c.writeError(code, err.Error())
+		return
+	}
+	write := c.isWriteRequest()
+	if c.apiToken != nil {
+		if c.route.Scope == apiV2ScopeTokens || !c.apiToken.HasScope(c.route.Scope, write) {
+			c.writeError(http.StatusForbidden, fmt.Sprintf("token has no scope: %s:%s", c.route.Scope, scopeLevel(write)))
+			return
+		}
+	}
+	// 转发到别的节点的请求, 由数据源所在的节点校验权限
+	c.clusterProxy(write)
+	// 每个用户都可以管理自己的 token
+	if c.route.Scope != apiV2ScopeTokens {
+		if err := c.checkRequestPermission(write); err != nil {
+			c.writeError(http.StatusForbidden, err.Error())
+			return
+		}
+	}
+	if write {
+		if err := cluster.CheckLeader(); err != nil {
+			c.writeError(http.StatusServiceUnavailable, err.Error())
+			return
+		}
+	}
+}
+
+func scopeLevel(write bool) string {
+	if write {
+		return user.SCOPE_WRITE
+	}
+	return user.SCOPE_READ
+}
+
+// 返回认证失败时候的状态码
+func (c *APIV2Controller) author() (int, error) {
+	req := c.Ctx.Request
+	mayXRealIP, remoteAddrIp := c.GetRemoteIp()
+	var userInfo *user.UserInfo
+	var err error
+	auth := req.Header.Get("Authorization")
+	switch {
+	case c.isClusterRequest():
+		var UserName string
+		if UserName, err = checkClusterRequest(req); err != nil {
+			return http.StatusUnauthorized, err
+		}
+		userInfo = user.GetUserInfo(UserName)
+	case strings.HasPrefix(auth, "Bearer "):
+		c.apiToken, userInfo, err = user.CheckAPIToken(strings.TrimSpace(strings.TrimPrefix(auth, "Bearer ")), mayXRealIP, remoteAddrIp)
+		if err != nil {
+			return http.StatusUnauthorized, err
+		}
+	case auth != "":
+		UserName, Password, ok := req.BasicAuth()
+		if !ok || UserName == "" {
+			return http.StatusUnauthorized, fmt.Errorf("Author error")
+		}
+		if userInfo, err = user.CheckUserWithIP(UserName, Password, mayXRealIP, remoteAddrIp); err != nil {
+			return http.StatusUnauthorized, err
+		}
+	default:
+		sessionID := c.Ctx.Session.CheckCookieValid(c.Ctx.ResponseWriter, req)
+		if sessionID == "" {
+			return http.StatusUnauthorized, fmt.Errorf("Author error")
+		}
+		UserName, ok := c.Ctx.Session.GetSessionVal(sessionID, "UserName")
+		if !ok {
+			return http.StatusUnauthorized, fmt.Errorf("session time out")
+		}
+		userInfo = user.GetUserInfo(fmt.Sprint(UserName))
+	}
+	if userInfo == nil || userInfo.Name == "" {
+		return http.StatusUnauthorized, fmt.Errorf("Author error")
+	}
+	if userInfo.Group == "" {
+		userInfo.Group = user.USER_GROUP_MONITOR
+	}
+	c.userName = userInfo.Name
+	c.userInfo = userInfo
+	c.group = userInfo.Group
+	return 0, nil
+}
+
+// 输出 json 之后结束当前请求
+func (c *APIV2Controller) writeJSON(code int, data interface{}) {
+	c.SetOutputByUser()
+	w := c.Ctx.ResponseWriter
+	if code == http.StatusNoContent || data == nil {
+		w.WriteHeader(code)
+		c.StopRun()
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(data)
+	c.StopRun()
+}
+
+func (c *APIV2Controller) writeError(code int, msg string) {
+	c.writeJSON(code, APIV2Error{Code: code, Message: msg})
+}
+
+// 成功的时候按路由配置的状态码返回
+func (c *APIV2Controller) writeSuccess(data interface{}) {
+	c.writeJSON(c.route.Status, data)
+}
+
+// body 为空的时候不报错, 路由里的参数覆盖 body 里的同名字段
+func (c *APIV2Controller) bindJSON(data interface{}) {
+	body, err := ioutil.ReadAll(c.Ctx.Request.Body)
+	if err != nil {
+		c.writeError(http.StatusBadRequest, err.Error())
+	}
+	if len(strings.TrimSpace(string(body))) > 0 {
+		if err = json.Unmarshal(body, data); err != nil {
+			c.writeError(http.StatusBadRequest, err.Error())
+		}
+	}
+	if err = setParamFields(data, c.Ctx.Params); err != nil {
+		c.writeError(http.StatusBadRequest, err.Error())
+	}
+}
+
+func setParamFields(data interface{}, params map[string]string) error {
+	v := reflect.Indirect(reflect.ValueOf(data))
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	for k, val := range params {
+		f := v.FieldByName(k)
+		if !f.IsValid() || !f.CanSet() {
+			continue
+		}
+		switch f.Kind() {
+		case reflect.String:
+			f.SetString(val)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n, err := strconv.ParseInt(val, 10, 64)
+			if err != nil {
+				return fmt.Errorf("%s must be int", k)
+			}
+			f.SetInt(n)
+		}
+	}
+	return nil
+}
+
+func (c *APIV2Controller) getParamInt(key string) int {
+	n, err := strconv.Atoi(c.Ctx.Request.Form.Get(key))
+	if err != nil {
+		c.writeError(http.StatusBadRequest, key+" must be int")
+	}
+	return n
+}
@@ -0,0 +1,276 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/brokercap/Bifrost/server/history"
+	"github.com/brokercap/Bifrost/server/user"
+	"github.com/brokercap/Bifrost/server/warning"
+)
+
+// /api/v2 全量任务, 报警, 用户, API token
+
+func (c *APIV2Controller) HistoryList() {
+	form := c.Ctx.Request.Form
+	status := getHistoryStatus(form.Get("Status"))
+	c.writeSuccess(c.filterHistoryList(history.GetHistoryList(c.getDbName(), form.Get("SchemaName"), tansferTableName(form.Get("TableName")), status)))
+}
+
+func (c *APIV2Controller) HistoryAdd() {
+	var param HistoryParam
+	c.bindJSON(&param)
+	c.mustGetDbInfo(param.DbName)
+	ID, err := addHistory(&param)
+	if err != nil {
+		c.writeError(http.StatusBadRequest, err.Error())
+	}
+	c.writeSuccess(APIV2IdResult{Id: ID})
+}
+
+// 全量任务不存在直接返回 404
+func (c *APIV2Controller) mustGetHistoryId() (string, int) {
+	DbName := c.getDbName()
+	ID := c.getParamInt("Id")
+	list := history.GetHistoryList(DbName, "", "", history.HISTORY_STATUS_ALL)
+	for i := range list {
+		if list[i].ID == ID {
+			return DbName, ID
+		}
+	}
+	c.writeError(http.StatusNotFound, fmt.Sprintf("%s history id:%d not exist", DbName, ID))
+	return DbName, ID
+}
+
+func (c *APIV2Controller) HistoryDelete() {
+	history.DelHistory(c.mustGetHistoryId())
+	c.writeSuccess(nil)
+}
+
+// 状态不允许的操作返回 409
+func (c *APIV2Controller) doHistory(f func(dbName string, ID int) error) {
+	DbName, ID := c.mustGetHistoryId()
+	if err := f(DbName, ID); err != nil {
+		c.writeError(http.StatusConflict, err.Error())
+	}
+	c.writeSuccess(APIV2IdResult{Id: ID})
+}
+
+func (c *APIV2Controller) HistoryStart() {
+	c.doHistory(history.Start)
+}
+
+func (c *APIV2Controller) HistoryStop() {
+	c.doHistory(history.StopHistory)
+}
+
+func (c *APIV2Controller) HistoryKill() {
+	c.doHistory(history.KillHistory)
+}
+
+func (c *APIV2Controller) HistoryResume() {
+	c.doHistory(history.ResumeHistory)
+}
+
+func (c *APIV2Controller) WarningConfigList() {
+	c.writeSuccess(warning.GetWarningConfigList())
+}
+
+func (c *APIV2Controller) WarningConfigAdd() {
+	var param WarningParam
+	c.bindJSON(&param)
+	if param.Type == "" || len(param.Param) == 0 {
+		c.writeError(http.StatusBadRequest, "Type and Param not empty")
+	}
+	key, err := warning.AddNewWarningConfig(warning.WaringConfig{Type: param.Type, Param: param.Param})
+	if err != nil {
+		c.writeError(http.StatusInternalServerError, err.Error())
+	}
+	c.writeSuccess(APIV2KeyResult{Key: key})
+}
+
+// Key 是列表里返回的 key, 也可以只传 key 最后的数字
+func (c *APIV2Controller) WarningConfigDelete() {
+	key := c.Ctx.Request.Form.Get("Key")
+	tmp := strings.Split(key, "_")
+	ID, err := strconv.Atoi(tmp[len(tmp)-1])
+	if err != nil {
+		c.writeError(http.StatusBadRequest, err.Error())
+	}
+	var exist bool
+	for k := range warning.GetWarningConfigList() {
+		if k == key || strings.HasSuffix(k, "_"+strconv.Itoa(ID)) {
+			exist = true
+			break
+		}
+	}
+	if !exist {
+		c.writeError(http.StatusNotFound, "warning config "+key+" not exist")
+	}
+	if err = warning.DelWarningConfig(ID); err != nil {
+		c.writeError(http.StatusInternalServerError, err.Error())
+	}
+	c.writeSuccess(nil)
+}
+
+func (c *APIV2Controller) WarningRuleList() {
+	c.writeSuccess(warning.GetWarningRuleList())
+}
+
+func (c *APIV2Controller) WarningRuleAdd() {
+	var param warning.WarningRule
+	c.bindJSON(&param)
+	ID, err := warning.AddNewWarningRule(param)
+	if err != nil {
+		c.writeError(http.StatusBadRequest, err.Error())
+	}
+	c.writeSuccess(APIV2IdResult{Id: ID})
+}
+
+func (c *APIV2Controller) mustGetWarningRuleId() int {
+	ID := c.getParamInt("Id")
+	for _, v := range warning.GetWarningRuleList() {
+		if v.Id == ID {
+			return ID
+		}
+	}
+	c.writeError(http.StatusNotFound, fmt.Sprintf("rule id:%d not exist", ID))
+	return ID
+}
+
+func (c *APIV2Controller) WarningRuleUpdate() {
+	var param warning.WarningRule
+	c.bindJSON(&param)
+	c.mustGetWarningRuleId()
+	if err := warning.UpdateWarningRule(param); err != nil {
+		c.writeError(http.StatusBadRequest, err.Error())
+	}
+	c.writeSuccess(APIV2IdResult{Id: param.Id})
+}
+
+func (c *APIV2Controller) WarningRuleDelete() {
+	if err := warning.DelWarningRule(c.mustGetWarningRuleId()); err != nil {
+		c.writeError(http.StatusInternalServerError, err.Error())
+	}
+	c.writeSuccess(nil)
+}
+
+func (c *APIV2Controller) UserList() {
+	UserList := user.GetUserList()
+	//过滤密码,防止其他 monitor 用户查看到
+	for k := range UserList {
+		UserList[k].Password = ""
+	}
+	c.writeSuccess(UserList)
+}
+
+func (c *APIV2Controller) UserUpdate() {
+	var param UserParam
+	c.bindJSON(&param)
+	if param.UserName == "" || param.Password == "" {
+		c.writeError(http.StatusBadRequest, "UserName and Password not empty")
+	}
+	for _, Host := range strings.Split(param.Host, ",") {
+		if strings.Count(Host, ".") > 3 {
+			c.writeError(http.StatusBadRequest, "Host error")
+		}
+	}
+	if err := user.UpdateUser(param.UserName, param.Password, param.Group, param.Host, param.Roles); err != nil {
+		c.writeError(http.StatusBadRequest, err.Error())
+	}
+	userInfo := user.GetUserInfo(param.UserName)
+	userInfo.Password = ""
+	c.writeSuccess(userInfo)
+}
+
+func (c *APIV2Controller) UserDelete() {
+	UserName := c.Ctx.Request.Form.Get("UserName")
+	if user.GetUserInfo(UserName).Name == "" {
+		c.writeError(http.StatusNotFound, "user "+UserName+" not exist")
+	}
+	if UserName == c.userName {
+		c.writeError(http.StatusConflict, "can't delete current user")
+	}
+	if err := user.DelUser(UserName); err != nil {
+		c.writeError(http.StatusInternalServerError, err.Error())
+	}
+	c.writeSuccess(nil)
+}
+
+func (c *APIV2Controller) RoleList() {
+	c.writeSuccess(user.GetRoleList())
+}
+
+func (c *APIV2Controller) RoleUpdate() {
+	var param user.Role
+	c.bindJSON(&param)
+	if err := user.UpdateRole(param); err != nil {
+		c.writeError(http.StatusBadRequest, err.Error())
+	}
+	c.writeSuccess(user.GetRole(param.Name))
+}
+
+func (c *APIV2Controller) RoleDelete() {
+	Name := c.Ctx.Request.Form.Get("Name")
+	if user.GetRole(Name) == nil {
+		c.writeError(http.StatusNotFound, "role "+Name+" not exist")
+	}
+	if err := user.DelRole(Name); err != nil {
+		c.writeError(http.StatusConflict, err.Error())
+	}
+	c.writeSuccess(nil)
+}
+
+// administrator 可以看到所有用户的 token, 其他用户只能看到自己的
+func (c *APIV2Controller) TokenList() {
+	UserName := c.userName
+	if c.group == "administrator" {
+		UserName = ""
+	}
+	list := user.GetAPITokenList(UserName)
+	for k := range list {
+		list[k].TokenHash = ""
+	}
+	c.writeSuccess(list)
+}
+
+func (c *APIV2Controller) TokenAdd() {
+	var param APIV2TokenParam
+	c.bindJSON(&param)
+	token, info, err := user.CreateAPIToken(c.userName, param.Name, param.Scopes, param.ExpireTime)
+	if err != nil {
+		c.writeError(http.StatusBadRequest, err.Error())
+	}
+	info.TokenHash = ""
+	c.writeSuccess(APIV2TokenResult{Token: token, Info: *info})
+}
+
+func (c *APIV2Controller) TokenDelete() {
+	ID := c.Ctx.Request.Form.Get("Id")
+	info := user.GetAPIToken(ID)
+	if info == nil || (c.group != "administrator" && info.UserName != c.userName) {
+		c.writeError(http.StatusNotFound, "token "+ID+" not exist")
+	}
+	if err := user.DelAPIToken(ID); err != nil {
+		c.writeError(http.StatusInternalServerError, err.Error())
+	}
+	c.writeSuccess(nil)
+}
@@ -0,0 +1,261 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brokercap/Bifrost/config"
+)
+
+// 根据 apiV2RouteList 生成 openapi 3.0 文档, 请求和返回的结构体通过反射生成 components/schemas
+
+type openAPIObject = map[string]interface{}
+
+// 路由里这些参数是数字, 其他的都是字符串
+var apiV2IntParamMap = map[string]bool{
+	"ChannelId":  true,
+	"ToServerId": true,
+	"Id":         true,
+}
+
+var apiV2OpenAPIOnce sync.Once
+var apiV2OpenAPIDoc openAPIObject
+
+func (c *APIV2Controller) OpenAPI() {
+	apiV2OpenAPIOnce.Do(func() {
+		apiV2OpenAPIDoc = buildOpenAPI(apiV2RouteList)
+	})
+	c.writeSuccess(apiV2OpenAPIDoc)
+}
+
+type openAPISchemaBuilder struct {
+	schemas openAPIObject
+	names   map[reflect.Type]string
+}
+
+func newOpenAPISchemaBuilder() *openAPISchemaBuilder {
+	return &openAPISchemaBuilder{schemas: make(openAPIObject, 0), names: make(map[reflect.Type]string, 0)}
+}
+
+// 一般用 包名.类型名, 包名相同的时候往上加一级目录, 比如 driver.DriverStructure 和 input.driver.DriverStructure
+func (b *openAPISchemaBuilder) schemaName(t reflect.Type) string {
+	if name, ok := b.names[t]; ok {
+		return name
+	}
+	pkgArr := strings.Split(t.PkgPath(), "/")
+	var name string
+	for i := len(pkgArr) - 1; i >= 0; i-- {
+		name = strings.Join(pkgArr[i:], ".") + "." + t.Name()
+		if _, ok := b.schemas[name]; !ok {
+			break
+		}
+	}
+	b.names[t] = name
+	return name
+}
+
+func buildOpenAPI(routeList []*apiV2Route) openAPIObject {
+	b := newOpenAPISchemaBuilder()
+	errorRef := b.schemaOf(reflect.TypeOf(APIV2Error{}))
+	paths := make(map[string]openAPIObject, 0)
+	for _, route := range routeList {
+		if _, ok := paths[route.Path]; !ok {
+			paths[route.Path] = make(openAPIObject, 0)
+		}
+		op := openAPIObject{
+			"operationId": route.Action,
+			"summary":     route.Summary,
+		}
+		if route.Scope != "" {
+			op["tags"] = []string{route.Scope}
+		}
+		params := make([]openAPIObject, 0)
+		for _, seg := range strings.Split(route.Path, "/") {
+			if !strings.HasPrefix(seg, "{") || !strings.HasSuffix(seg, "}") {
+				continue
+			}
+			name := seg[1 : len(seg)-1]
+			schema := openAPIObject{"type": "string"}
+			if apiV2IntParamMap[name] {
+				schema = openAPIObject{"type": "integer"}
+			}
+			params = append(params, openAPIObject{"name": name, "in": "path", "required": true, "schema": schema})
+		}
+		for _, name := range route.Query {
+			params = append(params, openAPIObject{"name": name, "in": "query", "required": false, "schema": openAPIObject{"type": "string"}})
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+		if route.Request != nil {
+			op["requestBody"] = openAPIObject{
+				"required": true,
+				"content": openAPIObject{
+					"application/json": openAPIObject{"schema": b.schemaOf(reflect.TypeOf(route.Request))},
+				},
+			}
+		}
+		success := openAPIObject{"description": http.StatusText(route.Status)}
+		if route.Response != nil {
+			success["content"] = openAPIObject{
+				"application/json": openAPIObject{"schema": b.schemaOf(reflect.TypeOf(route.Response))},
+			}
+		}
+		responses := openAPIObject{
+			strconv.Itoa(route.Status): success,
+			"default": openAPIObject{
+				"description": "error",
+				"content": openAPIObject{
+					"application/json": openAPIObject{"schema": errorRef},
+				},
+			},
+		}
+		op["responses"] = responses
+		switch route.Scope {
+		case "":
+			op["security"] = []openAPIObject{}
+		case apiV2ScopeTokens:
+			op["security"] = []openAPIObject{{"basicAuth": []string{}}}
+		}
+		paths[route.Path][strings.ToLower(route.Method)] = op
+	}
+	return openAPIObject{
+		"openapi": "3.0.3",
+		"info": openAPIObject{
+			"title":       "Bifrost API",
+			"version":     config.VERSION,
+			"description": "token scope is resource:read or resource:write, resource is one of dbs, channels, tables, toservers, history, plugins, warnings, users, filequeues or *",
+		},
+		"paths": paths,
+		"components": openAPIObject{
+			"schemas": b.schemas,
+			"securitySchemes": openAPIObject{
+				"bearerAuth": openAPIObject{"type": "http", "scheme": "bearer"},
+				"basicAuth":  openAPIObject{"type": "http", "scheme": "basic"},
+			},
+		},
+		"security": []openAPIObject{
+			{"bearerAuth": []string{}},
+			{"basicAuth": []string{}},
+		},
+	}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+var rawMessageType = reflect.TypeOf(json.RawMessage{})
+
+// 不能用 json 输出的类型返回 nil
+func (b *openAPISchemaBuilder) schemaOf(t reflect.Type) openAPIObject {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t {
+	case timeType:
+		return openAPIObject{"type": "string", "format": "date-time"}
+	case rawMessageType:
+		return openAPIObject{}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return openAPIObject{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Uint, reflect.Uint8, reflect.Uint16:
+		return openAPIObject{"type": "integer"}
+	case reflect.Int32, reflect.Uint32:
+		return openAPIObject{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return openAPIObject{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return openAPIObject{"type": "number"}
+	case reflect.String:
+		return openAPIObject{"type": "string"}
+	case reflect.Interface:
+		return openAPIObject{}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return openAPIObject{"type": "string", "format": "byte"}
+		}
+		items := b.schemaOf(t.Elem())
+		if items == nil {
+			return nil
+		}
+		return openAPIObject{"type": "array", "items": items}
+	case reflect.Map:
+		items := b.schemaOf(t.Elem())
+		if items == nil {
+			return nil
+		}
+		return openAPIObject{"type": "object", "additionalProperties": items}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		_, exist := b.names[t]
+		name := b.schemaName(t)
+		if !exist {
+			// 先占位, 结构体里引用自己的时候不会死循环
+			b.schemas[name] = openAPIObject{}
+			b.schemas[name] = b.structSchema(t)
+		}
+		return openAPIObject{"$ref": "#/components/schemas/" + name}
+	default:
+		return nil
+	}
+}
+
+func (b *openAPISchemaBuilder) structSchema(t reflect.Type) openAPIObject {
+	properties := make(openAPIObject, 0)
+	b.addProperties(t, properties)
+	return openAPIObject{"type": "object", "properties": properties}
+}
+
+// 和 encoding/json 一样, 跳过未导出的字段, 匿名结构体的字段展开
+func (b *openAPISchemaBuilder) addProperties(t reflect.Type, properties openAPIObject) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				b.addProperties(ft, properties)
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if schema := b.schemaOf(f.Type); schema != nil {
+			properties[name] = schema
+		}
+	}
+}
@@ -0,0 +1,413 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	inputDriver "github.com/brokercap/Bifrost/input/driver"
+	"github.com/brokercap/Bifrost/plugin"
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	pluginStorage "github.com/brokercap/Bifrost/plugin/storage"
+	"github.com/brokercap/Bifrost/server"
+)
+
+// /api/v2 数据源, 通道, 表, 同步配置, 目标库, 插件
+
+func (c *APIV2Controller) getDbName() string {
+	return c.Ctx.Request.Form.Get("DbName")
+}
+
+// 数据源不存在直接返回 404
+func (c *APIV2Controller) mustGetDbInfo(DbName string) *server.DbListStruct {
+	if server.GetDB(DbName) == nil {
+		c.writeError(http.StatusNotFound, DbName+" not exsit")
+	}
+	return server.GetDbInfo(DbName)
+}
+
+func (c *APIV2Controller) DbList() {
+	c.writeSuccess(c.filterDbList(server.GetListDb()))
+}
+
+func (c *APIV2Controller) DbAdd() {
+	var param DbUpdateParam
+	c.bindJSON(&param)
+	if param.InputType == "" {
+		param.InputType = "mysql"
+	}
+	if err := checkDbUpdateParam(&param); err != nil {
+		c.writeError(http.StatusBadRequest, err.Error())
+	}
+	if server.GetDB(param.DbName) != nil {
+		c.writeError(http.StatusConflict, param.DbName+" is exsit")
+	}
+	defer server.SaveDBConfigInfo()
+	if server.AddNewDB(param.DbName, param.InputType, getDbInputInfo(&param), time.Now().Unix()) == nil {
+		c.writeError(http.StatusConflict, param.DbName+" is exsit")
+	}
+	channel, _ := server.GetDBObj(param.DbName).AddChannel("default", 1)
+	if channel != nil {
+		channel.Start()
+	}
+	c.writeSuccess(server.GetDbInfo(param.DbName))
+}
+
+func (c *APIV2Controller) DbGet() {
+	c.writeSuccess(c.mustGetDbInfo(c.getDbName()))
+}
+
+func (c *APIV2Controller) DbUpdate() {
+	var param DbUpdateParam
+	c.bindJSON(&param)
+	c.mustGetDbInfo(param.DbName)
+	if param.InputType == "" {
+		param.InputType = "mysql"
+	}
+	if err := checkDbUpdateParam(&param); err != nil {
+		c.writeError(http.StatusBadRequest, err.Error())
+	}
+	err := server.UpdateDB(param.DbName, param.InputType, getDbInputInfo(&param), time.Now().Unix(), param.UpdateToServer)
+	if err != nil {
+		c.writeError(http.StatusConflict, err.Error())
+	}
+	server.SaveDBConfigInfo()
+	c.writeSuccess(server.GetDbInfo(param.DbName))
+}
+
+func (c *APIV2Controller) DbDelete() {
+	DbName := c.getDbName()
+	c.mustGetDbInfo(DbName)
+	if !server.DelDB(DbName) {
+		c.writeError(http.StatusConflict, "db status must be close")
+	}
+	server.SaveDBConfigInfo()
+	c.writeSuccess(nil)
+}
+
+func (c *APIV2Controller) DbStart() {
+	DbName := c.getDbName()
+	c.mustGetDbInfo(DbName)
+	defer server.SaveDBConfigInfo()
+	if err := server.GetDB(DbName).Start(); err != nil {
+		c.writeError(http.StatusConflict, err.Error())
+	}
+	c.writeSuccess(server.GetDbInfo(DbName))
+}
+
+func (c *APIV2Controller) DbStop() {
+	DbName := c.getDbName()
+	// 没有启动过的数据源不能 stop
+	if c.mustGetDbInfo(DbName).ConnStatus == server.CLOSED {
+		c.writeError(http.StatusConflict, "db status is closed")
+	}
+	defer server.SaveDBConfigInfo()
+	server.GetDB(DbName).Stop()
+	c.writeSuccess(server.GetDbInfo(DbName))
+}
+
+func (c *APIV2Controller) DbClose() {
+	DbName := c.getDbName()
+	c.mustGetDbInfo(DbName)
+	defer server.SaveDBConfigInfo()
+	server.GetDB(DbName).Close()
+	c.writeSuccess(server.GetDbInfo(DbName))
+}
+
+func (c *APIV2Controller) ChannelList() {
+	DbName := c.getDbName()
+	c.mustGetDbInfo(DbName)
+	c.writeSuccess(server.GetDBObj(DbName).ListChannel())
+}
+
+func (c *APIV2Controller) ChannelAdd() {
+	var param ChannelParam
+	c.bindJSON(&param)
+	c.mustGetDbInfo(param.DbName)
+	if param.ChannelName == "" || param.CosumerCount <= 0 {
+		c.writeError(http.StatusBadRequest, "ChannelName and CosumerCount not be empty")
+	}
+	defer server.SaveDBConfigInfo()
+	_, ChannelID := server.GetDBObj(param.DbName).AddChannel(param.ChannelName, param.CosumerCount)
+	c.writeSuccess(APIV2IdResult{Id: ChannelID})
+}
+
+func (c *APIV2Controller) mustGetChannel() *server.Channel {
+	DbName := c.getDbName()
+	ChannelId := c.getParamInt("ChannelId")
+	ch := server.GetChannel(DbName, ChannelId)
+	if ch == nil {
+		c.writeError(http.StatusNotFound, DbName+" channelId:"+fmt.Sprint(ChannelId)+" not exsit")
+	}
+	return ch
+}
+
+func (c *APIV2Controller) ChannelDelete() {
+	c.mustGetChannel()
+	DbName := c.getDbName()
+	ChannelId := c.getParamInt("ChannelId")
+	if n := len(server.GetDBObj(DbName).GetTableByChannelKey(DbName, ChannelId)); n > 0 {
+		c.writeError(http.StatusConflict, "The channel bind table count:"+fmt.Sprint(n))
+	}
+	if !server.DelChannel(DbName, ChannelId) {
+		c.writeError(http.StatusNotFound, "channel or db not exsit")
+	}
+	server.SaveDBConfigInfo()
+	c.writeSuccess(nil)
+}
+
+func (c *APIV2Controller) ChannelStart() {
+	ch := c.mustGetChannel()
+	ch.Start()
+	server.SaveDBConfigInfo()
+	c.writeSuccess(ch)
+}
+
+func (c *APIV2Controller) ChannelStop() {
+	ch := c.mustGetChannel()
+	ch.Stop()
+	server.SaveDBConfigInfo()
+	c.writeSuccess(ch)
+}
+
+func (c *APIV2Controller) ChannelClose() {
+	ch := c.mustGetChannel()
+	ch.Close()
+	server.SaveDBConfigInfo()
+	c.writeSuccess(ch)
+}
+
+func (c *APIV2Controller) TableList() {
+	DbName := c.getDbName()
+	c.mustGetDbInfo(DbName)
+	c.writeSuccess(server.GetDBObj(DbName).GetTables())
+}
+
+// 库名和表名, AllDataBases 和 AllTables 转成 *
+func (c *APIV2Controller) getSchemaAndTableName() (string, string) {
+	return tansferSchemaName(c.Ctx.Request.Form.Get("SchemaName")), tansferTableName(c.Ctx.Request.Form.Get("TableName"))
+}
+
+func (c *APIV2Controller) mustGetTable() *server.Table {
+	DbName := c.getDbName()
+	c.mustGetDbInfo(DbName)
+	SchemaName, TableName := c.getSchemaAndTableName()
+	t := server.GetDBObj(DbName).GetTable(SchemaName, TableName)
+	if t == nil {
+		c.writeError(http.StatusNotFound, server.GetSchemaAndTableJoin(SchemaName, TableName)+" not exsit")
+	}
+	return t
+}
+
+func (c *APIV2Controller) TableAdd() {
+	var param TableParam
+	c.bindJSON(&param)
+	c.mustGetDbInfo(param.DbName)
+	if param.SchemaName == "" || param.TableName == "" {
+		c.writeError(http.StatusBadRequest, "SchemaName and TableName not be empty")
+	}
+	SchemaName := tansferSchemaName(param.SchemaName)
+	TableName := tansferTableName(param.TableName)
+	if err := server.AddTable(param.DbName, SchemaName, TableName, param.IgnoreTable, param.DoTable, param.ChannelId); err != nil {
+		c.writeError(http.StatusBadRequest, err.Error())
+	}
+	server.SaveDBConfigInfo()
+	c.writeSuccess(server.GetDBObj(param.DbName).GetTable(SchemaName, TableName))
+}
+
+func (c *APIV2Controller) TableUpdate() {
+	var param TableParam
+	c.bindJSON(&param)
+	c.mustGetTable()
+	SchemaName, TableName := c.getSchemaAndTableName()
+	if err := server.UpdateTable(param.DbName, SchemaName, TableName, param.IgnoreTable, param.DoTable); err != nil {
+		c.writeError(http.StatusBadRequest, err.Error())
+	}
+	server.SaveDBConfigInfo()
+	c.writeSuccess(server.GetDBObj(param.DbName).GetTable(SchemaName, TableName))
+}
+
+func (c *APIV2Controller) TableDelete() {
+	c.mustGetTable()
+	SchemaName, TableName := c.getSchemaAndTableName()
+	if err := server.DelTable(c.getDbName(), SchemaName, TableName); err != nil {
+		c.writeError(http.StatusBadRequest, err.Error())
+	}
+	server.SaveDBConfigInfo()
+	c.writeSuccess(nil)
+}
+
+func (c *APIV2Controller) TableToServerList() {
+	c.writeSuccess(c.mustGetTable().ToServerList)
+}
+
+func (c *APIV2Controller) TableToServerAdd() {
+	var param TableToServerParam
+	c.bindJSON(&param)
+	c.mustGetDbInfo(param.DbName)
+	ToServerId, HistoryId, err := addTableToServer(&param)
+	if err != nil {
+		// 同步配置已经添加, 但是全量任务启动失败
+		if ToServerId > 0 {
+			c.writeError(http.StatusInternalServerError, err.Error())
+		}
+		c.writeError(http.StatusBadRequest, err.Error())
+	}
+	c.writeSuccess(APIV2TableToServerResult{ToServerId: ToServerId, HistoryId: HistoryId})
+}
+
+func (c *APIV2Controller) mustGetTableToServer() *server.ToServer {
+	t := c.mustGetTable()
+	ToServerId := c.getParamInt("ToServerId")
+	t.RLock()
+	var toServer *server.ToServer
+	for _, v := range t.ToServerList {
+		if v.ToServerID == ToServerId {
+			toServer = v
+			break
+		}
+	}
+	t.RUnlock()
+	if toServer == nil {
+		c.writeError(http.StatusNotFound, "ToServerId:"+fmt.Sprint(ToServerId)+" not exsit")
+	}
+	return toServer
+}
+
+func (c *APIV2Controller) TableToServerDelete() {
+	toServer := c.mustGetTableToServer()
+	SchemaName, TableName := c.getSchemaAndTableName()
+	server.GetDBObj(c.getDbName()).DelTableToServer(SchemaName, TableName, toServer.ToServerID)
+	server.SaveDBConfigInfo()
+	c.writeSuccess(nil)
+}
+
+func (c *APIV2Controller) TableToServerStart() {
+	toServer := c.mustGetTableToServer()
+	toServer.Start()
+	server.SaveDBConfigInfo()
+	c.writeSuccess(toServer)
+}
+
+func (c *APIV2Controller) TableToServerStop() {
+	toServer := c.mustGetTableToServer()
+	toServer.Stop()
+	server.SaveDBConfigInfo()
+	c.writeSuccess(toServer)
+}
+
+func (c *APIV2Controller) FileQueueGet() {
+	toServer := c.mustGetTableToServer()
+	info, err := toServer.GetFileQueueInfo()
+	if err != nil {
+		c.writeError(http.StatusInternalServerError, err.Error())
+	}
+	c.writeSuccess(&info)
+}
+
+func (c *APIV2Controller) FileQueueStart() {
+	toServer := c.mustGetTableToServer()
+	if err := toServer.FileQueueStart(); err != nil {
+		c.writeError(http.StatusConflict, err.Error())
+	}
+	server.SaveDBConfigInfo()
+	info, err := toServer.GetFileQueueInfo()
+	if err != nil {
+		c.writeError(http.StatusInternalServerError, err.Error())
+	}
+	c.writeSuccess(&info)
+}
+
+func (c *APIV2Controller) ToServerList() {
+	c.writeSuccess(pluginStorage.GetToServerMap())
+}
+
+func (c *APIV2Controller) getToServerParam() *ToServerParam {
+	var param ToServerParam
+	c.bindJSON(&param)
+	if param.ToServerKey == "" || param.PluginName == "" || param.ConnUri == "" {
+		c.writeError(http.StatusBadRequest, "toserverkey,PluginName,connuri muest be not empty")
+	}
+	if _, ok := pluginDriver.Drivers()[param.PluginName]; !ok {
+		c.writeError(http.StatusBadRequest, "plugin "+param.PluginName+" not exsit")
+	}
+	return &param
+}
+
+func (c *APIV2Controller) ToServerAdd() {
+	param := c.getToServerParam()
+	if pluginStorage.GetToServerInfo(param.ToServerKey) != nil {
+		c.writeError(http.StatusConflict, param.ToServerKey+" is exsit")
+	}
+	pluginStorage.SetToServerInfo(
+		param.ToServerKey,
+		pluginStorage.ToServer{
+			PluginName: param.PluginName,
+			ConnUri:    param.ConnUri,
+			Notes:      param.Notes,
+			MaxConn:    param.MaxConn,
+			MinConn:    param.MinConn,
+		})
+	server.SaveDBConfigInfo()
+	c.writeSuccess(pluginStorage.GetToServerInfo(param.ToServerKey))
+}
+
+func (c *APIV2Controller) ToServerUpdate() {
+	param := c.getToServerParam()
+	if pluginStorage.GetToServerInfo(param.ToServerKey) == nil {
+		c.writeError(http.StatusNotFound, param.ToServerKey+" not exsit")
+	}
+	err := pluginStorage.UpdateToServerInfo(
+		param.ToServerKey,
+		pluginStorage.ToServer{
+			PluginName: param.PluginName,
+			ConnUri:    param.ConnUri,
+			Notes:      param.Notes,
+			MaxConn:    param.MaxConn,
+			MinConn:    param.MinConn,
+		})
+	if err != nil {
+		c.writeError(http.StatusBadRequest, err.Error())
+	}
+	server.SaveDBConfigInfo()
+	c.writeSuccess(pluginStorage.GetToServerInfo(param.ToServerKey))
+}
+
+func (c *APIV2Controller) ToServerDelete() {
+	ToServerKey := c.Ctx.Request.Form.Get("ToServerKey")
+	if pluginStorage.GetToServerInfo(ToServerKey) == nil {
+		c.writeError(http.StatusNotFound, ToServerKey+" not exsit")
+	}
+	pluginStorage.DelToServerInfo(ToServerKey)
+	server.SaveDBConfigInfo()
+	c.writeSuccess(nil)
+}
+
+func (c *APIV2Controller) PluginList() {
+	driversMap := pluginDriver.Drivers()
+	// 加载异常的插件也返回, Error 不为空
+	for name, v := range plugin.GetErrorPluginList() {
+		driversMap[name] = v
+	}
+	c.writeSuccess(driversMap)
+}
+
+func (c *APIV2Controller) InputPluginList() {
+	c.writeSuccess(inputDriver.Drivers())
+}
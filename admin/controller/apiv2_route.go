@@ -0,0 +1,137 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"net/http"
+
+	inputDriver "github.com/brokercap/Bifrost/input/driver"
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	pluginStorage "github.com/brokercap/Bifrost/plugin/storage"
+	"github.com/brokercap/Bifrost/server"
+	"github.com/brokercap/Bifrost/server/filequeue"
+	"github.com/brokercap/Bifrost/server/history"
+	"github.com/brokercap/Bifrost/server/user"
+	"github.com/brokercap/Bifrost/server/warning"
+)
+
+const apiV2TablePath = "/api/v2/dbs/{DbName}/tables/{SchemaName}/{TableName}"
+
+// 所有 /api/v2 的路由, 同时用来生成 openapi 文档
+var apiV2RouteList = []*apiV2Route{
+	{Method: "GET", Path: "/api/v2/openapi.json", Action: "OpenAPI", Summary: "openapi document"},
+
+	// dbs
+	{Method: "GET", Path: "/api/v2/dbs", Action: "DbList", Scope: "dbs", Summary: "list dbs", Response: map[string]server.DbListStruct{}},
+	{Method: "POST", Path: "/api/v2/dbs", Action: "DbAdd", Scope: "dbs", Summary: "add db, a default channel is added and started", Status: http.StatusCreated, Request: DbUpdateParam{}, Response: server.DbListStruct{}},
+	{Method: "GET", Path: "/api/v2/dbs/{DbName}", Action: "DbGet", Scope: "dbs", Summary: "get db", Response: server.DbListStruct{}},
+	{Method: "PUT", Path: "/api/v2/dbs/{DbName}", Action: "DbUpdate", Scope: "dbs", Summary: "update db, db must be closed", Request: DbUpdateParam{}, Response: server.DbListStruct{}},
+	{Method: "DELETE", Path: "/api/v2/dbs/{DbName}", Action: "DbDelete", Scope: "dbs", Summary: "delete db, db must be closed", Status: http.StatusNoContent},
+	{Method: "POST", Path: "/api/v2/dbs/{DbName}/start", Action: "DbStart", Scope: "dbs", Summary: "start db", Response: server.DbListStruct{}},
+	{Method: "POST", Path: "/api/v2/dbs/{DbName}/stop", Action: "DbStop", Scope: "dbs", Summary: "stop db", Response: server.DbListStruct{}},
+	{Method: "POST", Path: "/api/v2/dbs/{DbName}/close", Action: "DbClose", Scope: "dbs", Summary: "close db", Response: server.DbListStruct{}},
+
+	// channels
+	{Method: "GET", Path: "/api/v2/dbs/{DbName}/channels", Action: "ChannelList", Scope: "channels", Summary: "list channels", Response: map[int]*server.Channel{}},
+	{Method: "POST", Path: "/api/v2/dbs/{DbName}/channels", Action: "ChannelAdd", Scope: "channels", Summary: "add channel", Status: http.StatusCreated, Request: ChannelParam{}, Response: APIV2IdResult{}},
+	{Method: "DELETE", Path: "/api/v2/dbs/{DbName}/channels/{ChannelId}", Action: "ChannelDelete", Scope: "channels", Summary: "delete channel, channel must not be bound to tables", Status: http.StatusNoContent},
+	{Method: "POST", Path: "/api/v2/dbs/{DbName}/channels/{ChannelId}/start", Action: "ChannelStart", Scope: "channels", Summary: "start channel", Response: server.Channel{}},
+	{Method: "POST", Path: "/api/v2/dbs/{DbName}/channels/{ChannelId}/stop", Action: "ChannelStop", Scope: "channels", Summary: "stop channel", Response: server.Channel{}},
+	{Method: "POST", Path: "/api/v2/dbs/{DbName}/channels/{ChannelId}/close", Action: "ChannelClose", Scope: "channels", Summary: "close channel", Response: server.Channel{}},
+
+	// tables
+	{Method: "GET", Path: "/api/v2/dbs/{DbName}/tables", Action: "TableList", Scope: "tables", Summary: "list tables", Response: map[string]*server.Table{}},
+	{Method: "POST", Path: "/api/v2/dbs/{DbName}/tables", Action: "TableAdd", Scope: "tables", Summary: "add table", Status: http.StatusCreated, Request: TableParam{}, Response: server.Table{}},
+	{Method: "PUT", Path: apiV2TablePath, Action: "TableUpdate", Scope: "tables", Summary: "update table IgnoreTable and DoTable", Request: TableParam{}, Response: server.Table{}},
+	{Method: "DELETE", Path: apiV2TablePath, Action: "TableDelete", Scope: "tables", Summary: "delete table", Status: http.StatusNoContent},
+	{Method: "GET", Path: apiV2TablePath + "/toservers", Action: "TableToServerList", Scope: "tables", Summary: "list table toservers", Response: []*server.ToServer{}},
+	{Method: "POST", Path: apiV2TablePath + "/toservers", Action: "TableToServerAdd", Scope: "tables", Summary: "add table toserver", Status: http.StatusCreated, Request: TableToServerParam{}, Response: APIV2TableToServerResult{}},
+	{Method: "DELETE", Path: apiV2TablePath + "/toservers/{ToServerId}", Action: "TableToServerDelete", Scope: "tables", Summary: "delete table toserver", Status: http.StatusNoContent},
+	{Method: "POST", Path: apiV2TablePath + "/toservers/{ToServerId}/start", Action: "TableToServerStart", Scope: "tables", Summary: "start table toserver", Response: server.ToServer{}},
+	{Method: "POST", Path: apiV2TablePath + "/toservers/{ToServerId}/stop", Action: "TableToServerStop", Scope: "tables", Summary: "stop table toserver", Response: server.ToServer{}},
+
+	// filequeues
+	{Method: "GET", Path: apiV2TablePath + "/toservers/{ToServerId}/filequeue", Action: "FileQueueGet", Scope: "filequeues", Summary: "get table toserver file queue info", Response: filequeue.QueueInfo{}},
+	{Method: "POST", Path: apiV2TablePath + "/toservers/{ToServerId}/filequeue", Action: "FileQueueStart", Scope: "filequeues", Summary: "start table toserver file queue", Response: filequeue.QueueInfo{}},
+
+	// toservers
+	{Method: "GET", Path: "/api/v2/toservers", Action: "ToServerList", Scope: "toservers", Summary: "list toservers", Response: map[string]*pluginStorage.ToServer{}},
+	{Method: "POST", Path: "/api/v2/toservers", Action: "ToServerAdd", Scope: "toservers", Summary: "add toserver", Status: http.StatusCreated, Request: ToServerParam{}, Response: pluginStorage.ToServer{}},
+	{Method: "PUT", Path: "/api/v2/toservers/{ToServerKey}", Action: "ToServerUpdate", Scope: "toservers", Summary: "update toserver", Request: ToServerParam{}, Response: pluginStorage.ToServer{}},
+	{Method: "DELETE", Path: "/api/v2/toservers/{ToServerKey}", Action: "ToServerDelete", Scope: "toservers", Summary: "delete toserver", Status: http.StatusNoContent},
+
+	// plugins
+	{Method: "GET", Path: "/api/v2/plugins", Action: "PluginList", Scope: "plugins", Summary: "list output plugins", Response: map[string]pluginDriver.DriverStructure{}},
+	{Method: "GET", Path: "/api/v2/plugins/input", Action: "InputPluginList", Scope: "plugins", Summary: "list input plugins", Response: map[string]inputDriver.DriverStructure{}},
+
+	// history
+	{Method: "GET", Path: "/api/v2/dbs/{DbName}/history", Action: "HistoryList", Scope: "history", Summary: "list history tasks", Query: []string{"SchemaName", "TableName", "Status"}, Response: []history.History{}},
+	{Method: "POST", Path: "/api/v2/dbs/{DbName}/history", Action: "HistoryAdd", Scope: "history", Summary: "add history task", Status: http.StatusCreated, Request: HistoryParam{}, Response: APIV2IdResult{}},
+	{Method: "DELETE", Path: "/api/v2/dbs/{DbName}/history/{Id}", Action: "HistoryDelete", Scope: "history", Summary: "delete history task", Status: http.StatusNoContent},
+	{Method: "POST", Path: "/api/v2/dbs/{DbName}/history/{Id}/start", Action: "HistoryStart", Scope: "history", Summary: "start history task", Response: APIV2IdResult{}},
+	{Method: "POST", Path: "/api/v2/dbs/{DbName}/history/{Id}/stop", Action: "HistoryStop", Scope: "history", Summary: "stop history task", Response: APIV2IdResult{}},
+	{Method: "POST", Path: "/api/v2/dbs/{DbName}/history/{Id}/kill", Action: "HistoryKill", Scope: "history", Summary: "kill history task", Response: APIV2IdResult{}},
+	{Method: "POST", Path: "/api/v2/dbs/{DbName}/history/{Id}/resume", Action: "HistoryResume", Scope: "history", Summary: "resume history task from checkpoint", Response: APIV2IdResult{}},
+
+	// warnings
+	{Method: "GET", Path: "/api/v2/warnings/configs", Action: "WarningConfigList", Scope: "warnings", Summary: "list warning configs", Response: map[string]warning.WaringConfig{}},
+	{Method: "POST", Path: "/api/v2/warnings/configs", Action: "WarningConfigAdd", Scope: "warnings", Summary: "add warning config", Status: http.StatusCreated, Request: WarningParam{}, Response: APIV2KeyResult{}},
+	{Method: "DELETE", Path: "/api/v2/warnings/configs/{Key}", Action: "WarningConfigDelete", Scope: "warnings", Summary: "delete warning config", Status: http.StatusNoContent},
+	{Method: "GET", Path: "/api/v2/warnings/rules", Action: "WarningRuleList", Scope: "warnings", Summary: "list warning rules", Response: []warning.WarningRule{}},
+	{Method: "POST", Path: "/api/v2/warnings/rules", Action: "WarningRuleAdd", Scope: "warnings", Summary: "add warning rule", Status: http.StatusCreated, Request: warning.WarningRule{}, Response: APIV2IdResult{}},
+	{Method: "PUT", Path: "/api/v2/warnings/rules/{Id}", Action: "WarningRuleUpdate", Scope: "warnings", Summary: "update warning rule", Request: warning.WarningRule{}, Response: APIV2IdResult{}},
+	{Method: "DELETE", Path: "/api/v2/warnings/rules/{Id}", Action: "WarningRuleDelete", Scope: "warnings", Summary: "delete warning rule", Status: http.StatusNoContent},
+
+	// users
+	{Method: "GET", Path: "/api/v2/users", Action: "UserList", Scope: "users", Summary: "list users, password is not returned", Response: []user.UserInfo{}},
+	{Method: "PUT", Path: "/api/v2/users/{UserName}", Action: "UserUpdate", Scope: "users", Summary: "add or update user", Request: UserParam{}, Response: user.UserInfo{}},
+	{Method: "DELETE", Path: "/api/v2/users/{UserName}", Action: "UserDelete", Scope: "users", Summary: "delete user and the user's tokens", Status: http.StatusNoContent},
+
+	// roles
+	{Method: "GET", Path: "/api/v2/roles", Action: "RoleList", Scope: "users", Summary: "list roles", Response: []user.Role{}},
+	{Method: "PUT", Path: "/api/v2/roles/{Name}", Action: "RoleUpdate", Scope: "users", Summary: "add or update role, action is one of view, operate, config, delete, history", Request: user.Role{}, Response: user.Role{}},
+	{Method: "DELETE", Path: "/api/v2/roles/{Name}", Action: "RoleDelete", Scope: "users", Summary: "delete role, role used by users can't be deleted", Status: http.StatusNoContent},
+
+	// tokens, 只能用 session 或者 Basic 认证
+	{Method: "GET", Path: "/api/v2/tokens", Action: "TokenList", Scope: apiV2ScopeTokens, Summary: "list api tokens, administrator can see all users' tokens", Response: []user.APIToken{}},
+	{Method: "POST", Path: "/api/v2/tokens", Action: "TokenAdd", Scope: apiV2ScopeTokens, Summary: "create api token for current user, the token is only returned once", Status: http.StatusCreated, Request: APIV2TokenParam{}, Response: APIV2TokenResult{}},
+	{Method: "DELETE", Path: "/api/v2/tokens/{Id}", Action: "TokenDelete", Scope: apiV2ScopeTokens, Summary: "revoke api token", Status: http.StatusNoContent},
+}
+
+type APIV2IdResult struct {
+	Id int
+}
+
+type APIV2KeyResult struct {
+	Key string
+}
+
+type APIV2TableToServerResult struct {
+	ToServerId int
+	HistoryId  int // 开启 Snapshot 的时候, 全量任务的 id
+}
+
+type APIV2TokenParam struct {
+	Name       string
+	Scopes     []string // 比如 dbs:read, *:write
+	ExpireTime int64    // 过期时间戳, 0 为不过期
+}
+
+type APIV2TokenResult struct {
+	Token string // 只返回这一次
+	Info  user.APIToken
+}
@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAPIV2RouteList(t *testing.T) {
+	Convey("every route has action and scope", t, func() {
+		ctrl := reflect.TypeOf(&APIV2Controller{})
+		actionMap := make(map[string]bool, 0)
+		for _, route := range GetAPIV2RouteList() {
+			_, ok := ctrl.MethodByName(route.Action)
+			So(ok, ShouldBeTrue)
+			So(actionMap[route.Action], ShouldBeFalse)
+			actionMap[route.Action] = true
+			So(strings.HasPrefix(route.Path, "/api/v2/"), ShouldBeTrue)
+			So(route.Status, ShouldBeGreaterThan, 0)
+		}
+	})
+}
+
+func TestAPIV2OpenAPI(t *testing.T) {
+	Convey("openapi document", t, func() {
+		b, err := json.Marshal(buildOpenAPI(apiV2RouteList))
+		So(err, ShouldBeNil)
+		var doc struct {
+			OpenAPI    string                                       `json:"openapi"`
+			Paths      map[string]map[string]map[string]interface{} `json:"paths"`
+			Components struct {
+				Schemas map[string]interface{} `json:"schemas"`
+			} `json:"components"`
+		}
+		So(json.Unmarshal(b, &doc), ShouldBeNil)
+		So(doc.OpenAPI, ShouldEqual, "3.0.3")
+		for _, route := range apiV2RouteList {
+			op, ok := doc.Paths[route.Path][strings.ToLower(route.Method)]
+			So(ok, ShouldBeTrue)
+			So(op["operationId"], ShouldEqual, route.Action)
+		}
+		// 所有的 $ref 都能找到
+		for _, m := range regexp.MustCompile(`"#/components/schemas/([^"]+)"`).FindAllStringSubmatch(string(b), -1) {
+			_, ok := doc.Components.Schemas[m[1]]
+			So(ok, ShouldBeTrue)
+		}
+		So(doc.Components.Schemas, ShouldContainKey, "controller.DbUpdateParam")
+		So(doc.Components.Schemas, ShouldContainKey, "controller.APIV2Error")
+		// 包名相同的类型不能覆盖
+		So(doc.Components.Schemas, ShouldContainKey, "driver.DriverStructure")
+		So(doc.Components.Schemas, ShouldContainKey, "input.driver.DriverStructure")
+	})
+
+	Convey("json tag and unexported field", t, func() {
+		type testStruct struct {
+			Name   string `json:"name"`
+			Skip   string `json:"-"`
+			hidden string
+			Ch     chan int
+			List   []*testStruct
+		}
+		builder := newOpenAPISchemaBuilder()
+		builder.schemaOf(reflect.TypeOf(testStruct{}))
+		properties := builder.schemas["controller.testStruct"].(openAPIObject)["properties"].(openAPIObject)
+		So(properties, ShouldContainKey, "name")
+		So(properties, ShouldContainKey, "List")
+		So(len(properties), ShouldEqual, 2)
+	})
+}
+
+func TestSetParamFields(t *testing.T) {
+	Convey("path params override body", t, func() {
+		param := &TableToServerParam{DbName: "body", ToServerId: 1}
+		err := setParamFields(param, map[string]string{"DbName": "mysqlTest", "SchemaName": "123", "ToServerId": "5", "NotExist": "x"})
+		So(err, ShouldBeNil)
+		So(param.DbName, ShouldEqual, "mysqlTest")
+		So(param.SchemaName, ShouldEqual, "123")
+		So(param.ToServerId, ShouldEqual, 5)
+
+		So(setParamFields(param, map[string]string{"ToServerId": "a"}), ShouldNotBeNil)
+	})
+}
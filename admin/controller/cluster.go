@@ -0,0 +1,197 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brokercap/Bifrost/config"
+	"github.com/brokercap/Bifrost/server/cluster"
+	"github.com/brokercap/Bifrost/server/user"
+)
+
+// shard 模式下, 任意一个节点的管理后台都可以操作整个集群
+// 数据源不在当前节点上的请求转发到数据源所在的节点, 没有数据源的写操作转发到 coordinator
+// 转发的请求带上用户名和 cluster_secret 的签名, 接收的节点不再校验密码和 session
+// 签名包含请求的方法, 路径, 参数, body 的 sha256 和 nonce, 同一个 nonce 在签名有效期内只能用一次
+
+const (
+	CLUSTER_USER_HEADER  = "Bifrost-Cluster-User"
+	CLUSTER_TIME_HEADER  = "Bifrost-Cluster-Time"
+	CLUSTER_SIGN_HEADER  = "Bifrost-Cluster-Sign"
+	CLUSTER_NONCE_HEADER = "Bifrost-Cluster-Nonce"
+)
+
+var clusterTransport *http.Transport
+var clusterTransportErr error
+var clusterTransportOnce sync.Once
+
+// 节点之间用 https 的时候校验证书, 自签名的证书配置 cluster_tls_ca 为签发证书的 CA 文件
+func getClusterTransport() (*http.Transport, error) {
+	clusterTransportOnce.Do(func() {
+		tlsConfig := &tls.Config{}
+		if caFile := config.GetConfigVal("Bifrostd", "cluster_tls_ca"); caFile != "" {
+			pem, err := ioutil.ReadFile(caFile)
+			if err != nil {
+				clusterTransportErr = fmt.Errorf("cluster_tls_ca err:%s", err)
+				return
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				clusterTransportErr = fmt.Errorf("cluster_tls_ca:%s no certificate", caFile)
+				return
+			}
+			tlsConfig.RootCAs = pool
+		}
+		clusterTransport = &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			TLSClientConfig:     tlsConfig,
+			MaxIdleConnsPerHost: 10,
+			IdleConnTimeout:     90 * time.Second,
+		}
+	})
+	return clusterTransport, clusterTransportErr
+}
+
+// 表单已经被 ParseForm 读取过, 用 PostForm 重新编码, 和转发的时候写回的 body 一致
+// 其他的 body 读出来之后再写回去
+func clusterBodyHash(req *http.Request) string {
+	var body []byte
+	if req.PostForm != nil && strings.Contains(req.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		body = []byte(req.PostForm.Encode())
+	} else if req.Body != nil {
+		body, _ = ioutil.ReadAll(req.Body)
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	h := sha256.Sum256(body)
+	return hex.EncodeToString(h[:])
+}
+
+func clusterSignContent(req *http.Request) cluster.ClusterSignContent {
+	return cluster.ClusterSignContent{
+		UserName:  req.Header.Get(CLUSTER_USER_HEADER),
+		Method:    req.Method,
+		Path:      req.URL.Path,
+		Query:     req.URL.RawQuery,
+		BodyHash:  clusterBodyHash(req),
+		Nonce:     req.Header.Get(CLUSTER_NONCE_HEADER),
+		Timestamp: req.Header.Get(CLUSTER_TIME_HEADER),
+	}
+}
+
+// 校验转发请求的签名, 返回转发的用户名
+func checkClusterRequest(req *http.Request) (string, error) {
+	content := clusterSignContent(req)
+	return content.UserName, cluster.CheckClusterSign(content, req.Header.Get(CLUSTER_SIGN_HEADER))
+}
+
+func (c *CommonController) isClusterRequest() bool {
+	return c.Ctx.Request.Header.Get(CLUSTER_SIGN_HEADER) != ""
+}
+
+func (c *CommonController) clusterAuthor() bool {
+	UserName, err := checkClusterRequest(c.Ctx.Request)
+	if err != nil {
+		c.SetJsonData(ResultDataStruct{Status: -1, Msg: err.Error(), Data: nil})
+		c.StopServeJSON()
+		return false
+	}
+	userInfo := user.GetUserInfo(UserName)
+	if userInfo.Name == "" {
+		c.authErrExit()
+		return false
+	}
+	if userInfo.Group == "" {
+		userInfo.Group = "monitor"
+	}
+	c.userName = UserName
+	c.userInfo = userInfo
+	c.Data["Version"] = config.VERSION
+	return true
+}
+
+// 需要转发的时候, 转发之后直接结束当前请求
+// write 为 true 的时候, 没有数据源的请求转发到 coordinator
+func (c *CommonController) clusterProxy(write bool) {
+	if !cluster.ShardEnable() || c.userName == "" || c.isClusterRequest() {
+		return
+	}
+	var member cluster.Member
+	var remote bool
+	// 参数有问题的在当前节点校验权限的时候返回错误
+	res, _ := c.getRequestResource()
+	if DbName := res.DbName; DbName != "" {
+		member, remote = cluster.GetDbOwner(DbName)
+	} else if write {
+		member, remote = cluster.GetCoordinator()
+	}
+	if !remote {
+		return
+	}
+	c.proxyTo(member)
+	c.SetOutputByUser()
+	c.StopRun()
+}
+
+func (c *CommonController) proxyTo(member cluster.Member) {
+	req := c.Ctx.Request
+	// 表单已经被 ParseForm 读取过, 重新写回 body
+	if req.PostForm != nil && strings.Contains(req.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		body := req.PostForm.Encode()
+		req.Body = ioutil.NopCloser(strings.NewReader(body))
+		req.ContentLength = int64(len(body))
+	}
+	req.Header.Del("Authorization")
+	req.Header.Del("Cookie")
+	req.Header.Set(CLUSTER_USER_HEADER, c.userName)
+	req.Header.Set(CLUSTER_TIME_HEADER, strconv.FormatInt(time.Now().Unix(), 10))
+	req.Header.Set(CLUSTER_NONCE_HEADER, randomString())
+	req.Header.Set(CLUSTER_SIGN_HEADER, cluster.ClusterSign(clusterSignContent(req)))
+
+	scheme := "http"
+	if config.TLS {
+		scheme = "https"
+	}
+	var errorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		msg := fmt.Sprintf("proxy to node:%s ( %s ) err:%s", member.NodeID, member.Addr, err)
+		json.NewEncoder(w).Encode(ResultDataStruct{Status: -1, Msg: msg, Data: nil})
+	}
+	transport, err := getClusterTransport()
+	if err != nil {
+		errorHandler(c.Ctx.ResponseWriter, req, err)
+		return
+	}
+	proxy := httputil.NewSingleHostReverseProxy(&url.URL{Scheme: scheme, Host: member.Addr})
+	proxy.Transport = transport
+	proxy.ErrorHandler = errorHandler
+	proxy.ServeHTTP(c.Ctx.ResponseWriter, req)
+}
@@ -0,0 +1,42 @@
+package controller
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestClusterSignContent(t *testing.T) {
+	Convey("form body hash same as the node received", t, func() {
+		req := httptest.NewRequest("POST", "/db/add?format=json", strings.NewReader("b=2&a=1"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.ParseForm()
+		sender := clusterSignContent(req)
+		So(sender.Path, ShouldEqual, "/db/add")
+		So(sender.Query, ShouldEqual, "format=json")
+
+		// 转发的时候写回的 body
+		received := httptest.NewRequest("POST", "/db/add?format=json", strings.NewReader(req.PostForm.Encode()))
+		received.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		received.ParseForm()
+		So(clusterSignContent(received).BodyHash, ShouldEqual, sender.BodyHash)
+
+		received = httptest.NewRequest("POST", "/db/add?format=json", strings.NewReader("a=1&b=3"))
+		received.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		received.ParseForm()
+		So(clusterSignContent(received).BodyHash, ShouldNotEqual, sender.BodyHash)
+	})
+
+	Convey("json body still can be read after hash", t, func() {
+		req := httptest.NewRequest("POST", "/api/v2/dbs", strings.NewReader(`{"Name":"mysqlTest"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.ParseForm()
+		content := clusterSignContent(req)
+		So(clusterSignContent(req).BodyHash, ShouldEqual, content.BodyHash)
+		body, _ := ioutil.ReadAll(req.Body)
+		So(string(body), ShouldEqual, `{"Name":"mysqlTest"}`)
+	})
+}
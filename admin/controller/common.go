@@ -21,18 +21,23 @@ import (
 
 	"github.com/brokercap/Bifrost/admin/xgo"
 	"github.com/brokercap/Bifrost/config"
+	"github.com/brokercap/Bifrost/server/cluster"
 	"github.com/brokercap/Bifrost/server/user"
 )
 
 type CommonController struct {
 	xgo.Controller
+	userName string // 当前登录的用户, 转发到别的节点的时候使用
+	userInfo *user.UserInfo
 }
 
-var writeRequestOp = []string{"/add", "/del", "/start", "/stop", "/close", "/deal", "/update", "/export", "/import", "kill"}
+var writeRequestOp = []string{"/add", "/del", "/start", "/stop", "/close", "/deal", "/replay", "/pause", "/resume", "/update", "/export", "/import", "kill"}
 var skipCheckAuthUriMap = map[string]bool{
-	"/login/index": true,
-	"/dologin":     true,
-	"/logout":      true,
+	"/login/index":         true,
+	"/dologin":             true,
+	"/logout":              true,
+	"/login/oidc":          true,
+	"/login/oidc/callback": true,
 }
 
 // 判断是否为写操作
@@ -47,7 +52,9 @@ func (c *CommonController) checkWriteRequest(uri string) bool {
 
 func (c *CommonController) Prepare() {
 	var ok bool
-	if c.Ctx.Request.Header.Get("Authorization") != "" {
+	if c.isClusterRequest() {
+		ok = c.clusterAuthor()
+	} else if c.Ctx.Request.Header.Get("Authorization") != "" {
 		ok = c.basicAuthor()
 	} else {
 		ok = c.normalAuthor()
@@ -56,15 +63,28 @@ func (c *CommonController) Prepare() {
 	if !ok {
 		c.authErrExit()
 	}
+	write := c.checkWriteRequest(c.Ctx.Request.RequestURI)
+	// 转发到别的节点的请求, 由数据源所在的节点校验权限
+	c.clusterProxy(write)
+	c.checkPermission(write)
 }
 
-func (c *CommonController) checkAdminWriteRequest(group string) bool {
-	if group != "administrator" && c.checkWriteRequest(c.Ctx.Request.RequestURI) {
-		c.SetJsonData(ResultDataStruct{Status: -1, Msg: "user group : [ " + group + " ] no authority", Data: nil})
+func (c *CommonController) checkPermission(write bool) {
+	if c.userInfo == nil {
+		return
+	}
+	if err := c.checkRequestPermission(write); err != nil {
+		c.SetJsonData(ResultDataStruct{Status: -1, Msg: err.Error(), Data: nil})
 		c.StopServeJSON()
-		return false
+		return
+	}
+	// standby 节点的修改不会生效, 需要到 leader 上操作
+	if write {
+		if err := cluster.CheckLeader(); err != nil {
+			c.SetJsonData(ResultDataStruct{Status: -1, Msg: err.Error(), Data: nil})
+			c.StopServeJSON()
+		}
 	}
-	return true
 }
 
 func (c *CommonController) authErrExit() {
@@ -85,16 +105,22 @@ func (c *CommonController) basicAuthor() bool {
 		c.StopServeJSON()
 		return false
 	}
-	return c.checkAdminWriteRequest(userInfo.Group)
+	c.userName = UserName
+	c.userInfo = userInfo
+	return true
 }
 
 func (c *CommonController) normalAuthor() bool {
 	var sessionID = c.Ctx.Session.CheckCookieValid(c.Ctx.ResponseWriter, c.Ctx.Request)
 	if sessionID != "" {
-		if _, ok := c.Ctx.Session.GetSessionVal(sessionID, "UserName"); ok {
-			//非administrator用户 用户，没有写操作权限
+		if UserName, ok := c.Ctx.Session.GetSessionVal(sessionID, "UserName"); ok {
+			c.userName, _ = UserName.(string)
+			// 用户组用登录时候的, 角色用最新的
 			Group, _ := c.Ctx.Session.GetSessionVal(sessionID, "Group")
-			return c.checkAdminWriteRequest(Group.(string))
+			c.userInfo = user.GetUserInfo(c.userName)
+			c.userInfo.Name = c.userName
+			c.userInfo.Group, _ = Group.(string)
+			return true
 		} else {
 			goto toLogin
 		}
@@ -103,7 +129,7 @@ func (c *CommonController) normalAuthor() bool {
 	}
 
 toLogin:
-	if _, ok := skipCheckAuthUriMap[c.Ctx.Request.RequestURI]; !ok {
+	if _, ok := skipCheckAuthUriMap[c.Ctx.Request.URL.Path]; !ok {
 		if c.IsHtmlOutput() {
 			http.Redirect(c.Ctx.ResponseWriter, c.Ctx.Request, "/login/index", http.StatusFound)
 			return false
@@ -71,13 +71,39 @@ func (c *DBController) getParam() *DbUpdateParam {
 }
 
 // 判断是否为mysql数据源
-func (c *DBController) isMysqlInputType(data *DbUpdateParam) bool {
+func isMysqlInputType(data *DbUpdateParam) bool {
 	return strings.Contains(strings.ToLower(data.InputType), "mysql")
 }
 
+// 添加和修改数据源的参数校验, v1 和 v2 接口共用
+func checkDbUpdateParam(data *DbUpdateParam) error {
+	if data.DbName == "" || data.Uri == "" || data.BinlogFileName == "" || data.BinlogPosition < 0 || data.ServerId <= 0 {
+		return fmt.Errorf(" param error!")
+	}
+	if data.Gtid != "" && isMysqlInputType(data) {
+		if err := mysql.CheckGtid(data.Gtid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getDbInputInfo(data *DbUpdateParam) inputDriver.InputInfo {
+	return inputDriver.InputInfo{
+		DbName:         data.DbName,
+		ConnectUri:     data.Uri,
+		GTID:           data.Gtid,
+		BinlogFileName: data.BinlogFileName,
+		BinlogPostion:  data.BinlogPosition,
+		ServerId:       data.ServerId,
+		MaxFileName:    data.MaxBinlogFileName,
+		MaxPosition:    data.MaxBinlogPosition,
+	}
+}
+
 // 数据源列表，界面显示
 func (c *DBController) Index() {
-	dbList := server.GetListDb()
+	dbList := c.filterDbList(server.GetListDb())
 	inputPluginsMap := inputDriver.Drivers()
 	c.SetData("Title", "db list")
 	c.SetData("DBList", dbList)
@@ -87,7 +113,7 @@ func (c *DBController) Index() {
 
 // db list
 func (c *DBController) List() {
-	dbList := server.GetListDb()
+	dbList := c.filterDbList(server.GetListDb())
 	c.SetJsonData(dbList)
 	c.StopServeJSON()
 }
@@ -100,28 +126,12 @@ func (c *DBController) Add() {
 		c.StopServeJSON()
 	}()
 	data := c.getParam()
-	if data.DbName == "" || data.Uri == "" || data.BinlogFileName == "" || data.BinlogPosition < 0 || data.ServerId <= 0 {
-		result.Msg = " param error!"
+	if err := checkDbUpdateParam(data); err != nil {
+		result.Msg = err.Error()
 		return
 	}
-	if data.Gtid != "" && c.isMysqlInputType(data) {
-		err := mysql.CheckGtid(data.Gtid)
-		if err != nil {
-			result.Msg = err.Error()
-			return
-		}
-	}
 	defer server.SaveDBConfigInfo()
-	inputInfo := inputDriver.InputInfo{
-		DbName:         data.DbName,
-		ConnectUri:     data.Uri,
-		GTID:           data.Gtid,
-		BinlogFileName: data.BinlogFileName,
-		BinlogPostion:  data.BinlogPosition,
-		ServerId:       data.ServerId,
-		MaxFileName:    data.MaxBinlogFileName,
-		MaxPosition:    data.MaxBinlogPosition,
-	}
+	inputInfo := getDbInputInfo(data)
 	server.AddNewDB(data.DbName, data.InputType, inputInfo, time.Now().Unix())
 	channel, _ := server.GetDBObj(data.DbName).AddChannel("default", 1)
 	if channel != nil {
@@ -138,27 +148,11 @@ func (c *DBController) Update() {
 		c.StopServeJSON()
 	}()
 	data := c.getParam()
-	if data.DbName == "" || data.Uri == "" || data.BinlogFileName == "" || data.BinlogPosition < 0 || data.ServerId <= 0 {
-		result.Msg = " param error!"
+	if err := checkDbUpdateParam(data); err != nil {
+		result.Msg = err.Error()
 		return
 	}
-	if data.Gtid != "" && c.isMysqlInputType(data) {
-		err := mysql.CheckGtid(data.Gtid)
-		if err != nil {
-			result.Msg = err.Error()
-			return
-		}
-	}
-	inputInfo := inputDriver.InputInfo{
-		DbName:         data.DbName,
-		ConnectUri:     data.Uri,
-		GTID:           data.Gtid,
-		BinlogFileName: data.BinlogFileName,
-		BinlogPostion:  data.BinlogPosition,
-		ServerId:       data.ServerId,
-		MaxFileName:    data.MaxBinlogFileName,
-		MaxPosition:    data.MaxBinlogPosition,
-	}
+	inputInfo := getDbInputInfo(data)
 	err := server.UpdateDB(data.DbName, data.InputType, inputInfo, time.Now().Unix(), data.UpdateToServer)
 	if err != nil {
 		result.Msg = err.Error()
@@ -58,38 +58,34 @@ func (c *HistoryController) getParam() *HistoryParam {
 	return &data
 }
 
-func (c *HistoryController) Index() {
-	DbName := c.Ctx.Request.Form.Get("DbName")
-	TableName := c.Ctx.Request.Form.Get("TableName")
-	SchemaName := c.Ctx.Request.Form.Get("SchemaName")
-	var status history.HisotryStatus
-	switch c.Ctx.Request.Form.Get("Status") {
+// 按名称过滤全量任务的状态, 为空或者不认识的返回所有状态
+func getHistoryStatus(name string) history.HisotryStatus {
+	switch name {
 	case "close":
-		status = history.HISTORY_STATUS_CLOSE
-		break
+		return history.HISTORY_STATUS_CLOSE
 	case "running":
-		status = history.HISTORY_STATUS_RUNNING
-		break
+		return history.HISTORY_STATUS_RUNNING
 	case "selectOver":
-		status = history.HISTORY_STATUS_SELECT_OVER
-		break
+		return history.HISTORY_STATUS_SELECT_OVER
 	case "over":
-		status = history.HISTORY_STATUS_OVER
-		break
+		return history.HISTORY_STATUS_OVER
 	case "halfway":
-		status = history.HISTORY_STATUS_HALFWAY
-		break
+		return history.HISTORY_STATUS_HALFWAY
 	case "killed":
-		status = history.HISTORY_STATUS_KILLED
-		break
+		return history.HISTORY_STATUS_KILLED
 	case "stoping":
-		status = history.HISTORY_STATUS_SELECT_STOPING
-		break
+		return history.HISTORY_STATUS_SELECT_STOPING
 	default:
-		status = history.HISTORY_STATUS_ALL
-		break
+		return history.HISTORY_STATUS_ALL
 	}
-	HistoryList := history.GetHistoryList(DbName, SchemaName, tansferTableName(TableName), status)
+}
+
+func (c *HistoryController) Index() {
+	DbName := c.Ctx.Request.Form.Get("DbName")
+	TableName := c.Ctx.Request.Form.Get("TableName")
+	SchemaName := c.Ctx.Request.Form.Get("SchemaName")
+	status := getHistoryStatus(c.Ctx.Request.Form.Get("Status"))
+	HistoryList := c.filterHistoryList(history.GetHistoryList(DbName, SchemaName, tansferTableName(TableName), status))
 
 	StatusList := []history.HisotryStatus{
 		history.HISTORY_STATUS_ALL,
@@ -106,7 +102,9 @@ func (c *HistoryController) Index() {
 	c.SetData("TableName", TableName)
 	c.SetData("SchemaName", SchemaName)
 	c.SetData("HistoryList", HistoryList)
-	c.SetData("DbList", server.GetListDb())
+	c.SetData("IncrementalSnapshotList", history.GetIncrementalSnapshotList(DbName))
+	c.SetData("VerifyTaskList", history.GetVerifyTaskList(DbName))
+	c.SetData("DbList", c.filterDbList(server.GetListDb()))
 	c.SetData("Status", status)
 	c.SetData("StatusList", StatusList)
 	c.SetData("DbName", DbName)
@@ -119,34 +117,8 @@ func (c *HistoryController) List() {
 	DbName := c.Ctx.Request.Form.Get("DbName")
 	TableName := c.Ctx.Request.Form.Get("TableName")
 	SchemaName := c.Ctx.Request.Form.Get("SchemaName")
-	var status history.HisotryStatus
-	switch c.Ctx.Request.Form.Get("Status") {
-	case "close":
-		status = history.HISTORY_STATUS_CLOSE
-		break
-	case "running":
-		status = history.HISTORY_STATUS_RUNNING
-		break
-	case "selectOver":
-		status = history.HISTORY_STATUS_SELECT_OVER
-		break
-	case "over":
-		status = history.HISTORY_STATUS_OVER
-		break
-	case "halfway":
-		status = history.HISTORY_STATUS_HALFWAY
-		break
-	case "killed":
-		status = history.HISTORY_STATUS_KILLED
-		break
-	case "stoping":
-		status = history.HISTORY_STATUS_SELECT_STOPING
-		break
-	default:
-		status = history.HISTORY_STATUS_ALL
-		break
-	}
-	HistoryList := history.GetHistoryList(DbName, SchemaName, tansferTableName(TableName), status)
+	status := getHistoryStatus(c.Ctx.Request.Form.Get("Status"))
+	HistoryList := c.filterHistoryList(history.GetHistoryList(DbName, SchemaName, tansferTableName(TableName), status))
 	c.SetJsonData(HistoryList)
 	c.StopServeJSON()
 }
@@ -158,58 +130,50 @@ func (c *HistoryController) Add() {
 		c.SetJsonData(result)
 		c.StopServeJSON()
 	}()
+	ID, err := addHistory(param)
+	if err != nil {
+		result.Msg = err.Error()
+	} else {
+		result = ResultDataStruct{Status: 1, Msg: "success", Data: ID}
+	}
+}
+
+// 添加全量任务, v1 和 v2 接口共用
+func addHistory(param *HistoryParam) (int, error) {
 	db := server.GetDbInfo(param.DbName)
 	if db == nil {
-		result.Msg = fmt.Sprintf("DbName: %s not esxit", param.DbName)
-		return
+		return 0, fmt.Errorf("DbName: %s not esxit", param.DbName)
 	}
 	o := inputDriver.Open(db.InputType, inputDriver.InputInfo{})
 	if o == nil {
-		result.Msg = fmt.Sprintf("DbName: %s Input: %s not esxit", db.Name, db.InputType)
-		return
+		return 0, fmt.Errorf("DbName: %s Input: %s not esxit", db.Name, db.InputType)
 	}
 	if !o.IsSupported(inputDriver.SupportFull) {
-		result.Msg = fmt.Sprintf("DbName: %s Input: %s Full is not supported", db.Name, db.InputType)
-		return
+		return 0, fmt.Errorf("DbName: %s Input: %s Full is not supported", db.Name, db.InputType)
 	}
 	if tansferTableName(param.SchemaName) == "*" {
-		result.Msg = "不能给 AllDataBases 添加全量任务!"
-		return
+		return 0, fmt.Errorf("不能给 AllDataBases 添加全量任务!")
 	}
 	if param.TableNames == "" {
-		result.Msg = "table_names not be empty!"
-		return
+		return 0, fmt.Errorf("table_names not be empty!")
 	}
 	if len(param.ToserverIds) == 0 {
-		result.Msg = "ToserverIds error!"
-		return
+		return 0, fmt.Errorf("ToserverIds error!")
 	}
-	tablenameArr := strings.Split(param.TableNames, ";")
 	tableNameTest := ""
-	for _, v := range tablenameArr {
+	for _, v := range strings.Split(param.TableNames, ";") {
 		if v != "" {
 			tableNameTest = v
 			break
 		}
 	}
 	if tableNameTest == "" {
-		result.Msg = "table_names error!"
-		return
-	}
-	var err error
-	err = history.CheckWhere(param.DbName, param.SchemaName, tableNameTest, param.Property.Where)
-	if err != nil {
-		result.Msg = err.Error()
-		return
+		return 0, fmt.Errorf("table_names error!")
 	}
-
-	var ID int
-	ID, err = history.AddHistory(param.DbName, param.SchemaName, tansferTableName(param.TableName), param.TableNames, param.Property, param.ToserverIds)
-	if err != nil {
-		result.Msg = err.Error()
-	} else {
-		result = ResultDataStruct{Status: 1, Msg: "success", Data: ID}
+	if err := history.CheckWhere(param.DbName, param.SchemaName, tableNameTest, param.Property.Where); err != nil {
+		return 0, err
 	}
+	return history.AddHistory(param.DbName, param.SchemaName, tansferTableName(param.TableName), param.TableNames, param.Property, param.ToserverIds)
 }
 
 func (c *HistoryController) Delete() {
@@ -272,6 +236,21 @@ func (c *HistoryController) Stop() {
 	}
 }
 
+func (c *HistoryController) Resume() {
+	param := c.getParam()
+	result := ResultDataStruct{Status: 0, Msg: "error", Data: nil}
+	defer func() {
+		c.SetJsonData(result)
+		c.StopServeJSON()
+	}()
+	err := history.ResumeHistory(param.DbName, param.Id)
+	if err != nil {
+		result.Msg = err.Error()
+	} else {
+		result = ResultDataStruct{Status: 1, Msg: "success", Data: param.Id}
+	}
+}
+
 func (c *HistoryController) CheckWhere() {
 	param := c.getParam()
 	result := ResultDataStruct{Status: 0, Msg: "error", Data: nil}
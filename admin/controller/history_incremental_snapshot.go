@@ -0,0 +1,123 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"encoding/json"
+	"github.com/brokercap/Bifrost/server/history"
+	"io/ioutil"
+)
+
+type IncrementalSnapshotParam struct {
+	DbName        string
+	SchemaName    string
+	TableName     string
+	TableNames    string // 用 ; 隔开的表名
+	ChunkSize     int    // 每个区间的数据条数
+	SignalTable   string // 信号表 schema.table, 为空则是 SchemaName.bifrost_signal
+	ToserverIds   []int
+	Id            int
+	SnapshotTable string // 暂停,恢复 的表名
+}
+
+func (c *HistoryController) getIncrementalSnapshotParam() (*IncrementalSnapshotParam, error) {
+	var param IncrementalSnapshotParam
+	body, err := ioutil.ReadAll(c.Ctx.Request.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(body, &param); err != nil {
+		return nil, err
+	}
+	return &param, nil
+}
+
+func (c *HistoryController) IncrementalSnapshotList() {
+	DbName := c.Ctx.Request.Form.Get("DbName")
+	c.SetJsonData(history.GetIncrementalSnapshotList(DbName))
+	c.StopServeJSON()
+}
+
+func (c *HistoryController) IncrementalSnapshotAdd() {
+	result := ResultDataStruct{Status: 0, Msg: "error", Data: nil}
+	defer func() {
+		c.SetJsonData(result)
+		c.StopServeJSON()
+	}()
+	param, err := c.getIncrementalSnapshotParam()
+	if err != nil {
+		result.Msg = err.Error()
+		return
+	}
+	if tansferSchemaName(param.SchemaName) == "*" {
+		result.Msg = "不能给 AllDataBases 添加增量快照任务!"
+		return
+	}
+	ID, err := history.AddIncrementalSnapshot(param.DbName, param.SchemaName, tansferTableName(param.TableName), param.TableNames, param.ChunkSize, param.SignalTable, param.ToserverIds)
+	if err != nil {
+		result.Msg = err.Error()
+		return
+	}
+	result = ResultDataStruct{Status: 1, Msg: "success", Data: ID}
+}
+
+func (c *HistoryController) IncrementalSnapshotStart() {
+	c.doIncrementalSnapshot(func(param *IncrementalSnapshotParam) error {
+		return history.StartIncrementalSnapshot(param.DbName, param.Id)
+	})
+}
+
+func (c *HistoryController) IncrementalSnapshotStop() {
+	c.doIncrementalSnapshot(func(param *IncrementalSnapshotParam) error {
+		return history.StopIncrementalSnapshot(param.DbName, param.Id)
+	})
+}
+
+func (c *HistoryController) IncrementalSnapshotDelete() {
+	c.doIncrementalSnapshot(func(param *IncrementalSnapshotParam) error {
+		return history.DelIncrementalSnapshot(param.DbName, param.Id)
+	})
+}
+
+func (c *HistoryController) IncrementalSnapshotPause() {
+	c.doIncrementalSnapshot(func(param *IncrementalSnapshotParam) error {
+		return history.PauseIncrementalSnapshotTable(param.DbName, param.Id, param.SnapshotTable, true)
+	})
+}
+
+func (c *HistoryController) IncrementalSnapshotResume() {
+	c.doIncrementalSnapshot(func(param *IncrementalSnapshotParam) error {
+		return history.PauseIncrementalSnapshotTable(param.DbName, param.Id, param.SnapshotTable, false)
+	})
+}
+
+func (c *HistoryController) doIncrementalSnapshot(fun func(param *IncrementalSnapshotParam) error) {
+	result := ResultDataStruct{Status: 0, Msg: "error", Data: nil}
+	defer func() {
+		c.SetJsonData(result)
+		c.StopServeJSON()
+	}()
+	param, err := c.getIncrementalSnapshotParam()
+	if err != nil {
+		result.Msg = err.Error()
+		return
+	}
+	if err = fun(param); err != nil {
+		result.Msg = err.Error()
+		return
+	}
+	result = ResultDataStruct{Status: 1, Msg: "success", Data: param.Id}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"encoding/json"
+	"github.com/brokercap/Bifrost/server/history"
+	"io/ioutil"
+)
+
+type VerifyParam struct {
+	DbName          string
+	SchemaName      string
+	TableName       string
+	VerifyTableName string // 校验的表, 同步配置是模糊匹配的时候要填
+	ToServerId      int
+	ChunkSize       int
+	RowsPerSecond   int // 每秒最多校验多少条数据, 0 不限速
+	Crontab         string
+	Repair          bool
+	Id              int
+}
+
+func (c *HistoryController) getVerifyParam() (*VerifyParam, error) {
+	var param VerifyParam
+	body, err := ioutil.ReadAll(c.Ctx.Request.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(body, &param); err != nil {
+		return nil, err
+	}
+	return &param, nil
+}
+
+func (c *HistoryController) VerifyList() {
+	DbName := c.Ctx.Request.Form.Get("DbName")
+	c.SetJsonData(history.GetVerifyTaskList(DbName))
+	c.StopServeJSON()
+}
+
+func (c *HistoryController) VerifyAdd() {
+	result := ResultDataStruct{Status: 0, Msg: "error", Data: nil}
+	defer func() {
+		c.SetJsonData(result)
+		c.StopServeJSON()
+	}()
+	param, err := c.getVerifyParam()
+	if err != nil {
+		result.Msg = err.Error()
+		return
+	}
+	ID, err := history.AddVerifyTask(param.DbName, tansferSchemaName(param.SchemaName), tansferTableName(param.TableName), param.VerifyTableName, param.ToServerId, param.ChunkSize, param.RowsPerSecond, param.Crontab, param.Repair)
+	if err != nil {
+		result.Msg = err.Error()
+		return
+	}
+	result = ResultDataStruct{Status: 1, Msg: "success", Data: ID}
+}
+
+func (c *HistoryController) VerifyDetail() {
+	result := ResultDataStruct{Status: 0, Msg: "error", Data: nil}
+	defer func() {
+		c.SetJsonData(result)
+		c.StopServeJSON()
+	}()
+	param, err := c.getVerifyParam()
+	if err != nil {
+		result.Msg = err.Error()
+		return
+	}
+	task, err := history.GetVerifyTask(param.DbName, param.Id)
+	if err != nil {
+		result.Msg = err.Error()
+		return
+	}
+	result = ResultDataStruct{Status: 1, Msg: "success", Data: task}
+}
+
+func (c *HistoryController) VerifyStart() {
+	c.doVerify(func(param *VerifyParam) error {
+		return history.StartVerifyTask(param.DbName, param.Id)
+	})
+}
+
+func (c *HistoryController) VerifyStop() {
+	c.doVerify(func(param *VerifyParam) error {
+		return history.StopVerifyTask(param.DbName, param.Id)
+	})
+}
+
+func (c *HistoryController) VerifyDelete() {
+	c.doVerify(func(param *VerifyParam) error {
+		return history.DelVerifyTask(param.DbName, param.Id)
+	})
+}
+
+func (c *HistoryController) doVerify(fun func(param *VerifyParam) error) {
+	result := ResultDataStruct{Status: 0, Msg: "error", Data: nil}
+	defer func() {
+		c.SetJsonData(result)
+		c.StopServeJSON()
+	}()
+	param, err := c.getVerifyParam()
+	if err != nil {
+		result.Msg = err.Error()
+		return
+	}
+	if err = fun(param); err != nil {
+		result.Msg = err.Error()
+		return
+	}
+	result = ResultDataStruct{Status: 1, Msg: "success", Data: param.Id}
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/brokercap/Bifrost/plugin/driver"
 	pluginStorage "github.com/brokercap/Bifrost/plugin/storage"
 	"github.com/brokercap/Bifrost/server"
+	"github.com/brokercap/Bifrost/server/cluster"
 	"io"
 	"os"
 	"runtime"
@@ -71,6 +72,8 @@ func (c *IndexController) Overview() {
 	c.SetData("StartTime", StartTime)
 	c.SetData("GOOS", runtime.GOOS)
 	c.SetData("GOARCH", runtime.GOARCH)
+	c.SetData("HA", cluster.GetStatus())
+	c.SetData("Shard", cluster.GetShardStatus())
 	c.StopServeJSON()
 }
 
@@ -16,6 +16,10 @@ limitations under the License.
 package controller
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"log"
 	"net/http"
 
 	"github.com/brokercap/Bifrost/server/user"
@@ -26,10 +30,88 @@ type LoginController struct {
 }
 
 func (c *LoginController) Index() {
+	c.SetData("OIDCEnable", user.GetOIDCProvider() != nil)
 	c.SetTitle("Login")
 	c.AddAdminTemplate("login.html")
 }
 
+func (c *LoginController) loginError(msg string) {
+	c.SetData("Error", msg)
+	c.Index()
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// 跳转到 IdP 登录, state 和 nonce 保存在一个还没有登录的 session 里
+func (c *LoginController) OIDCLogin() {
+	p := user.GetOIDCProvider()
+	if p == nil {
+		c.loginError("oidc not enable")
+		return
+	}
+	state, nonce := randomString(), randomString()
+	uri, err := p.AuthCodeURL(state, nonce)
+	if err != nil {
+		log.Println("oidc login err:", err)
+		c.loginError(err.Error())
+		return
+	}
+	sessionID := c.Ctx.Session.StartSession(c.Ctx.ResponseWriter, c.Ctx.Request)
+	c.Ctx.Session.SetSessionVal(sessionID, "OIDCState", state)
+	c.Ctx.Session.SetSessionVal(sessionID, "OIDCNonce", nonce)
+	c.SetOutputByUser()
+	http.Redirect(c.Ctx.ResponseWriter, c.Ctx.Request, uri, http.StatusFound)
+}
+
+func (c *LoginController) OIDCCallback() {
+	p := user.GetOIDCProvider()
+	if p == nil {
+		c.loginError("oidc not enable")
+		return
+	}
+	sessionID := c.Ctx.Session.CheckCookieValid(c.Ctx.ResponseWriter, c.Ctx.Request)
+	if sessionID == "" {
+		c.loginError("session time out")
+		return
+	}
+	state, _ := c.Ctx.Session.GetSessionVal(sessionID, "OIDCState")
+	nonce, _ := c.Ctx.Session.GetSessionVal(sessionID, "OIDCNonce")
+	// state 只能用一次
+	c.Ctx.Session.EndSessionBy(sessionID)
+	stateStr, _ := state.(string)
+	nonceStr, _ := nonce.(string)
+	query := c.Ctx.Request.URL.Query()
+	if stateStr == "" || subtle.ConstantTimeCompare([]byte(stateStr), []byte(query.Get("state"))) != 1 {
+		c.loginError("oidc state error")
+		return
+	}
+	if query.Get("error") != "" {
+		c.loginError("oidc " + query.Get("error") + " " + query.Get("error_description"))
+		return
+	}
+	claims, err := p.Exchange(query.Get("code"), nonceStr)
+	if err != nil {
+		log.Println("oidc callback err:", err)
+		c.loginError(err.Error())
+		return
+	}
+	mayXRealIP, remoteAddrIp := c.GetRemoteIp()
+	UserInfo, err := user.CheckExternalUserWithIP(user.USER_SOURCE_OIDC, &user.ExternalUser{Name: claims.Username, Groups: claims.Groups}, mayXRealIP, remoteAddrIp)
+	if err != nil {
+		c.loginError(err.Error())
+		return
+	}
+	sessionID = c.Ctx.Session.StartSession(c.Ctx.ResponseWriter, c.Ctx.Request)
+	c.Ctx.Session.SetSessionVal(sessionID, "UserName", UserInfo.Name)
+	c.Ctx.Session.SetSessionVal(sessionID, "Group", UserInfo.Group)
+	c.SetOutputByUser()
+	http.Redirect(c.Ctx.ResponseWriter, c.Ctx.Request, "/", http.StatusFound)
+}
+
 func (c *LoginController) Login() {
 	param := c.getParam()
 	result := ResultDataStruct{Status: 0, Msg: "error", Data: nil}
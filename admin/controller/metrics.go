@@ -0,0 +1,38 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"log"
+
+	"github.com/brokercap/Bifrost/server"
+	"github.com/brokercap/Bifrost/server/metrics"
+)
+
+type MetricsController struct {
+	CommonController
+}
+
+// Prometheus 抓取的指标, 抓取时用 basic_auth 配置 Bifrost 的账号
+func (c *MetricsController) Index() {
+	c.SetOutputByUser()
+	w := metrics.NewWriter(c.Ctx.ResponseWriter, metrics.NegotiateOpenMetrics(c.Ctx.Request.Header.Get("Accept")))
+	c.Ctx.ResponseWriter.Header().Set("Content-Type", w.ContentType())
+	server.WriteMetrics(w)
+	if err := w.Close(); err != nil {
+		log.Println("metrics write err:", err)
+	}
+}
@@ -0,0 +1,230 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/brokercap/Bifrost/server"
+	"github.com/brokercap/Bifrost/server/history"
+	"github.com/brokercap/Bifrost/server/user"
+)
+
+// 请求的权限校验
+// 带 DbName 的请求按 数据源, 库, 目标库 校验角色权限, 其他的写操作只有 administrator 可以操作
+
+type requestResource struct {
+	user.Resource
+	TableName  string
+	ToServerId int
+	Id         int
+}
+
+var operateRequestOp = []string{"/start", "/stop", "/close", "/pause", "/resume", "kill", "/deal", "/replay"}
+
+// 请求需要的权限, history 的操作都是 PERM_HISTORY
+func getPermAction(method, uri string, write bool) string {
+	if !write {
+		return user.PERM_VIEW
+	}
+	path := strings.Split(uri, "?")[0]
+	if strings.Contains(path, "/history") {
+		return user.PERM_HISTORY
+	}
+	if method == http.MethodDelete || strings.Contains(path, "/del") {
+		return user.PERM_DELETE
+	}
+	for _, v := range operateRequestOp {
+		if strings.Contains(path, v) {
+			return user.PERM_OPERATE
+		}
+	}
+	return user.PERM_CONFIG
+}
+
+// 表单里的值和 body 里的值不一样的时候报错, 防止校验的和实际操作的不是同一个
+func mergeRequestParam(name, formVal, bodyVal string) (string, error) {
+	if formVal != "" && bodyVal != "" && formVal != bodyVal {
+		return "", fmt.Errorf("%s in url and body is different", name)
+	}
+	if formVal != "" {
+		return formVal, nil
+	}
+	return bodyVal, nil
+}
+
+func mergeRequestIntParam(name, formVal string, bodyVal int) (int, error) {
+	n, _ := strconv.Atoi(formVal)
+	if n > 0 && bodyVal > 0 && n != bodyVal {
+		return 0, fmt.Errorf("%s in url and body is different", name)
+	}
+	if n > 0 {
+		return n, nil
+	}
+	return bodyVal, nil
+}
+
+// 参数可能在 url, 表单, 或者 json body 里
+func (c *CommonController) getRequestResource() (res requestResource, err error) {
+	req := c.Ctx.Request
+	var param struct {
+		DbName      string
+		SchemaName  string
+		TableName   string
+		ToServerKey string
+		ToServerId  int
+		Id          int
+	}
+	if req.Body != nil && !strings.Contains(req.Header.Get("Content-Type"), "multipart/form-data") {
+		body, _ := ioutil.ReadAll(req.Body)
+		// 后面的 action 还要读取 body
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		json.Unmarshal(body, &param)
+	}
+	if res.DbName, err = mergeRequestParam("DbName", req.Form.Get("DbName"), param.DbName); err != nil {
+		return
+	}
+	if res.SchemaName, err = mergeRequestParam("SchemaName", req.Form.Get("SchemaName"), param.SchemaName); err != nil {
+		return
+	}
+	if res.TableName, err = mergeRequestParam("TableName", req.Form.Get("TableName"), param.TableName); err != nil {
+		return
+	}
+	if res.ToServerKey, err = mergeRequestParam("ToServerKey", req.Form.Get("ToServerKey"), param.ToServerKey); err != nil {
+		return
+	}
+	res.SchemaName = tansferSchemaName(res.SchemaName)
+	res.TableName = tansferTableName(res.TableName)
+	if res.ToServerId, err = mergeRequestIntParam("ToServerId", req.Form.Get("ToServerId"), param.ToServerId); err != nil {
+		return
+	}
+	if res.Id, err = mergeRequestIntParam("Id", req.Form.Get("Id"), param.Id); err != nil {
+		return
+	}
+	err = c.resolveRequestResource(&res)
+	return
+}
+
+// 带 ToServerId 的按服务端实际的 ToServerKey 校验, 只传了全量任务 Id 的, 找出对应的 SchemaName
+func (c *CommonController) resolveRequestResource(res *requestResource) error {
+	if res.DbName == "" {
+		return nil
+	}
+	if res.ToServerId > 0 && res.SchemaName != "" && res.TableName != "" {
+		ToServerKey := res.ToServerKey
+		// 找不到的按没有 ToServerKey 校验, 只有不限制 ToServerKey 的权限才能操作
+		res.ToServerKey = ""
+		if db := server.GetDBObj(res.DbName); db != nil {
+			if t := db.GetTable(res.SchemaName, res.TableName); t != nil {
+				_, toServer, err := findTableToServer(t, res.ToServerId, ToServerKey)
+				if err != nil {
+					return err
+				}
+				if toServer != nil {
+					res.ToServerKey = toServer.ToServerKey
+				}
+			}
+		}
+	}
+	path := strings.Split(c.Ctx.Request.RequestURI, "?")[0]
+	if res.SchemaName == "" && res.Id > 0 && strings.Contains(path, "/history") && !strings.Contains(path, "/incremental") && !strings.Contains(path, "/verify") {
+		list := history.GetHistoryList(res.DbName, "", "", history.HISTORY_STATUS_ALL)
+		for i := range list {
+			if list[i].ID == res.Id {
+				res.SchemaName = list[i].SchemaName
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// 按 ToServerId 找到表的同步配置, 传了 ToServerKey 的必须和实际的一致, 防止用别的 ToServerKey 的权限操作
+func findTableToServer(t *server.Table, ToServerId int, ToServerKey string) (index int, toServer *server.ToServer, err error) {
+	t.RLock()
+	defer t.RUnlock()
+	for i, v := range t.ToServerList {
+		if v.ToServerID != ToServerId {
+			continue
+		}
+		if ToServerKey != "" && ToServerKey != v.ToServerKey {
+			return 0, nil, fmt.Errorf("ToServerId:%d ToServerKey is not %s", ToServerId, ToServerKey)
+		}
+		return i, v, nil
+	}
+	return 0, nil, nil
+}
+
+func (c *CommonController) checkRequestPermission(write bool) error {
+	if c.userInfo == nil {
+		return nil
+	}
+	res, err := c.getRequestResource()
+	if err != nil {
+		return err
+	}
+	if res.DbName == "" {
+		if write && c.userInfo.Group != user.USER_GROUP_ADMINISTRATOR {
+			return fmt.Errorf("user group : [ %s ] no authority", c.userInfo.Group)
+		}
+		return nil
+	}
+	action := getPermAction(c.Ctx.Request.Method, c.Ctx.Request.RequestURI, write)
+	if !user.CheckPermission(c.userInfo, action, res.Resource) {
+		return fmt.Errorf("user : [ %s ] no %s permission on %s", c.userInfo.Name, action, formatPermResource(res.Resource))
+	}
+	return nil
+}
+
+func formatPermResource(res user.Resource) string {
+	s := res.DbName
+	if res.SchemaName != "" {
+		s += "." + res.SchemaName
+	}
+	if res.ToServerKey != "" {
+		s += " ToServer:" + res.ToServerKey
+	}
+	return s
+}
+
+// 列表里只返回有查看权限的数据
+func (c *CommonController) canView(res user.Resource) bool {
+	return c.userInfo == nil || user.CheckPermission(c.userInfo, user.PERM_VIEW, res)
+}
+
+func (c *CommonController) filterDbList(dbList map[string]server.DbListStruct) map[string]server.DbListStruct {
+	for DbName := range dbList {
+		if !c.canView(user.Resource{DbName: DbName}) {
+			delete(dbList, DbName)
+		}
+	}
+	return dbList
+}
+
+func (c *CommonController) filterHistoryList(list []history.History) []history.History {
+	for i := len(list) - 1; i >= 0; i-- {
+		if !c.canView(user.Resource{DbName: list[i].DbName, SchemaName: list[i].SchemaName}) {
+			list = append(list[:i], list[i+1:]...)
+		}
+	}
+	return list
+}
@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/brokercap/Bifrost/admin/xgo"
+	inputDriver "github.com/brokercap/Bifrost/input/driver"
+	"github.com/brokercap/Bifrost/server"
+	"github.com/brokercap/Bifrost/server/user"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGetPermAction(t *testing.T) {
+	Convey("v1 uri", t, func() {
+		So(getPermAction(http.MethodGet, "/db/detail?DbName=mysql1", false), ShouldEqual, user.PERM_VIEW)
+		So(getPermAction(http.MethodPost, "/db/add", true), ShouldEqual, user.PERM_CONFIG)
+		So(getPermAction(http.MethodPost, "/table/toserver/add", true), ShouldEqual, user.PERM_CONFIG)
+		So(getPermAction(http.MethodPost, "/db/del", true), ShouldEqual, user.PERM_DELETE)
+		So(getPermAction(http.MethodPost, "/table/toserver/deadletter/del", true), ShouldEqual, user.PERM_DELETE)
+		So(getPermAction(http.MethodPost, "/channel/stop", true), ShouldEqual, user.PERM_OPERATE)
+		So(getPermAction(http.MethodPost, "/table/toserver/deadletter/replay", true), ShouldEqual, user.PERM_OPERATE)
+		So(getPermAction(http.MethodPost, "/history/del", true), ShouldEqual, user.PERM_HISTORY)
+		So(getPermAction(http.MethodPost, "/history/verify/start", true), ShouldEqual, user.PERM_HISTORY)
+	})
+
+	Convey("api v2 uri", t, func() {
+		So(getPermAction(http.MethodGet, "/api/v2/dbs/mysql1", false), ShouldEqual, user.PERM_VIEW)
+		So(getPermAction(http.MethodPut, "/api/v2/dbs/mysql1", true), ShouldEqual, user.PERM_CONFIG)
+		So(getPermAction(http.MethodDelete, "/api/v2/dbs/mysql1", true), ShouldEqual, user.PERM_DELETE)
+		So(getPermAction(http.MethodPost, "/api/v2/dbs/mysql1/channels/1/close", true), ShouldEqual, user.PERM_OPERATE)
+		So(getPermAction(http.MethodDelete, "/api/v2/dbs/mysql1/history/1", true), ShouldEqual, user.PERM_HISTORY)
+	})
+}
+
+func TestMergeRequestParam(t *testing.T) {
+	Convey("url and body param", t, func() {
+		val, err := mergeRequestParam("DbName", "mysql1", "")
+		So(err, ShouldBeNil)
+		So(val, ShouldEqual, "mysql1")
+		val, err = mergeRequestParam("DbName", "", "mysql2")
+		So(err, ShouldBeNil)
+		So(val, ShouldEqual, "mysql2")
+		_, err = mergeRequestParam("DbName", "mysql1", "mysql2")
+		So(err, ShouldNotBeNil)
+
+		n, err := mergeRequestIntParam("ToServerId", "", 2)
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 2)
+		_, err = mergeRequestIntParam("ToServerId", "1", 2)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestGetRequestResourceToServerKey(t *testing.T) {
+	dbObj := server.AddNewDB("permissionTestDb", "mysql", inputDriver.InputInfo{}, 0)
+	// DelDB 要删除存储里的位点, 这里直接从列表里删除
+	defer func() {
+		server.DbLock.Lock()
+		delete(server.DbList, "permissionTestDb")
+		server.DbLock.Unlock()
+	}()
+	_, ChannelKey := dbObj.AddChannel("default", 1)
+	dbObj.AddTable("bifrost_test", "binlog_field_test", "", "", ChannelKey, 0)
+	table := dbObj.GetTable("bifrost_test", "binlog_field_test")
+	table.ToServerList = append(table.ToServerList,
+		&server.ToServer{ToServerID: 1, ToServerKey: "allowed"},
+		&server.ToServer{ToServerID: 2, ToServerKey: "denied"},
+	)
+
+	getResource := func(uri, body string) (requestResource, error) {
+		req := httptest.NewRequest(http.MethodPost, uri, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.ParseForm()
+		c := &CommonController{}
+		c.Ctx = &xgo.Context{Request: req}
+		return c.getRequestResource()
+	}
+
+	Convey("ToServerKey is resolved by ToServerId", t, func() {
+		res, err := getResource("/table/toserver/stop", `{"DbName":"permissionTestDb","SchemaName":"bifrost_test","TableName":"binlog_field_test","ToServerId":2,"Index":1}`)
+		So(err, ShouldBeNil)
+		So(res.ToServerKey, ShouldEqual, "denied")
+	})
+
+	Convey("mismatched ToServerKey and ToServerId", t, func() {
+		_, err := getResource("/table/toserver/stop", `{"DbName":"permissionTestDb","SchemaName":"bifrost_test","TableName":"binlog_field_test","ToServerKey":"allowed","ToServerId":2,"Index":1}`)
+		So(err, ShouldNotBeNil)
+
+		param := &TableToServerParam{DbName: "permissionTestDb", SchemaName: "bifrost_test", TableName: "binlog_field_test", ToServerKey: "allowed", ToServerId: 2, Index: 1}
+		_, err = param.getToServer(true)
+		So(err, ShouldNotBeNil)
+		param.ToServerKey = "denied"
+		toServer, err := param.getToServer(true)
+		So(err, ShouldBeNil)
+		So(toServer.ToServerID, ShouldEqual, 2)
+		param.Index = 0
+		_, err = param.getToServer(true)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("ToServerId in url and body is different", t, func() {
+		_, err := getResource("/table/toserver/stop?ToServerId=1", `{"DbName":"permissionTestDb","SchemaName":"bifrost_test","TableName":"binlog_field_test","ToServerId":2}`)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("ToServerId not exist", t, func() {
+		res, err := getResource("/table/toserver/stop", `{"DbName":"permissionTestDb","SchemaName":"bifrost_test","TableName":"binlog_field_test","ToServerKey":"allowed","ToServerId":3}`)
+		So(err, ShouldBeNil)
+		So(res.ToServerKey, ShouldEqual, "")
+	})
+}
@@ -0,0 +1,91 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/brokercap/Bifrost/server/user"
+)
+
+type RoleController struct {
+	CommonController
+}
+
+func (c *RoleController) getParam() *user.Role {
+	body, err := ioutil.ReadAll(c.Ctx.Request.Body)
+	if err != nil {
+		result := ResultDataStruct{Status: 0, Msg: err.Error(), Data: nil}
+		c.SetJsonData(result)
+		c.StopServeJSON()
+		return nil
+	}
+	var data user.Role
+	if err = json.Unmarshal(body, &data); err != nil {
+		result := ResultDataStruct{Status: 0, Msg: err.Error(), Data: nil}
+		c.SetJsonData(result)
+		c.StopServeJSON()
+		return nil
+	}
+	return &data
+}
+
+func (c *RoleController) Index() {
+	c.SetData("RoleList", user.GetRoleList())
+	c.SetData("PermActionList", user.PermActionList)
+	c.SetTitle("RoleList")
+	c.AddAdminTemplate("role.list.html", "header.html", "footer.html")
+}
+
+func (c *RoleController) List() {
+	c.SetJsonData(user.GetRoleList())
+	c.StopServeJSON()
+}
+
+func (c *RoleController) Update() {
+	param := c.getParam()
+	result := ResultDataStruct{Status: 0, Msg: "error", Data: nil}
+	defer func() {
+		c.SetJsonData(result)
+		c.StopServeJSON()
+	}()
+	err := user.UpdateRole(*param)
+	if err != nil {
+		result.Msg = err.Error()
+	} else {
+		result = ResultDataStruct{Status: 1, Msg: "success", Data: nil}
+	}
+}
+
+func (c *RoleController) Delete() {
+	param := c.getParam()
+	result := ResultDataStruct{Status: 0, Msg: "error", Data: nil}
+	defer func() {
+		c.SetJsonData(result)
+		c.StopServeJSON()
+	}()
+	if param.Name == "" {
+		result.Msg = " role name not empty!"
+		return
+	}
+	err := user.DelRole(param.Name)
+	if err != nil {
+		result.Msg = err.Error()
+	} else {
+		result = ResultDataStruct{Status: 1, Msg: "success", Data: nil}
+	}
+}
@@ -18,6 +18,7 @@ package controller
 import (
 	pluginStorage "github.com/brokercap/Bifrost/plugin/storage"
 	"github.com/brokercap/Bifrost/server"
+	"github.com/brokercap/Bifrost/server/user"
 )
 
 type TableSyncController struct {
@@ -87,6 +88,12 @@ func (c *TableSyncController) getList() syncListResult {
 	} else {
 		syncList = get_syncList_all(ChannelID)
 	}
+	// 去掉没有查看权限的库
+	for i := len(syncList) - 1; i >= 0; i-- {
+		if !c.canView(user.Resource{DbName: syncList[i].DbName, SchemaName: syncList[i].SchemaName}) {
+			syncList = append(syncList[:i], syncList[i+1:]...)
+		}
+	}
 
 	//假如传了 toserverkey 参数，则将 非 toserverkey 的列表给过滤掉
 	ToServerKey := c.Ctx.Request.Form.Get("ToServerKey")
@@ -170,7 +177,7 @@ func (c *TableSyncController) getList() syncListResult {
 		SyncStatus:      SyncStatus,
 		SyncList:        syncList,
 		ChannelID:       ChannelID,
-		DbList:          server.GetListDb(),
+		DbList:          c.filterDbList(server.GetListDb()),
 		ToServerKeyList: pluginStorage.ToServerMap,
 		ChannelList:     ChannelList,
 	}
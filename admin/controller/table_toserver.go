@@ -17,9 +17,16 @@ package controller
 
 import (
 	"encoding/json"
+	"fmt"
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
 	pluginStorage "github.com/brokercap/Bifrost/plugin/storage"
 	"github.com/brokercap/Bifrost/server"
+	"github.com/brokercap/Bifrost/server/history"
+	"github.com/brokercap/Bifrost/server/rowfilter"
+	"github.com/brokercap/Bifrost/server/transform"
 	"io/ioutil"
+	"strings"
+	"time"
 )
 
 type TableToServerController struct {
@@ -36,9 +43,17 @@ type TableToServerParam struct {
 	MustBeSuccess bool
 	FilterQuery   bool
 	FilterUpdate  bool
+	RowFilter     string
+	Transforms    []*transform.Rule
 	PluginParam   map[string]interface{}
 	ToServerId    int
 	Index         int
+	// 失败重试多少次之后写入死信, 0 为不开启
+	DeadLetterRetry int
+	// 添加之后立即做一次一致性快照全量, 全量完成后再从快照位点开始增量同步
+	Snapshot           bool
+	SnapshotTableNames string // 要全量的表名, 用 ; 隔开, 为空则为 TableName, 模糊匹配的表必须填写
+	SnapshotProperty   history.HistoryProperty
 }
 
 func (c *TableToServerController) getParam() *TableToServerParam {
@@ -78,30 +93,130 @@ func (c *TableToServerController) Add() {
 		c.SetJsonData(result)
 		c.StopServeJSON()
 	}()
+	ToServerId, HistoryId, err := addTableToServer(param)
+	if err != nil {
+		result.Msg = err.Error()
+		if ToServerId > 0 {
+			result.Data = ToServerId
+		}
+		return
+	}
+	result = ResultDataStruct{Status: 1, Msg: "success", Data: ToServerId}
+	if param.Snapshot {
+		result.Msg = fmt.Sprintf("success, snapshot history id:%d", HistoryId)
+	}
+}
 
+// 添加同步配置, v1 和 v2 接口共用
+// 开启了 Snapshot 但是全量任务启动失败的时候, 同步配置已经添加并且是暂停状态, 返回的 ToServerId > 0
+func addTableToServer(param *TableToServerParam) (ToServerId int, HistoryId int, err error) {
 	if pluginStorage.GetToServerInfo(param.ToServerKey) == nil {
-		result.Msg = param.ToServerKey + "not exsit"
-		return
+		return 0, 0, fmt.Errorf(param.ToServerKey + "not exsit")
+	}
+	if _, err = rowfilter.Parse(param.RowFilter); err != nil {
+		return 0, 0, fmt.Errorf("RowFilter error:" + err.Error())
+	}
+	if err = transform.Check(param.Transforms); err != nil {
+		return 0, 0, fmt.Errorf("Transforms error:" + err.Error())
+	}
+	if param.DeadLetterRetry < 0 {
+		return 0, 0, fmt.Errorf("DeadLetterRetry can't be less than 0")
 	}
 	toServer := &server.ToServer{
-		MustBeSuccess: param.MustBeSuccess,
-		FilterQuery:   param.FilterQuery,
-		FilterUpdate:  param.FilterUpdate,
-		ToServerKey:   param.ToServerKey,
-		PluginName:    param.PluginName,
-		FieldList:     param.FieldList,
-		PluginParam:   param.PluginParam,
+		MustBeSuccess:   param.MustBeSuccess,
+		FilterQuery:     param.FilterQuery,
+		FilterUpdate:    param.FilterUpdate,
+		ToServerKey:     param.ToServerKey,
+		PluginName:      param.PluginName,
+		FieldList:       param.FieldList,
+		RowFilter:       param.RowFilter,
+		Transforms:      param.Transforms,
+		DeadLetterRetry: param.DeadLetterRetry,
+		PluginParam:     param.PluginParam,
 	}
 	SchemaName := tansferSchemaName(param.SchemaName)
 	TableName := tansferTableName(param.TableName)
+	if param.Snapshot {
+		if err = checkSnapshotParam(param, SchemaName, TableName); err != nil {
+			return 0, 0, err
+		}
+		// 先暂停, 增量数据堆积在队列里, 等全量完成之后再开始同步
+		toServer.Status = server.STOPPED
+	}
 	dbObj := server.GetDBObj(param.DbName)
+	if dbObj == nil {
+		return 0, 0, fmt.Errorf(param.DbName + " not exsit")
+	}
 	r, ToServerId := dbObj.AddTableToServer(SchemaName, TableName, toServer)
-	if r == true {
-		defer server.SaveDBConfigInfo()
-		result = ResultDataStruct{Status: 1, Msg: "success", Data: ToServerId}
-	} else {
-		result.Msg = "unkown error"
+	if r != true {
+		return 0, 0, fmt.Errorf("unkown error")
+	}
+	defer server.SaveDBConfigInfo()
+	if !param.Snapshot {
+		return ToServerId, 0, nil
 	}
+	HistoryId, err = history.AddHistory(param.DbName, SchemaName, TableName, param.SnapshotTableNames, param.SnapshotProperty, []int{ToServerId})
+	if err == nil {
+		err = history.Start(param.DbName, HistoryId)
+	}
+	if err != nil {
+		return ToServerId, 0, fmt.Errorf("ToServerId:%d is added and stopped, but start snapshot err:%s", ToServerId, err.Error())
+	}
+	return ToServerId, HistoryId, nil
+}
+
+func checkSnapshotParam(param *TableToServerParam, SchemaName, TableName string) error {
+	if err := history.CheckSnapshot(param.DbName); err != nil {
+		return err
+	}
+	if SchemaName == "*" {
+		return fmt.Errorf("不能给 AllDataBases 添加全量任务!")
+	}
+	if param.SnapshotTableNames == "" {
+		if strings.Contains(TableName, "*") {
+			return fmt.Errorf("SnapshotTableNames can't be empty")
+		}
+		param.SnapshotTableNames = TableName
+	}
+	param.SnapshotProperty.Snapshot = true
+	if param.SnapshotProperty.ThreadNum <= 0 {
+		param.SnapshotProperty.ThreadNum = 1
+	}
+	if param.SnapshotProperty.ThreadCountPer <= 0 {
+		param.SnapshotProperty.ThreadCountPer = 1000
+	}
+	if param.SnapshotProperty.Where != "" {
+		for _, tableNameTest := range strings.Split(param.SnapshotTableNames, ";") {
+			if tableNameTest == "" {
+				continue
+			}
+			if err := history.CheckWhere(param.DbName, SchemaName, tableNameTest, param.SnapshotProperty.Where); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// 按 ToServerId 找到要操作的同步配置, checkIndex 为 true 的时候 Index 也必须一致
+func (param *TableToServerParam) getToServer(checkIndex bool) (*server.ToServer, error) {
+	dbObj := server.GetDBObj(param.DbName)
+	if dbObj == nil {
+		return nil, fmt.Errorf(param.DbName + " not exsit")
+	}
+	t := dbObj.GetTableSelf(tansferSchemaName(param.SchemaName), tansferTableName(param.TableName))
+	if t == nil {
+		return nil, fmt.Errorf("table not exsit")
+	}
+	index, toServer, err := findTableToServer(t, param.ToServerId, param.ToServerKey)
+	if err != nil {
+		return nil, err
+	}
+	if toServer == nil || (checkIndex && index != param.Index) {
+		return nil, fmt.Errorf("ToServerId:%d not exsit", param.ToServerId)
+	}
+	return toServer, nil
 }
 
 func (c *TableToServerController) Delete() {
@@ -112,6 +227,10 @@ func (c *TableToServerController) Delete() {
 		c.StopServeJSON()
 	}()
 
+	if _, err := param.getToServer(false); err != nil {
+		result.Msg = err.Error()
+		return
+	}
 	SchemaName := tansferSchemaName(param.SchemaName)
 	TableName := tansferTableName(param.TableName)
 
@@ -128,13 +247,12 @@ func (c *TableToServerController) DealError() {
 		c.StopServeJSON()
 	}()
 
-	SchemaName := tansferSchemaName(param.SchemaName)
-	TableName := tansferTableName(param.TableName)
-	t := server.GetDBObj(param.DbName).GetTableSelf(SchemaName, TableName)
-	ToServerInfo := t.ToServerList[param.Index]
-	if ToServerInfo != nil && ToServerInfo.ToServerID == param.ToServerId {
-		ToServerInfo.DealWaitError()
+	ToServerInfo, err := param.getToServer(true)
+	if err != nil {
+		result = ResultDataStruct{Status: 0, Msg: err.Error(), Data: nil}
+		return
 	}
+	ToServerInfo.DealWaitError()
 }
 
 func (c *TableToServerController) Stop() {
@@ -145,13 +263,12 @@ func (c *TableToServerController) Stop() {
 		c.StopServeJSON()
 	}()
 
-	SchemaName := tansferSchemaName(param.SchemaName)
-	TableName := tansferTableName(param.TableName)
-	t := server.GetDBObj(param.DbName).GetTableSelf(SchemaName, TableName)
-	ToServerInfo := t.ToServerList[param.Index]
-	if ToServerInfo != nil && ToServerInfo.ToServerID == param.ToServerId {
-		ToServerInfo.Stop()
+	ToServerInfo, err := param.getToServer(true)
+	if err != nil {
+		result = ResultDataStruct{Status: 0, Msg: err.Error(), Data: nil}
+		return
 	}
+	ToServerInfo.Stop()
 }
 
 func (c *TableToServerController) Start() {
@@ -162,11 +279,55 @@ func (c *TableToServerController) Start() {
 		c.StopServeJSON()
 	}()
 
-	SchemaName := tansferSchemaName(param.SchemaName)
-	TableName := tansferTableName(param.TableName)
-	t := server.GetDBObj(param.DbName).GetTableSelf(SchemaName, TableName)
-	ToServerInfo := t.ToServerList[param.Index]
-	if ToServerInfo != nil && ToServerInfo.ToServerID == param.ToServerId {
-		ToServerInfo.Start()
+	ToServerInfo, err := param.getToServer(true)
+	if err != nil {
+		result = ResultDataStruct{Status: 0, Msg: err.Error(), Data: nil}
+		return
+	}
+	ToServerInfo.Start()
+}
+
+type TransformPreviewParam struct {
+	SchemaName string
+	TableName  string
+	EventType  string
+	Transforms []*transform.Rule
+	Row        map[string]interface{}
+}
+
+// 用一行样例数据预览字段转换之后的结果
+func (c *TableToServerController) TransformPreview() {
+	result := ResultDataStruct{Status: 0, Msg: "error", Data: nil}
+	defer func() {
+		c.SetJsonData(result)
+		c.StopServeJSON()
+	}()
+	body, err := ioutil.ReadAll(c.Ctx.Request.Body)
+	if err != nil {
+		result.Msg = err.Error()
+		return
+	}
+	var param TransformPreviewParam
+	if err = json.Unmarshal(body, &param); err != nil {
+		result.Msg = err.Error()
+		return
+	}
+	if err = transform.Check(param.Transforms); err != nil {
+		result.Msg = err.Error()
+		return
+	}
+	if param.EventType == "" {
+		param.EventType = "insert"
+	}
+	data := &pluginDriver.PluginDataType{
+		Timestamp:       uint32(time.Now().Unix()),
+		EventType:       param.EventType,
+		Rows:            []map[string]interface{}{param.Row},
+		SchemaName:      param.SchemaName,
+		TableName:       param.TableName,
+		AliasSchemaName: param.SchemaName,
+		AliasTableName:  param.TableName,
 	}
+	newData := transform.Transform(param.Transforms, data)
+	result = ResultDataStruct{Status: 1, Msg: "success", Data: newData.Rows[0]}
 }
@@ -0,0 +1,183 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"encoding/json"
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	"github.com/brokercap/Bifrost/server"
+	"github.com/brokercap/Bifrost/server/deadletter"
+	"io/ioutil"
+	"strconv"
+)
+
+type DeadLetterParam struct {
+	DbName     string
+	SchemaName string
+	TableName  string
+	ToServerId int
+	Id         int64
+	All        bool                         // 删除的时候, 为 true 则删除这个同步配置的所有死信
+	Data       *pluginDriver.PluginDataType // 修改后的数据, 为空则用原来的数据
+}
+
+func (This *DeadLetterParam) toServerKey() deadletter.ToServerKey {
+	return deadletter.ToServerKey{
+		DbName:     This.DbName,
+		SchemaName: tansferSchemaName(This.SchemaName),
+		TableName:  tansferTableName(This.TableName),
+		ToServerID: This.ToServerId,
+	}
+}
+
+func (c *TableToServerController) getDeadLetterParam() (*DeadLetterParam, error) {
+	var param DeadLetterParam
+	if c.Ctx.Request.Method == "GET" {
+		param.DbName = c.Ctx.Request.Form.Get("DbName")
+		param.SchemaName = c.Ctx.Request.Form.Get("SchemaName")
+		param.TableName = c.Ctx.Request.Form.Get("TableName")
+		param.ToServerId, _ = strconv.Atoi(c.Ctx.Request.Form.Get("ToServerId"))
+		param.Id, _ = strconv.ParseInt(c.Ctx.Request.Form.Get("Id"), 10, 64)
+		return &param, nil
+	}
+	body, err := ioutil.ReadAll(c.Ctx.Request.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(body, &param); err != nil {
+		return nil, err
+	}
+	return &param, nil
+}
+
+// 死信列表, 不返回数据内容
+func (c *TableToServerController) DeadLetterList() {
+	result := ResultDataStruct{Status: 0, Msg: "error", Data: nil}
+	defer func() {
+		c.SetJsonData(result)
+		c.StopServeJSON()
+	}()
+	param, err := c.getDeadLetterParam()
+	if err != nil {
+		result.Msg = err.Error()
+		return
+	}
+	list := deadletter.List(param.toServerKey())
+	for _, entry := range list {
+		entry.Data = nil
+	}
+	result = ResultDataStruct{Status: 1, Msg: "success", Data: list}
+}
+
+func (c *TableToServerController) DeadLetterGet() {
+	result := ResultDataStruct{Status: 0, Msg: "error", Data: nil}
+	defer func() {
+		c.SetJsonData(result)
+		c.StopServeJSON()
+	}()
+	param, err := c.getDeadLetterParam()
+	if err != nil {
+		result.Msg = err.Error()
+		return
+	}
+	entry, err := deadletter.Get(param.toServerKey(), param.Id)
+	if err != nil {
+		result.Msg = err.Error()
+		return
+	}
+	result = ResultDataStruct{Status: 1, Msg: "success", Data: entry}
+}
+
+// 只修改死信的数据, 不重放
+func (c *TableToServerController) DeadLetterUpdate() {
+	result := ResultDataStruct{Status: 0, Msg: "error", Data: nil}
+	defer func() {
+		c.SetJsonData(result)
+		c.StopServeJSON()
+	}()
+	param, err := c.getDeadLetterParam()
+	if err != nil {
+		result.Msg = err.Error()
+		return
+	}
+	if param.Data == nil {
+		result.Msg = "Data can't be empty"
+		return
+	}
+	entry, err := deadletter.Get(param.toServerKey(), param.Id)
+	if err != nil {
+		result.Msg = err.Error()
+		return
+	}
+	entry.Data = param.Data
+	if err = deadletter.Update(entry); err != nil {
+		result.Msg = err.Error()
+		return
+	}
+	result = ResultDataStruct{Status: 1, Msg: "success", Data: param.Id}
+}
+
+// 重放死信, 传了 Data 则用修改后的数据重放, 成功后删除这条死信
+func (c *TableToServerController) DeadLetterReplay() {
+	result := ResultDataStruct{Status: 0, Msg: "error", Data: nil}
+	defer func() {
+		c.SetJsonData(result)
+		c.StopServeJSON()
+	}()
+	param, err := c.getDeadLetterParam()
+	if err != nil {
+		result.Msg = err.Error()
+		return
+	}
+	dbObj := server.GetDBObj(param.DbName)
+	if dbObj == nil {
+		result.Msg = param.DbName + " not exist"
+		return
+	}
+	key := param.toServerKey()
+	if err = dbObj.ReplayDeadLetter(key.SchemaName, key.TableName, key.ToServerID, param.Id, param.Data); err != nil {
+		result.Msg = err.Error()
+		return
+	}
+	result = ResultDataStruct{Status: 1, Msg: "success", Data: param.Id}
+}
+
+func (c *TableToServerController) DeadLetterDelete() {
+	result := ResultDataStruct{Status: 0, Msg: "error", Data: nil}
+	defer func() {
+		c.SetJsonData(result)
+		c.StopServeJSON()
+	}()
+	param, err := c.getDeadLetterParam()
+	if err != nil {
+		result.Msg = err.Error()
+		return
+	}
+	if param.All {
+		n, err := deadletter.Purge(param.toServerKey())
+		if err != nil {
+			result.Msg = err.Error()
+			return
+		}
+		result = ResultDataStruct{Status: 1, Msg: "success", Data: n}
+		return
+	}
+	if err = deadletter.Del(param.toServerKey(), param.Id); err != nil {
+		result.Msg = err.Error()
+		return
+	}
+	result = ResultDataStruct{Status: 1, Msg: "success", Data: 1}
+}
@@ -31,6 +31,7 @@ type UserParam struct {
 	Password string
 	Group    string
 	Host     string
+	Roles    []string
 }
 
 func (c *UserController) getParam() *UserParam {
@@ -58,6 +59,7 @@ func (c *UserController) Index() {
 		UserList[k].Password = ""
 	}
 	c.SetData("UserList", UserList)
+	c.SetData("RoleList", user.GetRoleList())
 	c.SetTitle("UserList")
 	c.AddAdminTemplate("user.list.html", "header.html", "footer.html")
 }
@@ -89,7 +91,7 @@ func (c *UserController) Update() {
 			return
 		}
 	}
-	err := user.UpdateUser(param.UserName, param.Password, param.Group, param.Host)
+	err := user.UpdateUser(param.UserName, param.Password, param.Group, param.Host, param.Roles)
 	if err != nil {
 		result.Msg = err.Error()
 	} else {
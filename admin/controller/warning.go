@@ -54,6 +54,8 @@ func (c *WarningController) getParam() *WarningParam {
 func (c *WarningController) Index() {
 	c.SetTitle("Warning Config List")
 	c.SetData("WaringConfigList", warning.GetWarningConfigList())
+	c.SetData("WarningRuleList", warning.GetWarningRuleList())
+	c.SetData("WarningRuleTypeList", warning.GetRuleTypeList())
 	c.AddAdminTemplate("warning.config.list.html", "header.html", "footer.html")
 }
 
@@ -117,3 +119,76 @@ func (c *WarningController) Delete() {
 	warning.DelWarningConfig(id)
 	result = ResultDataStruct{Status: 1, Msg: "success", Data: nil}
 }
+
+func (c *WarningController) getRuleParam() *warning.WarningRule {
+	body, err := ioutil.ReadAll(c.Ctx.Request.Body)
+	if err != nil {
+		result := ResultDataStruct{Status: 0, Msg: err.Error(), Data: nil}
+		c.SetJsonData(result)
+		c.StopServeJSON()
+		return nil
+	}
+	var data warning.WarningRule
+	if err = json.Unmarshal(body, &data); err != nil {
+		result := ResultDataStruct{Status: 0, Msg: err.Error(), Data: nil}
+		c.SetJsonData(result)
+		c.StopServeJSON()
+		return nil
+	}
+	return &data
+}
+
+func (c *WarningController) RuleList() {
+	result := ResultDataStruct{Status: 1, Msg: "success", Data: warning.GetWarningRuleList()}
+	c.SetJsonData(result)
+	c.StopServeJSON()
+}
+
+func (c *WarningController) RuleAdd() {
+	param := c.getRuleParam()
+	result := ResultDataStruct{Status: 0, Msg: "error", Data: nil}
+	defer func() {
+		c.SetJsonData(result)
+		c.StopServeJSON()
+	}()
+	id, err := warning.AddNewWarningRule(*param)
+	if err != nil {
+		result.Msg = err.Error()
+	} else {
+		result = ResultDataStruct{Status: 1, Msg: "success", Data: id}
+	}
+}
+
+func (c *WarningController) RuleUpdate() {
+	param := c.getRuleParam()
+	result := ResultDataStruct{Status: 0, Msg: "error", Data: nil}
+	defer func() {
+		c.SetJsonData(result)
+		c.StopServeJSON()
+	}()
+	err := warning.UpdateWarningRule(*param)
+	if err != nil {
+		result.Msg = err.Error()
+	} else {
+		result = ResultDataStruct{Status: 1, Msg: "success", Data: param.Id}
+	}
+}
+
+func (c *WarningController) RuleDelete() {
+	param := c.getRuleParam()
+	result := ResultDataStruct{Status: 0, Msg: "error", Data: nil}
+	defer func() {
+		c.SetJsonData(result)
+		c.StopServeJSON()
+	}()
+	if param.Id <= 0 {
+		result.Msg = "Id error"
+		return
+	}
+	err := warning.DelWarningRule(param.Id)
+	if err != nil {
+		result.Msg = err.Error()
+	} else {
+		result = ResultDataStruct{Status: 1, Msg: "success", Data: param.Id}
+	}
+}
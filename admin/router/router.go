@@ -26,6 +26,9 @@ func init() {
 	xgo.Router("/serverMonitor", &controller.IndexController{}, "*:ServerMonitor")
 	xgo.Router("/freeOSMemory", &controller.IndexController{}, "*:FreeOSMemory")
 
+	// prometheus
+	xgo.Router("/metrics", &controller.MetricsController{}, "GET:Index")
+
 	// pprof
 	xgo.Router("/debug/pprof/", &controller.PprofController{}, "*:Default")
 	xgo.Router("/debug/pprof/allocs", &controller.PprofController{}, "*:Default")
@@ -89,8 +92,22 @@ func init() {
 	xgo.Router("/history/del", &controller.HistoryController{}, "POST,DELETE:Delete")
 	xgo.Router("/history/start", &controller.HistoryController{}, "POST:Start")
 	xgo.Router("/history/stop", &controller.HistoryController{}, "POST:Stop")
+	xgo.Router("/history/resume", &controller.HistoryController{}, "POST:Resume")
 	xgo.Router("/history/kill", &controller.HistoryController{}, "POST:Kill")
 	xgo.Router("/history/check_where", &controller.HistoryController{}, "POST:CheckWhere")
+	xgo.Router("/history/incremental/list", &controller.HistoryController{}, "*:IncrementalSnapshotList")
+	xgo.Router("/history/incremental/add", &controller.HistoryController{}, "POST,PUT:IncrementalSnapshotAdd")
+	xgo.Router("/history/incremental/start", &controller.HistoryController{}, "POST:IncrementalSnapshotStart")
+	xgo.Router("/history/incremental/stop", &controller.HistoryController{}, "POST:IncrementalSnapshotStop")
+	xgo.Router("/history/incremental/del", &controller.HistoryController{}, "POST,DELETE:IncrementalSnapshotDelete")
+	xgo.Router("/history/incremental/pause", &controller.HistoryController{}, "POST:IncrementalSnapshotPause")
+	xgo.Router("/history/incremental/resume", &controller.HistoryController{}, "POST:IncrementalSnapshotResume")
+	xgo.Router("/history/verify/list", &controller.HistoryController{}, "*:VerifyList")
+	xgo.Router("/history/verify/add", &controller.HistoryController{}, "POST,PUT:VerifyAdd")
+	xgo.Router("/history/verify/detail", &controller.HistoryController{}, "POST:VerifyDetail")
+	xgo.Router("/history/verify/start", &controller.HistoryController{}, "POST:VerifyStart")
+	xgo.Router("/history/verify/stop", &controller.HistoryController{}, "POST:VerifyStop")
+	xgo.Router("/history/verify/del", &controller.HistoryController{}, "POST,DELETE:VerifyDelete")
 
 	//user
 	xgo.Router("/user/index", &controller.UserController{}, "*:Index")
@@ -99,10 +116,18 @@ func init() {
 	xgo.Router("/user/del", &controller.UserController{}, "POST,DELETE:Delete")
 	xgo.Router("/user/login/log", &controller.UserController{}, "*:LastLoginLog")
 
+	//role
+	xgo.Router("/role/index", &controller.RoleController{}, "*:Index")
+	xgo.Router("/role/list", &controller.RoleController{}, "*:List")
+	xgo.Router("/role/update", &controller.RoleController{}, "POST:Update")
+	xgo.Router("/role/del", &controller.RoleController{}, "POST,DELETE:Delete")
+
 	//login
 	xgo.Router("/login/index", &controller.LoginController{}, "*:Index")
 	xgo.Router("/dologin", &controller.LoginController{}, "POST:Login")
 	xgo.Router("/logout", &controller.LoginController{}, "*:Logout")
+	xgo.Router("/login/oidc", &controller.LoginController{}, "GET:OIDCLogin")
+	xgo.Router("/login/oidc/callback", &controller.LoginController{}, "GET:OIDCCallback")
 
 	//table
 	xgo.Router("/table/list", &controller.TableController{}, "*:List")
@@ -117,6 +142,12 @@ func init() {
 	xgo.Router("/table/toserver/stop", &controller.TableToServerController{}, "POST:Stop")
 	xgo.Router("/table/toserver/deal", &controller.TableToServerController{}, "POST:DealError")
 	xgo.Router("/table/toserver/del", &controller.TableToServerController{}, "POST,DELETE:Delete")
+	xgo.Router("/table/toserver/transform/preview", &controller.TableToServerController{}, "POST:TransformPreview")
+	xgo.Router("/table/toserver/deadletter/list", &controller.TableToServerController{}, "*:DeadLetterList")
+	xgo.Router("/table/toserver/deadletter/get", &controller.TableToServerController{}, "*:DeadLetterGet")
+	xgo.Router("/table/toserver/deadletter/update", &controller.TableToServerController{}, "POST:DeadLetterUpdate")
+	xgo.Router("/table/toserver/deadletter/replay", &controller.TableToServerController{}, "POST:DeadLetterReplay")
+	xgo.Router("/table/toserver/deadletter/del", &controller.TableToServerController{}, "POST,DELETE:DeadLetterDelete")
 
 	//table sync
 	xgo.Router("/table/synclist/index", &controller.TableSyncController{}, "*:Index")
@@ -136,6 +167,10 @@ func init() {
 	xgo.Router("/warning/config/add", &controller.WarningController{}, "POST,PUT:Add")
 	xgo.Router("/warning/config/del", &controller.WarningController{}, "POST,DELETE:Delete")
 	xgo.Router("/warning/config/check", &controller.WarningController{}, "POST:Check")
+	xgo.Router("/warning/rule/list", &controller.WarningController{}, "*:RuleList")
+	xgo.Router("/warning/rule/add", &controller.WarningController{}, "POST,PUT:RuleAdd")
+	xgo.Router("/warning/rule/update", &controller.WarningController{}, "POST:RuleUpdate")
+	xgo.Router("/warning/rule/del", &controller.WarningController{}, "POST,DELETE:RuleDelete")
 
 	//file queue
 	xgo.Router("/table/toserver/filequeue/update", &controller.FileQueueController{}, "POST:Update")
@@ -154,4 +189,9 @@ func init() {
 
 	//input plugin
 	xgo.Router("/plugin/input/list", &controller.InputController{}, "*:List")
+
+	// api v2, 路由定义在 controller/apiv2_route.go
+	for _, route := range controller.GetAPIV2RouteList() {
+		xgo.Router(route.Path, &controller.APIV2Controller{}, route.Method+":"+route.Action)
+	}
 }
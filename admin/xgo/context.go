@@ -25,6 +25,7 @@ type Context struct {
 	Request        *http.Request
 	ResponseWriter http.ResponseWriter
 	Session        *SessionMgr
+	Params         map[string]string // 路由里的参数
 }
 
 func (ctx *Context) GetParamInt64(key string, defaultVal ...int64) (int64, error) {
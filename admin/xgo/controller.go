@@ -67,6 +67,9 @@ type ControllerInterface interface {
 
 func (c *Controller) Init(ctx *Context, controllerName, actionName string) {
 	ctx.Request.ParseForm()
+	for k, v := range ctx.Params {
+		ctx.Request.Form.Set(k, v)
+	}
 	c.Ctx = ctx
 	c.Data = make(map[string]interface{}, 0)
 	c.ControllerName = controllerName
@@ -142,7 +145,10 @@ func (c *Controller) NormalStop() {
 			break
 		}
 	}
-	c.Ctx.ResponseWriter.WriteHeader(200)
+	// OTHER_TYPE 由 action 自己输出,已经写过 header 了
+	if c.Format != OTHER_TYPE {
+		c.Ctx.ResponseWriter.WriteHeader(200)
+	}
 	switch c.Format {
 	case JSON_TYPE:
 		var body []byte
@@ -18,6 +18,7 @@ package xgo
 import (
 	"log"
 	"net/http"
+	"net/url"
 	"reflect"
 	"runtime/debug"
 	"strings"
@@ -28,6 +29,8 @@ type routeController struct {
 	controllerName string
 	funName        string
 	methodMap      map[string]bool
+	methodFunMap   map[string]string // 同一个路由不同的请求方式对应不同的方法, 比如 GET:List;POST:Add
+	pattern        []string          // 带参数的路由按 / 拆开, 比如 /api/v2/dbs/{DbName}
 }
 
 func NewRouteController(controllerType reflect.Type, controllerName string, funName string, methodMap map[string]bool) *routeController {
@@ -47,6 +50,21 @@ func (route *routeController) AddMethod(methodName string) *routeController {
 	return route
 }
 
+func (route *routeController) addMethodFun(methodName string, funName string) *routeController {
+	if route.methodFunMap == nil {
+		route.methodFunMap = make(map[string]string, 0)
+	}
+	route.methodFunMap[strings.ToUpper(methodName)] = funName
+	return route.AddMethod(methodName)
+}
+
+func (route *routeController) getFunName(methodName string) string {
+	if funName, ok := route.methodFunMap[strings.ToUpper(methodName)]; ok {
+		return funName
+	}
+	return route.funName
+}
+
 func (route *routeController) CheckMethod(methodName string) bool {
 	if route.methodMap == nil {
 		return false
@@ -61,37 +79,81 @@ func (route *routeController) CheckMethod(methodName string) bool {
 	return false
 }
 
-func (route *routeController) DoController(w http.ResponseWriter, req *http.Request) {
+// 路由参数的值, 比如 /api/v2/dbs/{DbName} 里的 DbName
+func (route *routeController) matchPattern(path string) (params map[string]string, ok bool) {
+	arr := strings.Split(path, "/")
+	if len(arr) != len(route.pattern) {
+		return nil, false
+	}
+	params = make(map[string]string, 0)
+	for i, v := range route.pattern {
+		if strings.HasPrefix(v, "{") && strings.HasSuffix(v, "}") {
+			val, err := url.PathUnescape(arr[i])
+			if err != nil || val == "" {
+				return nil, false
+			}
+			params[v[1:len(v)-1]] = val
+			continue
+		}
+		if v != arr[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+func (route *routeController) DoController(w http.ResponseWriter, req *http.Request, params map[string]string) {
 	defer func() {
 		if err := recover(); err != nil {
 			if err == ErrAbort {
 				return
 			} else {
 				log.Println("xgo doController:", err, string(debug.Stack()))
+				writeStatus(w, req.URL.Path, http.StatusInternalServerError)
 			}
 		}
 	}()
 	if route.CheckMethod(req.Method) {
-		route.DoController0(w, req)
+		route.DoController0(w, req, params)
+	} else {
+		writeStatus(w, req.URL.Path, http.StatusMethodNotAllowed)
 	}
 }
 
-func (route *routeController) DoController0(w http.ResponseWriter, req *http.Request) {
+// 只有 StatusRoutePrefix 下的路由返回 404, 405 等状态码, 其他路由和以前一样返回空内容
+var StatusRoutePrefix = "/api/v2/"
+
+func writeStatus(w http.ResponseWriter, path string, code int) {
+	if strings.HasPrefix(path, StatusRoutePrefix) {
+		w.WriteHeader(code)
+	}
+}
+
+func (route *routeController) DoController0(w http.ResponseWriter, req *http.Request, params map[string]string) {
+	funName := route.getFunName(req.Method)
 	vc := reflect.New(route.controllerType)
 	execController := vc.Interface().(ControllerInterface)
-	execController.Init(&Context{Request: req, ResponseWriter: w, Session: sessionMgr}, route.controllerName, route.funName)
+	execController.Init(&Context{Request: req, ResponseWriter: w, Session: sessionMgr, Params: params}, route.controllerName, funName)
 	execController.Prepare()
 	t := reflect.ValueOf(execController)
-	t.MethodByName(route.funName).Call(nil)
+	t.MethodByName(funName).Call(nil)
 	execController.NormalStop()
 }
 
 var routeMap map[string]*routeController
 
+// 带参数的路由, 按添加的顺序匹配
+var patternRouteList []*routeController
+
+// 已经注册到 http 的路径, 同一个路径不能重复注册
+var handlePathMap map[string]bool
+
 func init() {
 	routeMap = make(map[string]*routeController, 0)
+	handlePathMap = make(map[string]bool, 0)
 }
 
+// route 里可以带参数, 比如 /api/v2/dbs/{DbName}, 参数的值和 url 参数一样通过 Request.Form 获取
 func Router(route string, c ControllerInterface, FunNames string) error {
 	var ok bool
 	reflectVal := reflect.ValueOf(c)
@@ -111,11 +173,23 @@ func Router(route string, c ControllerInterface, FunNames string) error {
 		for _, method := range strings.Split(Arr[0], ",") {
 			if _, ok = routeMap[route]; !ok {
 				routeMap[route] = NewRouteController(t, t.Name(), Arr[1], make(map[string]bool, 0))
+				if i := strings.Index(route, "{"); i > 0 {
+					routeMap[route].pattern = strings.Split(route, "/")
+					patternRouteList = append(patternRouteList, routeMap[route])
+				}
 			}
-			routeMap[route].AddMethod(method)
+			routeMap[route].addMethodFun(method, Arr[1])
 		}
 	}
-	http.HandleFunc(route, rounteFunc)
+	handlePath := route
+	// 带参数的路由, 注册参数前面的目录
+	if i := strings.Index(route, "{"); i > 0 {
+		handlePath = route[0:i]
+	}
+	if !handlePathMap[handlePath] {
+		handlePathMap[handlePath] = true
+		http.HandleFunc(handlePath, rounteFunc)
+	}
 	return nil
 }
 
@@ -133,13 +207,20 @@ func rounteFunc(w http.ResponseWriter, req *http.Request) {
 		route = req.RequestURI
 	}
 	var ok bool
-	if _, ok = routeMap[route]; !ok {
-		if strings.Index(route, "/favicon.ico") == -1 {
-			log.Printf("route:%s 404", route)
-		}
+	if _, ok = routeMap[route]; ok && routeMap[route].pattern == nil {
+		routeMap[route].DoController(w, req, nil)
 		return
 	}
-	routeMap[route].DoController(w, req)
+	for _, r := range patternRouteList {
+		if params, ok := r.matchPattern(route); ok {
+			r.DoController(w, req, params)
+			return
+		}
+	}
+	if strings.Index(route, "/favicon.ico") == -1 {
+		log.Printf("route:%s 404", route)
+	}
+	writeStatus(w, route, http.StatusNotFound)
 }
 
 func AddStaticRoute(route string, dir string) {
@@ -0,0 +1,74 @@
+package xgo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type testPatternController struct {
+	Controller
+}
+
+func (c *testPatternController) Get() {
+	c.SetJsonData("get:" + c.Ctx.Request.Form.Get("Name") + ":" + c.Ctx.Request.Form.Get("Id"))
+	c.StopServeJSON()
+}
+
+func (c *testPatternController) Del() {
+	c.SetJsonData("del:" + c.Ctx.Request.Form.Get("Name") + ":" + c.Ctx.Request.Form.Get("Id"))
+	c.StopServeJSON()
+}
+
+func (c *testPatternController) List() {
+	c.SetJsonData("list")
+	c.StopServeJSON()
+}
+
+func doTestRequest(method, uri string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	rounteFunc(w, httptest.NewRequest(method, uri, nil))
+	return w
+}
+
+func TestPatternRouter(t *testing.T) {
+	Router("/api/v2/xgo_test/items", &testPatternController{}, "GET:List")
+	Router("/api/v2/xgo_test/items/{Name}/ids/{Id}", &testPatternController{}, "GET:Get")
+	Router("/api/v2/xgo_test/items/{Name}/ids/{Id}", &testPatternController{}, "DELETE:Del")
+
+	Convey("static route", t, func() {
+		w := doTestRequest("GET", "/api/v2/xgo_test/items")
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(w.Body.String(), ShouldEqual, `"list"`)
+	})
+
+	Convey("pattern route params and method", t, func() {
+		w := doTestRequest("GET", "/api/v2/xgo_test/items/a%2Fb/ids/12?Id=1")
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(w.Body.String(), ShouldEqual, `"get:a/b:12"`)
+
+		w = doTestRequest("DELETE", "/api/v2/xgo_test/items/test/ids/3")
+		So(w.Body.String(), ShouldEqual, `"del:test:3"`)
+
+		w = doTestRequest("POST", "/api/v2/xgo_test/items/test/ids/3")
+		So(w.Code, ShouldEqual, http.StatusMethodNotAllowed)
+	})
+
+	Convey("not found", t, func() {
+		So(doTestRequest("GET", "/api/v2/xgo_test/items/test").Code, ShouldEqual, http.StatusNotFound)
+		So(doTestRequest("GET", "/api/v2/xgo_test/items/test/ids/3/more").Code, ShouldEqual, http.StatusNotFound)
+		So(doTestRequest("GET", "/api/v2/xgo_test/items/test/ids/").Code, ShouldEqual, http.StatusNotFound)
+	})
+
+	Convey("v1 route not found and method not allowed return empty", t, func() {
+		Router("/xgo_test/v1/items", &testPatternController{}, "GET:List")
+		w := doTestRequest("POST", "/xgo_test/v1/items")
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(w.Body.String(), ShouldEqual, "")
+		w = doTestRequest("GET", "/xgo_test/v1/not_exist")
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(w.Body.String(), ShouldEqual, "")
+	})
+}
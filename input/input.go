@@ -5,5 +5,6 @@ import (
 	_ "github.com/brokercap/Bifrost/input/mock"
 	_ "github.com/brokercap/Bifrost/input/mongo"
 	_ "github.com/brokercap/Bifrost/input/mysql"
+	_ "github.com/brokercap/Bifrost/input/postgres"
 	_ "github.com/brokercap/Bifrost/input/prometheus"
 )
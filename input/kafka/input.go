@@ -88,6 +88,7 @@ func (c *InputKafka) GetUriExample() (string, string) {
 	<p><span class="help-block m-b-none">string_kafka: 将kafka中整条数据作为一个key进行处理</span></p>
 	<p><span class="help-block m-b-none">canal_kafka: 支持将kafka中canal的json数据进行解析</span></p>
 	<p><span class="help-block m-b-none">bifrost_kafka: 支持解析bifrost写入到kafka中的json数据</span></p>
+	<p><span class="help-block m-b-none">bifrost_protobuf_kafka,bifrost_msgpack_kafka: 支持解析bifrost以protobuf,msgpack格式写入到kafka中的数据</span></p>
 	<p><span class="help-block m-b-none" style="color:#F00">如果新增了 Topic 等同步，需要手工进行对数据源 进行 Start 一次</span></p>
 `
 	return "127.0.0.1:9092,192.168.1.10/[topic_name1,topic_name2]][?client.id=&from.beginning=false]", notesHtml
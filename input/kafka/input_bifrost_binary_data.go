@@ -0,0 +1,69 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package kafka
+
+import (
+	"github.com/Shopify/sarama"
+	inputDriver "github.com/brokercap/Bifrost/input/driver"
+	outputDriver "github.com/brokercap/Bifrost/plugin/driver"
+)
+
+// 解析 bifrost 以 protobuf,msgpack 格式写入到 kafka 中的数据，字段值的类型和写入前保持一致
+
+func init() {
+	inputDriver.Register("bifrost_protobuf_kafka", NewBifrostProtobufDataInput, VERSION, BIFROST_VERSION)
+	inputDriver.Register("bifrost_msgpack_kafka", NewBifrostMsgpackDataInput, VERSION, BIFROST_VERSION)
+}
+
+type BifrostBinaryDataInput struct {
+	InputKafka
+	decoder func(b []byte) (*outputDriver.PluginDataType, error)
+}
+
+func NewBifrostProtobufDataInput() inputDriver.Driver {
+	return newBifrostBinaryDataInput(outputDriver.NewPluginDataTypeByProtobuf)
+}
+
+func NewBifrostMsgpackDataInput() inputDriver.Driver {
+	return newBifrostBinaryDataInput(outputDriver.NewPluginDataTypeByMsgpack)
+}
+
+func newBifrostBinaryDataInput(decoder func(b []byte) (*outputDriver.PluginDataType, error)) *BifrostBinaryDataInput {
+	c := &BifrostBinaryDataInput{decoder: decoder}
+	c.Init()
+	c.childCallBack = c.CallBack
+	return c
+}
+
+func (c *BifrostBinaryDataInput) CallBack(kafkaMsg *sarama.ConsumerMessage) error {
+	if c.callback == nil {
+		return nil
+	}
+	var data *outputDriver.PluginDataType
+	data, c.err = c.decoder(kafkaMsg.Value)
+	if c.err != nil {
+		return c.err
+	}
+	data.Gtid = c.SetTopicPartitionOffsetAndReturnGTID(kafkaMsg)
+	data.EventSize = uint32(len(kafkaMsg.Value))
+	data.BinlogFileNum = 1
+	data.BinlogPosition = 0
+	data.EventID = c.getNextEventID()
+	data.AliasSchemaName = kafkaMsg.Topic
+	data.AliasTableName = c.FormatPartitionTableName(kafkaMsg.Partition)
+	c.ToInputCallback(data)
+	return nil
+}
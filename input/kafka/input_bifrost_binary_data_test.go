@@ -0,0 +1,86 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package kafka
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func getBifrostBinaryTestData() *pluginDriver.PluginDataType {
+	return &pluginDriver.PluginDataType{
+		Timestamp:     1665857191,
+		EventType:     "insert",
+		SchemaName:    "bifrost_test",
+		TableName:     "binlog_field_test",
+		Pri:           []string{"id"},
+		ColumnMapping: map[string]string{"id": "int8", "name": "Nullable(varchar(20))", "tags": "set('x','y')"},
+		Rows: []map[string]interface{}{
+			{"id": int8(1), "name": "bifrost", "tags": []string{"x", "y"}},
+		},
+	}
+}
+
+func TestBifrostBinaryDataInput_CallBack(t *testing.T) {
+	encoders := map[string]func(data *pluginDriver.PluginDataType) ([]byte, error){
+		"protobuf": (*pluginDriver.PluginDataType).ToProtobuf,
+		"msgpack":  (*pluginDriver.PluginDataType).ToMsgpack,
+	}
+	inputs := map[string]func() *BifrostBinaryDataInput{
+		"protobuf": func() *BifrostBinaryDataInput {
+			return NewBifrostProtobufDataInput().(*BifrostBinaryDataInput)
+		},
+		"msgpack": func() *BifrostBinaryDataInput {
+			return NewBifrostMsgpackDataInput().(*BifrostBinaryDataInput)
+		},
+	}
+	for name, encoder := range encoders {
+		Convey(name+" callback normal", t, func() {
+			var callbackData = make([]*pluginDriver.PluginDataType, 0)
+			c := inputs[name]()
+			c.callback = func(data *pluginDriver.PluginDataType) {
+				callbackData = append(callbackData, data)
+			}
+			value, err := encoder(getBifrostBinaryTestData())
+			So(err, ShouldBeNil)
+			err = c.CallBack(&sarama.ConsumerMessage{Topic: "topic1", Partition: 2, Offset: 10, Value: value})
+			So(err, ShouldBeNil)
+			So(len(callbackData), ShouldEqual, 2)
+			data := callbackData[0]
+			So(data.EventType, ShouldEqual, "insert")
+			So(data.SchemaName, ShouldEqual, "bifrost_test")
+			So(data.Rows, ShouldResemble, getBifrostBinaryTestData().Rows)
+			So(data.AliasSchemaName, ShouldEqual, "topic1")
+			So(data.AliasTableName, ShouldEqual, c.FormatPartitionTableName(2))
+			So(callbackData[1].EventType, ShouldEqual, "commit")
+		})
+
+		Convey(name+" callback decoder err", t, func() {
+			c := inputs[name]()
+			c.callback = func(data *pluginDriver.PluginDataType) {}
+			err := c.CallBack(&sarama.ConsumerMessage{Value: []byte{0xff, 0xff}})
+			So(err, ShouldNotBeNil)
+		})
+	}
+
+	Convey("callback nil", t, func() {
+		c := inputs["protobuf"]()
+		So(c.CallBack(nil), ShouldBeNil)
+	})
+}
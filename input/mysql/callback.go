@@ -65,6 +65,8 @@ func (c *MysqlInput) MySQLCallback(data *mysql.EventReslut) {
 		Pri:             data.Pri,
 		ColumnMapping:   data.ColumnMapping,
 		EventID:         data.EventID,
+		PayloadIndex:    data.PayloadIndex,
+		PresentColumns:  data.PresentColumns,
 	}
 	c.callback(data0)
 }
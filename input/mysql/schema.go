@@ -253,13 +253,15 @@ func (c *MysqlInput) CheckUri(CheckPrivilege bool) (CheckUriResult inputDriver.C
 			case "full":
 				break
 			default:
-				Msg = append(Msg, fmt.Sprintf("binlog_row_image(%s) != full", binlogRowImage))
+				// MINIMAL,NOBLOB 的时候，行数据里只有部分字段，只有 MySQL,ClickHouse,ElasticSearch,MongoDB 等插件支持只更新存在的字段
+				Msg = append(Msg, fmt.Sprintf("binlog_row_image(%s) != full, row data only contains part of columns, only plugins(mysql,clickhouse,elasticsearch,mongodb) support update present columns", binlogRowImage))
 			}
 			CheckUriResult.BinlogRowImage = binlogRowImage
 		}
 	} else {
 		err = fmt.Errorf("The binlog maybe not open,or no replication client privilege(s).you can show log more.")
 	}
+	CheckUriResult.Msg = Msg
 	MasterVersion := GetMySQLVersion(dbconn)
 	if strings.Contains(MasterVersion, "MariaDB") {
 		m := GetVariables(dbconn, "gtid_binlog_pos")
@@ -0,0 +1,387 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package postgres
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	outputDriver "github.com/brokercap/Bifrost/plugin/driver"
+	"github.com/jackc/pglogrepl"
+)
+
+// postgresql 内置类型的 oid, select oid,typname from pg_type
+const (
+	BoolOID        uint32 = 16
+	ByteaOID       uint32 = 17
+	Int8OID        uint32 = 20
+	Int2OID        uint32 = 21
+	Int4OID        uint32 = 23
+	TextOID        uint32 = 25
+	OIDOID         uint32 = 26
+	JSONOID        uint32 = 114
+	Float4OID      uint32 = 700
+	Float8OID      uint32 = 701
+	BPCharOID      uint32 = 1042
+	VarcharOID     uint32 = 1043
+	DateOID        uint32 = 1082
+	TimeOID        uint32 = 1083
+	TimestampOID   uint32 = 1114
+	TimestamptzOID uint32 = 1184
+	NumericOID     uint32 = 1700
+	JSONBOID       uint32 = 3802
+)
+
+func (c *PostgresInput) consumeXLogData(xld *pglogrepl.XLogData) error {
+	msg, err := ParsePgOutputMessage(xld.WALData)
+	if err != nil {
+		log.Printf("[ERROR] input[%s] %s lsn:%s parse pgoutput message err:%+v \n", OutPutName, c.inputInfo.DbName, FormatLSN(uint64(xld.WALStart)), err)
+		return err
+	}
+	switch m := msg.(type) {
+	case *pglogrepl.RelationMessage:
+		c.relations[m.RelationID] = m
+	case *pglogrepl.BeginMessage:
+		c.commitTime = m.CommitTime
+		c.lastData = nil
+	case *pglogrepl.CommitMessage:
+		if c.lastData != nil {
+			commitEvent := c.BuildCommitEvent(c.lastData)
+			commitEvent.Gtid = FormatLSN(uint64(m.TransactionEndLSN))
+			c.lastData = nil
+			c.ToInputCallback(commitEvent)
+		}
+		// 就算事务里没有需要同步的表,位点也要往前走
+		c.setLastLSN(uint64(m.TransactionEndLSN), uint32(m.CommitTime.Unix()))
+	case *pglogrepl.InsertMessage:
+		return c.consumeRowEvent(c.BuildInsertEvent(m, uint64(xld.WALStart)))
+	case *pglogrepl.UpdateMessage:
+		return c.consumeRowEvent(c.BuildUpdateEvent(m, uint64(xld.WALStart)))
+	case *pglogrepl.DeleteMessage:
+		return c.consumeRowEvent(c.BuildDeleteEvent(m, uint64(xld.WALStart)))
+	case *pglogrepl.TruncateMessage:
+		for _, relationID := range m.RelationIDs {
+			data, err := c.BuildTruncateEvent(relationID, uint64(xld.WALStart))
+			if err != nil {
+				return err
+			}
+			c.consumeRowEvent(data, nil)
+		}
+	}
+	return nil
+}
+
+func (c *PostgresInput) consumeRowEvent(data *outputDriver.PluginDataType, err error) error {
+	if err != nil {
+		return err
+	}
+	if !c.CheckReplicateDb(data.SchemaName, data.TableName) {
+		return nil
+	}
+	data.EventID = c.getNextEventID()
+	c.lastData = data
+	c.ToInputCallback(data)
+	return nil
+}
+
+func (c *PostgresInput) ToInputCallback(data *outputDriver.PluginDataType) {
+	if c.callback == nil {
+		return
+	}
+	c.callback(data)
+}
+
+func (c *PostgresInput) getRelation(relationID uint32) (*pglogrepl.RelationMessage, error) {
+	relation, ok := c.relations[relationID]
+	if !ok {
+		return nil, fmt.Errorf("relation id:%d not found", relationID)
+	}
+	return relation, nil
+}
+
+func (c *PostgresInput) BuildInsertEvent(m *pglogrepl.InsertMessage, lsn uint64) (*outputDriver.PluginDataType, error) {
+	relation, err := c.getRelation(m.RelationID)
+	if err != nil {
+		return nil, err
+	}
+	row, presentColumns := c.TupleToRow(relation, m.Tuple, false)
+	data := c.newRowEvent(relation, "insert", lsn)
+	data.Rows = []map[string]interface{}{row}
+	if presentColumns != nil {
+		data.PresentColumns = [][]string{presentColumns}
+	}
+	return data, nil
+}
+
+func (c *PostgresInput) BuildUpdateEvent(m *pglogrepl.UpdateMessage, lsn uint64) (*outputDriver.PluginDataType, error) {
+	relation, err := c.getRelation(m.RelationID)
+	if err != nil {
+		return nil, err
+	}
+	newRow, newPresentColumns := c.TupleToRow(relation, m.NewTuple, false)
+	var oldRow map[string]interface{}
+	var oldPresentColumns []string
+	switch m.OldTupleType {
+	case pglogrepl.UpdateMessageTupleTypeOld:
+		oldRow, oldPresentColumns = c.TupleToRow(relation, m.OldTuple, false)
+	default:
+		// 没有旧数据或者只有主键旧数据的时候,用新数据补全,主键被修改的时候再用旧的主键覆盖
+		oldRow = make(map[string]interface{}, len(newRow))
+		for k, v := range newRow {
+			oldRow[k] = v
+		}
+		oldPresentColumns = newPresentColumns
+		if m.OldTupleType == pglogrepl.UpdateMessageTupleTypeKey {
+			keyRow, _ := c.TupleToRow(relation, m.OldTuple, true)
+			for k, v := range keyRow {
+				oldRow[k] = v
+			}
+		}
+	}
+	data := c.newRowEvent(relation, "update", lsn)
+	data.Rows = []map[string]interface{}{oldRow, newRow}
+	if oldPresentColumns != nil || newPresentColumns != nil {
+		data.PresentColumns = [][]string{oldPresentColumns, newPresentColumns}
+	}
+	return data, nil
+}
+
+func (c *PostgresInput) BuildDeleteEvent(m *pglogrepl.DeleteMessage, lsn uint64) (*outputDriver.PluginDataType, error) {
+	relation, err := c.getRelation(m.RelationID)
+	if err != nil {
+		return nil, err
+	}
+	// REPLICA IDENTITY DEFAULT 的时候只有主键字段
+	row, presentColumns := c.TupleToRow(relation, m.OldTuple, m.OldTupleType == pglogrepl.DeleteMessageTupleTypeKey)
+	data := c.newRowEvent(relation, "delete", lsn)
+	data.Rows = []map[string]interface{}{row}
+	if presentColumns != nil {
+		data.PresentColumns = [][]string{presentColumns}
+	}
+	return data, nil
+}
+
+func (c *PostgresInput) BuildTruncateEvent(relationID uint32, lsn uint64) (*outputDriver.PluginDataType, error) {
+	relation, err := c.getRelation(relationID)
+	if err != nil {
+		return nil, err
+	}
+	sql := fmt.Sprintf("TRUNCATE TABLE %s", relation.RelationName)
+	data := c.newRowEvent(relation, "sql", lsn)
+	data.EventSize = uint32(len(sql))
+	data.Query = sql
+	data.Pri = nil
+	data.ColumnMapping = nil
+	return data, nil
+}
+
+func (c *PostgresInput) newRowEvent(relation *pglogrepl.RelationMessage, eventType string, lsn uint64) *outputDriver.PluginDataType {
+	var pri []string
+	for i := range relation.Columns {
+		if isKeyColumn(relation.Columns[i]) {
+			pri = append(pri, relation.Columns[i].Name)
+		}
+	}
+	return &outputDriver.PluginDataType{
+		Timestamp:       uint32(c.commitTime.Unix()),
+		EventSize:       0,
+		EventType:       eventType,
+		SchemaName:      relation.Namespace,
+		TableName:       relation.RelationName,
+		AliasSchemaName: relation.Namespace,
+		AliasTableName:  relation.RelationName,
+		BinlogFileNum:   1,
+		BinlogPosition:  0,
+		Gtid:            FormatLSN(lsn),
+		Pri:             pri,
+		ColumnMapping:   c.GetColumnMapping(relation),
+	}
+}
+
+func (c *PostgresInput) BuildCommitEvent(data *outputDriver.PluginDataType) *outputDriver.PluginDataType {
+	return &outputDriver.PluginDataType{
+		Timestamp:       data.Timestamp,
+		EventSize:       5,
+		EventType:       "commit",
+		Rows:            nil,
+		Query:           "",
+		SchemaName:      data.SchemaName,
+		TableName:       data.TableName,
+		AliasSchemaName: data.AliasSchemaName,
+		AliasTableName:  data.AliasTableName,
+		BinlogFileNum:   1,
+		BinlogPosition:  0,
+		Gtid:            data.Gtid,
+		Pri:             nil,
+		EventID:         c.getNextEventID(),
+	}
+}
+
+// 将 tuple 转成 map, unchanged toast 字段不在 map 里,这个时候会返回存在的字段列表,否则返回 nil 表示完整的行
+func (c *PostgresInput) TupleToRow(relation *pglogrepl.RelationMessage, tuple *pglogrepl.TupleData, onlyKey bool) (row map[string]interface{}, presentColumns []string) {
+	if tuple == nil {
+		return make(map[string]interface{}, 0), nil
+	}
+	row = make(map[string]interface{}, len(tuple.Columns))
+	var hasUnchanged bool
+	for i, column := range tuple.Columns {
+		if i >= len(relation.Columns) {
+			break
+		}
+		relationColumn := relation.Columns[i]
+		if onlyKey && !isKeyColumn(relationColumn) {
+			continue
+		}
+		switch column.DataType {
+		case pglogrepl.TupleDataTypeToast:
+			hasUnchanged = true
+			continue
+		case pglogrepl.TupleDataTypeNull:
+			row[relationColumn.Name] = nil
+		default:
+			row[relationColumn.Name] = TransferColumnValue(relationColumn.DataType, string(column.Data))
+		}
+	}
+	if hasUnchanged {
+		presentColumns = make([]string, 0, len(row))
+		for i := range relation.Columns {
+			if _, ok := row[relation.Columns[i].Name]; ok {
+				presentColumns = append(presentColumns, relation.Columns[i].Name)
+			}
+		}
+	}
+	return
+}
+
+// pgoutput 里所有值都是文本格式,按字段类型转成对应的 go 类型, 转换失败的保留原始字符串
+func TransferColumnValue(typeOID uint32, val string) interface{} {
+	switch typeOID {
+	case BoolOID:
+		return val == "t"
+	case Int2OID:
+		if v, err := strconv.ParseInt(val, 10, 16); err == nil {
+			return int16(v)
+		}
+	case Int4OID:
+		if v, err := strconv.ParseInt(val, 10, 32); err == nil {
+			return int32(v)
+		}
+	case Int8OID:
+		if v, err := strconv.ParseInt(val, 10, 64); err == nil {
+			return v
+		}
+	case OIDOID:
+		if v, err := strconv.ParseUint(val, 10, 32); err == nil {
+			return uint32(v)
+		}
+	case Float4OID:
+		if v, err := strconv.ParseFloat(val, 32); err == nil {
+			return float32(v)
+		}
+	case Float8OID:
+		if v, err := strconv.ParseFloat(val, 64); err == nil {
+			return v
+		}
+	case ByteaOID:
+		// 默认 bytea_output = hex, \x 开头
+		if strings.HasPrefix(val, `\x`) {
+			if v, err := hex.DecodeString(val[2:]); err == nil {
+				return string(v)
+			}
+		}
+	case TimestamptzOID:
+		// 带时区的时间转成本地时间,和 mysql timestamp 的表现一致
+		for _, layout := range []string{"2006-01-02 15:04:05.999999999-07", "2006-01-02 15:04:05.999999999-07:00", "2006-01-02 15:04:05.999999999-07:00:00"} {
+			if t, err := time.Parse(layout, val); err == nil {
+				return t.In(time.Local).Format("2006-01-02 15:04:05.999999")
+			}
+		}
+	}
+	return val
+}
+
+func (c *PostgresInput) GetColumnMapping(relation *pglogrepl.RelationMessage) map[string]string {
+	columnMapping := make(map[string]string, len(relation.Columns))
+	for i := range relation.Columns {
+		column := relation.Columns[i]
+		columnMappingType := GetColumnMappingType(column.DataType, column.TypeModifier)
+		// pgoutput 不会返回字段是否可以为 NULL, 除了主键外都认为可以为 NULL
+		if !isKeyColumn(column) {
+			columnMappingType = "Nullable(" + columnMappingType + ")"
+		}
+		columnMapping[column.Name] = columnMappingType
+	}
+	return columnMapping
+}
+
+// 转成和 mysql 一样的 ColumnMapping 类型
+func GetColumnMappingType(typeOID uint32, typeModifier int32) string {
+	switch typeOID {
+	case BoolOID:
+		return "bool"
+	case Int2OID:
+		return "int16"
+	case Int4OID:
+		return "int32"
+	case Int8OID:
+		return "int64"
+	case OIDOID:
+		return "uint32"
+	case Float4OID:
+		return "float"
+	case Float8OID:
+		return "double"
+	case NumericOID:
+		// typmod = (precision << 16 | scale) + 4
+		if typeModifier >= 4 {
+			typeModifier -= 4
+			return fmt.Sprintf("decimal(%d,%d)", (typeModifier>>16)&0xffff, typeModifier&0xffff)
+		}
+		return "string"
+	case VarcharOID:
+		if typeModifier >= 4 {
+			return fmt.Sprintf("varchar(%d)", typeModifier-4)
+		}
+		return "text"
+	case BPCharOID:
+		if typeModifier >= 4 {
+			return fmt.Sprintf("char(%d)", typeModifier-4)
+		}
+		return "char(1)"
+	case TextOID:
+		return "text"
+	case ByteaOID:
+		return "blob"
+	case JSONOID, JSONBOID:
+		return "json"
+	case DateOID:
+		return "date"
+	case TimeOID:
+		return "time"
+	case TimestampOID, TimestamptzOID:
+		if typeModifier > 0 {
+			return fmt.Sprintf("timestamp(%d)", typeModifier)
+		}
+		return "timestamp"
+	default:
+		return "string"
+	}
+}
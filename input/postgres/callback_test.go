@@ -0,0 +1,154 @@
+package postgres
+
+import (
+	"testing"
+
+	outputDriver "github.com/brokercap/Bifrost/plugin/driver"
+	"github.com/jackc/pglogrepl"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newTestRelation() *pglogrepl.RelationMessage {
+	return &pglogrepl.RelationMessage{
+		RelationID:   16385,
+		Namespace:    "public",
+		RelationName: "t1",
+		Columns: []*pglogrepl.RelationMessageColumn{
+			{Flags: 1, Name: "id", DataType: Int4OID, TypeModifier: -1},
+			{Name: "name", DataType: VarcharOID, TypeModifier: 24},
+			{Name: "price", DataType: NumericOID, TypeModifier: (10<<16 | 2) + 4},
+		},
+	}
+}
+
+func newTestPostgresInput() (c *PostgresInput, dataList *[]*outputDriver.PluginDataType) {
+	dataList = &[]*outputDriver.PluginDataType{}
+	c = &PostgresInput{relations: map[uint32]*pglogrepl.RelationMessage{}}
+	c.SetCallback(func(data *outputDriver.PluginDataType) {
+		*dataList = append(*dataList, data)
+	})
+	c.AddReplicateDoDb("public", "t1")
+	return
+}
+
+func TestGetColumnMappingType(t *testing.T) {
+	Convey("normal", t, func() {
+		So(GetColumnMappingType(Int4OID, -1), ShouldEqual, "int32")
+		So(GetColumnMappingType(VarcharOID, 24), ShouldEqual, "varchar(20)")
+		So(GetColumnMappingType(NumericOID, (10<<16|2)+4), ShouldEqual, "decimal(10,2)")
+		So(GetColumnMappingType(NumericOID, -1), ShouldEqual, "string")
+		So(GetColumnMappingType(TimestampOID, 3), ShouldEqual, "timestamp(3)")
+		So(GetColumnMappingType(JSONBOID, -1), ShouldEqual, "json")
+	})
+}
+
+func TestTransferColumnValue(t *testing.T) {
+	Convey("normal", t, func() {
+		So(TransferColumnValue(BoolOID, "t"), ShouldEqual, true)
+		So(TransferColumnValue(Int2OID, "-1"), ShouldEqual, int16(-1))
+		So(TransferColumnValue(Int8OID, "9223372036854775807"), ShouldEqual, int64(9223372036854775807))
+		So(TransferColumnValue(Float8OID, "1.5"), ShouldEqual, float64(1.5))
+		So(TransferColumnValue(ByteaOID, `\x4142`), ShouldEqual, "AB")
+		So(TransferColumnValue(NumericOID, "10.20"), ShouldEqual, "10.20")
+		So(TransferColumnValue(Int4OID, "abc"), ShouldEqual, "abc")
+	})
+}
+
+func TestPostgresInput_consumeXLogData(t *testing.T) {
+	relation := newTestRelation()
+	relationMsg := &pgOutputBuilder{}
+	relationMsg.byte('R').uint32(relation.RelationID).string(relation.Namespace).string(relation.RelationName).byte('d').uint16(3)
+	for _, column := range relation.Columns {
+		relationMsg.byte(column.Flags).string(column.Name).uint32(column.DataType).uint32(uint32(column.TypeModifier))
+	}
+
+	Convey("insert and commit", t, func() {
+		c, dataList := newTestPostgresInput()
+		So(c.consumeXLogData(&pglogrepl.XLogData{WALData: relationMsg.buf}), ShouldBeNil)
+		b := &pgOutputBuilder{}
+		b.byte('B').uint64(0x300).uint64(0).uint32(1)
+		So(c.consumeXLogData(&pglogrepl.XLogData{WALStart: 0x100, WALData: b.buf}), ShouldBeNil)
+		b = &pgOutputBuilder{}
+		b.byte('I').uint32(relation.RelationID).byte('N').uint16(3).text("1").text("bifrost").byte('n')
+		So(c.consumeXLogData(&pglogrepl.XLogData{WALStart: 0x200, WALData: b.buf}), ShouldBeNil)
+		b = &pgOutputBuilder{}
+		b.byte('C').byte(0).uint64(0x300).uint64(0x330).uint64(0)
+		So(c.consumeXLogData(&pglogrepl.XLogData{WALStart: 0x300, WALData: b.buf}), ShouldBeNil)
+
+		So(len(*dataList), ShouldEqual, 2)
+		data := (*dataList)[0]
+		So(data.EventType, ShouldEqual, "insert")
+		So(data.SchemaName, ShouldEqual, "public")
+		So(data.TableName, ShouldEqual, "t1")
+		So(data.Gtid, ShouldEqual, "0/200")
+		So(data.Pri, ShouldResemble, []string{"id"})
+		So(data.Rows[0]["id"], ShouldEqual, int32(1))
+		So(data.Rows[0]["name"], ShouldEqual, "bifrost")
+		So(data.Rows[0]["price"], ShouldBeNil)
+		So(data.ColumnMapping["id"], ShouldEqual, "int32")
+		So(data.ColumnMapping["name"], ShouldEqual, "Nullable(varchar(20))")
+		So((*dataList)[1].EventType, ShouldEqual, "commit")
+		So((*dataList)[1].Gtid, ShouldEqual, "0/330")
+		So(c.GetLastPosition().GTID, ShouldEqual, "0/330")
+	})
+
+	Convey("update with unchanged toast and key", t, func() {
+		c, dataList := newTestPostgresInput()
+		So(c.consumeXLogData(&pglogrepl.XLogData{WALData: relationMsg.buf}), ShouldBeNil)
+		b := &pgOutputBuilder{}
+		b.byte('U').uint32(relation.RelationID).byte('K').uint16(3).text("1").byte('n').byte('n')
+		b.byte('N').uint16(3).text("2").byte('u').text("1.00")
+		So(c.consumeXLogData(&pglogrepl.XLogData{WALStart: 0x200, WALData: b.buf}), ShouldBeNil)
+		So(len(*dataList), ShouldEqual, 1)
+		data := (*dataList)[0]
+		So(data.EventType, ShouldEqual, "update")
+		So(data.Rows[0]["id"], ShouldEqual, int32(1))
+		So(data.Rows[1]["id"], ShouldEqual, int32(2))
+		So(data.Rows[0]["price"], ShouldEqual, "1.00")
+		So(data.IsColumnPresent(1, "name"), ShouldBeFalse)
+		So(data.IsColumnPresent(1, "price"), ShouldBeTrue)
+	})
+
+	Convey("delete with key", t, func() {
+		c, dataList := newTestPostgresInput()
+		So(c.consumeXLogData(&pglogrepl.XLogData{WALData: relationMsg.buf}), ShouldBeNil)
+		b := &pgOutputBuilder{}
+		b.byte('D').uint32(relation.RelationID).byte('K').uint16(3).text("1").byte('n').byte('n')
+		So(c.consumeXLogData(&pglogrepl.XLogData{WALStart: 0x200, WALData: b.buf}), ShouldBeNil)
+		So(len(*dataList), ShouldEqual, 1)
+		So((*dataList)[0].Rows[0], ShouldResemble, map[string]interface{}{"id": int32(1)})
+	})
+
+	Convey("truncate", t, func() {
+		c, dataList := newTestPostgresInput()
+		So(c.consumeXLogData(&pglogrepl.XLogData{WALData: relationMsg.buf}), ShouldBeNil)
+		b := &pgOutputBuilder{}
+		b.byte('T').uint32(1).byte(0).uint32(relation.RelationID)
+		So(c.consumeXLogData(&pglogrepl.XLogData{WALStart: 0x200, WALData: b.buf}), ShouldBeNil)
+		So(len(*dataList), ShouldEqual, 1)
+		So((*dataList)[0].EventType, ShouldEqual, "sql")
+		So((*dataList)[0].Query, ShouldEqual, "TRUNCATE TABLE t1")
+	})
+
+	Convey("not replicate table", t, func() {
+		dataList := &[]*outputDriver.PluginDataType{}
+		c := &PostgresInput{relations: map[uint32]*pglogrepl.RelationMessage{}}
+		c.SetCallback(func(data *outputDriver.PluginDataType) {
+			*dataList = append(*dataList, data)
+		})
+		c.AddReplicateDoDb("public", "t2")
+		So(c.consumeXLogData(&pglogrepl.XLogData{WALData: relationMsg.buf}), ShouldBeNil)
+		b := &pgOutputBuilder{}
+		b.byte('I').uint32(relation.RelationID).byte('N').uint16(3).text("1").text("bifrost").byte('n')
+		So(c.consumeXLogData(&pglogrepl.XLogData{WALStart: 0x200, WALData: b.buf}), ShouldBeNil)
+		So(len(*dataList), ShouldEqual, 0)
+	})
+
+	Convey("relation not found", t, func() {
+		c, _ := newTestPostgresInput()
+		b := &pgOutputBuilder{}
+		b.byte('I').uint32(1).byte('N').uint16(1).text("1")
+		So(c.consumeXLogData(&pglogrepl.XLogData{WALStart: 0x200, WALData: b.buf}), ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,138 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgproto3/v2"
+)
+
+// 流复制协议通过 pgconn 和 pglogrepl 实现
+// https://www.postgresql.org/docs/current/protocol-replication.html
+
+// pgconn 不能并发读写, standby status 在读取消息的协程里按时间间隔发送
+type replicationConn struct {
+	conn *pgconn.PgConn
+}
+
+func newReplicationConn(ctx context.Context, cfg *Config) (*replicationConn, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	conn, err := pgconn.Connect(ctx, cfg.ReplicationDSN())
+	if err != nil {
+		return nil, err
+	}
+	return &replicationConn{conn: conn}, nil
+}
+
+// 创建 pgoutput 的逻辑复制槽,已经存在则忽略
+func (c *replicationConn) CreateReplicationSlot(ctx context.Context, slotName string) error {
+	_, err := pglogrepl.CreateReplicationSlot(ctx, c.conn, quoteIdent(slotName), "pgoutput", pglogrepl.CreateReplicationSlotOptions{
+		Mode:           pglogrepl.LogicalReplication,
+		SnapshotAction: "NOEXPORT_SNAPSHOT",
+	})
+	if err != nil {
+		// 42710 duplicate_object
+		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == "42710" {
+			return nil
+		}
+	}
+	return err
+}
+
+func (c *replicationConn) StartReplication(ctx context.Context, slotName string, startLSN uint64, publication string) error {
+	return pglogrepl.StartReplication(ctx, c.conn, quoteIdent(slotName), pglogrepl.LSN(startLSN), pglogrepl.StartReplicationOptions{
+		Mode: pglogrepl.LogicalReplication,
+		PluginArgs: []string{
+			"proto_version '1'",
+			"publication_names '" + strings.Replace(publication, "'", "''", -1) + "'",
+		},
+	})
+}
+
+// 读取复制流里的下一条消息,返回 *pglogrepl.XLogData 或者 *pglogrepl.PrimaryKeepaliveMessage
+// ctx 超时的时候返回 nil, nil
+func (c *replicationConn) ReceiveMessage(ctx context.Context) (interface{}, error) {
+	msg, err := c.conn.ReceiveMessage(ctx)
+	if err != nil {
+		if pgconn.Timeout(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	switch m := msg.(type) {
+	case *pgproto3.CopyData:
+		return parseCopyData(m.Data)
+	case *pgproto3.ErrorResponse:
+		return nil, pgconn.ErrorResponseToPgError(m)
+	case *pgproto3.CopyDone:
+		return nil, fmt.Errorf("replication stream closed by server")
+	default:
+		return nil, nil
+	}
+}
+
+func parseCopyData(data []byte) (interface{}, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("copy data is empty")
+	}
+	switch data[0] {
+	case pglogrepl.XLogDataByteID:
+		xld, err := pglogrepl.ParseXLogData(data[1:])
+		if err != nil {
+			return nil, err
+		}
+		return &xld, nil
+	case pglogrepl.PrimaryKeepaliveMessageByteID:
+		pkm, err := pglogrepl.ParsePrimaryKeepaliveMessage(data[1:])
+		if err != nil {
+			return nil, err
+		}
+		return &pkm, nil
+	default:
+		return nil, fmt.Errorf("copy data type:%c not support", data[0])
+	}
+}
+
+// 告诉 postgresql 已经确认过的位点, flush 之前的 wal 才能被 postgresql 回收
+// pglogrepl 在 flushed 为 0 的时候会用 written 代替, 还没有确认过位点的时候 written 也传 0, 否则没有同步成功的数据也会被确认
+func (c *replicationConn) SendStandbyStatus(ctx context.Context, written, flushed uint64) error {
+	if flushed == 0 {
+		written = 0
+	}
+	return pglogrepl.SendStandbyStatusUpdate(ctx, c.conn, pglogrepl.StandbyStatusUpdate{
+		WALWritePosition: pglogrepl.LSN(written),
+		WALFlushPosition: pglogrepl.LSN(flushed),
+		WALApplyPosition: pglogrepl.LSN(flushed),
+	})
+}
+
+func (c *replicationConn) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return c.conn.Close(ctx)
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
@@ -0,0 +1,37 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/jackc/pglogrepl"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseCopyData(t *testing.T) {
+	Convey("xlog data", t, func() {
+		b := &pgOutputBuilder{}
+		b.byte('w').uint64(0x200).uint64(0x300).uint64(0).byte('B')
+		msg, err := parseCopyData(b.buf)
+		So(err, ShouldBeNil)
+		xld := msg.(*pglogrepl.XLogData)
+		So(uint64(xld.WALStart), ShouldEqual, 0x200)
+		So(xld.WALData, ShouldResemble, []byte{'B'})
+	})
+
+	Convey("keepalive", t, func() {
+		b := &pgOutputBuilder{}
+		b.byte('k').uint64(0x300).uint64(0).byte(1)
+		msg, err := parseCopyData(b.buf)
+		So(err, ShouldBeNil)
+		So(msg.(*pglogrepl.PrimaryKeepaliveMessage).ReplyRequested, ShouldBeTrue)
+	})
+
+	Convey("error", t, func() {
+		_, err := parseCopyData(nil)
+		So(err, ShouldNotBeNil)
+		_, err = parseCopyData([]byte{'x'})
+		So(err, ShouldNotBeNil)
+		_, err = parseCopyData([]byte{'w', 0})
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,27 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package postgres
+
+const DefaultBinlogFileName = "bifrost.000001"
+const DefaultBinlogPosition = 0
+
+// 连接串中没有指定 slot_name 和 publication 的时候使用的默认值
+const DefaultSlotName = "bifrost_slot"
+const DefaultPublicationName = "bifrost_publication"
+
+// 多久给 postgresql 回复一次 standby status,超过 wal_sender_timeout(默认60s) 会被断开连接
+const StandbyStatusInterval = 10
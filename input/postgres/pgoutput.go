@@ -0,0 +1,54 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package postgres
+
+import (
+	"fmt"
+
+	"github.com/jackc/pglogrepl"
+)
+
+// pgoutput 逻辑复制消息通过 pglogrepl 解析, 只支持 proto_version 1
+// https://www.postgresql.org/docs/current/protocol-logicalrep-message-formats.html
+
+// 字段是否是 replica identity 的一部分,一般就是主键
+func isKeyColumn(column *pglogrepl.RelationMessageColumn) bool {
+	return column.Flags&1 == 1
+}
+
+// 返回的是 pglogrepl 的各个 *XXXMessage, 不关心的消息类型(Origin,Type)返回 nil
+// pglogrepl 解析数据不完整的消息的时候会 panic, 这里转成 error
+func ParsePgOutputMessage(data []byte) (msg pglogrepl.Message, err error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("pgoutput message is empty")
+	}
+	switch pglogrepl.MessageType(data[0]) {
+	case pglogrepl.MessageTypeOrigin, pglogrepl.MessageTypeType:
+		return nil, nil
+	case pglogrepl.MessageTypeBegin, pglogrepl.MessageTypeCommit, pglogrepl.MessageTypeRelation,
+		pglogrepl.MessageTypeInsert, pglogrepl.MessageTypeUpdate, pglogrepl.MessageTypeDelete, pglogrepl.MessageTypeTruncate:
+		break
+	default:
+		return nil, fmt.Errorf("pgoutput message type:%c not support", data[0])
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			msg, err = nil, fmt.Errorf("pgoutput message type:%c parse err:%v", data[0], r)
+		}
+	}()
+	return pglogrepl.Parse(data)
+}
@@ -0,0 +1,152 @@
+package postgres
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/jackc/pglogrepl"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type pgOutputBuilder struct {
+	buf []byte
+}
+
+func (b *pgOutputBuilder) byte(v byte) *pgOutputBuilder {
+	b.buf = append(b.buf, v)
+	return b
+}
+
+func (b *pgOutputBuilder) uint16(v uint16) *pgOutputBuilder {
+	b.buf = binary.BigEndian.AppendUint16(b.buf, v)
+	return b
+}
+
+func (b *pgOutputBuilder) uint32(v uint32) *pgOutputBuilder {
+	b.buf = binary.BigEndian.AppendUint32(b.buf, v)
+	return b
+}
+
+func (b *pgOutputBuilder) uint64(v uint64) *pgOutputBuilder {
+	b.buf = binary.BigEndian.AppendUint64(b.buf, v)
+	return b
+}
+
+func (b *pgOutputBuilder) string(v string) *pgOutputBuilder {
+	b.buf = append(append(b.buf, v...), 0)
+	return b
+}
+
+func (b *pgOutputBuilder) text(v string) *pgOutputBuilder {
+	b.byte('t').uint32(uint32(len(v)))
+	b.buf = append(b.buf, v...)
+	return b
+}
+
+func TestParsePgOutputMessage(t *testing.T) {
+	Convey("relation", t, func() {
+		b := &pgOutputBuilder{}
+		b.byte('R').uint32(16385).string("public").string("t1").byte('d').uint16(2)
+		b.byte(1).string("id").uint32(Int4OID).uint32(0xFFFFFFFF)
+		b.byte(0).string("name").uint32(VarcharOID).uint32(24)
+		msg, err := ParsePgOutputMessage(b.buf)
+		So(err, ShouldBeNil)
+		m := msg.(*pglogrepl.RelationMessage)
+		So(m.RelationID, ShouldEqual, 16385)
+		So(m.Namespace, ShouldEqual, "public")
+		So(m.RelationName, ShouldEqual, "t1")
+		So(len(m.Columns), ShouldEqual, 2)
+		So(isKeyColumn(m.Columns[0]), ShouldBeTrue)
+		So(m.Columns[0].TypeModifier, ShouldEqual, -1)
+		So(m.Columns[1].Name, ShouldEqual, "name")
+		So(isKeyColumn(m.Columns[1]), ShouldBeFalse)
+	})
+
+	Convey("begin and commit", t, func() {
+		b := &pgOutputBuilder{}
+		b.byte('B').uint64(0x200).uint64(1000000).uint32(735)
+		msg, err := ParsePgOutputMessage(b.buf)
+		So(err, ShouldBeNil)
+		So(msg.(*pglogrepl.BeginMessage).FinalLSN, ShouldEqual, 0x200)
+		So(msg.(*pglogrepl.BeginMessage).Xid, ShouldEqual, 735)
+		So(msg.(*pglogrepl.BeginMessage).CommitTime.Unix(), ShouldEqual, time.Date(2000, 1, 1, 0, 0, 1, 0, time.UTC).Unix())
+
+		b = &pgOutputBuilder{}
+		b.byte('C').byte(0).uint64(0x200).uint64(0x230).uint64(0)
+		msg, err = ParsePgOutputMessage(b.buf)
+		So(err, ShouldBeNil)
+		So(msg.(*pglogrepl.CommitMessage).TransactionEndLSN, ShouldEqual, 0x230)
+	})
+
+	Convey("insert", t, func() {
+		b := &pgOutputBuilder{}
+		b.byte('I').uint32(16385).byte('N').uint16(2).text("1").byte('n')
+		msg, err := ParsePgOutputMessage(b.buf)
+		So(err, ShouldBeNil)
+		m := msg.(*pglogrepl.InsertMessage)
+		So(len(m.Tuple.Columns), ShouldEqual, 2)
+		So(string(m.Tuple.Columns[0].Data), ShouldEqual, "1")
+		So(m.Tuple.Columns[1].DataType, ShouldEqual, pglogrepl.TupleDataTypeNull)
+	})
+
+	Convey("update with key", t, func() {
+		b := &pgOutputBuilder{}
+		b.byte('U').uint32(16385).byte('K').uint16(2).text("1").byte('n')
+		b.byte('N').uint16(2).text("2").byte('u')
+		msg, err := ParsePgOutputMessage(b.buf)
+		So(err, ShouldBeNil)
+		m := msg.(*pglogrepl.UpdateMessage)
+		So(m.OldTupleType, ShouldEqual, pglogrepl.UpdateMessageTupleTypeKey)
+		So(string(m.OldTuple.Columns[0].Data), ShouldEqual, "1")
+		So(string(m.NewTuple.Columns[0].Data), ShouldEqual, "2")
+		So(m.NewTuple.Columns[1].DataType, ShouldEqual, pglogrepl.TupleDataTypeToast)
+	})
+
+	Convey("update without old tuple", t, func() {
+		b := &pgOutputBuilder{}
+		b.byte('U').uint32(16385).byte('N').uint16(1).text("2")
+		msg, err := ParsePgOutputMessage(b.buf)
+		So(err, ShouldBeNil)
+		So(msg.(*pglogrepl.UpdateMessage).OldTupleType, ShouldEqual, pglogrepl.UpdateMessageTupleTypeNone)
+		So(msg.(*pglogrepl.UpdateMessage).OldTuple, ShouldBeNil)
+	})
+
+	Convey("delete", t, func() {
+		b := &pgOutputBuilder{}
+		b.byte('D').uint32(16385).byte('O').uint16(2).text("1").text("bifrost")
+		msg, err := ParsePgOutputMessage(b.buf)
+		So(err, ShouldBeNil)
+		m := msg.(*pglogrepl.DeleteMessage)
+		So(m.OldTupleType, ShouldEqual, pglogrepl.DeleteMessageTupleTypeOld)
+		So(string(m.OldTuple.Columns[1].Data), ShouldEqual, "bifrost")
+	})
+
+	Convey("truncate", t, func() {
+		b := &pgOutputBuilder{}
+		b.byte('T').uint32(2).byte(0).uint32(16385).uint32(16386)
+		msg, err := ParsePgOutputMessage(b.buf)
+		So(err, ShouldBeNil)
+		So(msg.(*pglogrepl.TruncateMessage).RelationIDs, ShouldResemble, []uint32{16385, 16386})
+	})
+
+	Convey("origin and type ignore", t, func() {
+		msg, err := ParsePgOutputMessage([]byte{'Y', 0, 0})
+		So(err, ShouldBeNil)
+		So(msg, ShouldBeNil)
+	})
+
+	Convey("unknown type", t, func() {
+		_, err := ParsePgOutputMessage([]byte{'X', 0})
+		So(err, ShouldNotBeNil)
+		_, err = ParsePgOutputMessage(nil)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("too short", t, func() {
+		b := &pgOutputBuilder{}
+		b.byte('I').uint32(16385).byte('N').uint16(2).text("1")
+		_, err := ParsePgOutputMessage(b.buf)
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,92 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package postgres
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	inputDriver "github.com/brokercap/Bifrost/input/driver"
+)
+
+// LSN 以 postgresql 的文本格式 0/16B3748 保存在 PluginPosition.GTID 中
+func FormatLSN(lsn uint64) string {
+	return fmt.Sprintf("%X/%X", uint32(lsn>>32), uint32(lsn))
+}
+
+func ParseLSN(s string) (uint64, error) {
+	arr := strings.Split(s, "/")
+	if len(arr) != 2 {
+		return 0, fmt.Errorf("lsn:%s format error", s)
+	}
+	hi, err := strconv.ParseUint(arr[0], 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("lsn:%s format error", s)
+	}
+	lo, err := strconv.ParseUint(arr[1], 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("lsn:%s format error", s)
+	}
+	return hi<<32 | lo, nil
+}
+
+func (c *PostgresInput) getLastLSN() uint64 {
+	c.RLock()
+	defer c.RUnlock()
+	return c.lastLSN
+}
+
+func (c *PostgresInput) setLastLSN(lsn uint64, timestamp uint32) {
+	c.Lock()
+	c.lastLSN = lsn
+	c.lastTimestamp = timestamp
+	c.Unlock()
+}
+
+func (c *PostgresInput) GetLastPosition() *inputDriver.PluginPosition {
+	c.RLock()
+	defer c.RUnlock()
+	if c.lastLSN == 0 {
+		return nil
+	}
+	return &inputDriver.PluginPosition{
+		GTID:           FormatLSN(c.lastLSN),
+		BinlogFileName: c.inputInfo.BinlogFileName,
+		BinlogPostion:  c.inputInfo.BinlogPostion,
+		Timestamp:      c.lastTimestamp,
+		EventID:        c.eventID,
+	}
+}
+
+// server 层计算出来的所有同步都已经成功的最小位点,只往前推进
+func (c *PostgresInput) DoneMinPosition(p *inputDriver.PluginPosition) (err error) {
+	if p == nil || p.GTID == "" {
+		return nil
+	}
+	lsn, err := ParseLSN(p.GTID)
+	if err != nil {
+		return err
+	}
+	for {
+		old := atomic.LoadUint64(&c.flushedLSN)
+		if lsn <= old || atomic.CompareAndSwapUint64(&c.flushedLSN, old, lsn) {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package postgres
+
+import (
+	"testing"
+
+	inputDriver "github.com/brokercap/Bifrost/input/driver"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFormatLSN(t *testing.T) {
+	Convey("normal", t, func() {
+		So(FormatLSN(0), ShouldEqual, "0/0")
+		So(FormatLSN(0x16B3748), ShouldEqual, "0/16B3748")
+		So(FormatLSN(1<<32|0xA0), ShouldEqual, "1/A0")
+	})
+}
+
+func TestParseLSN(t *testing.T) {
+	Convey("normal", t, func() {
+		lsn, err := ParseLSN("0/16B3748")
+		So(err, ShouldBeNil)
+		So(lsn, ShouldEqual, uint64(0x16B3748))
+		lsn, err = ParseLSN("1/a0")
+		So(err, ShouldBeNil)
+		So(lsn, ShouldEqual, uint64(1<<32|0xA0))
+	})
+
+	Convey("format error", t, func() {
+		_, err := ParseLSN("16B3748")
+		So(err, ShouldNotBeNil)
+		_, err = ParseLSN("0/XYZ")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestPostgresInput_DoneMinPosition(t *testing.T) {
+	c := &PostgresInput{}
+	Convey("nil", t, func() {
+		So(c.DoneMinPosition(nil), ShouldBeNil)
+		So(c.flushedLSN, ShouldEqual, 0)
+	})
+
+	Convey("only forward", t, func() {
+		So(c.DoneMinPosition(&inputDriver.PluginPosition{GTID: "0/200"}), ShouldBeNil)
+		So(c.flushedLSN, ShouldEqual, 0x200)
+		So(c.DoneMinPosition(&inputDriver.PluginPosition{GTID: "0/100"}), ShouldBeNil)
+		So(c.flushedLSN, ShouldEqual, 0x200)
+	})
+
+	Convey("format error", t, func() {
+		So(c.DoneMinPosition(&inputDriver.PluginPosition{GTID: "xxx"}), ShouldNotBeNil)
+	})
+}
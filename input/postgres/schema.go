@@ -0,0 +1,247 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+
+	inputDriver "github.com/brokercap/Bifrost/input/driver"
+	_ "github.com/lib/pq"
+)
+
+// 库表结构等信息都是通过 lib/pq 普通连接从 pg_catalog 中查询
+func (c *PostgresInput) openDB() (*sql.DB, error) {
+	cfg, err := ParseDSN(c.inputInfo.ConnectUri)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("postgres", cfg.DSN)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+func (c *PostgresInput) GetSchemaList() (data []string, err error) {
+	db, err := c.openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	query := `SELECT nspname FROM pg_catalog.pg_namespace
+WHERE nspname NOT IN ('pg_catalog','information_schema','pg_toast') AND nspname NOT LIKE 'pg_temp_%' AND nspname NOT LIKE 'pg_toast_temp_%'
+ORDER BY nspname`
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var schemaName string
+		if err = rows.Scan(&schemaName); err != nil {
+			return nil, err
+		}
+		data = append(data, schemaName)
+	}
+	return data, rows.Err()
+}
+
+func (c *PostgresInput) GetSchemaTableList(schema string) (tableList []inputDriver.TableList, err error) {
+	db, err := c.openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	query := `SELECT c.relname,CASE WHEN c.relkind IN ('v','m') THEN 'VIEW' ELSE 'BASE TABLE' END
+FROM pg_catalog.pg_class c JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+WHERE n.nspname = $1 AND c.relkind IN ('r','p','v','m')
+ORDER BY c.relname`
+	rows, err := db.Query(query, schema)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tableList = make([]inputDriver.TableList, 0)
+	for rows.Next() {
+		var tableName, tableType string
+		if err = rows.Scan(&tableName, &tableType); err != nil {
+			return nil, err
+		}
+		tableList = append(tableList, inputDriver.TableList{TableName: tableName, TableType: tableType})
+	}
+	return tableList, rows.Err()
+}
+
+func (c *PostgresInput) GetSchemaTableFieldList(schema string, table string) (FieldList []inputDriver.TableFieldInfo, err error) {
+	db, err := c.openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	query := `SELECT a.attname,
+pg_catalog.pg_get_expr(d.adbin, d.adrelid),
+NOT a.attnotnull,
+pg_catalog.format_type(a.atttypid, a.atttypmod),
+pg_catalog.format_type(a.atttypid, NULL),
+a.attidentity IN ('a','d') OR COALESCE(pg_catalog.pg_get_expr(d.adbin, d.adrelid), '') LIKE 'nextval(%',
+pg_catalog.col_description(a.attrelid, a.attnum),
+CASE WHEN a.atttypid = 1700 AND a.atttypmod >= 4 THEN ((a.atttypmod - 4) >> 16) & 65535 END,
+CASE WHEN a.atttypid = 1700 AND a.atttypmod >= 4 THEN (a.atttypmod - 4) & 65535 END,
+EXISTS (SELECT 1 FROM pg_catalog.pg_index i WHERE i.indrelid = a.attrelid AND i.indisprimary AND a.attnum = ANY(i.indkey))
+FROM pg_catalog.pg_attribute a
+JOIN pg_catalog.pg_class c ON c.oid = a.attrelid
+JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+LEFT JOIN pg_catalog.pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+WHERE n.nspname = $1 AND c.relname = $2 AND a.attnum > 0 AND NOT a.attisdropped
+ORDER BY a.attnum`
+	rows, err := db.Query(query, schema, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var columnName, columnType, dataType string
+		var columnDefault, comment *string
+		var isNullable, isAutoIncrement, isPri bool
+		var precision, scale *uint64
+		err = rows.Scan(&columnName, &columnDefault, &isNullable, &columnType, &dataType, &isAutoIncrement, &comment, &precision, &scale, &isPri)
+		if err != nil {
+			return nil, err
+		}
+		var columnKey string
+		if isPri {
+			columnKey = "PRI"
+		}
+		FieldList = append(FieldList, inputDriver.TableFieldInfo{
+			ColumnName:       &columnName,
+			ColumnDefault:    columnDefault,
+			IsNullable:       isNullable,
+			ColumnType:       &columnType,
+			IsAutoIncrement:  isAutoIncrement,
+			Comment:          comment,
+			DataType:         &dataType,
+			NumericPrecision: precision,
+			NumericScale:     scale,
+			ColumnKey:        &columnKey,
+		})
+	}
+	return FieldList, rows.Err()
+}
+
+// 发布不存在的时候创建 FOR ALL TABLES 的发布
+func (c *PostgresInput) CheckPublication() error {
+	db, err := c.openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	var n int
+	err = db.QueryRow("SELECT COUNT(*) FROM pg_catalog.pg_publication WHERE pubname = $1", c.config.Publication).Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	_, err = db.Exec(fmt.Sprintf("CREATE PUBLICATION %s FOR ALL TABLES", quoteIdent(c.config.Publication)))
+	return err
+}
+
+func (c *PostgresInput) CheckPrivilege() error {
+	db, err := c.openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	var ok bool
+	err = db.QueryRow("SELECT rolreplication OR rolsuper FROM pg_catalog.pg_roles WHERE rolname = current_user").Scan(&ok)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("current user has no REPLICATION privilege")
+	}
+	return nil
+}
+
+func (c *PostgresInput) CheckUri(CheckPrivilege bool) (result inputDriver.CheckUriResult, err error) {
+	db, err := c.openDB()
+	if err != nil {
+		return
+	}
+	defer db.Close()
+	var walLevel string
+	if err = db.QueryRow("SHOW wal_level").Scan(&walLevel); err != nil {
+		return
+	}
+	if walLevel != "logical" {
+		err = fmt.Errorf("wal_level:%s, must be logical", walLevel)
+		return
+	}
+	if CheckPrivilege {
+		if err = c.CheckPrivilege(); err != nil {
+			return
+		}
+	}
+	var p *inputDriver.PluginPosition
+	if p, err = c.GetCurrentPosition(); err != nil {
+		return
+	}
+	result = inputDriver.CheckUriResult{
+		BinlogFile:     DefaultBinlogFileName,
+		BinlogPosition: DefaultBinlogPosition,
+		BinlogFormat:   "row",
+		BinlogRowImage: "full",
+		Gtid:           p.GTID,
+		ServerId:       1,
+	}
+	return
+}
+
+func (c *PostgresInput) GetCurrentPosition() (p *inputDriver.PluginPosition, err error) {
+	db, err := c.openDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	var lsn string
+	var timestamp int64
+	err = db.QueryRow("SELECT pg_catalog.pg_current_wal_lsn()::text, EXTRACT(EPOCH FROM now())::bigint").Scan(&lsn, &timestamp)
+	if err != nil {
+		return nil, err
+	}
+	p = &inputDriver.PluginPosition{
+		GTID:           lsn,
+		BinlogFileName: DefaultBinlogFileName,
+		BinlogPostion:  DefaultBinlogPosition,
+		Timestamp:      uint32(timestamp),
+		EventID:        c.eventID,
+	}
+	return
+}
+
+func (c *PostgresInput) GetVersion() (version string, err error) {
+	db, err := c.openDB()
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+	err = db.QueryRow("SHOW server_version").Scan(&version)
+	return
+}
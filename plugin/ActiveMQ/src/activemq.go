@@ -37,6 +37,7 @@ type PluginParam struct {
 	QueueName          string
 	Persistent         bool
 	Expir              int
+	OtherObjectType    pluginDriver.OtherObjectType
 	BifrostFilterQuery bool // bifrost server 保留,是否过滤sql事件
 }
 
@@ -197,11 +198,15 @@ func (This *Conn) sendToList(data *pluginDriver.PluginDataType) (LastSuccessComm
 			return nil, data, This.err
 		}
 	}
-	c, err := json.Marshal(data)
+	c, err := pluginDriver.ToOtherObjectBytes(data, This.p.OtherObjectType)
 	if err != nil {
 		This.err = err
 		return nil, data, err
 	}
+	// 当前格式下不需要发送的事件，比如 debezium 格式下的 sql,commit 事件
+	if c == nil {
+		return nil, nil, nil
+	}
 	QueueName := fmt.Sprint(pluginDriver.TransfeResult(This.p.QueueName, data, len(data.Rows)-1))
 	var h stompngo.Headers
 	h = h.Add(stompngo.HK_DESTINATION, QueueName)
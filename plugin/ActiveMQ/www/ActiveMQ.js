@@ -26,6 +26,7 @@ function doGetPluginParam(){
 	data["QueueName"] = QueueName;
 	data["Persistent"] = Persistent;
 	data["Expir"] = parseInt(Expir);
+	data["OtherObjectType"] = $("#ActiveMQ_OtherObjectType").val();
 
 	result.data = data;
 	result.msg = "success";
@@ -33,4 +34,30 @@ function doGetPluginParam(){
     return result;
 }
 
+function initActiveMQSupportedOtherOutputTypeList(){
+    $.get(
+        "/plugin/getSupportedOtherOutputTypeList",
+        function (d, status) {
+            if (status != "success") {
+                return false;
+            }
+            var html = "";
+            var defaultValue = null;
+            for (var i in d) {
+                var typeName = d[i].name;
+                var value = d[i].value;
+                if (defaultValue == null) {
+                    defaultValue = value
+                }
+                html += "<option value=\"" + value + "\">" + typeName + "</option>";
+            }
+            $("#ActiveMQ_OtherObjectType").html(html);
+            if (defaultValue != null) {
+                $("#ActiveMQ_OtherObjectType").val(defaultValue);
+            }
+        }, 'json');
+}
+
+initActiveMQSupportedOtherOutputTypeList();
+
 setPluginParamDefault("FilterQuery",false);
\ No newline at end of file
@@ -95,21 +95,45 @@ func (This *Conn) makeUpdateRequest(rows []map[string]interface{}) ([]elastic.Bu
 	}
 	reqs := make([]elastic.BulkableRequest, 0, len(rows))
 	for i := 0; i < len(rows); i += 2 {
-		afterID, err := This.getDocID(rows[i+1])
+		doc := rows[i+1]
+		afterID, err := This.getDocID(doc)
 		if err != nil {
-			return nil, errors.Trace(err)
+			// binlog_row_image=MINIMAL 的时候，after image 中只有变更了的字段，主键需要从 before image 中获取
+			// update 请求只会修改 doc 中存在的字段
+			doc = This.withPrimaryKeys(rows[i], rows[i+1])
+			afterID, err = This.getDocID(doc)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
 		}
 		req := elastic.NewBulkUpdateRequest().
 			Index(This.p.EsIndexName).
 			RetryOnConflict(This.esServerInfo.RetryCount).
 			Id(afterID).
-			Doc(rows[i+1]).DocAsUpsert(true).
-			Upsert(rows[i+1])
+			Doc(doc).DocAsUpsert(true).
+			Upsert(doc)
 		reqs = append(reqs, req)
 	}
 	return reqs, nil
 }
 
+// 将 before image 中的主键补充到 after image 中，不修改原来的数据
+func (This *Conn) withPrimaryKeys(before, after map[string]interface{}) map[string]interface{} {
+	doc := make(map[string]interface{}, len(after)+len(This.p.primaryKeys))
+	for key, val := range after {
+		doc[key] = val
+	}
+	for _, key := range This.p.primaryKeys {
+		if _, ok := doc[key]; ok {
+			continue
+		}
+		if val, ok := before[key]; ok {
+			doc[key] = val
+		}
+	}
+	return doc
+}
+
 func (This *Conn) getDocID(row map[string]interface{}) (id string, err error) {
 	for _, key := range This.p.primaryKeys {
 		if _, ok := row[key]; ok {
@@ -0,0 +1,23 @@
+package src
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConn_withPrimaryKeys(t *testing.T) {
+	c := &Conn{p: &PluginParam{primaryKeys: []string{"id"}}}
+	before := map[string]interface{}{"id": 1}
+	after := map[string]interface{}{"name": "b"}
+	doc := c.withPrimaryKeys(before, after)
+	if !reflect.DeepEqual(doc, map[string]interface{}{"id": 1, "name": "b"}) {
+		t.Fatalf("doc:%+v", doc)
+	}
+	if _, ok := after["id"]; ok {
+		t.Fatal("after image be changed")
+	}
+	id, err := c.getDocID(doc)
+	if err != nil || id != "1" {
+		t.Fatalf("id:%s err:%v", id, err)
+	}
+}
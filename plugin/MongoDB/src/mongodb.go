@@ -197,19 +197,34 @@ func (This *Conn) Insert(data *pluginDriver.PluginDataType, retry bool) (LastSuc
 	}()
 	c := This.conn.DB(SchemaName).C(TableName)
 	This.createIndex(c)
-	k := make(bson.M, 1)
+	k, doc, err := This.getUpsertKeyAndDoc(data)
+	if err != nil {
+		return nil, data, err
+	}
+	_, err = c.Upsert(k, doc)
+	if err != nil {
+		return nil, data, err
+	}
+	return nil, nil, nil
+}
+
+// binlog_row_image 不是 FULL 的时候，只 $set 存在的字段，主键优先从 after image 获取，没有则从 before image 中获取
+func (This *Conn) getUpsertKeyAndDoc(data *pluginDriver.PluginDataType) (k bson.M, doc interface{}, err error) {
+	n := len(data.Rows) - 1
+	k = make(bson.M, 1)
 	for _, key := range This.p.primaryKeys {
 		if _, ok := data.Rows[n][key]; ok {
 			k[key] = data.Rows[n][key]
+		} else if _, ok = data.Rows[0][key]; ok && !data.IsFullRowImage(n) {
+			k[key] = data.Rows[0][key]
 		} else {
-			return nil, data, fmt.Errorf("key:" + key + " no exsit")
+			return nil, nil, fmt.Errorf("key:" + key + " no exsit")
 		}
 	}
-	_, err := c.Upsert(k, data.Rows[n])
-	if err != nil {
-		return nil, data, err
+	if data.IsFullRowImage(n) {
+		return k, data.Rows[n], nil
 	}
-	return nil, nil, nil
+	return k, bson.M{"$set": data.Rows[n]}, nil
 }
 
 func (This *Conn) Update(data *pluginDriver.PluginDataType, retry bool) (LastSuccessCommitData *pluginDriver.PluginDataType, ErrData *pluginDriver.PluginDataType, e error) {
@@ -0,0 +1,45 @@
+package src
+
+import (
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	"gopkg.in/mgo.v2/bson"
+	"reflect"
+	"testing"
+)
+
+func TestConn_getUpsertKeyAndDoc(t *testing.T) {
+	c := &Conn{p: &PluginParam{primaryKeys: []string{"id"}}}
+
+	data := &pluginDriver.PluginDataType{
+		EventType: "update",
+		Rows:      []map[string]interface{}{{"id": 1, "name": "a"}, {"id": 1, "name": "b"}},
+	}
+	k, doc, err := c.getUpsertKeyAndDoc(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(k, bson.M{"id": 1}) || !reflect.DeepEqual(doc, data.Rows[1]) {
+		t.Fatalf("full row image k:%+v doc:%+v", k, doc)
+	}
+
+	data = &pluginDriver.PluginDataType{
+		EventType:      "update",
+		Rows:           []map[string]interface{}{{"id": 1}, {"name": "b"}},
+		PresentColumns: [][]string{{"id"}, {"name"}},
+	}
+	k, doc, err = c.getUpsertKeyAndDoc(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(k, bson.M{"id": 1}) || !reflect.DeepEqual(doc, bson.M{"$set": data.Rows[1]}) {
+		t.Fatalf("minimal row image k:%+v doc:%+v", k, doc)
+	}
+
+	data = &pluginDriver.PluginDataType{
+		EventType: "update",
+		Rows:      []map[string]interface{}{{"id": 1}, {"name": "b"}},
+	}
+	if _, _, err = c.getUpsertKeyAndDoc(data); err == nil {
+		t.Fatal("full row image without primary key need err")
+	}
+}
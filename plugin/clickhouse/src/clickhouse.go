@@ -579,13 +579,28 @@ func (This *Conn) sendToCacheList(data *pluginDriver.PluginDataType, retry bool)
 }
 
 func (This *Conn) Insert(data *pluginDriver.PluginDataType, retry bool) (*pluginDriver.PluginDataType, *pluginDriver.PluginDataType, error) {
+	if !data.IsFullRowImageAll() {
+		return This.notFullRowImage(data)
+	}
 	return This.sendToCacheList(data, retry)
 }
 
 func (This *Conn) Update(data *pluginDriver.PluginDataType, retry bool) (*pluginDriver.PluginDataType, *pluginDriver.PluginDataType, error) {
+	if !data.IsFullRowImageAll() {
+		return This.notFullRowImage(data)
+	}
 	return This.sendToCacheList(data, retry)
 }
 
+// ck 是按 delete + insert 完整行数据的方式同步的, binlog_row_image 不是 FULL 的 insert,update 数据没法同步,直接报错
+// 设置了跳过位点的数据, 不报错,直接过滤掉
+func (This *Conn) notFullRowImage(data *pluginDriver.PluginDataType) (*pluginDriver.PluginDataType, *pluginDriver.PluginDataType, error) {
+	if This.CheckDataSkip(data) {
+		return nil, nil, nil
+	}
+	return nil, data, fmt.Errorf("%s.%s binlog_row_image is not FULL, clickhouse plugin need full row data, please set binlog_row_image=FULL", data.SchemaName, data.TableName)
+}
+
 func (This *Conn) Del(data *pluginDriver.PluginDataType, retry bool) (*pluginDriver.PluginDataType, *pluginDriver.PluginDataType, error) {
 	return This.sendToCacheList(data, retry)
 }
@@ -0,0 +1,50 @@
+package src
+
+import (
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestConn_NotFullRowImage(t *testing.T) {
+	newConn := func() *Conn {
+		return &Conn{p: &PluginParam{
+			BatchSize: 100,
+			Data:      &TableDataStruct{Data: make([]*pluginDriver.PluginDataType, 0)},
+		}}
+	}
+	data := &pluginDriver.PluginDataType{
+		EventType:      "update",
+		SchemaName:     "bifrost_test",
+		TableName:      "binlog_field_test",
+		BinlogFileNum:  1,
+		BinlogPosition: 100,
+		Rows:           []map[string]interface{}{{"id": int32(1)}, {"name": "bifrost"}},
+		PresentColumns: [][]string{{"id"}, {"name"}},
+	}
+
+	Convey("binlog_row_image not full", t, func() {
+		c := newConn()
+		_, errData, err := c.Update(data, false)
+		So(err, ShouldNotBeNil)
+		So(errData, ShouldEqual, data)
+		So(len(c.p.Data.Data), ShouldEqual, 0)
+	})
+
+	Convey("binlog_row_image not full and skip", t, func() {
+		c := newConn()
+		c.Skip(&pluginDriver.PluginDataType{BinlogFileNum: 1, BinlogPosition: 100})
+		_, errData, err := c.Update(data, false)
+		So(err, ShouldBeNil)
+		So(errData, ShouldBeNil)
+		So(len(c.p.Data.Data), ShouldEqual, 0)
+	})
+
+	Convey("binlog_row_image full", t, func() {
+		c := newConn()
+		_, errData, err := c.Insert(&pluginDriver.PluginDataType{EventType: "insert", Rows: []map[string]interface{}{{"id": int32(1)}}}, false)
+		So(err, ShouldBeNil)
+		So(errData, ShouldBeNil)
+		So(len(c.p.Data.Data), ShouldEqual, 1)
+	})
+}
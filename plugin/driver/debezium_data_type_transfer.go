@@ -166,9 +166,8 @@ func (c *DebeziumJsonMsg) ToBifrostDate() (toVal interface{}, toFieldType string
 	// 19280 ==> 2022-10-15
 	if c.DebeziumVal != nil {
 		tmpInt64, _ := strconv.ParseInt(c.DebeziumVal.(string), 10, 32)
-		now := time.Now()
-		// 当时时间戳 / 86400 算出当前距离1970的天数，再和 目标值（date int）的中的数字 对比，相差了几天，然后进行相加减，再格式化
-		toVal = now.AddDate(0, 0, int(tmpInt64-now.Unix()/86400)).Format("2006-01-02")
+		// 距离 1970-01-01 的天数
+		toVal = time.Unix(tmpInt64*86400, 0).UTC().Format("2006-01-02")
 	}
 	toFieldType = "date"
 	return
@@ -204,7 +203,7 @@ func (c *DebeziumJsonMsg) ToBifrostBits() (toVal interface{}, toFieldType string
 }
 
 func (c *DebeziumJsonMsg) ToBifrostDouble() (toVal interface{}, toFieldType string) {
-	if c.BifrostVal != nil {
+	if c.DebeziumVal != nil {
 		toVal, _ = strconv.ParseFloat(c.DebeziumVal.(string), 64)
 	}
 	toFieldType = "double"
@@ -212,8 +211,8 @@ func (c *DebeziumJsonMsg) ToBifrostDouble() (toVal interface{}, toFieldType stri
 }
 
 func (c *DebeziumJsonMsg) ToBifrostFloat() (toVal interface{}, toFieldType string) {
-	if c.BifrostVal != nil {
-		float64Val, _ := strconv.ParseFloat(c.BifrostVal.(string), 32)
+	if c.DebeziumVal != nil {
+		float64Val, _ := strconv.ParseFloat(c.DebeziumVal.(string), 32)
 		toVal = float32(float64Val)
 	}
 	toFieldType = "float"
@@ -221,14 +220,22 @@ func (c *DebeziumJsonMsg) ToBifrostFloat() (toVal interface{}, toFieldType strin
 }
 
 func (c *DebeziumJsonMsg) ToBifrostYear() (toVal interface{}, toFieldType string) {
-	if c.BifrostVal != nil {
-		tmpInt, _ := strconv.ParseInt(c.BifrostVal.(string), 10, 32)
+	if c.DebeziumVal != nil {
+		tmpInt, _ := strconv.ParseInt(c.DebeziumVal.(string), 10, 32)
 		toVal = int16(tmpInt)
 	}
 	toFieldType = "year"
 	return
 }
 
+func (c *DebeziumJsonMsg) ToBifrostBool() (toVal interface{}, toFieldType string) {
+	if c.DebeziumVal != nil {
+		toVal, _ = strconv.ParseBool(c.DebeziumVal.(string))
+	}
+	toFieldType = "bool"
+	return
+}
+
 func (c *DebeziumJsonMsg) ToBifrostEnum() (toVal interface{}, toFieldType string) {
 	if c.DebeziumParameters != nil && c.DebeziumParameters["allowed"] != "" {
 		tmpArr := strings.Split(fmt.Sprint(c.DebeziumParameters["allowed"]), ",")
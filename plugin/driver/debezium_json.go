@@ -87,9 +87,9 @@ type DebeziumValuePayloadSource struct {
 	       "query": null
 	   },
 	*/
-	Name     string `json:"name"`   // 同步的名字，并不是插件名
-	Database string `json:"db"`     // 数据库名
-	Table    string `json:"table""` // 表名
+	Name     string `json:"name"`  // 同步的名字，并不是插件名
+	Database string `json:"db"`    // 数据库名
+	Table    string `json:"table"` // 表名
 }
 
 type Debezium struct {
@@ -198,7 +198,7 @@ func (c *Debezium) GetToBifrostRowsWithDelete() (rows []map[string]interface{},
 func (c *Debezium) GetToBifrostRowsWithUpdate() (rows []map[string]interface{}, columnMap map[string]string) {
 	beforeMap, _ := c.GetToBifrostRowsAndMapping(c.Value.Payload.Before, c.Value.Schema.Fields[0].Fields)
 	rows = append(rows, beforeMap)
-	afterMap, columnMap := c.GetToBifrostRowsAndMapping(c.Value.Payload.Before, c.Value.Schema.Fields[0].Fields)
+	afterMap, columnMap := c.GetToBifrostRowsAndMapping(c.Value.Payload.After, c.Value.Schema.Fields[1].Fields)
 	rows = append(rows, afterMap)
 	return rows, columnMap
 }
@@ -261,6 +261,12 @@ func (c *Debezium) GetToBifrostRowsAndMapping(dataMap map[string]*json.RawMessag
 				toVal, fieldType = jsonRawMessageOjb.ToBifrostUint16()
 			case "uint8":
 				toVal, fieldType = jsonRawMessageOjb.ToBifrostUint8()
+			case "float64":
+				toVal, fieldType = jsonRawMessageOjb.ToBifrostDouble()
+			case "float32":
+				toVal, fieldType = jsonRawMessageOjb.ToBifrostFloat()
+			case "boolean":
+				toVal, fieldType = jsonRawMessageOjb.ToBifrostBool()
 			case "bytes":
 				toVal, fieldType = jsonRawMessageOjb.ToBifrostLongText()
 			default:
@@ -41,7 +41,12 @@ type PluginDataType struct {
 	Gtid            string
 	Pri             []string
 	EventID         uint64
-	ColumnMapping   map[string]string
+	// TRANSACTION_PAYLOAD_EVENT 里除最后一个以外的事件, 位点都是 payload 的起始位点, 用这个序号(从 1 开始)区分先后
+	PayloadIndex  uint32
+	ColumnMapping map[string]string
+	// binlog_row_image 为 MINIMAL,NOBLOB 的时候，和 Rows 一一对应，记录每一行实际存在的字段
+	// 不存在的字段在 Rows 里没有 key, 和值为 null 的字段区分开; nil 代表所有行都是完整的
+	PresentColumns [][]string
 }
 
 func GetApiVersion() string {
@@ -0,0 +1,24 @@
+package driver
+
+// 比较两个位点的先后, 返回 -1, 0, 1
+// TRANSACTION_PAYLOAD_EVENT 里的事件位点相同, 再按 PayloadIndex 比较, payload 之前的事件 PayloadIndex 为 0, 排在前面
+func CompareBinlogPosition(fileNum1 int, pos1 uint32, index1 uint32, fileNum2 int, pos2 uint32, index2 uint32) int {
+	switch {
+	case fileNum1 != fileNum2:
+		if fileNum1 < fileNum2 {
+			return -1
+		}
+		return 1
+	case pos1 != pos2:
+		if pos1 < pos2 {
+			return -1
+		}
+		return 1
+	case index1 != index2:
+		if index1 < index2 {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,21 @@
+package driver
+
+import (
+	"github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestCompareBinlogPosition(t *testing.T) {
+	convey.Convey("file num and position", t, func() {
+		convey.So(CompareBinlogPosition(1, 100, 0, 2, 4, 0), convey.ShouldEqual, -1)
+		convey.So(CompareBinlogPosition(2, 100, 0, 2, 4, 0), convey.ShouldEqual, 1)
+		convey.So(CompareBinlogPosition(2, 100, 0, 2, 100, 0), convey.ShouldEqual, 0)
+	})
+
+	convey.Convey("events in one transaction payload", t, func() {
+		// payload 起始位点 100, 结束位点 300
+		convey.So(CompareBinlogPosition(1, 100, 0, 1, 100, 1), convey.ShouldEqual, -1)
+		convey.So(CompareBinlogPosition(1, 100, 2, 1, 100, 1), convey.ShouldEqual, 1)
+		convey.So(CompareBinlogPosition(1, 100, 2, 1, 300, 0), convey.ShouldEqual, -1)
+	})
+}
@@ -0,0 +1,55 @@
+package driver
+
+// 第 rowIndex 行是否是完整的行数据(binlog_row_image=FULL)
+func (c *PluginDataType) IsFullRowImage(rowIndex int) bool {
+	if c.PresentColumns == nil || rowIndex < 0 || rowIndex >= len(c.PresentColumns) {
+		return true
+	}
+	return c.PresentColumns[rowIndex] == nil
+}
+
+// 所有行是否都是完整的行数据
+func (c *PluginDataType) IsFullRowImageAll() bool {
+	for i := range c.PresentColumns {
+		if c.PresentColumns[i] != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// 第 rowIndex 行中 column 字段是否存在，行数据完整的情况下,所有字段都认为是存在的
+func (c *PluginDataType) IsColumnPresent(rowIndex int, column string) bool {
+	if c.IsFullRowImage(rowIndex) {
+		return true
+	}
+	for _, v := range c.PresentColumns[rowIndex] {
+		if v == column {
+			return true
+		}
+	}
+	return false
+}
+
+// 获取第 rowIndex 行实际存在的字段列表，行数据完整的情况下返回 nil
+func (c *PluginDataType) GetPresentColumns(rowIndex int) []string {
+	if c.IsFullRowImage(rowIndex) {
+		return nil
+	}
+	return c.PresentColumns[rowIndex]
+}
+
+// 拆分多行数据的时候，获取第 rowIndex 行开始的 n 行对应的 PresentColumns
+func (c *PluginDataType) SubPresentColumns(rowIndex int, n int) [][]string {
+	if c.PresentColumns == nil || rowIndex < 0 || rowIndex+n > len(c.PresentColumns) {
+		return nil
+	}
+	presentColumns := make([][]string, n)
+	copy(presentColumns, c.PresentColumns[rowIndex:rowIndex+n])
+	for _, v := range presentColumns {
+		if v != nil {
+			return presentColumns
+		}
+	}
+	return nil
+}
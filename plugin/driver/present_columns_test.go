@@ -0,0 +1,48 @@
+package driver
+
+import (
+	"github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestPluginDataType_PresentColumns(t *testing.T) {
+	convey.Convey("full row image", t, func() {
+		data := &PluginDataType{
+			EventType: "update",
+			Rows:      []map[string]interface{}{{"id": 1, "name": "a"}, {"id": 1, "name": "b"}},
+		}
+		convey.So(data.IsFullRowImage(0), convey.ShouldBeTrue)
+		convey.So(data.IsFullRowImageAll(), convey.ShouldBeTrue)
+		convey.So(data.IsColumnPresent(1, "not_exist"), convey.ShouldBeTrue)
+		convey.So(data.GetPresentColumns(1), convey.ShouldBeNil)
+		convey.So(data.SubPresentColumns(0, 2), convey.ShouldBeNil)
+	})
+
+	convey.Convey("minimal row image", t, func() {
+		data := &PluginDataType{
+			EventType:      "update",
+			Rows:           []map[string]interface{}{{"id": 1}, {"name": "b"}, {"id": 2}, {"name": "c", "status": nil}},
+			PresentColumns: [][]string{{"id"}, {"name"}, {"id"}, {"name", "status"}},
+		}
+		convey.So(data.IsFullRowImage(1), convey.ShouldBeFalse)
+		convey.So(data.IsFullRowImageAll(), convey.ShouldBeFalse)
+		convey.So(data.IsColumnPresent(0, "id"), convey.ShouldBeTrue)
+		convey.So(data.IsColumnPresent(1, "id"), convey.ShouldBeFalse)
+		convey.So(data.IsColumnPresent(3, "status"), convey.ShouldBeTrue)
+		convey.So(data.GetPresentColumns(3), convey.ShouldResemble, []string{"name", "status"})
+		convey.So(data.SubPresentColumns(2, 2), convey.ShouldResemble, [][]string{{"id"}, {"name", "status"}})
+		convey.So(data.SubPresentColumns(3, 2), convey.ShouldBeNil)
+	})
+
+	convey.Convey("noblob row image, insert is full", t, func() {
+		data := &PluginDataType{
+			EventType:      "insert",
+			Rows:           []map[string]interface{}{{"id": 1, "content": "x"}, {"id": 2}},
+			PresentColumns: [][]string{nil, {"id"}},
+		}
+		convey.So(data.IsFullRowImage(0), convey.ShouldBeTrue)
+		convey.So(data.IsFullRowImage(1), convey.ShouldBeFalse)
+		convey.So(data.SubPresentColumns(0, 1), convey.ShouldBeNil)
+		convey.So(data.SubPresentColumns(1, 1), convey.ShouldResemble, [][]string{{"id"}})
+	})
+}
@@ -54,12 +54,12 @@ func (c *PluginDataType) ToCanalJsonMysqlAndSqlType() (map[string]string, map[st
 	sqlTypeMap := make(map[string]int16, 0)
 	for name, dataType := range c.ColumnMapping {
 		var dataTypeLen = len(dataType)
-		var columnType string
-		if dataType[0:3] == "Nul" && dataTypeLen > 9 {
+		var columnType = dataType
+		if dataTypeLen > 9 && dataType[0:9] == "Nullable(" {
 			columnType = dataType[9 : len(dataType)-1]
 		}
 		var sqlType int16
-		switch dataType {
+		switch columnType {
 		case "bool":
 			columnType = "tinyint(1)"
 			sqlType = GetCanalSqlTypeByDataType("bool")
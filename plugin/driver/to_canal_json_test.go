@@ -16,3 +16,23 @@ func TestPluginDataType_ToCanalJsonObject(t *testing.T) {
 		So(canalData.SqlType["id"], ShouldEqual, -5)
 	})
 }
+
+func TestPluginDataType_ToCanalJsonMysqlAndSqlType(t *testing.T) {
+	Convey("Nullable 和非 Nullable 字段类型", t, func() {
+		data := &PluginDataType{
+			ColumnMapping: map[string]string{
+				"id":    "int32",
+				"age":   "Nullable(uint32)",
+				"name":  "varchar(20)",
+				"price": "Nullable(decimal(10,2))",
+			},
+		}
+		mysqlTypeMap, sqlTypeMap := data.ToCanalJsonMysqlAndSqlType()
+		So(mysqlTypeMap["id"], ShouldEqual, "int(11)")
+		So(mysqlTypeMap["age"], ShouldEqual, "int(11) unsigned")
+		So(mysqlTypeMap["name"], ShouldEqual, "varchar(20)")
+		So(mysqlTypeMap["price"], ShouldEqual, "decimal(10,2)")
+		So(sqlTypeMap["name"], ShouldEqual, 12)
+		So(sqlTypeMap["price"], ShouldEqual, 3)
+	})
+}
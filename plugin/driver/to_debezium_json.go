@@ -0,0 +1,458 @@
+package driver
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// debezium 中 topic.prefix (database.server.name) 对应的名字，用于拼接 schema name
+const DebeziumServerName = "bifrost"
+
+type DebeziumOutputSchema struct {
+	Type       string                  `json:"type"`
+	Fields     []*DebeziumOutputSchema `json:"fields,omitempty"`
+	Optional   bool                    `json:"optional"`
+	Name       string                  `json:"name,omitempty"`
+	Version    int                     `json:"version,omitempty"`
+	Parameters map[string]string       `json:"parameters,omitempty"`
+	Field      string                  `json:"field,omitempty"`
+}
+
+// 带 schema 的格式 {"schema":{},"payload":{}}
+type DebeziumOutput struct {
+	Schema  *DebeziumOutputSchema `json:"schema"`
+	Payload interface{}           `json:"payload"`
+}
+
+type DebeziumOutputPayload struct {
+	Before      map[string]interface{} `json:"before"`
+	After       map[string]interface{} `json:"after"`
+	Source      *DebeziumOutputSource  `json:"source"`
+	Op          string                 `json:"op"`
+	Ts          int64                  `json:"ts_ms"`
+	Transaction interface{}            `json:"transaction"`
+}
+
+type DebeziumOutputSource struct {
+	Version   string  `json:"version"`
+	Connector string  `json:"connector"`
+	Name      string  `json:"name"`
+	Ts        int64   `json:"ts_ms"`
+	Snapshot  string  `json:"snapshot"`
+	Database  string  `json:"db"`
+	Table     string  `json:"table"`
+	ServerId  int64   `json:"server_id"`
+	Gtid      *string `json:"gtid"`
+	File      string  `json:"file"`
+	Pos       int64   `json:"pos"`
+	Row       int32   `json:"row"`
+}
+
+type debeziumColumn struct {
+	name     string
+	dataType string // 去掉 Nullable() 之后的类型
+	optional bool
+}
+
+// 转成 debezium 的 value 格式，只有 insert,update,delete 事件才有对应的格式，其他事件返回 nil
+// 一条 debezium 消息只对应一行数据，数据在 server 层已经被拆成了单行，假如有多行，只取最后一行
+func (c *PluginDataType) ToDebeziumObject(withSchema bool) (interface{}, error) {
+	op, before, after := c.getDebeziumRows()
+	if op == "" {
+		return nil, nil
+	}
+	columns := c.getDebeziumColumns(before, after)
+	payload := &DebeziumOutputPayload{
+		Before: debeziumRowValues(columns, before),
+		After:  debeziumRowValues(columns, after),
+		Source: c.getDebeziumSource(),
+		Op:     op,
+		Ts:     time.Now().UnixMilli(),
+	}
+	if !withSchema {
+		return payload, nil
+	}
+	recordName := c.getDebeziumRecordName()
+	rowSchema := debeziumRowSchema(columns, recordName+".Value")
+	return &DebeziumOutput{
+		Schema: &DebeziumOutputSchema{
+			Type: "struct",
+			Fields: []*DebeziumOutputSchema{
+				rowSchema.withField("before"),
+				rowSchema.withField("after"),
+				debeziumSourceSchema(),
+				{Type: "string", Field: "op"},
+				{Type: "int64", Optional: true, Field: "ts_ms"},
+			},
+			Name:    recordName + ".Envelope",
+			Version: 1,
+		},
+		Payload: payload,
+	}, nil
+}
+
+// 转成 debezium 的 key 格式，没有主键的表 debezium 的 key 为 null，这里也返回 nil
+func (c *PluginDataType) ToDebeziumKeyObject(withSchema bool) (interface{}, error) {
+	op, before, after := c.getDebeziumRows()
+	if op == "" || len(c.Pri) == 0 {
+		return nil, nil
+	}
+	row := after
+	if row == nil {
+		row = before
+	}
+	columns := make([]*debeziumColumn, 0, len(c.Pri))
+	for _, name := range c.Pri {
+		column := c.getDebeziumColumn(name, row[name])
+		column.optional = false
+		columns = append(columns, column)
+	}
+	payload := make(map[string]interface{}, len(columns))
+	for _, column := range columns {
+		// MINIMAL 模式下 update 的 after image 可能没有主键，则从 before image 中获取
+		val, ok := row[column.name]
+		if !ok && before != nil {
+			val = before[column.name]
+		}
+		payload[column.name] = debeziumValue(column.dataType, val)
+	}
+	if !withSchema {
+		return payload, nil
+	}
+	return &DebeziumOutput{
+		Schema:  debeziumRowSchema(columns, c.getDebeziumRecordName()+".Key"),
+		Payload: payload,
+	}, nil
+}
+
+func (c *PluginDataType) getDebeziumRows() (op string, before, after map[string]interface{}) {
+	n := len(c.Rows)
+	if n == 0 {
+		return
+	}
+	switch c.EventType {
+	case "insert":
+		return "c", nil, c.Rows[n-1]
+	case "delete":
+		return "d", c.Rows[n-1], nil
+	case "update":
+		if n < 2 {
+			return
+		}
+		return "u", c.Rows[n-2], c.Rows[n-1]
+	}
+	return
+}
+
+func (c *PluginDataType) getDebeziumRecordName() string {
+	return DebeziumServerName + "." + c.SchemaName + "." + c.TableName
+}
+
+func (c *PluginDataType) getDebeziumSource() *DebeziumOutputSource {
+	source := &DebeziumOutputSource{
+		Version:   API_VERSION,
+		Connector: "mysql",
+		Name:      DebeziumServerName,
+		Ts:        int64(c.Timestamp) * 1000,
+		Snapshot:  "false",
+		Database:  c.SchemaName,
+		Table:     c.TableName,
+		Pos:       int64(c.BinlogPosition),
+	}
+	if c.BinlogFileNum > 0 {
+		source.File = fmt.Sprintf("mysql-bin.%06d", c.BinlogFileNum)
+	}
+	if c.Gtid != "" {
+		gtid := c.Gtid
+		source.Gtid = &gtid
+	}
+	return source
+}
+
+// 字段按名字排序，保证每次输出的 schema 一致
+func (c *PluginDataType) getDebeziumColumns(before, after map[string]interface{}) []*debeziumColumn {
+	names := make([]string, 0, len(c.ColumnMapping))
+	if len(c.ColumnMapping) > 0 {
+		for name := range c.ColumnMapping {
+			names = append(names, name)
+		}
+	} else {
+		row := after
+		if row == nil {
+			row = before
+		}
+		for name := range row {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	columns := make([]*debeziumColumn, 0, len(names))
+	for _, name := range names {
+		val, ok := after[name]
+		if !ok || val == nil {
+			val = before[name]
+		}
+		columns = append(columns, c.getDebeziumColumn(name, val))
+	}
+	return columns
+}
+
+// 没有 ColumnMapping 的时候，根据值的类型推断
+func (c *PluginDataType) getDebeziumColumn(name string, val interface{}) *debeziumColumn {
+	column := &debeziumColumn{name: name, optional: true}
+	if mappingType, ok := c.ColumnMapping[name]; ok {
+		column.optional = false
+		if strings.Index(mappingType, "Nullable(") == 0 {
+			mappingType = mappingType[9 : len(mappingType)-1]
+			column.optional = true
+		}
+		column.dataType = strings.ToLower(mappingType)
+		return column
+	}
+	switch val.(type) {
+	case bool:
+		column.dataType = "bool"
+	case int8, int16, uint8:
+		column.dataType = "int16"
+	case int32, uint16:
+		column.dataType = "int32"
+	case int, int64, uint, uint32, uint64:
+		column.dataType = "int64"
+	case float32:
+		column.dataType = "float"
+	case float64:
+		column.dataType = "double"
+	case map[string]interface{}, []interface{}:
+		column.dataType = "json"
+	case []string:
+		column.dataType = "set"
+	default:
+		column.dataType = "text"
+	}
+	return column
+}
+
+func debeziumBaseType(dataType string) string {
+	dataType = strings.Split(dataType, "(")[0]
+	return strings.TrimSpace(strings.Replace(dataType, "unsigned", "", 1))
+}
+
+// enum('a','b') ==> a,b
+func debeziumAllowedValues(dataType string) string {
+	i := strings.Index(dataType, "(")
+	if i < 0 || !strings.HasSuffix(dataType, ")") {
+		return ""
+	}
+	values := strings.Split(dataType[i+1:len(dataType)-1], ",")
+	for k, v := range values {
+		values[k] = strings.Trim(strings.TrimSpace(v), "'")
+	}
+	return strings.Join(values, ",")
+}
+
+// 类型对应关系参考 debezium mysql connector 默认配置
+// decimal.handling.mode=string , time.precision.mode=adaptive_time_microseconds , bigint.unsigned.handling.mode=long
+func debeziumFieldSchema(column *debeziumColumn) *DebeziumOutputSchema {
+	schema := &DebeziumOutputSchema{
+		Type:     "string",
+		Optional: column.optional,
+		Field:    column.name,
+	}
+	switch debeziumBaseType(column.dataType) {
+	case "bool":
+		schema.Type = "boolean"
+	case "int8", "uint8", "int16", "tinyint", "smallint":
+		schema.Type = "int16"
+	case "uint16", "int24", "uint24", "int32", "int", "mediumint":
+		schema.Type = "int32"
+	case "uint32", "int64", "uint64", "bigint", "bit":
+		schema.Type = "int64"
+	case "float":
+		schema.Type = "float32"
+	case "double", "real":
+		schema.Type = "float64"
+	case "date":
+		schema.Type = "int32"
+		schema.Name = "io.debezium.time.Date"
+		schema.Version = 1
+	case "time":
+		schema.Type = "int64"
+		schema.Name = "io.debezium.time.MicroTime"
+		schema.Version = 1
+	case "datetime":
+		schema.Type = "int64"
+		schema.Name = "io.debezium.time.MicroTimestamp"
+		schema.Version = 1
+	case "timestamp":
+		schema.Name = "io.debezium.time.ZonedTimestamp"
+		schema.Version = 1
+	case "year":
+		schema.Type = "int32"
+		schema.Name = "io.debezium.time.Year"
+		schema.Version = 1
+	case "json":
+		schema.Name = "io.debezium.data.Json"
+		schema.Version = 1
+	case "enum":
+		schema.Name = "io.debezium.data.Enum"
+		schema.Version = 1
+		schema.Parameters = map[string]string{"allowed": debeziumAllowedValues(column.dataType)}
+	case "set":
+		schema.Name = "io.debezium.data.EnumSet"
+		schema.Version = 1
+		schema.Parameters = map[string]string{"allowed": debeziumAllowedValues(column.dataType)}
+	}
+	return schema
+}
+
+func debeziumRowSchema(columns []*debeziumColumn, name string) *DebeziumOutputSchema {
+	fields := make([]*DebeziumOutputSchema, 0, len(columns))
+	for _, column := range columns {
+		fields = append(fields, debeziumFieldSchema(column))
+	}
+	return &DebeziumOutputSchema{
+		Type:   "struct",
+		Fields: fields,
+		Name:   name,
+	}
+}
+
+func (schema *DebeziumOutputSchema) withField(field string) *DebeziumOutputSchema {
+	newSchema := *schema
+	newSchema.Optional = true
+	newSchema.Field = field
+	return &newSchema
+}
+
+func debeziumSourceSchema() *DebeziumOutputSchema {
+	return &DebeziumOutputSchema{
+		Type: "struct",
+		Fields: []*DebeziumOutputSchema{
+			{Type: "string", Field: "version"},
+			{Type: "string", Field: "connector"},
+			{Type: "string", Field: "name"},
+			{Type: "int64", Field: "ts_ms"},
+			{Type: "string", Optional: true, Field: "snapshot"},
+			{Type: "string", Field: "db"},
+			{Type: "string", Optional: true, Field: "table"},
+			{Type: "int64", Field: "server_id"},
+			{Type: "string", Optional: true, Field: "gtid"},
+			{Type: "string", Field: "file"},
+			{Type: "int64", Field: "pos"},
+			{Type: "int32", Field: "row"},
+		},
+		Name:  "io.debezium.connector.mysql.Source",
+		Field: "source",
+	}
+}
+
+func debeziumRowValues(columns []*debeziumColumn, row map[string]interface{}) map[string]interface{} {
+	if row == nil {
+		return nil
+	}
+	values := make(map[string]interface{}, len(columns))
+	for _, column := range columns {
+		values[column.name] = debeziumValue(column.dataType, row[column.name])
+	}
+	return values
+}
+
+func debeziumValue(dataType string, val interface{}) interface{} {
+	if val == nil {
+		return nil
+	}
+	var str string
+	switch v := val.(type) {
+	case string:
+		str = v
+	case []byte:
+		str = string(v)
+	case []string:
+		str = strings.Join(v, ",")
+	case map[string]interface{}, []interface{}:
+		b, _ := json.Marshal(v)
+		str = string(b)
+	default:
+		str = fmt.Sprint(v)
+	}
+	switch debeziumBaseType(dataType) {
+	case "bool":
+		switch str {
+		case "1", "true":
+			return true
+		}
+		return false
+	case "int8", "uint8", "int16", "uint16", "int24", "uint24", "int32", "uint32", "int64", "tinyint", "smallint", "mediumint", "int", "bigint", "bit", "year":
+		intVal, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return nil
+		}
+		return intVal
+	case "uint64":
+		// bigint.unsigned.handling.mode=long ，超出 int64 的值会溢出，和 debezium 保持一致
+		uintVal, err := strconv.ParseUint(str, 10, 64)
+		if err != nil {
+			return nil
+		}
+		return int64(uintVal)
+	case "float", "double", "real":
+		floatVal, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return nil
+		}
+		return floatVal
+	case "date":
+		t, err := time.Parse("2006-01-02", str)
+		if err != nil {
+			return nil
+		}
+		return t.Unix() / 86400
+	case "time":
+		return debeziumMicroTime(str)
+	case "datetime":
+		t, err := time.Parse("2006-01-02 15:04:05.999999", str)
+		if err != nil {
+			return nil
+		}
+		return t.UnixMicro()
+	case "timestamp":
+		t, err := time.Parse("2006-01-02 15:04:05.999999", str)
+		if err != nil {
+			return nil
+		}
+		return t.Format("2006-01-02T15:04:05.999999Z")
+	}
+	return str
+}
+
+// -838:59:59.000000 ~ 838:59:59.000000 转成微秒
+func debeziumMicroTime(str string) interface{} {
+	var sign int64 = 1
+	if strings.HasPrefix(str, "-") {
+		sign = -1
+		str = str[1:]
+	}
+	var micro int64
+	if i := strings.Index(str, "."); i >= 0 {
+		fraction := (str[i+1:] + "000000")[0:6]
+		micro, _ = strconv.ParseInt(fraction, 10, 64)
+		str = str[0:i]
+	}
+	arr := strings.Split(str, ":")
+	if len(arr) != 3 {
+		return nil
+	}
+	var sec int64
+	for _, v := range arr {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil
+		}
+		sec = sec*60 + n
+	}
+	return sign * (sec*1000000 + micro)
+}
@@ -0,0 +1,200 @@
+package driver
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func getDebeziumTestColumnMapping() map[string]string {
+	return map[string]string{
+		"id":        "uint32",
+		"name":      "Nullable(varchar(20))",
+		"price":     "Nullable(decimal(10,2))",
+		"flag":      "bool",
+		"score":     "Nullable(double)",
+		"f":         "Nullable(float)",
+		"big":       "Nullable(uint64)",
+		"d":         "Nullable(date)",
+		"t":         "Nullable(time(6))",
+		"created":   "Nullable(datetime(6))",
+		"update_at": "timestamp",
+		"y":         "Nullable(year(4))",
+		"status":    "enum('a','b')",
+		"tags":      "set('x','y')",
+		"doc":       "Nullable(json)",
+	}
+}
+
+func getDebeziumTestRow(id uint32, name string) map[string]interface{} {
+	return map[string]interface{}{
+		"id":        id,
+		"name":      name,
+		"price":     "12.30",
+		"flag":      true,
+		"score":     float64(1.5),
+		"f":         float32(2.5),
+		"big":       uint64(100),
+		"d":         "2022-10-15",
+		"t":         "18:06:31.098000",
+		"created":   "2022-10-15 18:06:31.098790",
+		"update_at": "2022-10-15 18:06:31",
+		"y":         "2022",
+		"status":    "b",
+		"tags":      []string{"x", "y"},
+		"doc":       map[string]interface{}{"key": "val"},
+	}
+}
+
+func getDebeziumTestExpectRow(id uint32, name string) map[string]interface{} {
+	return map[string]interface{}{
+		"id":        int64(id),
+		"name":      name,
+		"price":     "12.30",
+		"flag":      true,
+		"score":     float64(1.5),
+		"f":         float32(2.5),
+		"big":       int64(100),
+		"d":         "2022-10-15",
+		"t":         "18:06:31.098000",
+		"created":   "2022-10-15 18:06:31.098790",
+		"update_at": "2022-10-15 18:06:31",
+		"y":         int16(2022),
+		"status":    "b",
+		"tags":      "x,y",
+		"doc":       `{"key":"val"}`,
+	}
+}
+
+func getDebeziumTestPluginData(eventType string, rows ...map[string]interface{}) *PluginDataType {
+	return &PluginDataType{
+		Timestamp:      1665857191,
+		EventType:      eventType,
+		Rows:           rows,
+		SchemaName:     "bifrost_test",
+		TableName:      "debezium_test",
+		BinlogFileNum:  3,
+		BinlogPosition: 2820,
+		Pri:            []string{"id"},
+		ColumnMapping:  getDebeziumTestColumnMapping(),
+	}
+}
+
+// 转成 debezium 格式，再通过 NewDebezium 解析回 bifrost 格式
+func debeziumRoundTrip(data *PluginDataType) *PluginDataType {
+	value, err := ToOtherObject(data, DebeziumType)
+	So(err, ShouldBeNil)
+	key, err := ToOtherObjectKey(data, DebeziumType)
+	So(err, ShouldBeNil)
+	valueBytes, err := json.Marshal(value)
+	So(err, ShouldBeNil)
+	keyBytes, err := json.Marshal(key)
+	So(err, ShouldBeNil)
+	debezium, err := NewDebezium(keyBytes, valueBytes)
+	So(err, ShouldBeNil)
+	return debezium.ToBifrostOutputPluginData()
+}
+
+func TestPluginDataType_ToDebeziumObject(t *testing.T) {
+	Convey("insert", t, func() {
+		data := debeziumRoundTrip(getDebeziumTestPluginData("insert", getDebeziumTestRow(1, "bifrost")))
+		So(data.EventType, ShouldEqual, "insert")
+		So(data.SchemaName, ShouldEqual, "bifrost_test")
+		So(data.TableName, ShouldEqual, "debezium_test")
+		So(data.Pri, ShouldResemble, []string{"id"})
+		So(len(data.Rows), ShouldEqual, 1)
+		So(data.Rows[0], ShouldResemble, getDebeziumTestExpectRow(1, "bifrost"))
+		So(data.ColumnMapping["name"], ShouldEqual, "Nullable(text)")
+		So(data.ColumnMapping["id"], ShouldEqual, "int64")
+		So(data.ColumnMapping["status"], ShouldEqual, "enum('a','b')")
+	})
+
+	Convey("update", t, func() {
+		data := debeziumRoundTrip(getDebeziumTestPluginData("update", getDebeziumTestRow(1, "bifrost"), getDebeziumTestRow(1, "bristol")))
+		So(data.EventType, ShouldEqual, "update")
+		So(len(data.Rows), ShouldEqual, 2)
+		So(data.Rows[0], ShouldResemble, getDebeziumTestExpectRow(1, "bifrost"))
+		So(data.Rows[1], ShouldResemble, getDebeziumTestExpectRow(1, "bristol"))
+	})
+
+	Convey("delete", t, func() {
+		data := debeziumRoundTrip(getDebeziumTestPluginData("delete", getDebeziumTestRow(2, "bifrost")))
+		So(data.EventType, ShouldEqual, "delete")
+		So(len(data.Rows), ShouldEqual, 1)
+		So(data.Rows[0], ShouldResemble, getDebeziumTestExpectRow(2, "bifrost"))
+	})
+
+	Convey("null value", t, func() {
+		row := getDebeziumTestRow(3, "bifrost")
+		row["name"] = nil
+		row["created"] = nil
+		data := debeziumRoundTrip(getDebeziumTestPluginData("insert", row))
+		So(data.Rows[0]["name"], ShouldBeNil)
+		So(data.Rows[0]["created"], ShouldBeNil)
+		So(data.Rows[0]["id"], ShouldEqual, int64(3))
+	})
+
+	Convey("sql,commit 事件不输出", t, func() {
+		for _, eventType := range []string{"sql", "commit"} {
+			data := &PluginDataType{EventType: eventType, SchemaName: "bifrost_test", Query: "ALTER TABLE debezium_test ADD COLUMN c int"}
+			value, err := ToOtherObject(data, DebeziumType)
+			So(err, ShouldBeNil)
+			So(value, ShouldBeNil)
+			key, err := ToOtherObjectKey(data, DebeziumType)
+			So(err, ShouldBeNil)
+			So(key, ShouldBeNil)
+		}
+	})
+}
+
+func TestPluginDataType_ToDebeziumObject_NoSchema(t *testing.T) {
+	Convey("没有 schema 的时候只输出 payload", t, func() {
+		data := getDebeziumTestPluginData("update", getDebeziumTestRow(1, "bifrost"), getDebeziumTestRow(1, "bristol"))
+		value, err := ToOtherObject(data, DebeziumNoSchemaType)
+		So(err, ShouldBeNil)
+		valueBytes, _ := json.Marshal(value)
+		var payload DebeziumValuePayload
+		So(json.Unmarshal(valueBytes, &payload), ShouldBeNil)
+		So(payload.Op, ShouldEqual, "u")
+		So(payload.Source.Database, ShouldEqual, "bifrost_test")
+		So(payload.Source.Table, ShouldEqual, "debezium_test")
+		So(string(*payload.Before["name"]), ShouldEqual, `"bifrost"`)
+		So(string(*payload.After["name"]), ShouldEqual, `"bristol"`)
+		So(string(*payload.After["d"]), ShouldEqual, "19280")
+		So(string(*payload.After["t"]), ShouldEqual, "65191098000")
+		So(string(*payload.After["created"]), ShouldEqual, "1665857191098790")
+
+		key, err := ToOtherObjectKey(data, DebeziumNoSchemaType)
+		So(err, ShouldBeNil)
+		keyBytes, _ := json.Marshal(key)
+		So(string(keyBytes), ShouldEqual, `{"id":1}`)
+	})
+
+	Convey("没有 ColumnMapping 的时候根据值推断类型", t, func() {
+		data := &PluginDataType{
+			EventType:  "insert",
+			Rows:       []map[string]interface{}{{"id": int32(1), "name": "bifrost"}},
+			SchemaName: "bifrost_test",
+			TableName:  "debezium_test",
+			Pri:        []string{"id"},
+		}
+		value, err := data.ToDebeziumObject(true)
+		So(err, ShouldBeNil)
+		schema := value.(*DebeziumOutput).Schema.Fields[1]
+		So(schema.Field, ShouldEqual, "after")
+		So(fmt.Sprint(schema.Fields[0].Field, schema.Fields[0].Type), ShouldEqual, "idint32")
+		So(fmt.Sprint(schema.Fields[1].Field, schema.Fields[1].Type), ShouldEqual, "namestring")
+	})
+}
+
+func TestPluginDataType_ToDebeziumKeyObject_NoPri(t *testing.T) {
+	Convey("没有主键的表 key 为 nil", t, func() {
+		data := getDebeziumTestPluginData("insert", getDebeziumTestRow(1, "bifrost"))
+		data.Pri = nil
+		key, err := data.ToDebeziumKeyObject(true)
+		So(err, ShouldBeNil)
+		So(key, ShouldBeNil)
+	})
+}
@@ -0,0 +1,39 @@
+package driver
+
+import (
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// msgpack 编码的时候 int8,int16,uint32 等类型按固定长度编码，解码的时候可以还原成同样的类型
+func (c *PluginDataType) ToMsgpack() ([]byte, error) {
+	return msgpack.Marshal(c)
+}
+
+func NewPluginDataTypeByMsgpack(b []byte) (*PluginDataType, error) {
+	var data PluginDataType
+	err := msgpack.Unmarshal(b, &data)
+	if err != nil {
+		return nil, err
+	}
+	// set 类型的 []string 解码出来是 []interface{}，根据 ColumnMapping 还原
+	for name, columnType := range data.ColumnMapping {
+		if !strings.HasPrefix(columnType, "set(") && !strings.HasPrefix(columnType, "Nullable(set(") {
+			continue
+		}
+		for _, row := range data.Rows {
+			list, ok := row[name].([]interface{})
+			if !ok {
+				continue
+			}
+			strList := make([]string, 0, len(list))
+			for _, v := range list {
+				s, _ := v.(string)
+				strList = append(strList, s)
+			}
+			row[name] = strList
+		}
+	}
+	return &data, nil
+}
@@ -1,6 +1,9 @@
 package driver
 
-import "fmt"
+import (
+	"encoding/json"
+	"fmt"
+)
 
 type OtherObjectType string
 
@@ -8,6 +11,14 @@ const (
 	CanalType    OtherObjectType = "canal"
 	BifrostType  OtherObjectType = "bifrost"
 	TableMapType OtherObjectType = "tableMap"
+	// debezium 格式，包括 schema 和 payload
+	DebeziumType OtherObjectType = "debezium"
+	// debezium 格式，只有 payload，对应 debezium 中 schemas.enable=false
+	DebeziumNoSchemaType OtherObjectType = "debeziumNoSchema"
+	// 二进制格式，对应 bifrost_event.proto 中的 Event
+	ProtobufType OtherObjectType = "protobuf"
+	// 二进制格式，PluginDataType 的 msgpack 编码
+	MsgpackType OtherObjectType = "msgpack"
 )
 
 type OtherOutputType struct {
@@ -18,7 +29,7 @@ type OtherOutputType struct {
 var otherOutputTypesList []OtherOutputType
 
 func init() {
-	otherOutputTypesList = make([]OtherOutputType, 3)
+	otherOutputTypesList = make([]OtherOutputType, 7)
 	otherOutputTypesList[0] = OtherOutputType{
 		Name:  string(BifrostType),
 		Value: "",
@@ -31,6 +42,22 @@ func init() {
 		Name:  string(TableMapType),
 		Value: string(TableMapType),
 	}
+	otherOutputTypesList[3] = OtherOutputType{
+		Name:  string(DebeziumType),
+		Value: string(DebeziumType),
+	}
+	otherOutputTypesList[4] = OtherOutputType{
+		Name:  string(DebeziumNoSchemaType),
+		Value: string(DebeziumNoSchemaType),
+	}
+	otherOutputTypesList[5] = OtherOutputType{
+		Name:  string(ProtobufType),
+		Value: string(ProtobufType),
+	}
+	otherOutputTypesList[6] = OtherOutputType{
+		Name:  string(MsgpackType),
+		Value: string(MsgpackType),
+	}
 
 }
 
@@ -38,6 +65,7 @@ func GetSupportedOtherOutputTypeList() []OtherOutputType {
 	return otherOutputTypesList
 }
 
+// 返回 nil 的时候，说明该格式下这个事件不需要发送，比如 debezium 格式下的 sql,commit 事件
 func ToOtherObject(data *PluginDataType, otherObjectType OtherObjectType) (interface{}, error) {
 	switch otherObjectType {
 	case BifrostType:
@@ -46,6 +74,47 @@ func ToOtherObject(data *PluginDataType, otherObjectType OtherObjectType) (inter
 		return data.ToCanalJsonObject()
 	case TableMapType:
 		return data.ToTableMapObject()
+	case DebeziumType:
+		return data.ToDebeziumObject(true)
+	case DebeziumNoSchemaType:
+		return data.ToDebeziumObject(false)
 	}
 	return data, fmt.Errorf("not supported %s", otherObjectType)
 }
+
+// 消息的 key, 只有 debezium 格式有默认的 key , 其他格式返回 nil
+func ToOtherObjectKey(data *PluginDataType, otherObjectType OtherObjectType) (interface{}, error) {
+	switch otherObjectType {
+	case DebeziumType:
+		return data.ToDebeziumKeyObject(true)
+	case DebeziumNoSchemaType:
+		return data.ToDebeziumKeyObject(false)
+	}
+	return nil, nil
+}
+
+// 转成需要发送的数据，protobuf,msgpack 为二进制格式，其他格式为 json
+// 返回 nil 的时候，说明该格式下这个事件不需要发送
+func ToOtherObjectBytes(data *PluginDataType, otherObjectType OtherObjectType) ([]byte, error) {
+	switch otherObjectType {
+	case ProtobufType:
+		return data.ToProtobuf()
+	case MsgpackType:
+		return data.ToMsgpack()
+	}
+	toOtherObjectTypeData, _ := ToOtherObject(data, otherObjectType)
+	if toOtherObjectTypeData == nil {
+		return nil, nil
+	}
+	return json.Marshal(toOtherObjectTypeData)
+}
+
+func GetOtherObjectContentType(otherObjectType OtherObjectType) string {
+	switch otherObjectType {
+	case ProtobufType:
+		return "application/x-protobuf"
+	case MsgpackType:
+		return "application/msgpack"
+	}
+	return "application/json"
+}
@@ -0,0 +1,421 @@
+package driver
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// 字段编号和 bifrost_event.proto 保持一致
+
+const (
+	pbValueTypeNull int32 = iota
+	pbValueTypeString
+	pbValueTypeInt8
+	pbValueTypeInt16
+	pbValueTypeInt32
+	pbValueTypeInt64
+	pbValueTypeInt
+	pbValueTypeUint8
+	pbValueTypeUint16
+	pbValueTypeUint32
+	pbValueTypeUint64
+	pbValueTypeUint
+	pbValueTypeFloat32
+	pbValueTypeFloat64
+	pbValueTypeBool
+	pbValueTypeBytes
+	pbValueTypeStringList
+	pbValueTypeJson
+)
+
+func pbAppendString(b []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+func pbAppendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func pbAppendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+func pbEncodeValue(val interface{}) []byte {
+	var b []byte
+	var valueType int32
+	switch v := val.(type) {
+	case nil:
+		valueType = pbValueTypeNull
+	case string:
+		valueType = pbValueTypeString
+		b = pbAppendString(b, 7, v)
+	case int8:
+		valueType = pbValueTypeInt8
+		b = pbAppendVarint(b, 2, protowire.EncodeZigZag(int64(v)))
+	case int16:
+		valueType = pbValueTypeInt16
+		b = pbAppendVarint(b, 2, protowire.EncodeZigZag(int64(v)))
+	case int32:
+		valueType = pbValueTypeInt32
+		b = pbAppendVarint(b, 2, protowire.EncodeZigZag(int64(v)))
+	case int64:
+		valueType = pbValueTypeInt64
+		b = pbAppendVarint(b, 2, protowire.EncodeZigZag(v))
+	case int:
+		valueType = pbValueTypeInt
+		b = pbAppendVarint(b, 2, protowire.EncodeZigZag(int64(v)))
+	case uint8:
+		valueType = pbValueTypeUint8
+		b = pbAppendVarint(b, 3, uint64(v))
+	case uint16:
+		valueType = pbValueTypeUint16
+		b = pbAppendVarint(b, 3, uint64(v))
+	case uint32:
+		valueType = pbValueTypeUint32
+		b = pbAppendVarint(b, 3, uint64(v))
+	case uint64:
+		valueType = pbValueTypeUint64
+		b = pbAppendVarint(b, 3, v)
+	case uint:
+		valueType = pbValueTypeUint
+		b = pbAppendVarint(b, 3, uint64(v))
+	case float32:
+		valueType = pbValueTypeFloat32
+		if v != 0 {
+			b = protowire.AppendTag(b, 5, protowire.Fixed32Type)
+			b = protowire.AppendFixed32(b, math.Float32bits(v))
+		}
+	case float64:
+		valueType = pbValueTypeFloat64
+		if v != 0 {
+			b = protowire.AppendTag(b, 4, protowire.Fixed64Type)
+			b = protowire.AppendFixed64(b, math.Float64bits(v))
+		}
+	case bool:
+		valueType = pbValueTypeBool
+		if v {
+			b = pbAppendVarint(b, 6, 1)
+		}
+	case []byte:
+		valueType = pbValueTypeBytes
+		if len(v) > 0 {
+			b = protowire.AppendTag(b, 8, protowire.BytesType)
+			b = protowire.AppendBytes(b, v)
+		}
+	case []string:
+		valueType = pbValueTypeStringList
+		for _, s := range v {
+			b = protowire.AppendTag(b, 9, protowire.BytesType)
+			b = protowire.AppendString(b, s)
+		}
+	default:
+		valueType = pbValueTypeJson
+		c, err := json.Marshal(v)
+		if err != nil {
+			c = []byte(fmt.Sprint(v))
+		}
+		b = pbAppendString(b, 7, string(c))
+	}
+	return append(pbAppendVarint(nil, 1, uint64(valueType)), b...)
+}
+
+// map 按 key 排序编码，保证同样的数据编码结果一致
+func pbEncodeRow(row map[string]interface{}) []byte {
+	keys := make([]string, 0, len(row))
+	for k := range row {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b []byte
+	for _, k := range keys {
+		var entry []byte
+		entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+		entry = protowire.AppendString(entry, k)
+		entry = pbAppendMessage(entry, 2, pbEncodeValue(row[k]))
+		b = pbAppendMessage(b, 1, entry)
+	}
+	return b
+}
+
+func (c *PluginDataType) ToProtobuf() ([]byte, error) {
+	var b []byte
+	b = pbAppendVarint(b, 1, uint64(c.Timestamp))
+	b = pbAppendVarint(b, 2, uint64(c.EventSize))
+	b = pbAppendString(b, 3, c.EventType)
+	for _, row := range c.Rows {
+		b = pbAppendMessage(b, 4, pbEncodeRow(row))
+	}
+	b = pbAppendString(b, 5, c.Query)
+	b = pbAppendString(b, 6, c.SchemaName)
+	b = pbAppendString(b, 7, c.TableName)
+	b = pbAppendString(b, 8, c.AliasSchemaName)
+	b = pbAppendString(b, 9, c.AliasTableName)
+	b = pbAppendVarint(b, 10, uint64(int64(c.BinlogFileNum)))
+	b = pbAppendVarint(b, 11, uint64(c.BinlogPosition))
+	b = pbAppendString(b, 12, c.Gtid)
+	for _, pri := range c.Pri {
+		b = protowire.AppendTag(b, 13, protowire.BytesType)
+		b = protowire.AppendString(b, pri)
+	}
+	b = pbAppendVarint(b, 14, c.EventID)
+	names := make([]string, 0, len(c.ColumnMapping))
+	for name := range c.ColumnMapping {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var entry []byte
+		entry = pbAppendString(entry, 1, name)
+		entry = pbAppendString(entry, 2, c.ColumnMapping[name])
+		b = pbAppendMessage(b, 15, entry)
+	}
+	for _, columns := range c.PresentColumns {
+		var entry []byte
+		if columns == nil {
+			entry = pbAppendVarint(entry, 1, 1)
+		}
+		for _, column := range columns {
+			entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+			entry = protowire.AppendString(entry, column)
+		}
+		b = pbAppendMessage(b, 16, entry)
+	}
+	return b, nil
+}
+
+// 按字段遍历 protobuf 数据，未知的字段跳过
+func pbRangeFields(b []byte, f func(num protowire.Number, typ protowire.Type, v uint64, data []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		var v uint64
+		var data []byte
+		switch typ {
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed32Type:
+			var v32 uint32
+			v32, n = protowire.ConsumeFixed32(b)
+			v = uint64(v32)
+		case protowire.Fixed64Type:
+			v, n = protowire.ConsumeFixed64(b)
+		case protowire.BytesType:
+			data, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if err := f(num, typ, v, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func pbDecodeValue(b []byte) (interface{}, error) {
+	var valueType int32
+	var intVal int64
+	var uintVal uint64
+	var float32Val float32
+	var float64Val float64
+	var boolVal bool
+	var stringVal string
+	var bytesVal []byte
+	var stringListVal []string
+	err := pbRangeFields(b, func(num protowire.Number, typ protowire.Type, v uint64, data []byte) error {
+		switch num {
+		case 1:
+			valueType = int32(v)
+		case 2:
+			intVal = protowire.DecodeZigZag(v)
+		case 3:
+			uintVal = v
+		case 4:
+			float64Val = math.Float64frombits(v)
+		case 5:
+			float32Val = math.Float32frombits(uint32(v))
+		case 6:
+			boolVal = v != 0
+		case 7:
+			stringVal = string(data)
+		case 8:
+			bytesVal = append([]byte{}, data...)
+		case 9:
+			stringListVal = append(stringListVal, string(data))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	switch valueType {
+	case pbValueTypeNull:
+		return nil, nil
+	case pbValueTypeString:
+		return stringVal, nil
+	case pbValueTypeInt8:
+		return int8(intVal), nil
+	case pbValueTypeInt16:
+		return int16(intVal), nil
+	case pbValueTypeInt32:
+		return int32(intVal), nil
+	case pbValueTypeInt64:
+		return intVal, nil
+	case pbValueTypeInt:
+		return int(intVal), nil
+	case pbValueTypeUint8:
+		return uint8(uintVal), nil
+	case pbValueTypeUint16:
+		return uint16(uintVal), nil
+	case pbValueTypeUint32:
+		return uint32(uintVal), nil
+	case pbValueTypeUint64:
+		return uintVal, nil
+	case pbValueTypeUint:
+		return uint(uintVal), nil
+	case pbValueTypeFloat32:
+		return float32Val, nil
+	case pbValueTypeFloat64:
+		return float64Val, nil
+	case pbValueTypeBool:
+		return boolVal, nil
+	case pbValueTypeBytes:
+		if bytesVal == nil {
+			bytesVal = []byte{}
+		}
+		return bytesVal, nil
+	case pbValueTypeStringList:
+		if stringListVal == nil {
+			stringListVal = []string{}
+		}
+		return stringListVal, nil
+	case pbValueTypeJson:
+		var jsonVal interface{}
+		if err = json.Unmarshal([]byte(stringVal), &jsonVal); err != nil {
+			return nil, err
+		}
+		return jsonVal, nil
+	}
+	return nil, fmt.Errorf("protobuf value type:%d not supported", valueType)
+}
+
+func pbDecodeMapEntry(b []byte) (key string, value []byte, err error) {
+	err = pbRangeFields(b, func(num protowire.Number, typ protowire.Type, v uint64, data []byte) error {
+		switch num {
+		case 1:
+			key = string(data)
+		case 2:
+			value = data
+		}
+		return nil
+	})
+	return
+}
+
+func pbDecodeRow(b []byte) (map[string]interface{}, error) {
+	row := make(map[string]interface{}, 0)
+	err := pbRangeFields(b, func(num protowire.Number, typ protowire.Type, v uint64, data []byte) error {
+		if num != 1 {
+			return nil
+		}
+		key, value, err := pbDecodeMapEntry(data)
+		if err != nil {
+			return err
+		}
+		row[key], err = pbDecodeValue(value)
+		return err
+	})
+	return row, err
+}
+
+func NewPluginDataTypeByProtobuf(b []byte) (*PluginDataType, error) {
+	data := &PluginDataType{}
+	err := pbRangeFields(b, func(num protowire.Number, typ protowire.Type, v uint64, b []byte) error {
+		switch num {
+		case 1:
+			data.Timestamp = uint32(v)
+		case 2:
+			data.EventSize = uint32(v)
+		case 3:
+			data.EventType = string(b)
+		case 4:
+			row, err := pbDecodeRow(b)
+			if err != nil {
+				return err
+			}
+			data.Rows = append(data.Rows, row)
+		case 5:
+			data.Query = string(b)
+		case 6:
+			data.SchemaName = string(b)
+		case 7:
+			data.TableName = string(b)
+		case 8:
+			data.AliasSchemaName = string(b)
+		case 9:
+			data.AliasTableName = string(b)
+		case 10:
+			data.BinlogFileNum = int(int64(v))
+		case 11:
+			data.BinlogPosition = uint32(v)
+		case 12:
+			data.Gtid = string(b)
+		case 13:
+			data.Pri = append(data.Pri, string(b))
+		case 14:
+			data.EventID = v
+		case 15:
+			key, value, err := pbDecodeMapEntry(b)
+			if err != nil {
+				return err
+			}
+			if data.ColumnMapping == nil {
+				data.ColumnMapping = make(map[string]string, 0)
+			}
+			data.ColumnMapping[key] = string(value)
+		case 16:
+			var full bool
+			columns := make([]string, 0)
+			err := pbRangeFields(b, func(num protowire.Number, typ protowire.Type, v uint64, b []byte) error {
+				switch num {
+				case 1:
+					full = v != 0
+				case 2:
+					columns = append(columns, string(b))
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if full {
+				columns = nil
+			}
+			data.PresentColumns = append(data.PresentColumns, columns)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,126 @@
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bufbuild/protocompile"
+	. "github.com/smartystreets/goconvey/convey"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// 用 bifrost_event.proto 编译出来的描述信息解码 ToProtobuf 的数据，防止手写的编码和 .proto 文件不一致
+func getBifrostEventDescriptor() (protoreflect.MessageDescriptor, error) {
+	compiler := protocompile.Compiler{
+		Resolver: &protocompile.SourceResolver{},
+	}
+	files, err := compiler.Compile(context.Background(), "bifrost_event.proto")
+	if err != nil {
+		return nil, err
+	}
+	return files[0].Messages().ByName("Event"), nil
+}
+
+// 所有字段都要在 .proto 中有定义
+func pbHasUnknownFields(msg protoreflect.Message) bool {
+	if len(msg.GetUnknown()) > 0 {
+		return true
+	}
+	var unknown bool
+	msg.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case fd.IsMap():
+			if fd.MapValue().Message() != nil {
+				v.Map().Range(func(_ protoreflect.MapKey, mv protoreflect.Value) bool {
+					unknown = pbHasUnknownFields(mv.Message())
+					return !unknown
+				})
+			}
+		case fd.IsList():
+			if fd.Message() != nil {
+				for i := 0; i < v.List().Len() && !unknown; i++ {
+					unknown = pbHasUnknownFields(v.List().Get(i).Message())
+				}
+			}
+		case fd.Message() != nil:
+			unknown = pbHasUnknownFields(v.Message())
+		}
+		return !unknown
+	})
+	return unknown
+}
+
+func TestPluginDataType_ToProtobuf_Descriptor(t *testing.T) {
+	desc, err := getBifrostEventDescriptor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	Convey("按 bifrost_event.proto 解码", t, func() {
+		data := getBinaryTestPluginData()
+		b, err := data.ToProtobuf()
+		So(err, ShouldBeNil)
+
+		event := dynamicpb.NewMessage(desc)
+		So(proto.Unmarshal(b, event), ShouldBeNil)
+		So(pbHasUnknownFields(event), ShouldBeFalse)
+
+		fields := desc.Fields()
+		So(event.Get(fields.ByName("event_type")).String(), ShouldEqual, data.EventType)
+		So(event.Get(fields.ByName("schema_name")).String(), ShouldEqual, data.SchemaName)
+		So(event.Get(fields.ByName("alias_table_name")).String(), ShouldEqual, data.AliasTableName)
+		So(event.Get(fields.ByName("binlog_file_num")).Int(), ShouldEqual, int64(data.BinlogFileNum))
+		So(event.Get(fields.ByName("binlog_position")).Uint(), ShouldEqual, uint64(data.BinlogPosition))
+		So(event.Get(fields.ByName("event_id")).Uint(), ShouldEqual, data.EventID)
+		So(event.Get(fields.ByName("gtid")).String(), ShouldEqual, data.Gtid)
+		So(event.Get(fields.ByName("column_mapping")).Map().Get(protoreflect.ValueOfString("tags").MapKey()).String(), ShouldEqual, data.ColumnMapping["tags"])
+
+		rows := event.Get(fields.ByName("rows")).List()
+		So(rows.Len(), ShouldEqual, len(data.Rows))
+		rowDesc := desc.Fields().ByName("rows").Message()
+		valueDesc := rowDesc.Fields().ByName("columns").MapValue().Message()
+		getValue := func(rowIndex int, column string) protoreflect.Message {
+			columns := rows.Get(rowIndex).Message().Get(rowDesc.Fields().ByName("columns")).Map()
+			return columns.Get(protoreflect.ValueOfString(column).MapKey()).Message()
+		}
+		getType := func(v protoreflect.Message) string {
+			typeField := valueDesc.Fields().ByName("type")
+			return string(typeField.Enum().Values().ByNumber(v.Get(typeField).Enum()).Name())
+		}
+		v := getValue(0, "int32")
+		So(getType(v), ShouldEqual, "INT32")
+		So(v.Get(valueDesc.Fields().ByName("int_value")).Int(), ShouldEqual, -32)
+		v = getValue(0, "uint64")
+		So(getType(v), ShouldEqual, "UINT64")
+		So(v.Get(valueDesc.Fields().ByName("uint_value")).Uint(), ShouldEqual, uint64(18446744073709551615))
+		v = getValue(0, "float32")
+		So(getType(v), ShouldEqual, "FLOAT32")
+		So(v.Get(valueDesc.Fields().ByName("float_value")).Float(), ShouldEqual, 1.5)
+		v = getValue(0, "float64")
+		So(getType(v), ShouldEqual, "FLOAT64")
+		So(v.Get(valueDesc.Fields().ByName("double_value")).Float(), ShouldEqual, -2.25)
+		v = getValue(0, "bool")
+		So(getType(v), ShouldEqual, "BOOL")
+		So(v.Get(valueDesc.Fields().ByName("bool_value")).Bool(), ShouldBeTrue)
+		So(getType(getValue(0, "null")), ShouldEqual, "NULL")
+		v = getValue(1, "tags")
+		So(getType(v), ShouldEqual, "STRING_LIST")
+		So(v.Get(valueDesc.Fields().ByName("string_list_value")).List().Len(), ShouldEqual, 2)
+		v = getValue(1, "json")
+		So(getType(v), ShouldEqual, "JSON")
+		So(v.Get(valueDesc.Fields().ByName("string_value")).String(), ShouldEqual, `{"key":"val","list":["a",true]}`)
+
+		presentColumns := event.Get(fields.ByName("present_columns")).List()
+		So(presentColumns.Len(), ShouldEqual, 2)
+		presentDesc := fields.ByName("present_columns").Message()
+		So(presentColumns.Get(0).Message().Get(presentDesc.Fields().ByName("full")).Bool(), ShouldBeFalse)
+		So(presentColumns.Get(0).Message().Get(presentDesc.Fields().ByName("columns")).List().Len(), ShouldEqual, 2)
+		So(presentColumns.Get(1).Message().Get(presentDesc.Fields().ByName("full")).Bool(), ShouldBeTrue)
+
+		// 按 .proto 重新编码，结果要一样
+		b2, err := proto.MarshalOptions{Deterministic: true}.Marshal(event)
+		So(err, ShouldBeNil)
+		So(b2, ShouldResemble, b)
+	})
+}
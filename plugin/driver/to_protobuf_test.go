@@ -0,0 +1,136 @@
+package driver
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func getBinaryTestPluginData() *PluginDataType {
+	return &PluginDataType{
+		Timestamp:       1665857191,
+		EventSize:       100,
+		EventType:       "update",
+		SchemaName:      "bifrost_test",
+		TableName:       "binlog_field_test",
+		AliasSchemaName: "alias_db",
+		AliasTableName:  "alias_table",
+		BinlogFileNum:   3,
+		BinlogPosition:  2820,
+		Gtid:            "04038bcc-fd0c-11e7-9cc5-000c29db6599:1-18",
+		Pri:             []string{"id"},
+		EventID:         99,
+		ColumnMapping: map[string]string{
+			"id":   "uint32",
+			"name": "Nullable(varchar(20))",
+			"tags": "set('x','y')",
+		},
+		Rows: []map[string]interface{}{
+			{
+				"id":        uint32(1),
+				"name":      "bifrost",
+				"tags":      []string{"x"},
+				"int8":      int8(-8),
+				"int16":     int16(-16),
+				"int32":     int32(-32),
+				"int64":     int64(-64),
+				"uint8":     uint8(8),
+				"uint16":    uint16(16),
+				"uint64":    uint64(18446744073709551615),
+				"float32":   float32(1.5),
+				"float64":   float64(-2.25),
+				"bool":      true,
+				"null":      nil,
+				"empty_str": "",
+				"zero":      int32(0),
+			},
+			{
+				"id":   uint32(1),
+				"name": "bristol",
+				"tags": []string{"x", "y"},
+				"json": map[string]interface{}{"key": "val", "list": []interface{}{"a", true}},
+			},
+		},
+		PresentColumns: [][]string{{"id", "name"}, nil},
+	}
+}
+
+func TestPluginDataType_ToProtobuf(t *testing.T) {
+	Convey("编码之后再解码，数据一致", t, func() {
+		data := getBinaryTestPluginData()
+		b, err := data.ToProtobuf()
+		So(err, ShouldBeNil)
+		newData, err := NewPluginDataTypeByProtobuf(b)
+		So(err, ShouldBeNil)
+		So(newData, ShouldResemble, data)
+	})
+
+	Convey("sql 事件", t, func() {
+		data := &PluginDataType{EventType: "sql", SchemaName: "bifrost_test", Query: "ALTER TABLE binlog_field_test ADD COLUMN c int"}
+		b, err := data.ToProtobuf()
+		So(err, ShouldBeNil)
+		newData, err := NewPluginDataTypeByProtobuf(b)
+		So(err, ShouldBeNil)
+		So(newData, ShouldResemble, data)
+	})
+
+	Convey("和 bifrost_event.proto 中的字段编号一致", t, func() {
+		data := &PluginDataType{EventType: "insert", Rows: []map[string]interface{}{{"id": int32(-1)}}}
+		b, _ := data.ToProtobuf()
+		var expect []byte
+		expect = protowire.AppendTag(expect, 3, protowire.BytesType)
+		expect = protowire.AppendString(expect, "insert")
+		// Row{columns:{"id":Value{type:INT32,int_value:-1}}}
+		value := []byte{1<<3 | 0, 4, 2<<3 | 0, 1}
+		entry := []byte{1<<3 | 2, 2, 'i', 'd', 2<<3 | 2, byte(len(value))}
+		entry = append(entry, value...)
+		row := append([]byte{1<<3 | 2, byte(len(entry))}, entry...)
+		expect = protowire.AppendTag(expect, 4, protowire.BytesType)
+		expect = protowire.AppendBytes(expect, row)
+		So(b, ShouldResemble, expect)
+	})
+
+	Convey("数据错误", t, func() {
+		_, err := NewPluginDataTypeByProtobuf([]byte{0xff})
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestPluginDataType_ToMsgpack(t *testing.T) {
+	Convey("编码之后再解码，数据一致", t, func() {
+		data := getBinaryTestPluginData()
+		b, err := data.ToMsgpack()
+		So(err, ShouldBeNil)
+		newData, err := NewPluginDataTypeByMsgpack(b)
+		So(err, ShouldBeNil)
+		So(newData, ShouldResemble, data)
+	})
+
+	Convey("数据错误", t, func() {
+		_, err := NewPluginDataTypeByMsgpack([]byte{0xc1})
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestToOtherObjectBytes(t *testing.T) {
+	Convey("二进制格式", t, func() {
+		data := getBinaryTestPluginData()
+		b, err := ToOtherObjectBytes(data, ProtobufType)
+		So(err, ShouldBeNil)
+		pb, _ := data.ToProtobuf()
+		So(b, ShouldResemble, pb)
+		So(GetOtherObjectContentType(ProtobufType), ShouldEqual, "application/x-protobuf")
+		So(GetOtherObjectContentType(MsgpackType), ShouldEqual, "application/msgpack")
+		So(GetOtherObjectContentType(CanalType), ShouldEqual, "application/json")
+	})
+
+	Convey("json 格式", t, func() {
+		b, err := ToOtherObjectBytes(&PluginDataType{EventType: "commit"}, DebeziumType)
+		So(err, ShouldBeNil)
+		So(b, ShouldBeNil)
+		b, err = ToOtherObjectBytes(&PluginDataType{EventType: "commit"}, BifrostType)
+		So(err, ShouldBeNil)
+		So(string(b), ShouldContainSubstring, `"EventType":"commit"`)
+	})
+}
@@ -1,8 +1,10 @@
 package src
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
 	"time"
@@ -37,6 +39,7 @@ const (
 type PluginParam struct {
 	Timeout            int
 	ContentType        HttpContentType
+	OtherObjectType    pluginDriver.OtherObjectType
 	BifrostFilterQuery bool // bifrost server 保留,是否过滤sql事件
 }
 
@@ -142,13 +145,24 @@ func (This *Conn) httpPost(data *pluginDriver.PluginDataType) error {
 	var err error
 	switch This.p.ContentType {
 	case HTTP_CONTENT_TYPE_JSON_RAW:
-		c, err := json.Marshal(data)
+		c, err := pluginDriver.ToOtherObjectBytes(data, This.p.OtherObjectType)
 		if err != nil {
 			return err
 		}
-		body := strings.NewReader("\n" + string(c))
+		// 当前格式下不需要发送的事件，比如 debezium 格式下的 sql,commit 事件
+		if c == nil {
+			return nil
+		}
+		contentType := pluginDriver.GetOtherObjectContentType(This.p.OtherObjectType)
+		var body io.Reader
+		if contentType == "application/json" {
+			body = strings.NewReader("\n" + string(c))
+		} else {
+			// 二进制格式不能在前面加换行
+			body = bytes.NewReader(c)
+		}
 		req, err = http.NewRequest("POST", This.url, body)
-		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Content-Type", contentType)
 		break
 	default:
 		return fmt.Errorf("only support application/json(raw)")
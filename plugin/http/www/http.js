@@ -3,8 +3,35 @@ function doGetPluginParam(){
 	var result = {data:{},status:true,msg:"success",batchSupport:true};
     data["ContentType"]  = $("#Http_Plugin_Contair #Http_ContentType").val();
     data["Timeout"] = parseInt($("#Http_Plugin_Contair #Http_TimeOut").val());
+    data["OtherObjectType"] = $("#Http_OtherObjectType").val();
     result.data = data;
 	return result;
 }
 
+function initHttpSupportedOtherOutputTypeList(){
+    $.get(
+        "/plugin/getSupportedOtherOutputTypeList",
+        function (d, status) {
+            if (status != "success") {
+                return false;
+            }
+            var html = "";
+            var defaultValue = null;
+            for (var i in d) {
+                var typeName = d[i].name;
+                var value = d[i].value;
+                if (defaultValue == null) {
+                    defaultValue = value
+                }
+                html += "<option value=\"" + value + "\">" + typeName + "</option>";
+            }
+            $("#Http_OtherObjectType").html(html);
+            if (defaultValue != null) {
+                $("#Http_OtherObjectType").val(defaultValue);
+            }
+        }, 'json');
+}
+
+initHttpSupportedOtherOutputTypeList();
+
 setPluginParamDefault("FilterQuery",false);
\ No newline at end of file
@@ -0,0 +1,414 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package src
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+)
+
+/*
+avro 格式的 value ,一条消息对应一行数据
+insert,update 取 after image , delete 取 before image
+字段全部为 ["null",type] 并且 default 为 null ,表结构变更新增字段的时候, schema 兼容旧版本
+另外增加 __op,__schema_name,__table_name,__timestamp,__binlog_file_num,__binlog_position 几个字段
+*/
+
+const (
+	avroFieldOp             = "__op"
+	avroFieldSchemaName     = "__schema_name"
+	avroFieldTableName      = "__table_name"
+	avroFieldTimestamp      = "__timestamp"
+	avroFieldBinlogFileNum  = "__binlog_file_num"
+	avroFieldBinlogPosition = "__binlog_position"
+)
+
+type AvroSchema struct {
+	Type      string       `json:"type"`
+	Name      string       `json:"name"`
+	Namespace string       `json:"namespace,omitempty"`
+	Fields    []*AvroField `json:"fields"`
+}
+
+type AvroField struct {
+	Name    string      `json:"name"`
+	Type    interface{} `json:"type"`
+	Default interface{} `json:"default"`
+	// 原始的字段名，字段名不符合 avro 规范的时候，Name 会被替换
+	column   string
+	avroType *avroLogicalType
+}
+
+type avroLogicalType struct {
+	Type        string `json:"type"`
+	LogicalType string `json:"logicalType,omitempty"`
+	Precision   int    `json:"precision,omitempty"`
+	Scale       int    `json:"scale,omitempty"`
+}
+
+var avroNameReg = regexp.MustCompile("[^A-Za-z0-9_]")
+
+// avro 的 name 只能是 [A-Za-z_][A-Za-z0-9_]*
+func avroName(name string) string {
+	name = avroNameReg.ReplaceAllString(name, "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
+
+func (schema *AvroSchema) FullName() string {
+	if schema.Namespace == "" {
+		return schema.Name
+	}
+	return schema.Namespace + "." + schema.Name
+}
+
+func (schema *AvroSchema) String() string {
+	b, _ := json.Marshal(schema)
+	return string(b)
+}
+
+// 根据 ToCanalJsonMysqlAndSqlType 中的 mysql 类型转成 avro 类型
+func getAvroType(mysqlType string) *avroLogicalType {
+	mysqlType = strings.ToLower(mysqlType)
+	unsigned := strings.Contains(mysqlType, "unsigned")
+	baseType := strings.TrimSpace(strings.Split(mysqlType, "(")[0])
+	switch baseType {
+	case "tinyint":
+		if strings.HasPrefix(mysqlType, "tinyint(1)") && !unsigned {
+			return &avroLogicalType{Type: "boolean"}
+		}
+		return &avroLogicalType{Type: "int"}
+	case "bool", "boolean":
+		return &avroLogicalType{Type: "boolean"}
+	case "smallint", "mediumint", "year":
+		return &avroLogicalType{Type: "int"}
+	case "int", "integer":
+		if unsigned {
+			return &avroLogicalType{Type: "long"}
+		}
+		return &avroLogicalType{Type: "int"}
+	case "bigint":
+		if unsigned {
+			return &avroLogicalType{Type: "bytes", LogicalType: "decimal", Precision: 20, Scale: 0}
+		}
+		return &avroLogicalType{Type: "long"}
+	case "bit":
+		return &avroLogicalType{Type: "long"}
+	case "float":
+		return &avroLogicalType{Type: "float"}
+	case "double", "real":
+		return &avroLogicalType{Type: "double"}
+	case "decimal", "numeric":
+		precision, scale := 10, 0
+		if i := strings.Index(mysqlType, "("); i > 0 {
+			arr := strings.Split(strings.Split(mysqlType[i+1:], ")")[0], ",")
+			precision, _ = strconv.Atoi(strings.TrimSpace(arr[0]))
+			if len(arr) > 1 {
+				scale, _ = strconv.Atoi(strings.TrimSpace(arr[1]))
+			}
+		}
+		return &avroLogicalType{Type: "bytes", LogicalType: "decimal", Precision: precision, Scale: scale}
+	case "date":
+		return &avroLogicalType{Type: "int", LogicalType: "date"}
+	case "time":
+		return &avroLogicalType{Type: "long", LogicalType: "time-micros"}
+	case "datetime", "timestamp":
+		return &avroLogicalType{Type: "long", LogicalType: "timestamp-micros"}
+	}
+	return &avroLogicalType{Type: "string"}
+}
+
+func (t *avroLogicalType) schemaType() interface{} {
+	if t.LogicalType == "" {
+		return t.Type
+	}
+	return t
+}
+
+func newAvroNullableField(column string, t *avroLogicalType) *AvroField {
+	return &AvroField{
+		Name:     avroName(column),
+		Type:     []interface{}{"null", t.schemaType()},
+		Default:  nil,
+		column:   column,
+		avroType: t,
+	}
+}
+
+func newAvroMetaField(name string, t string) *AvroField {
+	field := newAvroNullableField(name, &avroLogicalType{Type: t})
+	field.column = ""
+	return field
+}
+
+// 字段按名字排序，保证同一个表结构生成的 schema 一致
+func GetAvroSchema(data *pluginDriver.PluginDataType) *AvroSchema {
+	schema := &AvroSchema{
+		Type:      "record",
+		Name:      avroName(data.TableName),
+		Namespace: "bifrost." + avroName(data.SchemaName),
+	}
+	mysqlTypeMap, _ := data.ToCanalJsonMysqlAndSqlType()
+	var columns []string
+	if mysqlTypeMap != nil {
+		for name := range mysqlTypeMap {
+			columns = append(columns, name)
+		}
+	} else if len(data.Rows) > 0 {
+		for name := range data.Rows[len(data.Rows)-1] {
+			columns = append(columns, name)
+		}
+	}
+	sort.Strings(columns)
+	for _, name := range columns {
+		schema.Fields = append(schema.Fields, newAvroNullableField(name, getAvroType(mysqlTypeMap[name])))
+	}
+	schema.Fields = append(schema.Fields,
+		newAvroMetaField(avroFieldOp, "string"),
+		newAvroMetaField(avroFieldSchemaName, "string"),
+		newAvroMetaField(avroFieldTableName, "string"),
+		newAvroMetaField(avroFieldTimestamp, "long"),
+		newAvroMetaField(avroFieldBinlogFileNum, "int"),
+		newAvroMetaField(avroFieldBinlogPosition, "long"),
+	)
+	return schema
+}
+
+func getAvroRow(data *pluginDriver.PluginDataType) map[string]interface{} {
+	if len(data.Rows) == 0 {
+		return nil
+	}
+	switch data.EventType {
+	case "insert", "update", "delete":
+		return data.Rows[len(data.Rows)-1]
+	}
+	return nil
+}
+
+// avro binary encoding, 不包括 confluent 的 magic byte 和 schema id
+func (schema *AvroSchema) Encode(data *pluginDriver.PluginDataType) ([]byte, error) {
+	row := getAvroRow(data)
+	if row == nil {
+		return nil, fmt.Errorf("EventType:%s not supported avro", data.EventType)
+	}
+	var buf bytes.Buffer
+	for _, field := range schema.Fields {
+		var val interface{}
+		if field.column != "" {
+			val = row[field.column]
+		} else {
+			switch field.Name {
+			case avroFieldOp:
+				val = data.EventType
+			case avroFieldSchemaName:
+				val = data.SchemaName
+			case avroFieldTableName:
+				val = data.TableName
+			case avroFieldTimestamp:
+				val = int64(data.Timestamp) * 1000
+			case avroFieldBinlogFileNum:
+				val = data.BinlogFileNum
+			case avroFieldBinlogPosition:
+				val = data.BinlogPosition
+			}
+		}
+		if err := avroWriteNullable(&buf, field.avroType, val); err != nil {
+			return nil, fmt.Errorf("field:%s %s", field.column, err.Error())
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func avroWriteLong(buf *bytes.Buffer, n int64) {
+	var b [binary.MaxVarintLen64]byte
+	buf.Write(b[:binary.PutVarint(b[:], n)])
+}
+
+func avroWriteBytes(buf *bytes.Buffer, b []byte) {
+	avroWriteLong(buf, int64(len(b)))
+	buf.Write(b)
+}
+
+// union ["null",type] , null 的下标为 0
+func avroWriteNullable(buf *bytes.Buffer, t *avroLogicalType, val interface{}) error {
+	if val == nil {
+		avroWriteLong(buf, 0)
+		return nil
+	}
+	avroWriteLong(buf, 1)
+	return avroWriteValue(buf, t, val)
+}
+
+func avroValueToString(val interface{}) string {
+	switch v := val.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case []string:
+		return strings.Join(v, ",")
+	case map[string]interface{}, []interface{}:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+	return fmt.Sprint(val)
+}
+
+func avroWriteValue(buf *bytes.Buffer, t *avroLogicalType, val interface{}) error {
+	str := avroValueToString(val)
+	switch t.LogicalType {
+	case "decimal":
+		unscaled, err := avroDecimalUnscaled(str, t.Scale)
+		if err != nil {
+			return err
+		}
+		avroWriteBytes(buf, avroBigIntToBytes(unscaled))
+		return nil
+	case "date":
+		tm, err := time.Parse("2006-01-02", str)
+		if err != nil {
+			return err
+		}
+		avroWriteLong(buf, tm.Unix()/86400)
+		return nil
+	case "time-micros":
+		micro, err := avroMicroTime(str)
+		if err != nil {
+			return err
+		}
+		avroWriteLong(buf, micro)
+		return nil
+	case "timestamp-micros":
+		tm, err := time.Parse("2006-01-02 15:04:05.999999", str)
+		if err != nil {
+			return err
+		}
+		avroWriteLong(buf, tm.UnixMicro())
+		return nil
+	}
+	switch t.Type {
+	case "boolean":
+		switch str {
+		case "1", "true":
+			buf.WriteByte(1)
+		default:
+			buf.WriteByte(0)
+		}
+	case "int", "long":
+		n, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return err
+		}
+		avroWriteLong(buf, n)
+	case "float":
+		f, err := strconv.ParseFloat(str, 32)
+		if err != nil {
+			return err
+		}
+		var b [4]byte
+		binary.LittleEndian.PutUint32(b[:], math.Float32bits(float32(f)))
+		buf.Write(b[:])
+	case "double":
+		f, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return err
+		}
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], math.Float64bits(f))
+		buf.Write(b[:])
+	case "bytes":
+		avroWriteBytes(buf, []byte(str))
+	default:
+		avroWriteBytes(buf, []byte(str))
+	}
+	return nil
+}
+
+// "12.3" scale:2 ==> 1230
+func avroDecimalUnscaled(str string, scale int) (*big.Int, error) {
+	str = strings.TrimSpace(str)
+	var sign string
+	if strings.HasPrefix(str, "-") || strings.HasPrefix(str, "+") {
+		sign, str = str[0:1], str[1:]
+	}
+	intPart, fraction := str, ""
+	if i := strings.Index(str, "."); i >= 0 {
+		intPart, fraction = str[0:i], str[i+1:]
+	}
+	if len(fraction) > scale {
+		fraction = fraction[0:scale]
+	} else {
+		fraction += strings.Repeat("0", scale-len(fraction))
+	}
+	n, ok := new(big.Int).SetString(sign+intPart+fraction, 10)
+	if !ok {
+		return nil, fmt.Errorf("decimal:%s err", str)
+	}
+	return n, nil
+}
+
+// 大端的二进制补码
+func avroBigIntToBytes(n *big.Int) []byte {
+	m := new(big.Int).Set(n)
+	if n.Sign() < 0 {
+		m.Neg(m).Sub(m, big.NewInt(1))
+	}
+	l := m.BitLen()/8 + 1
+	mod := new(big.Int).Lsh(big.NewInt(1), uint(8*l))
+	v := new(big.Int).Mod(n, mod)
+	return v.FillBytes(make([]byte, l))
+}
+
+// -838:59:59.000000 ~ 838:59:59.000000 转成微秒
+func avroMicroTime(str string) (int64, error) {
+	var sign int64 = 1
+	if strings.HasPrefix(str, "-") {
+		sign = -1
+		str = str[1:]
+	}
+	var micro int64
+	if i := strings.Index(str, "."); i >= 0 {
+		micro, _ = strconv.ParseInt((str[i+1:] + "000000")[0:6], 10, 64)
+		str = str[0:i]
+	}
+	arr := strings.Split(str, ":")
+	if len(arr) != 3 {
+		return 0, fmt.Errorf("time:%s err", str)
+	}
+	var sec int64
+	for _, v := range arr {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		sec = sec*60 + n
+	}
+	return sign * (sec*1000000 + micro), nil
+}
@@ -0,0 +1,166 @@
+package src
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func getAvroTestPluginData(eventType string, rows ...map[string]interface{}) *pluginDriver.PluginDataType {
+	return &pluginDriver.PluginDataType{
+		Timestamp:      1665857191,
+		EventType:      eventType,
+		Rows:           rows,
+		SchemaName:     "bifrost_test",
+		TableName:      "avro_test",
+		BinlogFileNum:  3,
+		BinlogPosition: 2820,
+		Pri:            []string{"id"},
+		ColumnMapping: map[string]string{
+			"id":      "int32",
+			"name":    "Nullable(varchar(20))",
+			"price":   "Nullable(decimal(10,2))",
+			"created": "Nullable(datetime)",
+		},
+	}
+}
+
+// 按 schema 中字段的顺序读取 avro binary
+type avroTestReader struct {
+	buf *bytes.Buffer
+}
+
+func (r *avroTestReader) long() int64 {
+	n, err := binary.ReadVarint(r.buf)
+	So(err, ShouldBeNil)
+	return n
+}
+
+func (r *avroTestReader) bytes() []byte {
+	return r.buf.Next(int(r.long()))
+}
+
+func TestGetAvroSchema(t *testing.T) {
+	Convey("根据字段类型生成 schema", t, func() {
+		schema := GetAvroSchema(getAvroTestPluginData("insert", map[string]interface{}{"id": int32(1)}))
+		So(schema.FullName(), ShouldEqual, "bifrost.bifrost_test.avro_test")
+		var m map[string]interface{}
+		So(json.Unmarshal([]byte(schema.String()), &m), ShouldBeNil)
+		So(m["type"], ShouldEqual, "record")
+		names := make([]string, 0)
+		for _, field := range schema.Fields {
+			names = append(names, field.Name)
+		}
+		So(names, ShouldResemble, []string{"created", "id", "name", "price", "__op", "__schema_name", "__table_name", "__timestamp", "__binlog_file_num", "__binlog_position"})
+		So(schema.Fields[0].avroType.LogicalType, ShouldEqual, "timestamp-micros")
+		So(schema.Fields[1].avroType.Type, ShouldEqual, "int")
+		So(schema.Fields[2].avroType.Type, ShouldEqual, "string")
+		So(*schema.Fields[3].avroType, ShouldResemble, avroLogicalType{Type: "bytes", LogicalType: "decimal", Precision: 10, Scale: 2})
+	})
+
+	Convey("字段名不符合 avro 规范", t, func() {
+		So(avroName("my-field"), ShouldEqual, "my_field")
+		So(avroName("1a"), ShouldEqual, "_1a")
+	})
+
+	Convey("mysql 类型转换", t, func() {
+		So(getAvroType("tinyint(1)").Type, ShouldEqual, "boolean")
+		So(getAvroType("int(11) unsigned").Type, ShouldEqual, "long")
+		So(getAvroType("bigint(20) unsigned").LogicalType, ShouldEqual, "decimal")
+		So(getAvroType("double").Type, ShouldEqual, "double")
+		So(getAvroType("date").LogicalType, ShouldEqual, "date")
+		So(getAvroType("time(6)").LogicalType, ShouldEqual, "time-micros")
+		So(getAvroType("enum('a','b')").Type, ShouldEqual, "string")
+	})
+}
+
+func TestAvroSchema_Encode(t *testing.T) {
+	Convey("insert", t, func() {
+		data := getAvroTestPluginData("insert", map[string]interface{}{
+			"id":      int32(-2),
+			"name":    "bifrost",
+			"price":   "-1.5",
+			"created": "2022-10-15 18:06:31",
+		})
+		schema := GetAvroSchema(data)
+		b, err := schema.Encode(data)
+		So(err, ShouldBeNil)
+		r := &avroTestReader{buf: bytes.NewBuffer(b)}
+		// created
+		So(r.long(), ShouldEqual, 1)
+		So(r.long(), ShouldEqual, int64(1665857191000000))
+		// id
+		So(r.long(), ShouldEqual, 1)
+		So(r.long(), ShouldEqual, -2)
+		// name
+		So(r.long(), ShouldEqual, 1)
+		So(string(r.bytes()), ShouldEqual, "bifrost")
+		// price -150
+		So(r.long(), ShouldEqual, 1)
+		So(r.bytes(), ShouldResemble, []byte{0xff, 0x6a})
+		// __op
+		So(r.long(), ShouldEqual, 1)
+		So(string(r.bytes()), ShouldEqual, "insert")
+		// __schema_name , __table_name
+		r.long()
+		So(string(r.bytes()), ShouldEqual, "bifrost_test")
+		r.long()
+		So(string(r.bytes()), ShouldEqual, "avro_test")
+		// __timestamp
+		r.long()
+		So(r.long(), ShouldEqual, int64(1665857191000))
+		// __binlog_file_num , __binlog_position
+		r.long()
+		So(r.long(), ShouldEqual, 3)
+		r.long()
+		So(r.long(), ShouldEqual, 2820)
+		So(r.buf.Len(), ShouldEqual, 0)
+	})
+
+	Convey("null", t, func() {
+		data := getAvroTestPluginData("delete", map[string]interface{}{"id": int32(1), "name": nil, "price": nil, "created": nil})
+		schema := GetAvroSchema(data)
+		b, err := schema.Encode(data)
+		So(err, ShouldBeNil)
+		So(b[0:5], ShouldResemble, []byte{0, 2, 2, 0, 0})
+	})
+
+	Convey("commit 事件不支持", t, func() {
+		data := getAvroTestPluginData("commit")
+		_, err := GetAvroSchema(data).Encode(data)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestAvroBigIntToBytes(t *testing.T) {
+	Convey("二进制补码", t, func() {
+		So(avroBigIntToBytes(big.NewInt(0)), ShouldResemble, []byte{0})
+		So(avroBigIntToBytes(big.NewInt(127)), ShouldResemble, []byte{0x7f})
+		So(avroBigIntToBytes(big.NewInt(128)), ShouldResemble, []byte{0x00, 0x80})
+		So(avroBigIntToBytes(big.NewInt(-1)), ShouldResemble, []byte{0xff})
+		So(avroBigIntToBytes(big.NewInt(-128)), ShouldResemble, []byte{0x80})
+		So(avroBigIntToBytes(big.NewInt(-129)), ShouldResemble, []byte{0xff, 0x7f})
+	})
+
+	Convey("decimal", t, func() {
+		n, err := avroDecimalUnscaled("12.3", 2)
+		So(err, ShouldBeNil)
+		So(n.Int64(), ShouldEqual, 1230)
+		n, err = avroDecimalUnscaled("-0.125", 2)
+		So(err, ShouldBeNil)
+		So(n.Int64(), ShouldEqual, -12)
+		_, err = avroDecimalUnscaled("abc", 2)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("time", t, func() {
+		n, err := avroMicroTime("-01:00:01.5")
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, int64(-3601500000))
+	})
+}
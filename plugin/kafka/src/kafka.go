@@ -36,6 +36,11 @@ const (
 	CLOSED  int8 = 0
 )
 
+const (
+	ENCODING_JSON = "json"
+	ENCODING_AVRO = "avro"
+)
+
 type Conn struct {
 	pluginDriver.PluginDriverInterface
 	Uri      *string
@@ -43,17 +48,27 @@ type Conn struct {
 	err      error
 	p        *PluginParam
 	producer sarama.SyncProducer
+
+	schemaRegistry *SchemaRegistry
+
+	txnProducer *transactionProducer // 事务模式下使用的 producer ,按 TransactionalId 共用
 }
 
 type PluginParam struct {
-	OtherObjectType      pluginDriver.OtherObjectType
-	Topic                string
-	Key                  string
-	BatchSize            int
-	Timeout              int
-	RequiredAcks         sarama.RequiredAcks
-	BifrostFilterQuery   bool // bifrost server 保留,是否过滤sql事件
-	BifrostMustBeSuccess bool // bifrost server 保留,数据是否能丢
+	OtherObjectType          pluginDriver.OtherObjectType
+	Encoding                 string // json , avro
+	SchemaRegistryUrl        string // Encoding 为 avro 的时候必填
+	SubjectNameStrategy      SubjectNameStrategy
+	Transactional            bool   // 是否使用事务 producer ,每批数据和位点在一个事务里提交
+	TransactionalId          string // Transactional 为 true 的时候必填,重启之后用同一个 id fence 掉之前的 producer
+	TransactionPositionTopic string // 事务里写入位点的 topic
+	Topic                    string
+	Key                      string
+	BatchSize                int
+	Timeout                  int
+	RequiredAcks             sarama.RequiredAcks
+	BifrostFilterQuery       bool // bifrost server 保留,是否过滤sql事件
+	BifrostMustBeSuccess     bool // bifrost server 保留,数据是否能丢
 
 	dataList         []*sarama.ProducerMessage
 	commitBinlogList []*pluginDriver.PluginDataType
@@ -96,6 +111,17 @@ func (This *Conn) CheckUri() error {
 }
 
 func (This *Conn) newProducer() bool {
+	if This.p.Transactional {
+		txn := This.getTransactionProducer()
+		txn.Lock()
+		This.err = txn.connect(*This.Uri, This.p)
+		txn.Unlock()
+		if This.err != nil {
+			return false
+		}
+		This.status = RUNNING
+		return true
+	}
 	config, err := getKafkaConnectConfig(ParseDSN(*This.Uri))
 	if err != nil {
 		return false
@@ -106,12 +132,11 @@ func (This *Conn) newProducer() bool {
 	config.ConnectConfig.Producer.Timeout = time.Duration(This.p.Timeout) * time.Second
 	//config.ConnectConfig.Producer.Partitioner = sarama.NewRandomPartitioner
 	This.producer, This.err = sarama.NewSyncProducer(config.BrokerServerList, config.ConnectConfig)
-	if This.err == nil {
-		This.status = RUNNING
-		return true
-	} else {
+	if This.err != nil {
 		return false
 	}
+	This.status = RUNNING
+	return true
 }
 
 func (This *Conn) Connect() bool {
@@ -147,11 +172,37 @@ func (This *Conn) GetParam(p interface{}) (interface{}, error) {
 		param.RequiredAcks = sarama.WaitForAll
 		break
 	}
+	switch param.Encoding {
+	case "", ENCODING_JSON:
+		param.Encoding = ENCODING_JSON
+	case ENCODING_AVRO:
+		if param.SchemaRegistryUrl == "" {
+			return nil, fmt.Errorf("SchemaRegistryUrl can't be empty when Encoding is avro")
+		}
+		switch param.SubjectNameStrategy {
+		case TopicNameStrategy, RecordNameStrategy, TopicRecordNameStrategy:
+			break
+		default:
+			param.SubjectNameStrategy = TopicNameStrategy
+		}
+	default:
+		return nil, fmt.Errorf("Encoding:%s not supported", param.Encoding)
+	}
+	if param.Transactional {
+		if param.TransactionalId == "" {
+			return nil, fmt.Errorf("TransactionalId can't be empty when Transactional is true")
+		}
+		if param.TransactionPositionTopic == "" {
+			param.TransactionPositionTopic = defaultTransactionPositionTopic
+		}
+		param.RequiredAcks = sarama.WaitForAll
+	}
 	if len(param.dataList) == 0 {
 		param.dataList = make([]*sarama.ProducerMessage, 0)
 		param.commitBinlogList = make([]*pluginDriver.PluginDataType, 0)
 	}
 	This.p = param
+	This.schemaRegistry = nil
 	return param, nil
 }
 
@@ -199,6 +250,8 @@ func (This *Conn) Close() bool {
 		}()
 	}
 	This.producer = nil
+	releaseTransactionProducer(This.txnProducer)
+	This.txnProducer = nil
 	This.status = CLOSED
 	return true
 }
@@ -227,16 +280,69 @@ func (This *Conn) getMsg(data *pluginDriver.PluginDataType) (*sarama.ProducerMes
 	Topic := fmt.Sprint(pluginDriver.TransfeResult(This.p.Topic, data, len(data.Rows)-1))
 	msg := &sarama.ProducerMessage{}
 	msg.Topic = Topic
+	// 事务模式下需要知道每条消息对应的位点
+	msg.Metadata = data
+	if This.p.Encoding == ENCODING_AVRO {
+		return This.getAvroMsg(data, msg)
+	}
+	c, err := pluginDriver.ToOtherObjectBytes(data, This.p.OtherObjectType)
+	if err != nil {
+		return nil, err
+	}
+	// 当前格式下不需要发送的事件，比如 debezium 格式下的 sql,commit 事件
+	if c == nil {
+		return nil, nil
+	}
+	if This.p.Key != "" {
+		Key := fmt.Sprint(pluginDriver.TransfeResult(This.p.Key, data, len(data.Rows)-1))
+		msg.Key = sarama.StringEncoder(Key)
+	} else {
+		// 没有配置 key 的时候，使用对应格式的默认 key , 比如 debezium 格式下主键组成的 key
+		keyData, _ := pluginDriver.ToOtherObjectKey(data, This.p.OtherObjectType)
+		if keyData != nil {
+			key, err := json.Marshal(keyData)
+			if err != nil {
+				return nil, err
+			}
+			msg.Key = sarama.ByteEncoder(key)
+		}
+	}
+	msg.Value = sarama.ByteEncoder(c)
+	return msg, nil
+}
+
+func (This *Conn) getSchemaRegistry() *SchemaRegistry {
+	if This.schemaRegistry == nil {
+		This.schemaRegistry = NewSchemaRegistry(This.p.SchemaRegistryUrl, time.Duration(This.p.Timeout+1)*time.Second)
+	}
+	return This.schemaRegistry
+}
+
+// avro 格式只发送 insert,update,delete 事件, sql 事件之后表结构可能变了，清除 schema id 缓存
+func (This *Conn) getAvroMsg(data *pluginDriver.PluginDataType, msg *sarama.ProducerMessage) (*sarama.ProducerMessage, error) {
+	switch data.EventType {
+	case "insert", "update", "delete":
+		break
+	case "sql":
+		This.getSchemaRegistry().ClearCache()
+		return nil, nil
+	default:
+		return nil, nil
+	}
 	if This.p.Key != "" {
 		Key := fmt.Sprint(pluginDriver.TransfeResult(This.p.Key, data, len(data.Rows)-1))
 		msg.Key = sarama.StringEncoder(Key)
 	}
-	toOtherObjectTypeData, _ := pluginDriver.ToOtherObject(data, This.p.OtherObjectType)
-	c, err := json.Marshal(toOtherObjectTypeData)
+	schema := GetAvroSchema(data)
+	schemaId, err := This.getSchemaRegistry().GetSchemaId(GetSubjectName(This.p.SubjectNameStrategy, msg.Topic, schema), schema.String())
 	if err != nil {
 		return nil, err
 	}
-	msg.Value = sarama.StringEncoder(c)
+	avroData, err := schema.Encode(data)
+	if err != nil {
+		return nil, err
+	}
+	msg.Value = sarama.ByteEncoder(ToConfluentWireFormat(schemaId, avroData))
 	return msg, nil
 }
 
@@ -249,12 +355,14 @@ func (This *Conn) sendToList(data *pluginDriver.PluginDataType, retry bool, isCo
 		if retry == false {
 			var msg *sarama.ProducerMessage
 			// 假如 非 commit 事件 或者 没有过滤 sql 事件，则需要将数据放到  list 里
-			if !isCommit || !This.p.BifrostFilterQuery {
+			if (!isCommit || !This.p.BifrostFilterQuery) && !This.isTransactionCommitted(data) {
 				msg, err = This.getMsg(data)
 				if err != nil {
 					goto endErr
 				}
-				This.p.dataList = append(This.p.dataList, msg)
+				if msg != nil {
+					This.p.dataList = append(This.p.dataList, msg)
+				}
 			}
 			if isCommit {
 				n0 := len(This.p.dataList) / This.p.BatchSize
@@ -273,11 +381,17 @@ func (This *Conn) sendToList(data *pluginDriver.PluginDataType, retry bool, isCo
 		if isCommit && This.p.BifrostFilterQuery {
 			return LastSuccessCommitData, nil, nil
 		}
+		if This.isTransactionCommitted(data) {
+			return data, nil, nil
+		}
 		var msg *sarama.ProducerMessage
 		msg, err = This.getMsg(data)
 		if err != nil {
 			goto endErr
 		}
+		if msg == nil {
+			return data, nil, nil
+		}
 		if This.status != RUNNING {
 			This.ReConnect()
 			if This.status != RUNNING {
@@ -285,7 +399,7 @@ func (This *Conn) sendToList(data *pluginDriver.PluginDataType, retry bool, isCo
 				goto endErr
 			}
 		}
-		_, _, err = This.producer.SendMessage(msg)
+		err = This.sendMessages([]*sarama.ProducerMessage{msg})
 		if err == nil {
 			LastSuccessCommitData = data
 		}
@@ -318,7 +432,7 @@ func (This *Conn) sendToKafkaByBatch() (*pluginDriver.PluginDataType, error) {
 	var binlogEvent *pluginDriver.PluginDataType
 	if len(This.p.dataList) > This.p.BatchSize {
 		list := This.p.dataList[:This.p.BatchSize]
-		err = This.producer.SendMessages(list)
+		err = This.sendMessages(list)
 		if err == nil {
 			This.p.dataList = This.p.dataList[This.p.BatchSize:]
 			if len(This.p.commitBinlogList) > 0 {
@@ -327,7 +441,7 @@ func (This *Conn) sendToKafkaByBatch() (*pluginDriver.PluginDataType, error) {
 			}
 		}
 	} else {
-		err = This.producer.SendMessages(This.p.dataList)
+		err = This.sendMessages(This.p.dataList)
 		if err == nil {
 			This.p.dataList = make([]*sarama.ProducerMessage, 0)
 			if len(This.p.commitBinlogList) > 0 {
@@ -0,0 +1,42 @@
+package src
+
+import (
+	"testing"
+
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConn_getMsg_Debezium(t *testing.T) {
+	data := &pluginDriver.PluginDataType{
+		EventType:     "insert",
+		Rows:          []map[string]interface{}{{"id": int32(1), "name": "bifrost"}},
+		SchemaName:    "bifrost_test",
+		TableName:     "binlog_field_test",
+		Pri:           []string{"id"},
+		ColumnMapping: map[string]string{"id": "int32", "name": "Nullable(varchar(20))"},
+	}
+	Convey("key 为空的时候使用 debezium key", t, func() {
+		conn := &Conn{p: &PluginParam{Topic: "{$SchemaName}", OtherObjectType: pluginDriver.DebeziumNoSchemaType}}
+		msg, err := conn.getMsg(data)
+		So(err, ShouldBeNil)
+		So(msg.Topic, ShouldEqual, "bifrost_test")
+		key, _ := msg.Key.Encode()
+		So(string(key), ShouldEqual, `{"id":1}`)
+	})
+
+	Convey("配置了 key 的时候使用配置的 key", t, func() {
+		conn := &Conn{p: &PluginParam{Topic: "{$SchemaName}", Key: "{$TableName}", OtherObjectType: pluginDriver.DebeziumType}}
+		msg, err := conn.getMsg(data)
+		So(err, ShouldBeNil)
+		key, _ := msg.Key.Encode()
+		So(string(key), ShouldEqual, "binlog_field_test")
+	})
+
+	Convey("commit 事件不发送", t, func() {
+		conn := &Conn{p: &PluginParam{Topic: "{$SchemaName}", OtherObjectType: pluginDriver.DebeziumType}}
+		msg, err := conn.getMsg(&pluginDriver.PluginDataType{EventType: "commit", SchemaName: "bifrost_test"})
+		So(err, ShouldBeNil)
+		So(msg, ShouldBeNil)
+	})
+}
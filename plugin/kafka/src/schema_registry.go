@@ -0,0 +1,178 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package src
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+type SubjectNameStrategy string
+
+const (
+	TopicNameStrategy       SubjectNameStrategy = "TopicNameStrategy"
+	RecordNameStrategy      SubjectNameStrategy = "RecordNameStrategy"
+	TopicRecordNameStrategy SubjectNameStrategy = "TopicRecordNameStrategy"
+)
+
+const schemaRegistryContentType = "application/vnd.schemaregistry.v1+json"
+
+// confluent wire format 的 magic byte
+const confluentMagicByte byte = 0
+
+func GetSubjectName(strategy SubjectNameStrategy, topic string, schema *AvroSchema) string {
+	switch strategy {
+	case RecordNameStrategy:
+		return schema.FullName()
+	case TopicRecordNameStrategy:
+		return topic + "-" + schema.FullName()
+	default:
+		return topic + "-value"
+	}
+}
+
+type SchemaRegistry struct {
+	sync.Mutex
+	url     string
+	client  *http.Client
+	idCache map[string]int // subject + "\n" + schema ==> schema id
+}
+
+type schemaRegistryRequest struct {
+	Schema string `json:"schema"`
+}
+
+type schemaRegistryResponse struct {
+	Id        int    `json:"id"`
+	ErrorCode int    `json:"error_code"`
+	Message   string `json:"message"`
+}
+
+// url 中可以带上 user:password@ ,请求的时候会使用 basic auth
+func NewSchemaRegistry(registryUrl string, timeout time.Duration) *SchemaRegistry {
+	return &SchemaRegistry{
+		url:     strings.TrimRight(registryUrl, "/"),
+		client:  &http.Client{Timeout: timeout},
+		idCache: make(map[string]int, 0),
+	}
+}
+
+// 先查询 subject 下是否已经存在这个 schema ,不存在则注册
+func (c *SchemaRegistry) GetSchemaId(subject string, schema string) (int, error) {
+	c.Lock()
+	defer c.Unlock()
+	cacheKey := subject + "\n" + schema
+	if id, ok := c.idCache[cacheKey]; ok {
+		return id, nil
+	}
+	id, found, err := c.lookup(subject, schema)
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		id, err = c.register(subject, schema)
+		if err != nil {
+			return 0, err
+		}
+	}
+	c.idCache[cacheKey] = id
+	return id, nil
+}
+
+// 表结构变更之后，清除缓存，旧的 schema 不会再使用
+func (c *SchemaRegistry) ClearCache() {
+	c.Lock()
+	c.idCache = make(map[string]int, 0)
+	c.Unlock()
+}
+
+func (c *SchemaRegistry) lookup(subject string, schema string) (id int, found bool, err error) {
+	var statusCode int
+	var resp *schemaRegistryResponse
+	statusCode, resp, err = c.post("/subjects/"+url.PathEscape(subject), schema)
+	if err != nil {
+		return
+	}
+	switch statusCode {
+	case http.StatusOK:
+		return resp.Id, true, nil
+	case http.StatusNotFound:
+		// 40401 subject not found , 40403 schema not found
+		return 0, false, nil
+	}
+	return 0, false, fmt.Errorf("schema registry lookup subject:%s http code:%d error_code:%d message:%s", subject, statusCode, resp.ErrorCode, resp.Message)
+}
+
+func (c *SchemaRegistry) register(subject string, schema string) (int, error) {
+	statusCode, resp, err := c.post("/subjects/"+url.PathEscape(subject)+"/versions", schema)
+	if err != nil {
+		return 0, err
+	}
+	if statusCode != http.StatusOK {
+		return 0, fmt.Errorf("schema registry register subject:%s http code:%d error_code:%d message:%s", subject, statusCode, resp.ErrorCode, resp.Message)
+	}
+	return resp.Id, nil
+}
+
+func (c *SchemaRegistry) post(path string, schema string) (statusCode int, resp *schemaRegistryResponse, err error) {
+	var body []byte
+	body, err = json.Marshal(schemaRegistryRequest{Schema: schema})
+	if err != nil {
+		return
+	}
+	var req *http.Request
+	req, err = http.NewRequest("POST", c.url+path, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", schemaRegistryContentType)
+	req.Header.Set("Accept", schemaRegistryContentType)
+	var httpResp *http.Response
+	httpResp, err = c.client.Do(req)
+	if err != nil {
+		return
+	}
+	defer httpResp.Body.Close()
+	body, err = ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return
+	}
+	resp = &schemaRegistryResponse{}
+	statusCode = httpResp.StatusCode
+	if len(body) > 0 {
+		if err = json.Unmarshal(body, resp); err != nil {
+			err = fmt.Errorf("schema registry response:%s err:%s", string(body), err.Error())
+		}
+	}
+	return
+}
+
+// confluent wire format: magic byte + 4 字节大端的 schema id + avro binary
+func ToConfluentWireFormat(schemaId int, avroData []byte) []byte {
+	b := make([]byte, 5, 5+len(avroData))
+	b[0] = confluentMagicByte
+	binary.BigEndian.PutUint32(b[1:5], uint32(schemaId))
+	return append(b, avroData...)
+}
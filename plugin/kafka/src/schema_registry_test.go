@@ -0,0 +1,165 @@
+package src
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// 模拟 confluent schema registry
+type testSchemaRegistryServer struct {
+	sync.Mutex
+	schemaIds    map[string]int      // schema ==> id
+	subjects     map[string][]string // subject ==> schema 列表
+	requestCount int
+}
+
+func newTestSchemaRegistryServer() *httptest.Server {
+	s := &testSchemaRegistryServer{
+		schemaIds: make(map[string]int, 0),
+		subjects:  make(map[string][]string, 0),
+	}
+	return httptest.NewServer(s)
+}
+
+func (s *testSchemaRegistryServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	s.requestCount++
+	w.Header().Set("Content-Type", schemaRegistryContentType)
+	var req schemaRegistryRequest
+	if r.Method != "POST" || json.NewDecoder(r.Body).Decode(&req) != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/subjects/")
+	if strings.HasSuffix(path, "/versions") {
+		subject := strings.TrimSuffix(path, "/versions")
+		if strings.HasPrefix(subject, "incompatible") {
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"error_code":409,"message":"Schema being registered is incompatible with an earlier schema"}`))
+			return
+		}
+		id, ok := s.schemaIds[req.Schema]
+		if !ok {
+			id = len(s.schemaIds) + 1
+			s.schemaIds[req.Schema] = id
+		}
+		s.subjects[subject] = append(s.subjects[subject], req.Schema)
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": id})
+		return
+	}
+	for _, schema := range s.subjects[path] {
+		if schema == req.Schema {
+			json.NewEncoder(w).Encode(map[string]interface{}{"subject": path, "id": s.schemaIds[schema], "version": 1, "schema": schema})
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNotFound)
+	w.Write([]byte(`{"error_code":40403,"message":"Schema not found"}`))
+}
+
+func TestGetSubjectName(t *testing.T) {
+	Convey("subject naming strategy", t, func() {
+		schema := &AvroSchema{Name: "avro_test", Namespace: "bifrost.bifrost_test"}
+		So(GetSubjectName(TopicNameStrategy, "topic1", schema), ShouldEqual, "topic1-value")
+		So(GetSubjectName(RecordNameStrategy, "topic1", schema), ShouldEqual, "bifrost.bifrost_test.avro_test")
+		So(GetSubjectName(TopicRecordNameStrategy, "topic1", schema), ShouldEqual, "topic1-bifrost.bifrost_test.avro_test")
+		So(GetSubjectName("", "topic1", schema), ShouldEqual, "topic1-value")
+	})
+}
+
+func TestSchemaRegistry_GetSchemaId(t *testing.T) {
+	server := newTestSchemaRegistryServer()
+	defer server.Close()
+	registryServer := server.Config.Handler.(*testSchemaRegistryServer)
+
+	Convey("注册之后再查询", t, func() {
+		registry := NewSchemaRegistry(server.URL+"/", 3*time.Second)
+		id, err := registry.GetSchemaId("topic1-value", `{"type":"string"}`)
+		So(err, ShouldBeNil)
+		So(id, ShouldEqual, 1)
+		// lookup + register
+		So(registryServer.requestCount, ShouldEqual, 2)
+
+		// 缓存
+		id, err = registry.GetSchemaId("topic1-value", `{"type":"string"}`)
+		So(err, ShouldBeNil)
+		So(id, ShouldEqual, 1)
+		So(registryServer.requestCount, ShouldEqual, 2)
+
+		// 清除缓存之后，直接查询到已注册的 schema
+		registry.ClearCache()
+		id, err = registry.GetSchemaId("topic1-value", `{"type":"string"}`)
+		So(err, ShouldBeNil)
+		So(id, ShouldEqual, 1)
+		So(registryServer.requestCount, ShouldEqual, 3)
+	})
+
+	Convey("schema 不兼容", t, func() {
+		registry := NewSchemaRegistry(server.URL, 3*time.Second)
+		_, err := registry.GetSchemaId("incompatible-value", `{"type":"long"}`)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "409")
+	})
+}
+
+func TestConn_getMsg_Avro(t *testing.T) {
+	server := newTestSchemaRegistryServer()
+	defer server.Close()
+
+	conn := &Conn{}
+	_, err := conn.GetParam(map[string]interface{}{
+		"Topic":             "{$SchemaName}",
+		"Encoding":          ENCODING_AVRO,
+		"SchemaRegistryUrl": server.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("confluent wire format", t, func() {
+		data := getAvroTestPluginData("insert", map[string]interface{}{"id": int32(1), "name": "bifrost"})
+		msg, err := conn.getMsg(data)
+		So(err, ShouldBeNil)
+		So(msg.Topic, ShouldEqual, "bifrost_test")
+		So(msg.Key, ShouldBeNil)
+		value, _ := msg.Value.Encode()
+		So(value[0], ShouldEqual, confluentMagicByte)
+		So(binary.BigEndian.Uint32(value[1:5]), ShouldEqual, 1)
+		avroData, _ := GetAvroSchema(data).Encode(data)
+		So(value[5:], ShouldResemble, avroData)
+	})
+
+	Convey("DDL 之后 schema 演进", t, func() {
+		msg, err := conn.getMsg(&pluginDriver.PluginDataType{EventType: "sql", SchemaName: "bifrost_test", TableName: "avro_test", Query: "ALTER TABLE avro_test ADD COLUMN age int"})
+		So(err, ShouldBeNil)
+		So(msg, ShouldBeNil)
+
+		data := getAvroTestPluginData("insert", map[string]interface{}{"id": int32(2), "name": "bristol", "age": int32(10)})
+		data.ColumnMapping["age"] = "Nullable(int32)"
+		msg, err = conn.getMsg(data)
+		So(err, ShouldBeNil)
+		value, _ := msg.Value.Encode()
+		So(binary.BigEndian.Uint32(value[1:5]), ShouldEqual, 2)
+	})
+
+	Convey("commit 事件不发送", t, func() {
+		msg, err := conn.getMsg(&pluginDriver.PluginDataType{EventType: "commit", SchemaName: "bifrost_test"})
+		So(err, ShouldBeNil)
+		So(msg, ShouldBeNil)
+	})
+
+	Convey("avro 必须配置 SchemaRegistryUrl", t, func() {
+		_, err := (&Conn{}).GetParam(map[string]interface{}{"Topic": "topic1", "Encoding": ENCODING_AVRO})
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,358 @@
+/*
+Copyright [2018] [jc3wish]
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package src
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+)
+
+// 事务模式下，每一批数据在一个 kafka 事务里发送，同一个事务里会往 TransactionPositionTopic 写一条当前批次最后的 binlog 位点
+// 重启之后，用同一个 TransactionalId 创建 producer 会把之前未完成的事务 abort 掉(fence)，
+// 再读取已提交的位点，位点小于等于这个位点的数据已经在 kafka 里了，不再重复发送
+// 连接池里同一个 ToServer 会有多个 Conn ,所以 producer 和已提交的位点按 TransactionalId 共用,不能每个 Conn 一个，否则会互相 fence
+// TransactionPositionTopic 需要提前创建好，并且 cleanup.policy=compact ,启动的时候会读取整个分区
+
+const defaultTransactionPositionTopic = "bifrost_transaction_position"
+
+type TransactionPosition struct {
+	BinlogFileNum  int
+	BinlogPosition uint32
+	PayloadIndex   uint32 `json:",omitempty"` // TRANSACTION_PAYLOAD_EVENT 里的事件位点相同，用 PayloadIndex 区分先后
+	Gtid           string
+}
+
+func (This *TransactionPosition) Valid() bool {
+	return This != nil && This.BinlogFileNum > 0 && This.BinlogPosition > 0
+}
+
+// 设置事务 producer 需要的配置
+func setTransactionalConfig(cfg *sarama.Config, transactionalId string) {
+	cfg.Producer.Idempotent = true
+	cfg.Producer.RequiredAcks = sarama.WaitForAll
+	cfg.Producer.Transaction.ID = transactionalId
+	cfg.Net.MaxOpenRequests = 1
+	if cfg.Producer.Retry.Max <= 0 {
+		cfg.Producer.Retry.Max = 1
+	}
+	cfg.Consumer.IsolationLevel = sarama.ReadCommitted
+}
+
+func getTransactionPosition(list []*sarama.ProducerMessage) *TransactionPosition {
+	for i := len(list) - 1; i >= 0; i-- {
+		data, ok := list[i].Metadata.(*pluginDriver.PluginDataType)
+		if !ok {
+			continue
+		}
+		p := &TransactionPosition{
+			BinlogFileNum:  data.BinlogFileNum,
+			BinlogPosition: data.BinlogPosition,
+			PayloadIndex:   data.PayloadIndex,
+			Gtid:           data.Gtid,
+		}
+		if p.Valid() {
+			return p
+		}
+	}
+	return nil
+}
+
+func (This *Conn) getTransactionPositionMsg(list []*sarama.ProducerMessage) (*sarama.ProducerMessage, error) {
+	p := getTransactionPosition(list)
+	if p == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	msg := &sarama.ProducerMessage{
+		Topic: This.p.TransactionPositionTopic,
+		Key:   sarama.StringEncoder(This.p.TransactionalId),
+		Value: sarama.ByteEncoder(b),
+	}
+	return msg, nil
+}
+
+// 同一个 TransactionalId 只有一个 producer ,多个 Conn 共用，事务串行提交
+type transactionProducer struct {
+	sync.Mutex
+	transactionalId string
+	producer        sarama.SyncProducer
+	position        *TransactionPosition // 创建 producer 之后读取到的已提交的位点
+	refs            int
+}
+
+var transactionProducerMap = make(map[string]*transactionProducer)
+var transactionProducerLock sync.Mutex
+
+func acquireTransactionProducer(transactionalId string) *transactionProducer {
+	transactionProducerLock.Lock()
+	defer transactionProducerLock.Unlock()
+	txn, ok := transactionProducerMap[transactionalId]
+	if !ok {
+		txn = &transactionProducer{transactionalId: transactionalId}
+		transactionProducerMap[transactionalId] = txn
+	}
+	txn.refs++
+	return txn
+}
+
+// 没有 Conn 使用的时候关闭 producer
+func releaseTransactionProducer(txn *transactionProducer) {
+	if txn == nil {
+		return
+	}
+	transactionProducerLock.Lock()
+	defer transactionProducerLock.Unlock()
+	txn.refs--
+	if txn.refs > 0 {
+		return
+	}
+	delete(transactionProducerMap, txn.transactionalId)
+	txn.Lock()
+	txn.close()
+	txn.Unlock()
+}
+
+// 调用方需要加锁
+func (txn *transactionProducer) connect(uri string, param *PluginParam) (err error) {
+	if txn.producer != nil {
+		return nil
+	}
+	config, err := getKafkaConnectConfig(ParseDSN(uri))
+	if err != nil {
+		return err
+	}
+	config.ConnectConfig.Producer.Return.Successes = true
+	config.ConnectConfig.Producer.Return.Errors = true
+	config.ConnectConfig.Producer.Timeout = time.Duration(param.Timeout) * time.Second
+	setTransactionalConfig(config.ConnectConfig, txn.transactionalId)
+	producer, err := sarama.NewSyncProducer(config.BrokerServerList, config.ConnectConfig)
+	if err != nil {
+		return err
+	}
+	// 创建 producer 的时候已经 fence 掉了之前同一个 TransactionalId 的 producer ,再读取已提交的位点
+	position, err := loadTransactionPosition(config, param)
+	if err != nil {
+		producer.Close()
+		return err
+	}
+	txn.producer, txn.position = producer, position
+	return nil
+}
+
+// 调用方需要加锁
+func (txn *transactionProducer) close() {
+	if txn.producer == nil {
+		return
+	}
+	func() {
+		defer func() {
+			if err := recover(); err != nil {
+				return
+			}
+		}()
+		txn.producer.Close()
+	}()
+	txn.producer = nil
+}
+
+// 事务失败之后 producer 可能已经被 fence 或者处于不可恢复的状态，关闭之后下一次重新创建
+func (txn *transactionProducer) closeIfFailed() {
+	if txn.producer.TxnStatus()&(sarama.ProducerTxnFlagFatalError|sarama.ProducerTxnFlagAbortableError) == 0 {
+		return
+	}
+	txn.close()
+}
+
+// 连接池里的 Conn 会被不同的 ToServer 复用，TransactionalId 变了就换成对应的 producer
+func (This *Conn) getTransactionProducer() *transactionProducer {
+	if This.txnProducer != nil && This.txnProducer.transactionalId == This.p.TransactionalId {
+		return This.txnProducer
+	}
+	releaseTransactionProducer(This.txnProducer)
+	This.txnProducer = acquireTransactionProducer(This.p.TransactionalId)
+	return This.txnProducer
+}
+
+// 非事务模式直接发送，事务模式下一批数据和位点在同一个事务里提交，失败则 abort
+func (This *Conn) sendMessages(list []*sarama.ProducerMessage) (err error) {
+	if !This.p.Transactional {
+		return This.producer.SendMessages(list)
+	}
+	positionMsg, err := This.getTransactionPositionMsg(list)
+	if err != nil {
+		return err
+	}
+	if positionMsg != nil {
+		list = append(list[:len(list):len(list)], positionMsg)
+	}
+	txn := This.getTransactionProducer()
+	txn.Lock()
+	defer txn.Unlock()
+	if err = txn.connect(*This.Uri, This.p); err != nil {
+		return err
+	}
+	if err = txn.producer.BeginTxn(); err != nil {
+		txn.closeIfFailed()
+		return err
+	}
+	err = txn.producer.SendMessages(list)
+	if err == nil {
+		err = txn.producer.CommitTxn()
+	}
+	if err != nil {
+		txn.producer.AbortTxn()
+		txn.closeIfFailed()
+		return err
+	}
+	return nil
+}
+
+// 重启之后，位点小于等于已提交事务位点的数据说明已经写入到 kafka 了，直接跳过
+// 全量数据等没有 binlog 位点的数据不跳过
+func (This *Conn) isTransactionCommitted(data *pluginDriver.PluginDataType) bool {
+	if !This.p.Transactional || data == nil {
+		return false
+	}
+	if data.BinlogFileNum <= 0 || data.BinlogPosition == 0 {
+		return false
+	}
+	txn := This.getTransactionProducer()
+	txn.Lock()
+	defer txn.Unlock()
+	// 还没有读取过已提交的位点
+	if txn.connect(*This.Uri, This.p) != nil {
+		return false
+	}
+	p := txn.position
+	if p == nil {
+		return false
+	}
+	// 同一个 payload 里的事件位点是一样的，只按位点比较会把 payload 里还没有提交的事件也跳过
+	if pluginDriver.CompareBinlogPosition(data.BinlogFileNum, data.BinlogPosition, data.PayloadIndex, p.BinlogFileNum, p.BinlogPosition, p.PayloadIndex) <= 0 {
+		return true
+	}
+	// 已经追上了已提交的位点，后面的数据都需要发送
+	txn.position = nil
+	return false
+}
+
+// 位点 topic 需要是 compact 的，否则保留时间之前的位点会被删除，启动的时候也要读取所有历史位点
+func checkTransactionPositionTopic(admin sarama.ClusterAdmin, topic string) error {
+	entries, err := admin.DescribeConfig(sarama.ConfigResource{
+		Type:        sarama.TopicResource,
+		Name:        topic,
+		ConfigNames: []string{"cleanup.policy"},
+	})
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Name == "cleanup.policy" && strings.Contains(entry.Value, "compact") {
+			return nil
+		}
+	}
+	return fmt.Errorf("TransactionPositionTopic:%s cleanup.policy must be compact", topic)
+}
+
+// 读取 TransactionalId 对应的最后一次已提交的事务位点
+func loadTransactionPosition(config *Config, param *PluginParam) (position *TransactionPosition, err error) {
+	client, err := sarama.NewClient(config.BrokerServerList, config.ConnectConfig)
+	if err != nil {
+		return nil, err
+	}
+	// admin 关闭的时候会关闭 client
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	defer admin.Close()
+	topic := param.TransactionPositionTopic
+	partitions, err := client.Partitions(topic)
+	if err != nil {
+		if err == sarama.ErrUnknownTopicOrPartition {
+			return nil, fmt.Errorf("TransactionPositionTopic:%s not exist, please create it with cleanup.policy=compact", topic)
+		}
+		return nil, err
+	}
+	if len(partitions) == 0 {
+		return nil, fmt.Errorf("TransactionPositionTopic:%s partitions is empty", topic)
+	}
+	if err = checkTransactionPositionTopic(admin, topic); err != nil {
+		return nil, err
+	}
+	// 和发送的时候一样按 key hash 计算分区
+	partition, err := sarama.NewHashPartitioner(topic).Partition(&sarama.ProducerMessage{Key: sarama.StringEncoder(param.TransactionalId)}, int32(len(partitions)))
+	if err != nil {
+		return nil, err
+	}
+	oldest, err := client.GetOffset(topic, partition, sarama.OffsetOldest)
+	if err != nil {
+		return nil, err
+	}
+	newest, err := client.GetOffset(topic, partition, sarama.OffsetNewest)
+	if err != nil {
+		return nil, err
+	}
+	if newest <= oldest {
+		return nil, nil
+	}
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		return nil, err
+	}
+	defer consumer.Close()
+	partitionConsumer, err := consumer.ConsumePartition(topic, partition, oldest)
+	if err != nil {
+		return nil, err
+	}
+	defer partitionConsumer.Close()
+	timeout := time.Duration(param.Timeout+1) * time.Second
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case msg := <-partitionConsumer.Messages():
+			if string(msg.Key) == param.TransactionalId {
+				var p TransactionPosition
+				if err = json.Unmarshal(msg.Value, &p); err != nil {
+					return nil, fmt.Errorf("transaction position:%s json.Unmarshal err:%s", string(msg.Value), err)
+				}
+				position = &p
+			}
+			if msg.Offset+1 >= newest {
+				return position, nil
+			}
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(timeout)
+		case <-timer.C:
+			// 最后的位点是事务控制消息的时候，读不到 newest-1 的消息
+			return position, nil
+		}
+	}
+}
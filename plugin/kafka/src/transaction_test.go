@@ -0,0 +1,206 @@
+package src
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func getTransactionTestData(eventType string, binlogFileNum int, binlogPosition uint32) *pluginDriver.PluginDataType {
+	data := &pluginDriver.PluginDataType{
+		EventType:      eventType,
+		SchemaName:     "bifrost_test",
+		TableName:      "binlog_field_test",
+		BinlogFileNum:  binlogFileNum,
+		BinlogPosition: binlogPosition,
+	}
+	if eventType != "commit" {
+		data.Rows = []map[string]interface{}{{"id": int32(binlogPosition)}}
+	}
+	return data
+}
+
+func newTransactionTestConn(t *testing.T, batchSize int) (*Conn, *mocks.SyncProducer) {
+	uri := "127.0.0.1:9092"
+	conn := &Conn{Uri: &uri}
+	p, err := conn.GetParam(map[string]interface{}{
+		"Topic":                "{$SchemaName}",
+		"BatchSize":            batchSize,
+		"Transactional":        true,
+		"TransactionalId":      "bifrost_test_id",
+		"BifrostMustBeSuccess": true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.p = p.(*PluginParam)
+	cfg := sarama.NewConfig()
+	setTransactionalConfig(cfg, conn.p.TransactionalId)
+	producer := mocks.NewSyncProducer(t, cfg)
+	conn.getTransactionProducer().producer = producer
+	conn.status = RUNNING
+	return conn, producer
+}
+
+func TestConn_GetParam_Transactional(t *testing.T) {
+	Convey("TransactionalId 不能为空", t, func() {
+		conn := &Conn{}
+		_, err := conn.GetParam(map[string]interface{}{"Topic": "test", "Transactional": true})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("默认位点 topic 和 acks", t, func() {
+		conn := &Conn{}
+		p, err := conn.GetParam(map[string]interface{}{"Topic": "test", "Transactional": true, "TransactionalId": "id1", "RequiredAcks": 1})
+		So(err, ShouldBeNil)
+		So(p.(*PluginParam).TransactionPositionTopic, ShouldEqual, defaultTransactionPositionTopic)
+		So(p.(*PluginParam).RequiredAcks, ShouldEqual, sarama.WaitForAll)
+	})
+}
+
+func TestConn_sendMessages_Transactional(t *testing.T) {
+	Convey("一批数据和位点在同一个事务里提交", t, func() {
+		conn, producer := newTransactionTestConn(t, 2)
+		var positionMsgValue []byte
+		producer.ExpectSendMessageAndSucceed()
+		producer.ExpectSendMessageAndSucceed()
+		producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+			if msg.Topic != defaultTransactionPositionTopic {
+				return fmt.Errorf("topic:%s", msg.Topic)
+			}
+			positionMsgValue, _ = msg.Value.Encode()
+			return nil
+		})
+		_, _, err := conn.Insert(getTransactionTestData("insert", 3, 100), false)
+		So(err, ShouldBeNil)
+		commitData := getTransactionTestData("commit", 3, 200)
+		lastSuccessCommitData, _, err := conn.Commit(commitData, false)
+		So(err, ShouldBeNil)
+		So(lastSuccessCommitData, ShouldEqual, commitData)
+		So(producer.TxnStatus(), ShouldEqual, sarama.ProducerTxnFlagReady)
+		var position TransactionPosition
+		So(json.Unmarshal(positionMsgValue, &position), ShouldBeNil)
+		So(position, ShouldResemble, TransactionPosition{BinlogFileNum: 3, BinlogPosition: 200})
+		So(producer.Close(), ShouldBeNil)
+		conn.Close()
+	})
+
+	Convey("发送失败，事务 abort 之后数据保留重试", t, func() {
+		conn, producer := newTransactionTestConn(t, 1)
+		producer.ExpectSendMessageAndFail(sarama.ErrOutOfBrokers)
+		producer.ExpectSendMessageAndSucceed()
+		data := getTransactionTestData("insert", 3, 100)
+		_, _, err := conn.Insert(data, false)
+		So(err, ShouldNotBeNil)
+
+		producer.ExpectSendMessageAndSucceed()
+		producer.ExpectSendMessageAndSucceed()
+		lastSuccessCommitData, _, err := conn.Insert(data, true)
+		So(err, ShouldBeNil)
+		So(lastSuccessCommitData, ShouldEqual, data)
+		So(producer.Close(), ShouldBeNil)
+		conn.Close()
+	})
+}
+
+func TestConn_isTransactionCommitted(t *testing.T) {
+	Convey("重启之后跳过已提交位点之前的数据", t, func() {
+		conn, producer := newTransactionTestConn(t, 1)
+		conn.txnProducer.position = &TransactionPosition{BinlogFileNum: 3, BinlogPosition: 200}
+
+		data := getTransactionTestData("insert", 3, 150)
+		lastSuccessCommitData, _, err := conn.Insert(data, false)
+		So(err, ShouldBeNil)
+		So(lastSuccessCommitData, ShouldEqual, data)
+		So(conn.isTransactionCommitted(getTransactionTestData("commit", 2, 900)), ShouldBeTrue)
+		So(conn.isTransactionCommitted(getTransactionTestData("commit", 3, 200)), ShouldBeTrue)
+
+		// 全量数据没有位点，不跳过
+		So(conn.isTransactionCommitted(getTransactionTestData("insert", 0, 0)), ShouldBeFalse)
+
+		producer.ExpectSendMessageAndSucceed()
+		producer.ExpectSendMessageAndSucceed()
+		_, _, err = conn.Insert(getTransactionTestData("insert", 3, 250), false)
+		So(err, ShouldBeNil)
+		So(conn.txnProducer.position, ShouldBeNil)
+		So(conn.isTransactionCommitted(getTransactionTestData("insert", 3, 100)), ShouldBeFalse)
+		So(producer.Close(), ShouldBeNil)
+		conn.Close()
+	})
+}
+
+func TestConn_isTransactionCommitted_Payload(t *testing.T) {
+	Convey("TRANSACTION_PAYLOAD_EVENT 中间提交的位点，payload 里后面的数据不能跳过", t, func() {
+		conn, producer := newTransactionTestConn(t, 1)
+		conn.txnProducer.position = &TransactionPosition{BinlogFileNum: 3, BinlogPosition: 200, PayloadIndex: 2}
+		getPayloadData := func(eventType string, binlogPosition uint32, payloadIndex uint32) *pluginDriver.PluginDataType {
+			data := getTransactionTestData(eventType, 3, binlogPosition)
+			data.PayloadIndex = payloadIndex
+			return data
+		}
+		So(conn.isTransactionCommitted(getPayloadData("insert", 200, 1)), ShouldBeTrue)
+		So(conn.isTransactionCommitted(getPayloadData("insert", 200, 2)), ShouldBeTrue)
+		So(conn.isTransactionCommitted(getPayloadData("insert", 200, 3)), ShouldBeFalse)
+		So(conn.txnProducer.position, ShouldBeNil)
+		So(producer.Close(), ShouldBeNil)
+		conn.Close()
+	})
+
+	Convey("位点里记录了 PayloadIndex", t, func() {
+		data := getTransactionTestData("insert", 3, 200)
+		data.PayloadIndex = 2
+		p := getTransactionPosition([]*sarama.ProducerMessage{{Metadata: data}})
+		So(*p, ShouldResemble, TransactionPosition{BinlogFileNum: 3, BinlogPosition: 200, PayloadIndex: 2})
+	})
+}
+
+func TestConn_getTransactionProducer(t *testing.T) {
+	Convey("连接池里同一个 TransactionalId 的 Conn 共用 producer 和位点", t, func() {
+		conn1, producer := newTransactionTestConn(t, 1)
+		conn2, _ := newTransactionTestConn(t, 1)
+		// conn2 创建的 mock producer 没有被使用
+		So(conn2.txnProducer, ShouldEqual, conn1.txnProducer)
+		conn2.txnProducer.producer = producer
+		conn1.txnProducer.position = &TransactionPosition{BinlogFileNum: 3, BinlogPosition: 200}
+		So(conn2.isTransactionCommitted(getTransactionTestData("insert", 3, 150)), ShouldBeTrue)
+
+		// Conn 被其他 ToServer 复用，不能使用之前 TransactionalId 的位点
+		conn2.p.TransactionalId = "bifrost_test_id2"
+		txn := conn2.getTransactionProducer()
+		So(txn, ShouldNotEqual, conn1.txnProducer)
+		txn.producer = producer
+		So(conn2.isTransactionCommitted(getTransactionTestData("insert", 3, 150)), ShouldBeFalse)
+		So(conn1.isTransactionCommitted(getTransactionTestData("insert", 3, 150)), ShouldBeTrue)
+
+		conn2.Close()
+		So(transactionProducerMap["bifrost_test_id2"], ShouldBeNil)
+		So(transactionProducerMap["bifrost_test_id"], ShouldEqual, conn1.txnProducer)
+		conn1.Close()
+		So(transactionProducerMap["bifrost_test_id"], ShouldBeNil)
+	})
+}
+
+type testClusterAdmin struct {
+	sarama.ClusterAdmin
+	entries []sarama.ConfigEntry
+}
+
+func (This *testClusterAdmin) DescribeConfig(resource sarama.ConfigResource) ([]sarama.ConfigEntry, error) {
+	return This.entries, nil
+}
+
+func TestCheckTransactionPositionTopic(t *testing.T) {
+	Convey("位点 topic 必须是 compact", t, func() {
+		admin := &testClusterAdmin{entries: []sarama.ConfigEntry{{Name: "cleanup.policy", Value: "compact"}}}
+		So(checkTransactionPositionTopic(admin, defaultTransactionPositionTopic), ShouldBeNil)
+		admin.entries[0].Value = "delete"
+		So(checkTransactionPositionTopic(admin, defaultTransactionPositionTopic), ShouldNotBeNil)
+		admin.entries = nil
+		So(checkTransactionPositionTopic(admin, defaultTransactionPositionTopic), ShouldNotBeNil)
+	})
+}
@@ -8,6 +8,12 @@ function doGetPluginParam(){
     var Timeout = $("#Kafka_Timeout").val();
     var RequiredAcks = $("#Kafka_RequiredAcks").val();
     var OtherObjectType = $("#Kafka_OtherObjectType").val();
+    var Encoding = $("#Kafka_Encoding").val();
+    var SchemaRegistryUrl = $("#Kafka_SchemaRegistryUrl").val();
+    var SubjectNameStrategy = $("#Kafka_SubjectNameStrategy").val();
+    var Transactional = $("#Kafka_Transactional").val();
+    var TransactionalId = $("#Kafka_TransactionalId").val();
+    var TransactionPositionTopic = $("#Kafka_TransactionPositionTopic").val();
 	
     if (Topic == ""){
 		result.msg = "Topic can't be empty"
@@ -26,6 +32,14 @@ function doGetPluginParam(){
         result.msg = "RequiredAcks must be -1 | 0 | 1 !";
         return result;
 	}
+    if (Encoding == "avro" && SchemaRegistryUrl == ""){
+        result.msg = "SchemaRegistryUrl can't be empty";
+        return result;
+    }
+    if (Transactional == "true" && TransactionalId == ""){
+        result.msg = "TransactionalId can't be empty";
+        return result;
+    }
 
 	data["Topic"] = Topic;
 	data["Key"] = Key;
@@ -33,6 +47,12 @@ function doGetPluginParam(){
     data["Timeout"] = parseInt(Timeout);
     data["RequiredAcks"] = parseInt(RequiredAcks);
     data["OtherObjectType"] = OtherObjectType;
+    data["Encoding"] = Encoding;
+    data["SchemaRegistryUrl"] = SchemaRegistryUrl;
+    data["SubjectNameStrategy"] = SubjectNameStrategy;
+    data["Transactional"] = Transactional == "true";
+    data["TransactionalId"] = TransactionalId;
+    data["TransactionPositionTopic"] = TransactionPositionTopic;
 
 	result.data = data;
 	result.msg = "success";
@@ -66,4 +86,22 @@ function initKafkaSupportedOtherOutputTypeList(){
 
 initKafkaSupportedOtherOutputTypeList();
 
+function Kafka_Encoding_Onchange(){
+    if ($("#Kafka_Encoding").val() == "avro"){
+        $(".Kafka_Avro_show_div").show();
+    }else{
+        $(".Kafka_Avro_show_div").hide();
+    }
+}
+Kafka_Encoding_Onchange();
+
+function Kafka_Transactional_Onchange(){
+    if ($("#Kafka_Transactional").val() == "true"){
+        $(".Kafka_Transactional_show_div").show();
+    }else{
+        $(".Kafka_Transactional_show_div").hide();
+    }
+}
+Kafka_Transactional_Onchange();
+
 setPluginParamDefault("FilterQuery",false);
\ No newline at end of file
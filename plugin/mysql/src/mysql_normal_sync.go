@@ -4,6 +4,7 @@ update 转成 insert on update
 insert 转成 replace into
 delete 转成 delete
 只要是同一条数据，只要有遍历过，后面遍历出来的数据，则不再进行操作
+binlog_row_image 不是 FULL 的时候，按顺序执行，insert,update 只写入存在的字段
 */
 package src
 
@@ -23,9 +24,20 @@ func (This *Conn) CommitNormal(list []*pluginDriver.PluginDataType) (errData *pl
 	//从最后一条数据开始遍历
 	var stmt dbDriver.Stmt
 	n := len(list)
+	// 同一条数据多次 update 的字段可能不一样，不能只执行最后一次操作
+	isFullRowImage := isFullRowImageList(list)
 LOOP:
 	for i := n - 1; i >= 0; i-- {
 		data := list[i]
+		if !isFullRowImage {
+			data = list[n-1-i]
+			if This.commitPartialImage(data) {
+				continue
+			}
+			if This.err != nil || This.conn.err != nil {
+				return data
+			}
+		}
 		switch data.EventType {
 		case "update":
 			val := make([]dbDriver.Value, This.p.fieldCount*2)
@@ -64,7 +76,9 @@ LOOP:
 				}
 				return data
 			}
-			setOpMapVal(opMap, data.Rows[1][This.p.fromPriKey], nil, "update")
+			if isFullRowImage {
+				setOpMapVal(opMap, data.Rows[1][This.p.fromPriKey], nil, "update")
+			}
 			break
 		case "delete":
 			where := make([]dbDriver.Value, 0)
@@ -98,7 +112,9 @@ LOOP:
 					}
 					return data
 				}
-				setOpMapVal(opMap, data.Rows[0][This.p.fromPriKey], nil, "delete")
+				if isFullRowImage {
+					setOpMapVal(opMap, data.Rows[0][This.p.fromPriKey], nil, "delete")
+				}
 			}
 			break
 		case "insert":
@@ -138,7 +154,9 @@ LOOP:
 				}
 				return data
 			}
-			setOpMapVal(opMap, data.Rows[0][This.p.fromPriKey], &val, "insert")
+			if isFullRowImage {
+				setOpMapVal(opMap, data.Rows[0][This.p.fromPriKey], &val, "insert")
+			}
 			break
 		}
 	}
@@ -0,0 +1,96 @@
+package src
+
+import (
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func newPartialImageTestConn() *Conn {
+	c := &Conn{p: &PluginParam{
+		schemaAndTable: "`bifrost_test`.`binlog_field_test`",
+		Field: []fieldStruct{
+			{ToField: "id", FromMysqlField: "id", ToFieldType: "int"},
+			{ToField: "name", FromMysqlField: "name", ToFieldType: "varchar"},
+			{ToField: "content", FromMysqlField: "content", ToFieldType: "text"},
+			{ToField: "event_type", FromMysqlField: "{$EventType}", ToFieldType: "varchar"},
+		},
+		PriKey: []fieldStruct{{ToField: "id", FromMysqlField: "id", ToFieldType: "int"}},
+	}}
+	return c
+}
+
+func TestConn_getPartialImageSql(t *testing.T) {
+	c := newPartialImageTestConn()
+
+	Convey("update minimal", t, func() {
+		data := &pluginDriver.PluginDataType{
+			EventType:      "update",
+			Rows:           []map[string]interface{}{{"id": int32(1)}, {"name": "bifrost"}},
+			PresentColumns: [][]string{{"id"}, {"name"}},
+		}
+		sql, values, err := c.getPartialImageSql(data)
+		So(err, ShouldBeNil)
+		So(sql, ShouldEqual, "UPDATE `bifrost_test`.`binlog_field_test` SET `name`=?,`event_type`=? WHERE `id`=?")
+		So(len(values), ShouldEqual, 3)
+		So(values[0], ShouldEqual, "bifrost")
+		So(values[1], ShouldEqual, "update")
+		So(values[2], ShouldEqual, "1")
+	})
+
+	Convey("update null value", t, func() {
+		data := &pluginDriver.PluginDataType{
+			EventType:      "update",
+			Rows:           []map[string]interface{}{{"id": int32(1)}, {"name": nil}},
+			PresentColumns: [][]string{{"id"}, {"name"}},
+		}
+		sql, values, err := c.getPartialImageSql(data)
+		So(err, ShouldBeNil)
+		So(sql, ShouldEqual, "UPDATE `bifrost_test`.`binlog_field_test` SET `name`=?,`event_type`=? WHERE `id`=?")
+		So(values[0], ShouldBeNil)
+	})
+
+	Convey("update no mapping field", t, func() {
+		data := &pluginDriver.PluginDataType{
+			EventType:      "update",
+			Rows:           []map[string]interface{}{{"id": int32(1)}, {"not_mapping": "x"}},
+			PresentColumns: [][]string{{"id"}, {"not_mapping"}},
+		}
+		sql, _, err := c.getPartialImageSql(data)
+		So(err, ShouldBeNil)
+		So(sql, ShouldEqual, "")
+	})
+
+	Convey("insert noblob", t, func() {
+		data := &pluginDriver.PluginDataType{
+			EventType:      "insert",
+			Rows:           []map[string]interface{}{{"id": int32(2), "name": "a"}},
+			PresentColumns: [][]string{{"id", "name"}},
+		}
+		sql, values, err := c.getPartialImageSql(data)
+		So(err, ShouldBeNil)
+		So(sql, ShouldEqual, "REPLACE INTO `bifrost_test`.`binlog_field_test` (`id`,`name`,`event_type`) VALUES (?,?,?)")
+		So(len(values), ShouldEqual, 3)
+	})
+
+	Convey("update no primary key", t, func() {
+		c := newPartialImageTestConn()
+		c.p.PriKey = nil
+		data := &pluginDriver.PluginDataType{
+			EventType:      "update",
+			Rows:           []map[string]interface{}{{"id": int32(1)}, {"name": "bifrost"}},
+			PresentColumns: [][]string{{"id"}, {"name"}},
+		}
+		_, _, err := c.getPartialImageSql(data)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestIsFullRowImageList(t *testing.T) {
+	Convey("isFullRowImageList", t, func() {
+		full := &pluginDriver.PluginDataType{EventType: "insert", Rows: []map[string]interface{}{{"id": 1}}}
+		minimal := &pluginDriver.PluginDataType{EventType: "update", Rows: []map[string]interface{}{{"id": 1}, {"name": "a"}}, PresentColumns: [][]string{{"id"}, {"name"}}}
+		So(isFullRowImageList([]*pluginDriver.PluginDataType{full}), ShouldBeTrue)
+		So(isFullRowImageList([]*pluginDriver.PluginDataType{full, minimal}), ShouldBeFalse)
+	})
+}
@@ -0,0 +1,346 @@
+package src
+
+import (
+	"log"
+	"strconv"
+	"strings"
+)
+
+/*
+  ALTER TABLE TableName
+  DROP COLUMN `name`,
+  CHANGE `number` `number` BIGINT(20) NOT NULL  COMMENT '馆藏数量',
+  ADD COLUMN `f1` VARCHAR(200) NULL AFTER `number`,
+  MODIFY `f2` int(11) unsigned NOT NULL DEFAULT '0',
+  ADD INDEX `sdfsdf` (`number`);
+
+  ==>
+
+  ALTER TABLE "db"."TableName" RENAME COLUMN ...
+  ALTER TABLE "db"."TableName" DROP COLUMN IF EXISTS "name",ALTER COLUMN "number" TYPE BIGINT USING ...,ADD COLUMN IF NOT EXISTS "f1" VARCHAR(200)
+  COMMENT ON COLUMN "db"."TableName"."number" IS '馆藏数量'
+
+  索引,存储引擎,字符集等 postgresql 不需要的 DDL 直接忽略
+*/
+
+type AlterSQL struct {
+	SchemaName string
+	TableName  string
+	Sql        string
+	c          *Conn
+
+	renameColumnSqlList []string
+	actionList          []string
+	commentSqlList      []string
+	renameTableSqlList  []string
+}
+
+type AlterColumnInfo struct {
+	Name          string
+	ColumnType    string
+	NotNull       bool
+	Default       *string
+	Comment       *string
+	AutoIncrement bool
+}
+
+func NewAlterSQL(SchemaName, TableName, sql string, c *Conn) *AlterSQL {
+	return &AlterSQL{
+		SchemaName: SchemaName,
+		TableName:  TableName,
+		Sql:        sql,
+		c:          c,
+	}
+}
+
+func (This *AlterSQL) schemaAndTable() string {
+	return QuoteSchemaAndTable(This.SchemaName, This.TableName)
+}
+
+// DefaultSchemaName 为 RENAME TO 新表名没有指定库名的时候使用的库名
+func (This *AlterSQL) Transfer2PgSQL(DefaultSchemaName string) (sqlArr []string) {
+	for _, v := range splitSqlByComma(This.Sql) {
+		This.transferAlterParam(v, DefaultSchemaName)
+	}
+	sqlArr = append(sqlArr, This.renameColumnSqlList...)
+	if len(This.actionList) > 0 {
+		sqlArr = append(sqlArr, "ALTER TABLE "+This.schemaAndTable()+" "+strings.Join(This.actionList, ","))
+	}
+	sqlArr = append(sqlArr, This.commentSqlList...)
+	sqlArr = append(sqlArr, This.renameTableSqlList...)
+	return
+}
+
+func (This *AlterSQL) transferAlterParam(param string, DefaultSchemaName string) {
+	var ok bool
+	if param, ok = trimPrefixKeyword(param, "ADD"); ok {
+		This.transferAdd(param)
+		return
+	}
+	if param, ok = trimPrefixKeyword(param, "MODIFY"); ok {
+		param, _ = trimPrefixKeyword(param, "COLUMN")
+		if columnInfo := parseColumnDefinition(splitSqlBySpace(param)); columnInfo != nil {
+			This.modifyColumn(columnInfo)
+		}
+		return
+	}
+	if param, ok = trimPrefixKeyword(param, "CHANGE"); ok {
+		param, _ = trimPrefixKeyword(param, "COLUMN")
+		arr := splitSqlBySpace(param)
+		if len(arr) < 3 {
+			return
+		}
+		oldName := unquoteIdent(arr[0])
+		columnInfo := parseColumnDefinition(arr[1:])
+		if columnInfo == nil {
+			return
+		}
+		if oldName != columnInfo.Name {
+			This.renameColumn(oldName, columnInfo.Name)
+		}
+		This.modifyColumn(columnInfo)
+		return
+	}
+	if param, ok = trimPrefixKeyword(param, "DROP"); ok {
+		This.transferDrop(param)
+		return
+	}
+	if param, ok = trimPrefixKeyword(param, "RENAME"); ok {
+		This.transferRename(param, DefaultSchemaName)
+		return
+	}
+	if param, ok = trimPrefixKeyword(param, "ALTER"); ok {
+		param, _ = trimPrefixKeyword(param, "COLUMN")
+		This.transferAlterColumn(param)
+		return
+	}
+	log.Printf("[INFO] output[%s] alter param:%s ignore \n", OutputName, param)
+}
+
+func isIndexKeyword(param string) bool {
+	for _, keyword := range []string{"INDEX", "KEY", "UNIQUE", "PRIMARY", "FOREIGN", "FULLTEXT", "SPATIAL", "CONSTRAINT", "CHECK", "PARTITION"} {
+		if _, ok := trimPrefixKeyword(param, keyword); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ADD [COLUMN] col_name column_definition
+// ADD [COLUMN] (col_name column_definition,...)
+func (This *AlterSQL) transferAdd(param string) {
+	param, _ = trimPrefixKeyword(param, "COLUMN")
+	if isIndexKeyword(param) {
+		return
+	}
+	var list []string
+	if strings.HasPrefix(param, "(") && strings.HasSuffix(param, ")") {
+		list = splitSqlByComma(param[1 : len(param)-1])
+	} else {
+		list = []string{param}
+	}
+	for _, v := range list {
+		columnInfo := parseColumnDefinition(splitSqlBySpace(v))
+		if columnInfo == nil {
+			continue
+		}
+		This.addColumn(columnInfo)
+	}
+}
+
+func (This *AlterSQL) addColumn(columnInfo *AlterColumnInfo) {
+	pgType := TransferMysqlTypeToPgType(columnInfo.ColumnType)
+	action := "ADD COLUMN IF NOT EXISTS " + QuoteIdent(columnInfo.Name) + " " + pgType
+	defaultVal, hasDefault := transferColumnDefault(columnInfo.Default, pgType)
+	if hasDefault {
+		action += " DEFAULT " + defaultVal
+	}
+	// 表里已经有数据的时候，没有默认值的 NOT NULL 字段是加不上的
+	if columnInfo.NotNull && hasDefault && defaultVal != "NULL" {
+		action += " NOT NULL"
+	}
+	This.actionList = append(This.actionList, action)
+	This.commentColumn(columnInfo)
+}
+
+func (This *AlterSQL) modifyColumn(columnInfo *AlterColumnInfo) {
+	pgType := TransferMysqlTypeToPgType(columnInfo.ColumnType)
+	columnName := QuoteIdent(columnInfo.Name)
+	// 先去掉默认值，防止原来的默认值和新的类型不兼容
+	if !columnInfo.AutoIncrement {
+		This.actionList = append(This.actionList, "ALTER COLUMN "+columnName+" DROP DEFAULT")
+	}
+	This.actionList = append(This.actionList, "ALTER COLUMN "+columnName+" TYPE "+pgType+" USING "+columnName+"::"+pgType)
+	if !columnInfo.AutoIncrement {
+		if defaultVal, ok := transferColumnDefault(columnInfo.Default, pgType); ok {
+			This.actionList = append(This.actionList, "ALTER COLUMN "+columnName+" SET DEFAULT "+defaultVal)
+		}
+	}
+	if columnInfo.NotNull {
+		This.actionList = append(This.actionList, "ALTER COLUMN "+columnName+" SET NOT NULL")
+	} else {
+		This.actionList = append(This.actionList, "ALTER COLUMN "+columnName+" DROP NOT NULL")
+	}
+	This.commentColumn(columnInfo)
+}
+
+func (This *AlterSQL) commentColumn(columnInfo *AlterColumnInfo) {
+	if columnInfo.Comment == nil {
+		return
+	}
+	This.commentSqlList = append(This.commentSqlList, "COMMENT ON COLUMN "+This.schemaAndTable()+"."+QuoteIdent(columnInfo.Name)+" IS "+quoteStringLiteral(*columnInfo.Comment))
+}
+
+// postgresql 里 RENAME COLUMN 不能和其他操作写在同一个 ALTER TABLE 里
+func (This *AlterSQL) renameColumn(oldName, newName string) {
+	This.renameColumnSqlList = append(This.renameColumnSqlList, "ALTER TABLE "+This.schemaAndTable()+" RENAME COLUMN "+QuoteIdent(oldName)+" TO "+QuoteIdent(newName))
+}
+
+// DROP [COLUMN] col_name
+func (This *AlterSQL) transferDrop(param string) {
+	param, isColumn := trimPrefixKeyword(param, "COLUMN")
+	if !isColumn && isIndexKeyword(param) {
+		return
+	}
+	arr := splitSqlBySpace(param)
+	if len(arr) == 0 {
+		return
+	}
+	This.actionList = append(This.actionList, "DROP COLUMN IF EXISTS "+QuoteIdent(unquoteIdent(arr[0])))
+}
+
+// RENAME COLUMN old_col_name TO new_col_name
+// RENAME [TO | AS] new_tbl_name
+func (This *AlterSQL) transferRename(param string, DefaultSchemaName string) {
+	if isIndexKeyword(param) {
+		return
+	}
+	if p, ok := trimPrefixKeyword(param, "COLUMN"); ok {
+		arr := splitSqlBySpace(p)
+		if len(arr) != 3 {
+			return
+		}
+		This.renameColumn(unquoteIdent(arr[0]), unquoteIdent(arr[2]))
+		return
+	}
+	if p, ok := trimPrefixKeyword(param, "TO"); ok {
+		param = p
+	} else if p, ok = trimPrefixKeyword(param, "AS"); ok {
+		param = p
+	}
+	arr := splitSqlBySpace(param)
+	if len(arr) == 0 {
+		return
+	}
+	ToSchemaName, ToTableName := This.c.getAutoTableSqlSchemaAndTable(arr[0], DefaultSchemaName)
+	This.renameTableSqlList = append(This.renameTableSqlList, getRenameTableSql(This.SchemaName, This.TableName, ToSchemaName, ToTableName)...)
+}
+
+// ALTER [COLUMN] col_name SET DEFAULT literal | DROP DEFAULT
+func (This *AlterSQL) transferAlterColumn(param string) {
+	arr := splitSqlBySpace(param)
+	if len(arr) < 3 {
+		return
+	}
+	columnName := QuoteIdent(unquoteIdent(arr[0]))
+	switch strings.ToUpper(arr[1] + " " + arr[2]) {
+	case "DROP DEFAULT":
+		This.actionList = append(This.actionList, "ALTER COLUMN "+columnName+" DROP DEFAULT")
+	case "SET DEFAULT":
+		if len(arr) < 4 {
+			return
+		}
+		// 这里不知道字段类型，按文本处理
+		if defaultVal, ok := transferColumnDefault(&arr[3], ""); ok {
+			This.actionList = append(This.actionList, "ALTER COLUMN "+columnName+" SET DEFAULT "+defaultVal)
+		}
+	}
+}
+
+// col_name data_type [NOT NULL | NULL] [DEFAULT default_value] [AUTO_INCREMENT] [COMMENT 'string'] [FIRST | AFTER col_name]
+func parseColumnDefinition(arr []string) *AlterColumnInfo {
+	if len(arr) < 2 {
+		return nil
+	}
+	columnInfo := &AlterColumnInfo{
+		Name:       unquoteIdent(arr[0]),
+		ColumnType: arr[1],
+	}
+	i := 2
+	// decimal (10,2) 这种类型和长度中间有空格的情况
+	if i < len(arr) && strings.HasPrefix(arr[i], "(") {
+		columnInfo.ColumnType += arr[i]
+		i++
+	}
+	for ; i < len(arr); i++ {
+		switch strings.ToUpper(arr[i]) {
+		case "UNSIGNED", "ZEROFILL":
+			columnInfo.ColumnType += " " + strings.ToLower(arr[i])
+		case "SIGNED":
+		case "NOT":
+			if i+1 < len(arr) && strings.ToUpper(arr[i+1]) == "NULL" {
+				columnInfo.NotNull = true
+				i++
+			}
+		case "NULL":
+			columnInfo.NotNull = false
+		case "DEFAULT":
+			if i+1 < len(arr) {
+				columnInfo.Default = &arr[i+1]
+				i++
+			}
+		case "COMMENT":
+			if i+1 < len(arr) {
+				comment := unquoteStringLiteral(arr[i+1])
+				columnInfo.Comment = &comment
+				i++
+			}
+		case "AUTO_INCREMENT":
+			columnInfo.AutoIncrement = true
+		case "CHARSET", "COLLATE", "AFTER":
+			i++
+		case "CHARACTER", "ON":
+			// CHARACTER SET utf8 , ON UPDATE CURRENT_TIMESTAMP
+			i += 2
+		}
+	}
+	return columnInfo
+}
+
+// 将 mysql 的默认值转成 postgresql 的默认值表达式,不能转换的返回 false
+func transferColumnDefault(defaultVal *string, pgType string) (string, bool) {
+	if defaultVal == nil {
+		return "", false
+	}
+	val := *defaultVal
+	upperVal := strings.ToUpper(val)
+	switch {
+	case upperVal == "NULL":
+		return "NULL", true
+	case strings.HasPrefix(upperVal, "CURRENT_TIMESTAMP"), strings.HasPrefix(upperVal, "NOW("), strings.HasPrefix(upperVal, "LOCALTIMESTAMP"):
+		return "CURRENT_TIMESTAMP", true
+	case strings.HasPrefix(upperVal, "B'"), strings.HasPrefix(upperVal, "X'"), strings.HasPrefix(upperVal, "("):
+		// bit,十六进制,表达式 的默认值不转换
+		return "", false
+	}
+	val = unquoteStringLiteral(val)
+	// mysql 的 0000-00-00 在 postgresql 里是非法的
+	if strings.HasPrefix(val, "0000-00-00") {
+		return "", false
+	}
+	switch pgType {
+	case "BOOLEAN":
+		switch strings.ToLower(val) {
+		case "0", "false", "":
+			return "FALSE", true
+		default:
+			return "TRUE", true
+		}
+	case "SMALLINT", "INTEGER", "BIGINT", "REAL", "DOUBLE PRECISION":
+		if _, err := strconv.ParseFloat(val, 64); err != nil {
+			return "", false
+		}
+		return val, true
+	}
+	return quoteStringLiteral(val), true
+}
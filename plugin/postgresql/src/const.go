@@ -0,0 +1,21 @@
+package src
+
+type EventType int8
+
+const (
+	INSERT EventType = 0
+	UPDATE EventType = 1
+	DELETE EventType = 2
+	UPSERT EventType = 3
+)
+
+type SyncMode string
+
+const (
+	SYNCMODE_NORMAL       SyncMode = "Normal"
+	SYNCMODE_LOG_UPDATE   SyncMode = "LogUpdate"
+	SYNCMODE_LOG_APPEND   SyncMode = "LogAppend"
+	SYNCMODE_NO_SYNC_DATA SyncMode = "NoSyncData"
+)
+
+const OutputName = "postgresql"
@@ -0,0 +1,246 @@
+package src
+
+import (
+	"log"
+	"regexp"
+	"strings"
+
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+)
+
+func (This *Conn) getAutoTableSqlSchemaAndTable(name string, DefaultSchemaName string) (SchemaName, TableName string) {
+	dbAndTable := strings.Replace(name, "`", "", -1)
+	i := strings.IndexAny(dbAndTable, ".")
+	if i > 0 {
+		if This.p.Schema == "" {
+			SchemaName = dbAndTable[0:i]
+		} else {
+			SchemaName = This.p.Schema
+		}
+		TableName = dbAndTable[i+1:]
+	} else {
+		if This.p.Schema == "" {
+			SchemaName = DefaultSchemaName
+		} else {
+			SchemaName = This.p.Schema
+		}
+		TableName = dbAndTable
+	}
+	SchemaName = strings.Trim(SchemaName, "\r\n ")
+	TableName = strings.Trim(TableName, "\r\n ;")
+	return
+}
+
+// 将sql 里 /* */ 注释内容给去掉
+var replaceSqlNotesReq = regexp.MustCompile(`/\*(.*?)\*/`)
+
+func (This *Conn) TransferNotes2Space(sql string) string {
+	sql = replaceSqlNotesReq.ReplaceAllString(sql, "")
+	return sql
+}
+
+// 去除连续的两个空格
+func (This *Conn) ReplaceTwoReplace(sql string) string {
+	for {
+		if strings.Index(sql, "  ") >= 0 {
+			sql = strings.Replace(sql, "  ", " ", -1)
+		} else {
+			return sql
+		}
+	}
+}
+
+// 按分隔符切分 sql, 括号，引号里的分隔符不切分
+func splitSql(sql string, isSep func(c byte) bool) (list []string) {
+	var depth int
+	var quote byte
+	var start int
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		if quote != 0 {
+			if c == '\\' && quote != '`' {
+				i++
+				continue
+			}
+			if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '\'', '"', '`':
+			quote = c
+			continue
+		case '(':
+			depth++
+			continue
+		case ')':
+			depth--
+			continue
+		}
+		if depth == 0 && isSep(c) {
+			if s := strings.Trim(sql[start:i], " "); s != "" {
+				list = append(list, s)
+			}
+			start = i + 1
+		}
+	}
+	if s := strings.Trim(sql[start:], " "); s != "" {
+		list = append(list, s)
+	}
+	return
+}
+
+func splitSqlByComma(sql string) []string {
+	return splitSql(sql, func(c byte) bool { return c == ',' })
+}
+
+func splitSqlBySpace(sql string) []string {
+	return splitSql(sql, func(c byte) bool { return c == ' ' || c == '\t' })
+}
+
+// 去掉开头的关键字, 不区分大小写, 关键字后面必须是空格,括号,反引号或者结尾
+func trimPrefixKeyword(sql string, keyword string) (string, bool) {
+	if len(sql) < len(keyword) || !strings.EqualFold(sql[0:len(keyword)], keyword) {
+		return sql, false
+	}
+	if len(sql) > len(keyword) {
+		switch sql[len(keyword)] {
+		case ' ', '(', '`':
+		default:
+			return sql, false
+		}
+	}
+	return strings.Trim(sql[len(keyword):], " "), true
+}
+
+func unquoteIdent(name string) string {
+	return strings.Trim(name, "`\" ")
+}
+
+// postgresql 的字符串常量
+func quoteStringLiteral(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// 去掉 mysql 字符串常量的引号和转义
+func unquoteStringLiteral(s string) string {
+	if len(s) < 2 || (s[0] != '\'' && s[0] != '"') || s[len(s)-1] != s[0] {
+		return s
+	}
+	quote := s[0]
+	s = s[1 : len(s)-1]
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' && i+1 < len(s) {
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case '0':
+				// postgresql 字符串不支持 \0
+			default:
+				b.WriteByte(s[i])
+			}
+			continue
+		}
+		if c == quote && i+1 < len(s) && s[i+1] == quote {
+			i++
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// 将 mysql 的 DDL 转成 postgresql 可以执行的 sql
+// 不支持的 DDL 返回空数组，由调用方直接跳过
+func (This *Conn) TranferQuerySql(data *pluginDriver.PluginDataType) (newSqlArr []string) {
+	var Query = This.TransferNotes2Space(data.Query)
+	Query = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ", "\t", " ").Replace(Query)
+	Query = strings.Trim(This.ReplaceTwoReplace(Query), " ;")
+	sql := strings.ToUpper(Query)
+	var SchemaName, TableName string
+
+	switch {
+	// ALTER TABLE tableName ADD COLUMN ...,MODIFY ...
+	case strings.Index(sql, "ALTER TABLE ") == 0:
+		sqlArr := splitSqlBySpace(Query)
+		if len(sqlArr) < 3 {
+			break
+		}
+		SchemaName, TableName = This.getAutoTableSqlSchemaAndTable(sqlArr[2], data.SchemaName)
+		alterSql := NewAlterSQL(SchemaName, TableName, strings.Join(sqlArr[3:], " "), This)
+		newSqlArr = alterSql.Transfer2PgSQL(data.SchemaName)
+
+	// TRUNCATE [TABLE] tableName
+	case strings.Index(sql, "TRUNCATE ") == 0:
+		sqlArr := splitSqlBySpace(Query)
+		var tableNameIndex = 1
+		if strings.Index(sql, "TRUNCATE TABLE ") == 0 {
+			tableNameIndex = 2
+		}
+		if len(sqlArr) <= tableNameIndex {
+			break
+		}
+		SchemaName, TableName = This.getAutoTableSqlSchemaAndTable(sqlArr[tableNameIndex], data.SchemaName)
+		newSqlArr = append(newSqlArr, "TRUNCATE TABLE "+QuoteSchemaAndTable(SchemaName, TableName))
+
+	// RENAME TABLE `test3` TO `test2`,`test2` TO `test4`
+	// postgresql 一条语句只能 rename 一个表，所以拆分成多条
+	case strings.Index(sql, "RENAME TABLE ") == 0:
+		for _, reNameInfo := range splitSqlByComma(Query[13:]) {
+			FromAndToArr := splitSqlBySpace(reNameInfo)
+			if len(FromAndToArr) != 3 {
+				log.Printf("[ERROR] output[%s] rename ddl transfer err!, sql :%s \n", OutputName, data.Query)
+				return nil
+			}
+			FromSchemaName, FromTableName := This.getAutoTableSqlSchemaAndTable(FromAndToArr[0], data.SchemaName)
+			ToSchemaName, ToTableName := This.getAutoTableSqlSchemaAndTable(FromAndToArr[2], data.SchemaName)
+			newSqlArr = append(newSqlArr, getRenameTableSql(FromSchemaName, FromTableName, ToSchemaName, ToTableName)...)
+		}
+
+	// DROP TABLE IF EXISTS tableName,tableName2
+	case strings.Index(sql, "DROP TABLE ") == 0:
+		tables := Query[11:]
+		if t, ok := trimPrefixKeyword(tables, "IF EXISTS"); ok {
+			tables = t
+		}
+		for _, name := range splitSqlByComma(tables) {
+			SchemaName, TableName = This.getAutoTableSqlSchemaAndTable(splitSqlBySpace(name)[0], data.SchemaName)
+			newSqlArr = append(newSqlArr, "DROP TABLE IF EXISTS "+QuoteSchemaAndTable(SchemaName, TableName))
+		}
+
+	// CREATE DATABASE IF NOT EXISTS databaseName
+	// mysql 的 database 对应 postgresql 的 schema
+	case strings.Index(sql, "CREATE DATABASE ") == 0, strings.Index(sql, "CREATE SCHEMA ") == 0:
+		if This.p.Schema != "" {
+			break
+		}
+		sqlArr := splitSqlBySpace(Query)
+		var schemaIndex = 2
+		if strings.Index(sql, " IF NOT EXISTS ") > 0 {
+			schemaIndex = 5
+		}
+		if len(sqlArr) <= schemaIndex {
+			break
+		}
+		newSqlArr = append(newSqlArr, "CREATE SCHEMA IF NOT EXISTS "+QuoteIdent(unquoteIdent(sqlArr[schemaIndex])))
+	}
+	return
+}
+
+// postgresql 的 RENAME TO 不能修改 schema ,不同 schema 的时候再 SET SCHEMA
+func getRenameTableSql(FromSchemaName, FromTableName, ToSchemaName, ToTableName string) (sqlArr []string) {
+	if FromTableName != ToTableName {
+		sqlArr = append(sqlArr, "ALTER TABLE "+QuoteSchemaAndTable(FromSchemaName, FromTableName)+" RENAME TO "+QuoteIdent(ToTableName))
+	}
+	if FromSchemaName != ToSchemaName {
+		sqlArr = append(sqlArr, "ALTER TABLE "+QuoteSchemaAndTable(FromSchemaName, ToTableName)+" SET SCHEMA "+QuoteIdent(ToSchemaName))
+	}
+	return
+}
@@ -0,0 +1,61 @@
+package src
+
+import (
+	"github.com/brokercap/Bifrost/admin/controller"
+	"github.com/brokercap/Bifrost/admin/xgo"
+	pluginStorage "github.com/brokercap/Bifrost/plugin/storage"
+)
+
+func init() {
+	xgo.Router("/bifrost/plugin/postgresql/schemalist", &PluginPostgresqlController{}, "*:GetSchemaList")
+	xgo.Router("/bifrost/plugin/postgresql/tablelist", &PluginPostgresqlController{}, "*:GetSchemaTableList")
+	xgo.Router("/bifrost/plugin/postgresql/tableinfo", &PluginPostgresqlController{}, "*:GetTableFields")
+}
+
+type PluginPostgresqlController struct {
+	controller.CommonController
+}
+
+func (c *PluginPostgresqlController) getToServerInfo() *pluginStorage.ToServer {
+	ToServerKey := c.Ctx.Get("ToServerKey")
+	toServerInfo := pluginStorage.GetToServerInfo(ToServerKey)
+	if toServerInfo == nil {
+		c.SetJsonData(ToServerKey + " no found")
+		c.StopServeJSON()
+		return nil
+	}
+	return toServerInfo
+}
+
+func (c *PluginPostgresqlController) GetSchemaList() {
+	toServerInfo := c.getToServerInfo()
+	conn := NewPostgresqlDBConn(toServerInfo.ConnUri)
+	defer conn.Close()
+	SchemaList := conn.GetSchemaList()
+	c.SetJsonData(SchemaList)
+	c.StopServeJSON()
+	return
+}
+
+func (c *PluginPostgresqlController) GetSchemaTableList() {
+	toServerInfo := c.getToServerInfo()
+	SchemaName := c.Ctx.Get("SchemaName")
+	conn := NewPostgresqlDBConn(toServerInfo.ConnUri)
+	defer conn.Close()
+	TableList := conn.GetSchemaTableList(SchemaName)
+	c.SetJsonData(TableList)
+	c.StopServeJSON()
+	return
+}
+
+func (c *PluginPostgresqlController) GetTableFields() {
+	toServerInfo := c.getToServerInfo()
+	SchemaName := c.Ctx.Get("SchemaName")
+	TableName := c.Ctx.Get("TableName")
+	conn := NewPostgresqlDBConn(toServerInfo.ConnUri)
+	defer conn.Close()
+	TableFieldMap := conn.GetTableFields(SchemaName, TableName)
+	c.SetJsonData(TableFieldMap)
+	c.StopServeJSON()
+	return
+}
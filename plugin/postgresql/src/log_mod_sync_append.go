@@ -0,0 +1,41 @@
+package src
+
+/*
+将所有数据转成 insert 的方式写入到 postgresql
+*/
+
+import (
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+)
+
+func (This *Conn) CommitLogMod_Append(list []*pluginDriver.PluginDataType) (errData *pluginDriver.PluginDataType) {
+	for _, data := range list {
+		if This.CheckDataSkip(data) {
+			continue
+		}
+		var index int
+		switch data.EventType {
+		case "update":
+			index = 1
+		case "insert", "delete":
+		default:
+			continue
+		}
+		var values []interface{}
+		values, This.err = This.getRowValues(data, index, This.p.Field)
+		if This.err != nil {
+			if This.canSkipTransferErr() {
+				continue
+			}
+			return data
+		}
+		stmt := This.getStmt(INSERT)
+		if stmt == nil {
+			return data
+		}
+		if !This.execStmt(stmt, data, values) {
+			return data
+		}
+	}
+	return
+}
@@ -0,0 +1,51 @@
+/*
+日志模式同步
+insert,update,delete 都转成 INSERT ... ON CONFLICT DO UPDATE
+目标表只保留每条数据最后一次操作的数据, binlog_event_type 字段记录最后一次操作的类型
+只要是同一条数据，只要有遍历过，后面遍历出来的数据，则不再进行操作
+*/
+package src
+
+import (
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+)
+
+func (This *Conn) CommitLogMod_Update(list []*pluginDriver.PluginDataType) (errData *pluginDriver.PluginDataType) {
+	opMap := make(map[interface{}]bool, 0)
+	n := len(list)
+	for i := n - 1; i >= 0; i-- {
+		data := list[i]
+		if This.CheckDataSkip(data) {
+			continue
+		}
+		var index int
+		switch data.EventType {
+		case "update":
+			index = 1
+		case "insert", "delete":
+		default:
+			continue
+		}
+		priKeyVal := This.getPriKeyVal(data, index)
+		if opMap[priKeyVal] {
+			continue
+		}
+		var values []interface{}
+		values, This.err = This.getRowValues(data, index, This.p.Field)
+		if This.err != nil {
+			if This.canSkipTransferErr() {
+				continue
+			}
+			return data
+		}
+		stmt := This.getStmt(UPSERT)
+		if stmt == nil {
+			return data
+		}
+		if !This.execStmt(stmt, data, values) {
+			return data
+		}
+		opMap[priKeyVal] = true
+	}
+	return
+}
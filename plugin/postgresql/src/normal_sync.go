@@ -0,0 +1,74 @@
+/*
+普通模式同步
+insert,update 转成 INSERT ... ON CONFLICT DO UPDATE
+delete 转成 delete
+只要是同一条数据，只要有遍历过，后面遍历出来的数据，则不再进行操作
+binlog_row_image 不是 FULL 的时候，按顺序执行，insert,update 只写入存在的字段
+*/
+package src
+
+import (
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+)
+
+func (This *Conn) CommitNormal(list []*pluginDriver.PluginDataType) (errData *pluginDriver.PluginDataType) {
+	//因为数据是有序写到list里的，里有 update,delete,insert，所以这里我们反向遍历
+	//用于存储数据库中最后一次操作记录
+	opMap := make(map[interface{}]bool, 0)
+	n := len(list)
+	// 同一条数据多次 update 的字段可能不一样，不能只执行最后一次操作
+	isFullRowImage := isFullRowImageList(list)
+	for i := n - 1; i >= 0; i-- {
+		data := list[i]
+		if !isFullRowImage {
+			data = list[n-1-i]
+		}
+		if This.CheckDataSkip(data) {
+			continue
+		}
+		if !isFullRowImage {
+			if This.commitPartialImage(data) {
+				continue
+			}
+			if This.err != nil || This.conn.err != nil {
+				return data
+			}
+		}
+		var index int
+		var Type = UPSERT
+		var fields = This.p.Field
+		switch data.EventType {
+		case "update":
+			index = 1
+		case "delete":
+			Type = DELETE
+			fields = This.p.PriKey
+		case "insert":
+		default:
+			continue
+		}
+		priKeyVal := This.getPriKeyVal(data, index)
+		if opMap[priKeyVal] {
+			continue
+		}
+		var values []interface{}
+		values, This.err = This.getRowValues(data, index, fields)
+		if This.err != nil {
+			if This.canSkipTransferErr() {
+				continue
+			}
+			return data
+		}
+		stmt := This.getStmt(Type)
+		if stmt == nil {
+			return data
+		}
+		if !This.execStmt(stmt, data, values) {
+			return data
+		}
+		if isFullRowImage {
+			opMap[priKeyVal] = true
+		}
+	}
+	return
+}
@@ -0,0 +1,112 @@
+/*
+binlog_row_image=MINIMAL,NOBLOB 的时候，行数据里只有部分字段
+insert 只写入存在的字段，其他字段由目标表默认值填充
+update 只更新 after image 中存在的字段，where 条件使用 before image 中的主键
+*/
+package src
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+)
+
+// 所有数据都是完整的行数据，才可以只取同一条数据的最后一次操作
+func isFullRowImageList(list []*pluginDriver.PluginDataType) bool {
+	for _, data := range list {
+		if !data.IsFullRowImageAll() {
+			return false
+		}
+	}
+	return true
+}
+
+// 字段是否需要写入，{$EventType} 等标签字段，每次都写入
+func isPresentField(data *pluginDriver.PluginDataType, index int, fromField string) bool {
+	if fromField == "" {
+		return false
+	}
+	if strings.Contains(fromField, "{$") {
+		return true
+	}
+	return data.IsColumnPresent(index, fromField)
+}
+
+// 生成只包含存在字段的 sql, 没有需要写入的字段的时候 sql 为空
+func (This *Conn) getPartialImageSql(data *pluginDriver.PluginDataType) (sql string, values []interface{}, err error) {
+	var index int
+	if data.EventType == "update" {
+		index = 1
+	}
+	var fields []fieldStruct
+	var hasSourceField bool
+	for _, v := range This.p.Field {
+		if !isPresentField(data, index, v.FromMysqlField) {
+			continue
+		}
+		if !strings.Contains(v.FromMysqlField, "{$") {
+			hasSourceField = true
+		}
+		fields = append(fields, v)
+	}
+	if !hasSourceField {
+		return "", nil, nil
+	}
+	values, err = This.getRowValues(data, index, fields)
+	if err != nil {
+		return "", nil, err
+	}
+	priKeys := getToFieldList(This.p.PriKey)
+	switch data.EventType {
+	case "insert":
+		sql = GetUpsertSql(This.p.schemaAndTable, getToFieldList(fields), priKeys)
+	case "update":
+		sql = GetUpdateSql(This.p.schemaAndTable, getToFieldList(fields), priKeys)
+		if sql == "" {
+			return "", nil, fmt.Errorf("%s no primary key,can't update by binlog_row_image != FULL", This.p.schemaAndTable)
+		}
+		var where []interface{}
+		where, err = This.getRowValues(data, 0, This.p.PriKey)
+		if err != nil {
+			return "", nil, err
+		}
+		values = append(values, where...)
+	default:
+		return "", nil, fmt.Errorf("EventType:%s not supported", data.EventType)
+	}
+	return
+}
+
+// 行数据不完整的 insert,update 在这里执行，返回 true 代表已经处理完成(包括跳过)
+// 返回 false 并且 err 都为 nil 的时候，由外层按完整行数据的逻辑处理
+func (This *Conn) commitPartialImage(data *pluginDriver.PluginDataType) bool {
+	switch data.EventType {
+	case "insert":
+		if data.IsFullRowImage(0) {
+			return false
+		}
+	case "update":
+		if data.IsFullRowImage(1) {
+			return false
+		}
+	default:
+		return false
+	}
+	var sql string
+	var values []interface{}
+	sql, values, This.err = This.getPartialImageSql(data)
+	if This.err != nil {
+		return This.canSkipTransferErr()
+	}
+	if sql == "" {
+		return true
+	}
+	This.conn.err = This.conn.Exec(sql, values...)
+	if This.conn.err != nil {
+		log.Printf("[ERROR] output[%s] partial image exec err:%s sql:%s data:%+v \n", OutputName, This.conn.err, sql, values)
+		return false
+	}
+	return true
+}
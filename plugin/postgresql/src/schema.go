@@ -0,0 +1,187 @@
+package src
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+
+	_ "github.com/lib/pq"
+)
+
+func NewPostgresqlDBConn(uri string) *postgresqlDB {
+	c := &postgresqlDB{
+		uri: uri,
+	}
+	c.Open()
+	return c
+}
+
+type postgresqlDB struct {
+	uri string
+	db  *sql.DB
+	tx  *sql.Tx
+	err error
+}
+
+func (This *postgresqlDB) Open() bool {
+	This.db, This.err = sql.Open("postgres", This.uri)
+	if This.err != nil {
+		log.Printf("[ERROR] output[%s] postgresqlDB Open err:%+v \n", OutputName, This.err)
+		return false
+	}
+	This.db.SetMaxOpenConns(1)
+	This.err = This.db.Ping()
+	if This.err != nil {
+		log.Printf("[ERROR] output[%s] postgresqlDB Ping err:%+v \n", OutputName, This.err)
+		return false
+	}
+	return true
+}
+
+func (This *postgresqlDB) Close() bool {
+	if This.tx != nil {
+		This.tx.Rollback()
+		This.tx = nil
+	}
+	if This.db != nil {
+		This.db.Close()
+	}
+	return true
+}
+
+// 过滤掉系统 schema
+func (This *postgresqlDB) GetSchemaList() (data []string) {
+	var rows *sql.Rows
+	rows, This.err = This.db.Query("SELECT schema_name FROM information_schema.schemata WHERE schema_name NOT LIKE 'pg\\_%' AND schema_name <> 'information_schema' ORDER BY schema_name")
+	if This.err != nil {
+		log.Printf("[ERROR] output[%s] GetSchemaList err:%+v \n", OutputName, This.err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var schemaName string
+		if This.err = rows.Scan(&schemaName); This.err != nil {
+			return
+		}
+		data = append(data, schemaName)
+	}
+	return
+}
+
+func (This *postgresqlDB) GetSchemaTableList(schema string) (data []string) {
+	if schema == "" {
+		return
+	}
+	var rows *sql.Rows
+	rows, This.err = This.db.Query("SELECT table_name FROM information_schema.tables WHERE table_schema = $1 AND table_type = 'BASE TABLE' ORDER BY table_name", schema)
+	if This.err != nil {
+		log.Printf("[ERROR] output[%s] GetSchemaTableList schema:%s err:%+v \n", OutputName, schema, This.err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tableName string
+		if This.err = rows.Scan(&tableName); This.err != nil {
+			return
+		}
+		data = append(data, tableName)
+	}
+	return
+}
+
+// 字段名和 mysql 插件保持一致,页面上可以用同样的方式展示
+type TableStruct struct {
+	COLUMN_NAME    string
+	COLUMN_DEFAULT *string
+	IS_NULLABLE    string
+	DATA_TYPE      string
+	COLUMN_KEY     string
+}
+
+func (This *postgresqlDB) GetTableFields(schema, table string) (data []TableStruct) {
+	sqlStr := `SELECT c.column_name, c.column_default, c.is_nullable, c.data_type,
+	CASE WHEN k.column_name IS NULL THEN '' ELSE 'PRI' END
+FROM information_schema.columns c
+LEFT JOIN (
+	SELECT kcu.column_name FROM information_schema.table_constraints tc
+	JOIN information_schema.key_column_usage kcu
+	ON tc.constraint_name = kcu.constraint_name AND tc.table_schema = kcu.table_schema AND tc.table_name = kcu.table_name
+	WHERE tc.constraint_type = 'PRIMARY KEY' AND tc.table_schema = $1 AND tc.table_name = $2
+) k ON c.column_name = k.column_name
+WHERE c.table_schema = $1 AND c.table_name = $2
+ORDER BY c.ordinal_position`
+	var rows *sql.Rows
+	rows, This.err = This.db.Query(sqlStr, schema, table)
+	if This.err != nil {
+		log.Printf("[ERROR] output[%s] GetTableFields schema:%s table:%s err:%+v \n", OutputName, schema, table, This.err)
+		return
+	}
+	defer rows.Close()
+	data = make([]TableStruct, 0)
+	for rows.Next() {
+		var field TableStruct
+		var columnDefault sql.NullString
+		This.err = rows.Scan(&field.COLUMN_NAME, &columnDefault, &field.IS_NULLABLE, &field.DATA_TYPE, &field.COLUMN_KEY)
+		if This.err != nil {
+			return
+		}
+		if columnDefault.Valid {
+			field.COLUMN_DEFAULT = &columnDefault.String
+		}
+		data = append(data, field)
+	}
+	return
+}
+
+func (This *postgresqlDB) Begin() error {
+	This.tx, This.err = This.db.Begin()
+	return This.err
+}
+
+func (This *postgresqlDB) Commit() error {
+	if This.tx == nil {
+		return nil
+	}
+	This.err = This.tx.Commit()
+	This.tx = nil
+	return This.err
+}
+
+func (This *postgresqlDB) Rollback() error {
+	if This.tx == nil {
+		return nil
+	}
+	This.err = This.tx.Rollback()
+	This.tx = nil
+	return This.err
+}
+
+// 在事务里的时候，使用事务执行
+func (This *postgresqlDB) Prepare(sqlStr string) (*sql.Stmt, error) {
+	if This.tx != nil {
+		return This.tx.Prepare(sqlStr)
+	}
+	return This.db.Prepare(sqlStr)
+}
+
+func (This *postgresqlDB) Exec(sqlStr string, args ...interface{}) (err error) {
+	if This.tx != nil {
+		_, This.err = This.tx.Exec(sqlStr, args...)
+	} else {
+		_, This.err = This.db.Exec(sqlStr, args...)
+	}
+	return This.err
+}
+
+func (This *postgresqlDB) CreateSchema(schema string) (err error) {
+	return This.Exec(fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s", QuoteIdent(schema)))
+}
+
+func (This *postgresqlDB) SelectVersion() string {
+	var version string
+	This.err = This.db.QueryRow("SELECT version()").Scan(&version)
+	if This.err != nil {
+		log.Printf("[ERROR] output[%s] SelectVersion err:%+v \n", OutputName, This.err)
+	}
+	return version
+}
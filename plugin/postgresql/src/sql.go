@@ -0,0 +1,88 @@
+package src
+
+import (
+	"fmt"
+	"strings"
+)
+
+// postgresql 里双引号包括的是标识符,区分大小写,表名和字段名都按源端原样加双引号
+func QuoteIdent(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+func QuoteSchemaAndTable(schemaName, tableName string) string {
+	return QuoteIdent(schemaName) + "." + QuoteIdent(tableName)
+}
+
+func quoteIdentList(names []string) string {
+	list := make([]string, 0, len(names))
+	for _, name := range names {
+		list = append(list, QuoteIdent(name))
+	}
+	return strings.Join(list, ",")
+}
+
+// $1,$2,$3 ... 从 start 开始
+func placeholders(start, n int) string {
+	list := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		list = append(list, fmt.Sprintf("$%d", start+i))
+	}
+	return strings.Join(list, ",")
+}
+
+func GetInsertSql(schemaAndTable string, fields []string) string {
+	return "INSERT INTO " + schemaAndTable + " (" + quoteIdentList(fields) + ") VALUES (" + placeholders(1, len(fields)) + ")"
+}
+
+// INSERT ... ON CONFLICT (主键) DO UPDATE SET 非主键字段, 没有主键的时候就是普通的 INSERT
+func GetUpsertSql(schemaAndTable string, fields []string, priKeys []string) string {
+	sql := GetInsertSql(schemaAndTable, fields)
+	if len(priKeys) == 0 {
+		return sql
+	}
+	priMap := make(map[string]bool, len(priKeys))
+	for _, name := range priKeys {
+		priMap[name] = true
+	}
+	updateList := make([]string, 0, len(fields))
+	for _, name := range fields {
+		if priMap[name] {
+			continue
+		}
+		updateList = append(updateList, QuoteIdent(name)+"=EXCLUDED."+QuoteIdent(name))
+	}
+	sql += " ON CONFLICT (" + quoteIdentList(priKeys) + ")"
+	if len(updateList) == 0 {
+		return sql + " DO NOTHING"
+	}
+	return sql + " DO UPDATE SET " + strings.Join(updateList, ",")
+}
+
+func getWhereByPriKeys(priKeys []string, start int) string {
+	where := make([]string, 0, len(priKeys))
+	for i, name := range priKeys {
+		where = append(where, fmt.Sprintf("%s=$%d", QuoteIdent(name), start+i))
+	}
+	return strings.Join(where, " AND ")
+}
+
+// 没有主键的时候不生成 sql,防止整表删除
+func GetDeleteSql(schemaAndTable string, priKeys []string) string {
+	if len(priKeys) == 0 {
+		return ""
+	}
+	return "DELETE FROM " + schemaAndTable + " WHERE " + getWhereByPriKeys(priKeys, 1)
+}
+
+// binlog_row_image != FULL 的时候，只更新存在的字段
+func GetUpdateSql(schemaAndTable string, fields []string, priKeys []string) string {
+	if len(priKeys) == 0 || len(fields) == 0 {
+		return ""
+	}
+	setList := make([]string, 0, len(fields))
+	for i, name := range fields {
+		setList = append(setList, fmt.Sprintf("%s=$%d", QuoteIdent(name), i+1))
+	}
+	return "UPDATE " + schemaAndTable + " SET " + strings.Join(setList, ",") + " WHERE " + getWhereByPriKeys(priKeys, len(fields)+1)
+}
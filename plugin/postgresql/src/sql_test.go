@@ -0,0 +1,115 @@
+package src
+
+import (
+	"testing"
+
+	"github.com/brokercap/Bifrost/sdk/pluginTestData"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGetUpsertSql(t *testing.T) {
+	Convey("有主键", t, func() {
+		sql := GetUpsertSql(QuoteSchemaAndTable("bifrost_test", "t1"), []string{"id", "name", "Age"}, []string{"id"})
+		So(sql, ShouldEqual, `INSERT INTO "bifrost_test"."t1" ("id","name","Age") VALUES ($1,$2,$3) ON CONFLICT ("id") DO UPDATE SET "name"=EXCLUDED."name","Age"=EXCLUDED."Age"`)
+	})
+	Convey("联合主键,并且只有主键字段", t, func() {
+		sql := GetUpsertSql(QuoteSchemaAndTable("bifrost_test", "t1"), []string{"id", "id2"}, []string{"id", "id2"})
+		So(sql, ShouldEqual, `INSERT INTO "bifrost_test"."t1" ("id","id2") VALUES ($1,$2) ON CONFLICT ("id","id2") DO NOTHING`)
+	})
+	Convey("没有主键", t, func() {
+		sql := GetUpsertSql(QuoteSchemaAndTable("bifrost_test", "t1"), []string{"id", "name"}, nil)
+		So(sql, ShouldEqual, `INSERT INTO "bifrost_test"."t1" ("id","name") VALUES ($1,$2)`)
+	})
+	Convey("字段名有双引号", t, func() {
+		So(QuoteIdent(`a"b`), ShouldEqual, `"a""b"`)
+	})
+}
+
+func TestGetDeleteAndUpdateSql(t *testing.T) {
+	Convey("delete", t, func() {
+		So(GetDeleteSql(`"s"."t"`, []string{"id", "id2"}), ShouldEqual, `DELETE FROM "s"."t" WHERE "id"=$1 AND "id2"=$2`)
+		So(GetDeleteSql(`"s"."t"`, nil), ShouldEqual, "")
+	})
+	Convey("update", t, func() {
+		So(GetUpdateSql(`"s"."t"`, []string{"name", "age"}, []string{"id"}), ShouldEqual, `UPDATE "s"."t" SET "name"=$1,"age"=$2 WHERE "id"=$3`)
+		So(GetUpdateSql(`"s"."t"`, []string{"name"}, nil), ShouldEqual, "")
+	})
+}
+
+func TestConn_TranferQuerySql(t *testing.T) {
+	conn := &Conn{p: &PluginParam{AutoTable: true}}
+	e := pluginTestData.NewEvent()
+	queryEvent := e.GetTestQueryData()
+	queryEvent.SchemaName = "bifrost_test"
+
+	Convey("ALTER TABLE 多个操作", t, func() {
+		queryEvent.Query = "ALTER TABLE `t1` DROP COLUMN `name`,\n CHANGE `number` `num` BIGINT(20) NOT NULL  COMMENT '馆藏''数量',\n ADD COLUMN `f1` VARCHAR(200) NULL AFTER `number`,\n ADD INDEX `idx_number` (`number`);"
+		sqlArr := conn.TranferQuerySql(queryEvent)
+		So(sqlArr, ShouldResemble, []string{
+			`ALTER TABLE "bifrost_test"."t1" RENAME COLUMN "number" TO "num"`,
+			`ALTER TABLE "bifrost_test"."t1" DROP COLUMN IF EXISTS "name",ALTER COLUMN "num" DROP DEFAULT,ALTER COLUMN "num" TYPE BIGINT USING "num"::BIGINT,ALTER COLUMN "num" SET NOT NULL,ADD COLUMN IF NOT EXISTS "f1" VARCHAR(200)`,
+			`COMMENT ON COLUMN "bifrost_test"."t1"."num" IS '馆藏''数量'`,
+		})
+	})
+
+	Convey("ADD COLUMN 默认值", t, func() {
+		queryEvent.Query = "alter table bifrost_test.t1 add `b` tinyint(1) NOT NULL DEFAULT '1', add column `d` decimal(18, 2) unsigned NOT NULL DEFAULT '0.00', add `dt` datetime NOT NULL DEFAULT '0000-00-00 00:00:00'"
+		sqlArr := conn.TranferQuerySql(queryEvent)
+		So(sqlArr, ShouldResemble, []string{
+			`ALTER TABLE "bifrost_test"."t1" ADD COLUMN IF NOT EXISTS "b" BOOLEAN DEFAULT TRUE NOT NULL,ADD COLUMN IF NOT EXISTS "d" NUMERIC(18,2) DEFAULT '0.00' NOT NULL,ADD COLUMN IF NOT EXISTS "dt" TIMESTAMP`,
+		})
+	})
+
+	Convey("MODIFY 及 RENAME TO", t, func() {
+		queryEvent.Query = "ALTER TABLE t1 MODIFY COLUMN `id` int(11) unsigned NOT NULL AUTO_INCREMENT, MODIFY `v` varchar(20) DEFAULT 'a', RENAME TO db2.t2"
+		sqlArr := conn.TranferQuerySql(queryEvent)
+		So(sqlArr, ShouldResemble, []string{
+			`ALTER TABLE "bifrost_test"."t1" ALTER COLUMN "id" TYPE BIGINT USING "id"::BIGINT,ALTER COLUMN "id" SET NOT NULL,ALTER COLUMN "v" DROP DEFAULT,ALTER COLUMN "v" TYPE VARCHAR(20) USING "v"::VARCHAR(20),ALTER COLUMN "v" SET DEFAULT 'a',ALTER COLUMN "v" DROP NOT NULL`,
+			`ALTER TABLE "bifrost_test"."t1" RENAME TO "t2"`,
+			`ALTER TABLE "bifrost_test"."t2" SET SCHEMA "db2"`,
+		})
+	})
+
+	Convey("只有索引的 ALTER 不生成 sql", t, func() {
+		queryEvent.Query = "ALTER TABLE t1 ADD PRIMARY KEY (id), ADD UNIQUE KEY unique_code (unique_code) USING BTREE, DROP INDEX idx_a, ENGINE=InnoDB"
+		So(conn.TranferQuerySql(queryEvent), ShouldBeEmpty)
+	})
+
+	Convey("RENAME TABLE", t, func() {
+		queryEvent.Query = "RENAME    TABLE `test3` TO `test2`,  test2 to test4 "
+		So(conn.TranferQuerySql(queryEvent), ShouldResemble, []string{
+			`ALTER TABLE "bifrost_test"."test3" RENAME TO "test2"`,
+			`ALTER TABLE "bifrost_test"."test2" RENAME TO "test4"`,
+		})
+	})
+
+	Convey("TRUNCATE", t, func() {
+		queryEvent.Query = " TRUNCATE TABLE db.tableTestName ;"
+		So(conn.TranferQuerySql(queryEvent), ShouldResemble, []string{`TRUNCATE TABLE "db"."tableTestName"`})
+		queryEvent.Query = "truncate `tableTestName`"
+		So(conn.TranferQuerySql(queryEvent), ShouldResemble, []string{`TRUNCATE TABLE "bifrost_test"."tableTestName"`})
+	})
+
+	Convey("DROP TABLE 及 CREATE DATABASE", t, func() {
+		queryEvent.Query = "DROP TABLE IF EXISTS `t1`,t2"
+		So(conn.TranferQuerySql(queryEvent), ShouldResemble, []string{
+			`DROP TABLE IF EXISTS "bifrost_test"."t1"`,
+			`DROP TABLE IF EXISTS "bifrost_test"."t2"`,
+		})
+		queryEvent.Query = "CREATE DATABASE IF NOT EXISTS `db3` DEFAULT CHARSET utf8mb4"
+		So(conn.TranferQuerySql(queryEvent), ShouldResemble, []string{`CREATE SCHEMA IF NOT EXISTS "db3"`})
+	})
+
+	Convey("指定了 Schema", t, func() {
+		conn := &Conn{p: &PluginParam{AutoTable: true, Schema: "public"}}
+		queryEvent.Query = "TRUNCATE db.t1"
+		So(conn.TranferQuerySql(queryEvent), ShouldResemble, []string{`TRUNCATE TABLE "public"."t1"`})
+		queryEvent.Query = "CREATE DATABASE db3"
+		So(conn.TranferQuerySql(queryEvent), ShouldBeEmpty)
+	})
+
+	Convey("不支持的 sql", t, func() {
+		queryEvent.Query = "CREATE TABLE t5 (id int)"
+		So(conn.TranferQuerySql(queryEvent), ShouldBeEmpty)
+	})
+}
@@ -0,0 +1,376 @@
+package src
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+)
+
+// 将 mysql 的字段类型转成 postgresql 的字段类型
+// mysqlColumnType 为 mysql 里的 COLUMN_TYPE ,比如 int(11) unsigned,decimal(18,2),enum('a','b')
+func TransferMysqlTypeToPgType(mysqlColumnType string) (pgType string) {
+	columnType := strings.ToLower(strings.Trim(mysqlColumnType, " "))
+	var isUnsigned bool
+	if strings.Contains(columnType, " unsigned") {
+		isUnsigned = true
+		columnType = strings.Replace(columnType, " unsigned", "", -1)
+	}
+	columnType = strings.Trim(strings.Replace(columnType, " zerofill", "", -1), " ")
+	dataType := columnType
+	var typeParam string
+	if i := strings.Index(columnType, "("); i > 0 {
+		dataType = strings.Trim(columnType[0:i], " ")
+		typeParam = strings.Trim(columnType[i+1:strings.LastIndex(columnType, ")")], " ")
+	}
+	switch dataType {
+	case "tinyint":
+		if typeParam == "1" && !isUnsigned {
+			return "BOOLEAN"
+		}
+		return "SMALLINT"
+	case "bool", "boolean":
+		return "BOOLEAN"
+	case "smallint":
+		if isUnsigned {
+			return "INTEGER"
+		}
+		return "SMALLINT"
+	case "mediumint":
+		return "INTEGER"
+	case "int", "integer":
+		if isUnsigned {
+			return "BIGINT"
+		}
+		return "INTEGER"
+	case "bigint":
+		if isUnsigned {
+			return "NUMERIC(20,0)"
+		}
+		return "BIGINT"
+	case "float":
+		return "REAL"
+	case "double", "real", "double precision":
+		return "DOUBLE PRECISION"
+	case "decimal", "numeric", "dec", "fixed":
+		if typeParam == "" {
+			return "NUMERIC(10,0)"
+		}
+		return "NUMERIC(" + strings.Replace(typeParam, " ", "", -1) + ")"
+	case "bit":
+		// bifrost 解析出来的 bit 是 int64
+		return "BIGINT"
+	case "year":
+		return "SMALLINT"
+	case "date":
+		return "DATE"
+	case "datetime", "timestamp":
+		if typeParam == "" {
+			return "TIMESTAMP"
+		}
+		return "TIMESTAMP(" + typeParam + ")"
+	case "time":
+		// mysql time 的范围是 -838:59:59 到 838:59:59 ,超出了 postgresql time 的范围
+		return "INTERVAL"
+	case "char":
+		if typeParam == "" {
+			return "CHAR(1)"
+		}
+		return "CHAR(" + typeParam + ")"
+	case "varchar":
+		if typeParam == "" {
+			return "VARCHAR(255)"
+		}
+		return "VARCHAR(" + typeParam + ")"
+	case "tinytext", "text", "mediumtext", "longtext":
+		return "TEXT"
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob":
+		return "BYTEA"
+	case "json":
+		return "JSONB"
+	case "enum":
+		return "VARCHAR(255)"
+	case "set":
+		return "TEXT"
+	default:
+		return "TEXT"
+	}
+}
+
+// 根据 ColumnMapping 里的类型转成 postgresql 类型, 整数类型 ColumnMapping 里是 int8,uint32 等
+func TransferToPgTypeByColumnType(columnType string) (pgType string, nullable bool) {
+	if strings.Index(columnType, "Nullable(") == 0 {
+		nullable = true
+		columnType = columnType[9 : len(columnType)-1]
+	}
+	switch columnType {
+	case "bool":
+		pgType = "BOOLEAN"
+	case "int8", "uint8", "int16":
+		pgType = "SMALLINT"
+	case "uint16", "int24", "uint24", "int32":
+		pgType = "INTEGER"
+	case "uint32", "int64":
+		pgType = "BIGINT"
+	case "uint64":
+		pgType = "NUMERIC(20,0)"
+	default:
+		pgType = TransferMysqlTypeToPgType(columnType)
+	}
+	return
+}
+
+// 没有 ColumnMapping 的时候，根据数据类型判断
+func TransferToPgTypeByColumnData(v interface{}) (pgType string) {
+	pgType = "TEXT"
+	if v == nil {
+		return
+	}
+	switch reflect.TypeOf(v).Kind() {
+	case reflect.Bool:
+		pgType = "BOOLEAN"
+	case reflect.Int8, reflect.Uint8, reflect.Int16:
+		pgType = "SMALLINT"
+	case reflect.Uint16, reflect.Int32:
+		pgType = "INTEGER"
+	case reflect.Uint32, reflect.Int, reflect.Int64:
+		pgType = "BIGINT"
+	case reflect.Uint, reflect.Uint64:
+		pgType = "NUMERIC(20,0)"
+	case reflect.Float32:
+		pgType = "REAL"
+	case reflect.Float64:
+		pgType = "DOUBLE PRECISION"
+	case reflect.Map, reflect.Slice, reflect.Array:
+		pgType = "JSONB"
+	case reflect.String:
+		if _, ok := v.(json.Number); ok {
+			pgType = "NUMERIC"
+			break
+		}
+		s := v.(string)
+		switch len(s) {
+		case 10:
+			if _, err := time.Parse("2006-01-02", s); err == nil {
+				pgType = "DATE"
+			}
+		case 19:
+			if _, err := time.Parse("2006-01-02 15:04:05", s); err == nil {
+				pgType = "TIMESTAMP"
+			}
+		}
+	}
+	return
+}
+
+func (This *Conn) GetToDestDataType(data *pluginDriver.PluginDataType, fieldName string) (pgType string, nullable bool) {
+	if data.ColumnMapping != nil {
+		if columnType, ok := data.ColumnMapping[fieldName]; ok {
+			return TransferToPgTypeByColumnType(columnType)
+		}
+	}
+	return TransferToPgTypeByColumnData(data.Rows[len(data.Rows)-1][fieldName]), true
+}
+
+// 自动建表, 字段按主键在前，其他字段按字段名排序
+// 日志模式下不创建主键,并且增加 binlog_event_type,binlog_datetime 字段
+func (This *Conn) TransferToCreateTableSql(data *pluginDriver.PluginDataType) (sql string, isContinue bool) {
+	if data.Rows == nil || len(data.Rows) == 0 {
+		return "", true
+	}
+	if len(data.Pri) == 0 && This.p.SyncMode != SYNCMODE_LOG_APPEND {
+		log.Printf("[ERROR] output[%s] only SyncMode:%s support no pri,bug current SyncMode:%s SchemaName:%s TableName:%s \n", OutputName, SYNCMODE_LOG_APPEND, This.p.SyncMode, data.SchemaName, data.TableName)
+		return "", true
+	}
+	fieldList := make([]string, 0)
+	priMap := make(map[string]bool, 0)
+	for _, fieldName := range data.Pri {
+		priMap[fieldName] = true
+		pgType, _ := This.GetToDestDataType(data, fieldName)
+		fieldList = append(fieldList, QuoteIdent(fieldName)+" "+pgType+" NOT NULL")
+	}
+	fieldNameList := make([]string, 0)
+	for fieldName := range data.Rows[len(data.Rows)-1] {
+		if priMap[fieldName] {
+			continue
+		}
+		fieldNameList = append(fieldNameList, fieldName)
+	}
+	sort.Strings(fieldNameList)
+	for _, fieldName := range fieldNameList {
+		pgType, nullable := This.GetToDestDataType(data, fieldName)
+		if !nullable {
+			pgType += " NOT NULL"
+		}
+		fieldList = append(fieldList, QuoteIdent(fieldName)+" "+pgType)
+	}
+	if This.p.SyncMode == SYNCMODE_LOG_UPDATE || This.p.SyncMode == SYNCMODE_LOG_APPEND {
+		fieldList = append(fieldList, QuoteIdent("binlog_event_type")+" VARCHAR(10)", QuoteIdent("binlog_datetime")+" TIMESTAMP")
+	}
+	if len(data.Pri) > 0 && This.p.SyncMode != SYNCMODE_LOG_APPEND {
+		fieldList = append(fieldList, "PRIMARY KEY ("+quoteIdentList(data.Pri)+")")
+	}
+	sql = fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", QuoteSchemaAndTable(This.GetSchemaName(data), This.GetTableName(data)), strings.Join(fieldList, ","))
+	return
+}
+
+// information_schema 里的 column_default 是表达式,比如 'abc'::character varying , nextval('t_id_seq'::regclass)
+// 只解析出常量，函数等表达式返回 nil
+func ParseColumnDefault(columnDefault *string) *string {
+	if columnDefault == nil {
+		return nil
+	}
+	val := strings.Trim(*columnDefault, " ")
+	if strings.HasPrefix(val, "'") {
+		end := strings.LastIndex(val, "'")
+		if end <= 0 {
+			return nil
+		}
+		val = strings.Replace(val[1:end], "''", "'", -1)
+		return &val
+	}
+	if i := strings.Index(val, "::"); i > 0 {
+		val = val[0:i]
+	}
+	val = strings.Trim(val, "()")
+	if strings.ToUpper(val) == "NULL" {
+		return nil
+	}
+	if _, err := strconv.ParseFloat(val, 64); err == nil {
+		return &val
+	}
+	switch strings.ToLower(val) {
+	case "true", "false":
+		return &val
+	}
+	return nil
+}
+
+func isZeroDateTime(data interface{}) bool {
+	s, ok := data.(string)
+	if !ok {
+		return false
+	}
+	return strings.HasPrefix(s, "0000-00-00")
+}
+
+// toDataType 为 information_schema.columns 里的 data_type
+func (This *Conn) dataTypeTransfer(data interface{}, fieldName string, toDataType string, defaultVal *string) (v interface{}, e error) {
+	defer func() {
+		if err := recover(); err != nil {
+			e = fmt.Errorf(fieldName + " " + fmt.Sprint(err))
+		}
+	}()
+	// mysql 里的 0000-00-00 在 postgresql 里是非法的日期,当成 null 处理
+	if isZeroDateTime(data) && (toDataType == "date" || strings.HasPrefix(toDataType, "timestamp")) {
+		data = nil
+	}
+	if data == nil {
+		if This.p.NullTransferDefault == false {
+			if defaultVal == nil {
+				return nil, nil
+			}
+			return *defaultVal, nil
+		}
+		//假如配置是强制转成默认值
+		switch toDataType {
+		case "smallint", "integer", "bigint", "numeric", "real", "double precision", "bit":
+			v = "0"
+		case "boolean":
+			v = "false"
+		case "date":
+			v = "1970-01-01"
+		case "timestamp without time zone", "timestamp with time zone":
+			v = "1970-01-01 00:00:00"
+		case "time without time zone", "time with time zone", "interval":
+			v = "00:00:00"
+		case "json", "jsonb":
+			v = "{}"
+		case "bytea":
+			v = []byte{}
+		default:
+			v = ""
+		}
+		return
+	}
+	switch toDataType {
+	case "boolean":
+		switch data.(type) {
+		case bool:
+			v = data.(bool)
+		default:
+			switch strings.ToLower(fmt.Sprint(data)) {
+			case "0", "", "false":
+				v = false
+			default:
+				v = true
+			}
+		}
+	case "bytea":
+		switch data.(type) {
+		case []byte:
+			v = data
+		default:
+			v = []byte(fmt.Sprint(data))
+		}
+	case "json", "jsonb":
+		switch data.(type) {
+		case string:
+			v = data
+		default:
+			var c []byte
+			c, e = json.Marshal(data)
+			if e != nil {
+				return
+			}
+			v = string(c)
+		}
+	default:
+		v, e = This.data2String(data)
+		if e != nil {
+			e = fmt.Errorf("field:%s ,%s", fieldName, e.Error())
+		}
+	}
+	return
+}
+
+func (This *Conn) data2String(data interface{}) (v string, e error) {
+	switch data.(type) {
+	case bool:
+		if data.(bool) {
+			return "1", nil
+		}
+		return "0", nil
+	case json.Number:
+		return data.(json.Number).String(), nil
+	case string:
+		// postgresql 的字符串里不能有 \x00
+		return strings.Replace(data.(string), "\x00", "", -1), nil
+	case []string:
+		// set 类型
+		return strings.Join(data.([]string), ","), nil
+	case float32:
+		return strconv.FormatFloat(float64(data.(float32)), 'f', -1, 32), nil
+	case float64:
+		return strconv.FormatFloat(data.(float64), 'f', -1, 64), nil
+	}
+	switch reflect.TypeOf(data).Kind() {
+	case reflect.Array, reflect.Slice, reflect.Map:
+		var c []byte
+		c, e = json.Marshal(data)
+		if e != nil {
+			e = fmt.Errorf("data source type: %s , json.Marshal err: %s ", reflect.TypeOf(data).Kind().String(), e.Error())
+			return
+		}
+		v = string(c)
+	default:
+		v = fmt.Sprint(data)
+	}
+	return
+}
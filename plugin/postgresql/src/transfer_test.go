@@ -0,0 +1,138 @@
+package src
+
+import (
+	"encoding/json"
+	"testing"
+
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTransferMysqlTypeToPgType(t *testing.T) {
+	Convey("mysql 类型转换", t, func() {
+		var caseMap = map[string]string{
+			"tinyint(1)":            "BOOLEAN",
+			"tinyint(4)":            "SMALLINT",
+			"tinyint(3) unsigned":   "SMALLINT",
+			"smallint(5) unsigned":  "INTEGER",
+			"mediumint(8)":          "INTEGER",
+			"int(11)":               "INTEGER",
+			"int(10) unsigned":      "BIGINT",
+			"bigint(20)":            "BIGINT",
+			"bigint(20) unsigned":   "NUMERIC(20,0)",
+			"float(9,2)":            "REAL",
+			"double":                "DOUBLE PRECISION",
+			"decimal(18, 2)":        "NUMERIC(18,2)",
+			"bit(64)":               "BIGINT",
+			"year(4)":               "SMALLINT",
+			"date":                  "DATE",
+			"datetime(3)":           "TIMESTAMP(3)",
+			"timestamp":             "TIMESTAMP",
+			"time":                  "INTERVAL",
+			"char(2)":               "CHAR(2)",
+			"varchar(400)":          "VARCHAR(400)",
+			"longtext":              "TEXT",
+			"blob":                  "BYTEA",
+			"varbinary(16)":         "BYTEA",
+			"json":                  "JSONB",
+			"enum('en1','en2')":     "VARCHAR(255)",
+			"set('set1','set2')":    "TEXT",
+			"geometry":              "TEXT",
+			"INT(11) UNSIGNED":      "BIGINT",
+			"int(11) zerofill":      "INTEGER",
+			"Nullable(varchar(20))": "TEXT",
+		}
+		for mysqlType, pgType := range caseMap {
+			So(TransferMysqlTypeToPgType(mysqlType), ShouldEqual, pgType)
+		}
+	})
+
+	Convey("ColumnMapping 类型转换", t, func() {
+		pgType, nullable := TransferToPgTypeByColumnType("Nullable(uint64)")
+		So(pgType, ShouldEqual, "NUMERIC(20,0)")
+		So(nullable, ShouldBeTrue)
+		pgType, nullable = TransferToPgTypeByColumnType("int24")
+		So(pgType, ShouldEqual, "INTEGER")
+		So(nullable, ShouldBeFalse)
+		pgType, _ = TransferToPgTypeByColumnType("Nullable(varchar(20))")
+		So(pgType, ShouldEqual, "VARCHAR(20)")
+	})
+}
+
+func TestConn_TransferToCreateTableSql(t *testing.T) {
+	data := &pluginDriver.PluginDataType{
+		SchemaName:    "bifrost_test",
+		TableName:     "t1",
+		Pri:           []string{"id"},
+		Rows:          []map[string]interface{}{{"id": uint32(1), "name": "a", "b": true}},
+		ColumnMapping: map[string]string{"id": "uint32", "name": "Nullable(varchar(20))", "b": "bool"},
+	}
+	Convey("普通模式", t, func() {
+		conn := &Conn{p: &PluginParam{SyncMode: SYNCMODE_NORMAL}}
+		sql, _ := conn.TransferToCreateTableSql(data)
+		So(sql, ShouldEqual, `CREATE TABLE IF NOT EXISTS "bifrost_test"."t1" ("id" BIGINT NOT NULL,"b" BOOLEAN NOT NULL,"name" VARCHAR(20),PRIMARY KEY ("id"))`)
+	})
+	Convey("日志追加模式不建主键", t, func() {
+		conn := &Conn{p: &PluginParam{SyncMode: SYNCMODE_LOG_APPEND, Schema: "public"}}
+		sql, _ := conn.TransferToCreateTableSql(data)
+		So(sql, ShouldEqual, `CREATE TABLE IF NOT EXISTS "public"."t1" ("id" BIGINT NOT NULL,"b" BOOLEAN NOT NULL,"name" VARCHAR(20),"binlog_event_type" VARCHAR(10),"binlog_datetime" TIMESTAMP)`)
+	})
+	Convey("没有主键", t, func() {
+		conn := &Conn{p: &PluginParam{SyncMode: SYNCMODE_NORMAL}}
+		sql, isContinue := conn.TransferToCreateTableSql(&pluginDriver.PluginDataType{Rows: data.Rows})
+		So(sql, ShouldEqual, "")
+		So(isContinue, ShouldBeTrue)
+	})
+}
+
+func TestParseColumnDefault(t *testing.T) {
+	Convey("解析 postgresql 字段默认值", t, func() {
+		var s = func(str string) *string { return &str }
+		So(*ParseColumnDefault(s("'abc''d'::character varying")), ShouldEqual, "abc'd")
+		So(*ParseColumnDefault(s("0")), ShouldEqual, "0")
+		So(*ParseColumnDefault(s("'-1'::integer")), ShouldEqual, "-1")
+		So(*ParseColumnDefault(s("(-1.5)")), ShouldEqual, "-1.5")
+		So(*ParseColumnDefault(s("false")), ShouldEqual, "false")
+		So(ParseColumnDefault(s("nextval('t1_id_seq'::regclass)")), ShouldBeNil)
+		So(ParseColumnDefault(s("CURRENT_TIMESTAMP")), ShouldBeNil)
+		So(ParseColumnDefault(s("NULL::character varying")), ShouldBeNil)
+		So(ParseColumnDefault(nil), ShouldBeNil)
+	})
+}
+
+func TestConn_dataTypeTransfer(t *testing.T) {
+	conn := &Conn{p: &PluginParam{}}
+	Convey("数据转换", t, func() {
+		v, err := conn.dataTypeTransfer(int8(1), "b", "boolean", nil)
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, true)
+		v, _ = conn.dataTypeTransfer("0", "b", "boolean", nil)
+		So(v, ShouldEqual, false)
+		v, _ = conn.dataTypeTransfer("0000-00-00 00:00:00", "dt", "timestamp without time zone", nil)
+		So(v, ShouldBeNil)
+		v, _ = conn.dataTypeTransfer([]string{"set1", "set2"}, "s", "text", nil)
+		So(v, ShouldEqual, "set1,set2")
+		v, _ = conn.dataTypeTransfer(float64(0.000001), "f", "double precision", nil)
+		So(v, ShouldEqual, "0.000001")
+		v, _ = conn.dataTypeTransfer(json.Number("123"), "n", "numeric", nil)
+		So(v, ShouldEqual, "123")
+		v, _ = conn.dataTypeTransfer(map[string]interface{}{"a": 1}, "j", "jsonb", nil)
+		So(v, ShouldEqual, `{"a":1}`)
+		v, _ = conn.dataTypeTransfer("a\x00b", "v", "character varying", nil)
+		So(v, ShouldEqual, "ab")
+		v, _ = conn.dataTypeTransfer("abc", "bin", "bytea", nil)
+		So(v, ShouldResemble, []byte("abc"))
+	})
+	Convey("null 值", t, func() {
+		def := "abc"
+		v, _ := conn.dataTypeTransfer(nil, "v", "character varying", &def)
+		So(v, ShouldEqual, "abc")
+		v, _ = conn.dataTypeTransfer(nil, "v", "character varying", nil)
+		So(v, ShouldBeNil)
+		conn := &Conn{p: &PluginParam{NullTransferDefault: true}}
+		v, _ = conn.dataTypeTransfer(nil, "i", "integer", nil)
+		So(v, ShouldEqual, "0")
+		v, _ = conn.dataTypeTransfer(nil, "d", "date", nil)
+		So(v, ShouldEqual, "1970-01-01")
+	})
+}
@@ -0,0 +1,4 @@
+package src
+
+const VERSION = "v2.3.12"
+const BIFROST_VERION = "v2.3.12"
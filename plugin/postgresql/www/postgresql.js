@@ -0,0 +1,191 @@
+function doGetPluginParam(){
+    var result = {data:{},status:false,msg:"failed",batchSupport:false}
+
+    var Table = $("#to_postgresql_table").val();
+    var Schema = $("#to_postgresql_schema").val();
+    var BatchSize = $("#Postgresql_BatchSize").val();
+    var NullTransferDefault = $("#Postgresql_NullTransferDefault").val();
+    var SyncMode = $("#Postgresql_SyncMode").val();
+
+    if( Table != "" && SyncMode == "NoSyncData" ) {
+        result.msg = "不同步数据模式,只支持 自动表结构匹配表 模式!";
+        result.batchSupport = true;
+        return result;
+    }
+
+    if (BatchSize != "" && BatchSize != null && isNaN(BatchSize)){
+        result.msg = "BatchSize must be int!"
+        return result;
+    }
+
+    var PriKey = [];
+    var Field = [];
+    // 选择了指定目标表的情况下，并且非日志追加模式同步情况下，必须指定目标表主键字段
+    if ( Table != "" ) {
+        $.each($("#ToPostgresqlTableFieldsTable tr"),function () {
+            var to_field_name = $(this).find("input[name=to_field_name]").val();
+            var from_field_name = $(this).find("input[name=from_field_name]").val();
+            var d       = {};
+            d["ToField"]     = to_field_name;
+            //假如没有配置任务同步,则代表这个表采用，默认值
+            if ( from_field_name == "" ){
+                return;
+            }
+            d["FromMysqlField"]  = from_field_name;
+            if($(this).find("input[name=pri_checkbox]").is(':checked')) {
+                PriKey.push(d);
+            }
+            Field.push(d);
+        });
+        if (PriKey.length == 0 && SyncMode != 'LogAppend') {
+            result.msg = "请选择主键字段！";
+            return result;
+        }
+    }else{
+        result.batchSupport = true;
+    }
+
+    result.msg = "success";
+    result.status = true;
+    result.data["Field"]    = Field;
+    result.data["PriKey"]   = PriKey;
+    result.data["Schema"]   = Schema;
+    result.data["Table"]    = Table;
+    result.data["BatchSize"] = parseInt(BatchSize);
+    if (NullTransferDefault == "true"){
+        result.data["NullTransferDefault"] = true;
+    }else{
+        result.data["NullTransferDefault"] = false;
+    }
+    result.data["SyncMode"] = SyncMode;
+    return result;
+}
+
+function Postgresql_GetToSchemaList() {
+    $.get(
+        "/bifrost/plugin/postgresql/schemalist?ToServerKey="+$("#addToServerKey").val(),
+        function (d, status) {
+            if (status != "success") {
+                return false;
+            }
+            var html = "<option value=''>请选择Schema</option>";
+            for(i in d){
+                var SchemaName = d[i];
+                html += "<option value=\""+SchemaName+"\">"+SchemaName+"</option>";
+            }
+            $("#to_postgresql_schema").html(html);
+        }, 'json');
+}
+
+function Postgresql_GetToSchemaTableList(schemaName) {
+    $("#to_postgresql_table").html("");
+    $("#ToPostgresqlTableFieldsTable").html("");
+    if(schemaName == ""){
+        return
+    }
+    $.get(
+        "/bifrost/plugin/postgresql/tablelist?ToServerKey="+$("#addToServerKey").val()+"&SchemaName="+schemaName,
+        function (d, status) {
+            if (status != "success") {
+                return false;
+            }
+            var html = "<option value=''>请选择表</option>";
+            for(i in d){
+                var TableName = d[i];
+                html += "<option value=\""+TableName+"\">"+TableName+"</option>";
+            }
+            $("#to_postgresql_table").html(html);
+        }, 'json');
+}
+
+function Postgresql_GetToTableDesc(schemaName,tableName) {
+    $("#ToPostgresqlTableFieldsTable").html("");
+    if(tableName == ""){
+        return
+    }
+    $.get(
+        "/bifrost/plugin/postgresql/tableinfo?ToServerKey="+$("#addToServerKey").val()+"&SchemaName="+schemaName+"&TableName="+tableName,
+        function (d, status) {
+            if (status != "success") {
+                return false;
+            }
+
+            var fieldsMap = {};
+            $.each($("#TableFieldsContair input"),function(){
+                fieldsMap[$(this).val().toLowerCase()] = getTableFieldType($(this).val());
+            });
+
+            var html = "";
+            for(var i in d){
+                var toField = "";
+                var isPri = d[i].COLUMN_KEY == "PRI";
+                var tmpKey = d[i].COLUMN_NAME.toLowerCase();
+                if(fieldsMap.hasOwnProperty(tmpKey)){
+                    toField = fieldsMap[tmpKey].ColumnName;
+                }
+
+                if(toField == ""){
+                    switch (tmpKey){
+                        case "binlog_event_type":
+                        case "eventtype":
+                        case "event_type":
+                            toField = "{$EventType}";
+                            break;
+                        case "timestamp":
+                            toField = "{$Timestamp}";
+                            break;
+                        case "binlogtimestamp":
+                        case "binlog_timestamp":
+                            toField = "{$BinlogTimestamp}";
+                            break;
+                        case "binlog_datetime":
+                        case "binlogdatetime":
+                            toField = "{$BinlogDateTime}";
+                            break;
+                        case "binlogfilenum":
+                        case "binlog_filenum":
+                            toField = "{$BinlogFileNum}";
+                            break;
+                        case "binlogposition":
+                        case "binlog_position":
+                        case "binlog_pos":
+                            toField = "{$BinlogPosition}";
+                            break;
+                        default:
+                            break;
+                    }
+                }
+
+                var htmlTr = "<tr id='to_postgresql_field_name_"+d[i].COLUMN_NAME+"'>";
+                htmlTr += "<td> <input type=\"text\"  value=\""+d[i].COLUMN_NAME+"\" name=\"to_field_name\" disabled  class=\"form-control\" placeholder=\"\"></td>"
+                htmlTr += "<td> <input type=\"text\" onfocus='ToPostgresql_Input_onFocus(this)' id='postgresql_filed_from_"+d[i].COLUMN_NAME+"' name=\"from_field_name\" value='"+toField+"' class=\"form-control\" placeholder=\"\"></td>";
+                htmlTr += "<td> <input type='checkbox'";
+                if(isPri){
+                    htmlTr += " checked='checked' ";
+                }
+                htmlTr += " style='width: 20px; height: 20px' name='pri_checkbox' class=\"form-control\" /></td>";
+                htmlTr += "</tr>";
+                html += htmlTr;
+            }
+            $("#ToPostgresqlTableFieldsTable").html(html);
+        }, 'json');
+}
+
+Postgresql_GetToSchemaList();
+
+var Postgresql_OnFoucsInputId = "";
+
+function ToPostgresql_Input_onFocus(obj) {
+    Postgresql_OnFoucsInputId = $(obj).attr("id");
+}
+
+$("#TableFieldsContair").on("dblclick","p.fieldsname",function(){
+    if (Postgresql_OnFoucsInputId == ""){
+        return false;
+    }
+    var fieldName = $(this).find("input").val();
+    $("#"+Postgresql_OnFoucsInputId).val($.trim(fieldName));
+});
+
+// 设置不过滤 sql 事件, sql 将会提交到 postgresql 插件来
+setPluginParamDefault("FilterQuery","false");
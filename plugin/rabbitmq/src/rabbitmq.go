@@ -54,6 +54,8 @@ type PluginParam struct {
 	Declare            bool
 	expir              string
 	deliveryMode       uint8
+	contentType        string
+	OtherObjectType    pluginDriver.OtherObjectType
 	BifrostFilterQuery bool // bifrost server 保留,是否过滤sql事件
 }
 
@@ -180,6 +182,12 @@ func (This *Conn) GetParam(p interface{}) (*PluginParam, error) {
 	} else {
 		param.deliveryMode = 1
 	}
+	switch param.OtherObjectType {
+	case pluginDriver.ProtobufType, pluginDriver.MsgpackType:
+		param.contentType = pluginDriver.GetOtherObjectContentType(param.OtherObjectType)
+	default:
+		param.contentType = "text/plain"
+	}
 	This.p = &param
 	return &param, nil
 }
@@ -267,11 +275,15 @@ func (This *Conn) sendToList(data *pluginDriver.PluginDataType) (*pluginDriver.P
 			return nil, data, This.err
 		}
 	}
-	c, err := json.Marshal(data)
+	c, err := pluginDriver.ToOtherObjectBytes(data, This.p.OtherObjectType)
 	if err != nil {
 		This.err = err
 		return nil, data, err
 	}
+	// 当前格式下不需要发送的事件，比如 debezium 格式下的 sql,commit 事件
+	if c == nil {
+		return nil, nil, nil
+	}
 	var queuename string
 	var exchange string
 	var routingkey string
@@ -18,7 +18,7 @@ func (This *Conn) SendAndWait(exchange *string, routingkey *string, c *[]byte, D
 		true,        // mandatory
 		false,       // immediate
 		amqp.Publishing{
-			ContentType:  "text/plain",
+			ContentType:  This.p.contentType,
 			Body:         *c,
 			DeliveryMode: DeliveryMode,
 			Expiration:   This.p.expir,
@@ -58,7 +58,7 @@ func (This *Conn) SendAndNoWait(exchange *string, routingkey *string, c *[]byte,
 		false,       // mandatory
 		false,       // immediate
 		amqp.Publishing{
-			ContentType:  "text/plain",
+			ContentType:  This.p.contentType,
 			Body:         *c,
 			DeliveryMode: DeliveryMode,
 			Expiration:   This.p.expir,
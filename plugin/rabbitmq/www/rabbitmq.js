@@ -63,6 +63,7 @@ function doGetPluginParam(){
     data["RoutingKey"] = RoutingKey;
     data["Expir"] = parseInt(Expir);
 	data["Declare"] = declare;
+	data["OtherObjectType"] = $("#RabbitMQ_OtherObjectType").val();
 	result.data = data;
 	result.msg = "success";
 	result.status = true;
@@ -78,4 +79,30 @@ function RabbitMQ_Declare_Onchange(){
 }
 RabbitMQ_Declare_Onchange();
 
+function initRabbitMQSupportedOtherOutputTypeList(){
+    $.get(
+        "/plugin/getSupportedOtherOutputTypeList",
+        function (d, status) {
+            if (status != "success") {
+                return false;
+            }
+            var html = "";
+            var defaultValue = null;
+            for (var i in d) {
+                var typeName = d[i].name;
+                var value = d[i].value;
+                if (defaultValue == null) {
+                    defaultValue = value
+                }
+                html += "<option value=\"" + value + "\">" + typeName + "</option>";
+            }
+            $("#RabbitMQ_OtherObjectType").html(html);
+            if (defaultValue != null) {
+                $("#RabbitMQ_OtherObjectType").val(defaultValue);
+            }
+        }, 'json');
+}
+
+initRabbitMQSupportedOtherOutputTypeList();
+
 setPluginParamDefault("FilterQuery",false);
\ No newline at end of file
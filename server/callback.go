@@ -41,6 +41,12 @@ func (db *db) Callback(data *outputDriver.PluginDataType) {
 	default:
 		break
 	}
+	// 数据校验监听的表, 记录有变更的主键
+	db.callbackRowWatcher(data)
+	// 增量快照信号表的水位线
+	if db.callbackWatermark(data) {
+		return
+	}
 	if db.Callback0(data) == false {
 		return
 	}
@@ -68,6 +74,7 @@ func (db *db) CallbackDoCommit(data *outputDriver.PluginDataType) {
 				Pri:             data.Pri,
 				ColumnMapping:   data.ColumnMapping,
 				EventID:         data.EventID,
+				PayloadIndex:    data.PayloadIndex,
 			}
 			db.Callback0(data0)
 		}
@@ -89,6 +89,7 @@ func (This *consume_channel_obj) sendToServerResult(ToServerInfo *ToServer, plug
 		GTID:           pluginData.Gtid,
 		Timestamp:      pluginData.Timestamp,
 		EventID:        pluginData.EventID,
+		PayloadIndex:   pluginData.PayloadIndex,
 	}
 	ToServerInfo.LastQueueBinlog = lastQueueBinlog
 
@@ -106,7 +107,7 @@ func (This *consume_channel_obj) sendToServerResult(ToServerInfo *ToServer, plug
 	if ToServerInfo.LastBinlogKey == nil {
 		ToServerInfo.LastBinlogKey = getToServerLastBinlogkey(This.db, ToServerInfo)
 	}
-	saveBinlogPositionByCache(ToServerInfo.LastBinlogKey, lastQueueBinlog)
+	saveBinlogPositionByCache(This.db.Name, ToServerInfo.LastBinlogKey, lastQueueBinlog)
 	if FileQueueStatus {
 		ToServerInfo.InitFileQueue(This.db.Name, pluginData.SchemaName, pluginData.TableName)
 		ToServerInfo.AppendToFileQueue(pluginData)
@@ -174,6 +175,7 @@ func (This *consume_channel_obj) transferToPluginData(data *mysql.EventReslut) (
 		Pri:            data.Pri,
 		ColumnMapping:  data.ColumnMapping,
 		EventID:        data.EventID,
+		PresentColumns: data.PresentColumns,
 	}
 	return
 }
@@ -312,6 +314,15 @@ func (This *consume_channel_obj) sendToServerList0(toServerList []*ToServer, plu
 				continue
 			}
 		*/
-		This.sendToServerResult(toServerInfo, pluginData)
+		// 按行过滤之后, update 有可能会被拆成 insert 和 delete
+		dataList, err := toServerInfo.filterRows(pluginData)
+		if err != nil {
+			// 不能丢数据, 原样放进队列, ToServer 是暂停状态, 不会同步出去
+			log.Println("ToServer ", *toServerInfo.Key, toServerInfo.ToServerKey, toServerInfo.ToServerID, " filterRows err:", err)
+			dataList = []*pluginDriver.PluginDataType{pluginData}
+		}
+		for _, data := range dataList {
+			This.sendToServerResult(toServerInfo, data)
+		}
 	}
 }
@@ -0,0 +1,342 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/brokercap/Bifrost/config"
+	"github.com/brokercap/Bifrost/server/storage"
+)
+
+// 多个 Bifrost 进程配置同一个 meta_storage_type=redis 及 cluster_name 的时候, 开启 ha 之后选出一个 leader
+// 只有 leader 启动数据源和同步, standby 定时加载配置, leader 租约过期之后接管
+// 每次成为 leader 分配一个递增的 fencing token, 写元数据的时候存储里的 token 变了则写入失败
+
+const (
+	ROLE_LEADER  = "leader"
+	ROLE_STANDBY = "standby"
+
+	LEASE_KEY   = "bifrost_ha_leader"
+	FENCING_KEY = "bifrost_ha_fencing_token"
+
+	DEFAULT_LEASE_TTL = 10
+)
+
+type LeaseInfo struct {
+	NodeID      string
+	Addr        string
+	AcquireTime int64 // 纳秒, 区分同一个节点的多次选举
+}
+
+type Status struct {
+	Enable         bool
+	NodeID         string
+	Role           string
+	LeaseTTL       int
+	Holder         LeaseInfo // 当前持有租约的节点
+	Token          int64     // 当前的 fencing token
+	LeaseDeadline  int64     // leader 本地认为租约有效的截止时间
+	ConfigLoadTime int64     // standby 最后一次加载配置的时间
+}
+
+type Handler struct {
+	OnElected func()       // 成为 leader, 启动数据源和同步
+	OnRevoked func()       // 失去租约, 必须马上停止同步
+	OnStandby func() error // standby 定时加载配置
+}
+
+// 测试的时候替换
+var acquireLease = storage.AcquireLease
+var renewLease = storage.RenewLease
+var releaseLease = storage.ReleaseLease
+var incr = storage.Incr
+var getKeyVal = storage.GetKeyVal
+
+type election struct {
+	sync.RWMutex
+	nodeID         string
+	addr           string
+	ttl            time.Duration
+	role           string
+	leaseVal       []byte
+	token          int64
+	deadline       time.Time
+	holder         LeaseInfo
+	holderToken    int64
+	configLoadTime int64
+	handler        Handler
+}
+
+var e *election
+
+func Init() {
+	if config.GetConfigVal("Bifrostd", "ha") != "true" {
+		return
+	}
+	if storage.GetMetaStorageType() != "redis" {
+		log.Println("config ha=true need meta_storage_type=redis")
+		os.Exit(1)
+	}
+	if config.GetConfigVal("Bifrostd", "shard") == "true" {
+		log.Println("config ha=true and shard=true can't be both enabled")
+		os.Exit(1)
+	}
+	nodeID := getNodeID()
+	ttl := getLeaseTTL("ha_lease_ttl")
+	e = newElection(nodeID, getNodeAddr(), time.Duration(ttl)*time.Second)
+	storage.SetFencing([]byte(FENCING_KEY), FencingToken)
+	log.Println("ha enable, node id:", nodeID, " lease ttl:", ttl)
+}
+
+func newElection(nodeID, addr string, ttl time.Duration) *election {
+	return &election{
+		nodeID: nodeID,
+		addr:   addr,
+		ttl:    ttl,
+		role:   ROLE_STANDBY,
+	}
+}
+
+func Enable() bool {
+	return e != nil
+}
+
+// 没有开启 ha 的时候, 当前节点就是 leader
+func IsLeader() bool {
+	if e == nil {
+		return true
+	}
+	return e.isLeader()
+}
+
+func CheckLeader() error {
+	if e == nil {
+		return nil
+	}
+	return e.checkLeader()
+}
+
+// 写元数据带上的 fencing token, 本地租约已经过期则不能写
+func FencingToken() (int64, error) {
+	if e == nil {
+		return 0, nil
+	}
+	return e.fencingToken()
+}
+
+func Start(handler Handler) {
+	if e == nil {
+		handler.OnElected()
+		return
+	}
+	e.handler = handler
+	go e.loop()
+}
+
+// 正常退出的时候释放租约, standby 不需要等租约过期就可以接管
+func Release() {
+	if e == nil {
+		return
+	}
+	e.release()
+}
+
+func GetStatus() Status {
+	if e == nil {
+		return Status{Role: ROLE_LEADER}
+	}
+	return e.getStatus()
+}
+
+func (This *election) isLeader() bool {
+	This.RLock()
+	defer This.RUnlock()
+	return This.role == ROLE_LEADER && time.Now().Before(This.deadline)
+}
+
+func (This *election) checkLeader() error {
+	if This.isLeader() {
+		return nil
+	}
+	This.RLock()
+	defer This.RUnlock()
+	return fmt.Errorf("node:%s is not leader, leader:%s ( %s )", This.nodeID, This.holder.NodeID, This.holder.Addr)
+}
+
+func (This *election) fencingToken() (int64, error) {
+	if err := This.checkLeader(); err != nil {
+		return 0, err
+	}
+	This.RLock()
+	defer This.RUnlock()
+	return This.token, nil
+}
+
+func (This *election) loop() {
+	for {
+		This.campaign()
+		time.Sleep(This.ttl / 3)
+	}
+}
+
+func (This *election) campaign() {
+	This.RLock()
+	role := This.role
+	This.RUnlock()
+	if role == ROLE_LEADER {
+		This.renew()
+		return
+	}
+	if This.acquire() {
+		log.Println("ha node:", This.nodeID, " elected leader, fencing token:", This.token)
+		// 启动数据源可能比较慢, 不能影响续期
+		go This.handler.OnElected()
+		return
+	}
+	This.loadHolder()
+	if This.handler.OnStandby == nil {
+		return
+	}
+	if err := This.handler.OnStandby(); err != nil {
+		log.Println("ha standby load config err:", err)
+		return
+	}
+	This.Lock()
+	This.configLoadTime = time.Now().Unix()
+	This.Unlock()
+}
+
+func (This *election) acquire() bool {
+	start := time.Now()
+	val, _ := json.Marshal(LeaseInfo{NodeID: This.nodeID, Addr: This.addr, AcquireTime: start.UnixNano()})
+	ok, err := acquireLease([]byte(LEASE_KEY), val, This.ttl)
+	if err != nil {
+		log.Println("ha acquire lease err:", err)
+		return false
+	}
+	if !ok {
+		return false
+	}
+	token, err := incr([]byte(FENCING_KEY))
+	if err != nil {
+		log.Println("ha incr fencing token err:", err)
+		releaseLease([]byte(LEASE_KEY), val)
+		return false
+	}
+	This.Lock()
+	defer This.Unlock()
+	This.role = ROLE_LEADER
+	This.leaseVal = val
+	This.token = token
+	This.holder = LeaseInfo{NodeID: This.nodeID, Addr: This.addr, AcquireTime: start.UnixNano()}
+	This.holderToken = token
+	This.deadline = This.leaseDeadline(start)
+	return true
+}
+
+// 存储里的过期时间是从收到请求开始算的, 本地从发请求之前开始算, 再留出时钟误差
+func (This *election) leaseDeadline(start time.Time) time.Time {
+	return start.Add(This.ttl - This.ttl/5)
+}
+
+func (This *election) renew() {
+	start := time.Now()
+	This.RLock()
+	val, token, deadline := This.leaseVal, This.token, This.deadline
+	This.RUnlock()
+	ok, err := renewLease([]byte(LEASE_KEY), val, This.ttl)
+	if err == nil && ok {
+		// 有更大的 fencing token, 说明租约已经被别的节点拿过了
+		currentToken, err := This.getToken()
+		if err == nil && currentToken != token {
+			This.revoke(fmt.Sprintf("fencing token %d != %d", currentToken, token))
+			return
+		}
+		This.Lock()
+		This.deadline = This.leaseDeadline(start)
+		This.Unlock()
+		return
+	}
+	if err == nil {
+		This.revoke("lease lost")
+		return
+	}
+	// 存储暂时不可用, 本地租约过期之前可以重试
+	log.Println("ha renew lease err:", err)
+	if time.Now().After(deadline) {
+		This.revoke("lease expired")
+	}
+}
+
+func (This *election) revoke(reason string) {
+	This.Lock()
+	This.role = ROLE_STANDBY
+	This.leaseVal = nil
+	This.deadline = time.Time{}
+	This.Unlock()
+	log.Println("ha node:", This.nodeID, " lost leader:", reason)
+	if This.handler.OnRevoked != nil {
+		This.handler.OnRevoked()
+	}
+}
+
+func (This *election) release() {
+	This.Lock()
+	defer This.Unlock()
+	if This.role != ROLE_LEADER {
+		return
+	}
+	if err := releaseLease([]byte(LEASE_KEY), This.leaseVal); err != nil {
+		log.Println("ha release lease err:", err)
+	}
+	This.role = ROLE_STANDBY
+	This.leaseVal = nil
+	This.deadline = time.Time{}
+}
+
+func (This *election) getToken() (int64, error) {
+	b, err := getKeyVal([]byte(FENCING_KEY))
+	if err != nil || len(b) == 0 {
+		return 0, err
+	}
+	return strconv.ParseInt(string(b), 10, 64)
+}
+
+func (This *election) loadHolder() {
+	var holder LeaseInfo
+	b, err := getKeyVal([]byte(LEASE_KEY))
+	if err != nil {
+		return
+	}
+	if len(b) > 0 {
+		json.Unmarshal(b, &holder)
+	}
+	token, _ := This.getToken()
+	This.Lock()
+	This.holder = holder
+	This.holderToken = token
+	This.Unlock()
+}
+
+func (This *election) getStatus() Status {
+	This.RLock()
+	defer This.RUnlock()
+	status := Status{
+		Enable:         true,
+		NodeID:         This.nodeID,
+		Role:           This.role,
+		LeaseTTL:       int(This.ttl / time.Second),
+		Holder:         This.holder,
+		Token:          This.holderToken,
+		ConfigLoadTime: This.configLoadTime,
+	}
+	if This.role == ROLE_LEADER {
+		status.LeaseDeadline = This.deadline.Unix()
+	}
+	return status
+}
@@ -0,0 +1,156 @@
+package cluster
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// 内存里模拟共享存储
+type memLeaseStorage struct {
+	sync.Mutex
+	data   map[string]string
+	expire map[string]time.Time
+	err    error
+}
+
+func newMemLeaseStorage() *memLeaseStorage {
+	s := &memLeaseStorage{data: make(map[string]string), expire: make(map[string]time.Time)}
+	acquireLease = func(key []byte, val []byte, ttl time.Duration) (bool, error) {
+		s.Lock()
+		defer s.Unlock()
+		if s.err != nil {
+			return false, s.err
+		}
+		if _, ok := s.data[string(key)]; ok && time.Now().Before(s.expire[string(key)]) {
+			return false, nil
+		}
+		s.data[string(key)] = string(val)
+		s.expire[string(key)] = time.Now().Add(ttl)
+		return true, nil
+	}
+	renewLease = func(key []byte, val []byte, ttl time.Duration) (bool, error) {
+		s.Lock()
+		defer s.Unlock()
+		if s.err != nil {
+			return false, s.err
+		}
+		if s.data[string(key)] != string(val) || time.Now().After(s.expire[string(key)]) {
+			return false, nil
+		}
+		s.expire[string(key)] = time.Now().Add(ttl)
+		return true, nil
+	}
+	releaseLease = func(key []byte, val []byte) error {
+		s.Lock()
+		defer s.Unlock()
+		if s.data[string(key)] == string(val) {
+			delete(s.data, string(key))
+		}
+		return nil
+	}
+	incr = func(key []byte) (int64, error) {
+		s.Lock()
+		defer s.Unlock()
+		n, _ := strconv.ParseInt(s.data[string(key)], 10, 64)
+		n++
+		s.data[string(key)] = strconv.FormatInt(n, 10)
+		return n, nil
+	}
+	getKeyVal = func(key []byte) ([]byte, error) {
+		s.Lock()
+		defer s.Unlock()
+		if time.Now().After(s.expire[string(key)]) && string(key) == LEASE_KEY {
+			return nil, nil
+		}
+		return []byte(s.data[string(key)]), nil
+	}
+	return s
+}
+
+func newTestElection(nodeID string, ttl time.Duration) (*election, *int, *int) {
+	var elected, revoked int
+	e := newElection(nodeID, nodeID+":21036", ttl)
+	e.handler = Handler{
+		OnElected: func() { elected++ },
+		OnRevoked: func() { revoked++ },
+	}
+	return e, &elected, &revoked
+}
+
+func TestElection(t *testing.T) {
+	Convey("only one leader", t, func() {
+		s := newMemLeaseStorage()
+		e1, _, revoked1 := newTestElection("node1", 100*time.Millisecond)
+		e2, _, _ := newTestElection("node2", 100*time.Millisecond)
+
+		e1.campaign()
+		e2.campaign()
+		So(e1.isLeader(), ShouldBeTrue)
+		So(e2.isLeader(), ShouldBeFalse)
+		So(e2.checkLeader(), ShouldNotBeNil)
+		So(e2.getStatus().Holder.NodeID, ShouldEqual, "node1")
+		So(e2.getStatus().Token, ShouldEqual, 1)
+
+		// leader 续期成功, standby 拿不到租约
+		time.Sleep(50 * time.Millisecond)
+		e1.campaign()
+		time.Sleep(60 * time.Millisecond)
+		e2.campaign()
+		So(e1.isLeader(), ShouldBeTrue)
+		So(e2.isLeader(), ShouldBeFalse)
+
+		// 存储不可用, 本地租约过期之后不再是 leader
+		s.err = errTest
+		time.Sleep(100 * time.Millisecond)
+		So(e1.isLeader(), ShouldBeFalse)
+		e1.campaign()
+		So(*revoked1, ShouldEqual, 1)
+		So(e1.getStatus().Role, ShouldEqual, ROLE_STANDBY)
+
+		// standby 接管, fencing token 递增
+		s.err = nil
+		e2.campaign()
+		So(e2.isLeader(), ShouldBeTrue)
+		So(e2.getStatus().Token, ShouldEqual, 2)
+	})
+
+	Convey("stale leader is fenced", t, func() {
+		newMemLeaseStorage()
+		e1, _, revoked1 := newTestElection("node1", 50*time.Millisecond)
+		e2, _, _ := newTestElection("node2", 50*time.Millisecond)
+		e1.campaign()
+		// node1 卡住没有续期, node2 拿到租约
+		time.Sleep(60 * time.Millisecond)
+		e2.campaign()
+		So(e2.isLeader(), ShouldBeTrue)
+		token, err := e2.fencingToken()
+		So(err, ShouldBeNil)
+		So(token, ShouldEqual, 2)
+		_, err = e1.fencingToken()
+		So(err, ShouldNotBeNil)
+		e1.campaign()
+		So(*revoked1, ShouldEqual, 1)
+		So(e1.isLeader(), ShouldBeFalse)
+	})
+
+	Convey("release lease", t, func() {
+		newMemLeaseStorage()
+		e1, _, _ := newTestElection("node1", time.Second)
+		e2, _, _ := newTestElection("node2", time.Second)
+		e1.campaign()
+		e1.release()
+		So(e1.isLeader(), ShouldBeFalse)
+		e2.campaign()
+		So(e2.isLeader(), ShouldBeTrue)
+	})
+}
+
+type testError string
+
+func (e testError) Error() string { return string(e) }
+
+const errTest = testError("storage unavailable")
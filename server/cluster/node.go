@@ -0,0 +1,46 @@
+package cluster
+
+import (
+	"net"
+	"os"
+	"strconv"
+
+	"github.com/brokercap/Bifrost/config"
+)
+
+// 节点ID, 同一个集群里不能重复, 默认为 主机名_listen
+func getNodeID() string {
+	nodeID := config.GetConfigVal("Bifrostd", "node_id")
+	if nodeID == "" {
+		nodeID = config.GetConfigVal("Bifrostd", "ha_node_id")
+	}
+	if nodeID == "" {
+		hostname, _ := os.Hostname()
+		nodeID = hostname + "_" + config.Listen
+	}
+	return nodeID
+}
+
+// 别的节点访问当前节点管理后台的地址, listen 是 0.0.0.0 的时候用主机名
+func getNodeAddr() string {
+	addr := config.GetConfigVal("Bifrostd", "node_addr")
+	if addr != "" {
+		return addr
+	}
+	host, port, err := net.SplitHostPort(config.Listen)
+	if err != nil {
+		return config.Listen
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host, _ = os.Hostname()
+	}
+	return net.JoinHostPort(host, port)
+}
+
+func getLeaseTTL(key string) int {
+	ttl, _ := strconv.Atoi(config.GetConfigVal("Bifrostd", key))
+	if ttl <= 0 {
+		ttl = DEFAULT_LEASE_TTL
+	}
+	return ttl
+}
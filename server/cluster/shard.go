@@ -0,0 +1,614 @@
+package cluster
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brokercap/Bifrost/config"
+	"github.com/brokercap/Bifrost/server/storage"
+)
+
+// 配置 shard=true 之后, 多个 Bifrost 节点把数据源分开同步
+// 每个节点定时写一个带过期时间的心跳 key, 所有节点按 rendezvous hash 算出每个数据源属于哪个节点
+// 节点加入或者退出之后, 只有受影响的数据源会迁移; 迁移之前要先拿到这个数据源的租约, 保证同一时间只有一个节点在同步
+// 每次拿到数据源的租约分配一个递增的 fencing token, 数据源的配置和位点带上 token 写入, 租约过期的旧节点写不进去
+// 加载和停止数据源比较慢, 在单独的协程里执行, 不影响心跳和别的数据源的租约续期
+// 目标库等全局配置只由 coordinator(节点列表里 NodeID 最小的节点) 保存, 别的节点定时加载
+
+const (
+	NODE_KEY_PREFIX     = "bifrost_cluster_node_"
+	DB_LEASE_KEY_PREFIX = "bifrost_cluster_db_"
+	DB_TOKEN_KEY_PREFIX = "bifrost_cluster_db_token_"
+
+	CLUSTER_SIGN_EXPIRE = 60 // 秒
+)
+
+type Member struct {
+	NodeID    string
+	Addr      string
+	StartTime int64
+}
+
+type ShardStatus struct {
+	Enable      bool
+	NodeID      string
+	Addr        string
+	LeaseTTL    int
+	Members     []Member
+	OwnedDbList []string
+}
+
+type ShardHandler struct {
+	GetDbList  func() []string           // 集群里所有的数据源
+	OnAssigned func(dbName string) error // 数据源分配到当前节点, 从存储里加载并启动
+	OnRevoked  func(dbName string)       // 数据源迁移到别的节点, 保存配置并停止
+	OnFollower func() error              // 不是 coordinator 的时候定时加载全局配置
+}
+
+var getListByPrefix = storage.GetListByPrefix
+
+type ownedDb struct {
+	leaseVal []byte
+	token    int64
+	deadline time.Time
+	loaded   bool // OnAssigned 执行完才算是 owner
+}
+
+type shard struct {
+	sync.RWMutex
+	member    Member
+	ttl       time.Duration
+	memberVal []byte
+	deadline  time.Time // 心跳的本地过期时间
+	members   []Member
+	owned     map[string]*ownedDb
+	handler   ShardHandler
+	secret    string
+	queue     []func()       // 加载和停止在一个协程里按顺序执行, 加载数据源的 recoveryData 等不能并发
+	working   bool           // 执行 queue 的协程在运行
+	pending   map[string]int // 还没执行完的加载和停止
+	running   sync.WaitGroup
+}
+
+var s *shard
+
+func InitShard() {
+	if config.GetConfigVal("Bifrostd", "shard") != "true" {
+		return
+	}
+	if storage.GetMetaStorageType() != "redis" {
+		log.Println("config shard=true need meta_storage_type=redis")
+		os.Exit(1)
+	}
+	secret := config.GetConfigVal("Bifrostd", "cluster_secret")
+	if secret == "" {
+		log.Println("config shard=true need cluster_secret")
+		os.Exit(1)
+	}
+	ttl := getLeaseTTL("shard_lease_ttl")
+	s = newShard(getNodeID(), getNodeAddr(), time.Duration(ttl)*time.Second)
+	s.secret = secret
+	log.Println("shard enable, node id:", s.member.NodeID, " addr:", s.member.Addr, " lease ttl:", ttl)
+}
+
+func newShard(nodeID, addr string, ttl time.Duration) *shard {
+	return &shard{
+		member:  Member{NodeID: nodeID, Addr: addr, StartTime: time.Now().Unix()},
+		ttl:     ttl,
+		owned:   make(map[string]*ownedDb, 0),
+		pending: make(map[string]int, 0),
+	}
+}
+
+func ShardEnable() bool {
+	return s != nil
+}
+
+func StartShard(handler ShardHandler) {
+	if s == nil {
+		return
+	}
+	s.handler = handler
+	go s.loop()
+}
+
+// 没有开启 shard 的时候, 所有数据源都属于当前节点
+func IsDbOwner(dbName string) bool {
+	if s == nil {
+		return true
+	}
+	return s.isDbOwner(dbName)
+}
+
+// shard 模式下写数据源的配置和位点带上的 fencing token, 租约已经不在当前节点则返回 error
+// 没有开启 shard 的时候 tokenKey 为 nil
+func DbFencingToken(dbName string) (tokenKey []byte, token int64, err error) {
+	if s == nil {
+		return nil, 0, nil
+	}
+	return s.dbFencingToken(dbName)
+}
+
+func dbTokenKey(dbName string) []byte {
+	return []byte(DB_TOKEN_KEY_PREFIX + dbName)
+}
+
+// 数据源按当前的节点列表应该分配到的节点, 自己是 owner 的时候返回 false
+func GetDbOwner(dbName string) (member Member, remote bool) {
+	if s == nil {
+		return Member{}, false
+	}
+	s.RLock()
+	defer s.RUnlock()
+	member = pickOwner(dbName, s.members)
+	if member.NodeID == "" || member.NodeID == s.member.NodeID {
+		return s.member, false
+	}
+	return member, true
+}
+
+// 没有开启 shard 的时候, 当前节点就是 coordinator
+func IsCoordinator() bool {
+	if s == nil {
+		return true
+	}
+	member, remote := GetCoordinator()
+	return !remote && member.NodeID != ""
+}
+
+// 存储里还看不到任何节点的时候返回空的 Member
+func GetCoordinator() (member Member, remote bool) {
+	if s == nil {
+		return Member{}, false
+	}
+	s.RLock()
+	defer s.RUnlock()
+	if len(s.members) == 0 {
+		return Member{}, false
+	}
+	return s.members[0], s.members[0].NodeID != s.member.NodeID
+}
+
+func GetClusterSecret() string {
+	if s == nil {
+		return ""
+	}
+	return s.secret
+}
+
+func GetShardStatus() ShardStatus {
+	if s == nil {
+		return ShardStatus{}
+	}
+	return s.getStatus()
+}
+
+// 正常退出的时候释放所有租约, 别的节点马上可以接管
+func ReleaseShard() {
+	if s == nil {
+		return
+	}
+	s.release()
+}
+
+// rendezvous hash, 每个数据源取分数最大的节点, 节点变化的时候只影响这个节点上的数据源
+func pickOwner(dbName string, members []Member) Member {
+	var owner Member
+	var maxScore uint64
+	for _, m := range members {
+		h := fnv.New64a()
+		h.Write([]byte(m.NodeID + "|" + dbName))
+		score := h.Sum64()
+		if owner.NodeID == "" || score > maxScore || (score == maxScore && m.NodeID < owner.NodeID) {
+			owner = m
+			maxScore = score
+		}
+	}
+	return owner
+}
+
+func (This *shard) loop() {
+	for {
+		This.tick()
+		time.Sleep(This.ttl / 3)
+	}
+}
+
+func (This *shard) tick() {
+	if !This.heartbeat() {
+		return
+	}
+	This.loadMembers()
+	This.RLock()
+	members := This.members
+	This.RUnlock()
+	// 存储里还看不到自己的心跳, 先不分配
+	if pickMember(This.member.NodeID, members) == nil {
+		return
+	}
+	if members[0].NodeID != This.member.NodeID && This.handler.OnFollower != nil {
+		if err := This.handler.OnFollower(); err != nil {
+			log.Println("shard load config err:", err)
+		}
+	}
+	dbMap := make(map[string]bool, 0)
+	for _, dbName := range This.handler.GetDbList() {
+		dbMap[dbName] = true
+		owner := pickOwner(dbName, members)
+		This.RLock()
+		_, owned := This.owned[dbName]
+		pending := This.pending[dbName] > 0
+		This.RUnlock()
+		// 加载和停止的过程中也要续期
+		if owned && !This.renewDb(dbName) {
+			continue
+		}
+		// 上一次的加载或者停止还没执行完, 等下一次
+		if pending {
+			continue
+		}
+		switch {
+		case owner.NodeID == This.member.NodeID && !owned:
+			This.acquireDb(dbName)
+		case owner.NodeID != This.member.NodeID && owned:
+			This.revokeDb(dbName, "move to "+owner.NodeID, false)
+		}
+	}
+	// 数据源已经删除
+	for _, dbName := range This.ownedDbList() {
+		if !dbMap[dbName] {
+			This.releaseDb(dbName, nil)
+		}
+	}
+}
+
+// 在单独的协程里执行数据源的加载和停止, 按提交的顺序执行
+func (This *shard) runDb(dbName string, f func()) {
+	This.running.Add(1)
+	This.Lock()
+	This.pending[dbName]++
+	This.queue = append(This.queue, func() {
+		defer This.running.Done()
+		f()
+		This.Lock()
+		This.pending[dbName]--
+		if This.pending[dbName] == 0 {
+			delete(This.pending, dbName)
+		}
+		This.Unlock()
+	})
+	working := This.working
+	This.working = true
+	This.Unlock()
+	if !working {
+		go This.work()
+	}
+}
+
+func (This *shard) work() {
+	for {
+		This.Lock()
+		if len(This.queue) == 0 {
+			This.working = false
+			This.Unlock()
+			return
+		}
+		f := This.queue[0]
+		This.queue = This.queue[1:]
+		This.Unlock()
+		f()
+	}
+}
+
+// 等所有的加载和停止执行完
+func (This *shard) wait() {
+	This.running.Wait()
+}
+
+func pickMember(nodeID string, members []Member) *Member {
+	for i := range members {
+		if members[i].NodeID == nodeID {
+			return &members[i]
+		}
+	}
+	return nil
+}
+
+func (This *shard) heartbeat() bool {
+	start := time.Now()
+	key := []byte(NODE_KEY_PREFIX + This.member.NodeID)
+	This.RLock()
+	val, deadline := This.memberVal, This.deadline
+	This.RUnlock()
+	var ok bool
+	var err error
+	if val != nil {
+		ok, err = renewLease(key, val, This.ttl)
+	}
+	if err == nil && !ok {
+		val, _ = json.Marshal(This.member)
+		ok, err = acquireLease(key, val, This.ttl)
+	}
+	if err == nil && ok {
+		This.Lock()
+		This.memberVal = val
+		This.deadline = start.Add(This.ttl - This.ttl/5)
+		This.Unlock()
+		return true
+	}
+	if err != nil {
+		log.Println("shard heartbeat err:", err)
+	}
+	// 心跳过期之后, 别的节点会接管当前节点的数据源, 这里要先停掉
+	if time.Now().After(deadline) {
+		for _, dbName := range This.ownedDbList() {
+			This.revokeDb(dbName, "heartbeat expired", true)
+		}
+	}
+	return false
+}
+
+func (This *shard) loadMembers() {
+	members := make([]Member, 0)
+	for _, v := range getListByPrefix([]byte(NODE_KEY_PREFIX)) {
+		var m Member
+		if err := json.Unmarshal([]byte(v.Value), &m); err != nil || m.NodeID == "" {
+			continue
+		}
+		members = append(members, m)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].NodeID < members[j].NodeID
+	})
+	This.Lock()
+	This.members = members
+	This.Unlock()
+}
+
+func (This *shard) acquireDb(dbName string) {
+	start := time.Now()
+	val, _ := json.Marshal(Member{NodeID: This.member.NodeID, Addr: This.member.Addr, StartTime: start.UnixNano()})
+	ok, err := acquireLease([]byte(DB_LEASE_KEY_PREFIX+dbName), val, This.ttl)
+	if err != nil {
+		log.Println("shard acquire db:", dbName, " err:", err)
+		return
+	}
+	// 原来的节点还没有释放, 等下一次
+	if !ok {
+		return
+	}
+	token, err := incr(dbTokenKey(dbName))
+	if err != nil {
+		log.Println("shard incr db:", dbName, " fencing token err:", err)
+		releaseLease([]byte(DB_LEASE_KEY_PREFIX+dbName), val)
+		return
+	}
+	log.Println("shard db:", dbName, " assigned to node:", This.member.NodeID, " fencing token:", token)
+	o := &ownedDb{leaseVal: val, token: token, deadline: start.Add(This.ttl - This.ttl/5)}
+	This.Lock()
+	This.owned[dbName] = o
+	This.Unlock()
+	// 加载完之后才算是 owner, 加载过程中不会保存这个数据源的配置
+	This.runDb(dbName, func() {
+		err := This.handler.OnAssigned(dbName)
+		This.Lock()
+		// 加载的过程中租约已经丢了, 后面排队的停止会处理
+		if This.owned[dbName] != o {
+			This.Unlock()
+			return
+		}
+		if err == nil {
+			o.loaded = true
+			This.Unlock()
+			return
+		}
+		This.Unlock()
+		log.Println("shard load db:", dbName, " err:", err)
+		This.releaseDb(dbName, o)
+	})
+}
+
+// 返回 false 说明租约已经不在当前节点
+func (This *shard) renewDb(dbName string) bool {
+	start := time.Now()
+	This.RLock()
+	o, ok := This.owned[dbName]
+	if !ok {
+		This.RUnlock()
+		return false
+	}
+	leaseVal, token, deadline := o.leaseVal, o.token, o.deadline
+	This.RUnlock()
+	ok, err := renewLease([]byte(DB_LEASE_KEY_PREFIX+dbName), leaseVal, This.ttl)
+	if err == nil && ok {
+		// 有更大的 fencing token, 说明租约已经被别的节点拿过了
+		var b []byte
+		if b, err = getKeyVal(dbTokenKey(dbName)); err == nil && string(b) != strconv.FormatInt(token, 10) {
+			This.revokeDb(dbName, fmt.Sprintf("fencing token %s != %d", string(b), token), true)
+			return false
+		}
+		This.Lock()
+		o.deadline = start.Add(This.ttl - This.ttl/5)
+		This.Unlock()
+		return true
+	}
+	if err == nil {
+		This.revokeDb(dbName, "lease lost", true)
+		return false
+	}
+	log.Println("shard renew db:", dbName, " err:", err)
+	if time.Now().After(deadline) {
+		This.revokeDb(dbName, "lease expired", true)
+		return false
+	}
+	return true
+}
+
+// lost 为 true 的时候租约已经失效, 先去掉 owner, 停止的时候不能再保存配置
+func (This *shard) revokeDb(dbName string, reason string, lost bool) {
+	log.Println("shard db:", dbName, " revoked from node:", This.member.NodeID, " ", reason)
+	This.Lock()
+	o := This.owned[dbName]
+	if lost {
+		delete(This.owned, dbName)
+	}
+	This.Unlock()
+	This.runDb(dbName, func() {
+		This.handler.OnRevoked(dbName)
+		if !lost {
+			This.releaseDb(dbName, o)
+		}
+	})
+}
+
+// o 不为 nil 的时候, 只释放这一次拿到的租约
+func (This *shard) releaseDb(dbName string, o *ownedDb) {
+	This.Lock()
+	current, ok := This.owned[dbName]
+	if !ok || (o != nil && current != o) {
+		This.Unlock()
+		return
+	}
+	delete(This.owned, dbName)
+	This.Unlock()
+	if err := releaseLease([]byte(DB_LEASE_KEY_PREFIX+dbName), current.leaseVal); err != nil {
+		log.Println("shard release db:", dbName, " err:", err)
+	}
+}
+
+func (This *shard) release() {
+	for _, dbName := range This.ownedDbList() {
+		This.releaseDb(dbName, nil)
+	}
+	This.Lock()
+	val := This.memberVal
+	This.memberVal = nil
+	This.Unlock()
+	if val != nil {
+		releaseLease([]byte(NODE_KEY_PREFIX+This.member.NodeID), val)
+	}
+}
+
+func (This *shard) isDbOwner(dbName string) bool {
+	This.RLock()
+	defer This.RUnlock()
+	o, ok := This.owned[dbName]
+	return ok && o.loaded && time.Now().Before(o.deadline)
+}
+
+// 加载的过程中也可以写位点, 只要租约还在
+func (This *shard) dbFencingToken(dbName string) ([]byte, int64, error) {
+	This.RLock()
+	defer This.RUnlock()
+	o, ok := This.owned[dbName]
+	if !ok || !time.Now().Before(o.deadline) {
+		return nil, 0, fmt.Errorf("db:%s lease not on node:%s", dbName, This.member.NodeID)
+	}
+	return dbTokenKey(dbName), o.token, nil
+}
+
+func (This *shard) ownedDbList() []string {
+	This.RLock()
+	defer This.RUnlock()
+	dbList := make([]string, 0, len(This.owned))
+	for dbName := range This.owned {
+		dbList = append(dbList, dbName)
+	}
+	sort.Strings(dbList)
+	return dbList
+}
+
+func (This *shard) getStatus() ShardStatus {
+	status := ShardStatus{
+		Enable:      true,
+		NodeID:      This.member.NodeID,
+		Addr:        This.member.Addr,
+		LeaseTTL:    int(This.ttl / time.Second),
+		OwnedDbList: This.ownedDbList(),
+	}
+	This.RLock()
+	status.Members = append(status.Members, This.members...)
+	This.RUnlock()
+	return status
+}
+
+// 集群内部转发的请求, 签名包含请求的方法, 路径, 参数, body 的 sha256 和一次性的 nonce
+type ClusterSignContent struct {
+	UserName  string
+	Method    string
+	Path      string
+	Query     string
+	BodyHash  string
+	Nonce     string
+	Timestamp string
+}
+
+// 集群内部转发请求的签名, 防止伪造用户和篡改请求
+func ClusterSign(content ClusterSignContent) string {
+	return sign(GetClusterSecret(), strings.Join([]string{
+		content.UserName, content.Method, content.Path, content.Query, content.BodyHash, content.Nonce, content.Timestamp,
+	}, "|"))
+}
+
+// 签名的时间和当前时间相差太多的, 或者 nonce 已经用过的认为是重放
+func CheckClusterSign(content ClusterSignContent, signature string) error {
+	if s == nil {
+		return fmt.Errorf("shard not enable")
+	}
+	t, err := strconv.ParseInt(content.Timestamp, 10, 64)
+	if err != nil {
+		return err
+	}
+	if d := time.Now().Unix() - t; d > CLUSTER_SIGN_EXPIRE || d < -CLUSTER_SIGN_EXPIRE {
+		return fmt.Errorf("cluster sign expired")
+	}
+	if !hmac.Equal([]byte(ClusterSign(content)), []byte(signature)) {
+		return fmt.Errorf("cluster sign error")
+	}
+	if content.Nonce == "" || !clusterNonces.add(content.Nonce, t+CLUSTER_SIGN_EXPIRE) {
+		return fmt.Errorf("cluster sign nonce reused")
+	}
+	return nil
+}
+
+// 签名有效期内用过的 nonce
+type nonceCache struct {
+	sync.Mutex
+	data map[string]int64 // nonce => 过期时间
+}
+
+var clusterNonces = &nonceCache{data: make(map[string]int64, 0)}
+
+// nonce 没有用过返回 true, 顺便清理过期的
+func (This *nonceCache) add(nonce string, expire int64) bool {
+	This.Lock()
+	defer This.Unlock()
+	now := time.Now().Unix()
+	for k, v := range This.data {
+		if v < now {
+			delete(This.data, k)
+		}
+	}
+	if _, ok := This.data[nonce]; ok {
+		return false
+	}
+	This.data[nonce] = expire
+	return true
+}
+
+func sign(secret string, content string) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(content))
+	return hex.EncodeToString(h.Sum(nil))
+}
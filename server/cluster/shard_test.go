@@ -0,0 +1,260 @@
+package cluster
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brokercap/Bifrost/server/storage"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func (s *memLeaseStorage) listByPrefix(key []byte) (data []storage.ListStruct) {
+	s.Lock()
+	defer s.Unlock()
+	for k, v := range s.data {
+		if !strings.HasPrefix(k, string(key)) || time.Now().After(s.expire[k]) {
+			continue
+		}
+		data = append(data, storage.ListStruct{Key: k, Value: v})
+	}
+	return
+}
+
+type testShardNode struct {
+	*shard
+	loadLock sync.Mutex
+	loaded   map[string]bool
+}
+
+func newTestShard(nodeID string, ttl time.Duration, dbList *[]string) *testShardNode {
+	n := &testShardNode{shard: newShard(nodeID, nodeID+":21036", ttl), loaded: make(map[string]bool)}
+	n.handler = ShardHandler{
+		GetDbList: func() []string { return *dbList },
+		OnAssigned: func(dbName string) error {
+			n.loadLock.Lock()
+			defer n.loadLock.Unlock()
+			n.loaded[dbName] = true
+			return nil
+		},
+		OnRevoked: func(dbName string) {
+			n.loadLock.Lock()
+			defer n.loadLock.Unlock()
+			delete(n.loaded, dbName)
+		},
+	}
+	return n
+}
+
+// 加载和停止是异步的, 测试里等执行完
+func (n *testShardNode) tick() {
+	n.shard.tick()
+	n.shard.wait()
+}
+
+func TestPickOwner(t *testing.T) {
+	Convey("pick owner", t, func() {
+		members := []Member{{NodeID: "node1"}, {NodeID: "node2"}, {NodeID: "node3"}}
+		owners := make(map[string]string)
+		for i := 0; i < 300; i++ {
+			dbName := fmt.Sprintf("db%d", i)
+			owners[dbName] = pickOwner(dbName, members).NodeID
+			// 和节点顺序无关
+			So(pickOwner(dbName, []Member{members[2], members[0], members[1]}).NodeID, ShouldEqual, owners[dbName])
+		}
+		So(pickOwner("db0", nil).NodeID, ShouldEqual, "")
+
+		// node3 退出, 只有 node3 上的数据源迁移
+		for dbName, owner := range owners {
+			newOwner := pickOwner(dbName, members[:2]).NodeID
+			if owner != "node3" {
+				So(newOwner, ShouldEqual, owner)
+			} else {
+				So(newOwner, ShouldNotEqual, "node3")
+			}
+		}
+	})
+}
+
+func TestShard(t *testing.T) {
+	Convey("db assign and rebalance", t, func() {
+		s := newMemLeaseStorage()
+		getListByPrefix = s.listByPrefix
+		dbList := make([]string, 0)
+		for i := 0; i < 20; i++ {
+			dbList = append(dbList, fmt.Sprintf("db%d", i))
+		}
+		n1 := newTestShard("node1", 200*time.Millisecond, &dbList)
+		n2 := newTestShard("node2", 200*time.Millisecond, &dbList)
+
+		// 只有一个节点的时候, 所有数据源都在这个节点上
+		n1.tick()
+		So(len(n1.loaded), ShouldEqual, 20)
+		So(n1.isDbOwner("db0"), ShouldBeTrue)
+
+		// node2 加入, 先从 node1 迁出, 下一次 node2 拿到租约
+		n2.tick()
+		So(len(n2.loaded), ShouldEqual, 0)
+		n1.tick()
+		n2.tick()
+		So(len(n1.loaded)+len(n2.loaded), ShouldEqual, 20)
+		So(len(n2.loaded), ShouldBeGreaterThan, 0)
+		for _, dbName := range dbList {
+			So(n1.loaded[dbName] != n2.loaded[dbName], ShouldBeTrue)
+			So(n1.isDbOwner(dbName) != n2.isDbOwner(dbName), ShouldBeTrue)
+		}
+
+		// 删除的数据源释放租约
+		dbList = dbList[1:]
+		n1.tick()
+		n2.tick()
+		owned := append(n1.ownedDbList(), n2.ownedDbList()...)
+		sort.Strings(owned)
+		So(len(owned), ShouldEqual, 19)
+
+		// node2 正常退出, node1 接管
+		n2.release()
+		n1.tick()
+		So(len(n1.loaded), ShouldEqual, 19)
+		So(len(n1.ownedDbList()), ShouldEqual, 19)
+	})
+
+	Convey("slow load does not block lease renew", t, func() {
+		s := newMemLeaseStorage()
+		getListByPrefix = s.listByPrefix
+		dbList := []string{"db1", "db2"}
+		n1 := newTestShard("node1", 200*time.Millisecond, &dbList)
+		loading := make(chan bool)
+		n1.handler.OnAssigned = func(dbName string) error {
+			if dbName == "db1" {
+				<-loading
+			}
+			return nil
+		}
+		n1.shard.tick()
+		// db1 还在加载, 租约还在但不算 owner, 位点可以带上 token 写入
+		So(n1.isDbOwner("db1"), ShouldBeFalse)
+		_, token, err := n1.dbFencingToken("db1")
+		So(err, ShouldBeNil)
+		So(token, ShouldEqual, 1)
+		time.Sleep(100 * time.Millisecond)
+		n1.shard.tick()
+		time.Sleep(100 * time.Millisecond)
+		// 第二次 tick 续期了, 第一次拿到的租约已经过了, 数据源还在当前节点
+		_, _, err = n1.dbFencingToken("db1")
+		So(err, ShouldBeNil)
+		close(loading)
+		n1.wait()
+		So(n1.isDbOwner("db1"), ShouldBeTrue)
+		So(n1.isDbOwner("db2"), ShouldBeTrue)
+	})
+
+	Convey("fencing token changed", t, func() {
+		s := newMemLeaseStorage()
+		getListByPrefix = s.listByPrefix
+		dbList := []string{"db1"}
+		n1 := newTestShard("node1", time.Second, &dbList)
+		n1.tick()
+		So(n1.isDbOwner("db1"), ShouldBeTrue)
+		tokenKey, token, err := n1.dbFencingToken("db1")
+		So(err, ShouldBeNil)
+		So(string(tokenKey), ShouldEqual, DB_TOKEN_KEY_PREFIX+"db1")
+
+		// 别的节点拿过这个数据源的租约, 当前节点停掉
+		incr(tokenKey)
+		n1.tick()
+		So(len(n1.loaded), ShouldEqual, 0)
+		_, _, err = n1.dbFencingToken("db1")
+		So(err, ShouldNotBeNil)
+		So(token, ShouldEqual, 1)
+	})
+
+	Convey("heartbeat expired", t, func() {
+		s := newMemLeaseStorage()
+		getListByPrefix = s.listByPrefix
+		dbList := []string{"db1", "db2"}
+		n1 := newTestShard("node1", 50*time.Millisecond, &dbList)
+		n1.tick()
+		So(len(n1.loaded), ShouldEqual, 2)
+
+		// 存储不可用, 本地心跳过期之后停掉所有数据源
+		s.err = errTest
+		time.Sleep(60 * time.Millisecond)
+		n1.tick()
+		So(len(n1.loaded), ShouldEqual, 0)
+		So(len(n1.ownedDbList()), ShouldEqual, 0)
+	})
+
+	Convey("coordinator", t, func() {
+		s := newMemLeaseStorage()
+		getListByPrefix = s.listByPrefix
+		dbList := []string{}
+		n2 := newTestShard("node2", time.Second, &dbList)
+		var loadCount int
+		n2.handler.OnFollower = func() error {
+			loadCount++
+			return nil
+		}
+		n2.tick()
+		So(loadCount, ShouldEqual, 0)
+		n1 := newTestShard("node1", time.Second, &dbList)
+		n1.tick()
+		n2.tick()
+		So(loadCount, ShouldEqual, 1)
+	})
+}
+
+func TestCheckClusterSign(t *testing.T) {
+	s = newShard("node1", "node1:21036", time.Second)
+	s.secret = "secret"
+	defer func() { s = nil }()
+
+	newContent := func() ClusterSignContent {
+		return ClusterSignContent{
+			UserName:  "Bifrost",
+			Method:    "POST",
+			Path:      "/db/add",
+			Query:     "format=json",
+			BodyHash:  "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			Nonce:     fmt.Sprint(time.Now().UnixNano()),
+			Timestamp: fmt.Sprint(time.Now().Unix()),
+		}
+	}
+
+	Convey("sign cover request and nonce only use once", t, func() {
+		content := newContent()
+		signature := ClusterSign(content)
+		So(CheckClusterSign(content, signature), ShouldBeNil)
+		// 重放
+		So(CheckClusterSign(content, signature), ShouldNotBeNil)
+
+		content = newContent()
+		signature = ClusterSign(content)
+		for _, f := range []func(c *ClusterSignContent){
+			func(c *ClusterSignContent) { c.UserName = "admin" },
+			func(c *ClusterSignContent) { c.Method = "GET" },
+			func(c *ClusterSignContent) { c.Path = "/db/del" },
+			func(c *ClusterSignContent) { c.Query = "format=html" },
+			func(c *ClusterSignContent) { c.BodyHash = "" },
+			func(c *ClusterSignContent) { c.Nonce = "other" },
+		} {
+			c := content
+			f(&c)
+			So(CheckClusterSign(c, signature), ShouldNotBeNil)
+		}
+		So(CheckClusterSign(content, signature), ShouldBeNil)
+	})
+
+	Convey("expired sign", t, func() {
+		content := newContent()
+		content.Timestamp = fmt.Sprint(time.Now().Unix() - CLUSTER_SIGN_EXPIRE - 1)
+		So(CheckClusterSign(content, ClusterSign(content)), ShouldNotBeNil)
+
+		content = newContent()
+		content.Nonce = ""
+		So(CheckClusterSign(content, ClusterSign(content)), ShouldNotBeNil)
+	})
+}
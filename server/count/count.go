@@ -289,6 +289,19 @@ func GetFlowByDb(db string, flowType string) []CountContent {
 	return nil
 }
 
+// 获取 db 启动以来累计的 数据条数 和 字节数
+func GetDbContent(db string) (CountContent, bool) {
+	l.RLock()
+	dbCountInfo, ok := dbCountChanMap[db]
+	l.RUnlock()
+	if !ok {
+		return CountContent{}, false
+	}
+	dbCountInfo.RLock()
+	defer dbCountInfo.RUnlock()
+	return *dbCountInfo.Content, true
+}
+
 func GetFlowAll(flowType string) []CountContent {
 
 	var tmp []CountContent
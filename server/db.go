@@ -30,6 +30,7 @@ import (
 
 	"github.com/brokercap/Bifrost/Bristol/mysql"
 	inputDriver "github.com/brokercap/Bifrost/input/driver"
+	"github.com/brokercap/Bifrost/server/cluster"
 	"github.com/brokercap/Bifrost/server/count"
 	"github.com/brokercap/Bifrost/server/warning"
 )
@@ -166,7 +167,7 @@ func DelDB(Name string) bool {
 		}
 	}
 	// 删除binlog 信息
-	delBinlogPosition(DBPositionBinlogKey)
+	delBinlogPosition(Name, DBPositionBinlogKey)
 	return true
 }
 
@@ -223,13 +224,14 @@ type DbListStruct struct {
 	ReplicateDoDb         map[string]uint8
 	ServerId              uint32
 	AddTime               int64
+	NodeID                string // shard 模式下数据源所在的节点
 }
 
 func GetListDb() map[string]DbListStruct {
 	var dbListMap map[string]DbListStruct
 	dbListMap = make(map[string]DbListStruct, 0)
+	nodeID := cluster.GetShardStatus().NodeID
 	DbLock.Lock()
-	defer DbLock.Unlock()
 	for k, v := range DbList {
 		dbListMap[k] = DbListStruct{
 			Name:                  v.Name,
@@ -251,8 +253,13 @@ func GetListDb() map[string]DbListStruct {
 			ReplicateDoDb:         v.replicateDoDb,
 			ServerId:              v.serverId,
 			AddTime:               v.AddTime,
+			NodeID:                nodeID,
 		}
 	}
+	DbLock.Unlock()
+	if cluster.ShardEnable() {
+		getRemoteDbList(dbListMap)
+	}
 	return dbListMap
 }
 
@@ -619,7 +626,7 @@ func (db *db) saveBinlog() {
 		Timestamp:      p.Timestamp,
 		EventID:        p.EventID,
 	}
-	saveBinlogPosition(db.DBBinlogKey, lastParseBinlog)
+	saveBinlogPosition(db.Name, db.DBBinlogKey, lastParseBinlog)
 }
 
 func (db *db) IgnoreTableToMap(IgnoreTable string) map[string]bool {
@@ -0,0 +1,183 @@
+package deadletter
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	"github.com/brokercap/Bifrost/server/storage"
+)
+
+// 死信队列
+// 同步配置开启了死信之后, 一条数据重试 N 次还是失败, 会连同错误信息一起保存到这里, 同步继续往下走
+// 数据保存在元数据存储(leveldb 或者 redis)里, 由管理界面 查看,修改后重放 或者 删除
+
+const DEAD_LETTER_KEY_PREFIX = "bifrost_deadletter_"
+
+// 两次重试之间最长等待时间
+var MaxBackoff = 60 * time.Second
+
+// 第 retries 次失败之后的等待时间, 1s,2s,4s... 最长 MaxBackoff
+func Backoff(retries int) time.Duration {
+	if retries <= 0 {
+		return 0
+	}
+	d := time.Second
+	for i := 1; i < retries; i++ {
+		d *= 2
+		if d >= MaxBackoff {
+			return MaxBackoff
+		}
+	}
+	if d > MaxBackoff {
+		return MaxBackoff
+	}
+	return d
+}
+
+// 一个同步配置
+type ToServerKey struct {
+	DbName     string
+	SchemaName string
+	TableName  string
+	ToServerID int
+}
+
+func (This ToServerKey) prefix() string {
+	// 用 | 分隔, 防止 db 名字是另外一个 db 名字前缀的时候, 按前缀查询查到别的同步配置的数据
+	return DEAD_LETTER_KEY_PREFIX + This.DbName + "|" + This.SchemaName + "|" + This.TableName + "|" + strconv.Itoa(This.ToServerID) + "|"
+}
+
+func (This ToServerKey) key(id int64) string {
+	// id 补齐 20 位, 按 key 排序就是按 id 排序
+	return This.prefix() + fmt.Sprintf("%020d", id)
+}
+
+type Entry struct {
+	Id          int64
+	DbName      string
+	SchemaName  string
+	TableName   string
+	ToServerID  int
+	ToServerKey string
+	PluginName  string
+	Time        int64 // 进入死信的时间
+	Retries     int   // 进入死信之前失败的次数
+	Error       string
+	ReplayTime  int64  // 最后一次重放的时间
+	ReplayError string // 最后一次重放的错误
+	Data        *pluginDriver.PluginDataType
+	// Data 是否是过滤字段和 Transforms 转换之后提交给插件的数据, 脱敏之前的明文数据不保存
+	// 旧版本写入的死信为 false, 重放的时候还需要转换
+	Transformed bool
+}
+
+func (This *Entry) ToServer() ToServerKey {
+	return ToServerKey{DbName: This.DbName, SchemaName: This.SchemaName, TableName: This.TableName, ToServerID: This.ToServerID}
+}
+
+// 方便单元测试替换存储
+var putKeyVal = storage.PutKeyVal
+var getKeyVal = storage.GetKeyVal
+var delKeyVal = storage.DelKeyVal
+var getListByPrefix = storage.GetListByPrefix
+
+var idLock sync.Mutex
+var lastId int64
+
+// 微秒时间戳作为 id, 同一微秒内的往后加 1, 保证进程内递增
+// 不用纳秒是因为 js 的 Number 只能精确表示 2^53 以内的整数
+func newId() int64 {
+	idLock.Lock()
+	defer idLock.Unlock()
+	id := time.Now().UnixNano() / 1000
+	if id <= lastId {
+		id = lastId + 1
+	}
+	lastId = id
+	return id
+}
+
+func put(entry *Entry) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return putKeyVal([]byte(entry.ToServer().key(entry.Id)), b)
+}
+
+// 写入一条死信, 返回 id
+func Add(entry *Entry) (int64, error) {
+	entry.Id = newId()
+	if entry.Time == 0 {
+		entry.Time = time.Now().Unix()
+	}
+	return entry.Id, put(entry)
+}
+
+// 更新一条死信, 修改数据 或者 记录重放结果
+func Update(entry *Entry) error {
+	if _, err := Get(entry.ToServer(), entry.Id); err != nil {
+		return err
+	}
+	return put(entry)
+}
+
+func Get(key ToServerKey, id int64) (*Entry, error) {
+	b, err := getKeyVal([]byte(key.key(id)))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, fmt.Errorf("dead letter id:%d not exist", id)
+	}
+	var entry Entry
+	if err = json.Unmarshal(b, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// 按 id 排序的死信列表
+func List(key ToServerKey) []*Entry {
+	data := getListByPrefix([]byte(key.prefix()))
+	list := make([]*Entry, 0, len(data))
+	for _, v := range data {
+		if !strings.HasPrefix(v.Key, key.prefix()) {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal([]byte(v.Value), &entry); err != nil {
+			continue
+		}
+		list = append(list, &entry)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Id < list[j].Id
+	})
+	return list
+}
+
+func Count(key ToServerKey) int {
+	return len(getListByPrefix([]byte(key.prefix())))
+}
+
+func Del(key ToServerKey, id int64) error {
+	return delKeyVal([]byte(key.key(id)))
+}
+
+// 删除一个同步配置的所有死信, 返回删除的数量
+func Purge(key ToServerKey) (n int, err error) {
+	for _, v := range getListByPrefix([]byte(key.prefix())) {
+		if err = delKeyVal([]byte(v.Key)); err != nil {
+			return
+		}
+		n++
+	}
+	return
+}
@@ -0,0 +1,124 @@
+package deadletter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	"github.com/brokercap/Bifrost/server/storage"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// 用 map 代替元数据存储
+func mockStorage() {
+	m := make(map[string][]byte, 0)
+	putKeyVal = func(key []byte, val []byte) error {
+		m[string(key)] = val
+		return nil
+	}
+	getKeyVal = func(key []byte) ([]byte, error) {
+		if v, ok := m[string(key)]; ok {
+			return v, nil
+		}
+		return nil, fmt.Errorf("not found")
+	}
+	delKeyVal = func(key []byte) error {
+		delete(m, string(key))
+		return nil
+	}
+	getListByPrefix = func(key []byte) (data []storage.ListStruct) {
+		keys := make([]string, 0)
+		for k := range m {
+			if strings.HasPrefix(k, string(key)) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			data = append(data, storage.ListStruct{Key: k, Value: string(m[k])})
+		}
+		return
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	Convey("backoff", t, func() {
+		So(Backoff(0), ShouldEqual, 0)
+		So(Backoff(1), ShouldEqual, time.Second)
+		So(Backoff(2), ShouldEqual, 2*time.Second)
+		So(Backoff(3), ShouldEqual, 4*time.Second)
+		So(Backoff(6), ShouldEqual, 32*time.Second)
+		So(Backoff(7), ShouldEqual, MaxBackoff)
+		So(Backoff(100), ShouldEqual, MaxBackoff)
+	})
+}
+
+func TestDeadLetter(t *testing.T) {
+	key := ToServerKey{DbName: "mysqlTest", SchemaName: "bifrost_test", TableName: "binlog_field_test", ToServerID: 1}
+	// db 名字是 key.DbName 的前缀, 不能查到 key 的死信
+	otherKey := ToServerKey{DbName: "mysql", SchemaName: "bifrost_test", TableName: "binlog_field_test", ToServerID: 1}
+	newEntry := func(k ToServerKey, id int) *Entry {
+		return &Entry{
+			DbName:     k.DbName,
+			SchemaName: k.SchemaName,
+			TableName:  k.TableName,
+			ToServerID: k.ToServerID,
+			Error:      "plugin err",
+			Data: &pluginDriver.PluginDataType{
+				EventType: "insert",
+				Rows:      []map[string]interface{}{{"id": id}},
+			},
+		}
+	}
+
+	Convey("add and list", t, func() {
+		// goconvey 每个子 Convey 都会重新执行一遍外层, 每次用新的存储
+		mockStorage()
+		id1, err := Add(newEntry(key, 1))
+		So(err, ShouldBeNil)
+		id2, err := Add(newEntry(key, 2))
+		So(err, ShouldBeNil)
+		So(id2, ShouldBeGreaterThan, id1)
+		_, err = Add(newEntry(otherKey, 3))
+		So(err, ShouldBeNil)
+
+		list := List(key)
+		So(len(list), ShouldEqual, 2)
+		So(list[0].Id, ShouldEqual, id1)
+		So(list[1].Id, ShouldEqual, id2)
+		So(list[0].Time, ShouldBeGreaterThan, 0)
+		So(Count(otherKey), ShouldEqual, 1)
+
+		Convey("get and update", func() {
+			entry, err := Get(key, id2)
+			So(err, ShouldBeNil)
+			So(entry.Error, ShouldEqual, "plugin err")
+			So(entry.Data.Rows[0]["id"], ShouldEqual, 2)
+
+			entry.Data.Rows[0]["id"] = 20
+			entry.ReplayError = "replay err"
+			So(Update(entry), ShouldBeNil)
+			entry, _ = Get(key, id2)
+			So(entry.Data.Rows[0]["id"], ShouldEqual, 20)
+			So(entry.ReplayError, ShouldEqual, "replay err")
+
+			_, err = Get(key, id2+1000)
+			So(err, ShouldNotBeNil)
+			So(Update(&Entry{DbName: key.DbName, Id: id2 + 1000}), ShouldNotBeNil)
+		})
+
+		Convey("del and purge", func() {
+			So(Del(key, id1), ShouldBeNil)
+			So(Count(key), ShouldEqual, 1)
+			n, err := Purge(key)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+			So(Count(key), ShouldEqual, 0)
+			So(Count(otherKey), ShouldEqual, 1)
+		})
+	})
+}
@@ -151,6 +151,23 @@ func (This *Queue) GetInfo() QueueInfo {
 	}
 }
 
+// 队列文件占用的磁盘大小
+func (This *Queue) GetDiskSize() (size int64) {
+	This.RLock()
+	path := This.path
+	This.RUnlock()
+	rd, err := ioutil.ReadDir(path)
+	if err != nil {
+		return 0
+	}
+	for _, fi := range rd {
+		if !fi.IsDir() && strings.HasSuffix(fi.Name(), ".list") {
+			size += fi.Size()
+		}
+	}
+	return
+}
+
 func (This *Queue) readInfoInit() {
 	fileName := This.path + "/" + fmt.Sprint(This.minId) + ".list"
 	fd0, err := os.OpenFile(fileName, os.O_RDONLY, 0700)
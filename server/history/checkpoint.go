@@ -0,0 +1,526 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	"github.com/brokercap/Bifrost/server"
+)
+
+// 全量任务持久化, 重启之后任务恢复成 halfway 状态, 可以从断点继续拉取
+// 每个区间拉取完, 并且区间里的数据都被插件提交成功之后, 才记录为完成
+
+const HISTORY_KEY_PREFIX = "bifrost_history_"
+
+type HistoryRange struct {
+	From uint64
+	To   uint64
+}
+
+// keyset 分页区间的进度, 键值用 encodeKeysetKey 编码
+type KeysetRangeCheckpoint struct {
+	Lower string // 已经同步完成的最后一条数据的键值, 空为从头开始
+	Upper string // 区间结束的键值, 空为一直到最后
+	Done  bool
+}
+
+// 持久化的每个表的进度
+type TableCheckpoint struct {
+	TableName       string
+	RowsCount       uint64
+	SelectCount     uint64
+	Done            bool
+	Cursor          uint64
+	CompletedRanges []HistoryRange
+	LimitOptimize   int8
+	KeysetKeyArr    []string
+	KeysetRanges    []KeysetRangeCheckpoint
+}
+
+// 持久化到 storage 的全量任务
+type historyStorage struct {
+	ID              int
+	DbName          string
+	SchemaName      string
+	TableName       string
+	TableNames      string
+	Property        HistoryProperty
+	Status          HisotryStatus
+	ToServerIDList  []int
+	StartTime       string
+	OverTime        string
+	SelectRowsCount uint64
+	Tables          []TableCheckpoint
+}
+
+// 拉取中的区间, 或者拉取完等待同步的区间
+type historyChunk struct {
+	table     *TableStatus
+	from      uint64 // 拉取之前的 NowStartI
+	to        uint64 // 拉取之后的 NowStartI
+	tableDone bool   // 整个表拉取完成
+	waits     []historyChunkWait
+
+	keyset      bool   // keyset 分页拉取完的一页
+	keysetIndex int    // keyset 分页区间的下标
+	keysetLower string // 这一页最后一条数据的键值
+	keysetDone  bool   // 区间拉取完成
+}
+
+// 区间拉取完的时候, 写入每个同步配置队列的 commit 标记
+type historyChunkWait struct {
+	toServer *toServer
+	eventID  uint64
+}
+
+func historyKey(dbName string, ID int) string {
+	return HISTORY_KEY_PREFIX + dbName + "|" + strconv.Itoa(ID)
+}
+
+// 区间同步完成, 和 Cursor 连续的区间合并到 Cursor
+func (This *TableStatus) completeRange(from, to uint64) {
+	This.Lock()
+	defer This.Unlock()
+	if from != This.Cursor {
+		This.CompletedRanges = append(This.CompletedRanges, HistoryRange{From: from, To: to})
+		return
+	}
+	This.Cursor = to
+	for {
+		var merged bool
+		for i, r := range This.CompletedRanges {
+			if r.From == This.Cursor {
+				This.Cursor = r.To
+				This.CompletedRanges = append(This.CompletedRanges[:i], This.CompletedRanges[i+1:]...)
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			break
+		}
+	}
+}
+
+// 跳过已经同步完成的区间, 返回下一次拉取的开始位置
+func (This *TableStatus) skipCompleted(start uint64) uint64 {
+	This.RLock()
+	defer This.RUnlock()
+	for {
+		var skip bool
+		for _, r := range This.CompletedRanges {
+			if r.From == start {
+				start = r.To
+				skip = true
+				break
+			}
+		}
+		if !skip {
+			return start
+		}
+	}
+}
+
+func (This *TableStatus) resetCheckpoint(LimitOptimize int8) {
+	This.Lock()
+	defer This.Unlock()
+	This.Done = false
+	This.Cursor = 0
+	This.CompletedRanges = nil
+	This.LimitOptimize = LimitOptimize
+	This.KeysetKeyArr = nil
+	This.KeysetRanges = nil
+}
+
+// keyset 分页开始拉取的时候, 记录每个区间的范围
+func (This *TableStatus) initKeysetCheckpoint(keyArr []string, ranges []*keysetRange) error {
+	keysetRanges := make([]KeysetRangeCheckpoint, 0, len(ranges))
+	for i, r := range ranges {
+		lower, err := encodeKeysetKey(r.lower)
+		if err != nil {
+			return err
+		}
+		upper, err := encodeKeysetKey(r.upper)
+		if err != nil {
+			return err
+		}
+		r.index = i
+		keysetRanges = append(keysetRanges, KeysetRangeCheckpoint{Lower: lower, Upper: upper, Done: r.done})
+	}
+	This.Lock()
+	defer This.Unlock()
+	This.KeysetKeyArr = keyArr
+	This.KeysetRanges = keysetRanges
+	return nil
+}
+
+// 按保存的进度恢复 keyset 分页的区间, 字段变了或者进度解析失败返回 nil
+func (This *TableStatus) keysetRangesFromCheckpoint(keyArr []string) []*keysetRange {
+	This.RLock()
+	defer This.RUnlock()
+	if len(This.KeysetRanges) == 0 || strings.Join(This.KeysetKeyArr, ",") != strings.Join(keyArr, ",") {
+		return nil
+	}
+	ranges := make([]*keysetRange, 0, len(This.KeysetRanges))
+	for i, v := range This.KeysetRanges {
+		lower, err := decodeKeysetKey(v.Lower)
+		if err != nil {
+			return nil
+		}
+		upper, err := decodeKeysetKey(v.Upper)
+		if err != nil {
+			return nil
+		}
+		ranges = append(ranges, &keysetRange{lower: lower, upper: upper, done: v.Done, index: i})
+	}
+	return ranges
+}
+
+// keyset 分页的一页同步完成
+func (This *TableStatus) completeKeyset(index int, lower string, done bool) {
+	This.Lock()
+	defer This.Unlock()
+	if index >= len(This.KeysetRanges) {
+		return
+	}
+	if done {
+		This.KeysetRanges[index].Done = true
+	} else {
+		This.KeysetRanges[index].Lower = lower
+	}
+}
+
+func (This *TableStatus) checkpoint() TableCheckpoint {
+	This.RLock()
+	defer This.RUnlock()
+	return TableCheckpoint{
+		TableName:       This.TableName,
+		RowsCount:       This.RowsCount,
+		SelectCount:     This.SelectCount,
+		Done:            This.Done,
+		Cursor:          This.Cursor,
+		CompletedRanges: append([]HistoryRange{}, This.CompletedRanges...),
+		LimitOptimize:   This.LimitOptimize,
+		KeysetKeyArr:    This.KeysetKeyArr,
+		KeysetRanges:    append([]KeysetRangeCheckpoint{}, This.KeysetRanges...),
+	}
+}
+
+// 当前表开始拉取数据, 断点续传的时候从 Cursor 开始, 否则清空进度
+// 在 initMetaInfo 里调用, 外面已经加锁
+func (This *History) initCheckpoint() {
+	This.runningChunks = make(map[uint64]*historyChunk, 0)
+	table := This.TableNameArr[This.TableCountSuccess]
+	resume := This.resume
+	This.resume = false
+	if resume && table.LimitOptimize == This.Property.LimitOptimize {
+		if len(This.keysetRanges) == 0 && len(table.KeysetRanges) == 0 {
+			This.NowStartI = table.Cursor
+			This.LogInfo(fmt.Sprintf("CurrentTableName:%s resume from:%d", This.CurrentTableName, This.NowStartI))
+			return
+		}
+		if len(This.keysetRanges) > 0 {
+			if ranges := table.keysetRangesFromCheckpoint(This.TableKeyArr); ranges != nil {
+				This.keysetRanges = ranges
+				This.LogInfo(fmt.Sprintf("CurrentTableName:%s resume keyset ranges:%d", This.CurrentTableName, len(ranges)))
+				return
+			}
+		}
+	}
+	table.resetCheckpoint(This.Property.LimitOptimize)
+	if len(This.keysetRanges) > 0 {
+		if err := table.initKeysetCheckpoint(This.TableKeyArr, This.keysetRanges); err != nil {
+			This.LogError(fmt.Sprintf("CurrentTableName:%s keyset checkpoint err:%+v", This.CurrentTableName, err))
+		}
+	}
+}
+
+// 正在拉取的表, 外面已经加锁
+func (This *History) currentTableStatus() *TableStatus {
+	if This.TableCountSuccess >= len(This.TableNameArr) {
+		return nil
+	}
+	return This.TableNameArr[This.TableCountSuccess]
+}
+
+// 跳过已经同步完成的区间, 在 GetNextSql 里调用, 外面已经加锁
+func (This *History) skipCompletedChunk() {
+	if table := This.currentTableStatus(); table != nil {
+		This.NowStartI = table.skipCompleted(This.NowStartI)
+	}
+}
+
+// 在 GetNextSql 里调用, 外面已经加锁
+func (This *History) addRunningChunk(start, from, to uint64) {
+	table := This.currentTableStatus()
+	if table == nil {
+		return
+	}
+	if This.runningChunks == nil {
+		This.runningChunks = make(map[uint64]*historyChunk, 0)
+	}
+	This.runningChunks[start] = &historyChunk{table: table, from: from, to: to}
+}
+
+// 往所有同步配置的队列里写一个 commit 标记, 插件返回这个标记为成功的时候, 标记之前的数据都已经同步完成
+// 批量提交的插件也要等真正提交之后才会返回, 所以不能只看数据有没有被同步协程取走
+// sendToServerResult 里是先锁 ToServerInfo 再锁 History, 所以这里不能在 History 锁里调用
+func (This *History) sendChunkMarker() []historyChunkWait {
+	// 标记按 eventID 从小到大写入队列
+	This.markerLock.Lock()
+	defer This.markerLock.Unlock()
+	This.Lock()
+	This.markerEventID++
+	eventID := This.markerEventID
+	toServerList := This.ToServerList
+	tableName := This.CurrentTableName
+	This.Unlock()
+	This.sendToServerResult(&pluginDriver.PluginDataType{
+		Timestamp:  uint32(time.Now().Unix()),
+		EventType:  "commit",
+		Query:      "COMMIT",
+		SchemaName: This.SchemaName,
+		TableName:  tableName,
+		EventID:    eventID,
+	})
+	waits := make([]historyChunkWait, 0, len(toServerList))
+	for _, toServer := range toServerList {
+		waits = append(waits, historyChunkWait{toServer: toServer, eventID: eventID})
+	}
+	return waits
+}
+
+// 区间拉取完成
+func (This *History) chunkSelected(start uint64) {
+	waits := This.sendChunkMarker()
+	This.Lock()
+	defer This.Unlock()
+	chunk, ok := This.runningChunks[start]
+	if !ok {
+		return
+	}
+	delete(This.runningChunks, start)
+	chunk.waits = waits
+	This.pendingChunks = append(This.pendingChunks, chunk)
+}
+
+// 表拉取完成
+func (This *History) tableSelected(table *TableStatus) {
+	waits := This.sendChunkMarker()
+	This.Lock()
+	defer This.Unlock()
+	This.pendingChunks = append(This.pendingChunks, &historyChunk{table: table, tableDone: true, waits: waits})
+}
+
+// 插件已经成功提交到 commit 标记
+func (This historyChunkWait) drained() bool {
+	ToServerInfo := This.toServer.ToServerInfo
+	ToServerInfo.Lock()
+	defer ToServerInfo.Unlock()
+	if ToServerInfo.Status == "deling" || ToServerInfo.Status == "deled" {
+		return false
+	}
+	return ToServerInfo.LastSuccessBinlog != nil && ToServerInfo.LastSuccessBinlog.EventID >= This.eventID
+}
+
+// 把已经同步完成的区间记录到表的进度里, 返回进度是否有变化
+func (This *History) checkpoint() bool {
+	This.RLock()
+	pendingChunks := This.pendingChunks
+	This.RUnlock()
+	doneMap := make(map[*historyChunk]bool, 0)
+	for _, chunk := range pendingChunks {
+		drained := true
+		for _, wait := range chunk.waits {
+			if !wait.drained() {
+				drained = false
+				break
+			}
+		}
+		if !drained {
+			continue
+		}
+		doneMap[chunk] = true
+		if chunk.tableDone {
+			chunk.table.Lock()
+			chunk.table.Done = true
+			chunk.table.CompletedRanges = nil
+			chunk.table.KeysetRanges = nil
+			chunk.table.Unlock()
+		} else if chunk.keyset {
+			chunk.table.completeKeyset(chunk.keysetIndex, chunk.keysetLower, chunk.keysetDone)
+		} else {
+			chunk.table.completeRange(chunk.from, chunk.to)
+		}
+	}
+	if len(doneMap) == 0 {
+		return false
+	}
+	This.Lock()
+	defer This.Unlock()
+	newPendingChunks := make([]*historyChunk, 0, len(This.pendingChunks))
+	for _, chunk := range This.pendingChunks {
+		if !doneMap[chunk] {
+			newPendingChunks = append(newPendingChunks, chunk)
+		}
+	}
+	This.pendingChunks = newPendingChunks
+	return true
+}
+
+// 每秒记录一次进度, 任务结束之后退出
+func (This *History) checkpointLoop() {
+	timer := time.NewTicker(time.Duration(1) * time.Second)
+	defer timer.Stop()
+	for {
+		<-timer.C
+		changed := This.checkpoint()
+		This.RLock()
+		status := This.Status
+		This.RUnlock()
+		switch status {
+		case HISTORY_STATUS_RUNNING, HISTORY_STATUS_SELECT_OVER, HISTORY_STATUS_SELECT_STOPING:
+			if changed {
+				This.save()
+			}
+		default:
+			This.save()
+			return
+		}
+	}
+}
+
+func (This *History) save() {
+	This.RLock()
+	data := historyStorage{
+		ID:              This.ID,
+		DbName:          This.DbName,
+		SchemaName:      This.SchemaName,
+		TableName:       This.TableName,
+		TableNames:      This.TableNames,
+		Property:        This.Property,
+		Status:          This.Status,
+		ToServerIDList:  This.ToServerIDList,
+		StartTime:       This.StartTime,
+		OverTime:        This.OverTime,
+		SelectRowsCount: This.SelectRowsCount,
+		Tables:          make([]TableCheckpoint, 0, len(This.TableNameArr)),
+	}
+	// LimitOptimize 拉数据的时候会按表改变, 保存界面配置的值
+	data.Property.LimitOptimize = This.Property.FirstLimitOptimize
+	for _, table := range This.TableNameArr {
+		data.Tables = append(data.Tables, table.checkpoint())
+	}
+	This.RUnlock()
+	b, err := json.Marshal(data)
+	if err != nil {
+		This.LogError("save err:" + err.Error())
+		return
+	}
+	if err = putKeyVal([]byte(historyKey(This.DbName, This.ID)), b); err != nil {
+		This.LogError("save err:" + err.Error())
+	}
+}
+
+// 重启之后恢复全量任务, 没有结束的任务改成 halfway, 可以通过 resume 继续拉取
+func RecoveryHistory() {
+	recoveryHistoryByPrefix(HISTORY_KEY_PREFIX)
+}
+
+func recoveryHistoryByPrefix(prefix string) {
+	for _, v := range getListByPrefix([]byte(prefix)) {
+		var data historyStorage
+		if err := json.Unmarshal([]byte(v.Value), &data); err != nil {
+			log.Println("history recovery key:", v.Key, " err:", err)
+			continue
+		}
+		if err := recoveryHistory(&data); err != nil {
+			log.Println("history recovery key:", v.Key, " err:", err)
+		}
+	}
+}
+
+func recoveryHistory(data *historyStorage) error {
+	db := server.GetDBObj(data.DbName)
+	if db == nil {
+		return fmt.Errorf("%s not exist", data.DbName)
+	}
+	historyJob := newHistoryFromStorage(data)
+	historyJob.Uri = db.ConnectUri
+	l.Lock()
+	if _, ok := historyMap[data.DbName]; !ok {
+		historyMap[data.DbName] = make(map[int]*History, 0)
+	}
+	historyMap[data.DbName][data.ID] = historyJob
+	if data.ID > lastHistoryID {
+		lastHistoryID = data.ID
+	}
+	l.Unlock()
+	if historyJob.Property.Crontab != "" {
+		return startCrond(historyJob)
+	}
+	return nil
+}
+
+func newHistoryFromStorage(data *historyStorage) *History {
+	TableNameArr := make([]*TableStatus, 0, len(data.Tables))
+	TableCountSuccess := len(data.Tables)
+	for i, v := range data.Tables {
+		TableNameArr = append(TableNameArr, &TableStatus{
+			RowsCount:       v.RowsCount,
+			SelectCount:     v.SelectCount,
+			TableName:       v.TableName,
+			Done:            v.Done,
+			Cursor:          v.Cursor,
+			CompletedRanges: v.CompletedRanges,
+			LimitOptimize:   v.LimitOptimize,
+			KeysetKeyArr:    v.KeysetKeyArr,
+			KeysetRanges:    v.KeysetRanges,
+		})
+		if !v.Done && i < TableCountSuccess {
+			TableCountSuccess = i
+		}
+	}
+	Status := data.Status
+	switch Status {
+	case HISTORY_STATUS_RUNNING, HISTORY_STATUS_SELECT_OVER, HISTORY_STATUS_SELECT_STOPING:
+		Status = HISTORY_STATUS_HALFWAY
+	}
+	if TableCountSuccess >= len(TableNameArr) {
+		TableCountSuccess = 0
+	}
+	return &History{
+		ID:                data.ID,
+		DbName:            data.DbName,
+		SchemaName:        data.SchemaName,
+		TableName:         data.TableName,
+		TableNames:        data.TableNames,
+		TableNameArr:      TableNameArr,
+		TableCount:        len(TableNameArr),
+		TableCountSuccess: TableCountSuccess,
+		Status:            Status,
+		Property:          data.Property,
+		ToServerIDList:    data.ToServerIDList,
+		StartTime:         data.StartTime,
+		OverTime:          data.OverTime,
+		SelectRowsCount:   data.SelectRowsCount,
+		ThreadPool:        make([]*ThreadStatus, 0),
+	}
+}
+
+func ResumeHistory(dbName string, ID int) error {
+	l.RLock()
+	defer l.RUnlock()
+	if _, ok := historyMap[dbName]; !ok {
+		return fmt.Errorf("%s not exist", dbName)
+	}
+	if _, ok := historyMap[dbName][ID]; !ok {
+		return fmt.Errorf("%s %d not exist", dbName, ID)
+	}
+	return historyMap[dbName][ID].Resume()
+}
@@ -0,0 +1,124 @@
+package history
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/brokercap/Bifrost/server"
+)
+
+func TestTableStatus_completeRange(t *testing.T) {
+	Convey("out of order chunks merge into cursor", t, func() {
+		table := &TableStatus{TableName: "binlog_field_test"}
+		table.completeRange(200, 300)
+		table.completeRange(300, 400)
+		So(table.Cursor, ShouldEqual, 0)
+		So(table.skipCompleted(200), ShouldEqual, 400)
+		So(table.skipCompleted(100), ShouldEqual, 100)
+
+		table.completeRange(0, 100)
+		So(table.Cursor, ShouldEqual, 100)
+		So(len(table.CompletedRanges), ShouldEqual, 2)
+
+		table.completeRange(100, 200)
+		So(table.Cursor, ShouldEqual, 400)
+		So(len(table.CompletedRanges), ShouldEqual, 0)
+	})
+}
+
+func TestHistory_checkpoint(t *testing.T) {
+	Convey("chunk is completed after plugin commit the marker", t, func() {
+		toServerObj := &toServer{ToServerInfo: &server.ToServer{}}
+		table := &TableStatus{TableName: "binlog_field_test"}
+		historyObj := &History{
+			TableNameArr:  []*TableStatus{table},
+			ToServerList:  []*toServer{toServerObj},
+			runningChunks: make(map[uint64]*historyChunk, 0),
+		}
+		historyObj.addRunningChunk(1, 0, 101)
+		historyObj.chunkSelected(1)
+		So(historyObj.checkpoint(), ShouldBeFalse)
+		So(table.Cursor, ShouldEqual, 0)
+
+		// commit 标记写在数据后面
+		marker := <-toServerObj.ToServerInfo.ToServerChan.To
+		So(marker.EventType, ShouldEqual, "commit")
+		So(marker.EventID, ShouldEqual, 1)
+
+		// 批量提交的插件, 标记被取走了但是还没提交成功
+		toServerObj.ToServerInfo.QueueMsgCount = 0
+		So(historyObj.checkpoint(), ShouldBeFalse)
+		So(table.Cursor, ShouldEqual, 0)
+
+		toServerObj.ToServerInfo.LastSuccessBinlog = &server.PositionStruct{EventID: marker.EventID}
+		So(historyObj.checkpoint(), ShouldBeTrue)
+		So(table.Cursor, ShouldEqual, 101)
+		So(len(historyObj.pendingChunks), ShouldEqual, 0)
+
+		historyObj.tableSelected(table)
+		So(historyObj.checkpoint(), ShouldBeFalse)
+		marker = <-toServerObj.ToServerInfo.ToServerChan.To
+		So(marker.EventID, ShouldEqual, 2)
+		toServerObj.ToServerInfo.LastSuccessBinlog = &server.PositionStruct{EventID: marker.EventID}
+		So(historyObj.checkpoint(), ShouldBeTrue)
+		So(table.Done, ShouldBeTrue)
+	})
+
+	Convey("killed toServer never complete", t, func() {
+		toServerObj := &toServer{ToServerInfo: &server.ToServer{Status: "deled"}}
+		table := &TableStatus{TableName: "binlog_field_test"}
+		historyObj := &History{TableNameArr: []*TableStatus{table}, ToServerList: []*toServer{toServerObj}}
+		historyObj.addRunningChunk(0, 0, 100)
+		historyObj.chunkSelected(0)
+		So(historyObj.checkpoint(), ShouldBeFalse)
+	})
+}
+
+func TestHistory_saveAndRecovery(t *testing.T) {
+	var saved []byte
+	putKeyVal = func(key []byte, val []byte) error {
+		saved = val
+		return nil
+	}
+	Convey("running history recovery as halfway", t, func() {
+		historyObj := &History{
+			ID:         3,
+			DbName:     "mysqlTest",
+			SchemaName: "bifrost_test",
+			TableName:  "binlog_field_test_*",
+			Status:     HISTORY_STATUS_RUNNING,
+			Property:   HistoryProperty{ThreadNum: 1, ThreadCountPer: 100, FirstLimitOptimize: 1, LimitOptimize: 0},
+			TableNameArr: []*TableStatus{
+				{TableName: "binlog_field_test_1", Done: true},
+				{TableName: "binlog_field_test_2", Cursor: 200, CompletedRanges: []HistoryRange{{From: 300, To: 400}}, LimitOptimize: 1},
+			},
+		}
+		historyObj.save()
+
+		var data historyStorage
+		So(json.Unmarshal(saved, &data), ShouldBeNil)
+		So(data.Property.LimitOptimize, ShouldEqual, 1)
+
+		job := newHistoryFromStorage(&data)
+		So(job.Status, ShouldEqual, HISTORY_STATUS_HALFWAY)
+		So(job.TableCountSuccess, ShouldEqual, 1)
+		So(job.TableNameArr[1].Cursor, ShouldEqual, 200)
+		So(job.TableNameArr[1].skipCompleted(300), ShouldEqual, 400)
+
+		Convey("resume from first table not done", func() {
+			job.TableCountSuccess = 0
+			So(job.checkResume(), ShouldBeNil)
+			So(job.TableCountSuccess, ShouldEqual, 1)
+
+			job.Property.LimitOptimize = 1
+			job.resume = true
+			job.initCheckpoint()
+			So(job.NowStartI, ShouldEqual, 200)
+
+			job.Property.Snapshot = true
+			So(job.checkResume(), ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,621 @@
+package history
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brokercap/Bifrost/Bristol/mysql"
+	"github.com/brokercap/Bifrost/server"
+	"github.com/brokercap/Bifrost/server/storage"
+)
+
+// 增量快照(DBLog 算法), 不锁表, 不开长事务, 全量和增量交替进行
+// 1. 按主键顺序每次拉取 ChunkSize 条数据, 拉取之前往信号表写低水位, 拉取之后写高水位
+// 2. 同步配置在 低水位 和 高水位 之间收到的增量数据, 主键在区间里的以增量为准, 收到高水位的时候把区间里剩下的数据同步出去
+// 3. 每个区间所有同步配置都处理完之后, 保存这个表同步到的最后一个主键, 重启之后从这个主键继续
+// 4. 每个表都可以单独暂停
+
+const INCREMENTAL_SNAPSHOT_KEY_PREFIX = "bifrost_incremental_snapshot_"
+
+const DEFAULT_SIGNAL_TABLE_NAME = "bifrost_signal"
+
+type IncrementalSnapshotStatus string
+
+const (
+	INCREMENTAL_SNAPSHOT_STATUS_CLOSE   IncrementalSnapshotStatus = "close"
+	INCREMENTAL_SNAPSHOT_STATUS_RUNNING IncrementalSnapshotStatus = "running"
+	INCREMENTAL_SNAPSHOT_STATUS_STOPING IncrementalSnapshotStatus = "stoping"
+	INCREMENTAL_SNAPSHOT_STATUS_STOPED  IncrementalSnapshotStatus = "stoped"
+	INCREMENTAL_SNAPSHOT_STATUS_PAUSED  IncrementalSnapshotStatus = "paused" // 只用于表
+	INCREMENTAL_SNAPSHOT_STATUS_OVER    IncrementalSnapshotStatus = "over"
+	INCREMENTAL_SNAPSHOT_STATUS_ERROR   IncrementalSnapshotStatus = "error"
+	INCREMENTAL_SNAPSHOT_STATUS_KILLED  IncrementalSnapshotStatus = "killed"
+)
+
+type IncrementalSnapshotTable struct {
+	TableName  string
+	Status     IncrementalSnapshotStatus
+	LastPri    []interface{} // 已经同步完成的最后一条数据的主键
+	ChunkCount int
+	RowsCount  uint64
+	Error      string
+}
+
+type IncrementalSnapshot struct {
+	sync.RWMutex
+	ID             int
+	DbName         string
+	SchemaName     string // 同步配置所在的库
+	TableName      string // 同步配置所在的表, 模糊匹配的表是 table_*
+	ToServerIDList []int
+	ChunkSize      int    // 每个区间的数据条数
+	SignalTable    string // 信号表 schema.table, 需要有写权限
+	Status         IncrementalSnapshotStatus
+	Error          string
+	Tables         []*IncrementalSnapshotTable
+	StartTime      string
+	OverTime       string
+	Uri            string `json:"-"`
+}
+
+// 方便单元测试替换存储
+var putKeyVal = storage.PutKeyVal
+var delKeyVal = storage.DelKeyVal
+var getListByPrefix = storage.GetListByPrefix
+
+var incrementalSnapshotLock sync.RWMutex
+var incrementalSnapshotMap = make(map[string]map[int]*IncrementalSnapshot, 0)
+var lastIncrementalSnapshotID int
+
+func incrementalSnapshotKey(dbName string, ID int) string {
+	return INCREMENTAL_SNAPSHOT_KEY_PREFIX + dbName + "|" + strconv.Itoa(ID)
+}
+
+// 信号表默认放在同步的库下面
+func parseSignalTable(SchemaName, SignalTable string) (string, string, error) {
+	if SignalTable == "" {
+		return SchemaName, DEFAULT_SIGNAL_TABLE_NAME, nil
+	}
+	arr := strings.Split(SignalTable, ".")
+	if len(arr) != 2 || arr[0] == "" || arr[1] == "" {
+		return "", "", fmt.Errorf("SignalTable:%s must be schema.table", SignalTable)
+	}
+	return arr[0], arr[1], nil
+}
+
+func AddIncrementalSnapshot(dbName, SchemaName, TableName, TableNames string, ChunkSize int, SignalTable string, ToServerIDList []int) (int, error) {
+	if err := CheckSnapshot(dbName); err != nil {
+		return 0, err
+	}
+	dbObj := server.GetDBObj(dbName)
+	if dbObj.GetTableSelf(SchemaName, TableName) == nil {
+		return 0, fmt.Errorf("%s.%s not exist", SchemaName, TableName)
+	}
+	if len(ToServerIDList) == 0 {
+		return 0, fmt.Errorf("ToServerIDList can't be empty")
+	}
+	if ChunkSize <= 0 {
+		ChunkSize = 1000
+	}
+	signalSchema, signalTable, err := parseSignalTable(SchemaName, SignalTable)
+	if err != nil {
+		return 0, err
+	}
+	tables := make([]*IncrementalSnapshotTable, 0)
+	for _, v := range strings.Split(TableNames, ";") {
+		v = strings.Trim(v, " ")
+		if v == "" {
+			continue
+		}
+		tables = append(tables, &IncrementalSnapshotTable{TableName: v, Status: INCREMENTAL_SNAPSHOT_STATUS_CLOSE})
+	}
+	if len(tables) == 0 {
+		return 0, fmt.Errorf("TableNames can't be empty")
+	}
+	incrementalSnapshotLock.Lock()
+	defer incrementalSnapshotLock.Unlock()
+	lastIncrementalSnapshotID++
+	task := &IncrementalSnapshot{
+		ID:             lastIncrementalSnapshotID,
+		DbName:         dbName,
+		SchemaName:     SchemaName,
+		TableName:      TableName,
+		ToServerIDList: ToServerIDList,
+		ChunkSize:      ChunkSize,
+		SignalTable:    signalSchema + "." + signalTable,
+		Status:         INCREMENTAL_SNAPSHOT_STATUS_CLOSE,
+		Tables:         tables,
+		Uri:            dbObj.ConnectUri,
+	}
+	if err = task.save(); err != nil {
+		return 0, err
+	}
+	if _, ok := incrementalSnapshotMap[dbName]; !ok {
+		incrementalSnapshotMap[dbName] = make(map[int]*IncrementalSnapshot, 0)
+	}
+	incrementalSnapshotMap[dbName][task.ID] = task
+	return task.ID, nil
+}
+
+func getIncrementalSnapshot(dbName string, ID int) (*IncrementalSnapshot, error) {
+	incrementalSnapshotLock.RLock()
+	defer incrementalSnapshotLock.RUnlock()
+	if _, ok := incrementalSnapshotMap[dbName]; !ok {
+		return nil, fmt.Errorf("%s not exist", dbName)
+	}
+	task, ok := incrementalSnapshotMap[dbName][ID]
+	if !ok {
+		return nil, fmt.Errorf("%s %d not exist", dbName, ID)
+	}
+	return task, nil
+}
+
+func GetIncrementalSnapshotList(dbName string) []*IncrementalSnapshot {
+	incrementalSnapshotLock.RLock()
+	defer incrementalSnapshotLock.RUnlock()
+	list := make([]*IncrementalSnapshot, 0)
+	for dbNameKey, v := range incrementalSnapshotMap {
+		if dbName != "" && dbName != dbNameKey {
+			continue
+		}
+		for _, task := range v {
+			list = append(list, task)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].DbName != list[j].DbName {
+			return list[i].DbName < list[j].DbName
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+func StartIncrementalSnapshot(dbName string, ID int) error {
+	task, err := getIncrementalSnapshot(dbName, ID)
+	if err != nil {
+		return err
+	}
+	return task.Start()
+}
+
+// 当前区间同步完之后停止, 重新启动后从最后一个主键继续
+func StopIncrementalSnapshot(dbName string, ID int) error {
+	task, err := getIncrementalSnapshot(dbName, ID)
+	if err != nil {
+		return err
+	}
+	task.Lock()
+	defer task.Unlock()
+	if task.Status != INCREMENTAL_SNAPSHOT_STATUS_RUNNING {
+		return fmt.Errorf("status is %s", task.Status)
+	}
+	task.Status = INCREMENTAL_SNAPSHOT_STATUS_STOPING
+	return task.save()
+}
+
+func DelIncrementalSnapshot(dbName string, ID int) error {
+	task, err := getIncrementalSnapshot(dbName, ID)
+	if err != nil {
+		return err
+	}
+	task.Lock()
+	task.Status = INCREMENTAL_SNAPSHOT_STATUS_KILLED
+	task.Unlock()
+	incrementalSnapshotLock.Lock()
+	defer incrementalSnapshotLock.Unlock()
+	delete(incrementalSnapshotMap[dbName], ID)
+	if len(incrementalSnapshotMap[dbName]) == 0 {
+		delete(incrementalSnapshotMap, dbName)
+	}
+	return delKeyVal([]byte(incrementalSnapshotKey(dbName, ID)))
+}
+
+// 暂停或者恢复一个表的增量快照, 正在拉取的区间会同步完
+func PauseIncrementalSnapshotTable(dbName string, ID int, TableName string, pause bool) error {
+	task, err := getIncrementalSnapshot(dbName, ID)
+	if err != nil {
+		return err
+	}
+	task.Lock()
+	defer task.Unlock()
+	for _, t := range task.Tables {
+		if t.TableName != TableName {
+			continue
+		}
+		if pause {
+			if t.Status != INCREMENTAL_SNAPSHOT_STATUS_CLOSE && t.Status != INCREMENTAL_SNAPSHOT_STATUS_RUNNING {
+				return fmt.Errorf("%s status is %s", TableName, t.Status)
+			}
+			t.Status = INCREMENTAL_SNAPSHOT_STATUS_PAUSED
+		} else {
+			if t.Status != INCREMENTAL_SNAPSHOT_STATUS_PAUSED && t.Status != INCREMENTAL_SNAPSHOT_STATUS_ERROR {
+				return fmt.Errorf("%s status is %s", TableName, t.Status)
+			}
+			t.Status = INCREMENTAL_SNAPSHOT_STATUS_CLOSE
+			t.Error = ""
+		}
+		return task.save()
+	}
+	return fmt.Errorf("%s not exist", TableName)
+}
+
+// 重启之后恢复增量快照任务, 之前在运行的继续运行
+func RecoveryIncrementalSnapshot() {
+	recoveryIncrementalSnapshotByPrefix(INCREMENTAL_SNAPSHOT_KEY_PREFIX)
+}
+
+func recoveryIncrementalSnapshotByPrefix(prefix string) {
+	for _, v := range getListByPrefix([]byte(prefix)) {
+		var task IncrementalSnapshot
+		decoder := json.NewDecoder(bytes.NewReader([]byte(v.Value)))
+		decoder.UseNumber()
+		if err := decoder.Decode(&task); err != nil {
+			log.Println("incremental snapshot recovery key:", v.Key, " err:", err)
+			continue
+		}
+		for _, t := range task.Tables {
+			t.LastPri = transferJsonNumber(t.LastPri)
+		}
+		dbObj := server.GetDBObj(task.DbName)
+		if dbObj == nil {
+			log.Println("incremental snapshot recovery:", task.DbName, task.ID, " db not exist")
+			continue
+		}
+		task.Uri = dbObj.ConnectUri
+		incrementalSnapshotLock.Lock()
+		if _, ok := incrementalSnapshotMap[task.DbName]; !ok {
+			incrementalSnapshotMap[task.DbName] = make(map[int]*IncrementalSnapshot, 0)
+		}
+		incrementalSnapshotMap[task.DbName][task.ID] = &task
+		if task.ID > lastIncrementalSnapshotID {
+			lastIncrementalSnapshotID = task.ID
+		}
+		incrementalSnapshotLock.Unlock()
+		switch task.Status {
+		case INCREMENTAL_SNAPSHOT_STATUS_RUNNING:
+			task.Status = INCREMENTAL_SNAPSHOT_STATUS_STOPED
+			task.Start()
+		case INCREMENTAL_SNAPSHOT_STATUS_STOPING:
+			task.Status = INCREMENTAL_SNAPSHOT_STATUS_STOPED
+		}
+	}
+}
+
+// json 反序列化之后的数字, 转回 int64, uint64, 防止大整数丢精度
+func transferJsonNumber(arr []interface{}) []interface{} {
+	for i, v := range arr {
+		n, ok := v.(json.Number)
+		if !ok {
+			continue
+		}
+		if i64, err := strconv.ParseInt(string(n), 10, 64); err == nil {
+			arr[i] = i64
+		} else if u64, err := strconv.ParseUint(string(n), 10, 64); err == nil {
+			arr[i] = u64
+		} else {
+			arr[i] = string(n)
+		}
+	}
+	return arr
+}
+
+// 调用方需要加锁
+func (This *IncrementalSnapshot) save() error {
+	b, err := json.Marshal(This)
+	if err != nil {
+		return err
+	}
+	return putKeyVal([]byte(incrementalSnapshotKey(This.DbName, This.ID)), b)
+}
+
+func (This *IncrementalSnapshot) LogInfo(infoContent string) {
+	log.Printf("[INFO] incremental snapshot ID:%d DbName:%s SchemaName:%s TableName:%s ToServerIDList:%+v %s \n", This.ID, This.DbName, This.SchemaName, This.TableName, This.ToServerIDList, infoContent)
+}
+
+func (This *IncrementalSnapshot) LogError(errContent string) {
+	log.Printf("[ERROR] incremental snapshot ID:%d DbName:%s SchemaName:%s TableName:%s ToServerIDList:%+v %s \n", This.ID, This.DbName, This.SchemaName, This.TableName, This.ToServerIDList, errContent)
+}
+
+func (This *IncrementalSnapshot) Start() error {
+	This.Lock()
+	defer This.Unlock()
+	switch This.Status {
+	case INCREMENTAL_SNAPSHOT_STATUS_RUNNING, INCREMENTAL_SNAPSHOT_STATUS_STOPING:
+		return fmt.Errorf("is %s", This.Status)
+	case INCREMENTAL_SNAPSHOT_STATUS_OVER:
+		// 已经结束的, 重新开始
+		for _, t := range This.Tables {
+			*t = IncrementalSnapshotTable{TableName: t.TableName, Status: INCREMENTAL_SNAPSHOT_STATUS_CLOSE}
+		}
+	default:
+		// 出错的表从最后一个主键继续
+		for _, t := range This.Tables {
+			if t.Status == INCREMENTAL_SNAPSHOT_STATUS_ERROR {
+				t.Status = INCREMENTAL_SNAPSHOT_STATUS_CLOSE
+				t.Error = ""
+			}
+		}
+	}
+	This.Status = INCREMENTAL_SNAPSHOT_STATUS_RUNNING
+	This.Error = ""
+	This.StartTime = time.Now().Format("2006-01-02 15:04:05")
+	This.OverTime = ""
+	if err := This.save(); err != nil {
+		return err
+	}
+	go This.run()
+	return nil
+}
+
+func (This *IncrementalSnapshot) getStatus() IncrementalSnapshotStatus {
+	This.RLock()
+	defer This.RUnlock()
+	return This.Status
+}
+
+// 下一个要拉取的表, 暂停的表跳过, 都暂停了则返回 nil,true
+func (This *IncrementalSnapshot) nextTable() (t *IncrementalSnapshotTable, hasPaused bool) {
+	This.Lock()
+	defer This.Unlock()
+	for _, v := range This.Tables {
+		switch v.Status {
+		case INCREMENTAL_SNAPSHOT_STATUS_CLOSE, INCREMENTAL_SNAPSHOT_STATUS_RUNNING:
+			v.Status = INCREMENTAL_SNAPSHOT_STATUS_RUNNING
+			return v, hasPaused
+		case INCREMENTAL_SNAPSHOT_STATUS_PAUSED:
+			hasPaused = true
+		}
+	}
+	return nil, hasPaused
+}
+
+func (This *IncrementalSnapshot) run() {
+	This.LogInfo("start")
+	var conn mysql.MysqlConnection
+	defer func() {
+		if err := recover(); err != nil {
+			This.LogError(fmt.Sprint(err) + string(debug.Stack()))
+			This.Lock()
+			This.Status = INCREMENTAL_SNAPSHOT_STATUS_ERROR
+			This.Error = fmt.Sprint(err)
+			This.Unlock()
+		}
+		if conn != nil {
+			conn.Close()
+		}
+		This.Lock()
+		defer This.Unlock()
+		switch This.Status {
+		case INCREMENTAL_SNAPSHOT_STATUS_KILLED:
+			return
+		case INCREMENTAL_SNAPSHOT_STATUS_STOPING:
+			This.Status = INCREMENTAL_SNAPSHOT_STATUS_STOPED
+		}
+		This.OverTime = time.Now().Format("2006-01-02 15:04:05")
+		This.save()
+		This.LogInfo(fmt.Sprintf("over, status:%s", This.Status))
+	}()
+	signalSchema, signalTable, _ := parseSignalTable(This.SchemaName, This.SignalTable)
+	conn, err := dbConnect(This.Uri)
+	if err != nil {
+		This.setError(err)
+		return
+	}
+	if err = This.initSignalTable(conn, signalSchema, signalTable); err != nil {
+		This.setError(err)
+		return
+	}
+	for {
+		if This.getStatus() != INCREMENTAL_SNAPSHOT_STATUS_RUNNING {
+			return
+		}
+		t, hasPaused := This.nextTable()
+		if t == nil {
+			if hasPaused {
+				// 还有暂停的表, 等待恢复
+				time.Sleep(time.Second)
+				continue
+			}
+			This.Lock()
+			This.Status = INCREMENTAL_SNAPSHOT_STATUS_OVER
+			This.Unlock()
+			return
+		}
+		if err = This.runTable(conn, t, signalSchema, signalTable); err != nil {
+			This.Lock()
+			t.Status = INCREMENTAL_SNAPSHOT_STATUS_ERROR
+			t.Error = err.Error()
+			This.save()
+			This.Unlock()
+			This.LogError(fmt.Sprintf("table:%s err:%s", t.TableName, err))
+			// 连接出错了, 整个任务停下来, 其他错误只影响这个表
+			if conn, err = This.reconnect(conn); err != nil {
+				This.setError(err)
+				return
+			}
+		}
+	}
+}
+
+func (This *IncrementalSnapshot) setError(err error) {
+	This.Lock()
+	defer This.Unlock()
+	This.Status = INCREMENTAL_SNAPSHOT_STATUS_ERROR
+	This.Error = err.Error()
+	This.LogError(err.Error())
+}
+
+func (This *IncrementalSnapshot) reconnect(conn mysql.MysqlConnection) (mysql.MysqlConnection, error) {
+	if _, err := conn.Exec("SELECT 1", []driver.Value{}); err == nil {
+		return conn, nil
+	}
+	func() {
+		defer func() {
+			recover()
+		}()
+		conn.Close()
+	}()
+	return dbConnect(This.Uri)
+}
+
+func (This *IncrementalSnapshot) initSignalTable(conn mysql.MysqlConnection, signalSchema, signalTable string) error {
+	sql := "CREATE TABLE IF NOT EXISTS `" + signalSchema + "`.`" + signalTable + "` (" +
+		"`id` varchar(64) NOT NULL," +
+		"`type` varchar(32) NOT NULL," +
+		"`data` varchar(2048) DEFAULT NULL," +
+		"PRIMARY KEY (`id`)" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+	if _, err := conn.Exec(sql, []driver.Value{}); err != nil {
+		return fmt.Errorf("create signal table %s.%s err:%s", signalSchema, signalTable, err)
+	}
+	// 信号表的 binlog 需要解析出来
+	dbObj := server.GetDBObj(This.DbName)
+	if dbObj == nil {
+		return fmt.Errorf("%s not exist", This.DbName)
+	}
+	dbObj.AddReplicateDoDb(signalSchema, signalTable, true)
+	return nil
+}
+
+// 一个表按区间拉取, 直到拉完或者暂停
+func (This *IncrementalSnapshot) runTable(conn mysql.MysqlConnection, t *IncrementalSnapshotTable, signalSchema, signalTable string) error {
+	Fields, err := GetSchemaTableFieldList(conn, This.SchemaName, t.TableName, false)
+	if err != nil {
+		return err
+	}
+	if len(Fields) == 0 {
+		return fmt.Errorf("%s.%s Fields empty", This.SchemaName, t.TableName)
+	}
+	Pri := getPriArr(Fields)
+	if len(Pri) == 0 {
+		return fmt.Errorf("%s.%s has no primary key", This.SchemaName, t.TableName)
+	}
+	ColumnMapping := getColumnMapping(Fields)
+	for {
+		switch This.getStatus() {
+		case INCREMENTAL_SNAPSHOT_STATUS_RUNNING:
+			break
+		default:
+			return nil
+		}
+		This.RLock()
+		status := t.Status
+		lastPri := t.LastPri
+		This.RUnlock()
+		if status != INCREMENTAL_SNAPSHOT_STATUS_RUNNING {
+			return nil
+		}
+		chunk := &server.WatermarkChunk{
+			DbName:         This.DbName,
+			SignalSchema:   signalSchema,
+			SignalTable:    signalTable,
+			SchemaName:     This.SchemaName,
+			TableName:      t.TableName,
+			BindKey:        server.GetSchemaAndTableJoin(This.SchemaName, This.TableName),
+			ToServerIDList: This.ToServerIDList,
+			Pri:            Pri,
+			ColumnMapping:  ColumnMapping,
+		}
+		rows, ok, err := This.doChunk(conn, chunk, Fields, lastPri)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			// 有同步配置没收到低水位, 重新拉取这个区间
+			This.LogInfo(fmt.Sprintf("table:%s chunk after %+v retry", t.TableName, lastPri))
+			continue
+		}
+		This.Lock()
+		t.ChunkCount++
+		t.RowsCount += uint64(len(rows))
+		if len(rows) > 0 {
+			t.LastPri = make([]interface{}, len(Pri))
+			for i, name := range Pri {
+				t.LastPri[i] = rows[len(rows)-1][name]
+			}
+		}
+		if len(rows) < This.ChunkSize && t.Status == INCREMENTAL_SNAPSHOT_STATUS_RUNNING {
+			t.Status = INCREMENTAL_SNAPSHOT_STATUS_OVER
+		}
+		err = This.save()
+		This.Unlock()
+		if err != nil {
+			return err
+		}
+		if len(rows) < This.ChunkSize {
+			return nil
+		}
+	}
+}
+
+// 拉取一个区间: 写低水位, 查询, 写高水位, 等所有同步配置处理完这个区间
+func (This *IncrementalSnapshot) doChunk(conn mysql.MysqlConnection, chunk *server.WatermarkChunk, Fields []TableStruct, lastPri []interface{}) (rows []map[string]interface{}, ok bool, err error) {
+	watermarkId := fmt.Sprintf("bifrost-%d-%d", This.ID, time.Now().UnixNano())
+	chunk.Low, chunk.High = watermarkId+"-low", watermarkId+"-high"
+	server.AddWatermarkChunk(chunk)
+	defer func() {
+		server.DelWatermarkChunk(chunk)
+		signalSql := "DELETE FROM `" + chunk.SignalSchema + "`.`" + chunk.SignalTable + "` WHERE `id` IN (?,?)"
+		conn.Exec(signalSql, []driver.Value{chunk.Low, chunk.High})
+	}()
+	if err = This.writeWatermark(conn, chunk, chunk.Low, "snapshot-window-open"); err != nil {
+		return
+	}
+	sql, args := chunkSql(This.SchemaName, chunk.TableName, chunk.Pri, lastPri, This.ChunkSize)
+	result, err := conn.Query(sql, args)
+	if err != nil {
+		return
+	}
+	n := len(Fields)
+	rows = make([]map[string]interface{}, 0, This.ChunkSize)
+	for {
+		dest := make([]driver.Value, n, n)
+		if e := result.Next(dest); e != nil {
+			break
+		}
+		m, _ := fieldsToRow(Fields, dest)
+		rows = append(rows, m)
+	}
+	result.Close()
+	chunk.SetRows(rows)
+	if err = This.writeWatermark(conn, chunk, chunk.High, "snapshot-window-close"); err != nil {
+		return
+	}
+	timer := time.NewTicker(time.Second)
+	defer timer.Stop()
+	for {
+		select {
+		case ok = <-chunk.Done():
+			return
+		case <-timer.C:
+			if This.getStatus() == INCREMENTAL_SNAPSHOT_STATUS_KILLED {
+				err = fmt.Errorf("killed")
+				return
+			}
+		}
+	}
+}
+
+func (This *IncrementalSnapshot) writeWatermark(conn mysql.MysqlConnection, chunk *server.WatermarkChunk, id, watermarkType string) error {
+	sql := "INSERT INTO `" + chunk.SignalSchema + "`.`" + chunk.SignalTable + "` (`id`,`type`,`data`) VALUES (?,?,?)"
+	_, err := conn.Exec(sql, []driver.Value{id, watermarkType, chunk.SchemaName + "." + chunk.TableName})
+	if err != nil {
+		return fmt.Errorf("write watermark %s err:%s", id, err)
+	}
+	return nil
+}
+
+// 按主键顺序分页, 复合主键用 (a,b) > (?,?)
+func chunkSql(SchemaName, TableName string, Pri []string, lastPri []interface{}, ChunkSize int) (string, []driver.Value) {
+	return keysetSql(SchemaName, TableName, Pri, lastPri, nil, "", ChunkSize)
+}
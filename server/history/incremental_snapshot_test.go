@@ -0,0 +1,94 @@
+package history
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestChunkSql(t *testing.T) {
+	Convey("first chunk", t, func() {
+		sql, args := chunkSql("bifrost_test", "binlog_field_test", []string{"id"}, nil, 1000)
+		So(sql, ShouldEqual, "SELECT * FROM `bifrost_test`.`binlog_field_test` ORDER BY `id` LIMIT 1000")
+		So(len(args), ShouldEqual, 0)
+	})
+
+	Convey("composite primary key", t, func() {
+		sql, args := chunkSql("bifrost_test", "binlog_field_test", []string{"tenant_id", "id"}, []interface{}{int64(2), "a"}, 500)
+		So(sql, ShouldEqual, "SELECT * FROM `bifrost_test`.`binlog_field_test` WHERE (`tenant_id`,`id`) > (?,?) ORDER BY `tenant_id`,`id` LIMIT 500")
+		So(args, ShouldResemble, []driver.Value{int64(2), "a"})
+	})
+}
+
+func TestTransferJsonNumber(t *testing.T) {
+	Convey("big int not lose precision", t, func() {
+		arr := []interface{}{json.Number("9007199254740993"), json.Number("18446744073709551615"), json.Number("1.5"), "abc"}
+		arr = transferJsonNumber(arr)
+		So(arr[0], ShouldEqual, int64(9007199254740993))
+		So(arr[1], ShouldEqual, uint64(18446744073709551615))
+		So(arr[2], ShouldEqual, "1.5")
+		So(arr[3], ShouldEqual, "abc")
+	})
+}
+
+func TestParseSignalTable(t *testing.T) {
+	Convey("parse signal table", t, func() {
+		schema, table, err := parseSignalTable("bifrost_test", "")
+		So(err, ShouldBeNil)
+		So(schema, ShouldEqual, "bifrost_test")
+		So(table, ShouldEqual, DEFAULT_SIGNAL_TABLE_NAME)
+
+		schema, table, err = parseSignalTable("bifrost_test", "bifrost.signal")
+		So(err, ShouldBeNil)
+		So(schema, ShouldEqual, "bifrost")
+		So(table, ShouldEqual, "signal")
+
+		_, _, err = parseSignalTable("bifrost_test", "signal")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestIncrementalSnapshot_PauseTable(t *testing.T) {
+	saved := 0
+	putKeyVal = func(key []byte, val []byte) error {
+		saved++
+		return nil
+	}
+	task := &IncrementalSnapshot{
+		ID:     1,
+		DbName: "mysqlTest",
+		Status: INCREMENTAL_SNAPSHOT_STATUS_RUNNING,
+		Tables: []*IncrementalSnapshotTable{
+			{TableName: "t1", Status: INCREMENTAL_SNAPSHOT_STATUS_OVER},
+			{TableName: "t2", Status: INCREMENTAL_SNAPSHOT_STATUS_CLOSE},
+			{TableName: "t3", Status: INCREMENTAL_SNAPSHOT_STATUS_CLOSE},
+		},
+	}
+	incrementalSnapshotMap["mysqlTest"] = map[int]*IncrementalSnapshot{1: task}
+	defer delete(incrementalSnapshotMap, "mysqlTest")
+
+	Convey("pause and resume table", t, func() {
+		next, _ := task.nextTable()
+		So(next.TableName, ShouldEqual, "t2")
+
+		So(PauseIncrementalSnapshotTable("mysqlTest", 1, "t2", true), ShouldBeNil)
+		So(PauseIncrementalSnapshotTable("mysqlTest", 1, "t1", true), ShouldNotBeNil)
+		So(PauseIncrementalSnapshotTable("mysqlTest", 1, "t4", true), ShouldNotBeNil)
+		So(saved, ShouldEqual, 1)
+
+		next, hasPaused := task.nextTable()
+		So(next.TableName, ShouldEqual, "t3")
+		So(hasPaused, ShouldBeTrue)
+
+		So(PauseIncrementalSnapshotTable("mysqlTest", 1, "t3", true), ShouldBeNil)
+		next, hasPaused = task.nextTable()
+		So(next, ShouldBeNil)
+		So(hasPaused, ShouldBeTrue)
+
+		So(PauseIncrementalSnapshotTable("mysqlTest", 1, "t2", false), ShouldBeNil)
+		next, _ = task.nextTable()
+		So(next.TableName, ShouldEqual, "t2")
+	})
+}
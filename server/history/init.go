@@ -50,6 +50,11 @@ func AddHistory(dbName string, SchemaName string, TableName string, TableNames s
 	if Property.SyncThreadNum <= 0 {
 		Property.SyncThreadNum = 1
 	}
+	if Property.Snapshot {
+		if err := CheckSnapshot(dbName); err != nil {
+			return 0, err
+		}
+	}
 	Property.FirstLimitOptimize = Property.LimitOptimize
 	if len(ToServerIDList)*int(Property.SyncThreadNum) > 16384 {
 		return 0, fmt.Errorf("SyncThreadNum * len(ToServerIDList) > 16384")
@@ -88,6 +93,7 @@ func AddHistory(dbName string, SchemaName string, TableName string, TableNames s
 		}
 	}
 	historyMap[dbName][ID] = historyJob
+	historyJob.save()
 	return ID, nil
 }
 
@@ -99,6 +105,7 @@ func DelHistory(dbName string, ID int) bool {
 	}
 	_ = deleteCrond(historyMap[dbName][ID])
 	delete(historyMap[dbName], ID)
+	_ = delKeyVal([]byte(historyKey(dbName, ID)))
 	if len(historyMap[dbName]) == 0 {
 		delete(historyMap, dbName)
 	}
@@ -118,6 +125,7 @@ func KillHistory(dbName string, ID int) error {
 	for _, toServer := range historyMap[dbName][ID].ToServerList {
 		toServer.ToServerInfo.Status = "deled"
 	}
+	historyMap[dbName][ID].save()
 	return nil
 }
 
@@ -131,6 +139,7 @@ func StopHistory(dbName string, ID int) error {
 		return fmt.Errorf("%s %d not exist", dbName, ID)
 	}
 	historyMap[dbName][ID].Status = HISTORY_STATUS_SELECT_STOPING
+	historyMap[dbName][ID].save()
 	return nil
 }
 
@@ -178,7 +187,7 @@ func startCrond(job *History) error {
 	defer job.Unlock()
 	EntryID, err := crodObj.AddJob(job.Property.Crontab, job)
 	if err != nil {
-		log.Printf("[ERROR] history add crontab job DbName:%s SchemaName:%s ID:%d Crontab  err:%+v \n", job.DbName, job.SchemaName, job.ID, job.Property.Crontab, err)
+		log.Printf("[ERROR] history add crontab job DbName:%s SchemaName:%s ID:%d Crontab:%s err:%+v \n", job.DbName, job.SchemaName, job.ID, job.Property.Crontab, err)
 		return err
 	}
 	job.cronEntryID = EntryID
@@ -208,6 +217,7 @@ type HistoryProperty struct {
 	SyncThreadNum      int    // 同步协程数
 	FirstLimitOptimize int8   // 被添加的时候 LimitOptimize 的值，因为计算的时候，LimitOptimize 是可能被修改掉值
 	Crontab            string // 定时表达式，如果为空，则说明没有定时
+	Snapshot           bool   // 一致性快照模式, 全量完成后 ToServerIDList 对应的增量同步配置从快照位点之后开始同步
 }
 
 type ThreadStatus struct {
@@ -262,9 +272,15 @@ func (This *WaitGroup) Done() {
 
 type TableStatus struct {
 	sync.RWMutex
-	RowsCount   uint64
-	SelectCount uint64
-	TableName   string
+	RowsCount       uint64
+	SelectCount     uint64
+	TableName       string
+	Done            bool                    // 数据都已经同步完成
+	Cursor          uint64                  // 小于 Cursor 的数据都已经同步完成, 对应 NowStartI
+	CompletedRanges []HistoryRange          // Cursor 之后已经同步完成的区间
+	LimitOptimize   int8                    // Cursor 对应的分页方式, 恢复的时候分页方式变了, 要从头开始
+	KeysetKeyArr    []string                // keyset 分页用的字段, 恢复的时候字段变了, 要从头开始
+	KeysetRanges    []KeysetRangeCheckpoint // keyset 分页每个区间的进度
 }
 
 type History struct {
@@ -288,17 +304,26 @@ type History struct {
 	TablePriKeyMaxId   uint64 // 假如主键是自增id的情况下 这个值是当前自增id最大值
 	TablePriKey        string // 主键字段
 	TablePriArr        []string
+	TableKeyArr        []string       // keyset 分页用的主键或者唯一键字段
+	keysetRanges       []*keysetRange // keyset 分页的区间, 为空则不是 keyset 分页
 	ToServerList       []*toServer
 	ToServerTheadCount int16 // 实际正在运行的同步协程数
 	ToServerTheadGroup *WaitGroup
-	TableNames         string            // 用 ; 隔开的表名
-	TableNameArr       []*TableStatus    // TableNames 分割后的数组
-	CurrentTableName   string            // 正在执行全量的表名
-	TableCount         int               // 要全量的总表数量
-	TableCountSuccess  int               // 已经成功的表数量
-	selectStatus       bool              // 拉数据协程状态，true 为已拉完
-	SelectRowsCount    uint64            // 成功拉取多少条数据
-	ColumnMapping      map[string]string // 表字段类型
+	TableNames         string                  // 用 ; 隔开的表名
+	TableNameArr       []*TableStatus          // TableNames 分割后的数组
+	CurrentTableName   string                  // 正在执行全量的表名
+	TableCount         int                     // 要全量的总表数量
+	TableCountSuccess  int                     // 已经成功的表数量
+	selectStatus       bool                    // 拉数据协程状态，true 为已拉完
+	SelectRowsCount    uint64                  // 成功拉取多少条数据
+	ColumnMapping      map[string]string       // 表字段类型
+	SnapshotPosition   *server.PositionStruct  // 一致性快照对应的 binlog 位点
+	snapshotConnList   []mysql.MysqlConnection // 一致性快照连接, 每个拉数据协程一个
+	resume             bool                    // 从进度断点继续拉取
+	runningChunks      map[uint64]*historyChunk
+	pendingChunks      []*historyChunk // 拉取完等待同步的区间
+	markerLock         sync.Mutex
+	markerEventID      uint64 // 写入队列的 commit 标记的 eventID
 
 	cronEntryID    cron.EntryID  // 定时任务模块返回的ID
 	cronStatus     HisotryStatus // 定时任务是否启动
@@ -342,11 +367,30 @@ func (This *History) LogInfo(infoContent string) {
 }
 
 func (This *History) Start() error {
+	return This.start(false)
+}
+
+// 从上一次同步完成的进度继续拉取
+func (This *History) Resume() error {
+	return This.start(true)
+}
+
+func (This *History) start(resume bool) error {
 	This.Lock()
-	This.LogInfo("start")
+	if resume {
+		if err := This.checkResume(); err != nil {
+			This.Unlock()
+			This.LogError(err.Error())
+			return err
+		}
+		This.LogInfo("resume")
+	} else {
+		This.LogInfo("start")
+	}
 	This.selectStatus = false
 	switch This.Status {
 	case HISTORY_STATUS_SELECT_STOPING:
+		This.Unlock()
 		This.LogError("is stoping")
 		return fmt.Errorf("is stoping")
 		break
@@ -368,25 +412,38 @@ func (This *History) Start() error {
 		This.NowStartI = 0
 		break
 	}
+	if !resume {
+		This.SelectRowsCount = 0
+		for _, table := range This.TableNameArr[This.TableCountSuccess:] {
+			table.resetCheckpoint(This.Property.FirstLimitOptimize)
+		}
+	}
+	This.resume = resume
+	This.runningChunks = make(map[uint64]*historyChunk, 0)
+	This.pendingChunks = make([]*historyChunk, 0)
 	This.StartTime = time.Now().Format("2006-01-02 15:04:05")
 	This.Status = HISTORY_STATUS_RUNNING
 	This.NowStartI = 0
-	This.SelectRowsCount = 0
 	This.Fields = make([]TableStruct, 0)
 	This.ThreadPool = make([]*ThreadStatus, This.Property.ThreadNum)
 	This.threadResultChan = make(chan int, 1)
 	This.ToServerList = make([]*toServer, 0)
 	This.OverTime = ""
+	This.SnapshotPosition = nil
 	This.Unlock()
+	This.save()
+	go This.checkpointLoop()
 
 	go func() {
 		defer func() {
 			This.Lock()
 			defer This.Unlock()
 			This.OverTime = time.Now().Format("2006-01-02 15:04:05")
+			var threadErr bool
 			for _, v := range This.ThreadPool {
 				if v.Error != nil {
 					This.Status = HISTORY_STATUS_HALFWAY
+					threadErr = true
 				}
 			}
 			if len(This.ToServerList) > 0 {
@@ -398,10 +455,36 @@ func (This *History) Start() error {
 			if This.SelectRowsCount == 0 {
 				This.Status = HISTORY_STATUS_OVER
 			}
+			// 没有拉到数据的时候不会有同步协程, 在这里启动增量同步
+			if This.Status == HISTORY_STATUS_OVER && !threadErr {
+				This.startFollowToServer()
+			}
 			This.selectStatus = true
 		}()
-		for i, _ := range This.TableNameArr {
-			This.TableNameArr[i].SelectCount = 0
+		if !resume {
+			for i, _ := range This.TableNameArr {
+				This.TableNameArr[i].SelectCount = 0
+			}
+		}
+		if This.Property.Snapshot {
+			err := This.stopFollowToServer()
+			if err == nil {
+				err = This.startSnapshot()
+			}
+			if err != nil {
+				This.LogError("snapshot err:" + err.Error())
+				This.Lock()
+				for i := range This.ThreadPool {
+					This.ThreadPool[i] = &ThreadStatus{Num: i + 1, Error: err}
+				}
+				This.Unlock()
+				return
+			}
+			defer This.closeSnapshot()
+			for _, toServerInfo := range This.getFollowToServerList() {
+				toServerInfo.SetSnapshotPosition(This.SnapshotPosition)
+			}
+			server.SaveDBConfigInfo()
 		}
 		for {
 			This.CurrentTableName = This.TableNameArr[This.TableCountSuccess].TableName
@@ -434,9 +517,11 @@ func (This *History) Start() error {
 			default:
 				break
 			}
-			This.TableNameArr[This.TableCountSuccess].RowsCount = This.TableNameArr[This.TableCountSuccess].SelectCount
+			StatusTable := This.TableNameArr[This.TableCountSuccess]
+			StatusTable.RowsCount = StatusTable.SelectCount
 			This.TableCountSuccess++
 			This.Unlock()
+			This.tableSelected(StatusTable)
 			if This.TableCountSuccess >= This.TableCount {
 				break
 			}
@@ -454,6 +539,8 @@ func (This *History) initMetaInfo(db mysql.MysqlConnection) {
 		return
 	}
 	This.TablePriKey = ""
+	This.TableKeyArr = nil
+	This.keysetRanges = nil
 	var isCk bool
 	var err error
 	if isCk, err = IsClickHouse(db); err != nil {
@@ -472,12 +559,82 @@ func (This *History) initMetaInfo(db mysql.MysqlConnection) {
 		This.LogError(fmt.Sprintf("CurrentTableName:%s get schema table fields error:%+v ", This.CurrentTableName, err))
 		return
 	}
-	This.TablePriArr = make([]string, 0)
-	This.ColumnMapping = make(map[string]string, 0)
-	for _, v := range This.Fields {
+	This.TablePriArr = getPriArr(This.Fields)
+	This.ColumnMapping = getColumnMapping(This.Fields)
+	//假如只有一个主键并且主键自增的情况，找出这个主键最小值和最大值，只支持 无符号的数字。有符号的不支持
+	if len(This.TablePriArr) > 0 {
+		for _, v := range This.Fields {
+			if strings.ToUpper(*v.COLUMN_KEY) == "PRI" && strings.ToLower(*v.EXTRA) == "auto_increment" {
+				This.TablePriKeyMinId, This.TablePriKeyMaxId = GetTablePriKeyMinAndMaxVal(db, This.SchemaName, This.CurrentTableName, *v.COLUMN_NAME, This.Property.Where)
+				This.TablePriKey = *v.COLUMN_NAME
+				break
+			}
+		}
+	}
+	// 重新赋值在界面配置的 LimitOptimize 初始值
+	This.Property.LimitOptimize = This.Property.FirstLimitOptimize
+	// 不能用 BETWEEN 分页的时候, 有主键或者唯一键就用 keyset 分页
+	if This.Property.LimitOptimize == 1 && This.TablePriKeyMaxId == 0 && !isCk {
+		This.TableKeyArr, err = GetTableKeyArr(db, This.SchemaName, This.CurrentTableName, This.Fields)
+		if err != nil {
+			This.LogError(fmt.Sprintf("CurrentTableName:%s get table key error:%+v ", This.CurrentTableName, err))
+		}
+		if len(This.TableKeyArr) > 0 {
+			This.initKeysetRanges(db)
+		}
+	}
+	// 没有主键的情况下,不能使用 between 等方式查询
+	if This.TablePriKey == "" {
+		This.Property.LimitOptimize = 0
+	}
+	// 当总数小于100万的时候的时候，并且自增id 最大值和最小值 差值 的分页数  是 直接 limit 分页数的 2 倍以上的时候，采用常规 limit 分页
+	if This.Property.Where == "" && This.Property.LimitOptimize == 1 && This.TableInfo.TABLE_ROWS <= 1000000 && (This.TablePriKeyMaxId-This.TablePriKeyMinId)/uint64(This.Property.ThreadCountPer) > This.TableInfo.TABLE_ROWS/uint64(This.Property.ThreadCountPer)*2 {
+		log.Println("history", This.DbName, This.SchemaName, This.CurrentTableName, This.ID, " TABLE_ROWS: ", This.TableInfo.TABLE_ROWS, " <= 1000000 ,then transfer LIMIT x,y")
+		This.Property.LimitOptimize = 0
+	}
+	This.initCheckpoint()
+	return
+}
+
+// 断点续传只支持 halfway 和 stoped 状态, 从第一个没有同步完成的表开始, 外面已经加锁
+func (This *History) checkResume() error {
+	switch This.Status {
+	case HISTORY_STATUS_HALFWAY, HISTORY_STATUS_SELECT_STOPED:
+		break
+	default:
+		return fmt.Errorf("status:%s can't resume", This.Status)
+	}
+	// 一致性快照要在同一个快照里拉完所有数据, 不能断点续传
+	if This.Property.Snapshot {
+		return fmt.Errorf("snapshot history can't resume")
+	}
+	for i, table := range This.TableNameArr {
+		table.RLock()
+		done := table.Done
+		table.RUnlock()
+		if !done {
+			This.TableCountSuccess = i
+			return nil
+		}
+	}
+	return fmt.Errorf("all tables are over")
+}
+
+// 主键字段
+func getPriArr(Fields []TableStruct) []string {
+	TablePriArr := make([]string, 0)
+	for _, v := range Fields {
 		if strings.ToUpper(*v.COLUMN_KEY) == "PRI" {
-			This.TablePriArr = append(This.TablePriArr, *v.COLUMN_NAME)
+			TablePriArr = append(TablePriArr, *v.COLUMN_NAME)
 		}
+	}
+	return TablePriArr
+}
+
+// 表字段类型
+func getColumnMapping(Fields []TableStruct) map[string]string {
+	ColumnMapping := make(map[string]string, 0)
+	for _, v := range Fields {
 		var columnMappingType string
 		switch *v.DATA_TYPE {
 		case "tinyint":
@@ -559,28 +716,7 @@ func (This *History) initMetaInfo(db mysql.MysqlConnection) {
 		if v.IS_NULLABLE != nil && *v.IS_NULLABLE != "NO" {
 			columnMappingType = "Nullable(" + columnMappingType + ")"
 		}
-		This.ColumnMapping[*v.COLUMN_NAME] = columnMappingType
+		ColumnMapping[*v.COLUMN_NAME] = columnMappingType
 	}
-	//假如只有一个主键并且主键自增的情况，找出这个主键最小值和最大值，只支持 无符号的数字。有符号的不支持
-	if len(This.TablePriArr) > 0 {
-		for _, v := range This.Fields {
-			if strings.ToUpper(*v.COLUMN_KEY) == "PRI" && strings.ToLower(*v.EXTRA) == "auto_increment" {
-				This.TablePriKeyMinId, This.TablePriKeyMaxId = GetTablePriKeyMinAndMaxVal(db, This.SchemaName, This.CurrentTableName, *v.COLUMN_NAME, This.Property.Where)
-				This.TablePriKey = *v.COLUMN_NAME
-				break
-			}
-		}
-	}
-	// 重新赋值在界面配置的 LimitOptimize 初始值
-	This.Property.LimitOptimize = This.Property.FirstLimitOptimize
-	// 没有主键的情况下,不能使用 between 等方式查询
-	if This.TablePriKey == "" {
-		This.Property.LimitOptimize = 0
-	}
-	// 当总数小于100万的时候的时候，并且自增id 最大值和最小值 差值 的分页数  是 直接 limit 分页数的 2 倍以上的时候，采用常规 limit 分页
-	if This.Property.Where == "" && This.Property.LimitOptimize == 1 && This.TableInfo.TABLE_ROWS <= 1000000 && (This.TablePriKeyMaxId-This.TablePriKeyMinId)/uint64(This.Property.ThreadCountPer) > This.TableInfo.TABLE_ROWS/uint64(This.Property.ThreadCountPer)*2 {
-		log.Println("history", This.DbName, This.SchemaName, This.CurrentTableName, This.ID, " TABLE_ROWS: ", This.TableInfo.TABLE_ROWS, " <= 1000000 ,then transfer LIMIT x,y")
-		This.Property.LimitOptimize = 0
-	}
-	return
+	return ColumnMapping
 }
@@ -0,0 +1,337 @@
+package history
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/brokercap/Bifrost/Bristol/mysql"
+)
+
+// 没有自增数字主键的时候(复合主键, uuid 等), 按主键或者唯一键 keyset 分页
+// WHERE (a,b) > (?,?) ORDER BY a,b LIMIT n, 不会像 LIMIT x,y 那样越往后越慢
+// 拉取之前先按 ThreadNum 采样分割点, 每个区间 (lower, upper] 互不重叠, 多个协程可以并行拉取
+
+type keysetRange struct {
+	lower   []interface{} // 上一次拉取的最后一条数据的键值, 不包含, nil 为从头开始
+	upper   []interface{} // 区间结束的键值, 包含, nil 为一直到最后
+	running bool          // 有协程正在拉取
+	done    bool
+	index   int // 在 TableStatus.KeysetRanges 里的下标
+}
+
+type indexColumn struct {
+	IndexName  string
+	ColumnName string
+}
+
+// 主键或者唯一键的字段, 优先用主键, 唯一键的字段都不能为 NULL
+func getKeyArr(indexList []indexColumn, Fields []TableStruct) []string {
+	nullableMap := make(map[string]bool, 0)
+	for _, v := range Fields {
+		nullableMap[*v.COLUMN_NAME] = v.IS_NULLABLE != nil && *v.IS_NULLABLE != "NO"
+	}
+	var keyArr []string
+	var indexName string
+	var nullable bool
+	for _, v := range indexList {
+		if v.IndexName != indexName {
+			if len(keyArr) > 0 && !nullable {
+				return keyArr
+			}
+			indexName = v.IndexName
+			keyArr = make([]string, 0)
+			nullable = false
+		}
+		keyArr = append(keyArr, v.ColumnName)
+		if nullableMap[v.ColumnName] {
+			nullable = true
+		}
+	}
+	if len(keyArr) > 0 && !nullable {
+		return keyArr
+	}
+	return nil
+}
+
+func GetTableKeyArr(db mysql.MysqlConnection, schema, table string, Fields []TableStruct) ([]string, error) {
+	sql := "SELECT `INDEX_NAME`,`COLUMN_NAME` FROM `information_schema`.`STATISTICS` WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND NON_UNIQUE = 0 ORDER BY `INDEX_NAME` = 'PRIMARY' DESC,`INDEX_NAME`,`SEQ_IN_INDEX`"
+	rows, err := db.Query(sql, []driver.Value{schema, table})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	indexList := make([]indexColumn, 0)
+	for {
+		dest := make([]driver.Value, 2, 2)
+		if err := rows.Next(dest); err != nil {
+			break
+		}
+		indexList = append(indexList, indexColumn{IndexName: fmt.Sprint(dest[0]), ColumnName: fmt.Sprint(dest[1])})
+	}
+	return getKeyArr(indexList, Fields), nil
+}
+
+// 按键值顺序分页, lower 不包含, upper 包含, limit <= 0 不限制条数
+func keysetSql(SchemaName, TableName string, KeyArr []string, lower, upper []interface{}, where string, limit int) (string, []driver.Value) {
+	keyFields := make([]string, len(KeyArr))
+	for i, name := range KeyArr {
+		keyFields[i] = "`" + name + "`"
+	}
+	sql := "SELECT * FROM `" + SchemaName + "`.`" + TableName + "`"
+	whereSql, args := keysetWhere(KeyArr, lower, upper, where)
+	if whereSql != "" {
+		sql += " WHERE " + whereSql
+	}
+	sql += " ORDER BY " + strings.Join(keyFields, ",")
+	if limit > 0 {
+		sql += " LIMIT " + strconv.Itoa(limit)
+	}
+	return sql, args
+}
+
+// (a,b) > (?,?) AND (a,b) <= (?,?) 的区间条件
+func keysetWhere(KeyArr []string, lower, upper []interface{}, where string) (string, []driver.Value) {
+	keyFields := make([]string, len(KeyArr))
+	for i, name := range KeyArr {
+		keyFields[i] = "`" + name + "`"
+	}
+	keys := "(" + strings.Join(keyFields, ",") + ")"
+	placeholders := "(" + strings.TrimRight(strings.Repeat("?,", len(KeyArr)), ",") + ")"
+	whereArr := make([]string, 0, 3)
+	args := make([]driver.Value, 0, len(lower)+len(upper))
+	if len(lower) == len(KeyArr) {
+		whereArr = append(whereArr, keys+" > "+placeholders)
+		for _, v := range lower {
+			args = append(args, v)
+		}
+	}
+	if len(upper) == len(KeyArr) {
+		whereArr = append(whereArr, keys+" <= "+placeholders)
+		for _, v := range upper {
+			args = append(args, v)
+		}
+	}
+	if where != "" {
+		whereArr = append(whereArr, "("+where+")")
+	}
+	return strings.Join(whereArr, " AND "), args
+}
+
+// 按表的行数估算值, 采样 ThreadNum-1 个分割点, 切成 ThreadNum 个区间
+func (This *History) initKeysetRanges(db mysql.MysqlConnection) {
+	keyFields := make([]string, len(This.TableKeyArr))
+	for i, name := range This.TableKeyArr {
+		keyFields[i] = "`" + name + "`"
+	}
+	sql := "SELECT " + strings.Join(keyFields, ",") + " FROM `" + This.SchemaName + "`.`" + This.CurrentTableName + "`"
+	if This.Property.Where != "" {
+		sql += " WHERE " + This.Property.Where
+	}
+	sql += " ORDER BY " + strings.Join(keyFields, ",")
+	This.keysetRanges = make([]*keysetRange, 0, This.Property.ThreadNum)
+	var lower []interface{}
+	for i := 1; i < This.Property.ThreadNum; i++ {
+		offset := This.TableInfo.TABLE_ROWS * uint64(i) / uint64(This.Property.ThreadNum)
+		if offset == 0 {
+			continue
+		}
+		upper := This.getKeysetSplitPoint(db, sql+" LIMIT "+strconv.FormatUint(offset, 10)+",1")
+		if upper == nil {
+			break
+		}
+		if lower != nil && fmt.Sprint(lower) == fmt.Sprint(upper) {
+			continue
+		}
+		This.keysetRanges = append(This.keysetRanges, &keysetRange{lower: lower, upper: upper})
+		lower = upper
+	}
+	This.keysetRanges = append(This.keysetRanges, &keysetRange{lower: lower})
+	log.Println("history", This.DbName, This.SchemaName, This.CurrentTableName, This.ID, " keyset:", This.TableKeyArr, " ranges:", len(This.keysetRanges))
+}
+
+func (This *History) getKeysetSplitPoint(db mysql.MysqlConnection, sql string) []interface{} {
+	rows, err := db.Query(sql, []driver.Value{})
+	if err != nil {
+		This.LogError(fmt.Sprintf("CurrentTableName:%s keyset split point err:%+v", This.CurrentTableName, err))
+		return nil
+	}
+	defer rows.Close()
+	dest := make([]driver.Value, len(This.TableKeyArr), len(This.TableKeyArr))
+	if err = rows.Next(dest); err != nil {
+		return nil
+	}
+	return toInterfaceArr(dest)
+}
+
+func (This *History) isKeyset() bool {
+	This.RLock()
+	defer This.RUnlock()
+	return len(This.keysetRanges) > 0
+}
+
+// 取一个没有协程在拉取的区间, 返回这个区间的下一页
+func (This *History) GetNextKeysetSql() (sql string, args []driver.Value, r *keysetRange) {
+	This.Lock()
+	defer This.Unlock()
+	for _, v := range This.keysetRanges {
+		if v.running || v.done {
+			continue
+		}
+		v.running = true
+		sql, args = keysetSql(This.SchemaName, This.CurrentTableName, This.TableKeyArr, v.lower, v.upper, This.Property.Where, This.Property.ThreadCountPer)
+		return sql, args, v
+	}
+	return "", nil, nil
+}
+
+// 一页拉取完, lastKey 为这一页最后一条数据的键值, 不满一页说明区间拉完了
+// commit 标记要在区间释放之前写入队列, 同一个区间的进度才是按顺序完成的
+func (This *History) keysetSelected(r *keysetRange, lastKey []interface{}, rowCount int) {
+	waits := This.sendChunkMarker()
+	This.Lock()
+	defer This.Unlock()
+	r.running = false
+	if rowCount < This.Property.ThreadCountPer || lastKey == nil {
+		r.done = true
+	} else {
+		r.lower = lastKey
+	}
+	table := This.currentTableStatus()
+	if table == nil {
+		return
+	}
+	lower, err := encodeKeysetKey(r.lower)
+	if err != nil {
+		This.LogError(fmt.Sprintf("CurrentTableName:%s keyset checkpoint err:%+v", This.CurrentTableName, err))
+		return
+	}
+	This.pendingChunks = append(This.pendingChunks, &historyChunk{
+		table:       table,
+		waits:       waits,
+		keyset:      true,
+		keysetIndex: r.index,
+		keysetLower: lower,
+		keysetDone:  r.done,
+	})
+}
+
+// 键值编码成字符串保存到进度里, 每个值带上类型, 恢复之后拼出来的 sql 和原来一样
+// 不是 utf8 的字符串用 hex 编码
+func encodeKeysetKey(key []interface{}) (string, error) {
+	if key == nil {
+		return "", nil
+	}
+	arr := make([]*string, len(key))
+	for i, v := range key {
+		var s string
+		switch val := v.(type) {
+		case nil:
+			continue
+		case bool:
+			if val {
+				s = "b1"
+			} else {
+				s = "b0"
+			}
+		case int8, int16, int32, int64, int:
+			s = "i" + fmt.Sprint(val)
+		case uint8, uint16, uint32, uint64, uint:
+			s = "u" + fmt.Sprint(val)
+		case float32:
+			s = "f" + strconv.FormatFloat(float64(val), 'g', -1, 64)
+		case float64:
+			s = "f" + strconv.FormatFloat(val, 'g', -1, 64)
+		case string:
+			s = encodeKeysetString(val)
+		case []byte:
+			s = encodeKeysetString(string(val))
+		case time.Time:
+			s = "s" + val.Format("2006-01-02 15:04:05.999999")
+		default:
+			return "", fmt.Errorf("keyset key type:%T not supported", v)
+		}
+		arr[i] = &s
+	}
+	b, err := json.Marshal(arr)
+	return string(b), err
+}
+
+func encodeKeysetString(s string) string {
+	if utf8.ValidString(s) {
+		return "s" + s
+	}
+	return "x" + hex.EncodeToString([]byte(s))
+}
+
+func decodeKeysetKey(s string) ([]interface{}, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var arr []*string
+	if err := json.Unmarshal([]byte(s), &arr); err != nil {
+		return nil, err
+	}
+	key := make([]interface{}, len(arr))
+	for i, v := range arr {
+		if v == nil {
+			continue
+		}
+		if *v == "" {
+			return nil, fmt.Errorf("keyset key:%s error", s)
+		}
+		var err error
+		val := (*v)[1:]
+		switch (*v)[0] {
+		case 'b':
+			key[i] = val == "1"
+		case 'i':
+			key[i], err = strconv.ParseInt(val, 10, 64)
+		case 'u':
+			key[i], err = strconv.ParseUint(val, 10, 64)
+		case 'f':
+			key[i], err = strconv.ParseFloat(val, 64)
+		case 's':
+			key[i] = val
+		case 'x':
+			key[i], err = hex.DecodeString(val)
+		default:
+			err = fmt.Errorf("keyset key:%s error", s)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// 键值字段在 Fields 里的下标
+func (This *History) keyIndexArr() []int {
+	indexArr := make([]int, 0, len(This.TableKeyArr))
+	for _, name := range This.TableKeyArr {
+		for i, v := range This.Fields {
+			if *v.COLUMN_NAME == name {
+				indexArr = append(indexArr, i)
+				break
+			}
+		}
+	}
+	return indexArr
+}
+
+func toInterfaceArr(values []driver.Value) []interface{} {
+	if values == nil {
+		return nil
+	}
+	arr := make([]interface{}, len(values))
+	for i, v := range values {
+		arr[i] = v
+	}
+	return arr
+}
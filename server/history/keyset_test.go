@@ -0,0 +1,167 @@
+package history
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/brokercap/Bifrost/server"
+)
+
+func TestKeysetSql(t *testing.T) {
+	Convey("range with lower and upper", t, func() {
+		sql, args := keysetSql("bifrost_test", "binlog_field_test", []string{"tenant_id", "uuid"}, []interface{}{int64(1), "a"}, []interface{}{int64(3), "c"}, "status=1", 1000)
+		So(sql, ShouldEqual, "SELECT * FROM `bifrost_test`.`binlog_field_test` WHERE (`tenant_id`,`uuid`) > (?,?) AND (`tenant_id`,`uuid`) <= (?,?) AND (status=1) ORDER BY `tenant_id`,`uuid` LIMIT 1000")
+		So(args, ShouldResemble, []driver.Value{int64(1), "a", int64(3), "c"})
+	})
+
+	Convey("first range", t, func() {
+		sql, args := keysetSql("bifrost_test", "binlog_field_test", []string{"uuid"}, nil, []interface{}{"c"}, "", 1000)
+		So(sql, ShouldEqual, "SELECT * FROM `bifrost_test`.`binlog_field_test` WHERE (`uuid`) <= (?) ORDER BY `uuid` LIMIT 1000")
+		So(args, ShouldResemble, []driver.Value{"c"})
+	})
+
+	Convey("last range without limit", t, func() {
+		sql, args := keysetSql("bifrost_test", "binlog_field_test", []string{"uuid"}, []interface{}{"c"}, nil, "", 0)
+		So(sql, ShouldEqual, "SELECT * FROM `bifrost_test`.`binlog_field_test` WHERE (`uuid`) > (?) ORDER BY `uuid`")
+		So(args, ShouldResemble, []driver.Value{"c"})
+	})
+}
+
+func TestGetKeyArr(t *testing.T) {
+	newField := func(name, nullable string) TableStruct {
+		return TableStruct{COLUMN_NAME: &name, IS_NULLABLE: &nullable}
+	}
+	Fields := []TableStruct{newField("tenant_id", "NO"), newField("uuid", "NO"), newField("email", "YES"), newField("code", "NO")}
+
+	Convey("primary key first", t, func() {
+		indexList := []indexColumn{{"PRIMARY", "tenant_id"}, {"PRIMARY", "uuid"}, {"uk_code", "code"}}
+		So(getKeyArr(indexList, Fields), ShouldResemble, []string{"tenant_id", "uuid"})
+	})
+
+	Convey("skip nullable unique key", t, func() {
+		indexList := []indexColumn{{"uk_email", "email"}, {"uk_email", "tenant_id"}, {"uk_code", "code"}}
+		So(getKeyArr(indexList, Fields), ShouldResemble, []string{"code"})
+		So(getKeyArr(indexList[:2], Fields), ShouldBeNil)
+	})
+}
+
+func TestHistory_GetNextKeysetSql(t *testing.T) {
+	Convey("each range is pulled by one thread", t, func() {
+		historyObj := &History{
+			SchemaName:       "bifrost_test",
+			CurrentTableName: "binlog_field_test",
+			TableKeyArr:      []string{"uuid"},
+			Property:         HistoryProperty{ThreadNum: 2, ThreadCountPer: 2},
+			keysetRanges: []*keysetRange{
+				{upper: []interface{}{"m"}},
+				{lower: []interface{}{"m"}},
+			},
+		}
+		sql1, _, r1 := historyObj.GetNextKeysetSql()
+		So(sql1, ShouldContainSubstring, "(`uuid`) <= (?)")
+		sql2, _, r2 := historyObj.GetNextKeysetSql()
+		So(sql2, ShouldContainSubstring, "(`uuid`) > (?)")
+		sql, _, _ := historyObj.GetNextKeysetSql()
+		So(sql, ShouldEqual, "")
+
+		// 满一页, 从最后一条继续
+		historyObj.keysetSelected(r1, []interface{}{"b"}, 2)
+		sql, args, r := historyObj.GetNextKeysetSql()
+		So(r, ShouldEqual, r1)
+		So(args, ShouldResemble, []driver.Value{"b", "m"})
+
+		historyObj.keysetSelected(r, []interface{}{"c"}, 1)
+		historyObj.keysetSelected(r2, nil, 0)
+		So(r1.done && r2.done, ShouldBeTrue)
+		sql, _, _ = historyObj.GetNextKeysetSql()
+		So(sql, ShouldEqual, "")
+	})
+}
+
+func TestEncodeKeysetKey(t *testing.T) {
+	Convey("encode and decode keep value type", t, func() {
+		key := []interface{}{int32(-1), uint64(18446744073709551615), int64(9007199254740993), float32(1.5), true, "a,\"b\"", string([]byte{0xff, 0x00}), nil}
+		s, err := encodeKeysetKey(key)
+		So(err, ShouldBeNil)
+		decoded, err := decodeKeysetKey(s)
+		So(err, ShouldBeNil)
+		So(decoded, ShouldResemble, []interface{}{int64(-1), uint64(18446744073709551615), int64(9007199254740993), float64(1.5), true, "a,\"b\"", []byte{0xff, 0x00}, nil})
+
+		s, err = encodeKeysetKey(nil)
+		So(s, ShouldEqual, "")
+		decoded, err = decodeKeysetKey(s)
+		So(err, ShouldBeNil)
+		So(decoded, ShouldBeNil)
+
+		_, err = encodeKeysetKey([]interface{}{struct{}{}})
+		So(err, ShouldNotBeNil)
+		_, err = decodeKeysetKey(`["z1"]`)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestHistory_keysetResume(t *testing.T) {
+	Convey("resume keyset ranges from checkpoint", t, func() {
+		toServerObj := &toServer{ToServerInfo: &server.ToServer{}}
+		table := &TableStatus{TableName: "binlog_field_test"}
+		newHistory := func() *History {
+			return &History{
+				SchemaName:       "bifrost_test",
+				CurrentTableName: "binlog_field_test",
+				TableKeyArr:      []string{"tenant_id", "uuid"},
+				TableNameArr:     []*TableStatus{table},
+				ToServerList:     []*toServer{toServerObj},
+				Property:         HistoryProperty{ThreadNum: 2, ThreadCountPer: 2},
+				keysetRanges: []*keysetRange{
+					{upper: []interface{}{int64(2), "m"}},
+					{lower: []interface{}{int64(2), "m"}},
+				},
+			}
+		}
+		historyObj := newHistory()
+		historyObj.initCheckpoint()
+		So(len(table.KeysetRanges), ShouldEqual, 2)
+		So(table.KeysetRanges[0].Lower, ShouldEqual, "")
+
+		// 第一个区间拉了一页, 第二个区间拉完
+		_, _, r1 := historyObj.GetNextKeysetSql()
+		_, _, r2 := historyObj.GetNextKeysetSql()
+		historyObj.keysetSelected(r1, []interface{}{int64(1), "b"}, 2)
+		historyObj.keysetSelected(r2, nil, 0)
+		So(historyObj.checkpoint(), ShouldBeFalse)
+
+		<-toServerObj.ToServerInfo.ToServerChan.To
+		marker := <-toServerObj.ToServerInfo.ToServerChan.To
+		toServerObj.ToServerInfo.LastSuccessBinlog = &server.PositionStruct{EventID: marker.EventID}
+		So(historyObj.checkpoint(), ShouldBeTrue)
+
+		b, err := json.Marshal(table.checkpoint())
+		So(err, ShouldBeNil)
+		var data TableCheckpoint
+		So(json.Unmarshal(b, &data), ShouldBeNil)
+		table = &TableStatus{TableName: data.TableName, KeysetKeyArr: data.KeysetKeyArr, KeysetRanges: data.KeysetRanges}
+
+		// 重启之后从保存的键值继续拉取
+		job := newHistory()
+		job.resume = true
+		job.initCheckpoint()
+		So(job.keysetRanges[1].done, ShouldBeTrue)
+		sql, args, r := job.GetNextKeysetSql()
+		So(r, ShouldEqual, job.keysetRanges[0])
+		So(sql, ShouldContainSubstring, "(`tenant_id`,`uuid`) > (?,?) AND (`tenant_id`,`uuid`) <= (?,?)")
+		So(args, ShouldResemble, []driver.Value{int64(1), "b", int64(2), "m"})
+		sql, _, _ = job.GetNextKeysetSql()
+		So(sql, ShouldEqual, "")
+
+		// 键值字段变了, 从头开始
+		job = newHistory()
+		job.TableKeyArr = []string{"uuid"}
+		job.resume = true
+		job.initCheckpoint()
+		So(table.KeysetKeyArr, ShouldResemble, []string{"uuid"})
+		So(table.KeysetRanges[1].Done, ShouldBeFalse)
+	})
+}
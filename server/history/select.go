@@ -35,16 +35,18 @@ func (This *History) threadStart(i int, wg *sync.WaitGroup) {
 		NowStartI: 0,
 	}
 	This.Unlock()
-	db := DBConnect(This.Uri)
-	defer func() {
+	db, snapshot := This.getSelectConn(i)
+	if !snapshot {
 		defer func() {
-			if err := recover(); err != nil {
-				return
-			}
+			defer func() {
+				if err := recover(); err != nil {
+					return
+				}
+			}()
+			db.Close()
 		}()
-		db.Close()
-	}()
-	db.Exec("SET NAMES utf8mb4", []driver.Value{})
+		db.Exec("SET NAMES utf8mb4", []driver.Value{})
+	}
 	This.initMetaInfo(db)
 	if len(This.Fields) == 0 {
 		This.ThreadPool[i].Error = fmt.Errorf("Fields empty,%s %s %s "+This.DbName, This.SchemaName, This.TableName, " Current Select Table:", This.CurrentTableName)
@@ -59,6 +61,11 @@ func (This *History) threadStart(i int, wg *sync.WaitGroup) {
 	var start uint64
 	var sql string
 	var rowCount int
+	var args []driver.Value
+	var keyRange *keysetRange
+	var lastKey []interface{}
+	keyset := This.isKeyset()
+	keyIndexArr := This.keyIndexArr()
 	// 每次循环之前先累加一次，再清空统计,待协程退出的时候 ，再累加一次，这样可以避免中途退出的情况
 	// 这里为什么用 闭合函数,假如放在 history 对象里，每次通过 This.TableNameArr[This.TableCountSuccess] 去获取 Table ,可能存在问题的，因为 defer 存在一定概率是在下一个表查询的时候执行呢
 	StatusTable := This.TableNameArr[This.TableCountSuccess]
@@ -80,14 +87,19 @@ func (This *History) threadStart(i int, wg *sync.WaitGroup) {
 			break
 		}
 		This.RUnlock()
-		sql, start = This.GetNextSql()
+		if keyset {
+			sql, args, keyRange = This.GetNextKeysetSql()
+		} else {
+			sql, start = This.GetNextSql()
+			args = make([]driver.Value, 0)
+		}
 		//log.Println(sql)
 		if sql == "" {
 			break
 		}
 		This.ThreadPool[i].NowStartI = start
-		p := make([]driver.Value, 0)
-		rows, err := db.Query(sql, p)
+		lastKey = nil
+		rows, err := db.Query(sql, args)
 		if err != nil {
 			log.Println("history select threadStart err:", err, "sql:", sql, This.DbName, This.SchemaName, This.TableName, This.CurrentTableName)
 			This.ThreadPool[i].Error = err
@@ -109,67 +121,14 @@ func (This *History) threadStart(i int, wg *sync.WaitGroup) {
 				break
 			}
 			rowCount++
-			m := make(map[string]interface{}, n)
-			sizeCount := int64(0)
-			for i, v := range This.Fields {
-				if dest[i] == nil {
-					m[*v.COLUMN_NAME] = dest[i]
-					continue
+			if keyset {
+				// 用原始的值做下一页的条件, 不能用转换之后的
+				lastKey = make([]interface{}, len(keyIndexArr))
+				for k, index := range keyIndexArr {
+					lastKey[k] = dest[index]
 				}
-				switch *v.DATA_TYPE {
-				case "set":
-					m[*v.COLUMN_NAME] = strings.Split(dest[i].(string), ",")
-					break
-				case "tinyint":
-					if *v.COLUMN_TYPE == "tinyint(1)" {
-						switch fmt.Sprint(dest[i]) {
-						case "1":
-							m[*v.COLUMN_NAME] = true
-							break
-						case "0":
-							m[*v.COLUMN_NAME] = false
-							break
-						default:
-							m[*v.COLUMN_NAME] = dest[i]
-							break
-						}
-					} else {
-						m[*v.COLUMN_NAME] = dest[i]
-					}
-					break
-				case "json":
-					var d interface{}
-					json.Unmarshal([]byte(dest[i].(string)), &d)
-					m[*v.COLUMN_NAME] = d
-					break
-				case "timestamp", "datetime", "time":
-					if v.Fsp == 0 {
-						m[*v.COLUMN_NAME] = dest[i]
-						break
-					}
-					val := dest[i].(string)
-					i := strings.Index(val, ".")
-					if i < 0 {
-						m[*v.COLUMN_NAME] = val + "." + fmt.Sprintf("%0*d", v.Fsp, 0)
-						break
-					}
-					n := len(val[i+1:])
-					if n == v.Fsp {
-						m[*v.COLUMN_NAME] = val
-						break
-					}
-					if n < v.Fsp {
-						m[*v.COLUMN_NAME] = val + fmt.Sprintf("%0*d", v.Fsp-n, 0)
-					} else {
-						m[*v.COLUMN_NAME] = val[0 : len(val)-n+v.Fsp]
-					}
-
-				default:
-					m[*v.COLUMN_NAME] = dest[i]
-					break
-				}
-				sizeCount += int64(unsafe.Sizeof(m[*v.COLUMN_NAME]))
 			}
+			m, sizeCount := fieldsToRow(This.Fields, dest)
 			if len(m) == 0 {
 				return
 			}
@@ -198,6 +157,11 @@ func (This *History) threadStart(i int, wg *sync.WaitGroup) {
 			}
 		}
 		rows.Close()
+		if keyset {
+			This.keysetSelected(keyRange, lastKey, rowCount)
+			continue
+		}
+		This.chunkSelected(start)
 
 		if (This.Property.LimitOptimize == 0 || This.TablePriKeyMaxId == 0) && rowCount < This.Property.ThreadCountPer {
 			runtime.Goexit()
@@ -206,6 +170,71 @@ func (This *History) threadStart(i int, wg *sync.WaitGroup) {
 	runtime.Goexit()
 }
 
+// 按字段类型把一行查询结果转换成同步的数据格式
+func fieldsToRow(Fields []TableStruct, dest []driver.Value) (m map[string]interface{}, sizeCount int64) {
+	m = make(map[string]interface{}, len(Fields))
+	for i, v := range Fields {
+		if dest[i] == nil {
+			m[*v.COLUMN_NAME] = dest[i]
+			continue
+		}
+		switch *v.DATA_TYPE {
+		case "set":
+			m[*v.COLUMN_NAME] = strings.Split(dest[i].(string), ",")
+			break
+		case "tinyint":
+			if *v.COLUMN_TYPE == "tinyint(1)" {
+				switch fmt.Sprint(dest[i]) {
+				case "1":
+					m[*v.COLUMN_NAME] = true
+					break
+				case "0":
+					m[*v.COLUMN_NAME] = false
+					break
+				default:
+					m[*v.COLUMN_NAME] = dest[i]
+					break
+				}
+			} else {
+				m[*v.COLUMN_NAME] = dest[i]
+			}
+			break
+		case "json":
+			var d interface{}
+			json.Unmarshal([]byte(dest[i].(string)), &d)
+			m[*v.COLUMN_NAME] = d
+			break
+		case "timestamp", "datetime", "time":
+			if v.Fsp == 0 {
+				m[*v.COLUMN_NAME] = dest[i]
+				break
+			}
+			val := dest[i].(string)
+			i := strings.Index(val, ".")
+			if i < 0 {
+				m[*v.COLUMN_NAME] = val + "." + fmt.Sprintf("%0*d", v.Fsp, 0)
+				break
+			}
+			n := len(val[i+1:])
+			if n == v.Fsp {
+				m[*v.COLUMN_NAME] = val
+				break
+			}
+			if n < v.Fsp {
+				m[*v.COLUMN_NAME] = val + fmt.Sprintf("%0*d", v.Fsp-n, 0)
+			} else {
+				m[*v.COLUMN_NAME] = val[0 : len(val)-n+v.Fsp]
+			}
+
+		default:
+			m[*v.COLUMN_NAME] = dest[i]
+			break
+		}
+		sizeCount += int64(unsafe.Sizeof(m[*v.COLUMN_NAME]))
+	}
+	return
+}
+
 func (This *History) sendToServerResult(pluginData *pluginDriver.PluginDataType) {
 	for _, toServer := range This.ToServerList {
 		ToServerInfo := toServer.ToServerInfo
@@ -252,6 +281,13 @@ func (This *History) GetNextSql() (sql string, start uint64) {
 	This.Lock()
 	defer This.Unlock()
 	var where string = ""
+	This.skipCompletedChunk()
+	from := This.NowStartI
+	defer func() {
+		if sql != "" {
+			This.addRunningChunk(start, from, This.NowStartI)
+		}
+	}()
 	if This.Property.LimitOptimize == 0 || This.TablePriKeyMaxId == 0 {
 		if This.Property.Where != "" {
 			where = " WHERE " + This.Property.Where
@@ -0,0 +1,67 @@
+package history
+
+// shard 模式下数据源迁移的时候, 全量, 增量快照, 校验任务跟着数据源一起迁移
+// 迁出的时候只停止并从内存里移除, 不修改存储里的状态, 迁入的节点按存储里的状态恢复
+
+// 数据源分配到当前节点, 恢复这个数据源的任务
+func RecoveryDb(dbName string) {
+	recoveryHistoryByPrefix(HISTORY_KEY_PREFIX + dbName + "|")
+	recoveryIncrementalSnapshotByPrefix(INCREMENTAL_SNAPSHOT_KEY_PREFIX + dbName + "|")
+	recoveryVerifyTaskByPrefix(VERIFY_KEY_PREFIX + dbName + "|")
+}
+
+// 数据源迁移到别的节点, 停止这个数据源的任务
+func UnloadDb(dbName string) {
+	unloadHistory(dbName)
+	unloadIncrementalSnapshot(dbName)
+	unloadVerifyTask(dbName)
+}
+
+func unloadHistory(dbName string) {
+	l.Lock()
+	jobs := historyMap[dbName]
+	delete(historyMap, dbName)
+	l.Unlock()
+	for _, job := range jobs {
+		_ = deleteCrond(job)
+		job.Lock()
+		// 存储里是 running 的, 迁入的节点恢复成 halfway, 可以继续拉取
+		if job.Status == HISTORY_STATUS_RUNNING {
+			job.Status = HISTORY_STATUS_SELECT_STOPING
+		}
+		job.Unlock()
+	}
+}
+
+func unloadIncrementalSnapshot(dbName string) {
+	incrementalSnapshotLock.Lock()
+	tasks := incrementalSnapshotMap[dbName]
+	delete(incrementalSnapshotMap, dbName)
+	incrementalSnapshotLock.Unlock()
+	for _, task := range tasks {
+		task.Lock()
+		// killed 状态退出的时候不保存, 迁入的节点按 running 继续
+		if task.Status == INCREMENTAL_SNAPSHOT_STATUS_RUNNING || task.Status == INCREMENTAL_SNAPSHOT_STATUS_STOPING {
+			task.Status = INCREMENTAL_SNAPSHOT_STATUS_KILLED
+		}
+		task.Unlock()
+	}
+}
+
+func unloadVerifyTask(dbName string) {
+	verifyLock.Lock()
+	tasks := verifyMap[dbName]
+	delete(verifyMap, dbName)
+	verifyLock.Unlock()
+	for _, task := range tasks {
+		task.Lock()
+		if task.cronEntryID > 0 {
+			crodObj.Remove(task.cronEntryID)
+			task.cronEntryID = 0
+		}
+		if task.Status == VERIFY_STATUS_RUNNING {
+			task.Status = VERIFY_STATUS_STOPING
+		}
+		task.Unlock()
+	}
+}
@@ -0,0 +1,218 @@
+package history
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brokercap/Bifrost/Bristol/mysql"
+	"github.com/brokercap/Bifrost/server"
+)
+
+// 一致性快照模式
+// 1. 暂停 ToServerIDList 对应的增量同步配置, 增量数据先堆积在队列里
+// 2. 加全局读锁(没有 RELOAD 权限的时候退化成给要拉取的表加读锁), 每个拉数据的连接开启一致性快照事务, 读取当前 binlog 位点, 解锁
+// 3. 在快照事务里拉取全量数据
+// 4. 全量同步完成之后, 启动增量同步配置, 小于等于快照位点的数据跳过, 之后的数据正常同步, 不丢也不重复
+
+// 一致性快照只支持 mysql
+func CheckSnapshot(dbName string) error {
+	dbInfo := server.GetDbInfo(dbName)
+	if dbInfo == nil {
+		return fmt.Errorf("%s not exist", dbName)
+	}
+	if dbInfo.InputType != "mysql" {
+		return fmt.Errorf("DbName: %s Input: %s Snapshot is not supported", dbName, dbInfo.InputType)
+	}
+	return nil
+}
+
+// 全量对应的增量同步配置
+func (This *History) getFollowToServerList() []*server.ToServer {
+	list := make([]*server.ToServer, 0)
+	dbObj := server.GetDBObj(This.DbName)
+	if dbObj == nil {
+		return list
+	}
+	t := dbObj.GetTableSelf(This.SchemaName, This.TableName)
+	if t == nil {
+		return list
+	}
+	for _, toServerInfo := range t.ToServerList {
+		for _, ID := range This.ToServerIDList {
+			if ID == toServerInfo.ToServerID {
+				list = append(list, toServerInfo)
+				break
+			}
+		}
+	}
+	return list
+}
+
+// 暂停增量同步配置, 并且等到消费协程真正停下来
+// 防止建立快照之后, 还在处理中的增量数据比全量数据先写入目标端
+func (This *History) stopFollowToServer() error {
+	for {
+		stopped := true
+		for _, toServerInfo := range This.getFollowToServerList() {
+			toServerInfo.Stop()
+			if toServerInfo.GetStatus() != server.STOPPED {
+				stopped = false
+			}
+		}
+		if stopped {
+			return nil
+		}
+		This.RLock()
+		status := This.Status
+		This.RUnlock()
+		switch status {
+		case HISTORY_STATUS_KILLED, HISTORY_STATUS_SELECT_STOPING:
+			return fmt.Errorf("history is %s", status)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// 全量同步完成, 增量同步配置从快照位点之后开始同步
+func (This *History) startFollowToServer() {
+	if This.SnapshotPosition == nil {
+		return
+	}
+	This.LogInfo(fmt.Sprintf("snapshot over, start ToServer after position:%+v", *This.SnapshotPosition))
+	for _, toServerInfo := range This.getFollowToServerList() {
+		toServerInfo.Start()
+	}
+}
+
+func (This *History) lockTablesSql() string {
+	tables := make([]string, 0, len(This.TableNameArr))
+	for _, t := range This.TableNameArr {
+		tables = append(tables, "`"+This.SchemaName+"`.`"+t.TableName+"` READ")
+	}
+	return "LOCK TABLES " + strings.Join(tables, ",")
+}
+
+func dbConnect(uri string) (db mysql.MysqlConnection, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("%v", e)
+		}
+	}()
+	db = DBConnect(uri)
+	return
+}
+
+// 建立一致性快照, 每个拉数据协程一个连接
+func (This *History) startSnapshot() (err error) {
+	lockConn, err := dbConnect(This.Uri)
+	if err != nil {
+		return err
+	}
+	defer lockConn.Close()
+	if _, err = lockConn.Exec("FLUSH TABLES WITH READ LOCK", []driver.Value{}); err != nil {
+		This.LogInfo(fmt.Sprintf("FLUSH TABLES WITH READ LOCK err:%s, try LOCK TABLES", err))
+		if _, err = lockConn.Exec(This.lockTablesSql(), []driver.Value{}); err != nil {
+			return fmt.Errorf("lock tables err:%s", err)
+		}
+	}
+	defer lockConn.Exec("UNLOCK TABLES", []driver.Value{})
+	connList := make([]mysql.MysqlConnection, 0, This.Property.ThreadNum)
+	defer func() {
+		if err != nil {
+			for _, conn := range connList {
+				conn.Close()
+			}
+		}
+	}()
+	for i := 0; i < This.Property.ThreadNum; i++ {
+		var conn mysql.MysqlConnection
+		if conn, err = dbConnect(This.Uri); err != nil {
+			return err
+		}
+		connList = append(connList, conn)
+		conn.Exec("SET NAMES utf8mb4", []driver.Value{})
+		if _, err = conn.Exec("SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ", []driver.Value{}); err != nil {
+			return err
+		}
+		if _, err = conn.Exec("START TRANSACTION WITH CONSISTENT SNAPSHOT", []driver.Value{}); err != nil {
+			return err
+		}
+	}
+	position, err := getMasterPosition(lockConn)
+	if err != nil {
+		return err
+	}
+	This.Lock()
+	This.snapshotConnList = connList
+	This.SnapshotPosition = position
+	This.Unlock()
+	This.LogInfo(fmt.Sprintf("snapshot position:%+v", *position))
+	return nil
+}
+
+// 关闭快照连接, 事务随之结束
+func (This *History) closeSnapshot() {
+	This.Lock()
+	connList := This.snapshotConnList
+	This.snapshotConnList = nil
+	This.Unlock()
+	for _, conn := range connList {
+		func() {
+			defer func() {
+				recover()
+			}()
+			conn.Close()
+		}()
+	}
+}
+
+// 拉取数据的连接, 快照模式下用快照连接, 不需要关闭
+func (This *History) getSelectConn(i int) (db mysql.MysqlConnection, snapshot bool) {
+	This.RLock()
+	defer This.RUnlock()
+	if i < len(This.snapshotConnList) {
+		return This.snapshotConnList[i], true
+	}
+	return DBConnect(This.Uri), false
+}
+
+func getMasterPosition(db mysql.MysqlConnection) (*server.PositionStruct, error) {
+	rows, err := db.Query("SHOW MASTER STATUS", []driver.Value{})
+	if err != nil {
+		// mysql 8.4 之后改名了
+		rows, err = db.Query("SHOW BINARY LOG STATUS", []driver.Value{})
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer rows.Close()
+	dest := make([]driver.Value, 5, 5)
+	if err = rows.Next(dest); err != nil {
+		return nil, fmt.Errorf("show master status err:%v, binlog is not enabled?", err)
+	}
+	return parseMasterPosition(fmt.Sprint(dest[0]), fmt.Sprint(dest[1]), dest[4])
+}
+
+// mysql-bin.000003 , 154 => BinlogFileNum:3 BinlogPosition:154
+func parseMasterPosition(file, position string, gtid interface{}) (*server.PositionStruct, error) {
+	i := strings.LastIndex(file, ".")
+	if i < 0 {
+		return nil, fmt.Errorf("binlog file:%s error", file)
+	}
+	fileNum, err := strconv.Atoi(file[i+1:])
+	if err != nil {
+		return nil, fmt.Errorf("binlog file:%s error", file)
+	}
+	pos, err := strconv.ParseUint(position, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("binlog position:%s error", position)
+	}
+	p := &server.PositionStruct{BinlogFileNum: fileNum, BinlogPosition: uint32(pos)}
+	if gtid != nil {
+		p.GTID = strings.Replace(fmt.Sprint(gtid), "\n", "", -1)
+	}
+	return p, nil
+}
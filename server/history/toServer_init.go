@@ -24,6 +24,7 @@ func (This *History) InitToServer() {
 					FilterQuery:        toServerInfo.FilterQuery,
 					FilterUpdate:       toServerInfo.FilterUpdate,
 					FieldList:          toServerInfo.FieldList,
+					Transforms:         toServerInfo.Transforms,
 					ToServerKey:        toServerInfo.ToServerKey,
 					BinlogFileNum:      toServerInfo.BinlogFileNum,
 					BinlogPosition:     toServerInfo.BinlogPosition,
@@ -68,6 +69,7 @@ func (This *History) SyncWaitToServerOver(n int) {
 				break
 			default:
 				This.Status = HISTORY_STATUS_OVER
+				This.startFollowToServer()
 				break
 			}
 		}()
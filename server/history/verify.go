@@ -0,0 +1,847 @@
+package history
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"github.com/brokercap/Bifrost/Bristol/mysql"
+	"github.com/brokercap/Bifrost/config"
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	pluginStorage "github.com/brokercap/Bifrost/plugin/storage"
+	"github.com/brokercap/Bifrost/server"
+)
+
+// 源表和同步配置的目标表数据一致性校验
+// 按主键(或者唯一键)分区间, 每个区间先在两边的库里计算 行数 + CRC32 聚合值, 不一致再把数据拉回来逐行比较, 找出不一致的数据
+// 校验过程中 binlog 里有变更的数据, 两边不一样有可能只是增量还没同步, 不算不一致
+// 可以选择通过同步配置的插件修复: 修复之前重新查询源表, 源表有的数据按源表 insert, 源表已经没有的数据才 delete
+// 修复数据用的是同步配置的副本, 不进入增量队列, 不影响增量的延迟及告警统计
+
+const VERIFY_KEY_PREFIX = "bifrost_verify_"
+
+// 每个任务最多保留的不一致数据条数
+const VERIFY_MAX_DIFF_COUNT = 1000
+
+type VerifyStatus string
+
+const (
+	VERIFY_STATUS_CLOSE   VerifyStatus = "close"
+	VERIFY_STATUS_RUNNING VerifyStatus = "running"
+	VERIFY_STATUS_STOPING VerifyStatus = "stoping"
+	VERIFY_STATUS_STOPED  VerifyStatus = "stoped"
+	VERIFY_STATUS_OVER    VerifyStatus = "over"
+	VERIFY_STATUS_ERROR   VerifyStatus = "error"
+)
+
+type VerifyDiffType string
+
+const (
+	VERIFY_DIFF_MISSING   VerifyDiffType = "missing"   // 目标表没有
+	VERIFY_DIFF_EXTRA     VerifyDiffType = "extra"     // 目标表多出来的
+	VERIFY_DIFF_DIFFERENT VerifyDiffType = "different" // 字段值不一样
+)
+
+type VerifyDiff struct {
+	Key      string // 主键值, 多个字段用 , 隔开
+	Type     VerifyDiffType
+	Repaired bool // 已经发送修复数据
+}
+
+type VerifyTask struct {
+	sync.RWMutex
+	ID              int
+	DbName          string
+	SchemaName      string
+	TableName       string // 同步配置所在的表, 模糊匹配的是 binlog_*
+	VerifyTableName string // 校验的表, 为空则是 TableName
+	ToServerID      int
+	ChunkSize       int // 每个区间的数据条数
+	RowsPerSecond   int // 每秒最多校验多少条数据, 0 不限速
+	Crontab         string
+	Repair          bool // 是否修复不一致的数据
+	Status          VerifyStatus
+	Error           string
+	StartTime       string
+	OverTime        string
+	ChunkCount      int
+	DiffChunkCount  int
+	RowsCount       uint64
+	DiffCount       int
+	ChangedCount    int // 校验过程中 binlog 里有变更, 没有算不一致的数据条数
+	Diffs           []VerifyDiff
+	ContabNextTime  time.Time
+
+	cronEntryID       cron.EntryID
+	repairToServer    *server.ToServer
+	repairThreadCount int
+}
+
+var verifyLock sync.RWMutex
+var verifyMap = make(map[string]map[int]*VerifyTask, 0)
+var lastVerifyID int
+
+func verifyKey(dbName string, ID int) string {
+	return VERIFY_KEY_PREFIX + dbName + "|" + strconv.Itoa(ID)
+}
+
+func AddVerifyTask(dbName, SchemaName, TableName, VerifyTableName string, ToServerID, ChunkSize, RowsPerSecond int, Crontab string, Repair bool) (int, error) {
+	if ChunkSize <= 0 {
+		ChunkSize = 1000
+	}
+	if RowsPerSecond < 0 {
+		RowsPerSecond = 0
+	}
+	if VerifyTableName == "" {
+		VerifyTableName = TableName
+	}
+	task := &VerifyTask{
+		DbName:          dbName,
+		SchemaName:      SchemaName,
+		TableName:       TableName,
+		VerifyTableName: VerifyTableName,
+		ToServerID:      ToServerID,
+		ChunkSize:       ChunkSize,
+		RowsPerSecond:   RowsPerSecond,
+		Crontab:         Crontab,
+		Repair:          Repair,
+		Status:          VERIFY_STATUS_CLOSE,
+	}
+	toServerInfo, err := task.getToServer()
+	if err != nil {
+		return 0, err
+	}
+	switch toServerInfo.PluginName {
+	case "mysql", "clickhouse":
+		break
+	default:
+		return 0, fmt.Errorf("plugin:%s not supported", toServerInfo.PluginName)
+	}
+	verifyLock.Lock()
+	defer verifyLock.Unlock()
+	if _, ok := verifyMap[dbName]; !ok {
+		verifyMap[dbName] = make(map[int]*VerifyTask, 0)
+	}
+	task.ID = lastVerifyID + 1
+	if Crontab != "" {
+		if err = task.startCrond(); err != nil {
+			return 0, err
+		}
+	}
+	lastVerifyID = task.ID
+	verifyMap[dbName][task.ID] = task
+	task.Lock()
+	err = task.save()
+	task.Unlock()
+	return task.ID, err
+}
+
+func GetVerifyTaskList(dbName string) []*VerifyTask {
+	verifyLock.RLock()
+	defer verifyLock.RUnlock()
+	list := make([]*VerifyTask, 0)
+	for dbNameKey, v := range verifyMap {
+		if dbName != "" && dbName != dbNameKey {
+			continue
+		}
+		for _, task := range v {
+			if task.cronEntryID > 0 {
+				task.ContabNextTime = crodObj.Entry(task.cronEntryID).Next
+			}
+			list = append(list, task)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].DbName != list[j].DbName {
+			return list[i].DbName < list[j].DbName
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+func GetVerifyTask(dbName string, ID int) (*VerifyTask, error) {
+	verifyLock.RLock()
+	defer verifyLock.RUnlock()
+	if _, ok := verifyMap[dbName][ID]; !ok {
+		return nil, fmt.Errorf("%s %d not exist", dbName, ID)
+	}
+	return verifyMap[dbName][ID], nil
+}
+
+func StartVerifyTask(dbName string, ID int) error {
+	task, err := GetVerifyTask(dbName, ID)
+	if err != nil {
+		return err
+	}
+	return task.Start()
+}
+
+func StopVerifyTask(dbName string, ID int) error {
+	task, err := GetVerifyTask(dbName, ID)
+	if err != nil {
+		return err
+	}
+	task.Lock()
+	defer task.Unlock()
+	if task.Status != VERIFY_STATUS_RUNNING {
+		return fmt.Errorf("status:%s can't stop", task.Status)
+	}
+	task.Status = VERIFY_STATUS_STOPING
+	return task.save()
+}
+
+func DelVerifyTask(dbName string, ID int) error {
+	task, err := GetVerifyTask(dbName, ID)
+	if err != nil {
+		return err
+	}
+	task.Lock()
+	if task.Status == VERIFY_STATUS_RUNNING || task.Status == VERIFY_STATUS_STOPING {
+		task.Unlock()
+		return fmt.Errorf("status:%s can't delete, please stop first", task.Status)
+	}
+	if task.cronEntryID > 0 {
+		crodObj.Remove(task.cronEntryID)
+		task.cronEntryID = 0
+	}
+	task.Unlock()
+	verifyLock.Lock()
+	delete(verifyMap[dbName], ID)
+	if len(verifyMap[dbName]) == 0 {
+		delete(verifyMap, dbName)
+	}
+	verifyLock.Unlock()
+	return delKeyVal([]byte(verifyKey(dbName, ID)))
+}
+
+// 重启之后恢复校验任务, 正在运行的任务不自动运行, 定时任务继续
+func RecoveryVerifyTask() {
+	recoveryVerifyTaskByPrefix(VERIFY_KEY_PREFIX)
+}
+
+func recoveryVerifyTaskByPrefix(prefix string) {
+	for _, v := range getListByPrefix([]byte(prefix)) {
+		var task VerifyTask
+		if err := json.Unmarshal([]byte(v.Value), &task); err != nil {
+			log.Println("verify task recovery key:", v.Key, " err:", err)
+			continue
+		}
+		if task.Status == VERIFY_STATUS_RUNNING || task.Status == VERIFY_STATUS_STOPING {
+			task.Status = VERIFY_STATUS_CLOSE
+		}
+		t := &task
+		verifyLock.Lock()
+		if _, ok := verifyMap[t.DbName]; !ok {
+			verifyMap[t.DbName] = make(map[int]*VerifyTask, 0)
+		}
+		verifyMap[t.DbName][t.ID] = t
+		if t.ID > lastVerifyID {
+			lastVerifyID = t.ID
+		}
+		verifyLock.Unlock()
+		if t.Crontab != "" {
+			if err := t.startCrond(); err != nil {
+				log.Println("verify task recovery key:", v.Key, " crontab err:", err)
+			}
+		}
+	}
+}
+
+// 外面已经加锁
+func (This *VerifyTask) save() error {
+	b, err := json.Marshal(This)
+	if err != nil {
+		return err
+	}
+	return putKeyVal([]byte(verifyKey(This.DbName, This.ID)), b)
+}
+
+func (This *VerifyTask) startCrond() error {
+	EntryID, err := crodObj.AddJob(This.Crontab, This)
+	if err != nil {
+		log.Printf("[ERROR] verify add crontab job DbName:%s SchemaName:%s ID:%d Crontab:%s err:%+v \n", This.DbName, This.SchemaName, This.ID, This.Crontab, err)
+		return err
+	}
+	This.cronEntryID = EntryID
+	return nil
+}
+
+func (This *VerifyTask) LogInfo(infoContent string) {
+	log.Printf("[INFO] verify task ID:%d DbName:%s SchemaName:%s Table:%s ToServerID:%d %s \n", This.ID, This.DbName, This.SchemaName, This.VerifyTableName, This.ToServerID, infoContent)
+}
+
+// 定时任务
+func (This *VerifyTask) Run() {
+	if err := This.Start(); err != nil {
+		This.LogInfo("crontab start err:" + err.Error())
+	}
+}
+
+func (This *VerifyTask) Start() error {
+	This.Lock()
+	defer This.Unlock()
+	if This.Status == VERIFY_STATUS_RUNNING || This.Status == VERIFY_STATUS_STOPING {
+		return fmt.Errorf("status:%s can't start", This.Status)
+	}
+	This.Status = VERIFY_STATUS_RUNNING
+	This.Error = ""
+	This.StartTime = time.Now().Format("2006-01-02 15:04:05")
+	This.OverTime = ""
+	This.ChunkCount = 0
+	This.DiffChunkCount = 0
+	This.RowsCount = 0
+	This.DiffCount = 0
+	This.ChangedCount = 0
+	This.Diffs = make([]VerifyDiff, 0)
+	_ = This.save()
+	go This.run()
+	return nil
+}
+
+func (This *VerifyTask) getStatus() VerifyStatus {
+	This.RLock()
+	defer This.RUnlock()
+	return This.Status
+}
+
+func (This *VerifyTask) run() {
+	This.LogInfo("start")
+	var err error
+	func() {
+		defer func() {
+			if e := recover(); e != nil {
+				err = fmt.Errorf("%v", e)
+			}
+		}()
+		err = This.verify()
+	}()
+	This.Lock()
+	defer This.Unlock()
+	This.OverTime = time.Now().Format("2006-01-02 15:04:05")
+	switch {
+	case err != nil:
+		This.Status = VERIFY_STATUS_ERROR
+		This.Error = err.Error()
+	case This.Status == VERIFY_STATUS_STOPING:
+		This.Status = VERIFY_STATUS_STOPED
+	default:
+		This.Status = VERIFY_STATUS_OVER
+	}
+	This.LogInfo(fmt.Sprintf("%s rows:%d diff:%d changed:%d err:%v", This.Status, This.RowsCount, This.DiffCount, This.ChangedCount, err))
+	_ = This.save()
+}
+
+func (This *VerifyTask) getToServer() (*server.ToServer, error) {
+	dbObj := server.GetDBObj(This.DbName)
+	if dbObj == nil {
+		return nil, fmt.Errorf("%s not exist", This.DbName)
+	}
+	table := dbObj.GetTableSelf(This.SchemaName, This.TableName)
+	if table == nil {
+		return nil, fmt.Errorf("%s.%s not exist", This.SchemaName, This.TableName)
+	}
+	for _, toServerInfo := range table.ToServerList {
+		if toServerInfo.ToServerID == This.ToServerID {
+			return toServerInfo, nil
+		}
+	}
+	return nil, fmt.Errorf("ToServerID:%d not exist", This.ToServerID)
+}
+
+func (This *VerifyTask) verify() error {
+	toServerInfo, err := This.getToServer()
+	if err != nil {
+		return err
+	}
+	pluginInfo := pluginStorage.GetToServerInfo(toServerInfo.ToServerKey)
+	if pluginInfo == nil {
+		return fmt.Errorf("ToServerKey:%s not exist", toServerInfo.ToServerKey)
+	}
+	conn, err := dbConnect(server.GetDBObj(This.DbName).ConnectUri)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	Fields, err := GetSchemaTableFieldList(conn, This.SchemaName, This.VerifyTableName, false)
+	if err != nil {
+		return err
+	}
+	if len(Fields) == 0 {
+		return fmt.Errorf("%s.%s fields empty", This.SchemaName, This.VerifyTableName)
+	}
+	KeyArr, err := GetTableKeyArr(conn, This.SchemaName, This.VerifyTableName, Fields)
+	if err != nil {
+		return err
+	}
+	if len(KeyArr) == 0 {
+		return fmt.Errorf("%s.%s no primary key or unique key", This.SchemaName, This.VerifyTableName)
+	}
+	target, err := newVerifyTarget(toServerInfo.PluginName, toServerInfo.PluginParam, This.SchemaName, This.VerifyTableName, Fields, KeyArr)
+	if err != nil {
+		return err
+	}
+	if err = target.Open(pluginInfo.ConnUri); err != nil {
+		return err
+	}
+	defer target.Close()
+	if This.Repair {
+		This.initRepairToServer(toServerInfo)
+	}
+	// 校验的过程中记录 binlog 里有变更的主键
+	watcher := &server.RowWatcher{
+		DbName:     This.DbName,
+		SchemaName: This.SchemaName,
+		TableName:  This.VerifyTableName,
+		KeyFunc: func(row map[string]interface{}) string {
+			key := make([]interface{}, len(KeyArr))
+			for i, name := range KeyArr {
+				key[i] = row[name]
+			}
+			return verifyKeyString(key)
+		},
+	}
+	server.AddRowWatcher(watcher)
+	defer server.DelRowWatcher(watcher)
+
+	chunk := &verifyChunk{
+		task:    This,
+		conn:    conn,
+		target:  target,
+		watcher: watcher,
+		Fields:  Fields,
+		KeyArr:  KeyArr,
+	}
+	chunk.init()
+
+	startTime := time.Now()
+	var rowsCount int64
+	var lower []interface{}
+	for {
+		if This.getStatus() != VERIFY_STATUS_RUNNING {
+			return nil
+		}
+		// 最后一个区间不限制上限, 目标表多出来的数据也要找出来
+		upper, err := chunk.getUpper(lower)
+		if err != nil {
+			return err
+		}
+		count, diffs, changedCount, err := chunk.verify(lower, upper)
+		if err != nil {
+			return err
+		}
+		This.addChunkResult(count, diffs, changedCount)
+		if upper == nil {
+			break
+		}
+		lower = upper
+		// 限速
+		rowsCount += int64(count)
+		if This.RowsPerSecond > 0 {
+			expect := time.Duration(rowsCount * int64(time.Second) / int64(This.RowsPerSecond))
+			if d := expect - time.Since(startTime); d > 0 {
+				time.Sleep(d)
+			}
+		}
+	}
+	This.waitRepairOver()
+	return nil
+}
+
+func (This *VerifyTask) addChunkResult(rowsCount int, diffs []verifyDiffRow, changedCount int) {
+	This.Lock()
+	defer This.Unlock()
+	This.ChunkCount++
+	This.RowsCount += uint64(rowsCount)
+	This.ChangedCount += changedCount
+	if len(diffs) == 0 {
+		return
+	}
+	This.DiffChunkCount++
+	This.DiffCount += len(diffs)
+	for _, diff := range diffs {
+		if len(This.Diffs) >= VERIFY_MAX_DIFF_COUNT {
+			break
+		}
+		This.Diffs = append(This.Diffs, diff.VerifyDiff)
+	}
+}
+
+// 一个校验任务的区间校验
+type verifyChunk struct {
+	task        *VerifyTask
+	conn        mysql.MysqlConnection
+	target      *verifyTarget
+	watcher     *server.RowWatcher
+	Fields      []TableStruct
+	KeyArr      []string
+	fieldIndex  map[string]int
+	columnIndex []int // 目标表字段对应的源表字段下标
+	keyPos      []int // 主键字段在目标表字段里的下标
+	rowCompare  bool  // 库里算不了聚合值, 只能逐行比较
+}
+
+func (This *verifyChunk) init() {
+	This.fieldIndex = make(map[string]int, len(This.Fields))
+	for i, v := range This.Fields {
+		This.fieldIndex[*v.COLUMN_NAME] = i
+	}
+	This.columnIndex = make([]int, len(This.target.Columns))
+	for i, column := range This.target.Columns {
+		This.columnIndex[i] = This.fieldIndex[column.From]
+	}
+	This.keyPos = make([]int, len(This.KeyArr))
+	for i, key := range This.KeyArr {
+		for j, column := range This.target.Columns {
+			if column.From == key {
+				This.keyPos[i] = j
+				break
+			}
+		}
+	}
+}
+
+func (This *verifyChunk) keyFields() string {
+	keyFields := make([]string, len(This.KeyArr))
+	for i, name := range This.KeyArr {
+		keyFields[i] = "`" + name + "`"
+	}
+	return strings.Join(keyFields, ",")
+}
+
+// 从 lower 往后第 ChunkSize 条数据的键值, 作为区间的上限, 不够 ChunkSize 条返回 nil
+func (This *verifyChunk) getUpper(lower []interface{}) ([]interface{}, error) {
+	task := This.task
+	sql := "SELECT " + This.keyFields() + " FROM `" + task.SchemaName + "`.`" + task.VerifyTableName + "`"
+	where, args := keysetWhere(This.KeyArr, lower, nil, "")
+	if where != "" {
+		sql += " WHERE " + where
+	}
+	sql += " ORDER BY " + This.keyFields() + " LIMIT " + strconv.Itoa(task.ChunkSize-1) + ",1"
+	rows, err := This.conn.Query(sql, args)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	dest := make([]driver.Value, len(This.KeyArr), len(This.KeyArr))
+	if rows.Next(dest) != nil {
+		return nil, nil
+	}
+	return toInterfaceArr(dest), nil
+}
+
+// 源表 (lower, upper] 区间的聚合值
+func (This *verifyChunk) sourceChecksum(lower, upper []interface{}) (verifyChecksum, error) {
+	task := This.task
+	names := make([]string, len(This.target.Columns))
+	for i, column := range This.target.Columns {
+		names[i] = column.From
+	}
+	sql := "SELECT " + verifyChecksumFields("mysql", names, This.target.Fields) + " FROM `" + task.SchemaName + "`.`" + task.VerifyTableName + "`"
+	where, args := keysetWhere(This.KeyArr, lower, upper, "")
+	if where != "" {
+		sql += " WHERE " + where
+	}
+	rows, err := This.conn.Query(sql, args)
+	if err != nil {
+		return verifyChecksum{}, err
+	}
+	defer rows.Close()
+	dest := make([]driver.Value, 2, 2)
+	if err = rows.Next(dest); err != nil {
+		return verifyChecksum{}, err
+	}
+	return parseVerifyChecksum([][]driver.Value{dest})
+}
+
+// 两边的聚合值一样返回 true, 不一样或者算不了的时候返回 false, 要逐行比较
+func (This *verifyChunk) checksumEqual(lower, upper []interface{}) (count int, equal bool) {
+	if This.rowCompare {
+		return 0, false
+	}
+	sourceSum, err := This.sourceChecksum(lower, upper)
+	if err == nil {
+		var targetSum verifyChecksum
+		if targetSum, err = This.target.ChecksumRange(lower, upper); err == nil {
+			return sourceSum.Count, sourceSum == targetSum
+		}
+	}
+	This.task.LogInfo("checksum err:" + err.Error() + ", compare rows")
+	This.rowCompare = true
+	return 0, false
+}
+
+func (This *verifyChunk) querySource(sql string, args []driver.Value) ([][]driver.Value, error) {
+	rows, err := This.conn.Query(sql, args)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	data := make([][]driver.Value, 0)
+	for {
+		dest := make([]driver.Value, len(This.Fields), len(This.Fields))
+		if rows.Next(dest) != nil {
+			break
+		}
+		data = append(data, dest)
+	}
+	return data, nil
+}
+
+// 校验一个区间, 返回源表的数据条数, 不一致的数据, 及校验过程中有变更跳过的数据条数
+func (This *verifyChunk) verify(lower, upper []interface{}) (count int, diffs []verifyDiffRow, changedCount int, err error) {
+	if count, equal := This.checksumEqual(lower, upper); equal {
+		return count, nil, 0, nil
+	}
+	task := This.task
+	sql, args := keysetSql(task.SchemaName, task.VerifyTableName, This.KeyArr, lower, upper, "", 0)
+	sourceRows, err := This.querySource(sql, args)
+	if err != nil {
+		return 0, nil, 0, err
+	}
+	targetRows, err := This.target.QueryRange(lower, upper)
+	if err != nil {
+		return 0, nil, 0, err
+	}
+	projectRows := make([][]driver.Value, len(sourceRows))
+	for i, row := range sourceRows {
+		projectRows[i] = make([]driver.Value, len(This.columnIndex))
+		for j, index := range This.columnIndex {
+			projectRows[i][j] = row[index]
+		}
+	}
+	diffs = compareVerifyChunk(projectRows, targetRows, This.keyPos)
+	diffs, changedCount = This.skipChanged(diffs)
+	if len(diffs) > 0 && task.Repair {
+		if err = This.repair(projectRows, targetRows, diffs); err != nil {
+			return 0, nil, 0, err
+		}
+	}
+	return len(sourceRows), diffs, changedCount, nil
+}
+
+// 去掉校验过程中 binlog 里有变更的数据
+func (This *verifyChunk) skipChanged(diffs []verifyDiffRow) ([]verifyDiffRow, int) {
+	result := make([]verifyDiffRow, 0, len(diffs))
+	for _, diff := range diffs {
+		if !This.watcher.IsChanged(diff.Key) {
+			result = append(result, diff)
+		}
+	}
+	return result, len(diffs) - len(result)
+}
+
+// 源表里这些主键现在的数据, 主键值 => 数据
+func (This *verifyChunk) querySourceByKeys(keys [][]interface{}) (map[string][]driver.Value, error) {
+	task := This.task
+	inArr := make([]string, len(keys))
+	for i, key := range keys {
+		values := make([]string, len(key))
+		for j, v := range key {
+			values[j] = quoteVerifyValue(v)
+		}
+		inArr[i] = "(" + strings.Join(values, ",") + ")"
+	}
+	sql := "SELECT * FROM `" + task.SchemaName + "`.`" + task.VerifyTableName + "` WHERE (" + This.keyFields() + ") IN (" + strings.Join(inArr, ",") + ")"
+	data, err := This.querySource(sql, []driver.Value{})
+	if err != nil {
+		return nil, err
+	}
+	rowMap := make(map[string][]driver.Value, len(data))
+	for _, row := range data {
+		key := make([]interface{}, len(This.KeyArr))
+		for i, name := range This.KeyArr {
+			key[i] = row[This.fieldIndex[name]]
+		}
+		rowMap[verifyKeyString(key)] = row
+	}
+	return rowMap, nil
+}
+
+type verifyDiffRow struct {
+	VerifyDiff
+	sourceIndex int // 源表数据的下标, -1 为没有
+	targetIndex int // 目标表数据的下标, -1 为没有
+}
+
+// 先比较区间的聚合值, 不一样再逐行比较, 两边的数据字段顺序一样
+func compareVerifyChunk(sourceRows, targetRows [][]driver.Value, keyPos []int) []verifyDiffRow {
+	var sourceSum, targetSum verifyChecksum
+	sourceCrc := make([]uint32, len(sourceRows))
+	for i, row := range sourceRows {
+		sourceCrc[i] = verifyRowChecksum(row)
+		sourceSum.Add(sourceCrc[i])
+	}
+	targetCrc := make([]uint32, len(targetRows))
+	for i, row := range targetRows {
+		targetCrc[i] = verifyRowChecksum(row)
+		targetSum.Add(targetCrc[i])
+	}
+	if sourceSum == targetSum {
+		return nil
+	}
+	var rowKey = func(row []driver.Value) string {
+		key := make([]interface{}, len(keyPos))
+		for i, pos := range keyPos {
+			key[i] = row[pos]
+		}
+		return verifyKeyString(key)
+	}
+	targetMap := make(map[string]int, len(targetRows))
+	for i, row := range targetRows {
+		targetMap[rowKey(row)] = i
+	}
+	diffs := make([]verifyDiffRow, 0)
+	for i, row := range sourceRows {
+		key := rowKey(row)
+		j, ok := targetMap[key]
+		if !ok {
+			diffs = append(diffs, verifyDiffRow{VerifyDiff: VerifyDiff{Key: key, Type: VERIFY_DIFF_MISSING}, sourceIndex: i, targetIndex: -1})
+			continue
+		}
+		delete(targetMap, key)
+		if sourceCrc[i] != targetCrc[j] {
+			diffs = append(diffs, verifyDiffRow{VerifyDiff: VerifyDiff{Key: key, Type: VERIFY_DIFF_DIFFERENT}, sourceIndex: i, targetIndex: j})
+		}
+	}
+	extraIndex := make([]int, 0, len(targetMap))
+	for _, j := range targetMap {
+		extraIndex = append(extraIndex, j)
+	}
+	sort.Ints(extraIndex)
+	for _, j := range extraIndex {
+		diffs = append(diffs, verifyDiffRow{VerifyDiff: VerifyDiff{Key: rowKey(targetRows[j]), Type: VERIFY_DIFF_EXTRA}, sourceIndex: -1, targetIndex: j})
+	}
+	return diffs
+}
+
+// 修复数据用同步配置的副本, 和全量任务一样, 不在增量的同步配置列表里
+func (This *VerifyTask) initRepairToServer(toServerInfo *server.ToServer) {
+	Key := server.GetSchemaAndTableJoin(This.SchemaName, This.TableName)
+	This.repairToServer = &server.ToServer{
+		Key:            &Key,
+		ToServerID:     0,
+		PluginName:     toServerInfo.PluginName,
+		MustBeSuccess:  toServerInfo.MustBeSuccess,
+		FilterQuery:    toServerInfo.FilterQuery,
+		FilterUpdate:   toServerInfo.FilterUpdate,
+		FieldList:      toServerInfo.FieldList,
+		Transforms:     toServerInfo.Transforms,
+		ToServerKey:    toServerInfo.ToServerKey,
+		BinlogFileNum:  toServerInfo.BinlogFileNum,
+		BinlogPosition: toServerInfo.BinlogPosition,
+		PluginParam:    toServerInfo.PluginParam,
+		Notes:          "verify",
+	}
+}
+
+// 校验的时候源表和目标表不是同一时刻查询的, 修复之前按主键重新查询源表
+// 源表现在有的数据按源表 insert, 源表已经没有的数据, 目标表多出来的或者不一样的才 delete, 源表有的主键不会删除
+// 发送之前 binlog 里已经有变更的数据不修复, 以增量同步为准
+func (This *verifyChunk) repair(sourceRows, targetRows [][]driver.Value, diffs []verifyDiffRow) error {
+	keys := make([][]interface{}, len(diffs))
+	for i, diff := range diffs {
+		var row []driver.Value
+		if diff.sourceIndex >= 0 {
+			row = sourceRows[diff.sourceIndex]
+		} else {
+			row = targetRows[diff.targetIndex]
+		}
+		keys[i] = make([]interface{}, len(This.keyPos))
+		for j, pos := range This.keyPos {
+			keys[i][j] = row[pos]
+		}
+	}
+	rowMap, err := This.querySourceByKeys(keys)
+	if err != nil {
+		return err
+	}
+	Pri := getPriArr(This.Fields)
+	if len(Pri) == 0 {
+		Pri = This.KeyArr
+	}
+	ColumnMapping := getColumnMapping(This.Fields)
+	for i := range diffs {
+		if This.watcher.IsChanged(diffs[i].Key) {
+			continue
+		}
+		d := &pluginDriver.PluginDataType{
+			Timestamp:     uint32(time.Now().Unix()),
+			SchemaName:    This.task.SchemaName,
+			TableName:     This.task.VerifyTableName,
+			Pri:           Pri,
+			ColumnMapping: ColumnMapping,
+		}
+		if row, ok := rowMap[diffs[i].Key]; ok {
+			m, _ := fieldsToRow(This.Fields, row)
+			d.EventType = "insert"
+			d.Rows = []map[string]interface{}{m}
+		} else if diffs[i].targetIndex >= 0 {
+			// 源表已经没有的数据, 用目标表的值按源表字段名删除
+			m := make(map[string]interface{}, len(This.target.Columns))
+			for j, column := range This.target.Columns {
+				m[column.From] = targetRows[diffs[i].targetIndex][j]
+			}
+			d.EventType = "delete"
+			d.Rows = []map[string]interface{}{m}
+		} else {
+			// 目标表没有, 源表也已经删除了
+			continue
+		}
+		This.task.sendRepairData(d)
+		diffs[i].Repaired = true
+	}
+	return nil
+}
+
+func (This *VerifyTask) sendRepairData(d *pluginDriver.PluginDataType) {
+	ToServerInfo := This.repairToServer
+	ToServerInfo.Lock()
+	ToServerInfo.QueueMsgCount++
+	var newChan bool
+	if ToServerInfo.ToServerChan == nil {
+		ToServerInfo.ToServerChan = &server.ToServerChan{
+			To: make(chan *pluginDriver.PluginDataType, config.ToServerQueueSize),
+		}
+		newChan = true
+	}
+	// 消费协程没数据的时候会把 ToServerChan 置为 nil 再退出, 新的队列要启动新的消费协程
+	if This.repairThreadCount == 0 || newChan {
+		This.repairThreadCount++
+		go func() {
+			defer func() {
+				ToServerInfo.Lock()
+				This.repairThreadCount--
+				ToServerInfo.Unlock()
+			}()
+			ToServerInfo.ConsumeToServer(server.GetDBObj(This.DbName), This.SchemaName, This.TableName)
+		}()
+	}
+	ch := ToServerInfo.ToServerChan.To
+	ToServerInfo.Unlock()
+	ch <- d
+}
+
+// 等修复数据都同步完
+func (This *VerifyTask) waitRepairOver() {
+	if This.repairToServer == nil {
+		return
+	}
+	for {
+		This.repairToServer.Lock()
+		over := This.repairThreadCount == 0
+		This.repairToServer.Unlock()
+		if over {
+			return
+		}
+		time.Sleep(time.Second)
+	}
+}
@@ -0,0 +1,516 @@
+package history
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	clickhouse "github.com/ClickHouse/clickhouse-go"
+
+	"github.com/brokercap/Bifrost/Bristol/mysql"
+)
+
+// 数据校验的目标库, 支持 mysql 插件(MySQL, StarRocks) 和 clickhouse 插件
+type verifyConn interface {
+	Query(sql string) ([][]driver.Value, error)
+	Close()
+}
+
+type verifyMysqlConn struct {
+	conn mysql.MysqlConnection
+}
+
+func (This *verifyMysqlConn) Query(sql string) ([][]driver.Value, error) {
+	return queryAll(This.conn, sql)
+}
+
+func (This *verifyMysqlConn) Close() {
+	defer func() {
+		recover()
+	}()
+	This.conn.Close()
+}
+
+type verifyClickhouseConn struct {
+	conn clickhouse.Clickhouse
+}
+
+func (This *verifyClickhouseConn) Query(sql string) (data [][]driver.Value, err error) {
+	if _, err = This.conn.Begin(); err != nil {
+		return
+	}
+	defer This.conn.Commit()
+	stmt, err := This.conn.Prepare(sql)
+	if err != nil {
+		return
+	}
+	defer stmt.Close()
+	rows, err := stmt.Query([]driver.Value{})
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	n := len(rows.Columns())
+	for {
+		dest := make([]driver.Value, n, n)
+		if rows.Next(dest) != nil {
+			break
+		}
+		data = append(data, dest)
+	}
+	return
+}
+
+func (This *verifyClickhouseConn) Close() {
+	defer func() {
+		recover()
+	}()
+	This.conn.Close()
+}
+
+func queryAll(conn mysql.MysqlConnection, sql string) (data [][]driver.Value, err error) {
+	rows, err := conn.Query(sql, []driver.Value{})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	n := len(rows.Columns())
+	for {
+		dest := make([]driver.Value, n, n)
+		if rows.Next(dest) != nil {
+			break
+		}
+		data = append(data, dest)
+	}
+	return data, nil
+}
+
+// 源表字段 => 目标表字段
+type verifyColumn struct {
+	From string
+	To   string
+}
+
+type verifyTarget struct {
+	PluginName string
+	SchemaName string
+	TableName  string
+	Columns    []verifyColumn
+	Fields     []TableStruct // 和 Columns 对应的源表字段
+	KeyColumns []verifyColumn
+	final      bool // clickhouse ReplacingMergeTree 查询要加 FINAL
+	conn       verifyConn
+}
+
+// 同步配置的插件参数
+type verifyPluginParam struct {
+	Field []struct {
+		ToField        string
+		FromMysqlField string
+		CK             string
+		MySQL          string
+	}
+	Schema              string
+	Table               string
+	SyncMode            string
+	CkSchema            string
+	CkTable             string
+	SyncType            string
+	AutoSchemaPrefix    string
+	AutoTablePrefix     string
+	LowerCaseTableNames int8
+}
+
+func parseVerifyPluginParam(PluginParam map[string]interface{}) (*verifyPluginParam, error) {
+	b, err := json.Marshal(PluginParam)
+	if err != nil {
+		return nil, err
+	}
+	var param verifyPluginParam
+	if err = json.Unmarshal(b, &param); err != nil {
+		return nil, err
+	}
+	return &param, nil
+}
+
+// 按同步配置的参数, 计算目标表名及字段对应关系
+func newVerifyTarget(PluginName string, PluginParam map[string]interface{}, SchemaName, TableName string, Fields []TableStruct, KeyArr []string) (*verifyTarget, error) {
+	param, err := parseVerifyPluginParam(PluginParam)
+	if err != nil {
+		return nil, err
+	}
+	target := &verifyTarget{PluginName: PluginName}
+	var nameCase = func(name string) string { return name }
+	switch PluginName {
+	case "mysql":
+		if param.SyncMode != "" && param.SyncMode != "Normal" {
+			return nil, fmt.Errorf("SyncMode:%s not supported, only Normal", param.SyncMode)
+		}
+		target.SchemaName, target.TableName = param.Schema, param.Table
+		if target.SchemaName == "" {
+			target.SchemaName = SchemaName
+		}
+		if target.TableName == "" {
+			target.TableName = TableName
+		}
+	case "clickhouse":
+		if param.SyncType != "" && param.SyncType != "Normal" {
+			return nil, fmt.Errorf("SyncType:%s not supported, only Normal", param.SyncType)
+		}
+		switch param.LowerCaseTableNames {
+		case 1:
+			nameCase = strings.ToLower
+		case 2:
+			nameCase = strings.ToUpper
+		}
+		target.SchemaName, target.TableName = param.CkSchema, param.CkTable
+		if target.SchemaName == "" {
+			target.SchemaName = param.AutoSchemaPrefix + nameCase(SchemaName)
+		}
+		if target.TableName == "" {
+			target.TableName = param.AutoTablePrefix + nameCase(TableName)
+		}
+	default:
+		return nil, fmt.Errorf("plugin:%s not supported", PluginName)
+	}
+	fieldMap := make(map[string]TableStruct, 0)
+	for _, v := range Fields {
+		fieldMap[*v.COLUMN_NAME] = v
+	}
+	for _, v := range param.Field {
+		from, to := v.FromMysqlField, v.ToField
+		if PluginName == "clickhouse" {
+			from, to = v.MySQL, v.CK
+		}
+		// {$EventType} 等不是源表字段, 不校验
+		field, ok := fieldMap[from]
+		if to == "" || !ok {
+			continue
+		}
+		target.Columns = append(target.Columns, verifyColumn{From: from, To: to})
+		target.Fields = append(target.Fields, field)
+	}
+	// 没有配置字段对应关系的时候(自动建表), 字段名一样
+	if len(param.Field) == 0 {
+		for _, v := range Fields {
+			target.Columns = append(target.Columns, verifyColumn{From: *v.COLUMN_NAME, To: nameCase(*v.COLUMN_NAME)})
+			target.Fields = append(target.Fields, v)
+		}
+	}
+	for _, key := range KeyArr {
+		var found bool
+		for _, column := range target.Columns {
+			if column.From == key {
+				target.KeyColumns = append(target.KeyColumns, column)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("key field:%s not sync to %s.%s", key, target.SchemaName, target.TableName)
+		}
+	}
+	return target, nil
+}
+
+func (This *verifyTarget) Open(uri string) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("%s connect err:%s", This.PluginName, fmt.Sprint(e))
+		}
+	}()
+	switch This.PluginName {
+	case "clickhouse":
+		var conn clickhouse.Clickhouse
+		if conn, err = clickhouse.OpenDirect(uri); err != nil {
+			return err
+		}
+		This.conn = &verifyClickhouseConn{conn: conn}
+		engineSql := "SELECT engine FROM system.tables WHERE database = " + quoteVerifyValue(This.SchemaName) + " AND name = " + quoteVerifyValue(This.TableName)
+		data, err := This.conn.Query(engineSql)
+		if err != nil {
+			return err
+		}
+		if len(data) > 0 {
+			This.final = strings.Contains(fmt.Sprint(data[0][0]), "Replacing")
+		}
+	default:
+		This.conn = &verifyMysqlConn{conn: mysql.NewConnect(uri)}
+	}
+	return nil
+}
+
+func (This *verifyTarget) Close() {
+	if This.conn != nil {
+		This.conn.Close()
+	}
+}
+
+// 查询目标表 (lower, upper] 区间的数据, 字段顺序和 Columns 一样
+func (This *verifyTarget) QueryRange(lower, upper []interface{}) ([][]driver.Value, error) {
+	fields := make([]string, len(This.Columns))
+	for i, column := range This.Columns {
+		fields[i] = "`" + column.To + "`"
+	}
+	return This.conn.Query("SELECT " + strings.Join(fields, ",") + This.rangeSql(lower, upper))
+}
+
+// 目标表 (lower, upper] 区间的聚合值, 在目标库里计算, 不用把数据拉回来
+// StarRocks 等不支持 CRC32, BIT_XOR 的库会返回 error, 外面改成逐行比较
+func (This *verifyTarget) ChecksumRange(lower, upper []interface{}) (verifyChecksum, error) {
+	names := make([]string, len(This.Columns))
+	for i, column := range This.Columns {
+		names[i] = column.To
+	}
+	data, err := This.conn.Query("SELECT " + verifyChecksumFields(This.PluginName, names, This.Fields) + This.rangeSql(lower, upper))
+	if err != nil {
+		return verifyChecksum{}, err
+	}
+	return parseVerifyChecksum(data)
+}
+
+func (This *verifyTarget) rangeSql(lower, upper []interface{}) string {
+	keys := make([]string, len(This.KeyColumns))
+	for i, column := range This.KeyColumns {
+		keys[i] = column.To
+	}
+	sql := " FROM `" + This.SchemaName + "`.`" + This.TableName + "`"
+	if This.final {
+		sql += " FINAL"
+	}
+	where := make([]string, 0, 2)
+	if lower != nil {
+		where = append(where, keyCompareSql(keys, lower, ">"))
+	}
+	if upper != nil {
+		where = append(where, keyCompareSql(keys, upper, "<="))
+	}
+	if len(where) > 0 {
+		sql += " WHERE " + strings.Join(where, " AND ")
+	}
+	return sql
+}
+
+// 展开成 a > ? OR (a = ? AND b > ?) 的方式, 不依赖 (a,b) > (?,?) 的语法, StarRocks 和 ClickHouse 都可以用
+func keyCompareSql(keys []string, values []interface{}, op string) string {
+	cmp := op[0:1]
+	orArr := make([]string, 0, len(keys)+1)
+	for i := range keys {
+		andArr := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			andArr = append(andArr, "`"+keys[j]+"` = "+quoteVerifyValue(values[j]))
+		}
+		andArr = append(andArr, "`"+keys[i]+"` "+cmp+" "+quoteVerifyValue(values[i]))
+		orArr = append(orArr, "("+strings.Join(andArr, " AND ")+")")
+	}
+	if strings.HasSuffix(op, "=") {
+		andArr := make([]string, len(keys))
+		for i := range keys {
+			andArr[i] = "`" + keys[i] + "` = " + quoteVerifyValue(values[i])
+		}
+		orArr = append(orArr, "("+strings.Join(andArr, " AND ")+")")
+	}
+	return "(" + strings.Join(orArr, " OR ") + ")"
+}
+
+var verifyStringReplacer = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+func quoteVerifyValue(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "NULL"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return fmt.Sprint(val)
+	case bool:
+		if val {
+			return "1"
+		}
+		return "0"
+	case time.Time:
+		return "'" + val.Format("2006-01-02 15:04:05.999999") + "'"
+	case []byte:
+		return "'" + verifyStringReplacer.Replace(string(val)) + "'"
+	default:
+		return "'" + verifyStringReplacer.Replace(fmt.Sprint(val)) + "'"
+	}
+}
+
+var verifyDecimalReg = regexp.MustCompile(`^-?\d+\.\d+$`)
+var verifyDateTimeReg = regexp.MustCompile(`^\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}(\.\d+)?$`)
+
+// 不同的库返回的类型不一样, 统一转成字符串再计算 CRC32
+// 比如 decimal 1.50 和 1.5, datetime 2021-01-01 00:00:00.000 和 time.Time, 都要转成一样的
+func verifyValueString(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "\\N"
+	case bool:
+		if val {
+			return "1"
+		}
+		return "0"
+	case float32:
+		return strconv.FormatFloat(float64(val), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(val, 'g', -1, 64)
+	case *big.Float:
+		return val.Text('g', -1)
+	case time.Time:
+		return verifyDateTimeString(val.Format("2006-01-02 15:04:05.999999999"))
+	case []byte:
+		return verifyStringValue(string(val))
+	case string:
+		return verifyStringValue(val)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+func verifyStringValue(val string) string {
+	if verifyDecimalReg.MatchString(val) {
+		val = strings.TrimRight(strings.TrimRight(val, "0"), ".")
+		if val == "-0" {
+			val = "0"
+		}
+		return val
+	}
+	if verifyDateTimeReg.MatchString(val) {
+		return verifyDateTimeString(val)
+	}
+	return val
+}
+
+// 去掉末尾的 0 毫秒, 00:00:00 的时间只保留日期, 和 date 类型一样
+func verifyDateTimeString(val string) string {
+	if i := strings.Index(val, "."); i > 0 {
+		val = strings.TrimRight(strings.TrimRight(val, "0"), ".")
+	}
+	return strings.TrimSuffix(val, " 00:00:00")
+}
+
+// 一行数据的 CRC32
+func verifyRowChecksum(row []driver.Value) uint32 {
+	arr := make([]string, len(row))
+	for i, v := range row {
+		arr[i] = verifyValueString(v)
+	}
+	return crc32.ChecksumIEEE([]byte(strings.Join(arr, "\x00")))
+}
+
+func verifyKeyString(key []interface{}) string {
+	arr := make([]string, len(key))
+	for i, v := range key {
+		arr[i] = verifyValueString(v)
+	}
+	return strings.Join(arr, ",")
+}
+
+// 区间的聚合值, 行数 + 每行 CRC32 的异或和累加, 库里计算的只有 行数 + 异或
+type verifyChecksum struct {
+	Count int
+	Xor   uint32
+	Sum   uint64
+}
+
+func (This *verifyChecksum) Add(crc uint32) {
+	This.Count++
+	This.Xor ^= crc
+	This.Sum += uint64(crc)
+}
+
+// 聚合值的查询字段: 行数, 每行 CRC32 的异或
+// 每行按字段顺序转成字符串用 , 连接, 最后再拼上每个字段是否为 NULL 的标记
+// dialect 为 mysql 的时候源表和目标表(MySQL, StarRocks)都用这个, clickhouse 为 ClickHouse 的写法
+func verifyChecksumFields(dialect string, names []string, Fields []TableStruct) string {
+	exprArr := make([]string, 0, len(names)+1)
+	nullArr := make([]string, len(names))
+	for i, name := range names {
+		column := "`" + name + "`"
+		if dialect == "clickhouse" {
+			exprArr = append(exprArr, "ifNull("+verifyClickhouseColumnExpr(column, Fields[i])+",'')")
+			nullArr[i] = "toString(isNull(" + column + "))"
+		} else {
+			exprArr = append(exprArr, "IFNULL("+verifyMysqlColumnExpr(column, Fields[i])+",'')")
+			nullArr[i] = "ISNULL(" + column + ")"
+		}
+	}
+	if dialect == "clickhouse" {
+		if len(nullArr) == 1 {
+			exprArr = append(exprArr, nullArr[0])
+		} else {
+			exprArr = append(exprArr, "concat("+strings.Join(nullArr, ",")+")")
+		}
+		return "count(),groupBitXor(CRC32(arrayStringConcat([" + strings.Join(exprArr, ",") + "],',')))"
+	}
+	exprArr = append(exprArr, "CONCAT("+strings.Join(nullArr, ",")+")")
+	return "COUNT(*),IFNULL(BIT_XOR(CRC32(CONCAT_WS(','," + strings.Join(exprArr, ",") + "))),0)"
+}
+
+// 小数和毫秒的时间, 去掉末尾的 0, 1.50 和 1.5 一样
+func verifyTrimZeroType(field TableStruct) bool {
+	if field.DATA_TYPE == nil {
+		return false
+	}
+	switch strings.ToLower(*field.DATA_TYPE) {
+	case "decimal", "float", "double", "datetime", "timestamp", "time":
+		return true
+	default:
+		return false
+	}
+}
+
+func verifyMysqlColumnExpr(column string, field TableStruct) string {
+	if !verifyTrimZeroType(field) {
+		return column
+	}
+	str := "CAST(" + column + " AS CHAR)"
+	return "IF(LOCATE('.'," + str + ")>0,TRIM(TRAILING '.' FROM TRIM(TRAILING '0' FROM " + str + "))," + str + ")"
+}
+
+func verifyClickhouseColumnExpr(column string, field TableStruct) string {
+	if verifyTrimZeroType(field) {
+		str := "toString(" + column + ")"
+		return "if(position(" + str + ",'.')>0,replaceRegexpOne(" + str + ",'\\\\.?0*$','')," + str + ")"
+	}
+	var dataType, columnType string
+	if field.DATA_TYPE != nil {
+		dataType = strings.ToLower(*field.DATA_TYPE)
+	}
+	if field.COLUMN_TYPE != nil {
+		columnType = strings.ToLower(*field.COLUMN_TYPE)
+	}
+	switch dataType {
+	// tinyint(1) 有可能同步成 Bool, 统一转成数字
+	case "tinyint", "smallint", "mediumint", "int", "integer", "year":
+		return "toString(toInt64(" + column + "))"
+	case "bigint":
+		if !strings.Contains(columnType, "unsigned") {
+			return "toString(toInt64(" + column + "))"
+		}
+	}
+	return "toString(" + column + ")"
+}
+
+func parseVerifyChecksum(data [][]driver.Value) (verifyChecksum, error) {
+	var sum verifyChecksum
+	if len(data) == 0 || len(data[0]) < 2 {
+		return sum, fmt.Errorf("checksum result empty")
+	}
+	count, err := strconv.ParseUint(verifyValueString(data[0][0]), 10, 64)
+	if err != nil {
+		return sum, err
+	}
+	xor, err := strconv.ParseUint(verifyValueString(data[0][1]), 10, 64)
+	if err != nil {
+		return sum, err
+	}
+	sum.Count = int(count)
+	sum.Xor = uint32(xor)
+	return sum, nil
+}
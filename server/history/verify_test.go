@@ -0,0 +1,130 @@
+package history
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestVerifyValueString(t *testing.T) {
+	Convey("same value from different database", t, func() {
+		So(verifyValueString("1.50"), ShouldEqual, verifyValueString(float64(1.5)))
+		So(verifyValueString("2.00"), ShouldEqual, verifyValueString(int64(2)))
+		So(verifyValueString("2021-01-02 03:04:05.120"), ShouldEqual, verifyValueString(time.Date(2021, 1, 2, 3, 4, 5, 120000000, time.UTC)))
+		So(verifyValueString("2021-01-02 00:00:00"), ShouldEqual, verifyValueString("2021-01-02"))
+		So(verifyValueString(time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC)), ShouldEqual, "2021-01-02")
+		So(verifyValueString(true), ShouldEqual, verifyValueString(int8(1)))
+		So(verifyValueString([]byte("abc")), ShouldEqual, "abc")
+		So(verifyValueString(nil), ShouldNotEqual, verifyValueString(""))
+	})
+}
+
+func TestKeyCompareSql(t *testing.T) {
+	Convey("composite key", t, func() {
+		So(keyCompareSql([]string{"a", "b"}, []interface{}{int64(1), "x'y"}, ">"), ShouldEqual, "((`a` > 1) OR (`a` = 1 AND `b` > 'x\\'y'))")
+		So(keyCompareSql([]string{"a"}, []interface{}{"m"}, "<="), ShouldEqual, "((`a` < 'm') OR (`a` = 'm'))")
+	})
+}
+
+func TestNewVerifyTarget(t *testing.T) {
+	newField := func(name string) TableStruct {
+		return TableStruct{COLUMN_NAME: &name}
+	}
+	Fields := []TableStruct{newField("id"), newField("name"), newField("age")}
+
+	Convey("mysql field mapping", t, func() {
+		param := map[string]interface{}{
+			"Schema": "",
+			"Table":  "t_user",
+			"Field": []interface{}{
+				map[string]interface{}{"ToField": "user_id", "FromMysqlField": "id"},
+				map[string]interface{}{"ToField": "user_name", "FromMysqlField": "name"},
+				map[string]interface{}{"ToField": "event_type", "FromMysqlField": "{$EventType}"},
+			},
+		}
+		target, err := newVerifyTarget("mysql", param, "bifrost_test", "user", Fields, []string{"id"})
+		So(err, ShouldBeNil)
+		So(target.SchemaName, ShouldEqual, "bifrost_test")
+		So(target.TableName, ShouldEqual, "t_user")
+		So(target.Columns, ShouldResemble, []verifyColumn{{From: "id", To: "user_id"}, {From: "name", To: "user_name"}})
+		So(target.Fields, ShouldResemble, []TableStruct{Fields[0], Fields[1]})
+		So(target.KeyColumns, ShouldResemble, []verifyColumn{{From: "id", To: "user_id"}})
+
+		_, err = newVerifyTarget("mysql", param, "bifrost_test", "user", Fields, []string{"age"})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("clickhouse auto create table", t, func() {
+		param := map[string]interface{}{"AutoSchemaPrefix": "ods_", "LowerCaseTableNames": 1, "SyncType": "Normal"}
+		target, err := newVerifyTarget("clickhouse", param, "Bifrost_Test", "User", Fields, []string{"id"})
+		So(err, ShouldBeNil)
+		So(target.SchemaName, ShouldEqual, "ods_bifrost_test")
+		So(target.TableName, ShouldEqual, "user")
+		So(len(target.Columns), ShouldEqual, 3)
+
+		param["SyncType"] = "insertAll"
+		_, err = newVerifyTarget("clickhouse", param, "Bifrost_Test", "User", Fields, []string{"id"})
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestCompareVerifyChunk(t *testing.T) {
+	Convey("equal chunk", t, func() {
+		source := [][]driver.Value{{int64(1), "a", "1.50"}, {int64(2), "b", "2.00"}}
+		target := [][]driver.Value{{uint32(2), "b", float64(2)}, {uint32(1), "a", float64(1.5)}}
+		So(compareVerifyChunk(source, target, []int{0}), ShouldBeNil)
+	})
+
+	Convey("drill down to rows", t, func() {
+		source := [][]driver.Value{{int64(1), "a"}, {int64(2), "b"}, {int64(3), "c"}}
+		target := [][]driver.Value{{int64(1), "a"}, {int64(3), "x"}, {int64(4), "d"}}
+		diffs := compareVerifyChunk(source, target, []int{0})
+		So(len(diffs), ShouldEqual, 3)
+		So(diffs[0].VerifyDiff, ShouldResemble, VerifyDiff{Key: "2", Type: VERIFY_DIFF_MISSING})
+		So(diffs[0].sourceIndex, ShouldEqual, 1)
+		So(diffs[1].VerifyDiff, ShouldResemble, VerifyDiff{Key: "3", Type: VERIFY_DIFF_DIFFERENT})
+		So(diffs[2].VerifyDiff, ShouldResemble, VerifyDiff{Key: "4", Type: VERIFY_DIFF_EXTRA})
+		So(diffs[2].targetIndex, ShouldEqual, 2)
+	})
+}
+
+func TestVerifyChecksumFields(t *testing.T) {
+	newField := func(name, dataType, columnType string) TableStruct {
+		return TableStruct{COLUMN_NAME: &name, DATA_TYPE: &dataType, COLUMN_TYPE: &columnType}
+	}
+	Fields := []TableStruct{newField("id", "bigint", "bigint(20) unsigned"), newField("status", "tinyint", "tinyint(1)"), newField("price", "decimal", "decimal(10,2)")}
+	names := []string{"id", "status", "price"}
+
+	Convey("mysql", t, func() {
+		So(verifyChecksumFields("mysql", names, Fields), ShouldEqual, "COUNT(*),IFNULL(BIT_XOR(CRC32(CONCAT_WS(',',"+
+			"IFNULL(`id`,''),IFNULL(`status`,''),"+
+			"IFNULL(IF(LOCATE('.',CAST(`price` AS CHAR))>0,TRIM(TRAILING '.' FROM TRIM(TRAILING '0' FROM CAST(`price` AS CHAR))),CAST(`price` AS CHAR)),''),"+
+			"CONCAT(ISNULL(`id`),ISNULL(`status`),ISNULL(`price`))))),0)")
+	})
+
+	Convey("clickhouse", t, func() {
+		So(verifyChecksumFields("clickhouse", names, Fields), ShouldEqual, "count(),groupBitXor(CRC32(arrayStringConcat(["+
+			"ifNull(toString(`id`),''),ifNull(toString(toInt64(`status`)),''),"+
+			"ifNull(if(position(toString(`price`),'.')>0,replaceRegexpOne(toString(`price`),'\\\\.?0*$',''),toString(`price`)),''),"+
+			"concat(toString(isNull(`id`)),toString(isNull(`status`)),toString(isNull(`price`)))],',')))")
+		So(verifyChecksumFields("clickhouse", names[:1], Fields[:1]), ShouldEqual, "count(),groupBitXor(CRC32(arrayStringConcat([ifNull(toString(`id`),''),toString(isNull(`id`))],',')))")
+	})
+}
+
+func TestParseVerifyChecksum(t *testing.T) {
+	Convey("mysql and clickhouse result", t, func() {
+		mysqlSum, err := parseVerifyChecksum([][]driver.Value{{int64(3), []byte("4294967295")}})
+		So(err, ShouldBeNil)
+		ckSum, err := parseVerifyChecksum([][]driver.Value{{uint64(3), uint32(4294967295)}})
+		So(err, ShouldBeNil)
+		So(mysqlSum, ShouldResemble, verifyChecksum{Count: 3, Xor: 4294967295})
+		So(ckSum, ShouldResemble, mysqlSum)
+	})
+
+	Convey("empty result", t, func() {
+		_, err := parseVerifyChecksum(nil)
+		So(err, ShouldNotBeNil)
+	})
+}
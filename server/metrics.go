@@ -0,0 +1,308 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/brokercap/Bifrost/server/cluster"
+	"github.com/brokercap/Bifrost/server/count"
+	"github.com/brokercap/Bifrost/server/metrics"
+)
+
+// 一个 db 在采集时刻的状态快照
+type dbMetricsInfo struct {
+	Name                string
+	InputType           string
+	ConnStatus          StatusFlag
+	ConnErr             string
+	BinlogFileNum       int
+	BinlogDumpPosition  uint32
+	BinlogDumpTimestamp uint32
+	LastEventID         uint64
+	Content             count.CountContent
+	ToServerList        []toServerMetricsInfo
+}
+
+// 一个同步配置在采集时刻的状态快照
+type toServerMetricsInfo struct {
+	Labels            metrics.Labels
+	ToServerID        int
+	Status            StatusFlag
+	Error             string
+	QueueMsgCount     uint32
+	ThreadCount       int16
+	FileQueueStatus   bool
+	FileQueueFiles    int
+	FileQueueUnack    int
+	FileQueueBytes    int64
+	LastConsumeTime   int64
+	LastSuccessBinlog PositionStruct
+	Count             map[string]metrics.EventCount
+}
+
+func getMetricsDbList() []*db {
+	DbLock.Lock()
+	defer DbLock.Unlock()
+	dbList := make([]*db, 0, len(DbList))
+	for _, dbObj := range DbList {
+		dbList = append(dbList, dbObj)
+	}
+	sort.Slice(dbList, func(i, j int) bool {
+		return dbList[i].Name < dbList[j].Name
+	})
+	return dbList
+}
+
+func getDbMetricsInfo(dbObj *db) dbMetricsInfo {
+	dbObj.RLock()
+	info := dbMetricsInfo{
+		Name:                dbObj.Name,
+		InputType:           dbObj.InputType,
+		ConnStatus:          dbObj.ConnStatus,
+		ConnErr:             dbObj.ConnErr,
+		BinlogFileNum:       getBinlogFileNum(dbObj.binlogDumpFileName),
+		BinlogDumpPosition:  dbObj.binlogDumpPosition,
+		BinlogDumpTimestamp: dbObj.binlogDumpTimestamp,
+		LastEventID:         dbObj.lastEventID,
+	}
+	tableKeys := make([]string, 0, len(dbObj.tableMap))
+	for key := range dbObj.tableMap {
+		tableKeys = append(tableKeys, key)
+	}
+	sort.Strings(tableKeys)
+	toServerList := make([]*ToServer, 0)
+	for _, key := range tableKeys {
+		toServerList = append(toServerList, dbObj.tableMap[key].ToServerList...)
+	}
+	dbObj.RUnlock()
+	info.Content, _ = count.GetDbContent(info.Name)
+	for _, toServerInfo := range toServerList {
+		info.ToServerList = append(info.ToServerList, toServerInfo.getMetricsInfo(info.Name))
+	}
+	return info
+}
+
+func (This *ToServer) getMetricsInfo(dbName string) toServerMetricsInfo {
+	This.RLock()
+	defer This.RUnlock()
+	var SchemaName, TableName string
+	if This.Key != nil {
+		SchemaName, TableName = GetSchemaAndTableBySplit(*This.Key)
+	}
+	info := toServerMetricsInfo{
+		Labels: metrics.Labels{
+			"db":            dbName,
+			"schema":        SchemaName,
+			"table":         TableName,
+			"to_server_id":  fmt.Sprint(This.ToServerID),
+			"to_server_key": This.ToServerKey,
+			"plugin":        This.PluginName,
+		},
+		ToServerID:      This.ToServerID,
+		Status:          This.Status,
+		Error:           This.Error,
+		QueueMsgCount:   This.QueueMsgCount,
+		ThreadCount:     This.ThreadCount,
+		FileQueueStatus: This.FileQueueStatus,
+		LastConsumeTime: atomic.LoadInt64(&This.lastConsumeTime),
+		Count: metrics.GetToServerCount(metrics.ToServerKey{
+			DbName:     dbName,
+			SchemaName: SchemaName,
+			TableName:  TableName,
+			ToServerID: This.ToServerID,
+		}),
+	}
+	if This.LastSuccessBinlog != nil {
+		info.LastSuccessBinlog = *This.LastSuccessBinlog
+	}
+	if This.fileQueueObj != nil {
+		fileQueueInfo := This.fileQueueObj.GetInfo()
+		info.FileQueueFiles = fileQueueInfo.FileCount
+		for _, unackFile := range fileQueueInfo.UnackFileList {
+			info.FileQueueUnack += unackFile.UnackCount
+		}
+		info.FileQueueBytes = This.fileQueueObj.GetDiskSize()
+	}
+	return info
+}
+
+// mysql-bin.000001 => 1
+func getBinlogFileNum(binlogFileName string) (BinlogFileNum int) {
+	if binlogFileName == "" {
+		return
+	}
+	index := strings.IndexAny(binlogFileName, ".")
+	BinlogFileNum, _ = strconv.Atoi(binlogFileName[index+1:])
+	return
+}
+
+func lagSeconds(now int64, timestamp uint32) float64 {
+	if timestamp == 0 || now < int64(timestamp) {
+		return 0
+	}
+	return float64(now - int64(timestamp))
+}
+
+func copyLabels(labels metrics.Labels, kv ...string) metrics.Labels {
+	newLabels := make(metrics.Labels, len(labels)+len(kv)/2)
+	for k, v := range labels {
+		newLabels[k] = v
+	}
+	for i := 0; i+1 < len(kv); i += 2 {
+		newLabels[kv[i]] = kv[i+1]
+	}
+	return newLabels
+}
+
+// 输出所有 db 和 同步配置 的监控指标
+func WriteMetrics(w *metrics.Writer) {
+	now := time.Now().Unix()
+	dbList := getMetricsDbList()
+	dbInfoList := make([]dbMetricsInfo, 0, len(dbList))
+	for _, dbObj := range dbList {
+		dbInfoList = append(dbInfoList, getDbMetricsInfo(dbObj))
+	}
+
+	w.Family("bifrost_up", metrics.GAUGE, "Bifrost process is up")
+	w.Sample(nil, 1)
+
+	w.Family("bifrost_start_time_seconds", metrics.GAUGE, "Bifrost process start time in unix seconds")
+	w.Sample(nil, float64(GetServerStartTime().Unix()))
+
+	haStatus := cluster.GetStatus()
+	w.Family("bifrost_ha_leader", metrics.GAUGE, "1 if this node is the leader, always 1 when ha is disabled")
+	w.Sample(metrics.Labels{"node_id": haStatus.NodeID, "role": haStatus.Role}, metrics.BoolToFloat(cluster.IsLeader()))
+
+	if haStatus.Enable {
+		w.Family("bifrost_ha_lease_holder", metrics.GAUGE, "Node holding the leader lease, the sample with the current holder is 1")
+		w.Sample(metrics.Labels{"holder": haStatus.Holder.NodeID, "addr": haStatus.Holder.Addr}, 1)
+
+		w.Family("bifrost_ha_fencing_token", metrics.GAUGE, "Fencing token of the current leader")
+		w.Sample(nil, float64(haStatus.Token))
+
+		w.Family("bifrost_ha_config_load_time_seconds", metrics.GAUGE, "Last time the standby loaded the config in unix seconds")
+		w.Sample(nil, float64(haStatus.ConfigLoadTime))
+	}
+
+	w.Family("bifrost_db_status", metrics.GAUGE, "Input status of the db, the sample with the current status is 1")
+	for _, dbInfo := range dbInfoList {
+		w.Sample(metrics.Labels{"db": dbInfo.Name, "input_type": dbInfo.InputType, "status": string(dbInfo.ConnStatus)}, 1)
+	}
+
+	w.Family("bifrost_db_error", metrics.GAUGE, "1 if the input of the db has an error")
+	for _, dbInfo := range dbInfoList {
+		w.Sample(metrics.Labels{"db": dbInfo.Name}, metrics.BoolToFloat(dbInfo.ConnErr != ""))
+	}
+
+	w.Family("bifrost_db_position_timestamp_seconds", metrics.GAUGE, "Event timestamp of the last parsed source position")
+	for _, dbInfo := range dbInfoList {
+		w.Sample(metrics.Labels{"db": dbInfo.Name}, float64(dbInfo.BinlogDumpTimestamp))
+	}
+
+	w.Family("bifrost_db_lag_seconds", metrics.GAUGE, "Now minus event timestamp of the last parsed source position")
+	for _, dbInfo := range dbInfoList {
+		w.Sample(metrics.Labels{"db": dbInfo.Name}, lagSeconds(now, dbInfo.BinlogDumpTimestamp))
+	}
+
+	w.Family("bifrost_db_binlog_file_num", metrics.GAUGE, "Binlog file number of the last parsed source position")
+	for _, dbInfo := range dbInfoList {
+		w.Sample(metrics.Labels{"db": dbInfo.Name}, float64(dbInfo.BinlogFileNum))
+	}
+
+	w.Family("bifrost_db_binlog_position", metrics.GAUGE, "Binlog position of the last parsed source position")
+	for _, dbInfo := range dbInfoList {
+		w.Sample(metrics.Labels{"db": dbInfo.Name}, float64(dbInfo.BinlogDumpPosition))
+	}
+
+	w.Family("bifrost_db_last_event_id", metrics.GAUGE, "Last event id of the db")
+	for _, dbInfo := range dbInfoList {
+		w.Sample(metrics.Labels{"db": dbInfo.Name}, float64(dbInfo.LastEventID))
+	}
+
+	w.Family("bifrost_db_rows", metrics.COUNTER, "Rows dispatched to sync configs of the db")
+	for _, dbInfo := range dbInfoList {
+		w.Sample(metrics.Labels{"db": dbInfo.Name}, float64(dbInfo.Content.Count))
+	}
+
+	w.Family("bifrost_db_bytes", metrics.COUNTER, "Event bytes dispatched to sync configs of the db")
+	for _, dbInfo := range dbInfoList {
+		w.Sample(metrics.Labels{"db": dbInfo.Name}, float64(dbInfo.Content.ByteSize))
+	}
+
+	var toServerFamily = func(name string, help string, value func(info toServerMetricsInfo) float64) {
+		w.Family(name, metrics.GAUGE, help)
+		for _, dbInfo := range dbInfoList {
+			for _, info := range dbInfo.ToServerList {
+				w.Sample(info.Labels, value(info))
+			}
+		}
+	}
+
+	w.Family("bifrost_toserver_status", metrics.GAUGE, "Status of the sync config, the sample with the current status is 1")
+	for _, dbInfo := range dbInfoList {
+		for _, info := range dbInfo.ToServerList {
+			status := string(info.Status)
+			if status == "" {
+				status = "idle"
+			}
+			w.Sample(copyLabels(info.Labels, "status", status), 1)
+		}
+	}
+
+	toServerFamily("bifrost_toserver_error", "1 if the sync config is waiting on an error", func(info toServerMetricsInfo) float64 {
+		return metrics.BoolToFloat(info.Error != "")
+	})
+	toServerFamily("bifrost_toserver_queue_msg_count", "Messages in the memory queue of the sync config", func(info toServerMetricsInfo) float64 {
+		return float64(info.QueueMsgCount)
+	})
+	toServerFamily("bifrost_toserver_thread_count", "Consumer goroutines of the sync config", func(info toServerMetricsInfo) float64 {
+		return float64(info.ThreadCount)
+	})
+	toServerFamily("bifrost_toserver_filequeue_enabled", "1 if the sync config is reading from the file queue", func(info toServerMetricsInfo) float64 {
+		return metrics.BoolToFloat(info.FileQueueStatus)
+	})
+	toServerFamily("bifrost_toserver_filequeue_files", "Files in the file queue of the sync config", func(info toServerMetricsInfo) float64 {
+		return float64(info.FileQueueFiles)
+	})
+	toServerFamily("bifrost_toserver_filequeue_bytes", "Disk bytes of the file queue of the sync config", func(info toServerMetricsInfo) float64 {
+		return float64(info.FileQueueBytes)
+	})
+	toServerFamily("bifrost_toserver_filequeue_unack", "Messages loaded from the file queue and not acked yet", func(info toServerMetricsInfo) float64 {
+		return float64(info.FileQueueUnack)
+	})
+	toServerFamily("bifrost_toserver_last_success_timestamp_seconds", "Event timestamp of the last successfully synced position", func(info toServerMetricsInfo) float64 {
+		return float64(info.LastSuccessBinlog.Timestamp)
+	})
+	toServerFamily("bifrost_toserver_lag_seconds", "Now minus event timestamp of the last successfully synced position", func(info toServerMetricsInfo) float64 {
+		return lagSeconds(now, info.LastSuccessBinlog.Timestamp)
+	})
+
+	var toServerCountFamily = func(name string, help string, value func(c metrics.EventCount) int64) {
+		w.Family(name, metrics.COUNTER, help)
+		for _, dbInfo := range dbInfoList {
+			for _, info := range dbInfo.ToServerList {
+				eventTypes := make([]string, 0, len(info.Count))
+				for eventType := range info.Count {
+					eventTypes = append(eventTypes, eventType)
+				}
+				sort.Strings(eventTypes)
+				for _, eventType := range eventTypes {
+					w.Sample(copyLabels(info.Labels, "event_type", eventType), float64(value(info.Count[eventType])))
+				}
+			}
+		}
+	}
+	toServerCountFamily("bifrost_toserver_events", "Events processed by the sync config", func(c metrics.EventCount) int64 {
+		return c.Events
+	})
+	toServerCountFamily("bifrost_toserver_rows", "Rows processed by the sync config", func(c metrics.EventCount) int64 {
+		return c.Rows
+	})
+	toServerCountFamily("bifrost_toserver_bytes", "Event bytes processed by the sync config", func(c metrics.EventCount) int64 {
+		return c.Bytes
+	})
+}
@@ -0,0 +1,137 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type MetricType string
+
+const (
+	GAUGE   MetricType = "gauge"
+	COUNTER MetricType = "counter"
+)
+
+const (
+	OpenMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+	TextContentType        = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+type Labels map[string]string
+
+// Prometheus 抓取时 Accept 里带了 application/openmetrics-text 才输出 OpenMetrics 格式,否则输出老的 text 格式
+func NegotiateOpenMetrics(accept string) bool {
+	return strings.Contains(accept, "application/openmetrics-text")
+}
+
+// 按 OpenMetrics(或者 Prometheus text 0.0.4) 文本格式输出指标
+// 同一个指标的所有 sample 必须连续输出,所以先 Family 再 Sample
+type Writer struct {
+	w           *bufio.Writer
+	openMetrics bool
+	family      string
+	familyType  MetricType
+	err         error
+}
+
+func NewWriter(w io.Writer, openMetrics bool) *Writer {
+	return &Writer{
+		w:           bufio.NewWriter(w),
+		openMetrics: openMetrics,
+	}
+}
+
+func (This *Writer) ContentType() string {
+	if This.openMetrics {
+		return OpenMetricsContentType
+	}
+	return TextContentType
+}
+
+// 开始一个指标, counter 类型的 name 不需要带 _total 后缀
+func (This *Writer) Family(name string, metricType MetricType, help string) {
+	This.family = name
+	This.familyType = metricType
+	typeName := name
+	if metricType == COUNTER && !This.openMetrics {
+		typeName = name + "_total"
+	}
+	This.writeString("# HELP " + typeName + " " + escapeHelp(help) + "\n")
+	This.writeString("# TYPE " + typeName + " " + string(metricType) + "\n")
+}
+
+func (This *Writer) Sample(labels Labels, value float64) {
+	name := This.family
+	if This.familyType == COUNTER {
+		name += "_total"
+	}
+	This.writeString(name + formatLabels(labels) + " " + formatValue(value) + "\n")
+}
+
+// 输出结束, OpenMetrics 格式要求以 # EOF 结尾
+func (This *Writer) Close() error {
+	if This.openMetrics {
+		This.writeString("# EOF\n")
+	}
+	if This.err != nil {
+		return This.err
+	}
+	return This.w.Flush()
+}
+
+func (This *Writer) writeString(s string) {
+	if This.err != nil {
+		return
+	}
+	_, This.err = This.w.WriteString(s)
+}
+
+func formatLabels(labels Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(k)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabelValue(labels[k]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(s string) string {
+	return labelValueReplacer.Replace(s)
+}
+
+var helpReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+func BoolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
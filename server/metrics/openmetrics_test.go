@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWriter(t *testing.T) {
+	Convey("openmetrics format", t, func() {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, true)
+		So(w.ContentType(), ShouldEqual, OpenMetricsContentType)
+		w.Family("bifrost_db_lag_seconds", GAUGE, "lag")
+		w.Sample(Labels{"db": "mysqlTest"}, 1.5)
+		w.Family("bifrost_toserver_rows", COUNTER, "rows")
+		w.Sample(Labels{"db": "mysqlTest", "event_type": "insert"}, 10)
+		So(w.Close(), ShouldBeNil)
+		So(buf.String(), ShouldEqual, `# HELP bifrost_db_lag_seconds lag
+# TYPE bifrost_db_lag_seconds gauge
+bifrost_db_lag_seconds{db="mysqlTest"} 1.5
+# HELP bifrost_toserver_rows rows
+# TYPE bifrost_toserver_rows counter
+bifrost_toserver_rows_total{db="mysqlTest",event_type="insert"} 10
+# EOF
+`)
+	})
+
+	Convey("prometheus text format", t, func() {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, false)
+		So(w.ContentType(), ShouldEqual, TextContentType)
+		w.Family("bifrost_toserver_rows", COUNTER, "rows")
+		w.Sample(nil, 3)
+		So(w.Close(), ShouldBeNil)
+		So(buf.String(), ShouldEqual, `# HELP bifrost_toserver_rows_total rows
+# TYPE bifrost_toserver_rows_total counter
+bifrost_toserver_rows_total 3
+`)
+	})
+
+	Convey("escape label value", t, func() {
+		So(formatLabels(Labels{"b": "x\"y", "a": "c:\\d\ne"}), ShouldEqual, `{a="c:\\d\ne",b="x\"y"}`)
+	})
+
+	Convey("negotiate", t, func() {
+		So(NegotiateOpenMetrics("application/openmetrics-text;version=1.0.0,text/plain;q=0.5"), ShouldBeTrue)
+		So(NegotiateOpenMetrics("text/plain"), ShouldBeFalse)
+	})
+}
+
+func TestToServerCounter(t *testing.T) {
+	Convey("add and snapshot", t, func() {
+		key := ToServerKey{DbName: "mysqlTest", SchemaName: "bifrost_test", TableName: "binlog_field_test", ToServerID: 1}
+		defer DelToServerCounter(key)
+		So(GetToServerCount(key), ShouldBeNil)
+		counter := GetToServerCounter(key)
+		So(GetToServerCounter(key), ShouldEqual, counter)
+		counter.Add("insert", 2, 100)
+		counter.Add("insert", 1, 50)
+		counter.Add("commit", 0, 10)
+		So(GetToServerCount(key), ShouldResemble, map[string]EventCount{
+			"insert": {Events: 2, Rows: 3, Bytes: 150},
+			"commit": {Events: 1, Rows: 0, Bytes: 10},
+		})
+		DelToServerCounter(key)
+		So(GetToServerCount(key), ShouldBeNil)
+	})
+}
@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// 每个同步配置(ToServer)按事件类型累计处理过的 事件数,行数,字节数
+// 进程重启后从 0 开始, Prometheus 的 rate() 会自动处理计数器重置
+
+type ToServerKey struct {
+	DbName     string
+	SchemaName string
+	TableName  string
+	ToServerID int
+}
+
+type EventCount struct {
+	Events int64
+	Rows   int64
+	Bytes  int64
+}
+
+type ToServerCounter struct {
+	sync.RWMutex
+	eventTypeMap map[string]*EventCount
+}
+
+var l sync.RWMutex
+var toServerCounterMap = make(map[ToServerKey]*ToServerCounter, 0)
+
+func GetToServerCounter(key ToServerKey) *ToServerCounter {
+	l.RLock()
+	counter, ok := toServerCounterMap[key]
+	l.RUnlock()
+	if ok {
+		return counter
+	}
+	l.Lock()
+	defer l.Unlock()
+	if counter, ok = toServerCounterMap[key]; !ok {
+		counter = &ToServerCounter{eventTypeMap: make(map[string]*EventCount, 0)}
+		toServerCounterMap[key] = counter
+	}
+	return counter
+}
+
+// 同步配置被删除的时候调用,防止指标一直保留
+func DelToServerCounter(key ToServerKey) {
+	l.Lock()
+	delete(toServerCounterMap, key)
+	l.Unlock()
+}
+
+func (This *ToServerCounter) Add(eventType string, rows int64, bytes int64) {
+	This.RLock()
+	c, ok := This.eventTypeMap[eventType]
+	This.RUnlock()
+	if !ok {
+		This.Lock()
+		if c, ok = This.eventTypeMap[eventType]; !ok {
+			c = &EventCount{}
+			This.eventTypeMap[eventType] = c
+		}
+		This.Unlock()
+	}
+	atomic.AddInt64(&c.Events, 1)
+	atomic.AddInt64(&c.Rows, rows)
+	atomic.AddInt64(&c.Bytes, bytes)
+}
+
+func (This *ToServerCounter) Snapshot() map[string]EventCount {
+	This.RLock()
+	defer This.RUnlock()
+	data := make(map[string]EventCount, len(This.eventTypeMap))
+	for eventType, c := range This.eventTypeMap {
+		data[eventType] = EventCount{
+			Events: atomic.LoadInt64(&c.Events),
+			Rows:   atomic.LoadInt64(&c.Rows),
+			Bytes:  atomic.LoadInt64(&c.Bytes),
+		}
+	}
+	return data
+}
+
+// 只读取,不存在的时候不创建
+func GetToServerCount(key ToServerKey) map[string]EventCount {
+	l.RLock()
+	counter, ok := toServerCounterMap[key]
+	l.RUnlock()
+	if !ok {
+		return nil
+	}
+	return counter.Snapshot()
+}
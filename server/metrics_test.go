@@ -0,0 +1,65 @@
+package server
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	inputDriver "github.com/brokercap/Bifrost/input/driver"
+	"github.com/brokercap/Bifrost/server/metrics"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	Convey("db and toserver metrics", t, func() {
+		dbName := "metricsTest"
+		dbObj := NewDb(dbName, "mysql", inputDriver.InputInfo{BinlogFileName: "mysql-bin.000012", BinlogPostion: 120}, 0)
+		dbObj.ConnStatus = RUNNING
+		dbObj.binlogDumpTimestamp = uint32(time.Now().Unix() - 30)
+		key := GetSchemaAndTableJoin("bifrost_test", "binlog_field_test")
+		dbObj.tableMap[key] = &Table{key: key}
+		toServer := &ToServer{
+			Key:               &key,
+			ToServerID:        1,
+			ToServerKey:       "mysqlTarget",
+			PluginName:        "mysql",
+			Status:            RUNNING,
+			QueueMsgCount:     5,
+			Error:             "connect err",
+			LastSuccessBinlog: &PositionStruct{Timestamp: uint32(time.Now().Unix() - 60)},
+		}
+		dbObj.tableMap[key].ToServerList = []*ToServer{toServer}
+		DbLock.Lock()
+		DbList[dbName] = dbObj
+		DbLock.Unlock()
+		metricsKey := metrics.ToServerKey{DbName: dbName, SchemaName: "bifrost_test", TableName: "binlog_field_test", ToServerID: 1}
+		metrics.GetToServerCounter(metricsKey).Add("insert", 2, 100)
+		defer func() {
+			DbLock.Lock()
+			delete(DbList, dbName)
+			DbLock.Unlock()
+			metrics.DelToServerCounter(metricsKey)
+		}()
+
+		var buf bytes.Buffer
+		w := metrics.NewWriter(&buf, true)
+		WriteMetrics(w)
+		So(w.Close(), ShouldBeNil)
+		body := buf.String()
+		toServerLabels := `db="metricsTest",plugin="mysql",schema="bifrost_test",table="binlog_field_test",to_server_id="1",to_server_key="mysqlTarget"`
+		So(body, ShouldContainSubstring, `bifrost_db_status{db="metricsTest",input_type="mysql",status="running"} 1`)
+		So(body, ShouldContainSubstring, `bifrost_db_binlog_file_num{db="metricsTest"} 12`)
+		So(body, ShouldContainSubstring, `bifrost_db_binlog_position{db="metricsTest"} 120`)
+		So(body, ShouldContainSubstring, `bifrost_toserver_queue_msg_count{`+toServerLabels+`} 5`)
+		So(body, ShouldContainSubstring, `bifrost_toserver_error{`+toServerLabels+`} 1`)
+		So(body, ShouldContainSubstring, `bifrost_toserver_rows_total{`+toServerLabels[:len(`db="metricsTest"`)]+`,event_type="insert",`+toServerLabels[len(`db="metricsTest",`):]+`} 2`)
+		So(strings.HasSuffix(body, "# EOF\n"), ShouldBeTrue)
+		for _, line := range strings.Split(body, "\n") {
+			if strings.HasPrefix(line, `bifrost_db_lag_seconds{db="metricsTest"}`) {
+				So(line, ShouldBeIn, []string{`bifrost_db_lag_seconds{db="metricsTest"} 30`, `bifrost_db_lag_seconds{db="metricsTest"} 31`})
+			}
+		}
+	})
+}
@@ -356,10 +356,14 @@ func recoveryData(data map[string]dbSaveInfo, isStop bool) {
 						ToServerKey:       toServer.ToServerKey,
 						PluginName:        toServer.PluginName,
 						FieldList:         toServer.FieldList,
+						RowFilter:         toServer.RowFilter,
+						Transforms:        toServer.Transforms,
+						DeadLetterRetry:   toServer.DeadLetterRetry,
 						BinlogFileNum:     toServerBinlog.BinlogFileNum,
 						BinlogPosition:    toServerBinlog.BinlogPosition,
 						LastSuccessBinlog: toServerBinlog,
 						LastQueueBinlog:   toServerLastQueueBinlog,
+						SnapshotPosition:  toServer.SnapshotPosition,
 						PluginParam:       toServer.PluginParam,
 						FileQueueStatus:   toServer.FileQueueStatus,
 						Status:            status,
@@ -395,7 +399,7 @@ func recoveryData(data map[string]dbSaveInfo, isStop bool) {
 						continue
 					}
 					//假如当前同步配置 最后输入的 位点 等于 最后成功的位点，说明当前这个 同步配置的位点是没有问题的
-					if toServerBinlog.BinlogFileNum > 0 && toServerBinlog.BinlogFileNum == toServerLastQueueBinlog.BinlogFileNum && toServerBinlog.BinlogPosition == toServerLastQueueBinlog.BinlogPosition {
+					if toServerBinlog.BinlogFileNum > 0 && toServerBinlog.BinlogFileNum == toServerLastQueueBinlog.BinlogFileNum && toServerBinlog.BinlogPosition == toServerLastQueueBinlog.BinlogPosition && toServerBinlog.PayloadIndex == toServerLastQueueBinlog.PayloadIndex {
 						if lastAllToServerNoraml {
 							//假如所有表都还是正常同步的情况下，LastBinlog 取大值
 							LastBinlog0 := CompareBinlogPositionAndReturnGreater(toServerBinlog, LastBinlog)
@@ -426,7 +430,7 @@ func recoveryData(data map[string]dbSaveInfo, isStop bool) {
 						}
 					}
 					if toServer.LastBinlogFileNum == 0 && toServer.BinlogFileNum > 0 {
-						saveBinlogPosition(getToServerLastBinlogkey(db, toServer), toServerBinlog)
+						saveBinlogPosition(db.Name, getToServerLastBinlogkey(db, toServer), toServerBinlog)
 					}
 				}
 			}
@@ -494,8 +498,12 @@ func recoveryData(data map[string]dbSaveInfo, isStop bool) {
 		}
 	}
 
-	//启动同步的消费线程
-	for _, db := range DbList {
+	//启动同步的消费线程, 只处理这次恢复的数据源
+	for name := range data {
+		db := GetDBObj(name)
+		if db == nil {
+			continue
+		}
 		for tableKey, t := range db.tableMap {
 			for _, toServer := range t.ToServerList {
 				if toServer.FileQueueStatus == false {
@@ -542,47 +550,52 @@ func SaveDBInfoToFileData() interface{} {
 	var data map[string]dbSaveInfo
 	data = make(map[string]dbSaveInfo, 0)
 	for k, db := range DbList {
-		db.Lock()
-		// 假如数据源是mysql,没有开启gtid同步功能，但是又有gtid信息的情况下，但是后端又能获取到gtid信息，启退的时候,还是会获取到gtid进行保留
-		// db.isGtid 是在启动的时候判断是否有gtid
-		// 所以在退出保存配置的时候，也应该判断在启动数据源的时候，是否有真正gtid信息，否则直接为空，防止中间被自动，导致重启后使用不了
-		var gtid string
-		if db.isGtid {
-			gtid = db.gtid
-		}
-		data[k] = dbSaveInfo{
-			Name:                  db.Name,
-			InputType:             db.InputType,
-			ConnectUri:            db.ConnectUri,
-			ConnStatus:            db.ConnStatus,
-			LastChannelID:         db.LastChannelID,
-			BinlogDumpFileName:    db.binlogDumpFileName,
-			BinlogDumpPosition:    db.binlogDumpPosition,
-			IsGtid:                db.isGtid,
-			Gtid:                  gtid,
-			LastEventID:           db.lastEventID,
-			BinlogDumpTimestamp:   db.binlogDumpTimestamp,
-			MaxBinlogDumpFileName: db.maxBinlogDumpFileName,
-			MaxinlogDumpPosition:  db.maxBinlogDumpPosition,
-			ReplicateDoDb:         db.replicateDoDb,
-			ServerId:              db.serverId,
-			ChannelMap:            make(map[int]channelSaveInfo, 0),
-			TableMap:              db.tableMap,
-			AddTime:               db.AddTime,
-		}
-		for chid, c := range db.channelMap {
-			c.Lock()
-			data[k].ChannelMap[chid] = channelSaveInfo{
-				Name:             c.Name,
-				MaxThreadNum:     c.MaxThreadNum,
-				CurrentThreadNum: 0,
-				Status:           c.Status,
-			}
-			c.Unlock()
-		}
+		data[k] = getDbSaveInfo(db)
 		log.Println(k, data[k])
-		db.Unlock()
 	}
 	DbLock.Unlock()
 	return data
 }
+
+func getDbSaveInfo(db *db) dbSaveInfo {
+	db.Lock()
+	defer db.Unlock()
+	// 假如数据源是mysql,没有开启gtid同步功能，但是又有gtid信息的情况下，但是后端又能获取到gtid信息，启退的时候,还是会获取到gtid进行保留
+	// db.isGtid 是在启动的时候判断是否有gtid
+	// 所以在退出保存配置的时候，也应该判断在启动数据源的时候，是否有真正gtid信息，否则直接为空，防止中间被自动，导致重启后使用不了
+	var gtid string
+	if db.isGtid {
+		gtid = db.gtid
+	}
+	info := dbSaveInfo{
+		Name:                  db.Name,
+		InputType:             db.InputType,
+		ConnectUri:            db.ConnectUri,
+		ConnStatus:            db.ConnStatus,
+		LastChannelID:         db.LastChannelID,
+		BinlogDumpFileName:    db.binlogDumpFileName,
+		BinlogDumpPosition:    db.binlogDumpPosition,
+		IsGtid:                db.isGtid,
+		Gtid:                  gtid,
+		LastEventID:           db.lastEventID,
+		BinlogDumpTimestamp:   db.binlogDumpTimestamp,
+		MaxBinlogDumpFileName: db.maxBinlogDumpFileName,
+		MaxinlogDumpPosition:  db.maxBinlogDumpPosition,
+		ReplicateDoDb:         db.replicateDoDb,
+		ServerId:              db.serverId,
+		ChannelMap:            make(map[int]channelSaveInfo, 0),
+		TableMap:              db.tableMap,
+		AddTime:               db.AddTime,
+	}
+	for chid, c := range db.channelMap {
+		c.Lock()
+		info.ChannelMap[chid] = channelSaveInfo{
+			Name:             c.Name,
+			MaxThreadNum:     c.MaxThreadNum,
+			CurrentThreadNum: 0,
+			Status:           c.Status,
+		}
+		c.Unlock()
+	}
+	return info
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"sync"
+	"sync/atomic"
+
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+)
+
+// 表的行数据变更监听
+// 数据校验的时候, 源表和目标表是先后查询的, 校验过程中 binlog 里有变更的数据, 两边不一样不一定是不一致
+// 监听期间记录变更过的主键, 这些数据不算不一致, 也不修复
+
+// 最多记录的主键数, 超过之后当成所有数据都有变更
+const ROW_WATCHER_MAX_KEYS = 100000
+
+type RowWatcher struct {
+	sync.Mutex
+	DbName     string
+	SchemaName string
+	TableName  string
+	KeyFunc    func(row map[string]interface{}) string // 一行数据的主键值
+	keys       map[string]bool
+	overflow   bool
+}
+
+var rowWatcherLock sync.RWMutex
+var rowWatcherList = make([]*RowWatcher, 0)
+var rowWatcherCount int32
+
+func AddRowWatcher(watcher *RowWatcher) {
+	watcher.Lock()
+	watcher.keys = make(map[string]bool, 0)
+	watcher.overflow = false
+	watcher.Unlock()
+	rowWatcherLock.Lock()
+	defer rowWatcherLock.Unlock()
+	rowWatcherList = append(rowWatcherList, watcher)
+	atomic.StoreInt32(&rowWatcherCount, int32(len(rowWatcherList)))
+}
+
+func DelRowWatcher(watcher *RowWatcher) {
+	rowWatcherLock.Lock()
+	defer rowWatcherLock.Unlock()
+	for i, v := range rowWatcherList {
+		if v == watcher {
+			rowWatcherList = append(rowWatcherList[:i], rowWatcherList[i+1:]...)
+			break
+		}
+	}
+	atomic.StoreInt32(&rowWatcherCount, int32(len(rowWatcherList)))
+}
+
+// 监听开始之后, 这个主键的数据在 binlog 里是否有变更
+func (This *RowWatcher) IsChanged(key string) bool {
+	This.Lock()
+	defer This.Unlock()
+	return This.overflow || This.keys[key]
+}
+
+func (This *RowWatcher) add(rows []map[string]interface{}) {
+	This.Lock()
+	defer This.Unlock()
+	if This.overflow {
+		return
+	}
+	for _, row := range rows {
+		if len(This.keys) >= ROW_WATCHER_MAX_KEYS {
+			This.overflow = true
+			This.keys = nil
+			return
+		}
+		This.keys[This.KeyFunc(row)] = true
+	}
+}
+
+func (db *db) callbackRowWatcher(data *pluginDriver.PluginDataType) {
+	if atomic.LoadInt32(&rowWatcherCount) == 0 {
+		return
+	}
+	switch data.EventType {
+	case "insert", "update", "delete":
+		break
+	default:
+		return
+	}
+	rowWatcherLock.RLock()
+	defer rowWatcherLock.RUnlock()
+	for _, watcher := range rowWatcherList {
+		if watcher.DbName == db.Name && watcher.SchemaName == data.SchemaName && watcher.TableName == data.TableName {
+			// update 的前后两行都要记录, 主键有可能变了
+			watcher.add(data.Rows)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+)
+
+func TestDb_callbackRowWatcher(t *testing.T) {
+	dbObj := &db{Name: "mysqlTest"}
+	newWatcher := func() *RowWatcher {
+		watcher := &RowWatcher{
+			DbName:     "mysqlTest",
+			SchemaName: "bifrost_test",
+			TableName:  "binlog_field_test",
+			KeyFunc: func(row map[string]interface{}) string {
+				return fmt.Sprint(row["id"])
+			},
+		}
+		AddRowWatcher(watcher)
+		return watcher
+	}
+
+	Convey("update records both before and after keys", t, func() {
+		watcher := newWatcher()
+		defer DelRowWatcher(watcher)
+		dbObj.callbackRowWatcher(&pluginDriver.PluginDataType{
+			EventType:  "update",
+			SchemaName: "bifrost_test",
+			TableName:  "binlog_field_test",
+			Rows:       []map[string]interface{}{{"id": int64(1)}, {"id": int64(2)}},
+		})
+		So(watcher.IsChanged("1"), ShouldBeTrue)
+		So(watcher.IsChanged("2"), ShouldBeTrue)
+		So(watcher.IsChanged("3"), ShouldBeFalse)
+	})
+
+	Convey("other tables and sql events are ignored", t, func() {
+		watcher := newWatcher()
+		defer DelRowWatcher(watcher)
+		dbObj.callbackRowWatcher(&pluginDriver.PluginDataType{
+			EventType:  "insert",
+			SchemaName: "bifrost_test",
+			TableName:  "other_table",
+			Rows:       []map[string]interface{}{{"id": int64(1)}},
+		})
+		dbObj.callbackRowWatcher(&pluginDriver.PluginDataType{
+			EventType:  "sql",
+			SchemaName: "bifrost_test",
+			TableName:  "binlog_field_test",
+			Query:      "ALTER TABLE binlog_field_test ADD COLUMN c int",
+		})
+		So(watcher.IsChanged("1"), ShouldBeFalse)
+	})
+
+	Convey("too many keys, all keys are changed", t, func() {
+		watcher := newWatcher()
+		defer DelRowWatcher(watcher)
+		rows := make([]map[string]interface{}, ROW_WATCHER_MAX_KEYS+1)
+		for i := range rows {
+			rows[i] = map[string]interface{}{"id": i}
+		}
+		dbObj.callbackRowWatcher(&pluginDriver.PluginDataType{
+			EventType:  "delete",
+			SchemaName: "bifrost_test",
+			TableName:  "binlog_field_test",
+			Rows:       rows,
+		})
+		So(watcher.IsChanged("-1"), ShouldBeTrue)
+	})
+
+	Convey("deleted watcher does not record", t, func() {
+		watcher := newWatcher()
+		DelRowWatcher(watcher)
+		dbObj.callbackRowWatcher(&pluginDriver.PluginDataType{
+			EventType:  "insert",
+			SchemaName: "bifrost_test",
+			TableName:  "binlog_field_test",
+			Rows:       []map[string]interface{}{{"id": int64(1)}},
+		})
+		So(watcher.IsChanged("1"), ShouldBeFalse)
+	})
+}
@@ -0,0 +1,413 @@
+package rowfilter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 和 mysql 一样是三值逻辑, 和 NULL 比较的结果是 unknown, unknown 最后按不匹配处理
+type tri int8
+
+const (
+	triFalse tri = iota
+	triTrue
+	triUnknown
+)
+
+func toTri(b bool) tri {
+	if b {
+		return triTrue
+	}
+	return triFalse
+}
+
+func (t tri) not() tri {
+	switch t {
+	case triTrue:
+		return triFalse
+	case triFalse:
+		return triTrue
+	}
+	return triUnknown
+}
+
+type Filter struct {
+	where   string
+	root    node
+	columns []string
+}
+
+func (f *Filter) String() string {
+	return f.where
+}
+
+// 表达式中用到的字段
+func (f *Filter) Columns() []string {
+	if f == nil {
+		return nil
+	}
+	return f.columns
+}
+
+// 行数据是否满足过滤条件, 不存在的字段当作 NULL 处理
+func (f *Filter) Match(row map[string]interface{}) bool {
+	if f == nil {
+		return true
+	}
+	return f.root.eval(row) == triTrue
+}
+
+type node interface {
+	eval(row map[string]interface{}) tri
+}
+
+type operand interface {
+	value(row map[string]interface{}) interface{}
+}
+
+type column struct {
+	name string
+}
+
+func (c *column) value(row map[string]interface{}) interface{} {
+	return row[c.name]
+}
+
+type literal struct {
+	val interface{}
+}
+
+func (l *literal) value(row map[string]interface{}) interface{} {
+	return l.val
+}
+
+type andNode struct {
+	left, right node
+}
+
+func (n *andNode) eval(row map[string]interface{}) tri {
+	l := n.left.eval(row)
+	if l == triFalse {
+		return triFalse
+	}
+	r := n.right.eval(row)
+	if r == triFalse {
+		return triFalse
+	}
+	if l == triTrue && r == triTrue {
+		return triTrue
+	}
+	return triUnknown
+}
+
+type orNode struct {
+	left, right node
+}
+
+func (n *orNode) eval(row map[string]interface{}) tri {
+	l := n.left.eval(row)
+	if l == triTrue {
+		return triTrue
+	}
+	r := n.right.eval(row)
+	if r == triTrue {
+		return triTrue
+	}
+	if l == triFalse && r == triFalse {
+		return triFalse
+	}
+	return triUnknown
+}
+
+type notNode struct {
+	n node
+}
+
+func (n *notNode) eval(row map[string]interface{}) tri {
+	return n.n.eval(row).not()
+}
+
+type compareNode struct {
+	op          string
+	left, right operand
+}
+
+func (n *compareNode) eval(row map[string]interface{}) tri {
+	c, ok := compare(n.left.value(row), n.right.value(row))
+	if !ok {
+		return triUnknown
+	}
+	switch n.op {
+	case "=":
+		return toTri(c == 0)
+	case "!=", "<>":
+		return toTri(c != 0)
+	case "<":
+		return toTri(c < 0)
+	case "<=":
+		return toTri(c <= 0)
+	case ">":
+		return toTri(c > 0)
+	case ">=":
+		return toTri(c >= 0)
+	}
+	return triUnknown
+}
+
+type isNullNode struct {
+	operand operand
+	not     bool
+}
+
+func (n *isNullNode) eval(row map[string]interface{}) tri {
+	return toTri((n.operand.value(row) == nil) != n.not)
+}
+
+type inNode struct {
+	operand operand
+	list    []operand
+	not     bool
+}
+
+func (n *inNode) eval(row map[string]interface{}) tri {
+	v := n.operand.value(row)
+	result := triFalse
+	for _, o := range n.list {
+		c, ok := compare(v, o.value(row))
+		if !ok {
+			result = triUnknown
+			continue
+		}
+		if c == 0 {
+			result = triTrue
+			break
+		}
+	}
+	if n.not {
+		return result.not()
+	}
+	return result
+}
+
+type likeNode struct {
+	operand operand
+	pattern operand
+	not     bool
+}
+
+func (n *likeNode) eval(row map[string]interface{}) tri {
+	v, p := n.operand.value(row), n.pattern.value(row)
+	if v == nil || p == nil {
+		return triUnknown
+	}
+	result := toTri(like(strings.ToLower(toString(v)), strings.ToLower(toString(p))))
+	if n.not {
+		return result.not()
+	}
+	return result
+}
+
+type betweenNode struct {
+	operand  operand
+	from, to operand
+	not      bool
+}
+
+func (n *betweenNode) eval(row map[string]interface{}) tri {
+	v := n.operand.value(row)
+	c1, ok1 := compare(v, n.from.value(row))
+	c2, ok2 := compare(v, n.to.value(row))
+	var result tri
+	switch {
+	case ok1 && c1 < 0, ok2 && c2 > 0:
+		result = triFalse
+	case ok1 && ok2:
+		result = triTrue
+	default:
+		result = triUnknown
+	}
+	if n.not {
+		return result.not()
+	}
+	return result
+}
+
+type truthNode struct {
+	operand operand
+}
+
+func (n *truthNode) eval(row map[string]interface{}) tri {
+	c, ok := compare(n.operand.value(row), number{i: 0, isInt: true})
+	if !ok {
+		return triUnknown
+	}
+	return toTri(c != 0)
+}
+
+type number struct {
+	i     int64
+	f     float64
+	isInt bool
+}
+
+func (n number) float() float64 {
+	if n.isInt {
+		return float64(n.i)
+	}
+	return n.f
+}
+
+func toNumber(v interface{}) (number, bool) {
+	switch val := v.(type) {
+	case number:
+		return val, true
+	case int:
+		return number{i: int64(val), isInt: true}, true
+	case int8:
+		return number{i: int64(val), isInt: true}, true
+	case int16:
+		return number{i: int64(val), isInt: true}, true
+	case int32:
+		return number{i: int64(val), isInt: true}, true
+	case int64:
+		return number{i: val, isInt: true}, true
+	case uint8:
+		return number{i: int64(val), isInt: true}, true
+	case uint16:
+		return number{i: int64(val), isInt: true}, true
+	case uint32:
+		return number{i: int64(val), isInt: true}, true
+	case uint:
+		return uintToNumber(uint64(val)), true
+	case uint64:
+		return uintToNumber(val), true
+	case float32:
+		return number{f: float64(val)}, true
+	case float64:
+		return number{f: val}, true
+	case bool:
+		if val {
+			return number{i: 1, isInt: true}, true
+		}
+		return number{i: 0, isInt: true}, true
+	case string:
+		s := strings.TrimSpace(val)
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return number{i: i, isInt: true}, true
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return number{f: f}, true
+		}
+	}
+	return number{}, false
+}
+
+func uintToNumber(v uint64) number {
+	if v > 1<<63-1 {
+		return number{f: float64(v)}
+	}
+	return number{i: int64(v), isInt: true}
+}
+
+func toString(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case []byte:
+		return string(val)
+	case number:
+		if val.isInt {
+			return strconv.FormatInt(val.i, 10)
+		}
+		return strconv.FormatFloat(val.f, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// 和 mysql 一样, 两边有一边是数字的时候按数字比较, 否则按字符串比较
+// 任意一边为 NULL 的时候返回 ok = false
+func compare(a, b interface{}) (c int, ok bool) {
+	if a == nil || b == nil {
+		return 0, false
+	}
+	_, aIsString := a.(string)
+	_, bIsString := b.(string)
+	if !aIsString || !bIsString {
+		na, okA := toNumber(a)
+		nb, okB := toNumber(b)
+		if okA && okB {
+			return compareNumber(na, nb), true
+		}
+	}
+	sa, sb := toString(a), toString(b)
+	switch {
+	case sa < sb:
+		return -1, true
+	case sa > sb:
+		return 1, true
+	}
+	return 0, true
+}
+
+func compareNumber(a, b number) int {
+	if a.isInt && b.isInt {
+		switch {
+		case a.i < b.i:
+			return -1
+		case a.i > b.i:
+			return 1
+		}
+		return 0
+	}
+	fa, fb := a.float(), b.float()
+	switch {
+	case fa < fb:
+		return -1
+	case fa > fb:
+		return 1
+	}
+	return 0
+}
+
+// LIKE 匹配, % 匹配任意多个字符, _ 匹配一个字符, \ 转义
+func like(s, pattern string) bool {
+	sr, pr := []rune(s), []rune(pattern)
+	var match func(i, j int) bool
+	match = func(i, j int) bool {
+		for j < len(pr) {
+			switch pr[j] {
+			case '%':
+				for j < len(pr) && pr[j] == '%' {
+					j++
+				}
+				if j == len(pr) {
+					return true
+				}
+				for k := i; k <= len(sr); k++ {
+					if match(k, j) {
+						return true
+					}
+				}
+				return false
+			case '_':
+				if i >= len(sr) {
+					return false
+				}
+			case '\\':
+				if j+1 < len(pr) {
+					j++
+				}
+				fallthrough
+			default:
+				if i >= len(sr) || sr[i] != pr[j] {
+					return false
+				}
+			}
+			i++
+			j++
+		}
+		return i == len(sr)
+	}
+	return match(0, 0)
+}
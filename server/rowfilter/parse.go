@@ -0,0 +1,362 @@
+package rowfilter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 行过滤表达式, 语法是 mysql WHERE 条件的子集, 和 history 全量任务里的 Where 写法一样
+// 支持: = != <> < <= > >= , IS [NOT] NULL , [NOT] IN (...) , [NOT] LIKE , [NOT] BETWEEN ... AND ... , AND OR NOT 以及括号
+// 例如: tenant_id = 42 AND status != 'draft'
+
+type tokenType int8
+
+const (
+	tokenEOF tokenType = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOp
+)
+
+type token struct {
+	typ    tokenType
+	val    string
+	pos    int
+	quoted bool // `name` 括起来的字段名
+}
+
+func tokenize(s string) (tokens []token, err error) {
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '\'' || c == '"':
+			start := i
+			var b strings.Builder
+			i++
+			for {
+				if i >= len(s) {
+					return nil, fmt.Errorf("string not closed at %d", start)
+				}
+				if s[i] == '\\' && i+1 < len(s) {
+					b.WriteByte(s[i+1])
+					i += 2
+					continue
+				}
+				if s[i] == c {
+					// '' 转义成 '
+					if i+1 < len(s) && s[i+1] == c {
+						b.WriteByte(c)
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				b.WriteByte(s[i])
+				i++
+			}
+			tokens = append(tokens, token{typ: tokenString, val: b.String(), pos: start})
+		case c == '`':
+			end := strings.IndexByte(s[i+1:], '`')
+			if end < 0 {
+				return nil, fmt.Errorf("identifier not closed at %d", i)
+			}
+			tokens = append(tokens, token{typ: tokenIdent, val: s[i+1 : i+1+end], pos: i, quoted: true})
+			i += end + 2
+		case c >= '0' && c <= '9' || c == '.' || (c == '-' && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9' && isOperandExpected(tokens)):
+			start := i
+			i++
+			for i < len(s) && (s[i] >= '0' && s[i] <= '9' || s[i] == '.' || s[i] == 'e' || s[i] == 'E' ||
+				((s[i] == '-' || s[i] == '+') && (s[i-1] == 'e' || s[i-1] == 'E'))) {
+				i++
+			}
+			tokens = append(tokens, token{typ: tokenNumber, val: s[start:i], pos: start})
+		case isIdentChar(c):
+			start := i
+			for i < len(s) && (isIdentChar(s[i]) || s[i] >= '0' && s[i] <= '9') {
+				i++
+			}
+			tokens = append(tokens, token{typ: tokenIdent, val: s[start:i], pos: start})
+		default:
+			var op string
+			for _, v := range []string{"<=", ">=", "<>", "!=", "=", "<", ">", "(", ")", ","} {
+				if strings.HasPrefix(s[i:], v) {
+					op = v
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected char %q at %d", c, i)
+			}
+			tokens = append(tokens, token{typ: tokenOp, val: op, pos: i})
+			i += len(op)
+		}
+	}
+	tokens = append(tokens, token{typ: tokenEOF, pos: len(s)})
+	return
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// 负号前面是操作符或者是开头的时候,才是负数
+func isOperandExpected(tokens []token) bool {
+	if len(tokens) == 0 {
+		return true
+	}
+	last := tokens[len(tokens)-1]
+	return last.typ == tokenOp && last.val != ")" || last.typ == tokenIdent && !last.quoted && isKeyword(last.val)
+}
+
+func isKeyword(s string) bool {
+	switch strings.ToUpper(s) {
+	case "AND", "OR", "NOT", "IS", "IN", "LIKE", "BETWEEN":
+		return true
+	}
+	return false
+}
+
+type parser struct {
+	tokens  []token
+	pos     int
+	columns []string
+}
+
+// 记录表达式中用到的字段, 行数据不完整的时候需要判断这些字段是否存在
+func (p *parser) newColumn(name string) *column {
+	var exist bool
+	for _, v := range p.columns {
+		if v == name {
+			exist = true
+			break
+		}
+	}
+	if !exist {
+		p.columns = append(p.columns, name)
+	}
+	return &column{name: name}
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.typ != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isKeyword(keyword string) bool {
+	t := p.peek()
+	return t.typ == tokenIdent && !t.quoted && strings.EqualFold(t.val, keyword)
+}
+
+func (p *parser) acceptKeyword(keyword string) bool {
+	if p.isKeyword(keyword) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) acceptOp(op string) bool {
+	t := p.peek()
+	if t.typ == tokenOp && t.val == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectOp(op string) error {
+	if !p.acceptOp(op) {
+		return p.errorf("expected %s", op)
+	}
+	return nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	t := p.peek()
+	if t.typ == tokenEOF {
+		return fmt.Errorf(format+" at end", args...)
+	}
+	return fmt.Errorf(format+" near %q at %d", append(args, t.val, t.pos)...)
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.acceptKeyword("NOT") {
+		n, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{n: n}, nil
+	}
+	return p.parsePredicate()
+}
+
+func (p *parser) parsePredicate() (node, error) {
+	if p.acceptOp("(") {
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return n, p.expectOp(")")
+	}
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	if t.typ == tokenOp {
+		switch t.val {
+		case "=", "!=", "<>", "<", "<=", ">", ">=":
+			p.next()
+			right, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			return &compareNode{op: t.val, left: left, right: right}, nil
+		}
+	}
+	if p.acceptKeyword("IS") {
+		not := p.acceptKeyword("NOT")
+		if !p.acceptKeyword("NULL") {
+			return nil, p.errorf("expected NULL")
+		}
+		return &isNullNode{operand: left, not: not}, nil
+	}
+	not := p.acceptKeyword("NOT")
+	switch {
+	case p.acceptKeyword("IN"):
+		if err = p.expectOp("("); err != nil {
+			return nil, err
+		}
+		n := &inNode{operand: left, not: not}
+		for {
+			v, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			n.list = append(n.list, v)
+			if !p.acceptOp(",") {
+				break
+			}
+		}
+		return n, p.expectOp(")")
+	case p.acceptKeyword("LIKE"):
+		pattern, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &likeNode{operand: left, pattern: pattern, not: not}, nil
+	case p.acceptKeyword("BETWEEN"):
+		from, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if !p.acceptKeyword("AND") {
+			return nil, p.errorf("expected AND")
+		}
+		to, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &betweenNode{operand: left, from: from, to: to, not: not}, nil
+	}
+	if not {
+		return nil, p.errorf("expected IN, LIKE or BETWEEN")
+	}
+	// 单独一个字段或者常量, 和 mysql 一样按是否非 0 判断
+	return &truthNode{operand: left}, nil
+}
+
+func (p *parser) parseOperand() (operand, error) {
+	t := p.next()
+	switch t.typ {
+	case tokenString:
+		return &literal{val: t.val}, nil
+	case tokenNumber:
+		num, ok := toNumber(t.val)
+		if !ok {
+			return nil, fmt.Errorf("number %q format error at %d", t.val, t.pos)
+		}
+		return &literal{val: num}, nil
+	case tokenIdent:
+		if t.quoted {
+			return p.newColumn(t.val), nil
+		}
+		switch strings.ToUpper(t.val) {
+		case "NULL":
+			return &literal{val: nil}, nil
+		case "TRUE":
+			return &literal{val: number{i: 1, isInt: true}}, nil
+		case "FALSE":
+			return &literal{val: number{i: 0, isInt: true}}, nil
+		}
+		// 关键字不能直接作为字段名, 需要用 ` 括起来
+		if isKeyword(t.val) {
+			return nil, fmt.Errorf("unexpected keyword %s at %d", t.val, t.pos)
+		}
+		return p.newColumn(t.val), nil
+	case tokenEOF:
+		return nil, fmt.Errorf("unexpected end")
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", t.val, t.pos)
+}
+
+// 解析行过滤表达式, 表达式为空的时候返回 nil, nil
+func Parse(where string) (*Filter, error) {
+	if strings.TrimSpace(where) == "" {
+		return nil, nil
+	}
+	tokens, err := tokenize(where)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().typ != tokenEOF {
+		return nil, p.errorf("unexpected")
+	}
+	return &Filter{where: where, root: root, columns: p.columns}, nil
+}
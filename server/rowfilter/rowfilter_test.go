@@ -0,0 +1,104 @@
+package rowfilter
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func match(where string, row map[string]interface{}) bool {
+	f, err := Parse(where)
+	So(err, ShouldBeNil)
+	return f.Match(row)
+}
+
+func TestParse(t *testing.T) {
+	Convey("empty", t, func() {
+		f, err := Parse("  ")
+		So(err, ShouldBeNil)
+		So(f, ShouldBeNil)
+		So(f.Match(map[string]interface{}{}), ShouldBeTrue)
+	})
+
+	Convey("error", t, func() {
+		for _, where := range []string{
+			"tenant_id =",
+			"tenant_id = 'abc",
+			"(tenant_id = 1",
+			"tenant_id = 1 status = 2",
+			"tenant_id NOT 1",
+			"tenant_id IN ()",
+			"tenant_id BETWEEN 1 10",
+			"AND = 1",
+			"tenant_id # 1",
+		} {
+			_, err := Parse(where)
+			So(err, ShouldNotBeNil)
+		}
+	})
+
+	Convey("columns", t, func() {
+		f, err := Parse("tenant_id = 42 AND (status != 'draft' OR `tenant_id` IN (1, 2)) AND 'a' = 'a'")
+		So(err, ShouldBeNil)
+		So(f.Columns(), ShouldResemble, []string{"tenant_id", "status"})
+	})
+
+	Convey("keyword column", t, func() {
+		So(match("`not` = 1", map[string]interface{}{"not": int64(1)}), ShouldBeTrue)
+	})
+}
+
+func TestFilter_Match(t *testing.T) {
+	row := map[string]interface{}{
+		"tenant_id": int64(42),
+		"status":    "published",
+		"price":     float64(10.5),
+		"big":       uint64(18446744073709551615),
+		"deleted":   false,
+		"name":      "Bifrost_Test",
+		"note":      nil,
+	}
+
+	Convey("compare", t, func() {
+		So(match("tenant_id = 42 AND status != 'draft'", row), ShouldBeTrue)
+		So(match("tenant_id = 43 AND status != 'draft'", row), ShouldBeFalse)
+		So(match("tenant_id = '42'", row), ShouldBeTrue)
+		So(match("tenant_id <> 42", row), ShouldBeFalse)
+		So(match("price > 10 AND price <= 10.5", row), ShouldBeTrue)
+		So(match("price >= -1", row), ShouldBeTrue)
+		So(match("big > 9223372036854775807", row), ShouldBeTrue)
+		So(match("status > 'a'", row), ShouldBeTrue)
+		So(match("status = \"published\"", row), ShouldBeTrue)
+	})
+
+	Convey("and or not", t, func() {
+		So(match("tenant_id = 1 OR status = 'published'", row), ShouldBeTrue)
+		So(match("NOT (tenant_id = 1 OR status = 'draft')", row), ShouldBeTrue)
+		So(match("tenant_id = 42 AND (status = 'draft' OR price > 10)", row), ShouldBeTrue)
+		So(match("deleted", row), ShouldBeFalse)
+		So(match("NOT deleted", row), ShouldBeTrue)
+		So(match("deleted = false", row), ShouldBeTrue)
+	})
+
+	Convey("null", t, func() {
+		So(match("note IS NULL", row), ShouldBeTrue)
+		So(match("not_exist IS NULL", row), ShouldBeTrue)
+		So(match("status IS NOT NULL", row), ShouldBeTrue)
+		So(match("note = 'a'", row), ShouldBeFalse)
+		So(match("NOT note = 'a'", row), ShouldBeFalse)
+		So(match("note = 'a' OR tenant_id = 42", row), ShouldBeTrue)
+		So(match("tenant_id NOT IN (1, NULL)", row), ShouldBeFalse)
+	})
+
+	Convey("in like between", t, func() {
+		So(match("tenant_id IN (1, 42, 43)", row), ShouldBeTrue)
+		So(match("tenant_id NOT IN (1, 2)", row), ShouldBeTrue)
+		So(match("status IN ('draft')", row), ShouldBeFalse)
+		So(match("name LIKE 'bifrost%'", row), ShouldBeTrue)
+		So(match("name LIKE 'bifrost\\_t_st'", row), ShouldBeTrue)
+		So(match("name NOT LIKE '%test'", row), ShouldBeFalse)
+		So(match("name LIKE 'bifrost'", row), ShouldBeFalse)
+		So(match("tenant_id BETWEEN 40 AND 50 AND status = 'published'", row), ShouldBeTrue)
+		So(match("tenant_id NOT BETWEEN 40 AND 50", row), ShouldBeFalse)
+	})
+}
@@ -4,9 +4,11 @@ import (
 	"encoding/json"
 	"github.com/brokercap/Bifrost/config"
 	"github.com/brokercap/Bifrost/plugin"
+	"github.com/brokercap/Bifrost/server/cluster"
 	"github.com/brokercap/Bifrost/server/storage"
 	"github.com/brokercap/Bifrost/server/user"
 	"github.com/brokercap/Bifrost/server/warning"
+	"hash/crc32"
 	"log"
 	"sync"
 	"time"
@@ -15,21 +17,25 @@ import (
 var l sync.RWMutex
 
 type recovery struct {
-	Version   string
-	StartTime time.Time
-	ToServer  *json.RawMessage
-	DbInfo    *json.RawMessage
-	User      *json.RawMessage
-	Warning   *json.RawMessage
+	Version     string
+	StartTime   time.Time
+	ToServer    *json.RawMessage
+	DbInfo      *json.RawMessage
+	User        *json.RawMessage
+	Role        *json.RawMessage
+	Warning     *json.RawMessage
+	WarningRule *json.RawMessage
 }
 
 type recoveryDataSturct struct {
-	Version   string
-	StartTime time.Time
-	ToServer  interface{}
-	DbInfo    interface{}
-	User      interface{}
-	Warning   interface{}
+	Version     string
+	StartTime   time.Time
+	ToServer    interface{}
+	DbInfo      interface{}
+	User        interface{}
+	Role        interface{}
+	Warning     interface{}
+	WarningRule interface{}
 }
 
 func DoRecoverySnapshotData() {
@@ -55,7 +61,12 @@ func DoRecoverySnapshotData() {
 		plugin.Recovery(data.ToServer)
 	}
 	if data.DbInfo != nil && string(*data.DbInfo) != "{}" {
-		Recovery(data.DbInfo, false)
+		// shard 模式下数据源分配到当前节点之后再加载
+		if cluster.ShardEnable() {
+			initShardData(data.DbInfo)
+		} else {
+			Recovery(data.DbInfo, false)
+		}
 	}
 	if data.User != nil && string(*data.User) != "[]" {
 		user.RecoveryUser(data.User)
@@ -67,6 +78,49 @@ func DoRecoverySnapshotData() {
 
 }
 
+var standbySnapshotCrc uint32
+
+// ha standby 定时加载 leader 保存的配置, 只加载 目标库 配置
+// 数据源和同步配置在成为 leader 之后再从存储里恢复, 位点用 leader 最后持久化的
+func LoadStandbySnapshotData() error {
+	fd, err := storage.GetDBInfo()
+	if err != nil {
+		return err
+	}
+	if len(fd) == 0 {
+		return nil
+	}
+	crc := crc32.ChecksumIEEE(fd)
+	if crc == standbySnapshotCrc {
+		return nil
+	}
+	var data recovery
+	if err = json.Unmarshal(fd, &data); err != nil {
+		return err
+	}
+	if data.ToServer != nil && string(*data.ToServer) != "{}" {
+		plugin.Recovery(data.ToServer)
+	}
+	standbySnapshotCrc = crc
+	log.Println("load cluster config success, crc:", crc)
+	return nil
+}
+
+// ha 失去 leader, 停止所有数据源并从内存里移除, 回到 standby
+// 不保存配置, 重新成为 leader 的时候从存储里恢复
+func UnloadAllDB() {
+	DbLock.Lock()
+	dbList := make([]*db, 0, len(DbList))
+	for _, dbObj := range DbList {
+		dbList = append(dbList, dbObj)
+	}
+	DbLock.Unlock()
+	for _, dbObj := range dbList {
+		unloadDB(dbObj)
+	}
+	standbySnapshotCrc = 0
+}
+
 func GetSnapshotData() ([]byte, error) {
 	l.Lock()
 	defer func() {
@@ -76,12 +130,14 @@ func GetSnapshotData() ([]byte, error) {
 		}
 	}()
 	data := recoveryDataSturct{
-		Version:   config.VERSION,
-		StartTime: GetServerStartTime(),
-		ToServer:  plugin.SaveToServerData(),
-		DbInfo:    SaveDBInfoToFileData(),
-		User:      user.GetUserList(),
-		Warning:   warning.GetWarningConfigList(),
+		Version:     config.VERSION,
+		StartTime:   GetServerStartTime(),
+		ToServer:    plugin.SaveToServerData(),
+		DbInfo:      getClusterDBInfo(),
+		User:        user.GetUserList(),
+		Role:        user.GetRoleList(),
+		Warning:     warning.GetWarningConfigList(),
+		WarningRule: warning.GetWarningRuleList(),
 	}
 	return json.Marshal(data)
 }
@@ -101,9 +157,27 @@ func GetSnapshotData2() ([]byte, error) {
 		ToServer:  plugin.SaveToServerData(),
 		DbInfo:    SaveDBInfoToFileData(),
 	}
+	// shard 模式下数据源单独保存
+	if cluster.ShardEnable() {
+		data.DbInfo = map[string]dbSaveInfo{}
+	}
 	return json.Marshal(data)
 }
 
+// 备份的时候, shard 模式下不在当前节点上的数据源从存储里取
+func getClusterDBInfo() interface{} {
+	data := SaveDBInfoToFileData().(map[string]dbSaveInfo)
+	if !cluster.ShardEnable() {
+		return data
+	}
+	for name, info := range getShardDbInfoList() {
+		if _, ok := data[name]; !ok {
+			data[name] = info
+		}
+	}
+	return data
+}
+
 func DoSaveSnapshotData() {
 	var data []byte
 	var err error
@@ -118,7 +192,13 @@ func DoSaveSnapshotData() {
 		SaveDBConfigInfo()
 		return
 	}
-	storage.SaveDBInfo(data)
+	// shard 模式下全局配置只由 coordinator 保存
+	if cluster.IsCoordinator() {
+		storage.SaveDBInfo(data)
+	}
+	if cluster.ShardEnable() {
+		saveShardDBInfo()
+	}
 }
 
 func DoRecoveryByBackupData(fileContent string) {
@@ -133,11 +213,22 @@ func DoRecoveryByBackupData(fileContent string) {
 		plugin.Recovery(data.ToServer)
 	}
 	if string(*data.DbInfo) != "{}" {
-		Recovery(data.DbInfo, true)
+		// shard 模式下只导入集群里还没有的数据源, 由分配到的节点加载
+		if cluster.ShardEnable() {
+			initShardData(data.DbInfo)
+		} else {
+			Recovery(data.DbInfo, true)
+		}
 	}
 	if string(*data.Warning) != "{}" {
 		warning.RecoveryWarning(data.Warning)
 	}
+	if data.WarningRule != nil && string(*data.WarningRule) != "[]" {
+		warning.RecoveryWarningRule(data.WarningRule)
+	}
+	if data.Role != nil && string(*data.Role) != "[]" {
+		user.RecoveryRole(data.Role)
+	}
 	if string(*data.User) != "[]" {
 		user.RecoveryUser(data.User)
 	}
@@ -0,0 +1,252 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/brokercap/Bifrost/server/cluster"
+	"github.com/brokercap/Bifrost/server/count"
+	"github.com/brokercap/Bifrost/server/storage"
+)
+
+// shard 模式下每个数据源的配置单独保存, 由这个数据源当前所在的节点写入
+// 数据源的配置和位点带上这个数据源租约的 fencing token 写入, 租约被别的节点拿走之后原来的节点写不进去
+// db.Bifrost 里只保存 目标库 配置
+
+const SHARD_DB_KEY_PREFIX = "bifrost_shard_db_"
+
+func shardDbKey(Name string) []byte {
+	return []byte(SHARD_DB_KEY_PREFIX + Name)
+}
+
+// 测试的时候替换
+var shardGetListByPrefix = storage.GetListByPrefix
+var shardGetKeyVal = storage.GetKeyVal
+var shardPutKeyVal = storage.PutKeyVal
+var shardDelKeyVal = storage.DelKeyVal
+var shardPutKeyValByToken = storage.PutKeyValByToken
+var shardDelKeyValByToken = storage.DelKeyValByToken
+
+// 没有开启 shard 的时候直接写
+func putDbKeyVal(Name string, key []byte, val []byte) error {
+	tokenKey, token, err := cluster.DbFencingToken(Name)
+	if err != nil {
+		return err
+	}
+	if tokenKey == nil {
+		return shardPutKeyVal(key, val)
+	}
+	return shardPutKeyValByToken(key, val, tokenKey, token)
+}
+
+func delDbKeyVal(Name string, key []byte) error {
+	tokenKey, token, err := cluster.DbFencingToken(Name)
+	if err != nil {
+		return err
+	}
+	if tokenKey == nil {
+		return shardDelKeyVal(key)
+	}
+	return shardDelKeyValByToken(key, tokenKey, token)
+}
+
+func getShardDbInfoList() map[string]dbSaveInfo {
+	data := make(map[string]dbSaveInfo, 0)
+	for _, v := range shardGetListByPrefix([]byte(SHARD_DB_KEY_PREFIX)) {
+		var info dbSaveInfo
+		if err := json.Unmarshal([]byte(v.Value), &info); err != nil {
+			log.Println("shard db info key:", v.Key, " err:", err)
+			continue
+		}
+		data[strings.TrimPrefix(v.Key, SHARD_DB_KEY_PREFIX)] = info
+	}
+	return data
+}
+
+// 集群里所有的数据源, 包括当前节点刚添加还没有保存的
+func GetShardDbNameList() []string {
+	nameMap := make(map[string]bool, 0)
+	for name := range getShardDbInfoList() {
+		nameMap[name] = true
+	}
+	DbLock.Lock()
+	for name := range DbList {
+		nameMap[name] = true
+	}
+	DbLock.Unlock()
+	nameList := make([]string, 0, len(nameMap))
+	for name := range nameMap {
+		nameList = append(nameList, name)
+	}
+	sort.Strings(nameList)
+	return nameList
+}
+
+// 第一次开启 shard 的时候, 把 db.Bifrost 里的数据源拆开保存, 已经拆开的不覆盖
+func initShardData(content *json.RawMessage) {
+	var data map[string]dbSaveInfo
+	if err := json.Unmarshal(*content, &data); err != nil {
+		log.Println("shard init db info err:", err)
+		return
+	}
+	stored := getShardDbInfoList()
+	for name, info := range data {
+		if _, ok := stored[name]; ok {
+			continue
+		}
+		b, _ := json.Marshal(info)
+		if err := shardPutKeyVal(shardDbKey(name), b); err != nil {
+			log.Println("shard init db:", name, " err:", err)
+		}
+	}
+}
+
+// 数据源分配到当前节点, 从存储里加载, 按保存的状态启动
+func LoadShardDB(Name string) error {
+	// 在当前节点上刚添加的数据源, 内存里的就是最新的
+	if GetDB(Name) != nil {
+		return nil
+	}
+	b, err := shardGetKeyVal(shardDbKey(Name))
+	if err != nil {
+		return err
+	}
+	if len(b) == 0 {
+		return fmt.Errorf("%s not exist", Name)
+	}
+	var info dbSaveInfo
+	if err = json.Unmarshal(b, &info); err != nil {
+		return err
+	}
+	recoveryData(map[string]dbSaveInfo{Name: info}, false)
+	return nil
+}
+
+// 数据源迁移到别的节点, 先保存配置, 再停止并从内存里移除, 不删除位点
+func UnloadShardDB(Name string) {
+	dbObj := GetDB(Name)
+	if dbObj == nil {
+		return
+	}
+	// 保存的是用户设置的状态, 新的节点按这个状态启动
+	if cluster.IsDbOwner(Name) {
+		saveShardDB(dbObj, true)
+	}
+	unloadDB(dbObj)
+}
+
+// 停止数据源并从内存里移除, 不删除位点
+func unloadDB(dbObj *db) {
+	dbObj.RLock()
+	status := dbObj.ConnStatus
+	dbObj.RUnlock()
+	if status == RUNNING || status == STARTING {
+		dbObj.Stop()
+	}
+	dbObj.Close()
+	for _, c := range dbObj.ListChannel() {
+		c.Close()
+	}
+	removeDBFromMemory(dbObj.Name)
+}
+
+func removeDBFromMemory(Name string) {
+	DbLock.Lock()
+	defer DbLock.Unlock()
+	dbObj, ok := DbList[Name]
+	if !ok {
+		return
+	}
+	for _, c := range dbObj.channelMap {
+		count.DelChannel(Name, c.Name)
+	}
+	delete(DbList, Name)
+	count.DelDB(Name)
+	log.Println("unload db:", Name)
+}
+
+// fencing 为 false 的是当前节点上刚添加的数据源, 还没有节点拿过租约
+func saveShardDB(dbObj *db, fencing bool) {
+	b, err := json.Marshal(getDbSaveInfo(dbObj))
+	if err != nil {
+		log.Println("shard save db:", dbObj.Name, " err:", err)
+		return
+	}
+	if fencing {
+		err = putDbKeyVal(dbObj.Name, shardDbKey(dbObj.Name), b)
+	} else {
+		err = shardPutKeyVal(shardDbKey(dbObj.Name), b)
+	}
+	if err != nil {
+		log.Println("shard save db:", dbObj.Name, " err:", err)
+	}
+}
+
+// 保存当前节点上的数据源
+// 不属于当前节点并且存储里没有的, 是在当前节点上刚添加的, 保存之后从内存里移除, 由分配到的节点加载
+// 属于当前节点但是内存里已经没有的, 是被删除了
+func saveShardDBInfo() {
+	stored := getShardDbInfoList()
+	DbLock.Lock()
+	dbList := make([]*db, 0, len(DbList))
+	for _, dbObj := range DbList {
+		dbList = append(dbList, dbObj)
+	}
+	DbLock.Unlock()
+	memMap := make(map[string]bool, 0)
+	for _, dbObj := range dbList {
+		memMap[dbObj.Name] = true
+		if cluster.IsDbOwner(dbObj.Name) {
+			saveShardDB(dbObj, true)
+			continue
+		}
+		if _, ok := stored[dbObj.Name]; !ok {
+			saveShardDB(dbObj, false)
+			if _, remote := cluster.GetDbOwner(dbObj.Name); remote {
+				UnloadShardDB(dbObj.Name)
+			}
+		}
+	}
+	for name := range stored {
+		if !memMap[name] && cluster.IsDbOwner(name) {
+			if err := delDbKeyVal(name, shardDbKey(name)); err != nil {
+				log.Println("shard del db:", name, " err:", err)
+			}
+		}
+	}
+}
+
+// 不在当前节点上的数据源, 用存储里最后保存的配置
+func getRemoteDbList(dbListMap map[string]DbListStruct) {
+	for name, v := range getShardDbInfoList() {
+		if _, ok := dbListMap[name]; ok {
+			continue
+		}
+		owner, _ := cluster.GetDbOwner(name)
+		dbListMap[name] = DbListStruct{
+			Name:                  v.Name,
+			InputType:             v.InputType,
+			ConnectUri:            v.ConnectUri,
+			ConnStatus:            v.ConnStatus,
+			ConnErr:               v.ConnErr,
+			ChannelCount:          len(v.ChannelMap),
+			LastChannelID:         v.LastChannelID,
+			TableCount:            len(v.TableMap),
+			BinlogDumpFileName:    v.BinlogDumpFileName,
+			BinlogDumpPosition:    v.BinlogDumpPosition,
+			IsGtid:                v.IsGtid,
+			Gtid:                  v.Gtid,
+			LastEventID:           v.LastEventID,
+			BinlogDumpTimestamp:   v.BinlogDumpTimestamp,
+			MaxBinlogDumpFileName: v.MaxBinlogDumpFileName,
+			MaxBinlogDumpPosition: v.MaxinlogDumpPosition,
+			ReplicateDoDb:         v.ReplicateDoDb,
+			ServerId:              v.ServerId,
+			AddTime:               v.AddTime,
+			NodeID:                owner.NodeID,
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/brokercap/Bifrost/server/storage"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestInitShardData(t *testing.T) {
+	kv := make(map[string]string)
+	shardGetListByPrefix = func(key []byte) (data []storage.ListStruct) {
+		for k, v := range kv {
+			if strings.HasPrefix(k, string(key)) {
+				data = append(data, storage.ListStruct{Key: k, Value: v})
+			}
+		}
+		return
+	}
+	shardPutKeyVal = func(key []byte, val []byte) error {
+		kv[string(key)] = string(val)
+		return nil
+	}
+	defer func() {
+		shardGetListByPrefix = storage.GetListByPrefix
+		shardPutKeyVal = storage.PutKeyVal
+	}()
+
+	Convey("split db info", t, func() {
+		kv[SHARD_DB_KEY_PREFIX+"db1"] = `{"Name":"db1","ServerId":100}`
+		content := json.RawMessage(`{"db1":{"Name":"db1","ServerId":1},"db2":{"Name":"db2","ServerId":2}}`)
+		initShardData(&content)
+
+		data := getShardDbInfoList()
+		So(len(data), ShouldEqual, 2)
+		// 已经拆开保存的不覆盖
+		So(data["db1"].ServerId, ShouldEqual, 100)
+		So(data["db2"].ServerId, ShouldEqual, 2)
+		So(data["db2"].Name, ShouldEqual, "db2")
+	})
+}
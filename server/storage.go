@@ -17,11 +17,13 @@ type PositionStruct struct {
 	GTID           string
 	Timestamp      uint32
 	EventID        uint64
+	PayloadIndex   uint32
 }
 
 type TmpPositioinStruct struct {
 	sync.RWMutex
-	Data map[string]*PositionStruct
+	Data   map[string]*PositionStruct
+	DbName map[string]string // key => 数据源, shard 模式下写入要带上数据源的 fencing token
 }
 
 var toSaveDbConfigChan chan int8
@@ -57,7 +59,8 @@ func InitStorage() {
 		var i uint32 = 0
 		for i = 0; i < cachePoolCount; i++ {
 			TmpPositioin[i] = &TmpPositioinStruct{
-				Data: make(map[string]*PositionStruct, 0),
+				Data:   make(map[string]*PositionStruct, 0),
+				DbName: make(map[string]string, 0),
 			}
 		}
 		go saveBinlogPositionToStorageFromCache()
@@ -71,9 +74,10 @@ func saveBinlogPositionToStorageFromCache() {
 			t.Lock()
 			for k, v := range t.Data {
 				Val, _ := json.Marshal(v)
-				storage.PutKeyVal([]byte(k), Val)
+				putDbKeyVal(t.DbName[k], []byte(k), Val)
 			}
 			t.Data = make(map[string]*PositionStruct, 0)
+			t.DbName = make(map[string]string, 0)
 			t.Unlock()
 		}
 	}
@@ -81,14 +85,15 @@ func saveBinlogPositionToStorageFromCache() {
 
 var crc_table *crc32.Table = crc32.MakeTable(0xD5828281)
 
-func saveBinlogPositionByCache(key []byte, t *PositionStruct) {
+func saveBinlogPositionByCache(dbName string, key []byte, t *PositionStruct) {
 	if cachePoolCount <= 0 {
-		saveBinlogPosition(key, t)
+		saveBinlogPosition(dbName, key, t)
 		return
 	}
 	id := crc32.Checksum(key, crc_table) % cachePoolCount
 	TmpPositioin[id].Lock()
 	TmpPositioin[id].Data[string(key)] = t
+	TmpPositioin[id].DbName[string(key)] = dbName
 	TmpPositioin[id].Unlock()
 }
 
@@ -121,9 +126,9 @@ func getDBBinlogkey(db *db) []byte {
 	return []byte("binlog-db-" + db.Name + "-" + strconv.FormatInt(db.AddTime, 10))
 }
 
-func saveBinlogPosition(key []byte, t *PositionStruct) error {
+func saveBinlogPosition(dbName string, key []byte, t *PositionStruct) error {
 	Val, _ := json.Marshal(t)
-	err := storage.PutKeyVal(key, Val)
+	err := putDbKeyVal(dbName, key, Val)
 	return err
 }
 
@@ -149,8 +154,8 @@ func getBinlogPosition(key []byte) (*PositionStruct, error) {
 	return &data, nil
 }
 
-func delBinlogPosition(key []byte) error {
-	return storage.DelKeyVal(key)
+func delBinlogPosition(dbName string, key []byte) error {
+	return delDbKeyVal(dbName, key)
 }
 
 func Close() {
@@ -3,6 +3,7 @@ package storage
 import (
 	"github.com/brokercap/Bifrost/config"
 	"github.com/brokercap/Bifrost/xdb"
+	"github.com/brokercap/Bifrost/xdb/driver"
 	"io"
 	"io/ioutil"
 	"log"
@@ -20,6 +21,11 @@ var metaStorageType string
 var path string
 var dbSourceKey []byte
 
+// 开启主备之后, 只有 leader 才可以写元数据, 返回 error 则不写
+// 写入的时候带上 leader 的 fencing token, 存储里的 token 变了则写入失败
+var fencing func() (int64, error)
+var fencingTokenKey string
+
 func init() {}
 
 func InitStorage() {
@@ -59,9 +65,17 @@ func GetKeyVal(key []byte) (data []byte, err error) {
 }
 
 func PutKeyVal(key []byte, val []byte) (err error) {
+	var token int64
+	if token, err = checkFencing(); err != nil {
+		return
+	}
 	for i := 0; i < 3; i++ {
-		err = xdbClient.PutKeyValBytes(DEFAULT_TABLE, string(key), val)
-		if err == nil {
+		if fencing != nil {
+			err = xdbClient.PutKeyValBytesByToken(DEFAULT_TABLE, string(key), val, fencingTokenKey, token)
+		} else {
+			err = xdbClient.PutKeyValBytes(DEFAULT_TABLE, string(key), val)
+		}
+		if err == nil || err == driver.ErrFencingToken {
 			break
 		}
 		time.Sleep(time.Duration(1) * time.Second)
@@ -70,9 +84,41 @@ func PutKeyVal(key []byte, val []byte) (err error) {
 }
 
 func DelKeyVal(key []byte) (err error) {
+	var token int64
+	if token, err = checkFencing(); err != nil {
+		return
+	}
 	for i := 0; i < 3; i++ {
-		err = xdbClient.DelKeyVal(DEFAULT_TABLE, string(key))
-		if err == nil {
+		if fencing != nil {
+			err = xdbClient.DelKeyValByToken(DEFAULT_TABLE, string(key), fencingTokenKey, token)
+		} else {
+			err = xdbClient.DelKeyVal(DEFAULT_TABLE, string(key))
+		}
+		if err == nil || err == driver.ErrFencingToken {
+			break
+		}
+		time.Sleep(time.Duration(1) * time.Second)
+	}
+	return
+}
+
+// 带上 fencing token 写入, 存储里 tokenKey 的值不是 token 则写入失败, 不经过主备的 fencing 检查
+// shard 模式下每个数据源有自己的 token
+func PutKeyValByToken(key []byte, val []byte, tokenKey []byte, token int64) (err error) {
+	for i := 0; i < 3; i++ {
+		err = xdbClient.PutKeyValBytesByToken(DEFAULT_TABLE, string(key), val, string(tokenKey), token)
+		if err == nil || err == driver.ErrFencingToken {
+			break
+		}
+		time.Sleep(time.Duration(1) * time.Second)
+	}
+	return
+}
+
+func DelKeyValByToken(key []byte, tokenKey []byte, token int64) (err error) {
+	for i := 0; i < 3; i++ {
+		err = xdbClient.DelKeyValByToken(DEFAULT_TABLE, string(key), string(tokenKey), token)
+		if err == nil || err == driver.ErrFencingToken {
 			break
 		}
 		time.Sleep(time.Duration(1) * time.Second)
@@ -103,6 +149,40 @@ func GetListByPrefix(key []byte) (data []ListStruct) {
 	return data
 }
 
+func GetMetaStorageType() string {
+	return metaStorageType
+}
+
+// tokenKey 为存储里保存 fencing token 的 key, f 返回当前 leader 的 token
+func SetFencing(tokenKey []byte, f func() (int64, error)) {
+	fencingTokenKey = string(tokenKey)
+	fencing = f
+}
+
+func checkFencing() (int64, error) {
+	if fencing == nil {
+		return 0, nil
+	}
+	return fencing()
+}
+
+// 租约相关的操作不经过 fencing 检查
+func AcquireLease(key []byte, val []byte, ttl time.Duration) (bool, error) {
+	return xdbClient.AcquireLease(DEFAULT_TABLE, string(key), val, ttl)
+}
+
+func RenewLease(key []byte, val []byte, ttl time.Duration) (bool, error) {
+	return xdbClient.RenewLease(DEFAULT_TABLE, string(key), val, ttl)
+}
+
+func ReleaseLease(key []byte, val []byte) error {
+	return xdbClient.ReleaseLease(DEFAULT_TABLE, string(key), val)
+}
+
+func Incr(key []byte) (int64, error) {
+	return xdbClient.Incr(DEFAULT_TABLE, string(key))
+}
+
 func Close() {
 	if xdbClient != nil {
 		xdbClient.Close()
@@ -132,6 +212,10 @@ func GetDBInfo() (data []byte, err error) {
 }
 
 func SaveDBInfo(data []byte) (err error) {
+	if _, err = checkFencing(); err != nil {
+		log.Println("save db info err:", err)
+		return
+	}
 	switch metaStorageType {
 	case "redis":
 		err = PutKeyVal(dbSourceKey, data)
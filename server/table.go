@@ -18,6 +18,8 @@ package server
 import (
 	"fmt"
 	"sync"
+
+	"github.com/brokercap/Bifrost/server/rowfilter"
 )
 
 type Table struct {
@@ -67,6 +69,9 @@ func AddTableToServer(db, schemaName, tableName string, ToServerInfo ToServer) e
 	if _, ok := DbList[db]; !ok {
 		return fmt.Errorf(db + "not exsit")
 	}
+	if _, err := rowfilter.Parse(ToServerInfo.RowFilter); err != nil {
+		return fmt.Errorf("RowFilter error:%s", err)
+	}
 	key := GetSchemaAndTableJoin(schemaName, tableName)
 	if _, ok := DbList[db].tableMap[key]; !ok {
 		return fmt.Errorf(key + " not exsit")
@@ -5,11 +5,16 @@ import (
 	"github.com/brokercap/Bifrost/config"
 	"github.com/brokercap/Bifrost/plugin"
 	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	"github.com/brokercap/Bifrost/server/deadletter"
+	"github.com/brokercap/Bifrost/server/metrics"
+	"github.com/brokercap/Bifrost/server/transform"
 	"github.com/brokercap/Bifrost/server/warning"
 	"io"
 	"log"
 	"runtime"
 	"runtime/debug"
+	"strconv"
+	"sync/atomic"
 	"time"
 )
 
@@ -33,6 +38,10 @@ func (This *ToServer) Stop() {
 func (This *ToServer) Start() {
 	This.Lock()
 	defer This.Unlock()
+	if This.rowFilterErr != nil {
+		log.Println("ToServer ", *This.Key, This.ToServerKey, This.ToServerID, " RowFilter err:", This.rowFilterErr, " can't start")
+		return
+	}
 	if This.Status == STOPPED {
 		if This.ThreadCount == 0 {
 			This.Status = DEFAULT
@@ -85,6 +94,7 @@ func (This *ToServer) consume_to_server(db *db, SchemaName string, TableName str
 	}()
 	log.Println(db.Name, This.Notes, "toServerKey:", *This.Key, "MyConsumerId:", MyConsumerId, "SchemaName:", SchemaName, "TableName:", TableName, This.PluginName, This.ToServerKey, "ToServer consume_to_server  start")
 	c := This.ToServerChan.To
+	atomic.StoreInt64(&This.lastConsumeTime, time.Now().Unix())
 	This.Lock()
 	if This.Status == DEFAULT {
 		This.Status = RUNNING
@@ -99,7 +109,7 @@ func (This *ToServer) consume_to_server(db *db, SchemaName string, TableName str
 			switch This.Status {
 			case DELING:
 				This.Status = DELED
-				delBinlogPosition(toServerPositionBinlogKey)
+				delBinlogPosition(db.Name, toServerPositionBinlogKey)
 				This.Unlock()
 				runtime.Goexit()
 				break
@@ -129,6 +139,14 @@ func (This *ToServer) consume_to_server(db *db, SchemaName string, TableName str
 	var ErrData *pluginDriver.PluginDataType
 	var errs error
 	binlogKey := getToServerBinlogkey(db, This)
+	// 给 /metrics 用的 处理条数统计, 按同步配置所在的表统计,模糊匹配的表不按实际表名拆开
+	metricsKey := metrics.ToServerKey{DbName: db.Name, SchemaName: SchemaName, TableName: TableName, ToServerID: This.ToServerID}
+	if This.Key != nil {
+		metricsKey.SchemaName, metricsKey.TableName = GetSchemaAndTableBySplit(*This.Key)
+	}
+	metricsCounter := metrics.GetToServerCounter(metricsKey)
+	// 死信也按同步配置所在的表保存
+	deadLetterKey := deadletter.ToServerKey{DbName: db.Name, SchemaName: metricsKey.SchemaName, TableName: metricsKey.TableName, ToServerID: This.ToServerID}
 
 	var SaveBinlog = func() {
 		if LastSuccessData != nil {
@@ -148,10 +166,14 @@ func (This *ToServer) consume_to_server(db *db, SchemaName string, TableName str
 				GTID:           LastSuccessData.Gtid,
 				Timestamp:      LastSuccessData.Timestamp,
 				EventID:        LastSuccessData.EventID,
+				PayloadIndex:   LastSuccessData.PayloadIndex,
 			}
 
 			This.LastSuccessBinlog = LastSuccessBinlog
-			saveBinlogPositionByCache(binlogKey, LastSuccessBinlog)
+			// 全量任务的同步配置 ToServerID 为 0, 位点只是全量任务自己用来判断进度, 不需要持久化
+			if This.ToServerID > 0 {
+				saveBinlogPositionByCache(db.Name, binlogKey, LastSuccessBinlog)
+			}
 
 			// 支持到 1.8.x
 			This.BinlogFileNum = LastSuccessData.BinlogFileNum
@@ -204,7 +226,8 @@ func (This *ToServer) consume_to_server(db *db, SchemaName string, TableName str
 			return
 		}
 		if LastSuccessData.BinlogFileNum == lastFromFileEndData.BinlogFileNum {
-			if LastSuccessData.BinlogPosition >= lastFromFileEndData.BinlogPosition {
+			if pluginDriver.CompareBinlogPosition(LastSuccessData.BinlogFileNum, LastSuccessData.BinlogPosition, LastSuccessData.PayloadIndex,
+				lastFromFileEndData.BinlogFileNum, lastFromFileEndData.BinlogPosition, lastFromFileEndData.PayloadIndex) >= 0 {
 				//log.Println("file ackn2:",unack," and unack:",unack," fileTotalCount:",fileTotalCount)
 				This.fileQueueObj.Ack(unack)
 				unack = 0
@@ -241,13 +264,72 @@ func (This *ToServer) consume_to_server(db *db, SchemaName string, TableName str
 		}
 		return false
 	}
-	var forSendData = func(data *pluginDriver.PluginDataType) {
+	// 连续失败的次数
+	var failCount int = 0
+	var lastDeadLetterWarningTime int64 = 0
+	// 插件里是否有之前提交了但是还没有真正写入的数据
+	// 批量提交的插件(mysql,clickhouse 等)跳过的时候, 会把缓存里到 ErrData 为止的数据全部丢掉, 这个时候不能只把当前这条数据写入死信
+	var pluginUnCommitted bool = false
+	// 将一直失败的数据写入死信,并且让插件跳过这条数据
+	// data 是已经过滤字段和转换过的数据, 和提交给插件的一样, 不会保存转换前的明文数据
+	var toDeadLetter = func(data *pluginDriver.PluginDataType) bool {
+		if pluginUnCommitted {
+			// 宁可阻塞重试也不能丢掉插件里缓存的其他数据
+			if failCount == This.DeadLetterRetry+1 {
+				log.Println(db.Name, SchemaName, TableName, This.PluginName, This.ToServerKey, This.ToServerID, "plugin has uncommitted data, can't write dead letter, retry until success")
+			}
+			return false
+		}
+		entry := &deadletter.Entry{
+			DbName:      db.Name,
+			SchemaName:  deadLetterKey.SchemaName,
+			TableName:   deadLetterKey.TableName,
+			ToServerID:  This.ToServerID,
+			ToServerKey: This.ToServerKey,
+			PluginName:  This.PluginName,
+			Retries:     failCount - 1,
+			Error:       errs.Error(),
+			Data:        data,
+			Transformed: true,
+		}
+		id, err := deadletter.Add(entry)
+		if err != nil {
+			log.Println(db.Name, SchemaName, TableName, This.PluginName, This.ToServerKey, This.ToServerID, "write dead letter err:", err)
+			return false
+		}
+		if This.SkipBinlog(MyConsumerId, ErrData) != nil {
+			deadletter.Del(deadLetterKey, id)
+			return false
+		}
+		log.Println(db.Name, SchemaName, TableName, This.PluginName, This.ToServerKey, This.ToServerID, "write dead letter id:", id, "err:", errs)
+		This.DelWaitError()
+		lastErrTime = 0
+		failCount = 0
+		// 同一个同步配置,一分钟内只报警一次
+		if time.Now().Unix()-lastDeadLetterWarningTime >= 60 {
+			lastDeadLetterWarningTime = time.Now().Unix()
+			doWarningFun(warning.WARNINGERROR, "PluginName:"+This.PluginName+";ToServerKey:"+This.ToServerKey+";ToServerID:"+strconv.Itoa(This.ToServerID)+" write dead letter id:"+strconv.FormatInt(id, 10)+" err:"+entry.Error)
+		}
+		fileAck()
+		return true
+	}
+	var forSendData = func(paramData *pluginDriver.PluginDataType) {
+		// 只有所有字段内容都没有更新，并且开启了过滤功能的情况下，才不需要提交给插件
+		data, needSend := This.toPluginData(paramData)
 		retry = false
 		for {
 			errs = nil
-			LastSuccessData, ErrData, errs = This.sendToServer(data, MyConsumerId, retry)
+			if needSend {
+				LastSuccessData, ErrData, errs = This.sendToServer(data, MyConsumerId, retry)
+			} else {
+				LastSuccessData, ErrData = paramData, nil
+			}
 			if This.MustBeSuccess == true {
 				if errs == nil {
+					if needSend {
+						// 没有返回成功的位点, 说明数据还缓存在插件里
+						pluginUnCommitted = LastSuccessData == nil
+					}
 					if lastErrTime > 0 {
 						This.DelWaitError()
 						lastErrTime = 0
@@ -263,12 +345,27 @@ func (This *ToServer) consume_to_server(db *db, SchemaName string, TableName str
 				This.AddWaitError(errs, ErrData)
 				if lastErrTime == 0 {
 					fordo = 0
+					failCount = 0
 					lastErrTime = time.Now().Unix()
 				} else {
 					if checkDealSkipErrData() {
 						break
 					}
 				}
+				// 开启了死信, 按 1s,2s,4s... 重试, 重试 DeadLetterRetry 次还是失败 写入死信, 继续同步后面的数据
+				if This.DeadLetterRetry > 0 {
+					failCount++
+					if failCount > This.DeadLetterRetry && toDeadLetter(data) {
+						break
+					}
+					CheckStatusFun()
+					timer2 := time.NewTimer(deadletter.Backoff(failCount))
+					<-timer2.C
+					timer2.Stop()
+					checkDoWarning()
+					retry = true
+					continue
+				}
 				fordo++
 				// 每重试2次,进行阻塞休眠一次
 				if fordo == 2 {
@@ -332,9 +429,12 @@ func (This *ToServer) consume_to_server(db *db, SchemaName string, TableName str
 							tmpUnack++
 							continue
 						}
+						// TRANSACTION_PAYLOAD_EVENT 里的事件位点相同, 还要比较 PayloadIndex
 						if data0.BinlogFileNum == This.BinlogFileNum && data0.BinlogPosition <= This.BinlogPosition {
-							tmpUnack++
-							continue
+							if data0.BinlogPosition < This.BinlogPosition || This.LastSuccessBinlog == nil || data0.PayloadIndex <= This.LastSuccessBinlog.PayloadIndex {
+								tmpUnack++
+								continue
+							}
 						}
 						lastFromFileEndData = data0
 						unack++
@@ -361,6 +461,26 @@ func (This *ToServer) consume_to_server(db *db, SchemaName string, TableName str
 			CheckStatusFun()
 			warningStatus = false
 			timer.Stop()
+			// 一致性快照全量里已经包含了的数据, 不需要再同步, 只更新位点
+			if This.isBeforeSnapshot(data) {
+				LastSuccessData = data
+				fileAck()
+				atomic.StoreInt64(&This.lastConsumeTime, time.Now().Unix())
+				SaveBinlog()
+				break
+			}
+			// 增量快照的水位线, 高水位的时候换成区间里需要同步的数据
+			var watermarkChunk *WatermarkChunk
+			if data.EventType == WATERMARK_EVENT {
+				LastSuccessData = data
+				if data, watermarkChunk = This.dealWatermark(db.Name, data); data == nil {
+					fileAck()
+					atomic.StoreInt64(&This.lastConsumeTime, time.Now().Unix())
+					break
+				}
+			} else {
+				This.watermarkWindowAdd(data)
+			}
 			switch data.EventType {
 			case "sql":
 				forSendData(data)
@@ -388,8 +508,10 @@ func (This *ToServer) consume_to_server(db *db, SchemaName string, TableName str
 						if n0 == n1 {
 							d.BinlogFileNum = data.BinlogFileNum
 							d.BinlogPosition = data.BinlogPosition
+							d.PayloadIndex = data.PayloadIndex
 						}
 						d.Rows[0] = v
+						d.PresentColumns = data.SubPresentColumns(n0-1, 1)
 						forSendData(d)
 					}
 				} else {
@@ -417,9 +539,11 @@ func (This *ToServer) consume_to_server(db *db, SchemaName string, TableName str
 						if n0 == n1-2 {
 							d.BinlogFileNum = data.BinlogFileNum
 							d.BinlogPosition = data.BinlogPosition
+							d.PayloadIndex = data.PayloadIndex
 						}
 						d.Rows[0] = data.Rows[n0]
 						d.Rows[1] = data.Rows[n0+1]
+						d.PresentColumns = data.SubPresentColumns(n0, 2)
 						forSendData(d)
 					}
 				} else {
@@ -430,6 +554,18 @@ func (This *ToServer) consume_to_server(db *db, SchemaName string, TableName str
 				forSendData(data)
 				break
 			}
+			switch data.EventType {
+			case "update":
+				metricsCounter.Add(data.EventType, int64(len(data.Rows)/2), int64(data.EventSize))
+			case "sql", "commit":
+				metricsCounter.Add(data.EventType, 0, int64(data.EventSize))
+			default:
+				metricsCounter.Add(data.EventType, int64(len(data.Rows)), int64(data.EventSize))
+			}
+			if watermarkChunk != nil {
+				watermarkChunk.done(This.ToServerID, true)
+			}
+			atomic.StoreInt64(&This.lastConsumeTime, time.Now().Unix())
 			//这里保存位点，为是了显示的时候，可以直接从内存中读取
 			SaveBinlog()
 			break
@@ -437,6 +573,8 @@ func (This *ToServer) consume_to_server(db *db, SchemaName string, TableName str
 			timer.Stop()
 			LastSuccessData, ErrData, errs = This.timeOutCommit(MyConsumerId)
 			if errs == nil {
+				// 插件里缓存的数据都已经提交了
+				pluginUnCommitted = false
 				if lastErrTime > 0 {
 					This.DelWaitError()
 					lastErrTime = 0
@@ -511,8 +649,10 @@ func (This *ToServer) filterField(data *pluginDriver.PluginDataType) (newData *p
 			Pri:            data.Pri,
 			ColumnMapping:  data.ColumnMapping,
 			EventID:        data.EventID,
+			PayloadIndex:   data.PayloadIndex,
 		}
 		newData.Rows[0] = m
+		newData.PresentColumns = This.filterPresentColumns(data.PresentColumns)
 	} else {
 		newData = &pluginDriver.PluginDataType{
 			Timestamp:      data.Timestamp,
@@ -526,11 +666,24 @@ func (This *ToServer) filterField(data *pluginDriver.PluginDataType) (newData *p
 			Pri:            data.Pri,
 			ColumnMapping:  data.ColumnMapping,
 			EventID:        data.EventID,
+			PayloadIndex:   data.PayloadIndex,
 		}
 		m_before := make(map[string]interface{})
 		m_after := make(map[string]interface{})
 		var isNotUpdate bool = true
+		isFullRowImage := data.IsFullRowImageAll()
 		for _, key := range This.FieldList {
+			// binlog_row_image 不是 FULL 的时候，before image 和 after image 中的字段不一样,只要 after image 有字段就认为是有变更
+			if !isFullRowImage {
+				if _, ok := data.Rows[0][key]; ok {
+					m_before[key] = data.Rows[0][key]
+				}
+				if _, ok := data.Rows[1][key]; ok {
+					m_after[key] = data.Rows[1][key]
+					isNotUpdate = false
+				}
+				continue
+			}
 			if _, ok := data.Rows[0][key]; ok {
 				m_before[key] = data.Rows[0][key]
 				m_after[key] = data.Rows[1][key]
@@ -569,10 +722,34 @@ func (This *ToServer) filterField(data *pluginDriver.PluginDataType) (newData *p
 		}
 		newData.Rows[0] = m_before
 		newData.Rows[1] = m_after
+		newData.PresentColumns = This.filterPresentColumns(data.PresentColumns)
 	}
 	return newData, true
 }
 
+// 过滤字段之后，PresentColumns 也只保留 FieldList 中的字段
+func (This *ToServer) filterPresentColumns(presentColumns [][]string) [][]string {
+	if presentColumns == nil {
+		return nil
+	}
+	newPresentColumns := make([][]string, len(presentColumns))
+	for i, columns := range presentColumns {
+		if columns == nil {
+			continue
+		}
+		newPresentColumns[i] = make([]string, 0)
+		for _, column := range columns {
+			for _, key := range This.FieldList {
+				if key == column {
+					newPresentColumns[i] = append(newPresentColumns[i], column)
+					break
+				}
+			}
+		}
+	}
+	return newPresentColumns
+}
+
 // 从插件实例池中获取一个插件实例
 func (This *ToServer) getPluginAndSetParam(MyConsumerId int) (PluginConn *plugin.ToServerConn, err error) {
 	PluginConn = plugin.GetPlugin(This.ToServerKey)
@@ -626,7 +803,18 @@ func (This *ToServer) SkipBinlog(MyConsumerId int, SkipErrData *pluginDriver.Plu
 	return
 }
 
-func (This *ToServer) sendToServer(paramData *pluginDriver.PluginDataType, MyConsumerId int, retry bool) (lastSuccessCommitData *pluginDriver.PluginDataType, ErrData *pluginDriver.PluginDataType, err error) {
+// 提交给插件的数据, 先按 FieldList 过滤字段, 再按 Transforms 转换
+// 只有所有字段内容都没有更新，并且开启了过滤功能的情况下，才会返回false
+func (This *ToServer) toPluginData(paramData *pluginDriver.PluginDataType) (*pluginDriver.PluginDataType, bool) {
+	data, b := This.filterField(paramData)
+	if b == false {
+		return nil, false
+	}
+	return transform.Transform(This.Transforms, data), true
+}
+
+// data 是 toPluginData 转换之后的数据
+func (This *ToServer) sendToServer(data *pluginDriver.PluginDataType, MyConsumerId int, retry bool) (lastSuccessCommitData *pluginDriver.PluginDataType, ErrData *pluginDriver.PluginDataType, err error) {
 	defer func() {
 		if err2 := recover(); err2 != nil {
 			err = fmt.Errorf("sendToServer:%s Commit Debug Err:%s", This.ToServerKey, string(debug.Stack()))
@@ -634,36 +822,37 @@ func (This *ToServer) sendToServer(paramData *pluginDriver.PluginDataType, MyCon
 		}
 	}()
 
-	// 只有所有字段内容都没有更新，并且开启了过滤功能的情况下，才会返回false
-	data, b := This.filterField(paramData)
-	if b == false {
-		return paramData, nil, nil
-	}
 	PluginConn, err := This.getPluginAndSetParam(MyConsumerId)
 	if err != nil {
 		return lastSuccessCommitData, data, err
 	}
 	defer plugin.BackPlugin(PluginConn)
 
+	lastSuccessCommitData, ErrData, err = callPlugin(PluginConn.GetConn(), data, retry)
+	return
+}
+
+// 按事件类型调用插件对应的方法
+func callPlugin(conn pluginDriver.Driver, data *pluginDriver.PluginDataType, retry bool) (lastSuccessCommitData *pluginDriver.PluginDataType, ErrData *pluginDriver.PluginDataType, err error) {
 	switch data.EventType {
 	case "insert":
-		lastSuccessCommitData, ErrData, err = PluginConn.GetConn().Insert(data, retry)
+		lastSuccessCommitData, ErrData, err = conn.Insert(data, retry)
 		break
 	case "update":
-		lastSuccessCommitData, ErrData, err = PluginConn.GetConn().Update(data, retry)
+		lastSuccessCommitData, ErrData, err = conn.Update(data, retry)
 		break
 	case "delete":
-		lastSuccessCommitData, ErrData, err = PluginConn.GetConn().Del(data, retry)
+		lastSuccessCommitData, ErrData, err = conn.Del(data, retry)
 		break
 	case "sql":
 		if data.Query == "COMMIT" {
-			lastSuccessCommitData, ErrData, err = PluginConn.GetConn().Commit(data, retry)
+			lastSuccessCommitData, ErrData, err = conn.Commit(data, retry)
 		} else {
-			lastSuccessCommitData, ErrData, err = PluginConn.GetConn().Query(data, retry)
+			lastSuccessCommitData, ErrData, err = conn.Query(data, retry)
 		}
 		break
 	case "commit":
-		lastSuccessCommitData, ErrData, err = PluginConn.GetConn().Commit(data, retry)
+		lastSuccessCommitData, ErrData, err = conn.Commit(data, retry)
 		break
 	default:
 		break
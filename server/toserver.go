@@ -4,7 +4,11 @@ import (
 	"fmt"
 	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
 	pluginStorage "github.com/brokercap/Bifrost/plugin/storage"
+	"github.com/brokercap/Bifrost/server/deadletter"
 	"github.com/brokercap/Bifrost/server/filequeue"
+	"github.com/brokercap/Bifrost/server/metrics"
+	"github.com/brokercap/Bifrost/server/rowfilter"
+	"github.com/brokercap/Bifrost/server/transform"
 	"log"
 	"sync"
 )
@@ -20,10 +24,15 @@ type ToServer struct {
 	FilterQuery   bool
 	FilterUpdate  bool
 	FieldList     []string
-	ToServerKey   string
+	RowFilter     string            // 行过滤表达式,为空不过滤,例如: tenant_id = 42 AND status != 'draft'
+	Transforms    []*transform.Rule // 提交给插件之前的字段转换规则,比如脱敏
+	// MustBeSuccess 为 true 的时候生效, 大于 0 则一条数据失败重试这么多次之后写入死信队列, 继续同步后面的数据
+	DeadLetterRetry int
+	ToServerKey     string
 
 	LastSuccessBinlog *PositionStruct // 最后处理成功的位点信息
 	LastQueueBinlog   *PositionStruct // 最后进入队列的位点信息
+	SnapshotPosition  *PositionStruct // 一致性快照全量对应的位点, 小于等于这个位点的数据已经包含在全量数据里了, 直接跳过
 
 	BinlogFileNum  int    // 支持到 1.8.x
 	BinlogPosition uint32 // 支持到 1.8.x
@@ -48,6 +57,11 @@ type ToServer struct {
 	FileQueueUsableCountStartTime int64  // 开始统计 FileQueueUsableCount 计算的时间
 	statusChan                    chan bool
 	cosumerPluginParamArr         []interface{} `json:"-"` // 用以区分多个消费者的身份
+	rowFilter                     *rowfilter.Filter
+	rowFilterParsed               bool
+	rowFilterErr                  error
+	lastConsumeTime               int64            // 最后一次从队列中消费数据的时间,用于检测消费是否卡住
+	watermarkWindow               *watermarkWindow // 增量快照 低水位 和 高水位 之间的状态
 }
 
 /*
@@ -96,6 +110,8 @@ func (db *db) AddTableToServer(schemaName string, tableName string, toserver *To
 	toserver.Key = &key
 	toserver.QueueMsgCount = 0
 	toserver.statusChan = make(chan bool, 1)
+	// RowFilter 解析失败的时候, 保持暂停状态, 不能同步没有过滤的数据
+	toserver.CheckRowFilter()
 	db.tableMap[key].ToServerList = append(db.tableMap[key].ToServerList, toserver)
 
 	// 在添加第一个同步的时候，通知 binlog 解析，需要同步这个表
@@ -140,7 +156,7 @@ func (db *db) DelTableToServer(schemaName string, tableName string, ToServerID i
 		toServerInfo.Status = DELING
 	} else {
 		if toServerInfo.Status != DELING {
-			delBinlogPosition(toServerPositionBinlogKey)
+			delBinlogPosition(db.Name, toServerPositionBinlogKey)
 		}
 	}
 	// 当前这个表都没有同步配置了，则通知 binlog 解析，不再需要解析这个表的数据了
@@ -151,6 +167,8 @@ func (db *db) DelTableToServer(schemaName string, tableName string, ToServerID i
 
 	//将文件队列的路径也相应的删除掉
 	filequeue.Delete(GetFileQueue(db.Name, schemaName, tableName, fmt.Sprint(ToServerID)))
+	metrics.DelToServerCounter(metrics.ToServerKey{DbName: db.Name, SchemaName: schemaName, TableName: tableName, ToServerID: ToServerID})
+	deadletter.Purge(deadletter.ToServerKey{DbName: db.Name, SchemaName: schemaName, TableName: tableName, ToServerID: ToServerID})
 	return true
 }
 
@@ -189,6 +207,12 @@ func (This *ToServer) GetWaitErrorDeal() int {
 	return deal
 }
 
+func (This *ToServer) GetStatus() StatusFlag {
+	This.RLock()
+	defer This.RUnlock()
+	return This.Status
+}
+
 func (This *ToServer) DelWaitError() bool {
 	This.Lock()
 	This.Error = ""
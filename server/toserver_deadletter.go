@@ -0,0 +1,98 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+	"time"
+
+	"github.com/brokercap/Bifrost/plugin"
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	"github.com/brokercap/Bifrost/server/deadletter"
+)
+
+func (db *db) getToServerByID(schemaName, tableName string, ToServerID int) *ToServer {
+	t := db.GetTableSelf(schemaName, tableName)
+	if t == nil {
+		return nil
+	}
+	for _, toServerInfo := range t.ToServerList {
+		if toServerInfo.ToServerID == ToServerID {
+			return toServerInfo
+		}
+	}
+	return nil
+}
+
+// 重放一条死信, data 不为 nil 的时候用修改后的数据重放
+// 重放成功删除死信, 失败则保存修改后的数据和错误信息
+func (db *db) ReplayDeadLetter(schemaName, tableName string, ToServerID int, id int64, data *pluginDriver.PluginDataType) error {
+	toServerInfo := db.getToServerByID(schemaName, tableName, ToServerID)
+	if toServerInfo == nil {
+		return fmt.Errorf("ToServerID:%d not exist", ToServerID)
+	}
+	key := deadletter.ToServerKey{DbName: db.Name, SchemaName: schemaName, TableName: tableName, ToServerID: ToServerID}
+	entry, err := deadletter.Get(key, id)
+	if err != nil {
+		return err
+	}
+	if data != nil {
+		entry.Data = data
+	}
+	if entry.Data == nil {
+		return fmt.Errorf("dead letter id:%d data is nil", id)
+	}
+	err = toServerInfo.replayData(entry.Data, entry.Transformed)
+	if err == nil {
+		log.Println(db.Name, schemaName, tableName, toServerInfo.ToServerKey, ToServerID, "replay dead letter id:", id, "success")
+		return deadletter.Del(key, id)
+	}
+	entry.ReplayTime = time.Now().Unix()
+	entry.ReplayError = err.Error()
+	if err2 := deadletter.Update(entry); err2 != nil {
+		log.Println(db.Name, schemaName, tableName, toServerInfo.ToServerKey, ToServerID, "update dead letter id:", id, "err:", err2)
+	}
+	return err
+}
+
+// 不经过队列, 单独用一个插件连接把数据提交掉
+// transformed 为 true 的时候数据已经是过滤字段和转换之后的, 不能再转换一次
+func (This *ToServer) replayData(paramData *pluginDriver.PluginDataType, transformed bool) (err error) {
+	defer func() {
+		if err2 := recover(); err2 != nil {
+			err = fmt.Errorf("replay:%s Debug Err:%s", This.ToServerKey, string(debug.Stack()))
+			log.Println(This.ToServerKey, err2, err)
+		}
+	}()
+	data := paramData
+	if !transformed {
+		var b bool
+		if data, b = This.toPluginData(paramData); b == false {
+			return nil
+		}
+	}
+	PluginConn := plugin.GetPlugin(This.ToServerKey)
+	if PluginConn == nil {
+		return fmt.Errorf("Get Plugin:" + This.PluginName + " ToServerKey:" + This.ToServerKey + " err,return nil")
+	}
+	defer plugin.BackPlugin(PluginConn)
+
+	// 复制一份参数, 不影响正在同步的消费者, 重放必须要知道是否成功
+	This.RLock()
+	param := make(map[string]interface{}, len(This.PluginParam)+1)
+	for k, v := range This.PluginParam {
+		param[k] = v
+	}
+	This.RUnlock()
+	param["BifrostMustBeSuccess"] = true
+	conn := PluginConn.GetConn()
+	if _, err = conn.SetParam(param); err != nil {
+		return err
+	}
+	if _, _, err = callPlugin(conn, data, false); err != nil {
+		return err
+	}
+	// 有些插件是批量提交的, 强制提交一次
+	_, _, err = conn.TimeOutCommit()
+	return err
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	"github.com/brokercap/Bifrost/server/transform"
+)
+
+func TestToServer_toPluginData(t *testing.T) {
+	newData := func() *pluginDriver.PluginDataType {
+		return &pluginDriver.PluginDataType{
+			EventType:  "insert",
+			SchemaName: "bifrost_test",
+			TableName:  "binlog_field_test",
+			Rows:       []map[string]interface{}{{"id": int64(1), "phone": "13800138000", "name": "bifrost"}},
+			Pri:        []string{"id"},
+		}
+	}
+
+	Convey("field list and transforms", t, func() {
+		toServer := &ToServer{
+			FieldList:  []string{"id", "phone"},
+			Transforms: []*transform.Rule{{Type: transform.TypeMask, Column: "phone", KeepPrefix: 3, KeepSuffix: 4}},
+		}
+		data := newData()
+		newData, b := toServer.toPluginData(data)
+		So(b, ShouldBeTrue)
+		So(newData.Rows[0], ShouldResemble, map[string]interface{}{"id": int64(1), "phone": "138****8000"})
+		// 原数据是多个 ToServer 共用的, 不能被修改
+		So(data.Rows[0]["phone"], ShouldEqual, "13800138000")
+	})
+
+	Convey("no field list and transforms", t, func() {
+		data := newData()
+		newData, b := (&ToServer{}).toPluginData(data)
+		So(b, ShouldBeTrue)
+		So(newData, ShouldEqual, data)
+	})
+}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"fmt"
+	"log"
+
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+	"github.com/brokercap/Bifrost/server/rowfilter"
+)
+
+// RowFilter 在添加同步配置的时候已经校验过, 这里只解析一次缓存起来
+func (This *ToServer) getRowFilter() (*rowfilter.Filter, error) {
+	This.Lock()
+	defer This.Unlock()
+	if !This.rowFilterParsed {
+		This.rowFilter, This.rowFilterErr = rowfilter.Parse(This.RowFilter)
+		This.rowFilterParsed = true
+	}
+	return This.rowFilter, This.rowFilterErr
+}
+
+// 加载同步配置的时候校验 RowFilter
+// 解析失败的时候不能把没有过滤的数据同步出去, 保持暂停状态并记录错误, 只能删除之后重新添加
+func (This *ToServer) CheckRowFilter() error {
+	if This.RowFilter == "" {
+		return nil
+	}
+	_, err := This.getRowFilter()
+	if err != nil {
+		log.Printf("[WARN] ToServerKey:%s ToServerID:%d RowFilter:%s parse err:%s, ToServer stopped \n", This.ToServerKey, This.ToServerID, This.RowFilter, err)
+		This.Lock()
+		This.Error = fmt.Sprintf("RowFilter:%s parse err:%s", This.RowFilter, err)
+		This.Status = STOPPED
+		This.Unlock()
+	}
+	return err
+}
+
+// 行数据里是否缺少过滤条件用到的字段, binlog_row_image 为 MINIMAL,NOBLOB 或者 postgresql 没有变更的 TOAST 字段的时候会缺少
+func isRowFilterColumnMissing(filter *rowfilter.Filter, data *pluginDriver.PluginDataType, rowIndex int) bool {
+	if data.IsFullRowImage(rowIndex) {
+		return false
+	}
+	for _, column := range filter.Columns() {
+		if !data.IsColumnPresent(rowIndex, column) {
+			return true
+		}
+	}
+	return false
+}
+
+// update 的 after 里没有的字段, 说明这个字段没有被修改, 用 before 里的值来判断
+// 返回的数据只用于判断是否满足条件, 不会同步出去
+func mergeUpdateAfterRow(filter *rowfilter.Filter, data *pluginDriver.PluginDataType, beforeIndex int) (after map[string]interface{}, missing bool) {
+	afterIndex := beforeIndex + 1
+	if data.IsFullRowImage(afterIndex) {
+		return data.Rows[afterIndex], false
+	}
+	after = make(map[string]interface{}, len(data.Rows[afterIndex]))
+	for k, v := range data.Rows[afterIndex] {
+		after[k] = v
+	}
+	for _, column := range filter.Columns() {
+		if data.IsColumnPresent(afterIndex, column) {
+			continue
+		}
+		if !data.IsColumnPresent(beforeIndex, column) {
+			missing = true
+			continue
+		}
+		after[column] = data.Rows[beforeIndex][column]
+	}
+	return
+}
+
+// 按 RowFilter 过滤行数据
+// insert,delete 只保留满足条件的行
+// update 的 before 和 after 都要判断, 从不满足变成满足的转成 insert, 从满足变成不满足的转成 delete
+// 行数据不完整, 无法判断是否满足条件的时候, 保留这一行, 宁可多同步也不能丢数据
+// 没有满足条件的行的时候返回空数组
+// RowFilter 解析失败的时候返回 error, 调用方不能丢弃数据
+func (This *ToServer) filterRows(data *pluginDriver.PluginDataType) ([]*pluginDriver.PluginDataType, error) {
+	if This.RowFilter == "" || len(data.Rows) == 0 {
+		return []*pluginDriver.PluginDataType{data}, nil
+	}
+	filter, err := This.getRowFilter()
+	if err != nil {
+		return nil, fmt.Errorf("RowFilter:%s parse err:%s", This.RowFilter, err)
+	}
+	if filter == nil {
+		return []*pluginDriver.PluginDataType{data}, nil
+	}
+	switch data.EventType {
+	case "insert", "delete":
+		var rows []map[string]interface{}
+		var presentColumns [][]string
+		for i, row := range data.Rows {
+			if isRowFilterColumnMissing(filter, data, i) || filter.Match(row) {
+				rows = append(rows, row)
+				presentColumns = append(presentColumns, data.GetPresentColumns(i))
+			}
+		}
+		if len(rows) == len(data.Rows) {
+			return []*pluginDriver.PluginDataType{data}, nil
+		}
+		if len(rows) == 0 {
+			return nil, nil
+		}
+		return []*pluginDriver.PluginDataType{copyPluginDataWithRows(data, data.EventType, rows, presentColumns)}, nil
+	case "update":
+		var deleteRows, updateRows, insertRows []map[string]interface{}
+		var deletePresentColumns, updatePresentColumns, insertPresentColumns [][]string
+		for i := 0; i+1 < len(data.Rows); i += 2 {
+			before, after := data.Rows[i], data.Rows[i+1]
+			mergedAfter, afterMissing := mergeUpdateAfterRow(filter, data, i)
+			var beforeMatch, afterMatch bool
+			if afterMissing {
+				// 修改后的数据无法判断, 按 update 同步
+				beforeMatch, afterMatch = true, true
+			} else {
+				afterMatch = filter.Match(mergedAfter)
+				// 修改前的数据无法判断的时候, 按修改后的数据是否满足条件决定是 update 还是 delete
+				beforeMatch = isRowFilterColumnMissing(filter, data, i) || filter.Match(before)
+			}
+			switch {
+			case beforeMatch && afterMatch:
+				updateRows = append(updateRows, before, after)
+				updatePresentColumns = append(updatePresentColumns, data.GetPresentColumns(i), data.GetPresentColumns(i+1))
+			case beforeMatch:
+				deleteRows = append(deleteRows, before)
+				deletePresentColumns = append(deletePresentColumns, data.GetPresentColumns(i))
+			case afterMatch:
+				insertRows = append(insertRows, after)
+				insertPresentColumns = append(insertPresentColumns, data.GetPresentColumns(i+1))
+			}
+		}
+		if len(updateRows) == len(data.Rows) {
+			return []*pluginDriver.PluginDataType{data}, nil
+		}
+		var list []*pluginDriver.PluginDataType
+		if len(deleteRows) > 0 {
+			list = append(list, copyPluginDataWithRows(data, "delete", deleteRows, deletePresentColumns))
+		}
+		if len(updateRows) > 0 {
+			list = append(list, copyPluginDataWithRows(data, "update", updateRows, updatePresentColumns))
+		}
+		if len(insertRows) > 0 {
+			list = append(list, copyPluginDataWithRows(data, "insert", insertRows, insertPresentColumns))
+		}
+		return list, nil
+	default:
+		return []*pluginDriver.PluginDataType{data}, nil
+	}
+}
+
+// pluginData 是多个 ToServer 共用的,不能直接修改,复制一份新的
+func copyPluginDataWithRows(data *pluginDriver.PluginDataType, eventType string, rows []map[string]interface{}, presentColumns [][]string) *pluginDriver.PluginDataType {
+	newData := &pluginDriver.PluginDataType{
+		Timestamp:       data.Timestamp,
+		EventSize:       data.EventSize,
+		EventType:       eventType,
+		Rows:            rows,
+		Query:           data.Query,
+		SchemaName:      data.SchemaName,
+		TableName:       data.TableName,
+		AliasSchemaName: data.AliasSchemaName,
+		AliasTableName:  data.AliasTableName,
+		BinlogFileNum:   data.BinlogFileNum,
+		BinlogPosition:  data.BinlogPosition,
+		Gtid:            data.Gtid,
+		Pri:             data.Pri,
+		EventID:         data.EventID,
+		PayloadIndex:    data.PayloadIndex,
+		ColumnMapping:   data.ColumnMapping,
+	}
+	for _, columns := range presentColumns {
+		if columns != nil {
+			newData.PresentColumns = presentColumns
+			break
+		}
+	}
+	return newData
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+)
+
+func TestToServer_filterRows(t *testing.T) {
+	newData := func(eventType string, rows ...map[string]interface{}) *pluginDriver.PluginDataType {
+		return &pluginDriver.PluginDataType{
+			EventType:    eventType,
+			SchemaName:   "bifrost_test",
+			TableName:    "binlog_field_test",
+			Rows:         rows,
+			Pri:          []string{"id"},
+			EventID:      10,
+			PayloadIndex: 2,
+		}
+	}
+	row := func(id int64, tenantId int64, status string) map[string]interface{} {
+		return map[string]interface{}{"id": id, "tenant_id": tenantId, "status": status}
+	}
+
+	filterRows := func(toServer *ToServer, data *pluginDriver.PluginDataType) []*pluginDriver.PluginDataType {
+		list, err := toServer.filterRows(data)
+		So(err, ShouldBeNil)
+		return list
+	}
+
+	Convey("empty row filter", t, func() {
+		toServer := &ToServer{}
+		data := newData("insert", row(1, 1, "draft"))
+		So(filterRows(toServer, data), ShouldResemble, []*pluginDriver.PluginDataType{data})
+	})
+
+	Convey("row filter parse error, return error and not change status", t, func() {
+		key := "bifrost_test-binlog_field_test"
+		toServer := &ToServer{Key: &key, RowFilter: "tenant_id =", Status: RUNNING}
+		data := newData("insert", row(1, 1, "draft"))
+		list, err := toServer.filterRows(data)
+		So(err, ShouldNotBeNil)
+		So(len(list), ShouldEqual, 0)
+		So(toServer.Status, ShouldEqual, RUNNING)
+
+		// 加载的时候校验, 不允许再次启动
+		toServer = &ToServer{Key: &key, RowFilter: "tenant_id ="}
+		So(toServer.CheckRowFilter(), ShouldNotBeNil)
+		So(toServer.Status, ShouldEqual, STOPPED)
+		So(toServer.Error, ShouldNotEqual, "")
+		toServer.Start()
+		So(toServer.Status, ShouldEqual, STOPPED)
+
+		So((&ToServer{RowFilter: "tenant_id = 1"}).CheckRowFilter(), ShouldBeNil)
+		So((&ToServer{}).CheckRowFilter(), ShouldBeNil)
+	})
+
+	toServer := &ToServer{RowFilter: "tenant_id = 42 AND status != 'draft'"}
+
+	Convey("insert", t, func() {
+		data := newData("insert", row(1, 42, "published"))
+		So(filterRows(toServer, data)[0], ShouldEqual, data)
+
+		So(len(filterRows(toServer, newData("insert", row(1, 42, "draft")))), ShouldEqual, 0)
+
+		list := filterRows(toServer, newData("insert", row(1, 42, "published"), row(2, 1, "published")))
+		So(len(list), ShouldEqual, 1)
+		So(list[0].Rows, ShouldResemble, []map[string]interface{}{row(1, 42, "published")})
+		So(list[0].EventID, ShouldEqual, 10)
+		So(list[0].PayloadIndex, ShouldEqual, 2)
+	})
+
+	Convey("sql and commit", t, func() {
+		data := newData("sql")
+		data.Query = "ALTER TABLE binlog_field_test ADD COLUMN c1 INT"
+		So(filterRows(toServer, data)[0], ShouldEqual, data)
+	})
+
+	Convey("update", t, func() {
+		data := newData("update", row(1, 42, "published"), row(1, 42, "archived"))
+		So(filterRows(toServer, data)[0], ShouldEqual, data)
+
+		So(len(filterRows(toServer, newData("update", row(1, 1, "published"), row(1, 2, "published")))), ShouldEqual, 0)
+
+		// 移入范围转成 insert
+		list := filterRows(toServer, newData("update", row(1, 42, "draft"), row(1, 42, "published")))
+		So(len(list), ShouldEqual, 1)
+		So(list[0].EventType, ShouldEqual, "insert")
+		So(list[0].Rows, ShouldResemble, []map[string]interface{}{row(1, 42, "published")})
+
+		// 移出范围转成 delete
+		list = filterRows(toServer, newData("update", row(1, 42, "published"), row(1, 43, "published")))
+		So(len(list), ShouldEqual, 1)
+		So(list[0].EventType, ShouldEqual, "delete")
+		So(list[0].Rows, ShouldResemble, []map[string]interface{}{row(1, 42, "published")})
+	})
+
+	Convey("update partial image", t, func() {
+		// after image 没有 status 字段, 说明没有修改, 用 before 里的值判断
+		data := newData("update", row(1, 42, "published"), map[string]interface{}{"id": int64(1), "tenant_id": int64(42)})
+		data.PresentColumns = [][]string{nil, {"id", "tenant_id"}}
+		So(filterRows(toServer, data)[0], ShouldEqual, data)
+
+		data = newData("update", row(1, 42, "draft"), map[string]interface{}{"id": int64(1), "tenant_id": int64(42)})
+		data.PresentColumns = [][]string{nil, {"id", "tenant_id"}}
+		So(len(filterRows(toServer, data)), ShouldEqual, 0)
+
+		data = newData("update", row(1, 42, "draft"), row(1, 42, "published"))
+		data.PresentColumns = [][]string{{"id", "tenant_id", "status"}, {"id", "tenant_id", "status"}}
+		list := filterRows(toServer, data)
+		So(len(list), ShouldEqual, 1)
+		So(list[0].PresentColumns, ShouldResemble, [][]string{{"id", "tenant_id", "status"}})
+	})
+
+	Convey("update minimal image", t, func() {
+		// before 只有主键, after 只有修改的字段, 无法判断的时候按 update 同步, 不能丢数据
+		data := newData("update", map[string]interface{}{"id": int64(1)}, map[string]interface{}{"id": int64(1), "name": "bifrost"})
+		data.PresentColumns = [][]string{{"id"}, {"id", "name"}}
+		So(filterRows(toServer, data)[0], ShouldEqual, data)
+
+		// before 无法判断, after 满足条件, 按 update 同步
+		data = newData("update", map[string]interface{}{"id": int64(1)}, row(1, 42, "published"))
+		data.PresentColumns = [][]string{{"id"}, {"id", "tenant_id", "status"}}
+		So(filterRows(toServer, data)[0], ShouldEqual, data)
+
+		// before 无法判断, after 不满足条件, 转成 delete
+		data = newData("update", map[string]interface{}{"id": int64(1)}, row(1, 43, "published"))
+		data.PresentColumns = [][]string{{"id"}, {"id", "tenant_id", "status"}}
+		list := filterRows(toServer, data)
+		So(len(list), ShouldEqual, 1)
+		So(list[0].EventType, ShouldEqual, "delete")
+		So(list[0].Rows, ShouldResemble, []map[string]interface{}{{"id": int64(1)}})
+	})
+
+	Convey("delete minimal image", t, func() {
+		data := newData("delete", map[string]interface{}{"id": int64(1)})
+		data.PresentColumns = [][]string{{"id"}}
+		So(filterRows(toServer, data)[0], ShouldEqual, data)
+	})
+}
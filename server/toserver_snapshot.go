@@ -0,0 +1,35 @@
+package server
+
+import (
+	"log"
+
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+)
+
+// 设置一致性快照全量对应的位点, 为 nil 则取消
+func (This *ToServer) SetSnapshotPosition(position *PositionStruct) {
+	This.Lock()
+	defer This.Unlock()
+	This.SnapshotPosition = position
+	log.Println("ToServer ", *This.Key, This.ToServerKey, This.ToServerID, " SetSnapshotPosition:", position)
+}
+
+// 数据是否已经包含在一致性快照全量数据里了
+// 第一次遇到快照位点之后的数据, 就把快照位点清掉, 后面的数据都要正常同步
+func (This *ToServer) isBeforeSnapshot(data *pluginDriver.PluginDataType) bool {
+	This.Lock()
+	defer This.Unlock()
+	if This.SnapshotPosition == nil || data.BinlogFileNum == 0 {
+		return false
+	}
+	if data.BinlogFileNum < This.SnapshotPosition.BinlogFileNum {
+		return true
+	}
+	// 快照位点不会在 TRANSACTION_PAYLOAD_EVENT 中间, 和快照位点相同的 payload 里的事件是快照之后的
+	if data.BinlogFileNum == This.SnapshotPosition.BinlogFileNum && (data.BinlogPosition < This.SnapshotPosition.BinlogPosition || (data.BinlogPosition == This.SnapshotPosition.BinlogPosition && data.PayloadIndex == 0)) {
+		return true
+	}
+	log.Println("ToServer ", *This.Key, This.ToServerKey, This.ToServerID, " reach SnapshotPosition:", This.SnapshotPosition)
+	This.SnapshotPosition = nil
+	return false
+}
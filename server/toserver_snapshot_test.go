@@ -0,0 +1,52 @@
+package server
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+)
+
+func TestToServer_isBeforeSnapshot(t *testing.T) {
+	newData := func(fileNum int, position uint32) *pluginDriver.PluginDataType {
+		return &pluginDriver.PluginDataType{
+			EventType:      "insert",
+			SchemaName:     "bifrost_test",
+			TableName:      "binlog_field_test",
+			BinlogFileNum:  fileNum,
+			BinlogPosition: position,
+		}
+	}
+	newToServer := func(position *PositionStruct) *ToServer {
+		key := "mysqlTest-bifrost_test-binlog_field_test"
+		return &ToServer{Key: &key, ToServerID: 1, SnapshotPosition: position}
+	}
+
+	Convey("no snapshot position", t, func() {
+		toServer := newToServer(nil)
+		So(toServer.isBeforeSnapshot(newData(1, 100)), ShouldBeFalse)
+	})
+
+	Convey("skip data before snapshot position", t, func() {
+		toServer := newToServer(&PositionStruct{BinlogFileNum: 3, BinlogPosition: 1000})
+		So(toServer.isBeforeSnapshot(newData(2, 5000)), ShouldBeTrue)
+		So(toServer.isBeforeSnapshot(newData(3, 900)), ShouldBeTrue)
+		So(toServer.isBeforeSnapshot(newData(3, 1000)), ShouldBeTrue)
+		// 没有位点的数据不跳过
+		So(toServer.isBeforeSnapshot(newData(0, 0)), ShouldBeFalse)
+		So(toServer.SnapshotPosition, ShouldNotBeNil)
+
+		Convey("clear snapshot position after reach it", func() {
+			So(toServer.isBeforeSnapshot(newData(3, 1100)), ShouldBeFalse)
+			So(toServer.SnapshotPosition, ShouldBeNil)
+			So(toServer.isBeforeSnapshot(newData(3, 900)), ShouldBeFalse)
+		})
+	})
+
+	Convey("next binlog file", t, func() {
+		toServer := newToServer(&PositionStruct{BinlogFileNum: 3, BinlogPosition: 1000})
+		So(toServer.isBeforeSnapshot(newData(4, 4)), ShouldBeFalse)
+		So(toServer.SnapshotPosition, ShouldBeNil)
+	})
+}
@@ -0,0 +1,325 @@
+package transform
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+)
+
+// 在数据提交给插件 Insert/Update/Del 之前,按顺序执行的字段转换规则
+// 主要用于脱敏,比如邮箱,手机号,身份证号等不能明文同步到目标端
+const (
+	TypeHash     = "hash"     // sha256(Salt + 值) 的 hex
+	TypeMask     = "mask"     // 保留前 KeepPrefix 个和后 KeepSuffix 个字符,中间替换成 MaskChar
+	TypeTruncate = "truncate" // 只保留前 Length 个字符
+	TypeReplace  = "replace"  // 替换成常量 Value
+	TypeDrop     = "drop"     // 删除字段
+	TypeRename   = "rename"   // 字段重命名为 NewName
+	TypeCast     = "cast"     // 类型转换, CastType: string,int64,float64,bool
+	TypeDerive   = "derive"   // 按 Template 生成新字段 Column, 模板标签和插件参数一样, 例如 {$SchemaName}.{$TableName}:{$id}
+)
+
+type Rule struct {
+	Type       string
+	Column     string
+	Salt       string `json:",omitempty"`
+	KeepPrefix int    `json:",omitempty"`
+	KeepSuffix int    `json:",omitempty"`
+	MaskChar   string `json:",omitempty"`
+	Length     int    `json:",omitempty"`
+	Value      string `json:",omitempty"`
+	NewName    string `json:",omitempty"`
+	CastType   string `json:",omitempty"`
+	Template   string `json:",omitempty"`
+}
+
+func (r *Rule) Check() error {
+	if r.Column == "" {
+		return fmt.Errorf("%s Column is empty", r.Type)
+	}
+	switch r.Type {
+	case TypeHash, TypeReplace, TypeDrop:
+		break
+	case TypeMask:
+		if r.KeepPrefix < 0 || r.KeepSuffix < 0 {
+			return fmt.Errorf("mask %s KeepPrefix and KeepSuffix must be >= 0", r.Column)
+		}
+	case TypeTruncate:
+		if r.Length <= 0 {
+			return fmt.Errorf("truncate %s Length must be > 0", r.Column)
+		}
+	case TypeRename:
+		if r.NewName == "" {
+			return fmt.Errorf("rename %s NewName is empty", r.Column)
+		}
+	case TypeCast:
+		switch r.CastType {
+		case "string", "int64", "float64", "bool":
+			break
+		default:
+			return fmt.Errorf("cast %s CastType:%s not support", r.Column, r.CastType)
+		}
+	case TypeDerive:
+		if r.Template == "" {
+			return fmt.Errorf("derive %s Template is empty", r.Column)
+		}
+	default:
+		return fmt.Errorf("transform type:%s not support", r.Type)
+	}
+	return nil
+}
+
+func Check(rules []*Rule) error {
+	for i, rule := range rules {
+		if rule == nil {
+			return fmt.Errorf("transform[%d] is nil", i)
+		}
+		if err := rule.Check(); err != nil {
+			return fmt.Errorf("transform[%d] %s", i, err)
+		}
+	}
+	return nil
+}
+
+// 按规则转换数据, 返回的是新的数据, 不会修改传进来的 data,因为 data 是多个 ToServer 共用的
+// sql,commit 等没有行数据的事件直接返回
+func Transform(rules []*Rule, data *pluginDriver.PluginDataType) *pluginDriver.PluginDataType {
+	if len(rules) == 0 || len(data.Rows) == 0 {
+		return data
+	}
+	newData := &pluginDriver.PluginDataType{
+		Timestamp:       data.Timestamp,
+		EventSize:       data.EventSize,
+		EventType:       data.EventType,
+		Rows:            make([]map[string]interface{}, len(data.Rows)),
+		Query:           data.Query,
+		SchemaName:      data.SchemaName,
+		TableName:       data.TableName,
+		AliasSchemaName: data.AliasSchemaName,
+		AliasTableName:  data.AliasTableName,
+		BinlogFileNum:   data.BinlogFileNum,
+		BinlogPosition:  data.BinlogPosition,
+		Gtid:            data.Gtid,
+		EventID:         data.EventID,
+		PayloadIndex:    data.PayloadIndex,
+	}
+	if data.Pri != nil {
+		newData.Pri = append([]string{}, data.Pri...)
+	}
+	for i, row := range data.Rows {
+		newRow := make(map[string]interface{}, len(row))
+		for k, v := range row {
+			newRow[k] = v
+		}
+		newData.Rows[i] = newRow
+	}
+	if data.ColumnMapping != nil {
+		newData.ColumnMapping = make(map[string]string, len(data.ColumnMapping))
+		for k, v := range data.ColumnMapping {
+			newData.ColumnMapping[k] = v
+		}
+	}
+	if data.PresentColumns != nil {
+		newData.PresentColumns = make([][]string, len(data.PresentColumns))
+		for i, columns := range data.PresentColumns {
+			if columns != nil {
+				newData.PresentColumns[i] = append([]string{}, columns...)
+			}
+		}
+	}
+	for _, rule := range rules {
+		rule.apply(newData)
+	}
+	return newData
+}
+
+func (r *Rule) apply(data *pluginDriver.PluginDataType) {
+	switch r.Type {
+	case TypeDrop:
+		for _, row := range data.Rows {
+			delete(row, r.Column)
+		}
+		delete(data.ColumnMapping, r.Column)
+		data.Pri = removeString(data.Pri, r.Column)
+		for i := range data.PresentColumns {
+			if data.PresentColumns[i] != nil {
+				data.PresentColumns[i] = removeString(data.PresentColumns[i], r.Column)
+			}
+		}
+		return
+	case TypeRename:
+		for _, row := range data.Rows {
+			if v, ok := row[r.Column]; ok {
+				delete(row, r.Column)
+				row[r.NewName] = v
+			}
+		}
+		if t, ok := data.ColumnMapping[r.Column]; ok {
+			delete(data.ColumnMapping, r.Column)
+			data.ColumnMapping[r.NewName] = t
+		}
+		replaceString(data.Pri, r.Column, r.NewName)
+		for i := range data.PresentColumns {
+			replaceString(data.PresentColumns[i], r.Column, r.NewName)
+		}
+		return
+	case TypeDerive:
+		for i, row := range data.Rows {
+			row[r.Column] = pluginDriver.TransfeResult(r.Template, data, i)
+			if i < len(data.PresentColumns) && data.PresentColumns[i] != nil && !containsString(data.PresentColumns[i], r.Column) {
+				data.PresentColumns[i] = append(data.PresentColumns[i], r.Column)
+			}
+		}
+		if data.ColumnMapping != nil {
+			data.ColumnMapping[r.Column] = "Nullable(string)"
+		}
+		return
+	}
+	for _, row := range data.Rows {
+		v, ok := row[r.Column]
+		if !ok {
+			continue
+		}
+		row[r.Column] = r.transferValue(v)
+	}
+	if t, ok := data.ColumnMapping[r.Column]; ok {
+		data.ColumnMapping[r.Column] = r.transferColumnMappingType(t)
+	}
+}
+
+func (r *Rule) transferValue(v interface{}) interface{} {
+	if r.Type == TypeReplace {
+		return r.Value
+	}
+	if v == nil {
+		return nil
+	}
+	switch r.Type {
+	case TypeHash:
+		sum := sha256.Sum256([]byte(r.Salt + toString(v)))
+		return hex.EncodeToString(sum[:])
+	case TypeMask:
+		return Mask(toString(v), r.KeepPrefix, r.KeepSuffix, r.MaskChar)
+	case TypeTruncate:
+		s := []rune(toString(v))
+		if len(s) > r.Length {
+			return string(s[:r.Length])
+		}
+		return string(s)
+	case TypeCast:
+		return Cast(v, r.CastType)
+	}
+	return v
+}
+
+func (r *Rule) transferColumnMappingType(t string) string {
+	nullable := strings.HasPrefix(t, "Nullable(")
+	var newType string
+	switch r.Type {
+	case TypeHash:
+		newType = "char(64)"
+	case TypeMask, TypeReplace:
+		newType = "string"
+	case TypeTruncate:
+		newType = fmt.Sprintf("varchar(%d)", r.Length)
+	case TypeCast:
+		switch r.CastType {
+		case "int64", "float64":
+			newType = r.CastType
+		case "bool":
+			newType = "bool"
+		default:
+			newType = "string"
+		}
+	default:
+		return t
+	}
+	// replace 之后有可能是常量空字符串, cast 失败的时候是 NULL
+	if nullable || r.Type == TypeCast {
+		return "Nullable(" + newType + ")"
+	}
+	return newType
+}
+
+// 保留前 keepPrefix 个和后 keepSuffix 个字符, 字符数不够的时候全部替换
+func Mask(s string, keepPrefix, keepSuffix int, maskChar string) string {
+	if maskChar == "" {
+		maskChar = "*"
+	}
+	r := []rune(s)
+	if keepPrefix+keepSuffix >= len(r) {
+		return strings.Repeat(maskChar, len(r))
+	}
+	return string(r[:keepPrefix]) + strings.Repeat(maskChar, len(r)-keepPrefix-keepSuffix) + string(r[len(r)-keepSuffix:])
+}
+
+// 转换失败返回 nil
+func Cast(v interface{}, castType string) interface{} {
+	s := toString(v)
+	switch castType {
+	case "string":
+		return s
+	case "int64":
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return int64(f)
+		}
+		if b, ok := v.(bool); ok {
+			if b {
+				return int64(1)
+			}
+			return int64(0)
+		}
+	case "float64":
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	case "bool":
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b
+		}
+	}
+	return nil
+}
+
+func toString(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case []byte:
+		return string(val)
+	}
+	return fmt.Sprint(v)
+}
+
+func removeString(list []string, s string) []string {
+	for i, v := range list {
+		if v == s {
+			return append(list[:i:i], list[i+1:]...)
+		}
+	}
+	return list
+}
+
+func replaceString(list []string, old, new string) {
+	for i, v := range list {
+		if v == old {
+			list[i] = new
+		}
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package transform
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+)
+
+func newTestData() *pluginDriver.PluginDataType {
+	return &pluginDriver.PluginDataType{
+		EventType:  "insert",
+		SchemaName: "bifrost_test",
+		TableName:  "user",
+		Rows: []map[string]interface{}{
+			{"id": int64(1), "email": "bifrost@example.com", "phone": "13800138000", "id_card": "110101199003077777", "age": "18", "note": "hello world", "nick": nil},
+		},
+		Pri:           []string{"id"},
+		ColumnMapping: map[string]string{"id": "int64", "email": "Nullable(varchar(100))", "phone": "Nullable(varchar(20))", "age": "Nullable(varchar(3))"},
+	}
+}
+
+func TestCheck(t *testing.T) {
+	Convey("normal", t, func() {
+		rules := []*Rule{
+			{Type: TypeHash, Column: "email", Salt: "s"},
+			{Type: TypeMask, Column: "phone", KeepPrefix: 3, KeepSuffix: 4},
+			{Type: TypeDerive, Column: "source", Template: "{$SchemaName}.{$TableName}"},
+		}
+		So(Check(rules), ShouldBeNil)
+	})
+
+	Convey("error", t, func() {
+		So(Check([]*Rule{{Type: "xxx", Column: "email"}}), ShouldNotBeNil)
+		So(Check([]*Rule{{Type: TypeHash}}), ShouldNotBeNil)
+		So(Check([]*Rule{{Type: TypeTruncate, Column: "note"}}), ShouldNotBeNil)
+		So(Check([]*Rule{{Type: TypeRename, Column: "note"}}), ShouldNotBeNil)
+		So(Check([]*Rule{{Type: TypeCast, Column: "age", CastType: "date"}}), ShouldNotBeNil)
+		So(Check([]*Rule{{Type: TypeDerive, Column: "source"}}), ShouldNotBeNil)
+		So(Check([]*Rule{nil}), ShouldNotBeNil)
+	})
+}
+
+func TestMask(t *testing.T) {
+	Convey("normal", t, func() {
+		So(Mask("13800138000", 3, 4, ""), ShouldEqual, "138****8000")
+		So(Mask("张三丰", 1, 0, "#"), ShouldEqual, "张##")
+		So(Mask("abc", 2, 2, ""), ShouldEqual, "***")
+	})
+}
+
+func TestTransform(t *testing.T) {
+	Convey("no rules", t, func() {
+		data := newTestData()
+		So(Transform(nil, data), ShouldEqual, data)
+	})
+
+	Convey("all rules", t, func() {
+		data := newTestData()
+		rules := []*Rule{
+			{Type: TypeDerive, Column: "email_domain", Template: "{$SchemaName}:{$email}"},
+			{Type: TypeHash, Column: "email", Salt: "bifrost"},
+			{Type: TypeMask, Column: "phone", KeepPrefix: 3, KeepSuffix: 4},
+			{Type: TypeReplace, Column: "id_card", Value: "******"},
+			{Type: TypeTruncate, Column: "note", Length: 5},
+			{Type: TypeCast, Column: "age", CastType: "int64"},
+			{Type: TypeRename, Column: "id", NewName: "user_id"},
+			{Type: TypeDrop, Column: "nick"},
+			{Type: TypeMask, Column: "not_exist"},
+		}
+		newData := Transform(rules, data)
+		sum := sha256.Sum256([]byte("bifrost" + "bifrost@example.com"))
+		row := newData.Rows[0]
+		So(row["email"], ShouldEqual, hex.EncodeToString(sum[:]))
+		So(row["email_domain"], ShouldEqual, "bifrost_test:bifrost@example.com")
+		So(row["phone"], ShouldEqual, "138****8000")
+		So(row["id_card"], ShouldEqual, "******")
+		So(row["note"], ShouldEqual, "hello")
+		So(row["age"], ShouldEqual, int64(18))
+		So(row["user_id"], ShouldEqual, int64(1))
+		_, ok := row["id"]
+		So(ok, ShouldBeFalse)
+		_, ok = row["nick"]
+		So(ok, ShouldBeFalse)
+		_, ok = row["not_exist"]
+		So(ok, ShouldBeFalse)
+		So(newData.Pri, ShouldResemble, []string{"user_id"})
+		So(newData.ColumnMapping["email"], ShouldEqual, "Nullable(char(64))")
+		So(newData.ColumnMapping["age"], ShouldEqual, "Nullable(int64)")
+		So(newData.ColumnMapping["user_id"], ShouldEqual, "int64")
+
+		// 原始数据不能被修改
+		So(data.Rows[0]["email"], ShouldEqual, "bifrost@example.com")
+		So(data.Rows[0]["id"], ShouldEqual, int64(1))
+		So(data.Pri, ShouldResemble, []string{"id"})
+		So(data.ColumnMapping["email"], ShouldEqual, "Nullable(varchar(100))")
+	})
+
+	Convey("null and cast error", t, func() {
+		data := newTestData()
+		data.Rows[0]["note"] = "abc"
+		newData := Transform([]*Rule{{Type: TypeHash, Column: "nick"}, {Type: TypeCast, Column: "note", CastType: "float64"}}, data)
+		So(newData.Rows[0]["nick"], ShouldBeNil)
+		So(newData.Rows[0]["note"], ShouldBeNil)
+	})
+
+	Convey("present columns", t, func() {
+		data := newTestData()
+		data.EventType = "update"
+		data.Rows = append(data.Rows, map[string]interface{}{"id": int64(1), "phone": "13800138001"})
+		data.PresentColumns = [][]string{nil, {"id", "phone"}}
+		newData := Transform([]*Rule{{Type: TypeRename, Column: "phone", NewName: "mobile"}, {Type: TypeDrop, Column: "id"}}, data)
+		So(newData.PresentColumns, ShouldResemble, [][]string{nil, {"mobile"}})
+		So(data.PresentColumns, ShouldResemble, [][]string{nil, {"id", "phone"}})
+	})
+}
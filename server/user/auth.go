@@ -0,0 +1,299 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brokercap/Bifrost/config"
+	"github.com/brokercap/Bifrost/server/user/ldap"
+	"github.com/brokercap/Bifrost/server/user/oidc"
+)
+
+// 外部认证, ldap 用户名密码登录, oidc 单点登录
+// 外部用户第一次登录成功之后保存到用户列表里, Source 为认证方式, 每次登录根据外部的组重新映射 Group 和 Roles
+
+const (
+	USER_SOURCE_LDAP = "ldap"
+	USER_SOURCE_OIDC = "oidc"
+)
+
+// 外部的组没有映射的时候不允许登录
+const EXTERNAL_GROUP_DENY = "deny"
+
+type ExternalUser struct {
+	Name   string
+	Groups []string
+}
+
+// 用户名密码方式的外部认证
+type PasswordAuthenticator interface {
+	Name() string
+	Authenticate(Name, Password string) (*ExternalUser, error)
+}
+
+type groupMapping struct {
+	Group string
+	Roles []string
+}
+
+var passwordAuthenticatorList []PasswordAuthenticator
+
+// 外部的组 => Bifrost 的组和角色
+var externalGroupMap = make(map[string]groupMapping)
+var externalDefaultGroup = USER_GROUP_MONITOR
+
+var oidcProvider *oidc.Provider
+
+func RegisterPasswordAuthenticator(auth PasswordAuthenticator) {
+	passwordAuthenticatorList = append(passwordAuthenticatorList, auth)
+}
+
+func GetOIDCProvider() *oidc.Provider {
+	return oidcProvider
+}
+
+func checkExternalUser(userInfo *UserInfo, Name, Password string) (*UserInfo, error) {
+	if Password == "" {
+		return nil, errors.New("password error")
+	}
+	for _, auth := range passwordAuthenticatorList {
+		// 已经存在的外部用户, 只能用原来的方式认证
+		if userInfo.Name != "" && userInfo.Source != auth.Name() {
+			continue
+		}
+		ext, err := auth.Authenticate(Name, Password)
+		if err != nil {
+			if err != ldap.ErrInvalidCredentials {
+				log.Println("user:", Name, " authenticate by", auth.Name(), "error:", err)
+			}
+			continue
+		}
+		return SaveExternalUser(auth.Name(), ext)
+	}
+	if userInfo.Name == "" {
+		return nil, errors.New("user not exist")
+	}
+	return nil, errors.New("password error")
+}
+
+// 外部认证成功之后, 保存用户, 返回映射之后的用户信息
+func SaveExternalUser(source string, ext *ExternalUser) (*UserInfo, error) {
+	if ext.Name == "" {
+		return nil, errors.New("external user name is empty")
+	}
+	OldUserInfo := GetUserInfo(ext.Name)
+	if OldUserInfo.Name != "" && OldUserInfo.Source != source {
+		// 不能用外部认证顶替本地用户
+		return nil, fmt.Errorf("user:%s already exist, source:%s", ext.Name, OldUserInfo.Source)
+	}
+	group, roles := mapExternalGroups(ext.Groups)
+	if group == EXTERNAL_GROUP_DENY {
+		return nil, fmt.Errorf("user:%s groups:%v not mapped", ext.Name, ext.Groups)
+	}
+	User := &UserInfo{
+		Name:       ext.Name,
+		Source:     source,
+		Group:      group,
+		Host:       "%",
+		Roles:      roles,
+		AddTime:    time.Now().Unix(),
+		UpdateTime: time.Now().Unix(),
+	}
+	if OldUserInfo.Name != "" {
+		// 保留原来的 Host
+		User.Host = OldUserInfo.Host
+		User.AddTime = OldUserInfo.AddTime
+		if User.Group == OldUserInfo.Group && strings.Join(User.Roles, ",") == strings.Join(OldUserInfo.Roles, ",") {
+			return User, nil
+		}
+	}
+	// ha standby 上不能写, 不影响登录
+	if err := saveUser(User); err != nil {
+		log.Println("save external user:", ext.Name, " error:", err)
+	}
+	return User, nil
+}
+
+// oidc 等不需要密码的外部认证, 和 CheckUserWithIP 一样校验 IP
+func CheckExternalUserWithIP(source string, ext *ExternalUser, IP string, RemoteAddrIp string) (*UserInfo, error) {
+	if RemoteAddrIp != "127.0.0.1" && CheckRefuseIp(IP) {
+		return nil, errors.New("ip is refused")
+	}
+	userInfo, err := SaveExternalUser(source, ext)
+	if err != nil {
+		AddFailedIp(IP)
+		appendLoginLog("IP:%s UserName:%s %s login failed", IP, ext.Name, source)
+		return nil, err
+	}
+	if err = CheckUserHost(IP, userInfo.Host); err != nil {
+		AddFailedIp(IP)
+		appendLoginLog("IP:%s UserName:%s CheckUserHost failed", IP, ext.Name)
+		return nil, err
+	}
+	appendLoginLog("IP:%s UserName:%s %s login success", IP, ext.Name, source)
+	return userInfo, nil
+}
+
+var groupLevel = map[string]int{
+	USER_GROUP_CUSTOM:        1,
+	USER_GROUP_MONITOR:       2,
+	USER_GROUP_ADMINISTRATOR: 3,
+}
+
+// 多个组取权限最大的, 角色取并集, 不存在的角色忽略
+func mapExternalGroups(groups []string) (group string, roles []string) {
+	roleMap := make(map[string]bool)
+	for _, name := range groups {
+		m, ok := externalGroupMap[name]
+		if !ok {
+			continue
+		}
+		if groupLevel[m.Group] > groupLevel[group] {
+			group = m.Group
+		}
+		for _, role := range m.Roles {
+			if !roleMap[role] && GetRole(role) != nil {
+				roleMap[role] = true
+				roles = append(roles, role)
+			}
+		}
+	}
+	if group == "" {
+		group = externalDefaultGroup
+	}
+	sort.Strings(roles)
+	return
+}
+
+// bifrost-admin=administrator
+// dba=custom:dba,dba_readonly
+func parseGroupMapping(val string) (groupMapping, error) {
+	var m groupMapping
+	arr := strings.SplitN(val, ":", 2)
+	m.Group = strings.TrimSpace(arr[0])
+	if _, ok := groupLevel[m.Group]; !ok {
+		return m, fmt.Errorf("group:%s not supported", m.Group)
+	}
+	if len(arr) == 2 {
+		for _, role := range strings.Split(arr[1], ",") {
+			if role = strings.TrimSpace(role); role != "" {
+				m.Roles = append(m.Roles, role)
+			}
+		}
+	}
+	return m, nil
+}
+
+func getTimeoutConfig(module string) time.Duration {
+	val := config.GetConfigVal(module, "timeout")
+	if val == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil || n <= 0 {
+		log.Println("config [", module, "] timeout:", val, " error")
+		os.Exit(1)
+	}
+	return time.Duration(n) * time.Second
+}
+
+func InitAuth() {
+	if hashType := config.GetConfigVal("auth", "password_hash"); hashType != "" {
+		if err := SetPasswordHashType(hashType); err != nil {
+			log.Println("config [auth]", err)
+			os.Exit(1)
+		}
+	}
+	if group := config.GetConfigVal("auth", "external_default_group"); group != "" {
+		if _, ok := groupLevel[group]; !ok && group != EXTERNAL_GROUP_DENY {
+			log.Println("config [auth] external_default_group:", group, " not supported")
+			os.Exit(1)
+		}
+		externalDefaultGroup = group
+	}
+	for name, val := range config.GetConf("auth_group_map") {
+		m, err := parseGroupMapping(val)
+		if err != nil {
+			log.Println("config [auth_group_map]", name, "err:", err)
+			os.Exit(1)
+		}
+		externalGroupMap[name] = m
+	}
+	initLDAP()
+	initOIDC()
+}
+
+type ldapAuthenticator struct {
+	cfg *ldap.Config
+}
+
+func (auth *ldapAuthenticator) Name() string {
+	return USER_SOURCE_LDAP
+}
+
+func (auth *ldapAuthenticator) Authenticate(Name, Password string) (*ExternalUser, error) {
+	groups, err := auth.cfg.Authenticate(Name, Password)
+	if err != nil {
+		return nil, err
+	}
+	return &ExternalUser{Name: Name, Groups: groups}, nil
+}
+
+func initLDAP() {
+	if config.GetConfigVal("ldap", "enable") != "true" {
+		return
+	}
+	cfg := &ldap.Config{
+		URL:                config.GetConfigVal("ldap", "url"),
+		InsecureSkipVerify: config.GetConfigVal("ldap", "insecure_skip_verify") == "true",
+		Timeout:            getTimeoutConfig("ldap"),
+		UserDN:             config.GetConfigVal("ldap", "user_dn"),
+		BindDN:             config.GetConfigVal("ldap", "bind_dn"),
+		BindPassword:       config.GetConfigVal("ldap", "bind_password"),
+		BaseDN:             config.GetConfigVal("ldap", "base_dn"),
+		UserFilter:         config.GetConfigVal("ldap", "user_filter"),
+		GroupBaseDN:        config.GetConfigVal("ldap", "group_base_dn"),
+		GroupFilter:        config.GetConfigVal("ldap", "group_filter"),
+		GroupAttr:          config.GetConfigVal("ldap", "group_attr"),
+	}
+	if err := cfg.Check(); err != nil {
+		log.Println("config [ldap]", err)
+		os.Exit(1)
+	}
+	RegisterPasswordAuthenticator(&ldapAuthenticator{cfg: cfg})
+	log.Println("ldap auth enable, url:", cfg.URL)
+}
+
+func initOIDC() {
+	if config.GetConfigVal("oidc", "enable") != "true" {
+		return
+	}
+	var scopes []string
+	for _, scope := range strings.Split(config.GetConfigVal("oidc", "scopes"), ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	p, err := oidc.NewProvider(oidc.Config{
+		Issuer:        config.GetConfigVal("oidc", "issuer"),
+		ClientID:      config.GetConfigVal("oidc", "client_id"),
+		ClientSecret:  config.GetConfigVal("oidc", "client_secret"),
+		RedirectURL:   config.GetConfigVal("oidc", "redirect_url"),
+		Scopes:        scopes,
+		UsernameClaim: config.GetConfigVal("oidc", "username_claim"),
+		GroupsClaim:   config.GetConfigVal("oidc", "groups_claim"),
+		Timeout:       getTimeoutConfig("oidc"),
+	})
+	if err != nil {
+		log.Println("config [oidc]", err)
+		os.Exit(1)
+	}
+	oidcProvider = p
+	log.Println("oidc auth enable, issuer:", config.GetConfigVal("oidc", "issuer"))
+}
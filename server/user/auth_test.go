@@ -0,0 +1,140 @@
+package user
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/brokercap/Bifrost/server/user/ldap"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type testAuthenticator struct {
+	users map[string]*ExternalUser
+}
+
+func (auth *testAuthenticator) Name() string {
+	return USER_SOURCE_LDAP
+}
+
+func (auth *testAuthenticator) Authenticate(Name, Password string) (*ExternalUser, error) {
+	if ext, ok := auth.users[Name]; ok && Password == Name+"pwd" {
+		return ext, nil
+	}
+	return nil, ldap.ErrInvalidCredentials
+}
+
+func initTestAuth() {
+	initTestRoleStorage(nil)
+	UpdateRole(Role{Name: "dba"})
+	UpdateRole(Role{Name: "app"})
+	externalDefaultGroup = USER_GROUP_MONITOR
+	externalGroupMap = make(map[string]groupMapping)
+	for name, val := range map[string]string{
+		"bifrost-admin": "administrator",
+		"dba":           "custom:dba,not_exist",
+		"app":           "custom: app , dba",
+		"readers":       "monitor",
+	} {
+		m, _ := parseGroupMapping(val)
+		externalGroupMap[name] = m
+	}
+	passwordAuthenticatorList = []PasswordAuthenticator{&testAuthenticator{users: map[string]*ExternalUser{
+		"alice": {Name: "alice", Groups: []string{"dba", "bifrost-admin"}},
+		"bob":   {Name: "bob", Groups: []string{"app", "dba"}},
+		"carol": {Name: "carol", Groups: []string{"other"}},
+		"local": {Name: "local", Groups: []string{"bifrost-admin"}},
+	}}}
+}
+
+func TestMapExternalGroups(t *testing.T) {
+	initTestAuth()
+	defer func() { externalGroupMap = make(map[string]groupMapping) }()
+	Convey("map external groups", t, func() {
+		group, roles := mapExternalGroups([]string{"dba", "bifrost-admin"})
+		So(group, ShouldEqual, USER_GROUP_ADMINISTRATOR)
+		So(roles, ShouldResemble, []string{"dba"})
+
+		group, roles = mapExternalGroups([]string{"app", "dba"})
+		So(group, ShouldEqual, USER_GROUP_CUSTOM)
+		So(roles, ShouldResemble, []string{"app", "dba"})
+
+		group, roles = mapExternalGroups([]string{"dba", "readers"})
+		So(group, ShouldEqual, USER_GROUP_MONITOR)
+		So(roles, ShouldResemble, []string{"dba"})
+
+		group, roles = mapExternalGroups(nil)
+		So(group, ShouldEqual, USER_GROUP_MONITOR)
+		So(len(roles), ShouldEqual, 0)
+
+		_, err := parseGroupMapping("root:dba")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestCheckExternalUser(t *testing.T) {
+	initTestAuth()
+	defer func() {
+		passwordAuthenticatorList = nil
+		externalGroupMap = make(map[string]groupMapping)
+		externalDefaultGroup = USER_GROUP_MONITOR
+	}()
+
+	Convey("external user login and save", t, func() {
+		kv := initTestUserStorage()
+		b, _ := json.Marshal(UserInfo{Name: "local", Password: "localpwd", Group: USER_GROUP_MONITOR})
+		kv[USER_PREFIX+"local"] = string(b)
+
+		userInfo, err := CheckUser("bob", "bobpwd")
+		So(err, ShouldBeNil)
+		So(userInfo.Group, ShouldEqual, USER_GROUP_CUSTOM)
+		So(userInfo.Roles, ShouldResemble, []string{"app", "dba"})
+		saved := GetUserInfo("bob")
+		So(saved.Source, ShouldEqual, USER_SOURCE_LDAP)
+		So(saved.Password, ShouldEqual, "")
+		So(saved.Host, ShouldEqual, "%")
+
+		_, err = CheckUser("bob", "wrong")
+		So(err, ShouldNotBeNil)
+		_, err = CheckUser("bob", "")
+		So(err, ShouldNotBeNil)
+
+		// 本地用户不会走外部认证, 外部认证也不能顶替本地用户
+		userInfo, err = CheckUser("local", "localpwd")
+		So(err, ShouldBeNil)
+		So(userInfo.Group, ShouldEqual, USER_GROUP_MONITOR)
+		_, err = SaveExternalUser(USER_SOURCE_OIDC, &ExternalUser{Name: "local", Groups: []string{"bifrost-admin"}})
+		So(err, ShouldNotBeNil)
+
+		// 外部用户不能在后台改成本地用户
+		So(UpdateUser("bob", "newpwd", USER_GROUP_ADMINISTRATOR, "%", nil), ShouldNotBeNil)
+
+		// 没有映射的组
+		userInfo, err = CheckUser("carol", "carolpwd")
+		So(err, ShouldBeNil)
+		So(userInfo.Group, ShouldEqual, USER_GROUP_MONITOR)
+		externalDefaultGroup = EXTERNAL_GROUP_DENY
+		_, err = CheckUser("carol", "carolpwd")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("oidc user can't login with password", t, func() {
+		initTestUserStorage()
+		externalDefaultGroup = USER_GROUP_MONITOR
+		userInfo, err := SaveExternalUser(USER_SOURCE_OIDC, &ExternalUser{Name: "alice", Groups: []string{"bifrost-admin"}})
+		So(err, ShouldBeNil)
+		So(userInfo.Group, ShouldEqual, USER_GROUP_ADMINISTRATOR)
+		_, err = CheckUser("alice", "alicepwd")
+		So(err, ShouldNotBeNil)
+		_, err = CheckUser("alice", "")
+		So(err, ShouldNotBeNil)
+
+		// 组变化之后重新映射, Host 保留
+		kv := initTestUserStorage()
+		b, _ := json.Marshal(UserInfo{Name: "alice", Source: USER_SOURCE_OIDC, Group: USER_GROUP_ADMINISTRATOR, Host: "10.0.%.%"})
+		kv[USER_PREFIX+"alice"] = string(b)
+		userInfo, err = SaveExternalUser(USER_SOURCE_OIDC, &ExternalUser{Name: "alice", Groups: []string{"dba"}})
+		So(err, ShouldBeNil)
+		So(GetUserInfo("alice").Group, ShouldEqual, USER_GROUP_CUSTOM)
+		So(GetUserInfo("alice").Host, ShouldEqual, "10.0.%.%")
+	})
+}
@@ -0,0 +1,151 @@
+package ldap
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+// 协议部分用 github.com/go-ldap/ldap, 这里只处理认证和用户组的逻辑
+
+// 模板里的占位符
+// {username} : 登录的用户名
+// {dn} : 用户的 DN, 只有 group_filter 里可以用
+
+type Config struct {
+	URL                string
+	InsecureSkipVerify bool
+	Timeout            time.Duration
+
+	// 直接用 user_dn 模板拼出用户 DN 进行 bind, 如 uid={username},ou=people,dc=example,dc=com
+	UserDN string
+
+	// 没有配置 UserDN 的时候, 先用服务账号 bind, 再根据 UserFilter 查出用户 DN
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	UserFilter   string
+
+	// 不配置 GroupBaseDN 则不查询用户组
+	GroupBaseDN string
+	GroupFilter string
+	GroupAttr   string
+}
+
+var ErrInvalidCredentials = errors.New("ldap invalid credentials")
+
+func (cfg *Config) Check() error {
+	if cfg.URL == "" {
+		return fmt.Errorf("ldap url not be empty")
+	}
+	if !strings.HasPrefix(cfg.URL, "ldap://") && !strings.HasPrefix(cfg.URL, "ldaps://") {
+		return fmt.Errorf("ldap url:%s must be start with ldap:// or ldaps://", cfg.URL)
+	}
+	if cfg.UserDN == "" {
+		if cfg.BaseDN == "" || cfg.UserFilter == "" {
+			return fmt.Errorf("ldap user_dn or base_dn and user_filter must be set")
+		}
+		if _, err := goldap.CompileFilter(strings.Replace(cfg.UserFilter, "{username}", "test", -1)); err != nil {
+			return err
+		}
+	} else if !strings.Contains(cfg.UserDN, "{username}") {
+		return fmt.Errorf("ldap user_dn:%s must be contains {username}", cfg.UserDN)
+	}
+	if cfg.GroupBaseDN != "" {
+		if cfg.GroupFilter == "" {
+			cfg.GroupFilter = "(member={dn})"
+		}
+		if cfg.GroupAttr == "" {
+			cfg.GroupAttr = "cn"
+		}
+		f := strings.NewReplacer("{username}", "test", "{dn}", "test").Replace(cfg.GroupFilter)
+		if _, err := goldap.CompileFilter(f); err != nil {
+			return err
+		}
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	return nil
+}
+
+func (cfg *Config) dial() (*goldap.Conn, error) {
+	opts := []goldap.DialOpt{goldap.DialWithDialer(&net.Dialer{Timeout: cfg.Timeout})}
+	if cfg.InsecureSkipVerify {
+		opts = append(opts, goldap.DialWithTLSConfig(&tls.Config{InsecureSkipVerify: true}))
+	}
+	conn, err := goldap.DialURL(cfg.URL, opts...)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(cfg.Timeout)
+	return conn, nil
+}
+
+func (cfg *Config) search(conn *goldap.Conn, baseDN, filter string, attributes []string) ([]*goldap.Entry, error) {
+	req := goldap.NewSearchRequest(baseDN, goldap.ScopeWholeSubtree, goldap.NeverDerefAliases, 0, int(cfg.Timeout/time.Second), false, filter, attributes, nil)
+	result, err := conn.Search(req)
+	if err != nil {
+		return nil, err
+	}
+	return result.Entries, nil
+}
+
+// 认证成功, 返回用户所在的组
+func (cfg *Config) Authenticate(Name, Password string) (groups []string, err error) {
+	// 空密码在很多 LDAP 服务上是匿名 bind, 会直接成功
+	if Name == "" || Password == "" {
+		return nil, ErrInvalidCredentials
+	}
+	conn, err := cfg.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var userDN string
+	if cfg.UserDN != "" {
+		userDN = strings.Replace(cfg.UserDN, "{username}", goldap.EscapeDN(Name), -1)
+	} else {
+		if cfg.BindDN != "" {
+			if err = conn.Bind(cfg.BindDN, cfg.BindPassword); err != nil {
+				return nil, fmt.Errorf("ldap service bind err:%s", err)
+			}
+		}
+		filter := strings.Replace(cfg.UserFilter, "{username}", goldap.EscapeFilter(Name), -1)
+		// 1.1 表示不返回任何属性, 只要 DN
+		entries, err := cfg.search(conn, cfg.BaseDN, filter, []string{"1.1"})
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) != 1 {
+			return nil, ErrInvalidCredentials
+		}
+		userDN = entries[0].DN
+	}
+
+	if err = conn.Bind(userDN, Password); err != nil {
+		if goldap.IsErrorWithCode(err, goldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	if cfg.GroupBaseDN == "" {
+		return nil, nil
+	}
+	filter := strings.NewReplacer("{username}", goldap.EscapeFilter(Name), "{dn}", goldap.EscapeFilter(userDN)).Replace(cfg.GroupFilter)
+	entries, err := cfg.search(conn, cfg.GroupBaseDN, filter, []string{cfg.GroupAttr})
+	if err != nil {
+		return nil, fmt.Errorf("ldap search group err:%s", err)
+	}
+	for _, entry := range entries {
+		groups = append(groups, entry.GetEqualFoldAttributeValues(cfg.GroupAttr)...)
+	}
+	return groups, nil
+}
@@ -0,0 +1,225 @@
+package ldap
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	goldap "github.com/go-ldap/ldap/v3"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type stubEntry struct {
+	dn       string
+	password string
+	attrs    map[string][]string
+}
+
+// 只实现 bind, search, unbind 的 LDAP 服务
+type stubServer struct {
+	ln      net.Listener
+	entries []stubEntry
+}
+
+func newStubServer(t *testing.T, entries []stubEntry) *stubServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &stubServer{ln: ln, entries: entries}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *stubServer) url() string {
+	return "ldap://" + s.ln.Addr().String()
+}
+
+func (s *stubServer) Close() {
+	s.ln.Close()
+}
+
+func newResult(tag ber.Tag, code int64) *ber.Packet {
+	p := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, ""))
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	return p
+}
+
+func newEntry(e stubEntry) *ber.Packet {
+	p := ber.Encode(ber.ClassApplication, ber.TypeConstructed, goldap.ApplicationSearchResultEntry, nil, "")
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, ""))
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	for k, vals := range e.attrs {
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, k, ""))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+		for _, v := range vals {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, ""))
+		}
+		attr.AppendChild(set)
+		attrs.AppendChild(attr)
+	}
+	p.AppendChild(attrs)
+	return p
+}
+
+func (s *stubServer) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		msg, err := ber.ReadPacket(conn)
+		if err != nil || len(msg.Children) < 2 {
+			return
+		}
+		msgID, _ := msg.Children[0].Value.(int64)
+		op := msg.Children[1]
+		reply := func(resp *ber.Packet) {
+			p := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+			p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, msgID, ""))
+			p.AppendChild(resp)
+			conn.Write(p.Bytes())
+		}
+		switch op.Tag {
+		case goldap.ApplicationBindRequest:
+			dn, password := op.Children[1].Data.String(), op.Children[2].Data.String()
+			code := int64(goldap.LDAPResultInvalidCredentials)
+			for _, e := range s.entries {
+				if e.dn == dn && e.password == password && password != "" {
+					code = goldap.LDAPResultSuccess
+				}
+			}
+			reply(newResult(goldap.ApplicationBindResponse, code))
+		case goldap.ApplicationSearchRequest:
+			base, filter := op.Children[0].Data.String(), op.Children[6]
+			for _, e := range s.entries {
+				if strings.HasSuffix(e.dn, base) && matchStubFilter(filter, e.attrs) {
+					reply(newEntry(e))
+				}
+			}
+			reply(newResult(goldap.ApplicationSearchResultDone, goldap.LDAPResultSuccess))
+		case goldap.ApplicationUnbindRequest:
+			return
+		}
+	}
+}
+
+func matchStubFilter(f *ber.Packet, attrs map[string][]string) bool {
+	switch f.Tag {
+	case goldap.FilterAnd:
+		for _, c := range f.Children {
+			if !matchStubFilter(c, attrs) {
+				return false
+			}
+		}
+		return true
+	case goldap.FilterOr:
+		for _, c := range f.Children {
+			if matchStubFilter(c, attrs) {
+				return true
+			}
+		}
+		return false
+	case goldap.FilterNot:
+		return !matchStubFilter(f.Children[0], attrs)
+	case goldap.FilterPresent:
+		return len(attrs[f.Data.String()]) > 0
+	case goldap.FilterEqualityMatch:
+		for _, v := range attrs[f.Children[0].Data.String()] {
+			if strings.EqualFold(v, f.Children[1].Data.String()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var testEntries = []stubEntry{
+	{dn: "cn=admin,dc=example,dc=com", password: "adminpwd"},
+	{dn: "uid=alice,ou=people,dc=example,dc=com", password: "alicepwd", attrs: map[string][]string{
+		"uid": {"alice"}, "objectClass": {"person"},
+	}},
+	{dn: "uid=bob,ou=people,dc=example,dc=com", password: "bobpwd", attrs: map[string][]string{
+		"uid": {"bob"}, "objectClass": {"person"},
+	}},
+	{dn: "cn=bifrost-admin,ou=groups,dc=example,dc=com", attrs: map[string][]string{
+		"cn": {"bifrost-admin"}, "member": {"uid=alice,ou=people,dc=example,dc=com"},
+	}},
+	{dn: "cn=dba,ou=groups,dc=example,dc=com", attrs: map[string][]string{
+		"cn": {"dba"}, "member": {"uid=alice,ou=people,dc=example,dc=com", "uid=bob,ou=people,dc=example,dc=com"},
+	}},
+}
+
+func TestAuthenticate(t *testing.T) {
+	s := newStubServer(t, testEntries)
+	defer s.Close()
+
+	Convey("direct bind with user_dn", t, func() {
+		cfg := &Config{URL: s.url(), UserDN: "uid={username},ou=people,dc=example,dc=com"}
+		So(cfg.Check(), ShouldBeNil)
+		groups, err := cfg.Authenticate("alice", "alicepwd")
+		So(err, ShouldBeNil)
+		So(len(groups), ShouldEqual, 0)
+		_, err = cfg.Authenticate("alice", "wrong")
+		So(err, ShouldEqual, ErrInvalidCredentials)
+		_, err = cfg.Authenticate("alice", "")
+		So(err, ShouldEqual, ErrInvalidCredentials)
+	})
+
+	Convey("search user and groups", t, func() {
+		cfg := &Config{
+			URL:          s.url(),
+			BindDN:       "cn=admin,dc=example,dc=com",
+			BindPassword: "adminpwd",
+			BaseDN:       "ou=people,dc=example,dc=com",
+			UserFilter:   "(&(objectClass=person)(uid={username}))",
+			GroupBaseDN:  "ou=groups,dc=example,dc=com",
+			Timeout:      time.Second,
+		}
+		So(cfg.Check(), ShouldBeNil)
+		So(cfg.GroupFilter, ShouldEqual, "(member={dn})")
+		groups, err := cfg.Authenticate("alice", "alicepwd")
+		So(err, ShouldBeNil)
+		So(groups, ShouldResemble, []string{"bifrost-admin", "dba"})
+
+		groups, err = cfg.Authenticate("bob", "bobpwd")
+		So(err, ShouldBeNil)
+		So(groups, ShouldResemble, []string{"dba"})
+
+		_, err = cfg.Authenticate("bob", "alicepwd")
+		So(err, ShouldEqual, ErrInvalidCredentials)
+		// filter 注入
+		_, err = cfg.Authenticate("*", "alicepwd")
+		So(err, ShouldEqual, ErrInvalidCredentials)
+		_, err = cfg.Authenticate("not_exist", "pwd")
+		So(err, ShouldEqual, ErrInvalidCredentials)
+	})
+
+	Convey("service bind failed", t, func() {
+		cfg := &Config{URL: s.url(), BindDN: "cn=admin,dc=example,dc=com", BindPassword: "wrong",
+			BaseDN: "dc=example,dc=com", UserFilter: "(uid={username})"}
+		So(cfg.Check(), ShouldBeNil)
+		_, err := cfg.Authenticate("alice", "alicepwd")
+		So(err, ShouldNotBeNil)
+		So(err, ShouldNotEqual, ErrInvalidCredentials)
+	})
+
+	Convey("config check", t, func() {
+		So((&Config{}).Check(), ShouldNotBeNil)
+		So((&Config{URL: "http://127.0.0.1", UserDN: "uid={username}"}).Check(), ShouldNotBeNil)
+		So((&Config{URL: s.url(), UserDN: "uid=alice"}).Check(), ShouldNotBeNil)
+		So((&Config{URL: s.url(), BaseDN: "dc=example,dc=com"}).Check(), ShouldNotBeNil)
+		So((&Config{URL: s.url(), BaseDN: "dc=example,dc=com", UserFilter: "uid={username}"}).Check(), ShouldNotBeNil)
+		So((&Config{URL: s.url(), UserDN: "uid={username}", GroupBaseDN: "dc=example,dc=com", GroupFilter: "(&(member={dn})"}).Check(), ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,194 @@
+package oidc
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	gooidc "github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// OpenID Connect 授权码模式登录, id_token 只支持 RS256, RS384, RS512 签名
+// discovery, jwks 及 id_token 的签名, iss, aud, exp 由 go-oidc 校验, nonce, azp, iat 在这里校验
+
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	// 用哪个 claim 作为 Bifrost 的用户名, 默认 preferred_username, 没有则用 sub
+	UsernameClaim string
+	GroupsClaim   string
+	Timeout       time.Duration
+}
+
+type Claims struct {
+	Subject  string
+	Username string
+	Groups   []string
+}
+
+type Provider struct {
+	sync.Mutex
+	cfg          Config
+	client       *http.Client
+	provider     *gooidc.Provider
+	oauth2Config *oauth2.Config
+	verifier     *gooidc.IDTokenVerifier
+}
+
+// 允许的时钟误差
+const clockSkew = 60 * time.Second
+
+func (cfg *Config) Check() error {
+	if cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return fmt.Errorf("oidc issuer, client_id, redirect_url not be empty")
+	}
+	if _, err := url.Parse(cfg.Issuer); err != nil {
+		return fmt.Errorf("oidc issuer:%s err:%s", cfg.Issuer, err)
+	}
+	cfg.Issuer = strings.TrimSuffix(cfg.Issuer, "/")
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "profile", "groups"}
+	}
+	hasOpenid := false
+	for _, scope := range cfg.Scopes {
+		if scope == "openid" {
+			hasOpenid = true
+		}
+	}
+	if !hasOpenid {
+		cfg.Scopes = append([]string{"openid"}, cfg.Scopes...)
+	}
+	if cfg.UsernameClaim == "" {
+		cfg.UsernameClaim = "preferred_username"
+	}
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = "groups"
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	return nil
+}
+
+func NewProvider(cfg Config) (*Provider, error) {
+	if err := cfg.Check(); err != nil {
+		return nil, err
+	}
+	return &Provider{cfg: cfg, client: &http.Client{Timeout: cfg.Timeout}}, nil
+}
+
+// 请求 IdP 都用带超时的 http client
+func (p *Provider) context() context.Context {
+	return gooidc.ClientContext(context.Background(), p.client)
+}
+
+// 第一次使用的时候才去拉取, 启动的时候 IdP 不可用不影响 Bifrost 启动
+// jwks 由 go-oidc 缓存, 找不到 kid 的时候重新拉取
+func (p *Provider) discover() error {
+	p.Lock()
+	defer p.Unlock()
+	if p.provider != nil {
+		return nil
+	}
+	provider, err := gooidc.NewProvider(p.context(), p.cfg.Issuer)
+	if err != nil {
+		return fmt.Errorf("oidc discovery err:%s", err)
+	}
+	p.provider = provider
+	p.oauth2Config = &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		RedirectURL:  p.cfg.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       p.cfg.Scopes,
+	}
+	p.verifier = provider.Verifier(&gooidc.Config{
+		ClientID:             p.cfg.ClientID,
+		SupportedSigningAlgs: []string{gooidc.RS256, gooidc.RS384, gooidc.RS512},
+	})
+	return nil
+}
+
+func (p *Provider) AuthCodeURL(state, nonce string) (string, error) {
+	if err := p.discover(); err != nil {
+		return "", err
+	}
+	return p.oauth2Config.AuthCodeURL(state, gooidc.Nonce(nonce)), nil
+}
+
+// 用授权码换 id_token, 并校验 id_token
+func (p *Provider) Exchange(code, nonce string) (*Claims, error) {
+	if err := p.discover(); err != nil {
+		return nil, err
+	}
+	token, err := p.oauth2Config.Exchange(p.context(), code)
+	if err != nil {
+		return nil, fmt.Errorf("oidc token err:%s", err)
+	}
+	idToken, _ := token.Extra("id_token").(string)
+	if idToken == "" {
+		return nil, fmt.Errorf("oidc token response id_token is empty")
+	}
+	return p.Verify(idToken, nonce)
+}
+
+func (p *Provider) Verify(idToken, nonce string) (*Claims, error) {
+	if err := p.discover(); err != nil {
+		return nil, err
+	}
+	token, err := p.verifier.Verify(p.context(), idToken)
+	if err != nil {
+		return nil, fmt.Errorf("id_token verify err:%s", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(token.Nonce), []byte(nonce)) != 1 || nonce == "" {
+		return nil, fmt.Errorf("id_token nonce error")
+	}
+	if token.IssuedAt.IsZero() || token.IssuedAt.After(time.Now().Add(clockSkew)) {
+		return nil, fmt.Errorf("id_token iat error")
+	}
+	var data map[string]interface{}
+	if err = token.Claims(&data); err != nil {
+		return nil, fmt.Errorf("id_token payload err:%s", err)
+	}
+	// 多个 aud 的时候必须有 azp, 有 azp 的时候必须是当前的 client_id
+	azp, _ := data["azp"].(string)
+	if (len(token.Audience) > 1 && azp == "") || (azp != "" && azp != p.cfg.ClientID) {
+		return nil, fmt.Errorf("id_token azp:%s error", azp)
+	}
+	claims := &Claims{Subject: token.Subject}
+	claims.Username, _ = data[p.cfg.UsernameClaim].(string)
+	if claims.Username == "" {
+		claims.Username = claims.Subject
+	}
+	if claims.Username == "" {
+		return nil, fmt.Errorf("id_token claim:%s and sub is empty", p.cfg.UsernameClaim)
+	}
+	claims.Groups = toStringList(data[p.cfg.GroupsClaim])
+	return claims, nil
+}
+
+func toStringList(v interface{}) []string {
+	switch val := v.(type) {
+	case string:
+		return []string{val}
+	case []interface{}:
+		list := make([]string, 0, len(val))
+		for _, s := range val {
+			if str, ok := s.(string); ok {
+				list = append(list, str)
+			}
+		}
+		return list
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type testIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	// code => id_token
+	codes map[string]string
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &testIdP{key: key, codes: make(map[string]string)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		r.ParseForm()
+		idToken, ok := idp.codes[r.PostForm.Get("code")]
+		if id != "bifrost" || secret != "secret" || !ok || r.PostForm.Get("grant_type") != "authorization_code" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "at", "id_token": idToken, "token_type": "Bearer"})
+	})
+	idp.server = httptest.NewServer(mux)
+	return idp
+}
+
+func (idp *testIdP) sign(kid string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	s := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	h := sha256.Sum256([]byte(s))
+	sig, _ := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, h[:])
+	return s + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func (idp *testIdP) claims(nonce string) map[string]interface{} {
+	return map[string]interface{}{
+		"iss":                idp.server.URL,
+		"aud":                "bifrost",
+		"sub":                "10001",
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"iat":                time.Now().Unix(),
+		"nonce":              nonce,
+		"preferred_username": "alice",
+		"groups":             []string{"bifrost-admin", "dba"},
+	}
+}
+
+func TestProvider(t *testing.T) {
+	idp := newTestIdP(t)
+	defer idp.server.Close()
+	p, err := NewProvider(Config{Issuer: idp.server.URL + "/", ClientID: "bifrost", ClientSecret: "secret", RedirectURL: "http://127.0.0.1:21036/login/oidc/callback"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("auth code url", t, func() {
+		uri, err := p.AuthCodeURL("state1", "nonce1")
+		So(err, ShouldBeNil)
+		u, _ := url.Parse(uri)
+		So(u.Path, ShouldEqual, "/authorize")
+		So(u.Query().Get("state"), ShouldEqual, "state1")
+		So(u.Query().Get("nonce"), ShouldEqual, "nonce1")
+		So(u.Query().Get("client_id"), ShouldEqual, "bifrost")
+		So(strings.HasPrefix(u.Query().Get("scope"), "openid"), ShouldBeTrue)
+	})
+
+	Convey("exchange", t, func() {
+		idp.codes["code1"] = idp.sign("k1", idp.claims("nonce1"))
+		claims, err := p.Exchange("code1", "nonce1")
+		So(err, ShouldBeNil)
+		So(claims.Username, ShouldEqual, "alice")
+		So(claims.Subject, ShouldEqual, "10001")
+		So(claims.Groups, ShouldResemble, []string{"bifrost-admin", "dba"})
+
+		_, err = p.Exchange("code1", "nonce2")
+		So(err, ShouldNotBeNil)
+		_, err = p.Exchange("not_exist", "nonce1")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("verify id_token", t, func() {
+		c := idp.claims("n")
+		delete(c, "preferred_username")
+		c["groups"] = "dba"
+		claims, err := p.Verify(idp.sign("k1", c), "n")
+		So(err, ShouldBeNil)
+		So(claims.Username, ShouldEqual, "10001")
+		So(claims.Groups, ShouldResemble, []string{"dba"})
+
+		for k, v := range map[string]interface{}{
+			"iss": "http://other",
+			"aud": []string{"other"},
+			"exp": time.Now().Add(-time.Hour).Unix(),
+			"iat": time.Now().Add(time.Hour).Unix(),
+			"azp": "other",
+		} {
+			c := idp.claims("n")
+			c[k] = v
+			_, err := p.Verify(idp.sign("k1", c), "n")
+			So(err, ShouldNotBeNil)
+		}
+		_, err = p.Verify(idp.sign("k1", idp.claims("")), "")
+		So(err, ShouldNotBeNil)
+
+		// 多个 aud 的时候要有 azp
+		c = idp.claims("n")
+		c["aud"] = []string{"bifrost", "other"}
+		_, err = p.Verify(idp.sign("k1", c), "n")
+		So(err, ShouldNotBeNil)
+		c["azp"] = "bifrost"
+		_, err = p.Verify(idp.sign("k1", c), "n")
+		So(err, ShouldBeNil)
+		_, err = p.Verify(idp.sign("k2", idp.claims("n")), "n")
+		So(err, ShouldNotBeNil)
+
+		// 只有一个 key 的时候不带 kid, 在 jwks 刷新间隔内也可以校验
+		claims, err = p.Verify(idp.sign("", idp.claims("n")), "n")
+		So(err, ShouldBeNil)
+		So(claims.Username, ShouldEqual, "alice")
+		claims, err = p.Verify(idp.sign("", idp.claims("n")), "n")
+		So(err, ShouldBeNil)
+
+		// 篡改 payload
+		token := idp.sign("k1", idp.claims("n"))
+		arr := strings.Split(token, ".")
+		c = idp.claims("n")
+		c["preferred_username"] = "admin"
+		payload, _ := json.Marshal(c)
+		arr[1] = base64.RawURLEncoding.EncodeToString(payload)
+		_, err = p.Verify(strings.Join(arr, "."), "n")
+		So(err, ShouldNotBeNil)
+
+		// 不接受 none 签名
+		header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+		_, err = p.Verify(header+"."+arr[1]+".", "n")
+		So(err, ShouldNotBeNil)
+	})
+}
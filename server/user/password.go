@@ -0,0 +1,179 @@
+package user
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 存储里只保存密码的 hash, 支持 bcrypt 和 argon2id
+// 老版本保存的明文密码, 在第一次登录成功的时候转成 hash
+
+const (
+	PASSWORD_HASH_BCRYPT   = "bcrypt"
+	PASSWORD_HASH_ARGON2ID = "argon2id"
+)
+
+// argon2id 参数, 参考 RFC 9106 推荐的第二种配置
+const (
+	argon2Time    uint32 = 3
+	argon2Memory  uint32 = 64 * 1024
+	argon2Threads uint8  = 4
+	argon2KeyLen  uint32 = 32
+	argon2SaltLen        = 16
+)
+
+var passwordHashType = PASSWORD_HASH_BCRYPT
+
+func SetPasswordHashType(hashType string) error {
+	switch hashType {
+	case PASSWORD_HASH_BCRYPT, PASSWORD_HASH_ARGON2ID:
+		passwordHashType = hashType
+		return nil
+	default:
+		return fmt.Errorf("password_hash:%s not supported, bcrypt or argon2id", hashType)
+	}
+}
+
+func HashPassword(Password string) (string, error) {
+	if passwordHashType == PASSWORD_HASH_ARGON2ID {
+		return hashArgon2id(Password)
+	}
+	b, err := bcrypt.GenerateFromPassword([]byte(Password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func hashArgon2id(Password string) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(Password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, argon2Memory, argon2Time, argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func isBcryptHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func isArgon2idHash(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+func IsPasswordHashed(hash string) bool {
+	return isBcryptHash(hash) || isArgon2idHash(hash)
+}
+
+// needRehash 为 true 的时候, 需要用当前配置的方式重新保存
+func VerifyPassword(hash, Password string) (ok bool, needRehash bool) {
+	switch {
+	case isBcryptHash(hash):
+		ok = verifyPasswordCache.verify(hash, Password, verifyBcrypt)
+		return ok, ok && passwordHashType != PASSWORD_HASH_BCRYPT
+	case isArgon2idHash(hash):
+		ok = verifyPasswordCache.verify(hash, Password, verifyArgon2id)
+		return ok, ok && passwordHashType != PASSWORD_HASH_ARGON2ID
+	default:
+		// 明文, 空密码不能登录
+		ok = hash != "" && subtle.ConstantTimeCompare([]byte(hash), []byte(Password)) == 1
+		return ok, ok
+	}
+}
+
+func verifyBcrypt(hash, Password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(Password)) == nil
+}
+
+func verifyArgon2id(hash, Password string) bool {
+	// $argon2id$v=19$m=65536,t=3,p=4$salt$key
+	arr := strings.Split(hash, "$")
+	if len(arr) != 6 {
+		return false
+	}
+	var version int
+	if _, err := fmt.Sscanf(arr[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false
+	}
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(arr[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(arr[4])
+	if err != nil {
+		return false
+	}
+	key, err := base64.RawStdEncoding.DecodeString(arr[5])
+	if err != nil || len(key) == 0 {
+		return false
+	}
+	otherKey := argon2.IDKey([]byte(Password), salt, time, memory, threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, otherKey) == 1
+}
+
+// Basic 认证每个请求都要校验密码, 校验成功的缓存一小段时间, 不用每次都计算 bcrypt / argon2id
+// key 是存储里的 hash, 修改密码之后 hash 变了, 缓存自然失效; 内存里只保存密码的 HMAC
+const passwordCacheTime = 60 * time.Second
+
+type passwordCacheItem struct {
+	mac    []byte
+	expire time.Time
+}
+
+type passwordCache struct {
+	sync.Mutex
+	secret []byte
+	data   map[string]passwordCacheItem
+}
+
+var verifyPasswordCache = newPasswordCache()
+
+func newPasswordCache() *passwordCache {
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	return &passwordCache{secret: secret, data: make(map[string]passwordCacheItem, 0)}
+}
+
+func (This *passwordCache) sum(hash, Password string) []byte {
+	h := hmac.New(sha256.New, This.secret)
+	h.Write([]byte(hash))
+	h.Write([]byte{0})
+	h.Write([]byte(Password))
+	return h.Sum(nil)
+}
+
+func (This *passwordCache) verify(hash, Password string, f func(hash, Password string) bool) bool {
+	mac := This.sum(hash, Password)
+	now := time.Now()
+	This.Lock()
+	item, ok := This.data[hash]
+	This.Unlock()
+	if ok && now.Before(item.expire) && hmac.Equal(item.mac, mac) {
+		return true
+	}
+	if !f(hash, Password) {
+		return false
+	}
+	This.Lock()
+	defer This.Unlock()
+	for k, v := range This.data {
+		if now.After(v.expire) {
+			delete(This.data, k)
+		}
+	}
+	This.data[hash] = passwordCacheItem{mac: mac, expire: now.Add(passwordCacheTime)}
+	return true
+}
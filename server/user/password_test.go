@@ -0,0 +1,114 @@
+package user
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func initTestUserStorage() map[string]string {
+	kv := make(map[string]string)
+	userGetKeyVal = func(key []byte) ([]byte, error) {
+		return []byte(kv[string(key)]), nil
+	}
+	userPutKeyVal = func(key []byte, val []byte) error {
+		kv[string(key)] = string(val)
+		return nil
+	}
+	return kv
+}
+
+func TestHashPassword(t *testing.T) {
+	defer SetPasswordHashType(PASSWORD_HASH_BCRYPT)
+	Convey("bcrypt", t, func() {
+		So(SetPasswordHashType(PASSWORD_HASH_BCRYPT), ShouldBeNil)
+		hash, err := HashPassword("Bifrost123")
+		So(err, ShouldBeNil)
+		So(IsPasswordHashed(hash), ShouldBeTrue)
+		ok, needRehash := VerifyPassword(hash, "Bifrost123")
+		So(ok, ShouldBeTrue)
+		So(needRehash, ShouldBeFalse)
+		ok, _ = VerifyPassword(hash, "Bifrost1234")
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("argon2id", t, func() {
+		So(SetPasswordHashType(PASSWORD_HASH_ARGON2ID), ShouldBeNil)
+		hash, err := HashPassword("Bifrost123")
+		So(err, ShouldBeNil)
+		So(isArgon2idHash(hash), ShouldBeTrue)
+		ok, needRehash := VerifyPassword(hash, "Bifrost123")
+		So(ok, ShouldBeTrue)
+		So(needRehash, ShouldBeFalse)
+		ok, _ = VerifyPassword(hash, "Bifrost1234")
+		So(ok, ShouldBeFalse)
+		ok, _ = VerifyPassword(hash+"x", "Bifrost123")
+		So(ok, ShouldBeFalse)
+
+		// 换成 bcrypt 之后, argon2id 的 hash 需要重新保存
+		So(SetPasswordHashType(PASSWORD_HASH_BCRYPT), ShouldBeNil)
+		ok, needRehash = VerifyPassword(hash, "Bifrost123")
+		So(ok, ShouldBeTrue)
+		So(needRehash, ShouldBeTrue)
+	})
+
+	Convey("plain text", t, func() {
+		So(SetPasswordHashType("md5"), ShouldNotBeNil)
+		ok, needRehash := VerifyPassword("Bifrost123", "Bifrost123")
+		So(ok, ShouldBeTrue)
+		So(needRehash, ShouldBeTrue)
+		ok, _ = VerifyPassword("", "")
+		So(ok, ShouldBeFalse)
+	})
+}
+
+func TestVerifyPasswordCache(t *testing.T) {
+	Convey("verified password is cached until expire", t, func() {
+		cache := newPasswordCache()
+		var n int
+		f := func(hash, Password string) bool {
+			n++
+			return hash == "hash1" && Password == "Bifrost123"
+		}
+		So(cache.verify("hash1", "Bifrost123", f), ShouldBeTrue)
+		So(cache.verify("hash1", "Bifrost123", f), ShouldBeTrue)
+		So(n, ShouldEqual, 1)
+
+		// 密码错误和 hash 变了的都要重新校验
+		So(cache.verify("hash1", "Bifrost1234", f), ShouldBeFalse)
+		So(cache.verify("hash2", "Bifrost123", f), ShouldBeFalse)
+		So(n, ShouldEqual, 3)
+
+		item := cache.data["hash1"]
+		item.expire = time.Now().Add(-time.Second)
+		cache.data["hash1"] = item
+		So(cache.verify("hash1", "Bifrost123", f), ShouldBeTrue)
+		So(n, ShouldEqual, 4)
+	})
+}
+
+func TestCheckUserMigratePassword(t *testing.T) {
+	Convey("plain text password migrate to hash after login", t, func() {
+		kv := initTestUserStorage()
+		b, _ := json.Marshal(UserInfo{Name: "Bifrost", Password: "Bifrost123", Group: USER_GROUP_ADMINISTRATOR})
+		kv[USER_PREFIX+"Bifrost"] = string(b)
+
+		_, err := CheckUser("Bifrost", "wrong")
+		So(err, ShouldNotBeNil)
+		So(GetUserInfo("Bifrost").Password, ShouldEqual, "Bifrost123")
+
+		userInfo, err := CheckUser("Bifrost", "Bifrost123")
+		So(err, ShouldBeNil)
+		So(userInfo.Group, ShouldEqual, USER_GROUP_ADMINISTRATOR)
+		hash := GetUserInfo("Bifrost").Password
+		So(isBcryptHash(hash), ShouldBeTrue)
+
+		_, err = CheckUser("Bifrost", "Bifrost123")
+		So(err, ShouldBeNil)
+		So(GetUserInfo("Bifrost").Password, ShouldEqual, hash)
+		_, err = CheckUser("not_exist", "Bifrost123")
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,220 @@
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/brokercap/Bifrost/server/storage"
+)
+
+// 角色权限
+// administrator 组拥有所有权限, monitor 组可以查看所有数据, custom 组只能查看有权限的数据
+// 除此之外的权限都由用户绑定的角色授予, 权限可以限定到 数据源, 库 和 目标库(ToServerKey)
+
+const ROLE_PREFIX string = "bifrost_role_"
+
+const (
+	USER_GROUP_ADMINISTRATOR = "administrator"
+	USER_GROUP_MONITOR       = "monitor"
+	USER_GROUP_CUSTOM        = "custom"
+)
+
+const (
+	PERM_VIEW    = "view"    // 查看
+	PERM_OPERATE = "operate" // start, stop, close 等操作
+	PERM_CONFIG  = "config"  // 添加, 修改配置
+	PERM_DELETE  = "delete"  // 删除
+	PERM_HISTORY = "history" // 全量任务
+)
+
+var PermActionList = []string{PERM_VIEW, PERM_OPERATE, PERM_CONFIG, PERM_DELETE, PERM_HISTORY}
+
+// DbName, SchemaName, ToServerKey 为空或者 * 的时候为所有
+type Permission struct {
+	DbName      string
+	SchemaName  string
+	ToServerKey string
+	Actions     []string
+}
+
+type Role struct {
+	Name        string
+	Notes       string
+	Permissions []Permission
+	AddTime     int64
+	UpdateTime  int64
+}
+
+// 请求操作的资源, 不是针对 库 或者 目标库 的请求, 对应的字段为空
+type Resource struct {
+	DbName      string
+	SchemaName  string
+	ToServerKey string
+}
+
+// 测试的时候替换
+var roleGetKeyVal = storage.GetKeyVal
+var rolePutKeyVal = storage.PutKeyVal
+var roleDelKeyVal = storage.DelKeyVal
+var roleGetListByPrefix = storage.GetListByPrefix
+var roleGetUserList = GetUserList
+
+func checkPermActions(Actions []string) error {
+	if len(Actions) == 0 {
+		return errors.New("actions not be empty")
+	}
+	for _, action := range Actions {
+		var ok bool
+		for _, v := range PermActionList {
+			if v == action {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fmt.Errorf("action:%s not exist", action)
+		}
+	}
+	return nil
+}
+
+func UpdateRole(role Role) error {
+	if role.Name == "" {
+		return errors.New("role name not be empty")
+	}
+	for _, p := range role.Permissions {
+		if err := checkPermActions(p.Actions); err != nil {
+			return err
+		}
+	}
+	if old := GetRole(role.Name); old != nil {
+		role.AddTime = old.AddTime
+	} else {
+		role.AddTime = time.Now().Unix()
+	}
+	role.UpdateTime = time.Now().Unix()
+	b, _ := json.Marshal(role)
+	return rolePutKeyVal([]byte(ROLE_PREFIX+role.Name), b)
+}
+
+func GetRole(Name string) *Role {
+	b, err := roleGetKeyVal([]byte(ROLE_PREFIX + Name))
+	if err != nil || len(b) == 0 {
+		return nil
+	}
+	var role Role
+	if err = json.Unmarshal(b, &role); err != nil {
+		return nil
+	}
+	return &role
+}
+
+func GetRoleList() []Role {
+	data := make([]Role, 0)
+	for _, v := range roleGetListByPrefix([]byte(ROLE_PREFIX)) {
+		var role Role
+		if err := json.Unmarshal([]byte(v.Value), &role); err != nil {
+			continue
+		}
+		data = append(data, role)
+	}
+	sort.Slice(data, func(i, j int) bool {
+		return data[i].Name < data[j].Name
+	})
+	return data
+}
+
+// 还有用户绑定的角色不能删除
+func DelRole(Name string) error {
+	for _, userInfo := range roleGetUserList() {
+		for _, roleName := range userInfo.Roles {
+			if roleName == Name {
+				return fmt.Errorf("role:%s is used by user:%s", Name, userInfo.Name)
+			}
+		}
+	}
+	return roleDelKeyVal([]byte(ROLE_PREFIX + Name))
+}
+
+// 用户绑定的角色必须存在
+func checkUserRoles(Roles []string) error {
+	for _, roleName := range Roles {
+		if GetRole(roleName) == nil {
+			return fmt.Errorf("role:%s not exist", roleName)
+		}
+	}
+	return nil
+}
+
+func RecoveryRole(content *json.RawMessage) {
+	if content == nil {
+		return
+	}
+	var data []*Role
+	if err := json.Unmarshal(*content, &data); err != nil {
+		log.Println("recovery role content errors;", err, " content:", content)
+		return
+	}
+	for _, role := range data {
+		b, _ := json.Marshal(role)
+		rolePutKeyVal([]byte(ROLE_PREFIX+role.Name), b)
+	}
+}
+
+func (This *Permission) hasAction(action string) bool {
+	for _, v := range This.Actions {
+		// 有任何一个权限都可以查看
+		if v == action || action == PERM_VIEW {
+			return true
+		}
+	}
+	return false
+}
+
+// 查看上一级的时候, 有下一级的权限就可以, 比如只有某个库的权限, 也可以查看这个库所在的数据源
+func matchPermName(pattern, name, action string) bool {
+	if pattern == "" || pattern == "*" {
+		return true
+	}
+	if name == "" {
+		return action == PERM_VIEW
+	}
+	return pattern == name
+}
+
+func (This *Permission) Match(action string, res Resource) bool {
+	return This.hasAction(action) &&
+		matchPermName(This.DbName, res.DbName, action) &&
+		matchPermName(This.SchemaName, res.SchemaName, action) &&
+		matchPermName(This.ToServerKey, res.ToServerKey, action)
+}
+
+// 用户对资源是否有 action 权限
+func CheckPermission(userInfo *UserInfo, action string, res Resource) bool {
+	switch userInfo.Group {
+	case USER_GROUP_ADMINISTRATOR:
+		return true
+	case USER_GROUP_CUSTOM:
+		break
+	default:
+		if action == PERM_VIEW {
+			return true
+		}
+	}
+	for _, roleName := range userInfo.Roles {
+		role := GetRole(roleName)
+		if role == nil {
+			continue
+		}
+		for i := range role.Permissions {
+			if role.Permissions[i].Match(action, res) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package user
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/brokercap/Bifrost/server/storage"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func initTestRoleStorage(userList []UserInfo) {
+	kv := make(map[string]string)
+	roleGetKeyVal = func(key []byte) ([]byte, error) {
+		return []byte(kv[string(key)]), nil
+	}
+	rolePutKeyVal = func(key []byte, val []byte) error {
+		kv[string(key)] = string(val)
+		return nil
+	}
+	roleDelKeyVal = func(key []byte) error {
+		delete(kv, string(key))
+		return nil
+	}
+	roleGetListByPrefix = func(key []byte) (data []storage.ListStruct) {
+		for k, v := range kv {
+			if strings.HasPrefix(k, string(key)) {
+				data = append(data, storage.ListStruct{Key: k, Value: v})
+			}
+		}
+		return
+	}
+	roleGetUserList = func() []UserInfo {
+		return userList
+	}
+}
+
+func TestUpdateRole(t *testing.T) {
+	Convey("update role", t, func() {
+		initTestRoleStorage(nil)
+		So(UpdateRole(Role{Name: ""}), ShouldNotBeNil)
+		So(UpdateRole(Role{Name: "dba", Permissions: []Permission{{DbName: "mysql1"}}}), ShouldNotBeNil)
+		So(UpdateRole(Role{Name: "dba", Permissions: []Permission{{DbName: "mysql1", Actions: []string{"drop"}}}}), ShouldNotBeNil)
+		So(UpdateRole(Role{Name: "dba", Permissions: []Permission{{DbName: "mysql1", Actions: []string{PERM_OPERATE}}}}), ShouldBeNil)
+		So(UpdateRole(Role{Name: "app", Notes: "app team"}), ShouldBeNil)
+
+		role := GetRole("dba")
+		So(role, ShouldNotBeNil)
+		So(role.Permissions[0].DbName, ShouldEqual, "mysql1")
+		So(role.AddTime, ShouldBeGreaterThan, 0)
+		So(GetRole("not_exist"), ShouldBeNil)
+
+		list := GetRoleList()
+		So(len(list), ShouldEqual, 2)
+		So(list[0].Name, ShouldEqual, "app")
+
+		So(checkUserRoles([]string{"dba", "app"}), ShouldBeNil)
+		So(checkUserRoles([]string{"not_exist"}), ShouldNotBeNil)
+	})
+}
+
+func TestDelRole(t *testing.T) {
+	Convey("role used by user can't be deleted", t, func() {
+		initTestRoleStorage([]UserInfo{{Name: "u1", Roles: []string{"dba"}}})
+		So(UpdateRole(Role{Name: "dba"}), ShouldBeNil)
+		So(UpdateRole(Role{Name: "app"}), ShouldBeNil)
+		So(DelRole("dba"), ShouldNotBeNil)
+		So(DelRole("app"), ShouldBeNil)
+		So(GetRole("app"), ShouldBeNil)
+		So(GetRole("dba"), ShouldNotBeNil)
+	})
+}
+
+func TestCheckPermission(t *testing.T) {
+	initTestRoleStorage(nil)
+	UpdateRole(Role{Name: "dba", Permissions: []Permission{
+		{DbName: "mysql1", Actions: []string{PERM_OPERATE, PERM_CONFIG, PERM_DELETE, PERM_HISTORY}},
+	}})
+	UpdateRole(Role{Name: "app", Permissions: []Permission{
+		{DbName: "*", SchemaName: "app", ToServerKey: "kafka_app", Actions: []string{PERM_CONFIG}},
+	}})
+
+	Convey("administrator and monitor", t, func() {
+		admin := &UserInfo{Name: "admin", Group: USER_GROUP_ADMINISTRATOR}
+		So(CheckPermission(admin, PERM_DELETE, Resource{DbName: "mysql1"}), ShouldBeTrue)
+		monitor := &UserInfo{Name: "monitor", Group: USER_GROUP_MONITOR}
+		So(CheckPermission(monitor, PERM_VIEW, Resource{DbName: "mysql2"}), ShouldBeTrue)
+		So(CheckPermission(monitor, PERM_OPERATE, Resource{DbName: "mysql1"}), ShouldBeFalse)
+	})
+
+	Convey("db scoped role", t, func() {
+		dba := &UserInfo{Name: "dba", Group: USER_GROUP_CUSTOM, Roles: []string{"dba"}}
+		So(CheckPermission(dba, PERM_VIEW, Resource{DbName: "mysql1"}), ShouldBeTrue)
+		So(CheckPermission(dba, PERM_OPERATE, Resource{DbName: "mysql1"}), ShouldBeTrue)
+		So(CheckPermission(dba, PERM_CONFIG, Resource{DbName: "mysql1", SchemaName: "test", ToServerKey: "redis"}), ShouldBeTrue)
+		So(CheckPermission(dba, PERM_VIEW, Resource{DbName: "mysql2"}), ShouldBeFalse)
+		So(CheckPermission(dba, PERM_OPERATE, Resource{DbName: "mysql2"}), ShouldBeFalse)
+
+		// monitor 组加上角色, 可以查看所有的数据源
+		dba.Group = USER_GROUP_MONITOR
+		So(CheckPermission(dba, PERM_VIEW, Resource{DbName: "mysql2"}), ShouldBeTrue)
+		So(CheckPermission(dba, PERM_OPERATE, Resource{DbName: "mysql2"}), ShouldBeFalse)
+	})
+
+	Convey("schema and ToServerKey scoped role", t, func() {
+		app := &UserInfo{Name: "app", Group: USER_GROUP_CUSTOM, Roles: []string{"app", "not_exist"}}
+		So(CheckPermission(app, PERM_CONFIG, Resource{DbName: "mysql1", SchemaName: "app", ToServerKey: "kafka_app"}), ShouldBeTrue)
+		So(CheckPermission(app, PERM_CONFIG, Resource{DbName: "mysql1", SchemaName: "app", ToServerKey: "kafka_other"}), ShouldBeFalse)
+		So(CheckPermission(app, PERM_CONFIG, Resource{DbName: "mysql1", SchemaName: "other", ToServerKey: "kafka_app"}), ShouldBeFalse)
+		// 不能添加表, 不能操作数据源
+		So(CheckPermission(app, PERM_CONFIG, Resource{DbName: "mysql1", SchemaName: "app"}), ShouldBeFalse)
+		So(CheckPermission(app, PERM_OPERATE, Resource{DbName: "mysql1"}), ShouldBeFalse)
+		So(CheckPermission(app, PERM_DELETE, Resource{DbName: "mysql1", SchemaName: "app", ToServerKey: "kafka_app"}), ShouldBeFalse)
+		// 可以查看库所在的数据源
+		So(CheckPermission(app, PERM_VIEW, Resource{DbName: "mysql1"}), ShouldBeTrue)
+		So(CheckPermission(app, PERM_VIEW, Resource{DbName: "mysql1", SchemaName: "other"}), ShouldBeFalse)
+	})
+}
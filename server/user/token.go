@@ -0,0 +1,237 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brokercap/Bifrost/server/storage"
+)
+
+// /api/v2 使用的 API token, 每个 token 属于一个用户, 权限不能超过用户所在的组
+// token 只在创建的时候返回一次, 存储里只保存 sha256
+
+const API_TOKEN_PREFIX string = "bifrost_api_token_"
+
+const API_TOKEN_HEAD = "bft_"
+
+const (
+	SCOPE_READ  = "read"
+	SCOPE_WRITE = "write"
+)
+
+// 可以授权的资源, * 为所有资源
+var APIResourceList = []string{"dbs", "channels", "tables", "toservers", "history", "plugins", "warnings", "users", "filequeues"}
+
+type APIToken struct {
+	ID           string
+	UserName     string
+	Name         string   // 备注, 比如用在哪个系统
+	Scopes       []string // 资源:read 或者 资源:write, 比如 dbs:read, *:write; write 包含 read
+	TokenHash    string
+	AddTime      int64
+	ExpireTime   int64 // 0 为不过期
+	LastUsedTime int64
+}
+
+// 测试的时候替换
+var tokenGetKeyVal = storage.GetKeyVal
+var tokenPutKeyVal = storage.PutKeyVal
+var tokenDelKeyVal = storage.DelKeyVal
+var tokenGetListByPrefix = storage.GetListByPrefix
+var tokenGetUserInfo = GetUserInfo
+
+// 最后使用时间每分钟最多保存一次
+var tokenLastUsedLock sync.Mutex
+var tokenLastUsedMap = make(map[string]int64, 0)
+
+func CheckAPITokenScopes(Scopes []string) error {
+	if len(Scopes) == 0 {
+		return errors.New("scopes not be empty")
+	}
+	for _, scope := range Scopes {
+		arr := strings.Split(scope, ":")
+		if len(arr) != 2 || (arr[1] != SCOPE_READ && arr[1] != SCOPE_WRITE) {
+			return fmt.Errorf("scope:%s error, format is resource:read or resource:write", scope)
+		}
+		if arr[0] == "*" {
+			continue
+		}
+		var ok bool
+		for _, resource := range APIResourceList {
+			if resource == arr[0] {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fmt.Errorf("scope:%s resource not exist", scope)
+		}
+	}
+	return nil
+}
+
+func (This *APIToken) HasScope(resource string, write bool) bool {
+	for _, scope := range This.Scopes {
+		arr := strings.Split(scope, ":")
+		if len(arr) != 2 || (arr[0] != "*" && arr[0] != resource) {
+			continue
+		}
+		if arr[1] == SCOPE_WRITE || !write {
+			return true
+		}
+	}
+	return false
+}
+
+func hashAPIToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+func randHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// 返回的 token 只有这一次可以看到
+func CreateAPIToken(UserName, Name string, Scopes []string, ExpireTime int64) (token string, info *APIToken, err error) {
+	if UserName == "" {
+		return "", nil, errors.New("user name not be empty")
+	}
+	if err = CheckAPITokenScopes(Scopes); err != nil {
+		return "", nil, err
+	}
+	if ExpireTime > 0 && ExpireTime <= time.Now().Unix() {
+		return "", nil, errors.New("ExpireTime must be greater than now")
+	}
+	ID, err := randHex(6)
+	if err != nil {
+		return "", nil, err
+	}
+	secret, err := randHex(24)
+	if err != nil {
+		return "", nil, err
+	}
+	token = API_TOKEN_HEAD + ID + "_" + secret
+	info = &APIToken{
+		ID:         ID,
+		UserName:   UserName,
+		Name:       Name,
+		Scopes:     Scopes,
+		TokenHash:  hashAPIToken(token),
+		AddTime:    time.Now().Unix(),
+		ExpireTime: ExpireTime,
+	}
+	if err = saveAPIToken(info); err != nil {
+		return "", nil, err
+	}
+	return token, info, nil
+}
+
+func saveAPIToken(info *APIToken) error {
+	b, _ := json.Marshal(info)
+	return tokenPutKeyVal([]byte(API_TOKEN_PREFIX+info.ID), b)
+}
+
+func GetAPIToken(ID string) *APIToken {
+	b, err := tokenGetKeyVal([]byte(API_TOKEN_PREFIX + ID))
+	if err != nil || len(b) == 0 {
+		return nil
+	}
+	var info APIToken
+	if err = json.Unmarshal(b, &info); err != nil {
+		return nil
+	}
+	return &info
+}
+
+// UserName 为空的时候返回所有用户的 token
+func GetAPITokenList(UserName string) []APIToken {
+	data := make([]APIToken, 0)
+	for _, v := range tokenGetListByPrefix([]byte(API_TOKEN_PREFIX)) {
+		var info APIToken
+		if err := json.Unmarshal([]byte(v.Value), &info); err != nil {
+			continue
+		}
+		if UserName != "" && info.UserName != UserName {
+			continue
+		}
+		data = append(data, info)
+	}
+	sort.Slice(data, func(i, j int) bool {
+		return data[i].AddTime < data[j].AddTime
+	})
+	return data
+}
+
+func DelAPIToken(ID string) error {
+	return tokenDelKeyVal([]byte(API_TOKEN_PREFIX + ID))
+}
+
+// 删除用户的时候, 这个用户的 token 一起删除
+func DelAPITokenByUser(UserName string) {
+	for _, info := range GetAPITokenList(UserName) {
+		DelAPIToken(info.ID)
+	}
+}
+
+// 校验 token 及 ip, 返回 token 和 token 所属的用户
+func CheckAPIToken(token string, IP string, RemoteAddrIp string) (*APIToken, *UserInfo, error) {
+	if RemoteAddrIp != "127.0.0.1" && CheckRefuseIp(IP) {
+		return nil, nil, errors.New("ip is refused")
+	}
+	arr := strings.Split(strings.TrimPrefix(token, API_TOKEN_HEAD), "_")
+	if !strings.HasPrefix(token, API_TOKEN_HEAD) || len(arr) != 2 {
+		return nil, nil, errors.New("token error")
+	}
+	info := GetAPIToken(arr[0])
+	if info == nil || subtle.ConstantTimeCompare([]byte(info.TokenHash), []byte(hashAPIToken(token))) != 1 {
+		AddFailedIp(IP)
+		return nil, nil, errors.New("token error")
+	}
+	if info.ExpireTime > 0 && info.ExpireTime <= time.Now().Unix() {
+		return nil, nil, errors.New("token expired")
+	}
+	userInfo := tokenGetUserInfo(info.UserName)
+	if userInfo.Name == "" {
+		return nil, nil, errors.New("token user not exist")
+	}
+	if err := CheckUserHost(IP, userInfo.Host); err != nil {
+		return nil, nil, err
+	}
+	if userInfo.Group == "" {
+		userInfo.Group = "monitor"
+	}
+	updateAPITokenLastUsed(info)
+	return info, userInfo, nil
+}
+
+func updateAPITokenLastUsed(info *APIToken) {
+	now := time.Now().Unix()
+	tokenLastUsedLock.Lock()
+	if now-tokenLastUsedMap[info.ID] < 60 {
+		tokenLastUsedLock.Unlock()
+		return
+	}
+	tokenLastUsedMap[info.ID] = now
+	tokenLastUsedLock.Unlock()
+	// 已经被删除的不能再写回去
+	if GetAPIToken(info.ID) == nil {
+		return
+	}
+	info.LastUsedTime = now
+	// ha standby 上不能写, 忽略
+	saveAPIToken(info)
+}
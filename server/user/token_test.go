@@ -0,0 +1,100 @@
+package user
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brokercap/Bifrost/server/storage"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func initTestTokenStorage() {
+	kv := make(map[string]string)
+	tokenGetKeyVal = func(key []byte) ([]byte, error) {
+		return []byte(kv[string(key)]), nil
+	}
+	tokenPutKeyVal = func(key []byte, val []byte) error {
+		kv[string(key)] = string(val)
+		return nil
+	}
+	tokenDelKeyVal = func(key []byte) error {
+		delete(kv, string(key))
+		return nil
+	}
+	tokenGetListByPrefix = func(key []byte) (data []storage.ListStruct) {
+		for k, v := range kv {
+			if strings.HasPrefix(k, string(key)) {
+				data = append(data, storage.ListStruct{Key: k, Value: v})
+			}
+		}
+		return
+	}
+	tokenGetUserInfo = func(Name string) *UserInfo {
+		if Name != "bifrost" {
+			return &UserInfo{}
+		}
+		return &UserInfo{Name: Name, Group: "administrator", Host: "%"}
+	}
+}
+
+func TestAPIToken(t *testing.T) {
+	initTestTokenStorage()
+
+	Convey("scopes", t, func() {
+		So(CheckAPITokenScopes(nil), ShouldNotBeNil)
+		So(CheckAPITokenScopes([]string{"dbs:read", "*:write"}), ShouldBeNil)
+		So(CheckAPITokenScopes([]string{"dbs"}), ShouldNotBeNil)
+		So(CheckAPITokenScopes([]string{"dbs:delete"}), ShouldNotBeNil)
+		So(CheckAPITokenScopes([]string{"xxx:read"}), ShouldNotBeNil)
+
+		info := &APIToken{Scopes: []string{"dbs:read", "history:write"}}
+		So(info.HasScope("dbs", false), ShouldBeTrue)
+		So(info.HasScope("dbs", true), ShouldBeFalse)
+		So(info.HasScope("history", true), ShouldBeTrue)
+		So(info.HasScope("history", false), ShouldBeTrue)
+		So(info.HasScope("users", false), ShouldBeFalse)
+		So((&APIToken{Scopes: []string{"*:read"}}).HasScope("users", false), ShouldBeTrue)
+	})
+
+	Convey("create check and revoke", t, func() {
+		token, info, err := CreateAPIToken("bifrost", "ci", []string{"dbs:read"}, 0)
+		So(err, ShouldBeNil)
+		So(strings.HasPrefix(token, API_TOKEN_HEAD+info.ID+"_"), ShouldBeTrue)
+		So(info.TokenHash, ShouldNotContainSubstring, token)
+
+		checked, userInfo, err := CheckAPIToken(token, "127.0.0.1", "127.0.0.1")
+		So(err, ShouldBeNil)
+		So(checked.ID, ShouldEqual, info.ID)
+		So(userInfo.Name, ShouldEqual, "bifrost")
+
+		_, _, err = CheckAPIToken(token+"x", "127.0.0.1", "127.0.0.1")
+		So(err, ShouldNotBeNil)
+		_, _, err = CheckAPIToken("xxx", "127.0.0.1", "127.0.0.1")
+		So(err, ShouldNotBeNil)
+
+		So(len(GetAPITokenList("bifrost")), ShouldEqual, 1)
+		So(len(GetAPITokenList("other")), ShouldEqual, 0)
+
+		So(DelAPIToken(info.ID), ShouldBeNil)
+		_, _, err = CheckAPIToken(token, "127.0.0.1", "127.0.0.1")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("expired and user deleted", t, func() {
+		_, _, err := CreateAPIToken("bifrost", "", []string{"dbs:read"}, time.Now().Unix()-1)
+		So(err, ShouldNotBeNil)
+
+		token, info, err := CreateAPIToken("bifrost", "", []string{"dbs:read"}, time.Now().Unix()+1)
+		So(err, ShouldBeNil)
+		info.ExpireTime = time.Now().Unix() - 1
+		saveAPIToken(info)
+		_, _, err = CheckAPIToken(token, "127.0.0.1", "127.0.0.1")
+		So(err, ShouldNotBeNil)
+
+		token, _, err = CreateAPIToken("deleted", "", []string{"dbs:read"}, 0)
+		So(err, ShouldBeNil)
+		_, _, err = CheckAPIToken(token, "127.0.0.1", "127.0.0.1")
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -18,22 +18,30 @@ type UserGroupType string
 
 type UserInfo struct {
 	Name       string
-	Password   string
+	Password   string // bcrypt 或者 argon2id hash, 见 password.go
+	Source     string // 为空是本地用户, 其他的是 ldap, oidc 等外部认证的用户, 不能用本地密码登录
 	Group      string
 	Host       string
+	Roles      []string // 绑定的角色, 角色里的权限见 role.go
 	AddTime    int64
 	UpdateTime int64
 }
 
+// 测试的时候替换
+var userGetKeyVal = storage.GetKeyVal
+var userPutKeyVal = storage.PutKeyVal
+
 func init() {
 
 }
 
 func getUserGroup(groupName string) string {
-	if groupName != "administrator" {
-		return "monitor"
+	switch groupName {
+	case USER_GROUP_ADMINISTRATOR, USER_GROUP_CUSTOM:
+		return groupName
+	default:
+		return USER_GROUP_MONITOR
 	}
-	return groupName
 }
 
 func InitUser() {
@@ -50,16 +58,21 @@ func InitUser() {
 		// time.Sleep( time.Duration(5) * time.Second)
 		for Name, Password := range config.GetConf("user") {
 			UserGroup := getUserGroup(config.GetConfigVal("groups", Name))
+			PasswordHash, err := HashPassword(Password)
+			if err != nil {
+				log.Println("InitUser error:", err, " user:", Name)
+				continue
+			}
 			User := UserInfo{
 				Name:       Name,
-				Password:   Password,
+				Password:   PasswordHash,
 				Group:      UserGroup,
 				Host:       "%",
 				AddTime:    time.Now().Unix(),
 				UpdateTime: time.Now().Unix(),
 			}
 			b, _ := json.Marshal(User)
-			err := storage.PutKeyVal([]byte(USER_PREFIX+Name), b)
+			err = storage.PutKeyVal([]byte(USER_PREFIX+Name), b)
 			if err != nil {
 				log.Println("InitUser error:", err, " user:", User)
 			}
@@ -105,23 +118,39 @@ func GetUserList() []UserInfo {
 
 func DelUser(Name string) error {
 	key := USER_PREFIX + Name
-	return storage.DelKeyVal([]byte(key))
+	if err := storage.DelKeyVal([]byte(key)); err != nil {
+		return err
+	}
+	DelAPITokenByUser(Name)
+	return nil
 }
 
-func AddUser(Name, Password, GroupName string, Host string) error {
-	return UpdateUser(Name, Password, GroupName, Host)
+func AddUser(Name, Password, GroupName string, Host string, Roles []string) error {
+	return UpdateUser(Name, Password, GroupName, Host, Roles)
 }
 
-func UpdateUser(Name, Password, GroupName string, Host string) error {
+func UpdateUser(Name, Password, GroupName string, Host string, Roles []string) error {
 	if Name == "" || Password == "" {
 		return fmt.Errorf("name and password not be empty")
 	}
+	if err := checkUserRoles(Roles); err != nil {
+		return err
+	}
 	OldUserInfo := GetUserInfo(Name)
+	// 外部用户的组和角色由 auth_group_map 映射, 不能改成本地用户
+	if OldUserInfo.Source != "" {
+		return fmt.Errorf("user:%s source is %s, can't be updated", Name, OldUserInfo.Source)
+	}
+	PasswordHash, err := HashPassword(Password)
+	if err != nil {
+		return err
+	}
 	User := &UserInfo{
 		Name:     Name,
-		Password: Password,
+		Password: PasswordHash,
 		Host:     Host,
 		Group:    getUserGroup(GroupName),
+		Roles:    Roles,
 	}
 	if OldUserInfo.Name == "" {
 		User.AddTime = time.Now().Unix()
@@ -130,14 +159,17 @@ func UpdateUser(Name, Password, GroupName string, Host string) error {
 		User.AddTime = OldUserInfo.AddTime
 		User.UpdateTime = time.Now().Unix()
 	}
-	key := USER_PREFIX + Name
+	return saveUser(User)
+}
+
+func saveUser(User *UserInfo) error {
 	b, _ := json.Marshal(User)
-	return storage.PutKeyVal([]byte(key), b)
+	return userPutKeyVal([]byte(USER_PREFIX+User.Name), b)
 }
 
 func GetUserInfo(Name string) *UserInfo {
-	b, err := storage.GetKeyVal([]byte(USER_PREFIX + Name))
-	if err != nil {
+	b, err := userGetKeyVal([]byte(USER_PREFIX + Name))
+	if err != nil || len(b) == 0 {
 		return &UserInfo{}
 	}
 	var User UserInfo
@@ -148,17 +180,35 @@ func GetUserInfo(Name string) *UserInfo {
 	return &User
 }
 
+// 本地用户校验密码, 不存在的用户或者外部认证的用户, 交给 ldap 等外部认证
 func CheckUser(Name, Password string) (userInfo *UserInfo, err error) {
 	userInfo = GetUserInfo(Name)
-	if userInfo.Name == "" {
-		err = errors.New("user not exist")
-		return
+	if userInfo.Name != "" && userInfo.Source == "" {
+		ok, needRehash := VerifyPassword(userInfo.Password, Password)
+		if !ok {
+			return nil, errors.New("password error")
+		}
+		if needRehash {
+			migratePassword(userInfo, Password)
+		}
+		return userInfo, nil
 	}
-	if userInfo.Password != Password {
-		err = errors.New("password error")
+	return checkExternalUser(userInfo, Name, Password)
+}
+
+// 明文或者 hash 方式和配置的不一样的, 登录成功之后重新保存
+func migratePassword(userInfo *UserInfo, Password string) {
+	PasswordHash, err := HashPassword(Password)
+	if err != nil {
+		log.Println("user:", userInfo.Name, " hash password error:", err)
 		return
 	}
-	return
+	User := *userInfo
+	User.Password = PasswordHash
+	// ha standby 上不能写, 下次登录再转
+	if err = saveUser(&User); err != nil {
+		log.Println("user:", userInfo.Name, " save password hash error:", err)
+	}
 }
 
 // IP 有可能是nginx代理转发采用的 X-Real-IP
@@ -171,7 +221,7 @@ func CheckUserWithIP(Name, Password string, IP string, RemoteAddrIp string) (use
 	userInfo, err = CheckUser(Name, Password)
 	if err != nil {
 		AddFailedIp(IP)
-		appendLoginLog("IP:%s UserName:%s Password:%s login failed", IP, Name, Password)
+		appendLoginLog("IP:%s UserName:%s login failed", IP, Name)
 		return nil, errors.New("user or password error")
 	}
 	err = CheckUserHost(IP, userInfo.Host)
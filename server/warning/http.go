@@ -1 +1,79 @@
 package warning
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// 通用 HTTP 回调, 以 POST json 的方式 将报警内容发送给 Url
+type Http struct {
+	p HttpParam
+}
+
+type HttpParam struct {
+	Url     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Timeout int               `json:"timeout"` // 秒, 默认 10 秒
+}
+
+type HttpPostData struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+func init() {
+	Register("HTTP", &Http{})
+}
+
+func (This *Http) paramTansfer(p map[string]interface{}) error {
+	s, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	This.p = HttpParam{}
+	err2 := json.Unmarshal(s, &This.p)
+	if err2 != nil {
+		return err2
+	}
+	if This.p.Url == "" {
+		return fmt.Errorf("url can't be empty")
+	}
+	if This.p.Timeout <= 0 {
+		This.p.Timeout = 10
+	}
+	return nil
+}
+
+func (This *Http) SendWarning(p map[string]interface{}, title string, Body string) error {
+	err1 := This.paramTansfer(p)
+	if err1 != nil {
+		return err1
+	}
+	b, err := json.Marshal(HttpPostData{Title: title, Body: Body})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", This.p.Url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range This.p.Headers {
+		req.Header.Set(k, v)
+	}
+	client := &http.Client{Timeout: time.Duration(This.p.Timeout) * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("http status:%d body:%s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package warning
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHttp_SendWarning(t *testing.T) {
+	Convey("post json", t, func() {
+		var data HttpPostData
+		var token string
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token = r.Header.Get("X-Token")
+			json.NewDecoder(r.Body).Decode(&data)
+		}))
+		defer ts.Close()
+		p := map[string]interface{}{"url": ts.URL, "headers": map[string]interface{}{"X-Token": "abc"}}
+		So((&Http{}).SendWarning(p, "Bifrost Warning", "it is test"), ShouldBeNil)
+		So(data, ShouldResemble, HttpPostData{Title: "Bifrost Warning", Body: "it is test"})
+		So(token, ShouldEqual, "abc")
+	})
+
+	Convey("http status error", t, func() {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(500)
+		}))
+		defer ts.Close()
+		So((&Http{}).SendWarning(map[string]interface{}{"url": ts.URL}, "title", "body"), ShouldNotBeNil)
+	})
+
+	Convey("url empty", t, func() {
+		So((&Http{}).SendWarning(map[string]interface{}{}, "title", "body"), ShouldNotBeNil)
+	})
+}
@@ -30,6 +30,7 @@ type WarningContent struct {
 	Body       interface{}
 	DateTime   string
 	IP         string
+	configKeys []string // 只发送给这些报警配置, 为空则发送给所有报警配置
 }
 
 var WarningChan chan WarningContent
@@ -102,7 +103,10 @@ func consumeWarning() {
 				break
 			}
 			l.RLock()
-			for _, config := range allWaringConfigCacheMap {
+			for key, config := range allWaringConfigCacheMap {
+				if !inConfigKeys(data.configKeys, key) {
+					continue
+				}
 				sendToWaring(config, title, body, 5)
 			}
 			l.RUnlock()
@@ -114,6 +118,18 @@ func consumeWarning() {
 	}
 }
 
+func inConfigKeys(configKeys []string, key string) bool {
+	if len(configKeys) == 0 {
+		return true
+	}
+	for _, v := range configKeys {
+		if v == key {
+			return true
+		}
+	}
+	return false
+}
+
 func sendToWaring(config WaringConfig, title, c string, n int) {
 	defer func() {
 		if err := recover(); err != nil {
@@ -0,0 +1,227 @@
+package warning
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/brokercap/Bifrost/server/storage"
+)
+
+// 阈值报警规则
+// 定时采集各个 数据源 和 同步配置 的指标, 指标值 >= Threshold 并且持续 Duration 秒之后报警
+
+const WARNING_RULE_KEY_PREFIX = "bifrost_warning_rule_"
+
+type RuleType string
+
+const (
+	RULE_DB_LAG           RuleType = "DbLag"           // 数据源位点延时(秒): 当前时间 - 最后解析的事件时间
+	RULE_DB_NOT_RUNNING   RuleType = "DbNotRunning"    // 数据源不是 running 状态为 1, 否则为 0
+	RULE_TOSERVER_LAG     RuleType = "ToServerLag"     // 同步配置位点延时(秒): 当前时间 - 最后成功同步的事件时间
+	RULE_TOSERVER_QUEUE   RuleType = "ToServerQueue"   // 同步配置内存队列堆积数量
+	RULE_TOSERVER_STALLED RuleType = "ToServerStalled" // 队列里有数据, 但是多少秒没有消费过数据
+	RULE_FILEQUEUE_SIZE   RuleType = "FileQueueSize"   // 文件队列占用磁盘大小(字节)
+)
+
+var ruleTypeList = []RuleType{RULE_DB_LAG, RULE_DB_NOT_RUNNING, RULE_TOSERVER_LAG, RULE_TOSERVER_QUEUE, RULE_TOSERVER_STALLED, RULE_FILEQUEUE_SIZE}
+
+func GetRuleTypeList() []RuleType {
+	return ruleTypeList
+}
+
+// 是否是 数据源 级别的指标, 数据源级别的规则 不能指定 SchemaName,TableName,ToServerID
+func (t RuleType) IsDbLevel() bool {
+	return t == RULE_DB_LAG || t == RULE_DB_NOT_RUNNING
+}
+
+type WarningRule struct {
+	Id                int
+	Type              RuleType
+	Threshold         float64  // 指标值 >= Threshold 认为异常
+	Duration          int      // 持续异常多少秒才报警, 0 为第一次检测到就报警
+	Renotify          int      // 报警后一直没有恢复, 间隔多少秒再次报警, 0 为不再重复报警
+	DbName            string   // 生效范围, 为空则所有数据源
+	SchemaName        string   // 为空则所有库
+	TableName         string   // 为空则所有表
+	ToServerID        int      // 0 则所有同步配置
+	WarningConfigKeys []string // 发送给哪些报警配置, 为空则发送给所有报警配置
+	Notes             string
+}
+
+func (This *WarningRule) Check() error {
+	var typeExist bool
+	for _, t := range ruleTypeList {
+		if t == This.Type {
+			typeExist = true
+			break
+		}
+	}
+	if !typeExist {
+		return fmt.Errorf("rule type:%s not supported", This.Type)
+	}
+	if This.Threshold < 0 {
+		return fmt.Errorf("Threshold can't be less than 0")
+	}
+	if This.Duration < 0 || This.Renotify < 0 {
+		return fmt.Errorf("Duration and Renotify can't be less than 0")
+	}
+	if This.Type.IsDbLevel() && (This.SchemaName != "" || This.TableName != "" || This.ToServerID != 0) {
+		return fmt.Errorf("rule type:%s only support DbName scope", This.Type)
+	}
+	if This.ToServerID < 0 {
+		return fmt.Errorf("ToServerID can't be less than 0")
+	}
+	return nil
+}
+
+// 规则是否作用于这个指标
+func (This *WarningRule) Match(sample RuleSample) bool {
+	if This.Type != sample.Type {
+		return false
+	}
+	if This.DbName != "" && This.DbName != sample.DbName {
+		return false
+	}
+	if This.SchemaName != "" && This.SchemaName != sample.SchemaName {
+		return false
+	}
+	if This.TableName != "" && This.TableName != sample.TableName {
+		return false
+	}
+	if This.ToServerID != 0 && This.ToServerID != sample.ToServerID {
+		return false
+	}
+	return true
+}
+
+var ruleLock sync.RWMutex
+var allWarningRuleCacheMap = make(map[int]WarningRule, 0)
+var ruleFirstStartUp bool = true
+var lastRuleID int = 0
+
+func getWarningRuleKey(ID int) string {
+	return WARNING_RULE_KEY_PREFIX + strconv.Itoa(ID)
+}
+
+func InitWarningRuleCache() {
+	ruleLock.Lock()
+	defer ruleLock.Unlock()
+	if ruleFirstStartUp == false {
+		return
+	}
+	ruleFirstStartUp = false
+	data := storage.GetListByPrefix([]byte(WARNING_RULE_KEY_PREFIX))
+	for _, v := range data {
+		var rule WarningRule
+		err := json.Unmarshal([]byte(v.Value), &rule)
+		if err != nil {
+			log.Println("warning rule json.Unmarshal err:", err, " key:", v.Key)
+			continue
+		}
+		if rule.Id > lastRuleID {
+			lastRuleID = rule.Id
+		}
+		allWarningRuleCacheMap[rule.Id] = rule
+	}
+}
+
+// 按 Id 排序的规则列表
+func GetWarningRuleList() []WarningRule {
+	InitWarningRuleCache()
+	ruleLock.RLock()
+	defer ruleLock.RUnlock()
+	list := make([]WarningRule, 0, len(allWarningRuleCacheMap))
+	for _, rule := range allWarningRuleCacheMap {
+		list = append(list, rule)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Id < list[j].Id
+	})
+	return list
+}
+
+func AddNewWarningRule(rule WarningRule) (int, error) {
+	if err := rule.Check(); err != nil {
+		return 0, err
+	}
+	InitWarningRuleCache()
+	ruleLock.Lock()
+	lastRuleID++
+	rule.Id = lastRuleID
+	allWarningRuleCacheMap[rule.Id] = rule
+	ruleLock.Unlock()
+	b, _ := json.Marshal(rule)
+	return rule.Id, storage.PutKeyVal([]byte(getWarningRuleKey(rule.Id)), b)
+}
+
+func UpdateWarningRule(rule WarningRule) error {
+	if err := rule.Check(); err != nil {
+		return err
+	}
+	InitWarningRuleCache()
+	ruleLock.Lock()
+	if _, ok := allWarningRuleCacheMap[rule.Id]; !ok {
+		ruleLock.Unlock()
+		return fmt.Errorf("rule id:%d not exist", rule.Id)
+	}
+	allWarningRuleCacheMap[rule.Id] = rule
+	ruleLock.Unlock()
+	b, _ := json.Marshal(rule)
+	return storage.PutKeyVal([]byte(getWarningRuleKey(rule.Id)), b)
+}
+
+func DelWarningRule(ID int) error {
+	InitWarningRuleCache()
+	ruleLock.Lock()
+	delete(allWarningRuleCacheMap, ID)
+	ruleLock.Unlock()
+	return storage.DelKeyVal([]byte(getWarningRuleKey(ID)))
+}
+
+func RecoveryWarningRule(content *json.RawMessage) {
+	if content == nil {
+		return
+	}
+	var data []WarningRule
+	err := json.Unmarshal(*content, &data)
+	if err != nil {
+		log.Println("recorery warning rule content errors;", err, " content:", string(*content))
+		return
+	}
+	for _, rule := range data {
+		if rule.Id <= 0 {
+			continue
+		}
+		b, _ := json.Marshal(rule)
+		storage.PutKeyVal([]byte(getWarningRuleKey(rule.Id)), b)
+	}
+	ruleLock.Lock()
+	ruleFirstStartUp = true
+	allWarningRuleCacheMap = make(map[int]WarningRule, 0)
+	ruleLock.Unlock()
+}
+
+func (This *WarningRule) String() string {
+	scope := make([]string, 0)
+	if This.DbName != "" {
+		scope = append(scope, "DbName:"+This.DbName)
+	}
+	if This.SchemaName != "" {
+		scope = append(scope, "SchemaName:"+This.SchemaName)
+	}
+	if This.TableName != "" {
+		scope = append(scope, "TableName:"+This.TableName)
+	}
+	if This.ToServerID != 0 {
+		scope = append(scope, "ToServerID:"+strconv.Itoa(This.ToServerID))
+	}
+	if len(scope) == 0 {
+		scope = append(scope, "all")
+	}
+	return fmt.Sprintf("rule[%d] %s >= %v for %ds (%s)", This.Id, This.Type, This.Threshold, This.Duration, strings.Join(scope, ","))
+}
@@ -0,0 +1,153 @@
+package warning
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// 规则检测的时间间隔
+var RuleCheckInterval = 10 * time.Second
+
+// 一个指标值, 由 server 包采集提供, 数据源级别的指标 SchemaName,TableName,ToServerID 为空
+type RuleSample struct {
+	Type        RuleType
+	DbName      string
+	SchemaName  string
+	TableName   string
+	ToServerID  int
+	ToServerKey string
+	Value       float64
+}
+
+func (This *RuleSample) targetKey() string {
+	return fmt.Sprintf("%s|%s|%s|%d", This.DbName, This.SchemaName, This.TableName, This.ToServerID)
+}
+
+var ruleSampleProvider func() []RuleSample
+
+// server 包在启动的时候设置指标采集方法
+func SetRuleSampleProvider(f func() []RuleSample) {
+	ruleSampleProvider = f
+}
+
+// 每个 规则 + 目标 的检测状态
+type ruleState struct {
+	rule       WarningRule
+	sample     RuleSample
+	since      int64 // 第一次检测到超过阈值的时间
+	notifyTime int64 // 最后一次报警时间, 0 代表还没报过警
+}
+
+type ruleChecker struct {
+	sync.Mutex
+	stateMap map[string]*ruleState
+}
+
+func newRuleChecker() *ruleChecker {
+	return &ruleChecker{stateMap: make(map[string]*ruleState, 0)}
+}
+
+// 检测一次, 返回需要发送的报警内容
+// 持续超过阈值 Duration 秒后报警, 报警后每 Renotify 秒重复报警一次, 恢复的时候发送一次恢复通知
+func (This *ruleChecker) check(now int64, rules []WarningRule, samples []RuleSample) (list []WarningContent) {
+	This.Lock()
+	defer This.Unlock()
+	seen := make(map[string]bool, 0)
+	for _, rule := range rules {
+		for _, sample := range samples {
+			if !rule.Match(sample) || sample.Value < rule.Threshold {
+				continue
+			}
+			key := fmt.Sprintf("%d|%s", rule.Id, sample.targetKey())
+			seen[key] = true
+			state, ok := This.stateMap[key]
+			if !ok {
+				state = &ruleState{since: now}
+				This.stateMap[key] = state
+			}
+			state.rule = rule
+			state.sample = sample
+			if now-state.since < int64(rule.Duration) {
+				continue
+			}
+			if state.notifyTime == 0 || (rule.Renotify > 0 && now-state.notifyTime >= int64(rule.Renotify)) {
+				state.notifyTime = now
+				list = append(list, newRuleWarningContent(WARNINGERROR, state, now))
+			}
+		}
+	}
+	for key, state := range This.stateMap {
+		if seen[key] {
+			continue
+		}
+		// 低于阈值,或者 规则/目标 已经被删除, 报过警的才发恢复通知
+		if state.notifyTime > 0 {
+			list = append(list, newRuleWarningContent(WARNINGNORMAL, state, now))
+		}
+		delete(This.stateMap, key)
+	}
+	return
+}
+
+func newRuleWarningContent(warningType WarningType, state *ruleState, now int64) WarningContent {
+	var body string
+	switch warningType {
+	case WARNINGERROR:
+		body = fmt.Sprintf("%s; value:%v; since:%s", state.rule.String(), state.sample.Value, time.Unix(state.since, 0).Format("2006-01-02 15:04:05"))
+	default:
+		body = fmt.Sprintf("%s; return to normal; lasted:%ds", state.rule.String(), now-state.since)
+	}
+	if state.sample.ToServerKey != "" {
+		body += fmt.Sprintf("; ToServerID:%d; ToServerKey:%s", state.sample.ToServerID, state.sample.ToServerKey)
+	}
+	if state.rule.Notes != "" {
+		body += "; " + state.rule.Notes
+	}
+	return WarningContent{
+		Type:       warningType,
+		DbName:     state.sample.DbName,
+		SchemaName: state.sample.SchemaName,
+		TableName:  state.sample.TableName,
+		Body:       body,
+		configKeys: state.rule.WarningConfigKeys,
+	}
+}
+
+var ruleCheckStartOnce sync.Once
+
+// 启动规则检测协程, 由 server 在恢复完配置之后调用
+func StartRuleCheck() {
+	ruleCheckStartOnce.Do(func() {
+		go ruleCheckLoop(newRuleChecker())
+	})
+}
+
+func ruleCheckLoop(checker *ruleChecker) {
+	ticker := time.NewTicker(RuleCheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		doRuleCheck(checker)
+	}
+}
+
+func doRuleCheck(checker *ruleChecker) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Println("warning rule check err:", err, string(debug.Stack()))
+		}
+	}()
+	if ruleSampleProvider == nil {
+		return
+	}
+	rules := GetWarningRuleList()
+	var samples []RuleSample
+	if len(rules) > 0 {
+		samples = ruleSampleProvider()
+	}
+	for _, content := range checker.check(time.Now().Unix(), rules, samples) {
+		AppendWarning(content)
+	}
+}
@@ -0,0 +1,96 @@
+package warning
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWarningRule_Check(t *testing.T) {
+	Convey("check", t, func() {
+		So((&WarningRule{Type: RULE_DB_LAG, Threshold: 1200}).Check(), ShouldBeNil)
+		So((&WarningRule{Type: "NotExist"}).Check(), ShouldNotBeNil)
+		So((&WarningRule{Type: RULE_DB_LAG, Threshold: -1}).Check(), ShouldNotBeNil)
+		So((&WarningRule{Type: RULE_DB_LAG, Duration: -1}).Check(), ShouldNotBeNil)
+		So((&WarningRule{Type: RULE_DB_LAG, TableName: "binlog_field_test"}).Check(), ShouldNotBeNil)
+		So((&WarningRule{Type: RULE_TOSERVER_QUEUE, TableName: "binlog_field_test", ToServerID: 1}).Check(), ShouldBeNil)
+	})
+}
+
+func TestWarningRule_Match(t *testing.T) {
+	sample := RuleSample{Type: RULE_TOSERVER_QUEUE, DbName: "mysqlTest", SchemaName: "bifrost_test", TableName: "binlog_field_test", ToServerID: 2}
+	Convey("match scope", t, func() {
+		So((&WarningRule{Type: RULE_TOSERVER_QUEUE}).Match(sample), ShouldBeTrue)
+		So((&WarningRule{Type: RULE_TOSERVER_QUEUE, DbName: "mysqlTest", ToServerID: 2}).Match(sample), ShouldBeTrue)
+		So((&WarningRule{Type: RULE_TOSERVER_LAG}).Match(sample), ShouldBeFalse)
+		So((&WarningRule{Type: RULE_TOSERVER_QUEUE, DbName: "other"}).Match(sample), ShouldBeFalse)
+		So((&WarningRule{Type: RULE_TOSERVER_QUEUE, SchemaName: "other"}).Match(sample), ShouldBeFalse)
+		So((&WarningRule{Type: RULE_TOSERVER_QUEUE, ToServerID: 1}).Match(sample), ShouldBeFalse)
+	})
+}
+
+func TestRuleChecker_check(t *testing.T) {
+	rule := WarningRule{Id: 1, Type: RULE_DB_LAG, Threshold: 100, Duration: 60, Renotify: 300, WarningConfigKeys: []string{"bifrost_warning_config_1"}}
+	lagSample := func(value float64) []RuleSample {
+		return []RuleSample{{Type: RULE_DB_LAG, DbName: "mysqlTest", Value: value}}
+	}
+
+	Convey("duration, renotify and recovery", t, func() {
+		checker := newRuleChecker()
+		rules := []WarningRule{rule}
+		So(checker.check(1000, rules, lagSample(50)), ShouldBeEmpty)
+
+		// 超过阈值,但是还没持续 Duration
+		So(checker.check(1010, rules, lagSample(150)), ShouldBeEmpty)
+		So(checker.check(1060, rules, lagSample(200)), ShouldBeEmpty)
+
+		list := checker.check(1070, rules, lagSample(250))
+		So(len(list), ShouldEqual, 1)
+		So(list[0].Type, ShouldEqual, WARNINGERROR)
+		So(list[0].DbName, ShouldEqual, "mysqlTest")
+		So(list[0].configKeys, ShouldResemble, []string{"bifrost_warning_config_1"})
+		So(list[0].Body, ShouldContainSubstring, "value:250")
+
+		// 去重, Renotify 之内不重复报警
+		So(checker.check(1080, rules, lagSample(260)), ShouldBeEmpty)
+		So(checker.check(1369, rules, lagSample(260)), ShouldBeEmpty)
+		So(len(checker.check(1370, rules, lagSample(260))), ShouldEqual, 1)
+
+		list = checker.check(1380, rules, lagSample(10))
+		So(len(list), ShouldEqual, 1)
+		So(list[0].Type, ShouldEqual, WARNINGNORMAL)
+		So(checker.check(1390, rules, lagSample(10)), ShouldBeEmpty)
+	})
+
+	Convey("recovered before duration, no warning", t, func() {
+		checker := newRuleChecker()
+		rules := []WarningRule{rule}
+		So(checker.check(1000, rules, lagSample(150)), ShouldBeEmpty)
+		So(checker.check(1030, rules, lagSample(10)), ShouldBeEmpty)
+		So(checker.check(1070, rules, lagSample(150)), ShouldBeEmpty)
+	})
+
+	Convey("no renotify", t, func() {
+		checker := newRuleChecker()
+		rules := []WarningRule{{Id: 2, Type: RULE_DB_NOT_RUNNING, Threshold: 1}}
+		samples := []RuleSample{{Type: RULE_DB_NOT_RUNNING, DbName: "mysqlTest", Value: 1}}
+		So(len(checker.check(1000, rules, samples)), ShouldEqual, 1)
+		So(checker.check(100000, rules, samples), ShouldBeEmpty)
+	})
+
+	Convey("rule deleted", t, func() {
+		checker := newRuleChecker()
+		So(len(checker.check(1000, []WarningRule{{Id: 3, Type: RULE_DB_LAG, Threshold: 1}}, lagSample(10))), ShouldEqual, 1)
+		list := checker.check(1010, nil, nil)
+		So(len(list), ShouldEqual, 1)
+		So(list[0].Type, ShouldEqual, WARNINGNORMAL)
+	})
+}
+
+func TestInConfigKeys(t *testing.T) {
+	Convey("in config keys", t, func() {
+		So(inConfigKeys(nil, "bifrost_warning_config_1"), ShouldBeTrue)
+		So(inConfigKeys([]string{"bifrost_warning_config_1"}, "bifrost_warning_config_1"), ShouldBeTrue)
+		So(inConfigKeys([]string{"bifrost_warning_config_2"}, "bifrost_warning_config_1"), ShouldBeFalse)
+	})
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"time"
+
+	"github.com/brokercap/Bifrost/server/metrics"
+	"github.com/brokercap/Bifrost/server/warning"
+)
+
+// 启动阈值报警规则检测
+func StartWarningRuleCheck() {
+	warning.SetRuleSampleProvider(GetWarningRuleSamples)
+	warning.StartRuleCheck()
+}
+
+// 采集报警规则需要的指标
+func GetWarningRuleSamples() []warning.RuleSample {
+	now := time.Now().Unix()
+	samples := make([]warning.RuleSample, 0)
+	for _, dbObj := range getMetricsDbList() {
+		dbInfo := getDbMetricsInfo(dbObj)
+		samples = append(samples, getDbWarningRuleSamples(now, dbInfo)...)
+		for _, info := range dbInfo.ToServerList {
+			samples = append(samples, getToServerWarningRuleSamples(now, dbInfo.Name, info)...)
+		}
+	}
+	return samples
+}
+
+func getDbWarningRuleSamples(now int64, dbInfo dbMetricsInfo) []warning.RuleSample {
+	samples := []warning.RuleSample{
+		{Type: warning.RULE_DB_NOT_RUNNING, DbName: dbInfo.Name, Value: metrics.BoolToFloat(dbInfo.ConnStatus != RUNNING)},
+	}
+	// 没有运行的时候,位点不会再更新,延时由 DbNotRunning 规则报警
+	if dbInfo.ConnStatus == RUNNING {
+		samples = append(samples, warning.RuleSample{Type: warning.RULE_DB_LAG, DbName: dbInfo.Name, Value: lagSeconds(now, dbInfo.BinlogDumpTimestamp)})
+	}
+	return samples
+}
+
+func getToServerWarningRuleSamples(now int64, dbName string, info toServerMetricsInfo) []warning.RuleSample {
+	var newSample = func(ruleType warning.RuleType, value float64) warning.RuleSample {
+		return warning.RuleSample{
+			Type:        ruleType,
+			DbName:      dbName,
+			SchemaName:  info.Labels["schema"],
+			TableName:   info.Labels["table"],
+			ToServerID:  info.ToServerID,
+			ToServerKey: info.Labels["to_server_key"],
+			Value:       value,
+		}
+	}
+	var stalledSeconds float64
+	switch info.Status {
+	case STOPPING, STOPPED:
+		// 人工暂停的不算卡住
+	default:
+		if info.QueueMsgCount > 0 && info.LastConsumeTime > 0 && now > info.LastConsumeTime {
+			stalledSeconds = float64(now - info.LastConsumeTime)
+		}
+	}
+	// 队列里没有待同步的数据,说明已经追上了,延时为 0 ,防止源表长时间没有写入的时候误报
+	var lag float64
+	if info.QueueMsgCount > 0 || info.FileQueueStatus {
+		lag = lagSeconds(now, info.LastSuccessBinlog.Timestamp)
+	}
+	return []warning.RuleSample{
+		newSample(warning.RULE_TOSERVER_LAG, lag),
+		newSample(warning.RULE_TOSERVER_QUEUE, float64(info.QueueMsgCount)),
+		newSample(warning.RULE_TOSERVER_STALLED, stalledSeconds),
+		newSample(warning.RULE_FILEQUEUE_SIZE, float64(info.FileQueueBytes)),
+	}
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/brokercap/Bifrost/server/metrics"
+	"github.com/brokercap/Bifrost/server/warning"
+)
+
+func TestGetToServerWarningRuleSamples(t *testing.T) {
+	getValue := func(samples []warning.RuleSample, ruleType warning.RuleType) float64 {
+		for _, sample := range samples {
+			if sample.Type == ruleType {
+				return sample.Value
+			}
+		}
+		return -1
+	}
+	info := toServerMetricsInfo{
+		Labels:            metrics.Labels{"schema": "bifrost_test", "table": "binlog_field_test", "to_server_key": "mysqlTarget"},
+		ToServerID:        1,
+		Status:            RUNNING,
+		LastConsumeTime:   900,
+		LastSuccessBinlog: PositionStruct{Timestamp: 800},
+		FileQueueBytes:    1024,
+	}
+
+	Convey("queue empty, no lag and not stalled", t, func() {
+		samples := getToServerWarningRuleSamples(1000, "mysqlTest", info)
+		So(samples[0].DbName, ShouldEqual, "mysqlTest")
+		So(samples[0].TableName, ShouldEqual, "binlog_field_test")
+		So(samples[0].ToServerID, ShouldEqual, 1)
+		So(getValue(samples, warning.RULE_TOSERVER_LAG), ShouldEqual, 0)
+		So(getValue(samples, warning.RULE_TOSERVER_STALLED), ShouldEqual, 0)
+		So(getValue(samples, warning.RULE_FILEQUEUE_SIZE), ShouldEqual, 1024)
+	})
+
+	Convey("queue not empty", t, func() {
+		info.QueueMsgCount = 10
+		samples := getToServerWarningRuleSamples(1000, "mysqlTest", info)
+		So(getValue(samples, warning.RULE_TOSERVER_LAG), ShouldEqual, 200)
+		So(getValue(samples, warning.RULE_TOSERVER_QUEUE), ShouldEqual, 10)
+		So(getValue(samples, warning.RULE_TOSERVER_STALLED), ShouldEqual, 100)
+	})
+
+	Convey("stopped by user, not stalled", t, func() {
+		info.QueueMsgCount = 10
+		info.Status = STOPPED
+		samples := getToServerWarningRuleSamples(1000, "mysqlTest", info)
+		So(getValue(samples, warning.RULE_TOSERVER_STALLED), ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,297 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+)
+
+// 增量快照(DBLog 算法)的水位线
+// 拉取一个主键区间的数据之前往信号表写一条低水位, 拉完之后再写一条高水位
+// 信号表的 binlog 按顺序转成 watermark 事件, 和要拉取的表的增量数据一起进入同步配置的队列
+// 同步配置在 低水位 和 高水位 之间收到的增量数据, 主键在区间数据里的, 以增量数据为准, 区间里去掉这些主键
+// 收到高水位的时候, 区间里剩下的数据当成 insert 同步, 全量和增量交替进行, 不需要锁表, 也不需要长事务
+
+const WATERMARK_EVENT = "watermark"
+
+type WatermarkChunk struct {
+	sync.Mutex
+	DbName         string
+	SignalSchema   string // 信号表
+	SignalTable    string
+	SchemaName     string // 拉取数据的表
+	TableName      string
+	BindKey        string // 同步配置所在的表, 模糊匹配的表是 schema-table_*
+	ToServerIDList []int
+	Low            string // 低水位 id
+	High           string // 高水位 id
+	Pri            []string
+	ColumnMapping  map[string]string
+	rows           []map[string]interface{}
+	doneMap        map[int]bool // ToServerID => 是否成功处理完这个区间
+	doneChan       chan bool
+	finished       bool
+}
+
+var watermarkLock sync.RWMutex
+var watermarkChunkMap = make(map[string]*WatermarkChunk, 0)
+var watermarkChunkCount int32
+
+func watermarkMapKey(dbName, id string) string {
+	return dbName + "|" + id
+}
+
+// 注册一个区间, 要在写低水位之前注册
+func AddWatermarkChunk(chunk *WatermarkChunk) {
+	chunk.Lock()
+	chunk.doneMap = make(map[int]bool, 0)
+	chunk.doneChan = make(chan bool, 1)
+	chunk.Unlock()
+	watermarkLock.Lock()
+	defer watermarkLock.Unlock()
+	watermarkChunkMap[watermarkMapKey(chunk.DbName, chunk.Low)] = chunk
+	watermarkChunkMap[watermarkMapKey(chunk.DbName, chunk.High)] = chunk
+	atomic.StoreInt32(&watermarkChunkCount, int32(len(watermarkChunkMap)))
+}
+
+func DelWatermarkChunk(chunk *WatermarkChunk) {
+	watermarkLock.Lock()
+	defer watermarkLock.Unlock()
+	delete(watermarkChunkMap, watermarkMapKey(chunk.DbName, chunk.Low))
+	delete(watermarkChunkMap, watermarkMapKey(chunk.DbName, chunk.High))
+	atomic.StoreInt32(&watermarkChunkCount, int32(len(watermarkChunkMap)))
+}
+
+func getWatermarkChunk(dbName, id string) *WatermarkChunk {
+	if atomic.LoadInt32(&watermarkChunkCount) == 0 {
+		return nil
+	}
+	watermarkLock.RLock()
+	defer watermarkLock.RUnlock()
+	return watermarkChunkMap[watermarkMapKey(dbName, id)]
+}
+
+// 区间数据, 在写高水位之前设置
+func (This *WatermarkChunk) SetRows(rows []map[string]interface{}) {
+	This.Lock()
+	defer This.Unlock()
+	This.rows = rows
+}
+
+// 所有同步配置都处理完这个区间之后返回, ok 为 false 说明有同步配置没收到低水位, 需要重新拉这个区间
+func (This *WatermarkChunk) Done() <-chan bool {
+	return This.doneChan
+}
+
+func (This *WatermarkChunk) isMyToServer(toServer *ToServer) bool {
+	if toServer.Key == nil || *toServer.Key != This.BindKey {
+		return false
+	}
+	for _, ID := range This.ToServerIDList {
+		if ID == toServer.ToServerID {
+			return true
+		}
+	}
+	return false
+}
+
+func (This *WatermarkChunk) done(ToServerID int, ok bool) {
+	This.Lock()
+	defer This.Unlock()
+	if _, exist := This.doneMap[ToServerID]; exist {
+		return
+	}
+	This.doneMap[ToServerID] = ok
+	if This.finished {
+		return
+	}
+	if ok && len(This.doneMap) < len(This.ToServerIDList) {
+		return
+	}
+	This.finished = true
+	This.doneChan <- ok
+}
+
+// 主键值拼成字符串, 用于判断增量数据是否在区间里
+// 区间数据是查询出来的, 增量数据是 binlog 解析出来的, 同一个值的类型可能不一样, 按 ColumnMapping 转成一样的格式
+func (This *WatermarkChunk) priKey(row map[string]interface{}) string {
+	keys := make([]string, len(This.Pri))
+	for i, name := range This.Pri {
+		keys[i] = watermarkKeyValue(This.ColumnMapping[name], row[name])
+	}
+	return strings.Join(keys, "\x00")
+}
+
+func watermarkKeyValue(columnType string, v interface{}) string {
+	if v == nil {
+		return "\x01NULL"
+	}
+	if strings.Index(columnType, "Nullable(") == 0 {
+		columnType = columnType[len("Nullable(") : len(columnType)-1]
+	}
+	if b, ok := v.([]byte); ok {
+		v = string(b)
+	}
+	switch {
+	case columnType == "bool":
+		switch val := v.(type) {
+		case bool:
+			if val {
+				return "1"
+			}
+			return "0"
+		}
+	case columnType == "float" || columnType == "double":
+		bitSize := 64
+		if columnType == "float" {
+			bitSize = 32
+		}
+		var f float64
+		switch val := v.(type) {
+		case float32:
+			f = float64(val)
+		case float64:
+			f = val
+		case string:
+			var err error
+			if f, err = strconv.ParseFloat(val, bitSize); err != nil {
+				return val
+			}
+		default:
+			return fmt.Sprint(v)
+		}
+		return strconv.FormatFloat(f, 'g', -1, bitSize)
+	case strings.Index(columnType, "datetime") == 0 || strings.Index(columnType, "timestamp") == 0 || strings.Index(columnType, "date") == 0:
+		if t, ok := v.(time.Time); ok {
+			layout := "2006-01-02 15:04:05"
+			if columnType == "date" {
+				layout = "2006-01-02"
+			} else if n := strings.Index(columnType, "("); n > 0 {
+				if fsp, err := strconv.Atoi(strings.TrimSuffix(columnType[n+1:], ")")); err == nil && fsp > 0 {
+					layout += "." + strings.Repeat("0", fsp)
+				}
+			}
+			return t.Format(layout)
+		}
+	}
+	return fmt.Sprint(v)
+}
+
+// 信号表的数据, 转成 watermark 事件发给拉取数据的表
+// 返回 true 说明是水位线, 不需要再按普通数据处理
+func (db *db) callbackWatermark(data *pluginDriver.PluginDataType) bool {
+	if atomic.LoadInt32(&watermarkChunkCount) == 0 || data.EventType != "insert" || len(data.Rows) == 0 {
+		return false
+	}
+	id, _ := data.Rows[0]["id"].(string)
+	if id == "" {
+		return false
+	}
+	chunk := getWatermarkChunk(db.Name, id)
+	if chunk == nil || chunk.SignalSchema != data.SchemaName || chunk.SignalTable != data.TableName {
+		return false
+	}
+	db.Callback0(&pluginDriver.PluginDataType{
+		Timestamp:       data.Timestamp,
+		EventType:       WATERMARK_EVENT,
+		SchemaName:      chunk.SchemaName,
+		TableName:       chunk.TableName,
+		AliasSchemaName: chunk.SchemaName,
+		AliasTableName:  chunk.TableName,
+		Query:           id,
+		BinlogFileNum:   data.BinlogFileNum,
+		BinlogPosition:  data.BinlogPosition,
+		Gtid:            data.Gtid,
+		EventID:         data.EventID,
+		PayloadIndex:    data.PayloadIndex,
+	})
+	return true
+}
+
+// 同步配置 低水位 和 高水位 之间的状态
+type watermarkWindow struct {
+	chunk *WatermarkChunk
+	seen  map[string]bool // 窗口内增量数据出现过的主键
+}
+
+// 处理 watermark 事件
+// 低水位 打开窗口, 高水位 关闭窗口, 返回区间里剩下的数据, 为 nil 则不需要同步
+func (This *ToServer) dealWatermark(dbName string, data *pluginDriver.PluginDataType) (*pluginDriver.PluginDataType, *WatermarkChunk) {
+	chunk := getWatermarkChunk(dbName, data.Query)
+	if chunk == nil || !chunk.isMyToServer(This) {
+		return nil, nil
+	}
+	if data.Query == chunk.Low {
+		This.watermarkWindow = &watermarkWindow{chunk: chunk, seen: make(map[string]bool, 0)}
+		return nil, nil
+	}
+	window := This.watermarkWindow
+	This.watermarkWindow = nil
+	if window == nil || window.chunk != chunk {
+		// 重启或者队列数据丢了, 没收到低水位, 不能确定区间数据是不是最新的
+		log.Println("ToServer ", *This.Key, This.ToServerKey, This.ToServerID, " watermark:", data.Query, " low watermark not found")
+		chunk.done(This.ToServerID, false)
+		return nil, nil
+	}
+	chunk.Lock()
+	rows := make([]map[string]interface{}, 0, len(chunk.rows))
+	for _, row := range chunk.rows {
+		if window.seen[chunk.priKey(row)] {
+			continue
+		}
+		rows = append(rows, row)
+	}
+	chunk.Unlock()
+	if len(rows) == 0 {
+		chunk.done(This.ToServerID, true)
+		return nil, nil
+	}
+	d := &pluginDriver.PluginDataType{
+		Timestamp:      data.Timestamp,
+		EventType:      "insert",
+		SchemaName:     chunk.SchemaName,
+		TableName:      chunk.TableName,
+		Rows:           rows,
+		BinlogFileNum:  data.BinlogFileNum,
+		BinlogPosition: data.BinlogPosition,
+		Gtid:           data.Gtid,
+		Pri:            chunk.Pri,
+		ColumnMapping:  chunk.ColumnMapping,
+		EventID:        data.EventID,
+		PayloadIndex:   data.PayloadIndex,
+	}
+	filterData, err := This.filterRows(d)
+	if err != nil {
+		log.Println("ToServer ", *This.Key, This.ToServerKey, This.ToServerID, " watermark:", data.Query, " filterRows err:", err)
+		chunk.done(This.ToServerID, false)
+		return nil, nil
+	}
+	if len(filterData) == 0 {
+		chunk.done(This.ToServerID, true)
+		return nil, nil
+	}
+	return filterData[0], chunk
+}
+
+// 窗口内的增量数据, 记录主键
+func (This *ToServer) watermarkWindowAdd(data *pluginDriver.PluginDataType) {
+	window := This.watermarkWindow
+	if window == nil {
+		return
+	}
+	if data.SchemaName != window.chunk.SchemaName || data.TableName != window.chunk.TableName {
+		return
+	}
+	switch data.EventType {
+	case "insert", "update", "delete":
+		for _, row := range data.Rows {
+			window.seen[window.chunk.priKey(row)] = true
+		}
+	}
+}
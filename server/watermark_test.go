@@ -0,0 +1,146 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	pluginDriver "github.com/brokercap/Bifrost/plugin/driver"
+)
+
+func TestToServer_dealWatermark(t *testing.T) {
+	key := GetSchemaAndTableJoin("bifrost_test", "binlog_field_test")
+	newChunk := func() *WatermarkChunk {
+		chunk := &WatermarkChunk{
+			DbName:         "mysqlTest",
+			SignalSchema:   "bifrost_test",
+			SignalTable:    "bifrost_signal",
+			SchemaName:     "bifrost_test",
+			TableName:      "binlog_field_test",
+			BindKey:        key,
+			ToServerIDList: []int{1, 2},
+			Low:            "bifrost-1-1-low",
+			High:           "bifrost-1-1-high",
+			Pri:            []string{"id"},
+		}
+		AddWatermarkChunk(chunk)
+		chunk.SetRows([]map[string]interface{}{{"id": int64(1)}, {"id": int64(2)}, {"id": int64(3)}})
+		return chunk
+	}
+	watermark := func(id string) *pluginDriver.PluginDataType {
+		return &pluginDriver.PluginDataType{EventType: WATERMARK_EVENT, Query: id, BinlogFileNum: 1, BinlogPosition: 100}
+	}
+	newToServer := func(ID int) *ToServer {
+		return &ToServer{Key: &key, ToServerID: ID}
+	}
+
+	Convey("rows changed between watermarks are not synced", t, func() {
+		chunk := newChunk()
+		defer DelWatermarkChunk(chunk)
+		toServer := newToServer(1)
+		data, c := toServer.dealWatermark("mysqlTest", watermark(chunk.Low))
+		So(data, ShouldBeNil)
+		So(c, ShouldBeNil)
+
+		// binlog 解析出来的是 int32, 也要能匹配上
+		toServer.watermarkWindowAdd(&pluginDriver.PluginDataType{
+			EventType:  "update",
+			SchemaName: "bifrost_test",
+			TableName:  "binlog_field_test",
+			Rows:       []map[string]interface{}{{"id": int32(2)}, {"id": int32(2)}},
+		})
+		// 别的表的数据不影响
+		toServer.watermarkWindowAdd(&pluginDriver.PluginDataType{
+			EventType:  "delete",
+			SchemaName: "bifrost_test",
+			TableName:  "other_table",
+			Rows:       []map[string]interface{}{{"id": int32(3)}},
+		})
+
+		data, c = toServer.dealWatermark("mysqlTest", watermark(chunk.High))
+		So(c, ShouldEqual, chunk)
+		So(data.EventType, ShouldEqual, "insert")
+		So(data.Rows, ShouldResemble, []map[string]interface{}{{"id": int64(1)}, {"id": int64(3)}})
+		So(data.BinlogPosition, ShouldEqual, 100)
+		So(toServer.watermarkWindow, ShouldBeNil)
+
+		c.done(1, true)
+		var finished bool
+		select {
+		case <-chunk.Done():
+			finished = true
+		default:
+		}
+		So(finished, ShouldBeFalse)
+
+		Convey("done after all ToServer", func() {
+			toServer2 := newToServer(2)
+			toServer2.dealWatermark("mysqlTest", watermark(chunk.Low))
+			data, c = toServer2.dealWatermark("mysqlTest", watermark(chunk.High))
+			So(len(data.Rows), ShouldEqual, 3)
+			c.done(2, true)
+			So(<-chunk.Done(), ShouldBeTrue)
+		})
+	})
+
+	Convey("high watermark without low watermark", t, func() {
+		chunk := newChunk()
+		defer DelWatermarkChunk(chunk)
+		data, c := newToServer(1).dealWatermark("mysqlTest", watermark(chunk.High))
+		So(data, ShouldBeNil)
+		So(c, ShouldBeNil)
+		So(<-chunk.Done(), ShouldBeFalse)
+	})
+
+	Convey("other ToServer ignore watermark", t, func() {
+		chunk := newChunk()
+		defer DelWatermarkChunk(chunk)
+		toServer := newToServer(3)
+		toServer.dealWatermark("mysqlTest", watermark(chunk.Low))
+		So(toServer.watermarkWindow, ShouldBeNil)
+	})
+}
+
+func TestWatermarkChunk_priKey(t *testing.T) {
+	Convey("query rows and binlog rows with different types", t, func() {
+		chunk := &WatermarkChunk{
+			Pri: []string{"id", "code", "flag", "rate", "created_at", "day", "uid"},
+			ColumnMapping: map[string]string{
+				"id":         "uint64",
+				"code":       "varbinary(16)",
+				"flag":       "bool",
+				"rate":       "float",
+				"created_at": "Nullable(datetime(3))",
+				"day":        "date",
+				"uid":        "Nullable(int32)",
+			},
+		}
+		createdAt := time.Date(2024, 1, 2, 3, 4, 5, 120000000, time.UTC)
+		queryRow := map[string]interface{}{
+			"id":         int64(10),
+			"code":       []byte("a1"),
+			"flag":       true,
+			"rate":       float64(float32(1.1)),
+			"created_at": createdAt,
+			"day":        createdAt,
+			"uid":        nil,
+		}
+		binlogRow := map[string]interface{}{
+			"id":         uint64(10),
+			"code":       "a1",
+			"flag":       int8(1),
+			"rate":       float32(1.1),
+			"created_at": "2024-01-02 03:04:05.120",
+			"day":        "2024-01-02",
+			"uid":        nil,
+		}
+		So(chunk.priKey(queryRow), ShouldEqual, chunk.priKey(binlogRow))
+
+		binlogRow["uid"] = int32(0)
+		So(chunk.priKey(queryRow), ShouldNotEqual, chunk.priKey(binlogRow))
+		binlogRow["uid"] = nil
+		binlogRow["flag"] = false
+		So(chunk.priKey(queryRow), ShouldNotEqual, chunk.priKey(binlogRow))
+	})
+}
@@ -2,9 +2,11 @@ package driver
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"sync"
+	"time"
 )
 
 var (
@@ -30,6 +32,25 @@ type XdbDriver interface {
 	Close() error
 }
 
+// 支持租约的驱动, 多个 Bifrost 进程共用同一个存储的时候, 用于选主
+type LeaseDriver interface {
+	// key 不存在的时候写入 val 并设置过期时间, 写入成功返回 true
+	AcquireLease(key []byte, val []byte, ttl time.Duration) (bool, error)
+	// key 的值等于 val 的时候, 重新设置过期时间
+	RenewLease(key []byte, val []byte, ttl time.Duration) (bool, error)
+	// key 的值等于 val 的时候, 删除 key
+	ReleaseLease(key []byte, val []byte) error
+	// 原子加 1, 返回加 1 之后的值
+	Incr(key []byte) (int64, error)
+	// tokenKey 的值等于 token 的时候才写入, 否则返回 ErrFencingToken
+	PutKeyValByToken(tokenKey []byte, token int64, key []byte, val []byte) error
+	// tokenKey 的值等于 token 的时候才删除, 否则返回 ErrFencingToken
+	DelKeyValByToken(tokenKey []byte, token int64, key []byte) error
+}
+
+// 存储里的 fencing token 已经变了, 说明别的节点已经成为 leader
+var ErrFencingToken = errors.New("fencing token changed")
+
 type ListValue struct {
 	Key   string
 	Value string
@@ -6,7 +6,10 @@ import (
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/util"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 const VERSION = "v1.1.0"
@@ -35,6 +38,15 @@ type Conn struct {
 	path    string
 	err     error
 	levelDB *leveldb.DB
+
+	leaseLock sync.Mutex
+	leaseMap  map[string]*lease
+}
+
+// leveldb 只能被一个进程打开, 租约只需要在进程内有效, 不落盘
+type lease struct {
+	val    string
+	expire time.Time
 }
 
 func (This *Conn) connect() error {
@@ -78,3 +90,84 @@ func (This *Conn) GetListByKeyPrefix(key []byte) ([]driver.ListValue, error) {
 	iter.Release()
 	return data, nil
 }
+
+func (This *Conn) AcquireLease(key []byte, val []byte, ttl time.Duration) (bool, error) {
+	This.leaseLock.Lock()
+	defer This.leaseLock.Unlock()
+	if This.leaseMap == nil {
+		This.leaseMap = make(map[string]*lease, 0)
+	}
+	if v, ok := This.leaseMap[string(key)]; ok && time.Now().Before(v.expire) {
+		return false, nil
+	}
+	This.leaseMap[string(key)] = &lease{val: string(val), expire: time.Now().Add(ttl)}
+	return true, nil
+}
+
+func (This *Conn) RenewLease(key []byte, val []byte, ttl time.Duration) (bool, error) {
+	This.leaseLock.Lock()
+	defer This.leaseLock.Unlock()
+	v, ok := This.leaseMap[string(key)]
+	if !ok || v.val != string(val) || time.Now().After(v.expire) {
+		return false, nil
+	}
+	v.expire = time.Now().Add(ttl)
+	return true, nil
+}
+
+func (This *Conn) ReleaseLease(key []byte, val []byte) error {
+	This.leaseLock.Lock()
+	defer This.leaseLock.Unlock()
+	if v, ok := This.leaseMap[string(key)]; ok && v.val == string(val) {
+		delete(This.leaseMap, string(key))
+	}
+	return nil
+}
+
+func (This *Conn) Incr(key []byte) (int64, error) {
+	This.leaseLock.Lock()
+	defer This.leaseLock.Unlock()
+	s, err := This.GetKeyVal(key)
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	if len(s) > 0 {
+		n, err = strconv.ParseInt(string(s), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+	}
+	n++
+	return n, This.PutKeyVal(key, []byte(strconv.FormatInt(n, 10)))
+}
+
+func (This *Conn) PutKeyValByToken(tokenKey []byte, token int64, key []byte, val []byte) error {
+	This.leaseLock.Lock()
+	defer This.leaseLock.Unlock()
+	if err := This.checkToken(tokenKey, token); err != nil {
+		return err
+	}
+	return This.PutKeyVal(key, val)
+}
+
+func (This *Conn) DelKeyValByToken(tokenKey []byte, token int64, key []byte) error {
+	This.leaseLock.Lock()
+	defer This.leaseLock.Unlock()
+	if err := This.checkToken(tokenKey, token); err != nil {
+		return err
+	}
+	return This.DelKeyVal(key)
+}
+
+// 和 Incr 在同一个锁里, 检查完写入之前 token 不会变
+func (This *Conn) checkToken(tokenKey []byte, token int64) error {
+	s, err := This.GetKeyVal(tokenKey)
+	if err != nil {
+		return err
+	}
+	if string(s) != strconv.FormatInt(token, 10) {
+		return driver.ErrFencingToken
+	}
+	return nil
+}
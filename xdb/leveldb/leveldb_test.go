@@ -0,0 +1,74 @@
+package leveldb
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/brokercap/Bifrost/xdb/driver"
+)
+
+func TestConn_Lease(t *testing.T) {
+	conn, err := newConn(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	Convey("lease", t, func() {
+		key := []byte("leader")
+		ok, err := conn.AcquireLease(key, []byte("node1"), 50*time.Millisecond)
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeTrue)
+
+		ok, _ = conn.AcquireLease(key, []byte("node2"), 50*time.Millisecond)
+		So(ok, ShouldBeFalse)
+		ok, _ = conn.RenewLease(key, []byte("node2"), 50*time.Millisecond)
+		So(ok, ShouldBeFalse)
+		ok, _ = conn.RenewLease(key, []byte("node1"), 50*time.Millisecond)
+		So(ok, ShouldBeTrue)
+
+		// 过期之后别的节点可以拿到, 原来的节点不能再续期
+		time.Sleep(60 * time.Millisecond)
+		ok, _ = conn.AcquireLease(key, []byte("node2"), 50*time.Millisecond)
+		So(ok, ShouldBeTrue)
+		ok, _ = conn.RenewLease(key, []byte("node1"), 50*time.Millisecond)
+		So(ok, ShouldBeFalse)
+
+		So(conn.ReleaseLease(key, []byte("node1")), ShouldBeNil)
+		ok, _ = conn.AcquireLease(key, []byte("node1"), 50*time.Millisecond)
+		So(ok, ShouldBeFalse)
+		So(conn.ReleaseLease(key, []byte("node2")), ShouldBeNil)
+		ok, _ = conn.AcquireLease(key, []byte("node1"), 50*time.Millisecond)
+		So(ok, ShouldBeTrue)
+	})
+
+	Convey("incr", t, func() {
+		n, err := conn.Incr([]byte("token"))
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 1)
+		n, _ = conn.Incr([]byte("token"))
+		So(n, ShouldEqual, 2)
+	})
+
+	Convey("write by fencing token", t, func() {
+		tokenKey, key := []byte("fencing_token"), []byte("dbSourceData")
+		token, _ := conn.Incr(tokenKey)
+		So(conn.PutKeyValByToken(tokenKey, token, key, []byte("leader1")), ShouldBeNil)
+
+		// 别的节点成为 leader 之后, 旧 leader 不能再写
+		newToken, _ := conn.Incr(tokenKey)
+		So(conn.PutKeyValByToken(tokenKey, token, key, []byte("stale")), ShouldEqual, driver.ErrFencingToken)
+		So(conn.DelKeyValByToken(tokenKey, token, key), ShouldEqual, driver.ErrFencingToken)
+		val, _ := conn.GetKeyVal(key)
+		So(string(val), ShouldEqual, "leader1")
+
+		So(conn.PutKeyValByToken(tokenKey, newToken, key, []byte("leader2")), ShouldBeNil)
+		val, _ = conn.GetKeyVal(key)
+		So(string(val), ShouldEqual, "leader2")
+		So(conn.DelKeyValByToken(tokenKey, newToken, key), ShouldBeNil)
+		val, _ = conn.GetKeyVal(key)
+		So(val, ShouldBeNil)
+	})
+}
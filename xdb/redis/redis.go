@@ -178,3 +178,78 @@ func (This *Conn) GetListByKeyPrefix(key []byte) ([]driver.ListValue, error) {
 	}
 	return data, nil
 }
+
+// 值相等才续期, 防止把别人的租约续上
+var renewLeaseScript = redis.NewScript(`if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("pexpire", KEYS[1], ARGV[2]) else return 0 end`)
+
+var releaseLeaseScript = redis.NewScript(`if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`)
+
+func (This *Conn) AcquireLease(key []byte, val []byte, ttl time.Duration) (bool, error) {
+	This.InitConn()
+	ok, err := This.conn.SetNX(ctx, string(key), string(val), ttl).Result()
+	if err != nil {
+		This.Close()
+		return false, err
+	}
+	return ok, nil
+}
+
+func (This *Conn) RenewLease(key []byte, val []byte, ttl time.Duration) (bool, error) {
+	This.InitConn()
+	n, err := renewLeaseScript.Run(ctx, This.conn, []string{string(key)}, string(val), ttl.Milliseconds()).Int64()
+	if err != nil {
+		This.Close()
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func (This *Conn) ReleaseLease(key []byte, val []byte) error {
+	This.InitConn()
+	err := releaseLeaseScript.Run(ctx, This.conn, []string{string(key)}, string(val)).Err()
+	if err != nil && err.Error() != "redis: nil" {
+		This.Close()
+		return err
+	}
+	return nil
+}
+
+func (This *Conn) Incr(key []byte) (int64, error) {
+	This.InitConn()
+	n, err := This.conn.Incr(ctx, string(key)).Result()
+	if err != nil {
+		This.Close()
+		return 0, err
+	}
+	return n, nil
+}
+
+// fencing token 没变才写入, 防止租约过期的旧 leader 覆盖新 leader 写的数据
+// 两个 key 要在同一个节点上, 不支持 redis cluster
+var putKeyValByTokenScript = redis.NewScript(`if redis.call("get", KEYS[1]) == ARGV[1] then redis.call("set", KEYS[2], ARGV[2]) return 1 else return 0 end`)
+
+var delKeyValByTokenScript = redis.NewScript(`if redis.call("get", KEYS[1]) == ARGV[1] then redis.call("del", KEYS[2]) return 1 else return 0 end`)
+
+func (This *Conn) PutKeyValByToken(tokenKey []byte, token int64, key []byte, val []byte) error {
+	return This.runByToken(putKeyValByTokenScript, []string{string(tokenKey), string(key)}, strconv.FormatInt(token, 10), string(val))
+}
+
+func (This *Conn) DelKeyValByToken(tokenKey []byte, token int64, key []byte) error {
+	return This.runByToken(delKeyValByTokenScript, []string{string(tokenKey), string(key)}, strconv.FormatInt(token, 10))
+}
+
+func (This *Conn) runByToken(script *redis.Script, keys []string, args ...interface{}) error {
+	This.InitConn()
+	if _, ok := This.conn.(*redis.ClusterClient); ok {
+		return fmt.Errorf("redis cluster not support fencing token")
+	}
+	n, err := script.Run(ctx, This.conn, keys, args...).Int64()
+	if err != nil {
+		This.Close()
+		return err
+	}
+	if n != 1 {
+		return driver.ErrFencingToken
+	}
+	return nil
+}
@@ -2,7 +2,9 @@ package xdb
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/brokercap/Bifrost/xdb/driver"
+	"time"
 )
 
 import (
@@ -100,6 +102,62 @@ func (This *Client) GetListByKeyPrefix(table, key string, data interface{}) ([]d
 	return s, err
 }
 
+func (This *Client) leaseDriver() (driver.LeaseDriver, error) {
+	leaseDriver, ok := This.client.(driver.LeaseDriver)
+	if !ok {
+		return nil, fmt.Errorf("xdb driver not support lease")
+	}
+	return leaseDriver, nil
+}
+
+func (This *Client) AcquireLease(table, key string, val []byte, ttl time.Duration) (bool, error) {
+	leaseDriver, err := This.leaseDriver()
+	if err != nil {
+		return false, err
+	}
+	return leaseDriver.AcquireLease([]byte(This.prefix+"-"+table+"-"+key), val, ttl)
+}
+
+func (This *Client) RenewLease(table, key string, val []byte, ttl time.Duration) (bool, error) {
+	leaseDriver, err := This.leaseDriver()
+	if err != nil {
+		return false, err
+	}
+	return leaseDriver.RenewLease([]byte(This.prefix+"-"+table+"-"+key), val, ttl)
+}
+
+func (This *Client) ReleaseLease(table, key string, val []byte) error {
+	leaseDriver, err := This.leaseDriver()
+	if err != nil {
+		return err
+	}
+	return leaseDriver.ReleaseLease([]byte(This.prefix+"-"+table+"-"+key), val)
+}
+
+func (This *Client) Incr(table, key string) (int64, error) {
+	leaseDriver, err := This.leaseDriver()
+	if err != nil {
+		return 0, err
+	}
+	return leaseDriver.Incr([]byte(This.prefix + "-" + table + "-" + key))
+}
+
+func (This *Client) PutKeyValBytesByToken(table, key string, val []byte, tokenKey string, token int64) error {
+	leaseDriver, err := This.leaseDriver()
+	if err != nil {
+		return err
+	}
+	return leaseDriver.PutKeyValByToken([]byte(This.prefix+"-"+table+"-"+tokenKey), token, []byte(This.prefix+"-"+table+"-"+key), val)
+}
+
+func (This *Client) DelKeyValByToken(table, key string, tokenKey string, token int64) error {
+	leaseDriver, err := This.leaseDriver()
+	if err != nil {
+		return err
+	}
+	return leaseDriver.DelKeyValByToken([]byte(This.prefix+"-"+table+"-"+tokenKey), token, []byte(This.prefix+"-"+table+"-"+key))
+}
+
 func (This *Client) Close() error {
 	return This.client.Close()
 }